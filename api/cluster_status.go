@@ -2,8 +2,26 @@ package api
 
 // ClusterStatus describes the status of a cluster.
 type ClusterStatus struct {
-	CurrentVersion string     `json:"current_version" yaml:"current_version"`
-	LastVersion    string     `json:"last_version"    yaml:"last_version"`
-	NextVersion    string     `json:"next_version"    yaml:"next_version"`
-	Problems       []*Problem `json:"problems"        yaml:"problems"`
+	CurrentVersion string        `json:"current_version" yaml:"current_version"`
+	LastVersion    string        `json:"last_version"    yaml:"last_version"`
+	NextVersion    string        `json:"next_version"    yaml:"next_version"`
+	Problems       []*Problem    `json:"problems"        yaml:"problems"`
+	AuditLog       string        `json:"audit_log"       yaml:"audit_log"`
+	CostEstimate   *CostEstimate `json:"cost_estimate"   yaml:"cost_estimate"`
+	// ForceDeletedPods are the pods which had to be force deleted while
+	// draining nodes in the last provisioning run.
+	ForceDeletedPods []string `json:"force_deleted_pods" yaml:"force_deleted_pods"`
+	// Degraded is set if the cluster is quarantined after failing to be
+	// provisioned several times in a row, it's retried after
+	// QuarantinedUntil (RFC3339).
+	Degraded         bool   `json:"degraded"          yaml:"degraded"`
+	QuarantinedUntil string `json:"quarantined_until" yaml:"quarantined_until"`
+}
+
+// CostEstimate describes the estimated monthly cost of the instances of a
+// cluster.
+type CostEstimate struct {
+	MinMonthly float64 `json:"min_monthly" yaml:"min_monthly"`
+	MaxMonthly float64 `json:"max_monthly" yaml:"max_monthly"`
+	Currency   string  `json:"currency"    yaml:"currency"`
 }
@@ -123,6 +123,10 @@ func TestVersion(t *testing.T) {
 	require.NoError(t, err)
 
 	for _, field := range fields {
+		if field == "Status" {
+			continue
+		}
+
 		cluster := sampleCluster()
 		err := permute(cluster.NodePools[0], field)
 		require.NoError(t, err, "node pool field: %s", field)
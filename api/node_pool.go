@@ -1,6 +1,9 @@
 package api
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
 // NodePool describes a node pool in a kubernetes cluster.
 type NodePool struct {
@@ -11,6 +14,28 @@ type NodePool struct {
 	MinSize          int64             `json:"min_size"          yaml:"min_size"`
 	MaxSize          int64             `json:"max_size"          yaml:"max_size"`
 	ConfigItems      map[string]string `json:"config_items"      yaml:"config_items"`
+	// Status is the status of the node pool observed by the CLM. It's
+	// not part of the cluster version.
+	Status *NodePoolStatus `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
+// NodePoolStatus describes the observed status of a node pool.
+type NodePoolStatus struct {
+	CurrentSize   int64     `json:"current_size"   yaml:"current_size"`
+	InstanceTypes []string  `json:"instance_types" yaml:"instance_types"`
+	Images        []string  `json:"images"         yaml:"images"`
+	LastUpdated   time.Time `json:"last_updated"   yaml:"last_updated"`
+	// InstanceTypeSubstitution is set while the node pool runs a fallback
+	// instance type instead of the configured one.
+	InstanceTypeSubstitution *InstanceTypeSubstitution `json:"instance_type_substitution,omitempty" yaml:"instance_type_substitution,omitempty"`
+}
+
+// InstanceTypeSubstitution describes a fallback instance type used instead of
+// the configured instance type of a node pool.
+type InstanceTypeSubstitution struct {
+	InstanceType string `json:"instance_type" yaml:"instance_type"`
+	Substitute   string `json:"substitute"    yaml:"substitute"`
+	Reason       string `json:"reason"        yaml:"reason"`
 }
 
 // NodePools is a slice of *NodePool which implements the sort interface to
@@ -2,32 +2,87 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/signal"
 	"sort"
+	"strings"
 	"syscall"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"golang.org/x/oauth2"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
 
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/controller"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/credentials-loader/platformiam"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/decrypter"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/events"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/history"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/httpclient"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubectl"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/metrics"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/openstack"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/registry"
 )
 
 var (
-	provisionCmd    = kingpin.Command("provision", "Provision a cluster.")
-	decommissionCmd = kingpin.Command("decommission", "Decommission a cluster.")
-	controllerCmd   = kingpin.Command("controller", "Run controller loop.")
-	version         = "unknown"
+	provisionCmd          = kingpin.Command("provision", "Provision a cluster.")
+	provisionCluster      = provisionCmd.Flag("cluster", "ID of the cluster to provision.").Required().String()
+	decommissionCmd       = kingpin.Command("decommission", "Decommission a cluster.")
+	decommissionCluster   = decommissionCmd.Flag("cluster", "ID of the cluster to decommission.").Required().String()
+	decommissionOverride  = decommissionCmd.Flag("override-deletion-protection", "Decommission the cluster even if it's protected from deletion.").Bool()
+	controllerCmd         = kingpin.Command("controller", "Run controller loop.")
+	verifyEtcdCmd         = kingpin.Command("verify-etcd-backup", "Verify that recent etcd backups exist.")
+	restoreEtcdCmd        = kingpin.Command("restore-etcd", "Provision a new etcd stack from a snapshot.")
+	restoreCluster        = restoreEtcdCmd.Flag("cluster", "ID of the cluster to restore.").Required().String()
+	restoreSnapshot       = restoreEtcdCmd.Flag("snapshot", "S3 key of the snapshot in the etcd backup bucket of the cluster.").Required().String()
+	planCmd               = kingpin.Command("plan", "Print the changes provisioning a cluster would make without changing anything.")
+	planCluster           = planCmd.Flag("cluster", "ID of the cluster to plan.").Required().String()
+	planVersion           = planCmd.Flag("channel-version", "Version of the channel config to plan, e.g. a git commit. Defaults to the current version of the cluster's channel.").String()
+	applyManifestsCmd     = kingpin.Command("apply-manifests", "Apply the manifests of a cluster without provisioning its stacks and node pools.")
+	applyManifestsCluster = applyManifestsCmd.Flag("cluster", "ID of the cluster to apply the manifests to.").Required().String()
+	applyComponents       = applyManifestsCmd.Flag("component", "Only apply the manifests and run the deletions of the component, can be repeated.").Strings()
+	applyNamespaces       = applyManifestsCmd.Flag("namespace", "Only apply the manifests and run the deletions of the objects in the namespace, can be repeated.").Strings()
+	updateNodePoolCmd     = kingpin.Command("update-node-pool", "Provision the stack of a single node pool and roll its nodes.")
+	updateNodePoolCluster = updateNodePoolCmd.Flag("cluster", "ID of the cluster of the node pool.").Required().String()
+	updateNodePoolName    = updateNodePoolCmd.Flag("node-pool", "Name of the node pool to update.").Required().String()
+	renderCmd             = kingpin.Command("render", "Render the templates of a cluster without applying them.")
+	renderCluster         = renderCmd.Flag("cluster", "ID of the cluster to render the templates for.").Required().String()
+	renderOutputDir       = renderCmd.Flag("output-dir", "Directory to write all rendered templates to. Only the manifests are printed if not set.").String()
+	renderOffline         = renderCmd.Flag("offline", "Render without access to AWS and the cluster, mocking subnets and secrets.").Bool()
+	valuesCmd             = kingpin.Command("values", "Print the effective values passed to the templates of a cluster and where they're taken from.")
+	valuesCluster         = valuesCmd.Flag("cluster", "ID of the cluster to print the values of.").Required().String()
+	valuesOffline         = valuesCmd.Flag("offline", "Compute the values without access to AWS, mocking subnets and infrastructure facts.").Bool()
+	testTemplatesCmd      = kingpin.Command("test-templates", "Run the template tests of a channel.")
+	testTemplatesChannel  = testTemplatesCmd.Flag("channel", "Channel to test, a branch or a commit of the channel config repository.").Default("master").String()
+	testTemplatesReport   = testTemplatesCmd.Flag("report", "File to write the JSON test report to. The report is printed if not set.").String()
+	lintChannelCmd        = kingpin.Command("lint-channel", "Validate the structure and templates of a channel.")
+	lintChannelName       = lintChannelCmd.Flag("channel", "Channel to lint, a branch or a commit of the channel config repository.").Default("master").String()
+	inventoryCmd          = kingpin.Command("export-inventory", "Print the inventory of the AWS resources and Kubernetes objects the CLM manages for a cluster.")
+	inventoryCluster      = inventoryCmd.Flag("cluster", "ID of the cluster to export the inventory of.").Required().String()
+	inventoryFormat       = inventoryCmd.Flag("format", "Format of the inventory.").Default(provisioner.InventoryFormatJSON).Enum(provisioner.InventoryFormatJSON, provisioner.InventoryFormatYAML)
+	cloneCmd              = kingpin.Command("clone", "Create a new cluster in the registry from the spec and config items of an existing one.")
+	cloneCluster          = cloneCmd.Flag("cluster", "ID of the cluster to clone.").Required().String()
+	cloneLocalID          = cloneCmd.Flag("local-id", "Local ID of the new cluster.").Required().String()
+	cloneAccount          = cloneCmd.Flag("infrastructure-account", "Infrastructure account of the new cluster. Defaults to the account of the cloned cluster.").String()
+	cloneRegion           = cloneCmd.Flag("region", "Region of the new cluster. Defaults to the region of the cloned cluster.").String()
+	cloneAlias            = cloneCmd.Flag("alias", "Alias of the new cluster. Defaults to the local ID.").String()
+	cloneAPIServerURL     = cloneCmd.Flag("api-server-url", "API server URL of the new cluster. Defaults to the URL of the cloned cluster with the local ID replaced.").String()
+	cloneChannel          = cloneCmd.Flag("channel", "Channel of the new cluster. Defaults to the channel of the cloned cluster.").String()
+	cloneEnvironment      = cloneCmd.Flag("environment", "Environment of the new cluster. Defaults to the environment of the cloned cluster.").String()
+	version               = "unknown"
 )
 
 func main() {
@@ -39,8 +94,22 @@ func main() {
 		log.Fatalf("Incorrectly configured flag: %v", err)
 	}
 
+	logLevel := cfg.LogLevel
 	if cfg.Debug {
-		log.SetLevel(log.DebugLevel)
+		logLevel = log.DebugLevel.String()
+	}
+
+	// masks the values of the sensitive config items of the clusters
+	redactor := logging.NewRedactor()
+
+	err := logging.Setup(log.StandardLogger(), logging.Config{
+		Format:       cfg.LogFormat,
+		Level:        logLevel,
+		ModuleLevels: cfg.LogModuleLevels,
+		Redactor:     redactor,
+	})
+	if err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
 	}
 
 	var registryTokenSource, clusterTokenSource oauth2.TokenSource
@@ -50,14 +119,35 @@ func main() {
 		clusterTokenSource = registryTokenSource
 	} else {
 		// tokenSource used when connecting to a cluster registry.
-		registryTokenSource = platformiam.NewTokenSource(cfg.RegistryTokenName, cfg.CredentialsDir)
-		// tokenSource used when connecting to a cluster API Server.
-		clusterTokenSource = platformiam.NewTokenSource(cfg.ClusterTokenName, cfg.CredentialsDir)
+		registryTokenSource = platformiam.NewExpiryGuardTokenSource(platformiam.NewTokenSource(cfg.RegistryTokenName, cfg.CredentialsDir), cfg.TokenMinValidity)
+		// tokenSource used when connecting to a cluster API Server. The
+		// tokens are passed to long-running kubectl commands, so they're
+		// re-read before they expire.
+		clusterTokenSource = platformiam.NewExpiryGuardTokenSource(platformiam.NewTokenSource(cfg.ClusterTokenName, cfg.CredentialsDir), cfg.TokenMinValidity)
 	}
 
-	clusterRegistry := registry.NewRegistry(cfg.Registry, registryTokenSource, &registry.Options{Debug: cfg.DumpRequest})
+	tlsMinVersion, err := httpclient.ParseTLSVersion(cfg.TLSMinVersion)
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
+
+	httpConfig := &httpclient.Config{
+		ProxyURL:      cfg.HTTPProxy,
+		CABundle:      cfg.CABundle,
+		TLSMinVersion: tlsMinVersion,
+	}
+
+	clusterRegistry := registry.NewRegistry(cfg.Registry, registryTokenSource, &registry.Options{
+		Debug:      cfg.DumpRequest,
+		HTTPConfig: httpConfig,
+	})
+
+	awsHTTPClient, err := httpConfig.Client(nil)
+	if err != nil {
+		log.Fatalf("Failed to setup AWS HTTP client: %v", err)
+	}
 
-	awsConfig := aws.Config(cfg.AwsMaxRetries, cfg.AwsMaxRetryInterval)
+	awsConfig := aws.Config(cfg.AwsMaxRetries, cfg.AwsMaxRetryInterval).WithHTTPClient(awsHTTPClient)
 
 	// setup aws session
 	sess, err := aws.Session(awsConfig, "")
@@ -65,17 +155,55 @@ func main() {
 		log.Fatalf("Failed to setup AWS session: %v", err)
 	}
 	secretDecrypter := decrypter.SecretDecrypter(map[string]decrypter.Decrypter{
-		decrypter.AWSKMSSecretPrefix: decrypter.NewAWSKMSDescrypter(sess),
+		decrypter.AWSKMSSecretPrefix:            decrypter.NewAWSKMSDescrypter(sess),
+		decrypter.AWSSecretsManagerSecretPrefix: decrypter.NewAWSSecretsManagerDecrypter(sess),
 	})
 
 	rootLogger := log.StandardLogger().WithFields(map[string]interface{}{})
 
-	p := provisioner.NewClusterpyProvisioner(clusterTokenSource, cfg.AssumedRole, awsConfig, &provisioner.Options{
-		DryRun:         cfg.DryRun,
-		ApplyOnly:      cfg.ApplyOnly,
-		UpdateStrategy: cfg.UpdateStrategy,
-		RemoveVolumes:  cfg.RemoveVolumes,
-	})
+	var auditStore audit.Store
+	if cfg.AuditLogLocation != "" {
+		auditStore, err = audit.NewStore(cfg.AuditLogLocation, sess)
+		if err != nil {
+			log.Fatalf("Failed to setup audit log store: %v", err)
+		}
+	}
+
+	var tracer *tracing.Tracer
+	if cfg.TracingEndpoint != "" {
+		tracer = tracing.NewTracer(cfg.TracingEndpoint, "cluster-lifecycle-manager")
+	}
+
+	kubectlHTTPClient, err := httpConfig.Client(nil)
+	if err != nil {
+		log.Fatalf("Failed to setup kubectl download HTTP client: %v", err)
+	}
+
+	provisionerOptions := &provisioner.Options{
+		DryRun:                  cfg.DryRun,
+		ApplyOnly:               cfg.ApplyOnly,
+		UpdateStrategy:          cfg.UpdateStrategy,
+		RemoveVolumes:           cfg.RemoveVolumes,
+		SnapshotVolumes:         cfg.SnapshotVolumes,
+		VolumeSnapshotRetention: cfg.VolumeSnapshotRetention,
+		AuditStore:              auditStore,
+		HTTPConfig:              httpConfig,
+		RateLimiter:             aws.NewRateLimiter(cfg.AwsRateLimit, cfg.AwsRateLimitBurst),
+		Kubectl:                 kubectl.NewManager(cfg.KubectlCacheDir, cfg.KubectlDownloadURL, kubectlHTTPClient),
+		Tracer:                  tracer,
+		ValueOverrides:          cfg.ValueOverrides,
+		CredentialPlugins:       cfg.CredentialPlugins,
+	}
+
+	provisioners := []provisioner.Provisioner{
+		provisioner.NewClusterpyProvisioner(clusterTokenSource, cfg.AssumedRole, awsConfig, provisionerOptions),
+		provisioner.NewEKSProvisioner(cfg.AssumedRole, awsConfig, provisionerOptions),
+		provisioner.NewStaticProvisioner(clusterTokenSource, provisionerOptions),
+	}
+	if credentials := openstack.CredentialsFromEnv(); credentials != nil {
+		provisioners = append(provisioners, provisioner.NewOpenStackProvisioner(clusterTokenSource, credentials, provisionerOptions))
+	}
+	p := provisioner.NewMultiProvisioner(provisioners...)
 
 	var configSource channel.ConfigSource
 
@@ -92,19 +220,55 @@ func main() {
 	if command == controllerCmd.FullCommand() {
 		log.Info("Running control loop")
 
-		go serveHealthCheck(cfg.Listen)
+		var historyStore history.Store
+		if cfg.HistoryLocation != "" {
+			historyStore, err = history.NewStore(cfg.HistoryLocation, sess)
+			if err != nil {
+				log.Fatalf("Failed to setup history store: %v", err)
+			}
+		}
+
+		var eventPublisher events.Publisher
+		if cfg.EventSink != "" {
+			eventsHTTPClient, err := httpConfig.Client(nil)
+			if err != nil {
+				log.Fatalf("Failed to setup HTTP client: %v", err)
+			}
+
+			eventPublisher, err = events.NewPublisher(cfg.EventSink, sess, eventsHTTPClient)
+			if err != nil {
+				log.Fatalf("Failed to setup event publisher: %v", err)
+			}
+		}
 
 		opts := &controller.Options{
-			AccountFilter:     cfg.AccountFilter,
-			Interval:          cfg.Interval,
-			DryRun:            cfg.DryRun,
-			SecretDecrypter:   secretDecrypter,
-			ConcurrentUpdates: cfg.ConcurrentUpdates,
-			EnvironmentOrder:  cfg.EnvironmentOrder,
+			AccountFilter:            cfg.AccountFilter,
+			Interval:                 cfg.Interval,
+			DryRun:                   cfg.DryRun,
+			SecretDecrypter:          secretDecrypter,
+			ConcurrentUpdates:        cfg.ConcurrentUpdates,
+			ConcurrentAccountUpdates: cfg.ConcurrentAccountUpdates,
+			EnvironmentOrder:         cfg.EnvironmentOrder,
+			History:                  historyStore,
+			Events:                   eventPublisher,
+			RolloutBatches:           cfg.RolloutBatches,
+			RolloutMaxFailureRate:    cfg.RolloutMaxFailureRate,
+			QuarantineThreshold:      cfg.QuarantineThreshold,
+			QuarantineBackoff:        cfg.QuarantineBackoff,
+			QuarantineMaxBackoff:     cfg.QuarantineMaxBackoff,
+			Redactor:                 redactor,
 		}
 
 		ctrl := controller.New(rootLogger, clusterRegistry, p, configSource, opts)
 
+		// the handlers are served with a dedicated mux, the default one
+		// serves the expvar variables including the command line.
+		mux := http.NewServeMux()
+		mux.Handle("/clusters/", ctrl.ClusterHandler())
+		mux.Handle("/rollouts", ctrl.RolloutHandler())
+		mux.Handle("/debug/vars", metrics.Handler())
+		go serveHealthCheck(cfg.Listen, mux)
+
 		ctx, cancel := context.WithCancel(context.Background())
 		go handleSigterm(cancel)
 		ctrl.Run(ctx)
@@ -112,18 +276,71 @@ func main() {
 		os.Exit(0)
 	}
 
+	if command == testTemplatesCmd.FullCommand() {
+		err = testTemplates(rootLogger, stepProvisioner(p), configSource, *testTemplatesChannel, *testTemplatesReport)
+		if err != nil {
+			log.Fatalf("Fail to test templates: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	if command == lintChannelCmd.FullCommand() {
+		err = lintChannel(rootLogger, configSource, *lintChannelName)
+		if err != nil {
+			log.Fatalf("Fail to lint channel: %v", err)
+		}
+		os.Exit(0)
+	}
+
 	clusters, err := clusterRegistry.ListClusters(registry.Filter{})
 	if err != nil {
 		log.Fatalf("%+v", err)
 	}
 	orderByEnvironmentOrder(clusters, cfg.EnvironmentOrder)
 
+	if command == cloneCmd.FullCommand() {
+		// the config items are cloned encrypted, so the clone is created
+		// before any of them are decrypted.
+		err = clone(clusterRegistry, clusters, *cloneCluster, cfg.DryRun, &provisioner.CloneOptions{
+			LocalID:               *cloneLocalID,
+			InfrastructureAccount: *cloneAccount,
+			Region:                *cloneRegion,
+			Alias:                 *cloneAlias,
+			APIServerURL:          *cloneAPIServerURL,
+			Channel:               *cloneChannel,
+			Environment:           *cloneEnvironment,
+		})
+		if err != nil {
+			log.Fatalf("Fail to clone cluster %s: %v", *cloneCluster, err)
+		}
+		os.Exit(0)
+	}
+
+	// all commands except verify-etcd-backup target a single cluster.
+	clusterID, singleCluster := map[string]*string{
+		provisionCmd.FullCommand():      provisionCluster,
+		decommissionCmd.FullCommand():   decommissionCluster,
+		restoreEtcdCmd.FullCommand():    restoreCluster,
+		planCmd.FullCommand():           planCluster,
+		applyManifestsCmd.FullCommand(): applyManifestsCluster,
+		updateNodePoolCmd.FullCommand(): updateNodePoolCluster,
+		renderCmd.FullCommand():         renderCluster,
+		valuesCmd.FullCommand():         valuesCluster,
+		inventoryCmd.FullCommand():      inventoryCluster,
+	}[command]
+	found := false
+
 	for _, cluster := range clusters {
 		if !cfg.AccountFilter.Allowed(cluster.InfrastructureAccount) {
 			log.Debugf("Skipping %s cluster, infrastructure account does not match provided filter.", cluster.ID)
 			continue
 		}
 
+		if singleCluster && cluster.ID != *clusterID {
+			continue
+		}
+		found = true
+
 		channels, err := configSource.Update(rootLogger)
 		if err != nil {
 			log.Fatalf("%+v", err)
@@ -134,6 +351,10 @@ func main() {
 			log.Fatalf("%+v", err)
 		}
 
+		if command == planCmd.FullCommand() && *planVersion != "" {
+			version = channel.ConfigVersion(*planVersion)
+		}
+
 		config, err := configSource.Get(rootLogger, version)
 		if err != nil {
 			log.Fatalf("%+v", err)
@@ -148,25 +369,299 @@ func main() {
 			cluster.ConfigItems[key] = decryptedValue
 		}
 
+		sensitiveValues, err := provisioner.SensitiveConfigValues(cluster, config)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+		redactor.SetValues(cluster.ID, sensitiveValues)
+
+		clusterLogger := rootLogger.WithFields(log.Fields{
+			logging.FieldCluster:   cluster.ID,
+			logging.FieldProvider:  cluster.Provider,
+			logging.FieldOperation: command,
+		})
+
 		switch command {
 		case provisionCmd.FullCommand():
 			log.Infof("Provisioning cluster %s", cluster.ID)
-			err = p.Provision(context.Background(), rootLogger, cluster, config)
+			err = p.Provision(context.Background(), clusterLogger, cluster, config)
 			if err != nil {
 				log.Fatalf("Fail to provision: %v", err)
 			}
 			log.Infof("Provisioning done for cluster %s", cluster.ID)
 		case decommissionCmd.FullCommand():
+			if *decommissionOverride {
+				log.Warnf("Overriding the deletion protection of cluster %s", cluster.ID)
+				cluster.ConfigItems[provisioner.ConfigKeyDeletionProtectionOverride] = cluster.ID
+			}
+			if cfg.DryRun {
+				plan, err := decommissionPlanner(p).PlanDecommission(context.Background(), clusterLogger, cluster, config)
+				if err != nil {
+					log.Fatalf("Fail to plan the decommission: %v", err)
+				}
+
+				data, err := json.MarshalIndent(plan, "", "  ")
+				if err != nil {
+					log.Fatalf("Fail to print the decommission plan: %v", err)
+				}
+				fmt.Println(string(data))
+				break
+			}
+
 			log.Infof("Decommissioning cluster %s", cluster.ID)
-			err = p.Decommission(rootLogger, cluster, config)
+			err = p.Decommission(clusterLogger, cluster, config)
 			if err != nil {
 				log.Fatalf("Fail to decommission: %v", err)
 			}
 			log.Infof("Decommissioning done for cluster %s", cluster.ID)
+		case verifyEtcdCmd.FullCommand():
+			err = etcdBackupProvisioner(p).VerifyEtcdBackup(clusterLogger, cluster, config)
+			if err != nil {
+				log.Fatalf("Fail to verify etcd backup of cluster %s: %v", cluster.ID, err)
+			}
+			log.Infof("etcd backup verified for cluster %s", cluster.ID)
+		case restoreEtcdCmd.FullCommand():
+			log.Infof("Restoring etcd of cluster %s from %s", cluster.ID, *restoreSnapshot)
+			stackVersion, err := etcdBackupProvisioner(p).RestoreEtcd(context.Background(), clusterLogger, cluster, config, *restoreSnapshot)
+			if err != nil {
+				log.Fatalf("Fail to restore etcd: %v", err)
+			}
+			log.Infof("Restored etcd of cluster %s, set the etcd_stack_version config item to '%s' to switch to the restored stack", cluster.ID, stackVersion)
+		case planCmd.FullCommand():
+			log.Infof("Planning cluster %s with channel version %s", cluster.ID, version)
+			plan, err := planner(p).Plan(context.Background(), clusterLogger, cluster, config)
+			if err != nil {
+				log.Fatalf("Fail to plan: %v", err)
+			}
+			err = plan.Write(os.Stdout)
+			if err != nil {
+				log.Fatalf("Fail to write plan: %v", err)
+			}
+		case applyManifestsCmd.FullCommand():
+			if len(*applyComponents) > 0 {
+				cluster.ConfigItems[provisioner.ConfigKeyApplyComponents] = strings.Join(*applyComponents, ",")
+			}
+			if len(*applyNamespaces) > 0 {
+				cluster.ConfigItems[provisioner.ConfigKeyApplyNamespaces] = strings.Join(*applyNamespaces, ",")
+			}
+			log.Infof("Applying manifests of cluster %s", cluster.ID)
+			err = stepProvisioner(p).ApplyManifests(context.Background(), clusterLogger, cluster, config)
+			if err != nil {
+				log.Fatalf("Fail to apply manifests: %v", err)
+			}
+			log.Infof("Applied manifests of cluster %s", cluster.ID)
+		case updateNodePoolCmd.FullCommand():
+			log.Infof("Updating node pool %s of cluster %s", *updateNodePoolName, cluster.ID)
+			err = stepProvisioner(p).UpdateNodePool(context.Background(), clusterLogger, cluster, config, *updateNodePoolName)
+			if err != nil {
+				log.Fatalf("Fail to update node pool: %v", err)
+			}
+			log.Infof("Updated node pool %s of cluster %s", *updateNodePoolName, cluster.ID)
+		case renderCmd.FullCommand():
+			err = stepProvisioner(p).Render(context.Background(), clusterLogger, cluster, config, &provisioner.RenderOptions{
+				Output:  os.Stdout,
+				Dir:     *renderOutputDir,
+				Offline: *renderOffline,
+			})
+			if err != nil {
+				log.Fatalf("Fail to render templates: %v", err)
+			}
+		case valuesCmd.FullCommand():
+			values, err := stepProvisioner(p).Values(context.Background(), clusterLogger, cluster, config, *valuesOffline)
+			if err != nil {
+				log.Fatalf("Fail to compute values: %v", err)
+			}
+
+			data, err := json.MarshalIndent(values, "", "  ")
+			if err != nil {
+				log.Fatalf("Fail to print values: %v", err)
+			}
+			fmt.Println(string(data))
+		case inventoryCmd.FullCommand():
+			inventory, err := inventoryExporter(p).ExportInventory(context.Background(), clusterLogger, cluster, config)
+			if err != nil {
+				log.Fatalf("Fail to export the inventory: %v", err)
+			}
+			err = inventory.Write(os.Stdout, *inventoryFormat)
+			if err != nil {
+				log.Fatalf("Fail to write the inventory: %v", err)
+			}
 		default:
 			log.Fatalf("unknown command: %s", command)
 		}
 	}
+
+	if singleCluster && !found {
+		log.Fatalf("Cluster %s not found or excluded by the account filter", *clusterID)
+	}
+}
+
+// etcdBackupProvisioner returns the provisioner as an EtcdBackupProvisioner
+// or exits if it doesn't support managing etcd backups.
+func etcdBackupProvisioner(p provisioner.Provisioner) provisioner.EtcdBackupProvisioner {
+	backups, ok := p.(provisioner.EtcdBackupProvisioner)
+	if !ok {
+		log.Fatalf("Provisioner doesn't support managing etcd backups")
+	}
+	return backups
+}
+
+// stepProvisioner returns the provisioner as a StepProvisioner or exits if it
+// doesn't support running single provisioning steps.
+func stepProvisioner(p provisioner.Provisioner) provisioner.StepProvisioner {
+	steps, ok := p.(provisioner.StepProvisioner)
+	if !ok {
+		log.Fatalf("Provisioner doesn't support running single provisioning steps")
+	}
+	return steps
+}
+
+// inventoryExporter returns the provisioner as an InventoryExporter or exits
+// if it doesn't support exporting inventories.
+func inventoryExporter(p provisioner.Provisioner) provisioner.InventoryExporter {
+	exporter, ok := p.(provisioner.InventoryExporter)
+	if !ok {
+		log.Fatalf("Provisioner doesn't support exporting inventories")
+	}
+	return exporter
+}
+
+// clone creates a clone of the source cluster in the registry. The controller
+// provisions it like any other requested cluster. In dry-run mode the clone
+// is only printed.
+func clone(clusterRegistry registry.Registry, clusters []*api.Cluster, sourceID string, dryRun bool, options *provisioner.CloneOptions) error {
+	var source *api.Cluster
+	for _, cluster := range clusters {
+		if cluster.ID == sourceID {
+			source = cluster
+		}
+	}
+	if source == nil {
+		return fmt.Errorf("cluster not found")
+	}
+
+	cloned, err := provisioner.CloneCluster(source, options)
+	if err != nil {
+		return err
+	}
+
+	for _, cluster := range clusters {
+		if cluster.ID == cloned.ID {
+			return fmt.Errorf("cluster %s already exists", cloned.ID)
+		}
+	}
+
+	if dryRun {
+		data, err := yaml.Marshal(cloned)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	err = clusterRegistry.CreateCluster(cloned)
+	if err != nil {
+		return err
+	}
+	log.Infof("Created cluster %s from %s", cloned.ID, source.ID)
+	return nil
+}
+
+// testTemplates runs the template tests of the channel and writes the report
+// to the file or stdout. Returns an error if any test failed.
+func testTemplates(logger *log.Entry, steps provisioner.StepProvisioner, configSource channel.ConfigSource, channelName, reportFile string) error {
+	channels, err := configSource.Update(logger)
+	if err != nil {
+		return err
+	}
+
+	version, err := channels.Version(channelName)
+	if err != nil {
+		return err
+	}
+
+	config, err := configSource.Get(logger, version)
+	if err != nil {
+		return err
+	}
+
+	report, err := provisioner.RunTemplateTests(context.Background(), logger, steps, config)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if reportFile != "" {
+		err = ioutil.WriteFile(reportFile, data, 0644)
+	} else {
+		_, err = os.Stdout.Write(append(data, '\n'))
+	}
+	if err != nil {
+		return err
+	}
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d template tests failed", report.Failed, report.Failed+report.Passed)
+	}
+	return nil
+}
+
+// lintChannel prints the lint issues of the channel. Returns an error if any
+// issue was found.
+func lintChannel(logger *log.Entry, configSource channel.ConfigSource, channelName string) error {
+	channels, err := configSource.Update(logger)
+	if err != nil {
+		return err
+	}
+
+	version, err := channels.Version(channelName)
+	if err != nil {
+		return err
+	}
+
+	config, err := configSource.Get(logger, version)
+	if err != nil {
+		return err
+	}
+
+	issues, err := provisioner.LintChannel(config, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+
+	if len(issues) > 0 {
+		return fmt.Errorf("%d issues found in channel %s", len(issues), channelName)
+	}
+	return nil
+}
+
+// decommissionPlanner returns the provisioner as a DecommissionPlanner or
+// exits if it doesn't support planning decommissions.
+func decommissionPlanner(p provisioner.Provisioner) provisioner.DecommissionPlanner {
+	planner, ok := p.(provisioner.DecommissionPlanner)
+	if !ok {
+		log.Fatalf("Provisioner doesn't support planning decommissions")
+	}
+	return planner
+}
+
+// planner returns the provisioner as a Planner or exits if it doesn't support
+// planning.
+func planner(p provisioner.Provisioner) provisioner.Planner {
+	planner, ok := p.(provisioner.Planner)
+	if !ok {
+		log.Fatalf("Provisioner doesn't support planning")
+	}
+	return planner
 }
 
 // orderByEnvironmentOrder orders the clusters based on the provided environment ordering.
@@ -186,11 +681,11 @@ func orderByEnvironmentOrder(clusters []*api.Cluster, environmentOrder []string)
 	})
 }
 
-func serveHealthCheck(listen string) {
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+func serveHealthCheck(listen string, mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
-	http.ListenAndServe(listen, nil)
+	http.ListenAndServe(listen, mux)
 }
 
 func handleSigterm(cancelFunc func()) {
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path"
 	"time"
@@ -10,46 +11,87 @@ import (
 )
 
 const (
-	defaultInterval              = "10m"
-	defaultListener              = ":9090"
-	defaultCredentialsDir        = "/meta/credentials"
-	defaultRegistryTokenName     = "cluster-registry-rw"
-	defaultClusterTokenName      = "cluster-rw"
-	defaultRegistry              = "file://clusters.yaml"
-	defaultConcurrentUpdates     = "1"
-	defaultAwsMaxRetries         = "50"
-	defaultAwsMaxRetryInterval   = "10s"
-	defaultUpdateMaxEvictTimeout = "10m"
-	defaultUpdateStrategy        = "rolling"
+	defaultInterval                 = "10m"
+	defaultListener                 = ":9090"
+	defaultCredentialsDir           = "/meta/credentials"
+	defaultRegistryTokenName        = "cluster-registry-rw"
+	defaultClusterTokenName         = "cluster-rw"
+	defaultRegistry                 = "file://clusters.yaml"
+	defaultConcurrentUpdates        = "1"
+	defaultConcurrentAccountUpdates = "0"
+	defaultAwsMaxRetries            = "50"
+	defaultAwsMaxRetryInterval      = "10s"
+	defaultAwsRateLimit             = "10"
+	defaultAwsRateLimitBurst        = "20"
+	defaultUpdateMaxEvictTimeout    = "10m"
+	defaultVolumeSnapshotRetention  = "720h"
+	defaultUpdateStrategy           = "rolling"
+	defaultTLSMinVersion            = "1.2"
+	defaultKubectlDownloadURL       = "https://storage.googleapis.com/kubernetes-release/release"
+	defaultLogFormat                = "text"
+	defaultLogLevel                 = "info"
+	defaultRolloutMaxFailureRate    = "20"
+	defaultTokenMinValidity         = "5m"
+	defaultQuarantineThreshold      = "0"
+	defaultQuarantineBackoff        = "30m"
+	defaultQuarantineMaxBackoff     = "24h"
 )
 
-var defaultWorkdir = path.Join(os.TempDir(), "clm-workdir")
+var (
+	defaultWorkdir         = path.Join(os.TempDir(), "clm-workdir")
+	defaultKubectlCacheDir = path.Join(os.TempDir(), "clm-kubectl")
+)
 
 // LifecycleManagerConfig stores the configuration for app
 type LifecycleManagerConfig struct {
-	Registry            string
-	AccountFilter       IncludeExcludeFilter
-	Token               string
-	RegistryTokenName   string
-	ClusterTokenName    string
-	AssumedRole         string
-	Interval            time.Duration
-	Debug               bool
-	DumpRequest         bool
-	DryRun              bool
-	ConcurrentUpdates   uint
-	Listen              string
-	Workdir             string
-	Directory           string
-	GitRepositoryURL    string
-	SSHPrivateKeyFile   string
-	CredentialsDir      string
-	EnvironmentOrder    []string
-	ApplyOnly           bool
-	AwsMaxRetries       int
-	AwsMaxRetryInterval time.Duration
-	UpdateStrategy      UpdateStrategy
-	RemoveVolumes       bool
+	Registry                 string
+	AccountFilter            IncludeExcludeFilter
+	Token                    string
+	RegistryTokenName        string
+	ClusterTokenName         string
+	TokenMinValidity         time.Duration
+	AssumedRole              string
+	Interval                 time.Duration
+	Debug                    bool
+	LogFormat                string
+	LogLevel                 string
+	LogModuleLevels          []string
+	DumpRequest              bool
+	DryRun                   bool
+	ConcurrentUpdates        uint
+	ConcurrentAccountUpdates uint
+	Listen                   string
+	Workdir                  string
+	Directory                string
+	GitRepositoryURL         string
+	SSHPrivateKeyFile        string
+	CredentialsDir           string
+	EnvironmentOrder         []string
+	ApplyOnly                bool
+	AwsMaxRetries            int
+	AwsMaxRetryInterval      time.Duration
+	AwsRateLimit             float64
+	AwsRateLimitBurst        int
+	UpdateStrategy           UpdateStrategy
+	RemoveVolumes            bool
+	SnapshotVolumes          bool
+	VolumeSnapshotRetention  time.Duration
+	AuditLogLocation         string
+	HistoryLocation          string
+	EventSink                string
+	TracingEndpoint          string
+	HTTPProxy                *url.URL
+	CABundle                 string
+	TLSMinVersion            string
+	KubectlCacheDir          string
+	KubectlDownloadURL       string
+	RolloutBatches           []uint
+	RolloutMaxFailureRate    float64
+	QuarantineThreshold      uint
+	QuarantineBackoff        time.Duration
+	QuarantineMaxBackoff     time.Duration
+	ValueOverrides           map[string]string
+	CredentialPlugins        map[string]string
 }
 
 // UpdateStrategy defines the default update strategy configured for the
@@ -72,6 +114,26 @@ func (cfg *LifecycleManagerConfig) ValidateFlags() error {
 	if cfg.GitRepositoryURL == "" && cfg.Directory == "" {
 		return fmt.Errorf("Either --git-repository-url or --directory must be specified")
 	}
+
+	return validateRolloutBatches(cfg.RolloutBatches)
+}
+
+// validateRolloutBatches checks that the rollout batches are increasing
+// percentages ending with 100.
+func validateRolloutBatches(batches []uint) error {
+	if len(batches) == 0 {
+		return nil
+	}
+
+	for i, batch := range batches {
+		if batch == 0 || batch > 100 || (i > 0 && batch <= batches[i-1]) {
+			return fmt.Errorf("--rollout-batch must be increasing percentages, got %v", batches)
+		}
+	}
+
+	if batches[len(batches)-1] != 100 {
+		return fmt.Errorf("the last --rollout-batch must be 100, got %v", batches)
+	}
 	return nil
 }
 
@@ -83,9 +145,13 @@ func (cfg *LifecycleManagerConfig) ParseFlags() string {
 	kingpin.Flag("token", "The token to authenticate with.").StringVar(&cfg.Token)
 	kingpin.Flag("registry-token-name", "Name of the token used when authenticating with a cluster registry.").Default(defaultRegistryTokenName).StringVar(&cfg.RegistryTokenName)
 	kingpin.Flag("cluster-token-name", "Name of the token used when authenticating with a cluster.").Default(defaultClusterTokenName).StringVar(&cfg.ClusterTokenName)
+	kingpin.Flag("token-min-validity", "Minimum remaining validity of the tokens read from the credentials dir, tokens expiring sooner are read again.").Default(defaultTokenMinValidity).DurationVar(&cfg.TokenMinValidity)
 	kingpin.Flag("assumed-role", "The role ARN to assume in target accounts.").StringVar(&cfg.AssumedRole)
 	kingpin.Flag("interval", "The interval between iterations in Duration format, e.g. 60s.").Default(defaultInterval).DurationVar(&cfg.Interval)
 	kingpin.Flag("debug", "Enable debug logging.").BoolVar(&cfg.Debug)
+	kingpin.Flag("log-format", "Format of the log entries.").Default(defaultLogFormat).EnumVar(&cfg.LogFormat, "text", "json")
+	kingpin.Flag("log-level", "Default log level, overridden by --debug.").Default(defaultLogLevel).EnumVar(&cfg.LogLevel, "debug", "info", "warning", "error")
+	kingpin.Flag("log-module-level", "Log level of a single module as <module>=<level>, e.g. updatestrategy=debug. Can be repeated.").StringsVar(&cfg.LogModuleLevels)
 	kingpin.Flag("dump-request", "Enable logging http requests.").BoolVar(&cfg.DumpRequest)
 	kingpin.Flag("dry-run", "Don't make any changes, just print.").BoolVar(&cfg.DryRun)
 	kingpin.Flag("listen", "Address to listen at, e.g. :9090 or 0.0.0.0:9090").Default(defaultListener).StringVar(&cfg.Listen)
@@ -93,14 +159,35 @@ func (cfg *LifecycleManagerConfig) ParseFlags() string {
 	kingpin.Flag("directory", "Path of a directory to use as channel config source.").StringVar(&cfg.Directory)
 	kingpin.Flag("git-repository-url", "URL of the git repository to use as channel config source.").StringVar(&cfg.GitRepositoryURL)
 	kingpin.Flag("concurrent-updates", "Number of updates allowed to run in parallel.").Default(defaultConcurrentUpdates).UintVar(&cfg.ConcurrentUpdates)
+	kingpin.Flag("concurrent-updates-per-account", "Number of updates allowed to run in parallel in the same infrastructure account, 0 means unlimited.").Default(defaultConcurrentAccountUpdates).UintVar(&cfg.ConcurrentAccountUpdates)
 	kingpin.Flag("ssh-private-key-path", "Path to SSH private key used when pulling from a private git repository.").Envar("SSH_PRIVATE_KEY_PATH").StringVar(&cfg.SSHPrivateKeyFile)
 	kingpin.Flag("credentials-dir", "Path to OAuth credentials").Envar("CREDENTIALS_DIR").Default(defaultCredentialsDir).StringVar(&cfg.CredentialsDir)
 	kingpin.Flag("apply-only", "Enable apply only mode which will only apply CloudFormation stacks and manifests, but not do any rolling of nodes.").BoolVar(&cfg.ApplyOnly)
 	kingpin.Flag("aws-max-retries", "Maximum number of retries for AWS SDK requests.").Default(defaultAwsMaxRetries).IntVar(&cfg.AwsMaxRetries)
 	kingpin.Flag("aws-max-retry-interval", "Maximum interval between retries for AWS SDK requests.").Default(defaultAwsMaxRetryInterval).DurationVar(&cfg.AwsMaxRetryInterval)
+	kingpin.Flag("aws-rate-limit", "Maximum number of AWS SDK requests per second per infrastructure account and region, 0 disables rate limiting.").Default(defaultAwsRateLimit).Float64Var(&cfg.AwsRateLimit)
+	kingpin.Flag("aws-rate-limit-burst", "Maximum burst of AWS SDK requests per infrastructure account and region.").Default(defaultAwsRateLimitBurst).IntVar(&cfg.AwsRateLimitBurst)
 	kingpin.Flag("update-max-evict-timeout", "Maximum timeout for evicting pods during update.").Default(defaultUpdateMaxEvictTimeout).DurationVar(&cfg.UpdateStrategy.MaxEvictTimeout)
 	kingpin.Flag("update-strategy", "Update strategy to use when updating node pools.").Default(defaultUpdateStrategy).EnumVar(&cfg.UpdateStrategy.Strategy, "rolling")
 	kingpin.Flag("remove-volumes", "Remove EBS volumes when decommissioning").BoolVar(&cfg.RemoveVolumes)
+	kingpin.Flag("snapshot-volumes", "Snapshot EBS volumes before removing them when decommissioning.").BoolVar(&cfg.SnapshotVolumes)
+	kingpin.Flag("volume-snapshot-retention", "Duration the snapshots of removed EBS volumes are tagged to be retained for.").Default(defaultVolumeSnapshotRetention).DurationVar(&cfg.VolumeSnapshotRetention)
+	kingpin.Flag("audit-log-location", "Location for storing audit logs of provisioning runs. This can either be an S3 URL (s3://bucket/prefix) or a path to a local directory.").StringVar(&cfg.AuditLogLocation)
+	kingpin.Flag("history-location", "Location for storing the history of provisioning attempts. This can either be an S3 URL (s3://bucket/prefix) or a path to a local directory.").StringVar(&cfg.HistoryLocation)
+	kingpin.Flag("event-sink", "Destination CloudEvents for cluster lifecycle transitions are published to. This can either be the ARN of an SNS topic or an HTTP(S) URL. No events are published if not set.").StringVar(&cfg.EventSink)
+	kingpin.Flag("tracing-endpoint", "OTLP/HTTP endpoint the traces of provisioning runs are exported to, e.g. http://otel-collector:4318. Tracing is disabled if not set.").StringVar(&cfg.TracingEndpoint)
+	kingpin.Flag("http-proxy", "Proxy used for all outbound HTTP requests. Defaults to the HTTP_PROXY/HTTPS_PROXY environment variables.").URLVar(&cfg.HTTPProxy)
+	kingpin.Flag("ca-bundle", "Path to a PEM encoded bundle of CA certificates to trust in addition to the system CAs.").StringVar(&cfg.CABundle)
+	kingpin.Flag("tls-min-version", "Minimum TLS version accepted by outbound HTTP clients.").Default(defaultTLSMinVersion).EnumVar(&cfg.TLSMinVersion, "1.0", "1.1", "1.2")
+	kingpin.Flag("kubectl-cache-dir", "Path to the directory caching the kubectl binaries of the versions pinned by the channels.").Default(defaultKubectlCacheDir).StringVar(&cfg.KubectlCacheDir)
+	kingpin.Flag("kubectl-download-url", "Base URL to download the kubectl binaries from.").Default(defaultKubectlDownloadURL).StringVar(&cfg.KubectlDownloadURL)
 	kingpin.Flag("environment-order", "Roll out channel updates to the environments in a specific order").StringsVar(&cfg.EnvironmentOrder)
+	kingpin.Flag("rollout-batch", "Cumulative percentage of the clusters of a channel a new channel version is rolled out to in a batch, e.g. 5, 25 and 100. Can be repeated, all clusters are updated at once if not set.").UintsVar(&cfg.RolloutBatches)
+	kingpin.Flag("rollout-max-failure-rate", "Percentage of failed clusters in a rollout batch halting the rollout.").Default(defaultRolloutMaxFailureRate).Float64Var(&cfg.RolloutMaxFailureRate)
+	kingpin.Flag("quarantine-threshold", "Number of consecutive failures after which a cluster is quarantined and retried with an exponential backoff. Clusters are never quarantined if 0.").Default(defaultQuarantineThreshold).UintVar(&cfg.QuarantineThreshold)
+	kingpin.Flag("quarantine-backoff", "Initial backoff before retrying a quarantined cluster, doubled with every further failure.").Default(defaultQuarantineBackoff).DurationVar(&cfg.QuarantineBackoff)
+	kingpin.Flag("quarantine-max-backoff", "Maximum backoff before retrying a quarantined cluster.").Default(defaultQuarantineMaxBackoff).DurationVar(&cfg.QuarantineMaxBackoff)
+	kingpin.Flag("value", "Override a value passed to the templates as <key>=<value>, taking precedence over the defaults, the channel and the config items. Can be repeated.").StringMapVar(&cfg.ValueOverrides)
+	kingpin.Flag("credential-plugin", "Allow clusters to authenticate to their API server with a credential plugin as <name>=<path>. Can be repeated.").StringMapVar(&cfg.CredentialPlugins)
 	return kingpin.Parse()
 }
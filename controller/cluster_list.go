@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"sort"
 	"sync"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
 )
 
 const (
@@ -17,12 +19,14 @@ const (
 	updatePriorityNormal
 	updatePriorityDecommissionRequested
 	updatePriorityAlreadyUpdating
+	updatePriorityUrgent
 
 	stateIdle = iota
 	stateProcessing
 	stateProcessed
 
 	updateBlockedConfigItem = "cluster_update_block"
+	pausedConfigItem        = "cluster_paused"
 )
 
 type ClusterInfo struct {
@@ -30,7 +34,23 @@ type ClusterInfo struct {
 	state          int
 	cancelUpdate   context.CancelFunc
 	updatePriority uint32
-	Cluster        *api.Cluster
+	// attempt is the number of consecutive attempts to process the
+	// cluster, it's reset once an attempt succeeds.
+	attempt uint
+	// hibernationScheduled is the state of the hibernation schedule of the
+	// cluster when it was last provisioned.
+	hibernationScheduled bool
+	// maintenancePending is true if the cluster was last provisioned in
+	// apply only mode outside of its maintenance window, so it's
+	// provisioned again once the window starts.
+	maintenancePending bool
+	// paused is true if reconciliation of the cluster was paused on the
+	// last refresh, so pausing and resuming is only logged once.
+	paused bool
+	// deletionProtected is true if decommissioning the cluster was skipped
+	// because it's protected from deletion, so it's only logged once.
+	deletionProtected bool
+	Cluster           *api.Cluster
 
 	CurrentVersion *api.ClusterVersion
 	NextVersion    *api.ClusterVersion
@@ -44,12 +64,24 @@ type ClusterList struct {
 	clusters      map[string]*ClusterInfo
 	pendingUpdate []*ClusterInfo
 
+	// The maximum number of clusters per infrastructure account processed at
+	// the same time, 0 means unlimited
+	accountConcurrency uint
+
 	// A map of env1 -> env2. For every channel, all clusters in env2 must be updated to a specific version before
 	// clusters in env1 will be allowed to be updated to it
 	prerequisiteEnvironments map[string]string
+
+	// rollouts rolls out new channel versions in batches, nil if all
+	// clusters are updated at once.
+	rollouts *rolloutCoordinator
+
+	// quarantine isolates clusters failing repeatedly, nil if they're
+	// retried on every loop.
+	quarantine *quarantinePolicy
 }
 
-func NewClusterList(accountFilter config.IncludeExcludeFilter, environmentOrder []string) *ClusterList {
+func NewClusterList(accountFilter config.IncludeExcludeFilter, environmentOrder []string, accountConcurrency uint) *ClusterList {
 	prerequisiteEnvironments := make(map[string]string)
 	for i, env := range environmentOrder {
 		if i > 0 {
@@ -61,6 +93,7 @@ func NewClusterList(accountFilter config.IncludeExcludeFilter, environmentOrder
 		accountFilter:            accountFilter,
 		clusters:                 make(map[string]*ClusterInfo),
 		prerequisiteEnvironments: prerequisiteEnvironments,
+		accountConcurrency:       accountConcurrency,
 	}
 }
 
@@ -72,6 +105,10 @@ func (clusterList *ClusterList) UpdateAvailable(channels channel.ConfigVersions,
 
 	clusterList.updateClusters(channels, availableClusters)
 
+	if clusterList.rollouts != nil {
+		clusterList.rollouts.update(clusterList.clusters)
+	}
+
 	// Collect information about used clusterInfo versions
 	usedVersions := newUsedVersions()
 	for _, clusterInfo := range clusterList.clusters {
@@ -113,6 +150,21 @@ func updateBlocked(cluster *api.Cluster) bool {
 	return ok
 }
 
+// paused returns true if reconciliation of the cluster has been temporarily
+// paused by an operator. Paused clusters are still tracked by the cluster list
+// so their state is taken into account e.g. for environment ordering.
+func paused(cluster *api.Cluster) bool {
+	return cluster.ConfigItems[pausedConfigItem] == "true"
+}
+
+// hibernationScheduled returns true if the hibernation schedule of the
+// cluster is currently active. Invalid schedules are reported when the
+// cluster is provisioned.
+func hibernationScheduled(cluster *api.Cluster) bool {
+	scheduled, _ := provisioner.HibernationScheduled(cluster, time.Now())
+	return scheduled
+}
+
 func (clusterList *ClusterList) updateClusters(channels channel.ConfigVersions, availableClusters []*api.Cluster) {
 	availableClusterIds := make(map[string]bool)
 
@@ -129,6 +181,21 @@ func (clusterList *ClusterList) updateClusters(channels channel.ConfigVersions,
 
 		availableClusterIds[cluster.ID] = true
 
+		clusterPaused := paused(cluster)
+		deletionProtected := cluster.LifecycleStatus == statusDecommissionRequested && provisioner.DeletionProtected(cluster)
+
+		existing, ok := clusterList.clusters[cluster.ID]
+		switch {
+		case clusterPaused && (!ok || !existing.paused):
+			log.Infof("Cluster %s is paused, reconciliation is skipped", cluster.ID)
+		case !clusterPaused && ok && existing.paused:
+			log.Infof("Cluster %s is no longer paused, reconciliation is resumed", cluster.ID)
+		}
+
+		if deletionProtected && (!ok || !existing.deletionProtected) {
+			log.Warnf("Cluster %s is protected from deletion, decommissioning is skipped", cluster.ID)
+		}
+
 		currentVersion := api.ParseVersion(cluster.Status.CurrentVersion)
 
 		var channelVersion channel.ConfigVersion
@@ -138,27 +205,41 @@ func (clusterList *ClusterList) updateClusters(channels channel.ConfigVersions,
 		if nextError == nil {
 			nextVersion, nextError = cluster.Version(channelVersion)
 		}
+		if nextError == nil {
+			_, err := maintenanceWindow(cluster)
+			if err != nil {
+				nextError = fmt.Errorf("invalid %s: %v", maintenanceWindowConfigItem, err)
+			}
+		}
+		if nextError == nil {
+			nextError = validateUrgentUpdate(cluster, nextVersion)
+		}
 
-		if existing, ok := clusterList.clusters[cluster.ID]; ok {
+		if ok {
+			existing.paused = clusterPaused
+			existing.deletionProtected = deletionProtected
 			if existing.state != stateProcessing {
 				existing.state = stateIdle
 				existing.Cluster = cluster
 				existing.CurrentVersion = currentVersion
 				existing.NextVersion = nextVersion
 				existing.NextError = nextError
-			} else if existing.state == stateProcessing && updateBlocked(cluster) {
+			} else if existing.state == stateProcessing && (updateBlocked(cluster) || clusterPaused) {
 				// abort an update in progress
 				existing.cancelUpdate()
 			}
 		} else {
 			clusterList.clusters[cluster.ID] = &ClusterInfo{
-				lastProcessed:  time.Unix(0, 0),
-				state:          stateIdle,
-				cancelUpdate:   func() {},
-				Cluster:        cluster,
-				CurrentVersion: currentVersion,
-				NextVersion:    nextVersion,
-				NextError:      nextError,
+				lastProcessed:        time.Unix(0, 0),
+				state:                stateIdle,
+				cancelUpdate:         func() {},
+				hibernationScheduled: hibernationScheduled(cluster),
+				paused:               clusterPaused,
+				deletionProtected:    deletionProtected,
+				Cluster:              cluster,
+				CurrentVersion:       currentVersion,
+				NextVersion:          nextVersion,
+				NextError:            nextError,
 			}
 		}
 	}
@@ -186,16 +267,36 @@ func (clusterList *ClusterList) updatePriority(clusterInfo *ClusterInfo, usedVer
 		return updatePriorityNone
 	}
 
+	// cluster reconciliation is paused
+	if paused(clusterInfo.Cluster) {
+		return updatePriorityNone
+	}
+
+	// cluster failed repeatedly and is quarantined
+	if clusterList.quarantine != nil && quarantined(clusterInfo, time.Now()) {
+		return updatePriorityNone
+	}
+
 	// something is wrong with cluster configuration (e.g. missing channel)
 	if clusterInfo.NextError != nil {
 		return updatePriorityNormal
 	}
 
-	// cluster needs to be decommissioned
+	// cluster needs to be decommissioned, unless it's protected from
+	// deletion
 	if cluster.LifecycleStatus == statusDecommissionRequested {
+		if provisioner.DeletionProtected(cluster) {
+			return updatePriorityNone
+		}
 		return updatePriorityDecommissionRequested
 	}
 
+	// urgent updates to a new channel version bypass the environment
+	// order, the rollout batches and the maintenance window
+	if urgentUpdate(clusterInfo) {
+		return updatePriorityUrgent
+	}
+
 	// if the cluster's environment has another environment marked as a prerequisite, check if all clusters
 	// in that environment use the new version. only allow channel version change it if's true.
 	if clusterInfo.NextVersion.ConfigVersion != clusterInfo.CurrentVersion.ConfigVersion {
@@ -204,6 +305,18 @@ func (clusterList *ClusterList) updatePriority(clusterInfo *ClusterInfo, usedVer
 				return updatePriorityNone
 			}
 		}
+
+		// the cluster isn't admitted to the current batch of the rollout
+		if clusterList.rollouts != nil && !clusterList.rollouts.admitted(clusterInfo) {
+			return updatePriorityNone
+		}
+	}
+
+	// disruptive operations wait for the maintenance window unless the
+	// cluster can be provisioned in apply only mode until then
+	now := time.Now()
+	if !inMaintenanceWindow(cluster, now) && !maintenanceApplyOnly(cluster) {
+		return updatePriorityNone
 	}
 
 	// cluster is already being updated (CLM restart?)
@@ -216,26 +329,56 @@ func (clusterList *ClusterList) updatePriority(clusterInfo *ClusterInfo, usedVer
 		return updatePriorityNormal
 	}
 
+	// the maintenance window started after provisioning in apply only mode
+	if clusterInfo.maintenancePending && inMaintenanceWindow(cluster, now) {
+		return updatePriorityNormal
+	}
+
+	// the hibernation schedule started or ended
+	if hibernationScheduled(cluster) != clusterInfo.hibernationScheduled {
+		return updatePriorityNormal
+	}
+
 	return updatePriorityNone
 }
 
 // SelectNext returns the next cluster to update, if any, and marks it as being processed. A cluster with higher
 // priority will be selected first, in case of ties it'll select a cluster that hasn't been updated for the longest
-// time.
+// time. Clusters in infrastructure accounts which already have the maximum number of clusters being processed are
+// skipped, so they don't exhaust the AWS API limits of the account.
 func (clusterList *ClusterList) SelectNext(cancelUpdate context.CancelFunc) *ClusterInfo {
 	clusterList.Lock()
 	defer clusterList.Unlock()
 
-	if len(clusterList.pendingUpdate) == 0 {
-		return nil
+	for i, result := range clusterList.pendingUpdate {
+		if clusterList.accountLimitReached(result.Cluster.InfrastructureAccount) {
+			continue
+		}
+
+		result.state = stateProcessing
+		result.cancelUpdate = cancelUpdate
+		clusterList.pendingUpdate = append(clusterList.pendingUpdate[:i:i], clusterList.pendingUpdate[i+1:]...)
+
+		return result
 	}
 
-	result := clusterList.pendingUpdate[0]
-	result.state = stateProcessing
-	result.cancelUpdate = cancelUpdate
-	clusterList.pendingUpdate = clusterList.pendingUpdate[1:]
+	return nil
+}
 
-	return result
+// accountLimitReached returns true if the maximum number of clusters in the infrastructure account are already
+// being processed.
+func (clusterList *ClusterList) accountLimitReached(account string) bool {
+	if clusterList.accountConcurrency == 0 {
+		return false
+	}
+
+	processing := uint(0)
+	for _, cluster := range clusterList.clusters {
+		if cluster.state == stateProcessing && cluster.Cluster.InfrastructureAccount == account {
+			processing++
+		}
+	}
+	return processing >= clusterList.accountConcurrency
 }
 
 // ClusterProcessed marks a cluster as no longer being processed.
@@ -247,5 +390,21 @@ func (clusterList *ClusterList) ClusterProcessed(cluster *ClusterInfo) {
 		cluster.state = stateProcessed
 		cluster.cancelUpdate = func() {}
 		cluster.lastProcessed = time.Now()
+
+		if clusterList.rollouts != nil {
+			clusterList.rollouts.processed(cluster)
+		}
+	}
+}
+
+// Rollouts returns the state of the rollouts of all channels, nil if
+// batched rollouts aren't enabled.
+func (clusterList *ClusterList) Rollouts() []*Rollout {
+	clusterList.Lock()
+	defer clusterList.Unlock()
+
+	if clusterList.rollouts == nil {
+		return nil
 	}
+	return clusterList.rollouts.list()
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
 )
 
 var mockStatus = &api.ClusterStatus{
@@ -96,6 +97,28 @@ func TestUpdateIgnoresClusters(t *testing.T) {
 			},
 			ignored: true,
 		},
+		{
+			cluster: &api.Cluster{
+				ID: "aws:123456789011:eu-central-1:paused",
+				InfrastructureAccount: "aws:123456789011",
+				LifecycleStatus:       "ready",
+				Channel:               "dev",
+				Status:                mockStatus,
+				ConfigItems:           map[string]string{pausedConfigItem: "true"},
+			},
+			ignored: true,
+		},
+		{
+			cluster: &api.Cluster{
+				ID: "aws:123456789011:eu-central-1:not-paused",
+				InfrastructureAccount: "aws:123456789011",
+				LifecycleStatus:       "ready",
+				Channel:               "dev",
+				Status:                mockStatus,
+				ConfigItems:           map[string]string{pausedConfigItem: "false"},
+			},
+			ignored: false,
+		},
 		{
 			cluster: &api.Cluster{
 				ID: "foobar:123456789011:eu-central-1:not-included",
@@ -107,7 +130,7 @@ func TestUpdateIgnoresClusters(t *testing.T) {
 			ignored: true,
 		},
 	} {
-		clusterList := NewClusterList(filter, []string{})
+		clusterList := NewClusterList(filter, []string{}, 0)
 		clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{ti.cluster})
 		nextCluster := clusterList.SelectNext(dummyCancelFunc)
 		if ti.ignored {
@@ -151,7 +174,7 @@ func TestUpdateAddsNewClusters(t *testing.T) {
 		Status:                mockStatus,
 	}
 
-	clusterList := NewClusterList(config.DefaultFilter, []string{})
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
 
 	// No clusters yet
 	require.Nil(t, clusterList.SelectNext(dummyCancelFunc))
@@ -174,7 +197,7 @@ func TestUpdateUpdatesExistingClusters(t *testing.T) {
 		Status:                mockStatus,
 	}
 
-	clusterList := NewClusterList(config.DefaultFilter, []string{})
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
 
 	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
 
@@ -216,7 +239,7 @@ func TestUpdateAbortsProcessingIfBlocked(t *testing.T) {
 		Status:                mockStatus,
 	}
 
-	clusterList := NewClusterList(config.DefaultFilter, []string{})
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
 	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
@@ -236,6 +259,37 @@ func TestUpdateAbortsProcessingIfBlocked(t *testing.T) {
 	require.Equal(t, context.Canceled, ctx.Err())
 }
 
+func TestUpdateAbortsProcessingIfPaused(t *testing.T) {
+	cluster := &api.Cluster{
+		ID: "aws:123456789011:eu-central-1:cluster",
+		InfrastructureAccount: "aws:123456789011",
+		LifecycleStatus:       "ready",
+		Channel:               "dev",
+		Status:                mockStatus,
+	}
+
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	next := clusterList.SelectNext(cancelFunc)
+	require.NotNil(t, next)
+	require.NoError(t, ctx.Err())
+
+	updated := &api.Cluster{
+		ID: "aws:123456789011:eu-central-1:cluster",
+		InfrastructureAccount: "aws:123456789011",
+		LifecycleStatus:       "ready",
+		Channel:               "dev",
+		Status:                mockStatus,
+		ConfigItems:           map[string]string{pausedConfigItem: "true"},
+	}
+	require.False(t, clusterList.clusters[cluster.ID].paused)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{updated})
+	require.Equal(t, context.Canceled, ctx.Err())
+	require.True(t, clusterList.clusters[cluster.ID].paused)
+}
+
 func TestUpdateDeletesUnusedClusters(t *testing.T) {
 	cluster1 := &api.Cluster{
 		ID: "aws:123456789011:eu-central-1:cluster1",
@@ -252,7 +306,7 @@ func TestUpdateDeletesUnusedClusters(t *testing.T) {
 		Status:                mockStatus,
 	}
 
-	clusterList := NewClusterList(config.DefaultFilter, []string{})
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
 
 	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster1, cluster2})
 	require.Equal(t, []string{cluster1.ID, cluster2.ID}, sortedStrings(allClusterIds(clusterList)))
@@ -302,7 +356,7 @@ func TestClusterPriority(t *testing.T) {
 		{pendingUpdate, normal, decommissionRequested},
 		{pendingUpdate, decommissionRequested, normal},
 	} {
-		clusterList := NewClusterList(config.DefaultFilter, []string{})
+		clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
 
 		clusterList.UpdateAvailable(defaultChannels, clusters)
 		assert.Equal(t, []string{pendingUpdate.ID, decommissionRequested.ID, normal.ID}, allClusterIds(clusterList))
@@ -313,6 +367,49 @@ func TestClusterPriority(t *testing.T) {
 	}
 }
 
+func TestDeletionProtectedClusterPriority(t *testing.T) {
+	protected := &api.Cluster{
+		ID:                    "aws:123456789012:eu-central-1:protected",
+		InfrastructureAccount: "aws:123456789012",
+		LifecycleStatus:       "decommission-requested",
+		Channel:               "dev",
+		Status:                mockStatus,
+		ConfigItems:           map[string]string{"deletion_protection": "true"},
+	}
+
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{protected})
+	assert.Empty(t, allClusterIds(clusterList))
+	assert.True(t, clusterList.clusters[protected.ID].deletionProtected)
+
+	protected.ConfigItems[provisioner.ConfigKeyDeletionProtectionOverride] = protected.ID
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{protected})
+	assert.Equal(t, []string{protected.ID}, allClusterIds(clusterList))
+	assert.False(t, clusterList.clusters[protected.ID].deletionProtected)
+}
+
+func TestHibernationScheduleChangePriority(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:                    "aws:123456789012:eu-central-1:scheduled",
+		InfrastructureAccount: "aws:123456789012",
+		LifecycleStatus:       "ready",
+		Channel:               "dev",
+		ConfigItems:           map[string]string{"hibernate_schedule": "Mon-Sun 00:00-24:00 UTC"},
+	}
+	version, err := cluster.Version(devRevision)
+	require.NoError(t, err)
+	cluster.Status = &api.ClusterStatus{CurrentVersion: version.String()}
+
+	// the schedule state of new clusters is taken as provisioned
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	assert.Empty(t, allClusterIds(clusterList))
+
+	clusterList.clusters[cluster.ID].hibernationScheduled = false
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	assert.Equal(t, []string{cluster.ID}, allClusterIds(clusterList))
+}
+
 func TestClusterEnvOrder(t *testing.T) {
 	status := &api.ClusterStatus{
 		CurrentVersion: "abc123#test",
@@ -363,7 +460,7 @@ func TestClusterEnvOrder(t *testing.T) {
 	}
 
 	pendingUpdates := func(clusters ...*api.Cluster) []string {
-		clusterList := NewClusterList(config.DefaultFilter, []string{"test", "prod"})
+		clusterList := NewClusterList(config.DefaultFilter, []string{"test", "prod"}, 0)
 		clusterList.UpdateAvailable(channels, clusters)
 		return allClusterIds(clusterList)
 	}
@@ -382,7 +479,7 @@ func TestClusterEnvOrder(t *testing.T) {
 }
 
 func TestClusterLastUpdated(t *testing.T) {
-	clusterList := NewClusterList(config.DefaultFilter, []string{})
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
 
 	clusters := []*api.Cluster{
 		{
@@ -443,7 +540,7 @@ func TestProcessingClusterNotDeleted(t *testing.T) {
 		Status:                mockStatus,
 	}
 
-	clusterList := NewClusterList(config.DefaultFilter, []string{})
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
 	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
 	next := clusterList.SelectNext(dummyCancelFunc)
 	require.NotNil(t, next)
@@ -479,7 +576,7 @@ func TestProcessingClusterNotUpdated(t *testing.T) {
 		Status:                mockStatus,
 	}
 
-	clusterList := NewClusterList(config.DefaultFilter, []string{})
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
 	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
 	next := clusterList.SelectNext(dummyCancelFunc)
 	require.NotNil(t, next)
@@ -505,3 +602,55 @@ func TestProcessingClusterNotUpdated(t *testing.T) {
 	require.NotNil(t, next2)
 	require.Equal(t, updated.LifecycleStatus, next2.Cluster.LifecycleStatus)
 }
+
+func TestAccountConcurrency(t *testing.T) {
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 1)
+
+	clusters := []*api.Cluster{
+		{
+			ID:                    "aws:123456789011:eu-central-1:cluster1",
+			InfrastructureAccount: "aws:123456789011",
+			LifecycleStatus:       "ready",
+			Channel:               "dev",
+			Status:                mockStatus,
+		},
+		{
+			ID:                    "aws:123456789011:eu-west-1:cluster2",
+			InfrastructureAccount: "aws:123456789011",
+			LifecycleStatus:       "ready",
+			Channel:               "dev",
+			Status:                mockStatus,
+		},
+		{
+			ID:                    "aws:123456789012:eu-central-1:cluster3",
+			InfrastructureAccount: "aws:123456789012",
+			LifecycleStatus:       "ready",
+			Channel:               "dev",
+			Status:                mockStatus,
+		},
+	}
+
+	clusterList.UpdateAvailable(defaultChannels, clusters)
+
+	// only one cluster per account is processed at the same time
+	next1 := clusterList.SelectNext(dummyCancelFunc)
+	require.NotNil(t, next1)
+
+	next2 := clusterList.SelectNext(dummyCancelFunc)
+	require.NotNil(t, next2)
+	require.NotEqual(t, next1.Cluster.InfrastructureAccount, next2.Cluster.InfrastructureAccount)
+
+	require.Nil(t, clusterList.SelectNext(dummyCancelFunc))
+
+	// the remaining cluster is selected once its account is free again
+	blocking := next1
+	if blocking.Cluster.InfrastructureAccount != "aws:123456789011" {
+		blocking = next2
+	}
+	clusterList.ClusterProcessed(blocking)
+
+	next3 := clusterList.SelectNext(dummyCancelFunc)
+	require.NotNil(t, next3)
+	require.Equal(t, "aws:123456789011", next3.Cluster.InfrastructureAccount)
+	require.NotEqual(t, blocking.Cluster.ID, next3.Cluster.ID)
+}
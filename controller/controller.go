@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,6 +12,9 @@ import (
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/decrypter"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/events"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/history"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/registry"
 )
@@ -18,9 +22,15 @@ import (
 const (
 	errTypeGeneral           = "https://cluster-lifecycle-manager.zalando.org/problems/general-error"
 	errTypeCoalescedProblems = "https://cluster-lifecycle-manager.zalando.org/problems/too-many-problems"
+	errTypeTimeout           = "https://cluster-lifecycle-manager.zalando.org/problems/provisioning-timeout"
 	errorLimit               = 25
 )
 
+const (
+	operationProvision    = "provision"
+	operationDecommission = "decommission"
+)
+
 var (
 	statusRequested             = "requested"
 	statusReady                 = "ready"
@@ -36,7 +46,32 @@ type Options struct {
 	DryRun            bool
 	SecretDecrypter   decrypter.SecretDecrypter
 	ConcurrentUpdates uint
-	EnvironmentOrder  []string
+	// ConcurrentAccountUpdates limits the number of clusters per
+	// infrastructure account processed at the same time, 0 means
+	// unlimited.
+	ConcurrentAccountUpdates uint
+	EnvironmentOrder         []string
+	// History records the provisioning attempts if set.
+	History history.Store
+	// RolloutBatches are the cumulative percentages of the clusters of a
+	// channel new channel versions are rolled out to, e.g. 5, 25 and 100.
+	// All clusters are updated at once if empty.
+	RolloutBatches []uint
+	// RolloutMaxFailureRate is the percentage of failed clusters in a
+	// batch halting the rollout.
+	RolloutMaxFailureRate float64
+	// Redactor is updated with the values of the sensitive config items
+	// of the clusters, which are masked in the problems and the history.
+	Redactor *logging.Redactor
+	// Events publishes the lifecycle transitions of the clusters if set.
+	Events events.Publisher
+	// QuarantineThreshold is the number of consecutive failures after which
+	// a cluster is quarantined and retried with an exponential backoff
+	// from QuarantineBackoff up to QuarantineMaxBackoff. Clusters are never
+	// quarantined if 0.
+	QuarantineThreshold  uint
+	QuarantineBackoff    time.Duration
+	QuarantineMaxBackoff time.Duration
 }
 
 // Controller defines the main control loop for the cluster-lifecycle-manager.
@@ -50,20 +85,30 @@ type Controller struct {
 	dryRun               bool
 	clusterList          *ClusterList
 	concurrentUpdates    uint
+	history              history.Store
+	redactor             *logging.Redactor
+	events               events.Publisher
 }
 
 // New initializes a new controller.
 func New(logger *log.Entry, registry registry.Registry, provisioner provisioner.Provisioner, channelConfigSourcer channel.ConfigSource, options *Options) *Controller {
+	clusterList := NewClusterList(options.AccountFilter, options.EnvironmentOrder, options.ConcurrentAccountUpdates)
+	clusterList.rollouts = newRolloutCoordinator(options.RolloutBatches, options.RolloutMaxFailureRate)
+	clusterList.quarantine = newQuarantinePolicy(options.QuarantineThreshold, options.QuarantineBackoff, options.QuarantineMaxBackoff)
+
 	return &Controller{
-		logger:               logger,
+		logger:               logging.WithModule(logger, "controller"),
 		registry:             registry,
 		provisioner:          provisioner,
 		channelConfigSourcer: channelConfigSourcer,
 		secretDecrypter:      options.SecretDecrypter,
 		interval:             options.Interval,
 		dryRun:               options.DryRun,
-		clusterList:          NewClusterList(options.AccountFilter, options.EnvironmentOrder),
+		clusterList:          clusterList,
 		concurrentUpdates:    options.ConcurrentUpdates,
+		history:              options.History,
+		redactor:             options.Redactor,
+		events:               options.Events,
 	}
 }
 
@@ -94,15 +139,23 @@ func (c *Controller) Run(ctx context.Context) {
 	}
 }
 
+// processWorkerLoop processes the pending clusters one at a time. The worker
+// only waits for the next interval if there are no pending clusters, so a
+// slow cluster processed by another worker doesn't delay the rest.
 func (c *Controller) processWorkerLoop(ctx context.Context, workerNum uint) {
+	interval := c.interval
 	for {
 		select {
-		case <-time.After(c.interval):
+		case <-time.After(interval):
 			updateCtx, cancelFunc := context.WithCancel(ctx)
 			nextCluster := c.clusterList.SelectNext(cancelFunc)
 			if nextCluster != nil {
 				c.processCluster(updateCtx, workerNum, nextCluster)
+				interval = 0
+			} else {
+				interval = c.interval
 			}
+			cancelFunc()
 		case <-ctx.Done():
 			return
 		}
@@ -163,9 +216,32 @@ func (c *Controller) doProcessCluster(logger *log.Entry, updateCtx context.Conte
 		return err
 	}
 
+	sensitiveValues, err := provisioner.SensitiveConfigValues(cluster, config)
+	if err != nil {
+		return err
+	}
+	c.redactor.SetValues(cluster.ID, sensitiveValues)
+
 	switch cluster.LifecycleStatus {
 	case statusRequested, statusReady:
 		cluster.Status.NextVersion = clusterInfo.NextVersion.String()
+		scheduled := hibernationScheduled(cluster)
+
+		urgent := urgentUpdate(clusterInfo)
+		if urgent {
+			logger.Warnf("Urgent update to channel version %s triggered by %s: %s", clusterInfo.NextVersion.ConfigVersion,
+				cluster.ConfigItems[provisioner.ConfigKeyUrgentUpdateBy], cluster.ConfigItems[provisioner.ConfigKeyUrgentUpdateReason])
+		} else {
+			clearUrgentUpdate(cluster)
+		}
+
+		// outside of the maintenance window clusters are only provisioned
+		// in apply only mode, without rolling any nodes.
+		applyOnly := !urgent && !inMaintenanceWindow(cluster, time.Now()) && cluster.ConfigItems[applyOnlyConfigItem] != "true"
+		if applyOnly {
+			logger.Infof("Outside of the maintenance window, provisioning in apply only mode")
+			cluster.ConfigItems[applyOnlyConfigItem] = "true"
+		}
 		if !c.dryRun {
 			err = c.registry.UpdateCluster(cluster)
 			if err != nil {
@@ -178,6 +254,8 @@ func (c *Controller) doProcessCluster(logger *log.Entry, updateCtx context.Conte
 			return err
 		}
 
+		clusterInfo.hibernationScheduled = scheduled
+		clusterInfo.maintenancePending = applyOnly
 		cluster.LifecycleStatus = statusReady
 		cluster.Status.LastVersion = cluster.Status.CurrentVersion
 		cluster.Status.CurrentVersion = cluster.Status.NextVersion
@@ -206,33 +284,70 @@ func (c *Controller) processCluster(updateCtx context.Context, workerNum uint, c
 	defer c.clusterList.ClusterProcessed(clusterInfo)
 
 	cluster := clusterInfo.Cluster
-	clusterLog := c.logger.WithField("cluster", cluster.Alias).WithField("worker", workerNum)
+
+	operation := operationProvision
+	if cluster.LifecycleStatus == statusDecommissionRequested {
+		operation = operationDecommission
+	}
+	started := time.Now()
+	previousStatus := cluster.LifecycleStatus
+	clusterInfo.attempt++
+
+	clusterLog := c.logger.WithFields(log.Fields{
+		"cluster":              cluster.Alias,
+		"worker":               workerNum,
+		logging.FieldCluster:   cluster.ID,
+		logging.FieldProvider:  cluster.Provider,
+		logging.FieldOperation: operation,
+		logging.FieldAttempt:   clusterInfo.attempt,
+	})
 
 	clusterLog.Infof("Processing cluster (%s)", cluster.LifecycleStatus)
 
 	err := c.doProcessCluster(clusterLog, updateCtx, clusterInfo)
 
 	// log the error and resolve the special error cases
+	errType := errTypeGeneral
 	if err != nil {
 		clusterLog.Errorf("Failed to process cluster: %s", err)
 
+		var timeoutErr *provisioner.ProvisionTimeoutError
+		if errors.As(err, &timeoutErr) {
+			errType = errTypeTimeout
+		}
+
 		// treat "provider not supported" as no error
 		if err == provisioner.ErrProviderNotSupported {
 			err = nil
+		} else {
+			// the problems and the history are exposed, so the
+			// values of sensitive config items are masked
+			err = errors.New(c.redactor.Redact(err.Error()))
 		}
 	} else {
 		clusterLog.Infof("Finished processing cluster")
+		clusterInfo.attempt = 0
+	}
+
+	if c.clusterList.quarantine != nil && cluster.Status != nil {
+		c.clusterList.quarantine.update(clusterInfo, err != nil, time.Now())
+		if err != nil && cluster.Status.Degraded {
+			clusterLog.Warnf("Quarantined cluster after %d consecutive failures until %s", clusterInfo.attempt, cluster.Status.QuarantinedUntil)
+		}
 	}
 
 	// update the cluster state in the registry
 	if !c.dryRun {
+		c.recordHistory(clusterLog, clusterInfo, operation, started, err)
+		c.publishEvent(clusterLog, clusterInfo, previousStatus, err)
+
 		if err != nil {
 			if cluster.Status.Problems == nil {
 				cluster.Status.Problems = make([]*api.Problem, 0, 1)
 			}
 			cluster.Status.Problems = append(cluster.Status.Problems, &api.Problem{
 				Title: err.Error(),
-				Type:  errTypeGeneral,
+				Type:  errType,
 			})
 
 			if len(cluster.Status.Problems) > errorLimit {
@@ -249,6 +364,24 @@ func (c *Controller) processCluster(updateCtx context.Context, workerNum uint, c
 		if err != nil {
 			clusterLog.Errorf("Unable to update cluster state: %s", err)
 		}
+
+		c.updateNodePoolStatus(clusterLog, cluster, started)
+	}
+}
+
+// updateNodePoolStatus writes the status of the node pools observed by the
+// provisioner since started back to the registry, so it can be used as an
+// inventory of the fleet. Statuses from previous runs aren't written again.
+func (c *Controller) updateNodePoolStatus(logger *log.Entry, cluster *api.Cluster, started time.Time) {
+	for _, nodePool := range cluster.NodePools {
+		if nodePool.Status == nil || nodePool.Status.LastUpdated.Before(started) {
+			continue
+		}
+
+		err := c.registry.UpdateNodePoolStatus(cluster, nodePool)
+		if err != nil {
+			logger.Errorf("Unable to update status of node pool %s: %s", nodePool.Name, err)
+		}
 	}
 }
 
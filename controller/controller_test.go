@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -64,8 +65,9 @@ func (p *mockErrCreateProvisioner) Provision(ctx context.Context, logger *log.En
 }
 
 type mockRegistry struct {
-	theCluster *api.Cluster
-	lastUpdate *api.Cluster
+	theCluster            *api.Cluster
+	lastUpdate            *api.Cluster
+	nodePoolStatusUpdates []string
 }
 
 func MockRegistry(lifecycleStatus string, status *api.ClusterStatus) *mockRegistry {
@@ -90,6 +92,13 @@ func (r *mockRegistry) UpdateCluster(cluster *api.Cluster) error {
 	r.lastUpdate = cluster
 	return nil
 }
+func (r *mockRegistry) CreateCluster(cluster *api.Cluster) error {
+	return nil
+}
+func (r *mockRegistry) UpdateNodePoolStatus(cluster *api.Cluster, nodePool *api.NodePool) error {
+	r.nodePoolStatusUpdates = append(r.nodePoolStatusUpdates, nodePool.Name)
+	return nil
+}
 
 type mockChannelSource struct {
 	configVersions channel.ConfigVersions
@@ -208,6 +217,24 @@ func TestProcessCluster(t *testing.T) {
 	}
 }
 
+func TestUpdateNodePoolStatus(t *testing.T) {
+	registry := MockRegistry(statusReady, nil)
+	controller := New(defaultLogger, registry, &mockProvisioner{}, MockChannelSource(defaultVersions, false), defaultOptions)
+
+	started := time.Now()
+	cluster := &api.Cluster{
+		ID: "aws:123456789012:eu-central-1:kube-1",
+		NodePools: []*api.NodePool{
+			{Name: "observed", Status: &api.NodePoolStatus{CurrentSize: 3, LastUpdated: started.Add(time.Minute)}},
+			{Name: "stale", Status: &api.NodePoolStatus{CurrentSize: 3, LastUpdated: started.Add(-time.Hour)}},
+			{Name: "unknown"},
+		},
+	}
+
+	controller.updateNodePoolStatus(defaultLogger, cluster, started)
+	require.Equal(t, []string{"observed"}, registry.nodePoolStatusUpdates)
+}
+
 func TestIgnoreUnsupportedProvider(t *testing.T) {
 	registry := MockRegistry("ready", nil)
 	registry.theCluster.Provider = "<unsupported>"
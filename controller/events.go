@@ -0,0 +1,67 @@
+package controller
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/events"
+)
+
+// lifecycleEventType returns the type of the event published for the
+// transition of a cluster from the previous lifecycle status, or an empty
+// string if no event is published.
+func lifecycleEventType(clusterInfo *ClusterInfo, previousStatus string, err error) string {
+	if err != nil {
+		return events.TypeClusterFailed
+	}
+
+	cluster := clusterInfo.Cluster
+	switch {
+	case cluster.LifecycleStatus == statusDecommissioned:
+		return events.TypeClusterDecommissioned
+	case previousStatus == statusRequested && cluster.LifecycleStatus == statusReady:
+		return events.TypeClusterCreated
+	case cluster.LifecycleStatus == statusReady && cluster.Status != nil && cluster.Status.CurrentVersion != cluster.Status.LastVersion:
+		return events.TypeClusterUpdated
+	default:
+		return ""
+	}
+}
+
+// publishEvent publishes an event about the lifecycle transition of the
+// cluster. Failing to publish the event is only logged since it shouldn't
+// fail the provisioning.
+func (c *Controller) publishEvent(logger *log.Entry, clusterInfo *ClusterInfo, previousStatus string, err error) {
+	if c.events == nil {
+		return
+	}
+
+	eventType := lifecycleEventType(clusterInfo, previousStatus, err)
+	if eventType == "" {
+		return
+	}
+
+	cluster := clusterInfo.Cluster
+	data := &events.ClusterData{
+		ClusterID:               cluster.ID,
+		Alias:                   cluster.Alias,
+		InfrastructureAccount:   cluster.InfrastructureAccount,
+		Region:                  cluster.Region,
+		Provider:                cluster.Provider,
+		Environment:             cluster.Environment,
+		LifecycleStatus:         cluster.LifecycleStatus,
+		PreviousLifecycleStatus: previousStatus,
+	}
+	if clusterInfo.NextVersion != nil {
+		data.ChannelVersion = string(clusterInfo.NextVersion.ConfigVersion)
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+
+	event, publishErr := events.NewEvent(eventType, cluster.ID, data)
+	if publishErr == nil {
+		publishErr = c.events.Publish(event)
+	}
+	if publishErr != nil {
+		logger.Errorf("Failed to publish %s event: %v", eventType, publishErr)
+	}
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/events"
+)
+
+type mockPublisher struct {
+	events []*events.Event
+}
+
+func (p *mockPublisher) Publish(event *events.Event) error {
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestLifecycleEventType(t *testing.T) {
+	for _, tc := range []struct {
+		msg            string
+		previousStatus string
+		status         *api.ClusterStatus
+		lifecycle      string
+		err            error
+		expected       string
+	}{
+		{
+			msg:            "created",
+			previousStatus: statusRequested,
+			lifecycle:      statusReady,
+			status:         &api.ClusterStatus{CurrentVersion: "abc"},
+			expected:       events.TypeClusterCreated,
+		},
+		{
+			msg:            "updated",
+			previousStatus: statusReady,
+			lifecycle:      statusReady,
+			status:         &api.ClusterStatus{CurrentVersion: "def", LastVersion: "abc"},
+			expected:       events.TypeClusterUpdated,
+		},
+		{
+			msg:            "unchanged",
+			previousStatus: statusReady,
+			lifecycle:      statusReady,
+			status:         &api.ClusterStatus{CurrentVersion: "abc", LastVersion: "abc"},
+			expected:       "",
+		},
+		{
+			msg:            "decommissioned",
+			previousStatus: statusDecommissionRequested,
+			lifecycle:      statusDecommissioned,
+			status:         &api.ClusterStatus{},
+			expected:       events.TypeClusterDecommissioned,
+		},
+		{
+			msg:            "failed",
+			previousStatus: statusReady,
+			lifecycle:      statusReady,
+			status:         &api.ClusterStatus{},
+			err:            errors.New("failed"),
+			expected:       events.TypeClusterFailed,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			clusterInfo := &ClusterInfo{Cluster: &api.Cluster{LifecycleStatus: tc.lifecycle, Status: tc.status}}
+			require.Equal(t, tc.expected, lifecycleEventType(clusterInfo, tc.previousStatus, tc.err))
+		})
+	}
+}
+
+func TestPublishEvent(t *testing.T) {
+	publisher := &mockPublisher{}
+	controller := &Controller{logger: log.WithField("test", true), events: publisher}
+
+	clusterInfo := &ClusterInfo{
+		Cluster: &api.Cluster{
+			ID:              "aws:123456789012:eu-central-1:kube-1",
+			LifecycleStatus: statusReady,
+			Status:          &api.ClusterStatus{CurrentVersion: "abc"},
+		},
+		NextVersion: &api.ClusterVersion{ConfigVersion: "abc"},
+	}
+
+	controller.publishEvent(controller.logger, clusterInfo, statusRequested, nil)
+	require.Len(t, publisher.events, 1)
+	require.Equal(t, events.TypeClusterCreated, publisher.events[0].Type)
+	require.Equal(t, "aws:123456789012:eu-central-1:kube-1", publisher.events[0].Subject)
+
+	data := publisher.events[0].Data.(*events.ClusterData)
+	require.Equal(t, statusRequested, data.PreviousLifecycleStatus)
+	require.Equal(t, "abc", data.ChannelVersion)
+
+	// publishing is optional
+	controller.events = nil
+	controller.publishEvent(controller.logger, clusterInfo, statusRequested, nil)
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/history"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
+)
+
+const (
+	historyPathPrefix   = "/clusters/"
+	historyPathSuffix   = "/history"
+	defaultHistoryLimit = 20
+)
+
+// recordHistory records the provisioning attempt of the cluster in the
+// history store. Failing to record the attempt is only logged since it
+// shouldn't fail the provisioning.
+func (c *Controller) recordHistory(logger *log.Entry, clusterInfo *ClusterInfo, operation string, started time.Time, err error) {
+	if c.history == nil {
+		return
+	}
+
+	var channelVersion string
+	if clusterInfo.NextVersion != nil {
+		channelVersion = string(clusterInfo.NextVersion.ConfigVersion)
+	}
+
+	cluster := clusterInfo.Cluster
+	entry := history.NewEntry(cluster.ID, operation, channelVersion, started, err)
+	if cluster.Status != nil {
+		entry.AuditLog = cluster.Status.AuditLog
+	}
+	if urgentUpdate(clusterInfo) {
+		entry.Urgent = &history.Urgent{
+			Reason:      cluster.ConfigItems[provisioner.ConfigKeyUrgentUpdateReason],
+			TriggeredBy: cluster.ConfigItems[provisioner.ConfigKeyUrgentUpdateBy],
+		}
+	}
+
+	recordErr := c.history.Record(entry)
+	if recordErr != nil {
+		logger.Errorf("Failed to record provisioning history: %v", recordErr)
+	}
+}
+
+// HistoryHandler returns an HTTP handler serving the provisioning history of
+// a cluster at /clusters/<cluster id>/history, newest first. The number of
+// entries can be limited with the limit query parameter.
+func (c *Controller) HistoryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if c.history == nil {
+			http.Error(w, "provisioning history is not enabled", http.StatusNotFound)
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, historyPathPrefix) || !strings.HasSuffix(r.URL.Path, historyPathSuffix) {
+			http.NotFound(w, r)
+			return
+		}
+
+		clusterID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, historyPathPrefix), historyPathSuffix)
+		if clusterID == "" || strings.Contains(clusterID, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		limit := defaultHistoryLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 0 {
+				http.Error(w, "invalid limit: "+value, http.StatusBadRequest)
+				return
+			}
+		}
+
+		entries, err := c.history.List(clusterID, limit)
+		if err != nil {
+			c.logger.Errorf("Failed to list provisioning history of %s: %v", clusterID, err)
+			http.Error(w, "failed to list provisioning history", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(entries)
+		if err != nil {
+			c.logger.Errorf("Failed to write provisioning history of %s: %v", clusterID, err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/history"
+)
+
+type mockHistoryStore struct {
+	entries []*history.Entry
+	limit   int
+}
+
+func (s *mockHistoryStore) Record(entry *history.Entry) error {
+	s.entries = append([]*history.Entry{entry}, s.entries...)
+	return nil
+}
+
+func (s *mockHistoryStore) List(clusterID string, limit int) ([]*history.Entry, error) {
+	s.limit = limit
+	result := []*history.Entry{}
+	for _, entry := range s.entries {
+		if entry.ClusterID == clusterID {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+func TestRecordHistory(t *testing.T) {
+	store := &mockHistoryStore{}
+	controller := &Controller{logger: log.WithField("test", true), history: store}
+
+	clusterInfo := &ClusterInfo{
+		Cluster: &api.Cluster{
+			ID:     "aws:123456789012:eu-central-1:kube-1",
+			Status: &api.ClusterStatus{AuditLog: "s3://audit/kube-1.json"},
+		},
+		NextVersion: &api.ClusterVersion{ConfigVersion: "abc"},
+	}
+
+	controller.recordHistory(controller.logger, clusterInfo, operationProvision, time.Now(), errors.New("failed"))
+	require.Len(t, store.entries, 1)
+	require.Equal(t, "abc", store.entries[0].ChannelVersion)
+	require.Equal(t, history.ResultFailure, store.entries[0].Result)
+	require.Equal(t, "s3://audit/kube-1.json", store.entries[0].AuditLog)
+
+	// recording is optional
+	controller.history = nil
+	controller.recordHistory(controller.logger, clusterInfo, operationProvision, time.Now(), nil)
+}
+
+func TestHistoryHandler(t *testing.T) {
+	store := &mockHistoryStore{}
+	store.Record(history.NewEntry("aws:123456789012:eu-central-1:kube-1", operationProvision, "abc", time.Now(), nil))
+	store.Record(history.NewEntry("aws:123456789012:eu-central-1:kube-2", operationProvision, "abc", time.Now(), nil))
+	controller := &Controller{logger: log.WithField("test", true), history: store}
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		limit  int
+	}{
+		{path: "/clusters/aws:123456789012:eu-central-1:kube-1/history", status: http.StatusOK, limit: defaultHistoryLimit},
+		{path: "/clusters/aws:123456789012:eu-central-1:kube-1/history?limit=5", status: http.StatusOK, limit: 5},
+		{path: "/clusters/aws:123456789012:eu-central-1:kube-1/history?limit=-1", status: http.StatusBadRequest},
+		{path: "/clusters/aws:123456789012:eu-central-1:kube-1", status: http.StatusNotFound},
+		{path: "/clusters//history", status: http.StatusNotFound},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			controller.HistoryHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			require.Equal(t, tc.status, recorder.Code)
+
+			if tc.status == http.StatusOK {
+				require.Equal(t, tc.limit, store.limit)
+
+				var entries []*history.Entry
+				require.NoError(t, json.NewDecoder(recorder.Body).Decode(&entries))
+				require.Len(t, entries, 1)
+				require.Equal(t, "aws:123456789012:eu-central-1:kube-1", entries[0].ClusterID)
+			}
+		})
+	}
+
+	controller.history = nil
+	recorder := httptest.NewRecorder()
+	controller.HistoryHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/clusters/kube-1/history", nil))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/schedule"
+)
+
+const (
+	maintenanceWindowConfigItem          = "maintenance_window"
+	maintenanceWindowApplyOnlyConfigItem = "maintenance_window_apply_only"
+	applyOnlyConfigItem                  = "apply_only"
+)
+
+// maintenanceWindow returns the maintenance window of the cluster configured
+// with the maintenance_window config item, nil if the cluster has none.
+func maintenanceWindow(cluster *api.Cluster) (*schedule.Schedule, error) {
+	definition, ok := cluster.ConfigItems[maintenanceWindowConfigItem]
+	if !ok {
+		return nil, nil
+	}
+	return schedule.Parse(definition)
+}
+
+// inMaintenanceWindow returns true if disruptive operations may be started
+// on the cluster at the given time. That's always the case for clusters
+// without a maintenance window and for clusters which aren't ready yet.
+// Invalid maintenance windows are reported as the next error of the cluster
+// so they never allow disruptive operations.
+func inMaintenanceWindow(cluster *api.Cluster, now time.Time) bool {
+	if cluster.LifecycleStatus != statusReady {
+		return true
+	}
+
+	window, err := maintenanceWindow(cluster)
+	if err != nil {
+		return false
+	}
+	return window == nil || window.Active(now)
+}
+
+// maintenanceApplyOnly returns true if the cluster may be provisioned in
+// apply only mode outside of its maintenance window.
+func maintenanceApplyOnly(cluster *api.Cluster) bool {
+	return cluster.ConfigItems[maintenanceWindowApplyOnlyConfigItem] == "true"
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+)
+
+// inactiveMaintenanceWindow returns a maintenance window which isn't active
+// today.
+func inactiveMaintenanceWindow() string {
+	day := time.Now().UTC().Add(72 * time.Hour).Weekday()
+	return day.String()[:3] + " 00:00-24:00 UTC"
+}
+
+func TestInMaintenanceWindow(t *testing.T) {
+	cluster := &api.Cluster{
+		LifecycleStatus: "ready",
+		ConfigItems:     map[string]string{},
+	}
+	require.True(t, inMaintenanceWindow(cluster, time.Now()))
+
+	cluster.ConfigItems[maintenanceWindowConfigItem] = "Sat,Sun 02:00-06:00 UTC"
+	require.True(t, inMaintenanceWindow(cluster, time.Date(2019, 11, 23, 3, 0, 0, 0, time.UTC)))
+	require.False(t, inMaintenanceWindow(cluster, time.Date(2019, 11, 23, 7, 0, 0, 0, time.UTC)))
+
+	// clusters which aren't ready yet aren't restricted
+	cluster.LifecycleStatus = "requested"
+	require.True(t, inMaintenanceWindow(cluster, time.Date(2019, 11, 23, 7, 0, 0, 0, time.UTC)))
+
+	cluster.LifecycleStatus = "ready"
+	cluster.ConfigItems[maintenanceWindowConfigItem] = "weekends"
+	require.False(t, inMaintenanceWindow(cluster, time.Now()))
+}
+
+func TestMaintenanceWindowPriority(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:                    "aws:123456789012:eu-central-1:kube-1",
+		InfrastructureAccount: "aws:123456789012",
+		LifecycleStatus:       "ready",
+		Channel:               "dev",
+		Status:                mockStatus,
+		ConfigItems:           map[string]string{maintenanceWindowConfigItem: inactiveMaintenanceWindow()},
+	}
+
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	require.Empty(t, allClusterIds(clusterList))
+
+	cluster.ConfigItems[maintenanceWindowApplyOnlyConfigItem] = "true"
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	require.Equal(t, []string{cluster.ID}, allClusterIds(clusterList))
+
+	cluster.ConfigItems[maintenanceWindowConfigItem] = "Mon-Sun 00:00-24:00 UTC"
+	delete(cluster.ConfigItems, maintenanceWindowApplyOnlyConfigItem)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	require.Equal(t, []string{cluster.ID}, allClusterIds(clusterList))
+
+	// invalid maintenance windows are reported as errors
+	cluster.ConfigItems[maintenanceWindowConfigItem] = "weekends"
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	require.Error(t, clusterList.clusters[cluster.ID].NextError)
+}
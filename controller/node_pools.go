@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
+)
+
+const nodePoolsPathSuffix = "/node-pools"
+
+// clusterSnapshot returns a copy of the cluster with the id and the version
+// it's being updated to, so the cluster can be inspected without affecting
+// the processing of the original. It returns nil if the cluster isn't known.
+func (clusterList *ClusterList) clusterSnapshot(id string) (*api.Cluster, *api.ClusterVersion) {
+	clusterList.Lock()
+	defer clusterList.Unlock()
+
+	clusterInfo, ok := clusterList.clusters[id]
+	if !ok {
+		return nil, nil
+	}
+
+	cluster := *clusterInfo.Cluster
+	cluster.ConfigItems = copyConfigItems(clusterInfo.Cluster.ConfigItems)
+	cluster.NodePools = make([]*api.NodePool, 0, len(clusterInfo.Cluster.NodePools))
+	for _, nodePool := range clusterInfo.Cluster.NodePools {
+		nodePoolCopy := *nodePool
+		nodePoolCopy.ConfigItems = copyConfigItems(nodePool.ConfigItems)
+		cluster.NodePools = append(cluster.NodePools, &nodePoolCopy)
+	}
+	return &cluster, clusterInfo.NextVersion
+}
+
+func copyConfigItems(configItems map[string]string) map[string]string {
+	result := make(map[string]string, len(configItems))
+	for key, value := range configItems {
+		result[key] = value
+	}
+	return result
+}
+
+// ClusterHandler returns an HTTP handler serving the per-cluster views under
+// /clusters/<cluster id>/, the provisioning history and the node pools.
+func (c *Controller) ClusterHandler() http.Handler {
+	history := c.HistoryHandler()
+	nodePools := c.NodePoolHandler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, nodePoolsPathSuffix):
+			nodePools.ServeHTTP(w, r)
+		default:
+			history.ServeHTTP(w, r)
+		}
+	})
+}
+
+// NodePoolHandler returns an HTTP handler serving the live view of the node
+// pools of a cluster at /clusters/<cluster id>/node-pools: the instances with
+// their ages, images and kubelet versions, and the number of instances
+// pending replacement.
+func (c *Controller) NodePoolHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, historyPathPrefix) || !strings.HasSuffix(r.URL.Path, nodePoolsPathSuffix) {
+			http.NotFound(w, r)
+			return
+		}
+
+		clusterID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, historyPathPrefix), nodePoolsPathSuffix)
+		if clusterID == "" || strings.Contains(clusterID, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		inspector, ok := c.provisioner.(provisioner.NodePoolInspector)
+		if !ok {
+			http.Error(w, "node pool insights are not supported", http.StatusNotImplemented)
+			return
+		}
+
+		cluster, version := c.clusterList.clusterSnapshot(clusterID)
+		if cluster == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if version == nil {
+			http.Error(w, "the channel version of the cluster is unknown", http.StatusServiceUnavailable)
+			return
+		}
+
+		logger := c.logger.WithFields(log.Fields{
+			"cluster":            cluster.Alias,
+			logging.FieldCluster: cluster.ID,
+		})
+
+		config, err := c.channelConfigSourcer.Get(logger, version.ConfigVersion)
+		if err != nil {
+			logger.Errorf("Failed to get the channel config: %v", err)
+			http.Error(w, "failed to get the channel config", http.StatusInternalServerError)
+			return
+		}
+		defer c.channelConfigSourcer.Delete(logger, config)
+
+		err = c.decryptConfigItems(cluster)
+		if err != nil {
+			logger.Errorf("Failed to decrypt the config items: %v", err)
+			http.Error(w, "failed to decrypt the config items", http.StatusInternalServerError)
+			return
+		}
+
+		insights, err := inspector.NodePoolInsights(r.Context(), logger, cluster, config)
+		if err != nil {
+			logger.Errorf("Failed to inspect the node pools: %v", err)
+			http.Error(w, "failed to inspect the node pools", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(insights)
+		if err != nil {
+			logger.Errorf("Failed to write the node pools of %s: %v", clusterID, err)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
+)
+
+type mockNodePoolInspector struct {
+	mockProvisioner
+	cluster *api.Cluster
+}
+
+func (p *mockNodePoolInspector) NodePoolInsights(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) ([]*provisioner.NodePoolInsight, error) {
+	p.cluster = cluster
+	insights := make([]*provisioner.NodePoolInsight, 0, len(cluster.NodePools))
+	for _, nodePool := range cluster.NodePools {
+		insights = append(insights, &provisioner.NodePoolInsight{Name: nodePool.Name, PendingReplacements: 1})
+	}
+	return insights, nil
+}
+
+func TestNodePoolHandler(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:          "aws:123456789012:eu-central-1:kube-1",
+		ConfigItems: map[string]string{"foo": "bar"},
+		NodePools:   []*api.NodePool{{Name: "worker", ConfigItems: map[string]string{}}},
+	}
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
+	clusterList.clusters[cluster.ID] = &ClusterInfo{
+		Cluster:     cluster,
+		NextVersion: &api.ClusterVersion{ConfigVersion: "abc"},
+	}
+	clusterList.clusters["aws:123456789012:eu-central-1:kube-2"] = &ClusterInfo{
+		Cluster: &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-2"},
+	}
+
+	inspector := &mockNodePoolInspector{}
+	controller := &Controller{
+		logger:               log.WithField("test", true),
+		clusterList:          clusterList,
+		provisioner:          inspector,
+		channelConfigSourcer: MockChannelSource(nil, false),
+	}
+
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{path: "/clusters/aws:123456789012:eu-central-1:kube-1/node-pools", status: http.StatusOK},
+		{path: "/clusters/aws:123456789012:eu-central-1:kube-2/node-pools", status: http.StatusServiceUnavailable},
+		{path: "/clusters/aws:123456789012:eu-central-1:kube-3/node-pools", status: http.StatusNotFound},
+		{path: "/clusters//node-pools", status: http.StatusNotFound},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			controller.ClusterHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			require.Equal(t, tc.status, recorder.Code)
+
+			if tc.status == http.StatusOK {
+				var insights []*provisioner.NodePoolInsight
+				require.NoError(t, json.NewDecoder(recorder.Body).Decode(&insights))
+				require.Len(t, insights, 1)
+				require.Equal(t, "worker", insights[0].Name)
+				require.Equal(t, 1, insights[0].PendingReplacements)
+			}
+		})
+	}
+
+	// the provisioner gets a copy of the cluster
+	inspector.cluster.ConfigItems["foo"] = "baz"
+	require.Equal(t, "bar", cluster.ConfigItems["foo"])
+
+	controller.provisioner = &mockProvisioner{}
+	recorder := httptest.NewRecorder()
+	controller.NodePoolHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/clusters/aws:123456789012:eu-central-1:kube-1/node-pools", nil))
+	require.Equal(t, http.StatusNotImplemented, recorder.Code)
+}
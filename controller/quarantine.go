@@ -0,0 +1,88 @@
+package controller
+
+import "time"
+
+// quarantinePolicy isolates clusters failing to be processed several times
+// in a row, so they don't take up the workers updating the rest of the
+// fleet. Quarantined clusters are retried with an exponential backoff.
+type quarantinePolicy struct {
+	// threshold is the number of consecutive failures quarantining a
+	// cluster.
+	threshold  uint
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// newQuarantinePolicy returns the quarantine policy or nil if clusters are
+// never quarantined.
+func newQuarantinePolicy(threshold uint, backoff, maxBackoff time.Duration) *quarantinePolicy {
+	if threshold == 0 {
+		return nil
+	}
+
+	return &quarantinePolicy{
+		threshold:  threshold,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+	}
+}
+
+// until returns the time until which a cluster whose last attempts failed
+// is quarantined, or the zero time if it's below the threshold. The backoff
+// doubles with every failure past the threshold, up to the maximum.
+func (q *quarantinePolicy) until(failures uint, failed time.Time) time.Time {
+	if failures < q.threshold {
+		return time.Time{}
+	}
+
+	backoff := q.backoff
+	for i := q.threshold; i < failures && backoff < q.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > q.maxBackoff {
+		backoff = q.maxBackoff
+	}
+	return failed.Add(backoff)
+}
+
+// update marks the cluster as degraded in its status if the attempt failed
+// and the cluster is quarantined, or clears the quarantine.
+func (q *quarantinePolicy) update(clusterInfo *ClusterInfo, failed bool, now time.Time) {
+	status := clusterInfo.Cluster.Status
+	if !failed {
+		status.Degraded = false
+		status.QuarantinedUntil = ""
+		return
+	}
+
+	until := q.until(clusterInfo.attempt, now)
+	if until.IsZero() {
+		return
+	}
+	status.Degraded = true
+	status.QuarantinedUntil = until.UTC().Format(time.RFC3339)
+}
+
+// quarantined returns true if the cluster is degraded and its quarantine
+// hasn't expired. A new version of the cluster, e.g. fixing the cause of the
+// failures, lifts the quarantine.
+func quarantined(clusterInfo *ClusterInfo, now time.Time) bool {
+	status := clusterInfo.Cluster.Status
+	if status == nil || !status.Degraded {
+		return false
+	}
+
+	until, err := time.Parse(time.RFC3339, status.QuarantinedUntil)
+	if err != nil || !now.Before(until) {
+		return false
+	}
+
+	return targetVersion(clusterInfo) == status.NextVersion
+}
+
+func targetVersion(clusterInfo *ClusterInfo) string {
+	if clusterInfo.NextVersion == nil {
+		return ""
+	}
+	return clusterInfo.NextVersion.String()
+}
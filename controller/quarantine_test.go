@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+)
+
+func TestQuarantineUntil(t *testing.T) {
+	require.Nil(t, newQuarantinePolicy(0, time.Minute, time.Hour))
+
+	policy := newQuarantinePolicy(3, 10*time.Minute, time.Hour)
+	failed := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		failures uint
+		expected time.Duration
+	}{
+		{failures: 2, expected: 0},
+		{failures: 3, expected: 10 * time.Minute},
+		{failures: 4, expected: 20 * time.Minute},
+		{failures: 5, expected: 40 * time.Minute},
+		{failures: 6, expected: time.Hour},
+		{failures: 100, expected: time.Hour},
+	} {
+		until := policy.until(tc.failures, failed)
+		if tc.expected == 0 {
+			require.True(t, until.IsZero(), "failures: %d", tc.failures)
+			continue
+		}
+		require.Equal(t, failed.Add(tc.expected), until, "failures: %d", tc.failures)
+	}
+}
+
+func TestQuarantineUpdate(t *testing.T) {
+	policy := newQuarantinePolicy(2, 10*time.Minute, time.Hour)
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	clusterInfo := &ClusterInfo{
+		attempt: 1,
+		Cluster: &api.Cluster{Status: &api.ClusterStatus{}},
+	}
+
+	policy.update(clusterInfo, true, now)
+	require.False(t, clusterInfo.Cluster.Status.Degraded)
+
+	clusterInfo.attempt = 2
+	policy.update(clusterInfo, true, now)
+	require.True(t, clusterInfo.Cluster.Status.Degraded)
+	require.Equal(t, "2018-01-01T12:10:00Z", clusterInfo.Cluster.Status.QuarantinedUntil)
+
+	policy.update(clusterInfo, false, now)
+	require.False(t, clusterInfo.Cluster.Status.Degraded)
+	require.Empty(t, clusterInfo.Cluster.Status.QuarantinedUntil)
+}
+
+func TestQuarantinedClusterSkipped(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:                    "aws:123456789012:eu-central-1:kube-1",
+		InfrastructureAccount: "aws:123456789012",
+		LifecycleStatus:       "ready",
+		Channel:               "dev",
+		Status:                &api.ClusterStatus{CurrentVersion: "abc#123"},
+		ConfigItems:           map[string]string{},
+	}
+
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
+	clusterList.quarantine = newQuarantinePolicy(3, time.Hour, time.Hour)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	require.Equal(t, []string{cluster.ID}, allClusterIds(clusterList))
+
+	// the version which failed is retried once the quarantine expires
+	cluster.Status.NextVersion = clusterList.clusters[cluster.ID].NextVersion.String()
+	cluster.Status.Degraded = true
+	cluster.Status.QuarantinedUntil = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	require.Empty(t, allClusterIds(clusterList))
+
+	cluster.Status.QuarantinedUntil = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	require.Equal(t, []string{cluster.ID}, allClusterIds(clusterList))
+
+	// a new version lifts the quarantine
+	cluster.Status.NextVersion = "fedcba#123"
+	cluster.Status.QuarantinedUntil = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	require.Equal(t, []string{cluster.ID}, allClusterIds(clusterList))
+}
@@ -0,0 +1,300 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+const (
+	rolloutPath = "/rollouts"
+
+	rolloutStatusInProgress = "in-progress"
+	rolloutStatusHalted     = "halted"
+	rolloutStatusCompleted  = "completed"
+
+	rolloutResultPending   = "pending"
+	rolloutResultSucceeded = "succeeded"
+	rolloutResultFailed    = "failed"
+)
+
+// Rollout is the state of the rollout of a channel version to the clusters
+// of the channel.
+type Rollout struct {
+	Channel string                `json:"channel"`
+	Version channel.ConfigVersion `json:"version"`
+	Status  string                `json:"status"`
+	Started time.Time             `json:"started"`
+	// Batch is the index of the current batch in the configured batches.
+	Batch int `json:"batch"`
+	// Total is the number of clusters the version is rolled out to.
+	Total int `json:"total"`
+	// Updated is the number of clusters already using the version.
+	Updated    int    `json:"updated"`
+	HaltReason string `json:"halt_reason,omitempty"`
+	// Clusters are the clusters admitted to the rollout by ID, with the
+	// result of updating them.
+	Clusters map[string]*RolloutCluster `json:"clusters"`
+}
+
+// RolloutCluster is a cluster admitted to a rollout.
+type RolloutCluster struct {
+	Batch  int    `json:"batch"`
+	Result string `json:"result"`
+}
+
+// rolloutCoordinator rolls out new channel versions to the clusters of a
+// channel in batches. A batch is a cumulative percentage of the clusters of
+// the channel, e.g. 5, 25 and 100. The next batch is only admitted once all
+// clusters of the current batch were processed and the rollout is halted if
+// more than maxFailureRate percent of them failed.
+type rolloutCoordinator struct {
+	batches        []uint
+	maxFailureRate float64
+	rollouts       map[string]*Rollout
+}
+
+// newRolloutCoordinator initializes a new rolloutCoordinator, or returns nil
+// if no batches are configured so channel versions are rolled out to all
+// clusters at once.
+func newRolloutCoordinator(batches []uint, maxFailureRate float64) *rolloutCoordinator {
+	if len(batches) == 0 {
+		return nil
+	}
+
+	return &rolloutCoordinator{
+		batches:        batches,
+		maxFailureRate: maxFailureRate,
+		rollouts:       make(map[string]*Rollout),
+	}
+}
+
+// rolledOut returns true if updating the cluster to a new channel version
+// is subject to the rollout of its channel. Requested clusters are created
+// with the current version right away and clusters which can't be updated
+// don't take part either.
+func rolledOut(clusterInfo *ClusterInfo) bool {
+	cluster := clusterInfo.Cluster
+	if cluster.LifecycleStatus != statusReady || clusterInfo.NextError != nil {
+		return false
+	}
+	return !updateBlocked(cluster) && !paused(cluster)
+}
+
+// update starts new rollouts for changed channel versions, advances the
+// rollouts whose current batch was processed and admits clusters to the
+// current batches.
+func (c *rolloutCoordinator) update(clusters map[string]*ClusterInfo) {
+	channels := make(map[string][]*ClusterInfo)
+	for _, clusterInfo := range clusters {
+		if rolledOut(clusterInfo) {
+			channels[clusterInfo.Cluster.Channel] = append(channels[clusterInfo.Cluster.Channel], clusterInfo)
+		}
+	}
+
+	for name := range c.rollouts {
+		if _, ok := channels[name]; !ok {
+			delete(c.rollouts, name)
+		}
+	}
+
+	for name, channelClusters := range channels {
+		// admit the clusters in a predictable order
+		sort.Slice(channelClusters, func(i, j int) bool {
+			return channelClusters[i].Cluster.ID < channelClusters[j].Cluster.ID
+		})
+
+		version := channelClusters[0].NextVersion.ConfigVersion
+		rollout, ok := c.rollouts[name]
+		if !ok || rollout.Version != version {
+			rollout = &Rollout{
+				Channel:  name,
+				Version:  version,
+				Status:   rolloutStatusInProgress,
+				Started:  time.Now(),
+				Clusters: make(map[string]*RolloutCluster),
+			}
+			c.rollouts[name] = rollout
+		}
+
+		c.advance(rollout, channelClusters)
+	}
+}
+
+// advance admits the clusters of the current batch of the rollout and moves
+// on to the next batch once the current one is processed.
+func (c *rolloutCoordinator) advance(rollout *Rollout, clusters []*ClusterInfo) {
+	rollout.Total = len(clusters)
+	rollout.Updated = 0
+	for _, clusterInfo := range clusters {
+		if clusterInfo.CurrentVersion.ConfigVersion == rollout.Version {
+			rollout.Updated++
+		}
+	}
+
+	for rollout.Status == rolloutStatusInProgress {
+		limit := int(math.Ceil(float64(c.batches[rollout.Batch]) * float64(rollout.Total) / 100))
+
+		// clusters already using the version count towards the batches
+		included := func(clusterInfo *ClusterInfo) bool {
+			_, ok := rollout.Clusters[clusterInfo.Cluster.ID]
+			return ok || clusterInfo.CurrentVersion.ConfigVersion == rollout.Version
+		}
+
+		admitted := 0
+		for _, clusterInfo := range clusters {
+			if included(clusterInfo) {
+				admitted++
+			}
+		}
+		for _, clusterInfo := range clusters {
+			if admitted >= limit {
+				break
+			}
+			if included(clusterInfo) {
+				continue
+			}
+			rollout.Clusters[clusterInfo.Cluster.ID] = &RolloutCluster{Batch: rollout.Batch, Result: rolloutResultPending}
+			admitted++
+		}
+
+		var processed, failed int
+		for _, cluster := range rollout.Clusters {
+			if cluster.Batch != rollout.Batch {
+				continue
+			}
+			switch cluster.Result {
+			case rolloutResultSucceeded:
+				processed++
+			case rolloutResultFailed:
+				processed++
+				failed++
+			}
+		}
+
+		if rollout.Updated == rollout.Total {
+			rollout.Status = rolloutStatusCompleted
+			return
+		}
+
+		if processed < rollout.batchSize() {
+			return
+		}
+
+		if processed > 0 && float64(failed)*100/float64(processed) > c.maxFailureRate {
+			rollout.Status = rolloutStatusHalted
+			rollout.HaltReason = fmt.Sprintf("%d of %d clusters of batch %d failed", failed, processed, rollout.Batch+1)
+			log.Warnf("Halted the rollout of version %s of channel %s: %s", rollout.Version, rollout.Channel, rollout.HaltReason)
+			return
+		}
+
+		if rollout.Batch == len(c.batches)-1 {
+			return
+		}
+		rollout.Batch++
+	}
+}
+
+// batchSize returns the number of clusters admitted to the current batch.
+func (r *Rollout) batchSize() int {
+	size := 0
+	for _, cluster := range r.Clusters {
+		if cluster.Batch == r.Batch {
+			size++
+		}
+	}
+	return size
+}
+
+// admitted returns true if the cluster may be updated to a new channel
+// version.
+func (c *rolloutCoordinator) admitted(clusterInfo *ClusterInfo) bool {
+	rollout, ok := c.rollouts[clusterInfo.Cluster.Channel]
+	if !ok || !rolledOut(clusterInfo) || rollout.Version != clusterInfo.NextVersion.ConfigVersion {
+		return true
+	}
+
+	if rollout.Status == rolloutStatusCompleted || clusterInfo.CurrentVersion.ConfigVersion == rollout.Version {
+		return true
+	}
+
+	_, ok = rollout.Clusters[clusterInfo.Cluster.ID]
+	return ok
+}
+
+// processed records the result of processing a cluster admitted to the
+// rollout of its channel. The attempt counter of the cluster is reset when
+// processing succeeds.
+func (c *rolloutCoordinator) processed(clusterInfo *ClusterInfo) {
+	if clusterInfo.NextVersion == nil {
+		return
+	}
+
+	rollout, ok := c.rollouts[clusterInfo.Cluster.Channel]
+	if !ok || rollout.Version != clusterInfo.NextVersion.ConfigVersion {
+		return
+	}
+
+	cluster, ok := rollout.Clusters[clusterInfo.Cluster.ID]
+	if !ok {
+		return
+	}
+
+	if clusterInfo.attempt == 0 {
+		cluster.Result = rolloutResultSucceeded
+	} else {
+		cluster.Result = rolloutResultFailed
+	}
+}
+
+// list returns copies of the rollouts sorted by channel.
+func (c *rolloutCoordinator) list() []*Rollout {
+	result := make([]*Rollout, 0, len(c.rollouts))
+	for _, rollout := range c.rollouts {
+		copied := *rollout
+		copied.Clusters = make(map[string]*RolloutCluster, len(rollout.Clusters))
+		for id, cluster := range rollout.Clusters {
+			clusterCopy := *cluster
+			copied.Clusters[id] = &clusterCopy
+		}
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Channel < result[j].Channel
+	})
+	return result
+}
+
+// RolloutHandler returns an HTTP handler serving the state of the rollouts
+// of all channels at /rollouts.
+func (c *Controller) RolloutHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.URL.Path != rolloutPath {
+			http.NotFound(w, r)
+			return
+		}
+
+		rollouts := c.clusterList.Rollouts()
+		if rollouts == nil {
+			http.Error(w, "batched rollouts are not enabled", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(rollouts)
+		if err != nil {
+			c.logger.Errorf("Failed to write the rollouts: %v", err)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+)
+
+func rolloutClusters(count int) map[string]*ClusterInfo {
+	clusters := make(map[string]*ClusterInfo)
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("aws:123456789012:eu-central-1:kube-%02d", i)
+		clusters[id] = &ClusterInfo{
+			Cluster: &api.Cluster{
+				ID:              id,
+				LifecycleStatus: "ready",
+				Channel:         "dev",
+				ConfigItems:     map[string]string{},
+			},
+			CurrentVersion: api.ParseVersion("old#abc"),
+			NextVersion:    api.ParseVersion("new#abc"),
+		}
+	}
+	return clusters
+}
+
+func admittedClusters(coordinator *rolloutCoordinator, clusters map[string]*ClusterInfo) int {
+	count := 0
+	for _, clusterInfo := range clusters {
+		if coordinator.admitted(clusterInfo) {
+			count++
+		}
+	}
+	return count
+}
+
+// finishBatch processes the admitted clusters which weren't processed yet,
+// failing the given number of them.
+func finishBatch(coordinator *rolloutCoordinator, clusters map[string]*ClusterInfo, failures int) {
+	for _, id := range sortedIDs(clusters) {
+		clusterInfo := clusters[id]
+		if !coordinator.admitted(clusterInfo) || clusterInfo.CurrentVersion.ConfigVersion == "new" || clusterInfo.attempt > 0 {
+			continue
+		}
+
+		if failures > 0 {
+			clusterInfo.attempt = 1
+			failures--
+		} else {
+			clusterInfo.CurrentVersion = clusterInfo.NextVersion
+		}
+		coordinator.processed(clusterInfo)
+	}
+}
+
+func sortedIDs(clusters map[string]*ClusterInfo) []string {
+	var ids []string
+	for id := range clusters {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestRolloutBatches(t *testing.T) {
+	coordinator := newRolloutCoordinator([]uint{10, 50, 100}, 20)
+	clusters := rolloutClusters(10)
+
+	coordinator.update(clusters)
+	require.Equal(t, 1, admittedClusters(coordinator, clusters))
+
+	// the batch isn't complete until the admitted clusters are processed
+	coordinator.update(clusters)
+	require.Equal(t, 1, admittedClusters(coordinator, clusters))
+
+	finishBatch(coordinator, clusters, 0)
+	coordinator.update(clusters)
+	require.Equal(t, 5, admittedClusters(coordinator, clusters))
+	require.Equal(t, 1, coordinator.rollouts["dev"].Batch)
+
+	finishBatch(coordinator, clusters, 0)
+	coordinator.update(clusters)
+	require.Equal(t, 10, admittedClusters(coordinator, clusters))
+
+	finishBatch(coordinator, clusters, 0)
+	coordinator.update(clusters)
+	require.Equal(t, rolloutStatusCompleted, coordinator.rollouts["dev"].Status)
+	require.Equal(t, 10, coordinator.rollouts["dev"].Updated)
+}
+
+func TestRolloutHalted(t *testing.T) {
+	coordinator := newRolloutCoordinator([]uint{10, 50, 100}, 20)
+	clusters := rolloutClusters(10)
+
+	coordinator.update(clusters)
+	finishBatch(coordinator, clusters, 0)
+	coordinator.update(clusters)
+	require.Equal(t, 5, admittedClusters(coordinator, clusters))
+
+	// 2 of the 4 clusters of the second batch fail
+	finishBatch(coordinator, clusters, 2)
+	coordinator.update(clusters)
+	rollout := coordinator.rollouts["dev"]
+	require.Equal(t, rolloutStatusHalted, rollout.Status)
+	require.NotEmpty(t, rollout.HaltReason)
+	require.Equal(t, 5, admittedClusters(coordinator, clusters))
+
+	// a new version starts a new rollout
+	for _, clusterInfo := range clusters {
+		clusterInfo.NextVersion = api.ParseVersion("fixed#abc")
+		clusterInfo.attempt = 0
+	}
+	coordinator.update(clusters)
+	require.Equal(t, rolloutStatusInProgress, coordinator.rollouts["dev"].Status)
+	require.Equal(t, 1, admittedClusters(coordinator, clusters))
+}
+
+func TestRolloutSkipsUpdatedClusters(t *testing.T) {
+	coordinator := newRolloutCoordinator([]uint{10, 50, 100}, 20)
+	clusters := rolloutClusters(10)
+
+	// clusters updated before, e.g. before a restart, count towards the
+	// batches
+	for _, id := range sortedIDs(clusters)[:6] {
+		clusters[id].CurrentVersion = clusters[id].NextVersion
+	}
+
+	coordinator.update(clusters)
+	require.Equal(t, 2, coordinator.rollouts["dev"].Batch)
+	require.Equal(t, 10, admittedClusters(coordinator, clusters))
+}
+
+func TestRolloutIgnoresRequestedClusters(t *testing.T) {
+	coordinator := newRolloutCoordinator([]uint{10, 100}, 20)
+	clusters := rolloutClusters(10)
+	for _, clusterInfo := range clusters {
+		clusterInfo.Cluster.LifecycleStatus = "requested"
+	}
+
+	coordinator.update(clusters)
+	require.Equal(t, 10, admittedClusters(coordinator, clusters))
+}
+
+func TestClusterListRollout(t *testing.T) {
+	var clusters []*api.Cluster
+	for i := 0; i < 4; i++ {
+		clusters = append(clusters, &api.Cluster{
+			ID:                    fmt.Sprintf("aws:123456789012:eu-central-1:kube-%d", i),
+			InfrastructureAccount: "aws:123456789012",
+			LifecycleStatus:       "ready",
+			Channel:               "dev",
+			Status:                mockStatus,
+		})
+	}
+
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
+	clusterList.rollouts = newRolloutCoordinator([]uint{25, 100}, 20)
+	clusterList.UpdateAvailable(defaultChannels, clusters)
+	require.Equal(t, []string{clusters[0].ID}, allClusterIds(clusterList))
+
+	rollouts := clusterList.Rollouts()
+	require.Len(t, rollouts, 1)
+	require.Equal(t, devRevision, rollouts[0].Version)
+	require.Equal(t, rolloutResultSucceeded, rollouts[0].Clusters[clusters[0].ID].Result)
+}
+
+func TestRolloutHandler(t *testing.T) {
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
+	controller := &Controller{clusterList: clusterList}
+
+	recorder := httptest.NewRecorder()
+	controller.RolloutHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/rollouts", nil))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	clusterList.rollouts = newRolloutCoordinator([]uint{100}, 20)
+	recorder = httptest.NewRecorder()
+	controller.RolloutHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/rollouts", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "[]\n", recorder.Body.String())
+}
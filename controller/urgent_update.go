@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
+)
+
+// minUrgentVersionLength is the minimum length of abbreviated channel
+// versions, e.g. git commits, in the urgent_update config item.
+const minUrgentVersionLength = 7
+
+// urgentUpdate returns true if the update of the cluster to its next channel
+// version is marked as urgent with the urgent_update config item. Urgent
+// updates bypass the environment order, batched rollouts, maintenance windows
+// and the soak period of images. Config item changes of a cluster already
+// using the version aren't urgent.
+func urgentUpdate(clusterInfo *ClusterInfo) bool {
+	if clusterInfo.NextVersion == nil || clusterInfo.CurrentVersion == nil {
+		return false
+	}
+	if clusterInfo.NextVersion.ConfigVersion == clusterInfo.CurrentVersion.ConfigVersion {
+		return false
+	}
+	return urgentVersion(clusterInfo.Cluster, clusterInfo.NextVersion)
+}
+
+// urgentVersion returns true if the urgent_update config item of the cluster
+// is the channel version or an abbreviation of it.
+func urgentVersion(cluster *api.Cluster, version *api.ClusterVersion) bool {
+	urgent := cluster.ConfigItems[provisioner.ConfigKeyUrgentUpdate]
+	if len(urgent) < minUrgentVersionLength {
+		return urgent != "" && urgent == string(version.ConfigVersion)
+	}
+	return strings.HasPrefix(string(version.ConfigVersion), urgent)
+}
+
+// validateUrgentUpdate returns an error if an urgent update of the cluster to
+// the version doesn't record who triggered it and why.
+func validateUrgentUpdate(cluster *api.Cluster, version *api.ClusterVersion) error {
+	if !urgentVersion(cluster, version) {
+		return nil
+	}
+
+	for _, key := range []string{provisioner.ConfigKeyUrgentUpdateReason, provisioner.ConfigKeyUrgentUpdateBy} {
+		if strings.TrimSpace(cluster.ConfigItems[key]) == "" {
+			return fmt.Errorf("%s requires %s", provisioner.ConfigKeyUrgentUpdate, key)
+		}
+	}
+	return nil
+}
+
+// clearUrgentUpdate removes the urgent update config items of a cluster which
+// isn't updated urgently, so they don't affect the provisioner.
+func clearUrgentUpdate(cluster *api.Cluster) {
+	delete(cluster.ConfigItems, provisioner.ConfigKeyUrgentUpdate)
+	delete(cluster.ConfigItems, provisioner.ConfigKeyUrgentUpdateReason)
+	delete(cluster.ConfigItems, provisioner.ConfigKeyUrgentUpdateBy)
+}
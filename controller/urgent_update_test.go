@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
+)
+
+func TestUrgentVersion(t *testing.T) {
+	version := &api.ClusterVersion{ConfigVersion: channel.ConfigVersion("0123456789abcdef")}
+
+	for _, tc := range []struct {
+		urgent   string
+		expected bool
+	}{
+		{urgent: "", expected: false},
+		{urgent: "0123456789abcdef", expected: true},
+		{urgent: "0123456", expected: true},
+		{urgent: "012345", expected: false},
+		{urgent: "1234567", expected: false},
+	} {
+		cluster := &api.Cluster{ConfigItems: map[string]string{provisioner.ConfigKeyUrgentUpdate: tc.urgent}}
+		require.Equal(t, tc.expected, urgentVersion(cluster, version), tc.urgent)
+	}
+}
+
+func TestValidateUrgentUpdate(t *testing.T) {
+	version := &api.ClusterVersion{ConfigVersion: channel.ConfigVersion("0123456789abcdef")}
+	cluster := &api.Cluster{ConfigItems: map[string]string{provisioner.ConfigKeyUrgentUpdate: "0123456"}}
+	require.Error(t, validateUrgentUpdate(cluster, version))
+
+	cluster.ConfigItems[provisioner.ConfigKeyUrgentUpdateReason] = "CVE-2019-0001"
+	require.Error(t, validateUrgentUpdate(cluster, version))
+
+	cluster.ConfigItems[provisioner.ConfigKeyUrgentUpdateBy] = "jdoe"
+	require.NoError(t, validateUrgentUpdate(cluster, version))
+
+	// items referring to another version are ignored
+	cluster.ConfigItems = map[string]string{provisioner.ConfigKeyUrgentUpdate: "fedcba9"}
+	require.NoError(t, validateUrgentUpdate(cluster, version))
+}
+
+func TestUrgentUpdatePriority(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:                    "aws:123456789012:eu-central-1:kube-1",
+		InfrastructureAccount: "aws:123456789012",
+		LifecycleStatus:       "ready",
+		Channel:               "dev",
+		Status:                mockStatus,
+		ConfigItems: map[string]string{
+			maintenanceWindowConfigItem:             inactiveMaintenanceWindow(),
+			provisioner.ConfigKeyUrgentUpdate:       string(devRevision),
+			provisioner.ConfigKeyUrgentUpdateReason: "CVE-2019-0001",
+			provisioner.ConfigKeyUrgentUpdateBy:     "jdoe",
+		},
+	}
+
+	clusterList := NewClusterList(config.DefaultFilter, []string{}, 0)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	require.Equal(t, []string{cluster.ID}, allClusterIds(clusterList))
+	require.EqualValues(t, updatePriorityUrgent, clusterList.clusters[cluster.ID].updatePriority)
+
+	// blocked clusters aren't updated even if the update is urgent
+	cluster.ConfigItems[updateBlockedConfigItem] = "true"
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	require.Empty(t, allClusterIds(clusterList))
+
+	// the reason is required
+	delete(cluster.ConfigItems, updateBlockedConfigItem)
+	delete(cluster.ConfigItems, provisioner.ConfigKeyUrgentUpdateReason)
+	clusterList.UpdateAvailable(defaultChannels, []*api.Cluster{cluster})
+	require.Error(t, clusterList.clusters[cluster.ID].NextError)
+}
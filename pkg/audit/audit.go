@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// KindAWS is the kind of entries describing AWS API mutations.
+	KindAWS = "aws"
+	// KindKubernetes is the kind of entries describing changes applied to
+	// the Kubernetes API.
+	KindKubernetes = "kubernetes"
+	// KindOpenStack is the kind of entries describing OpenStack API
+	// mutations.
+	KindOpenStack = "openstack"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+// Entry describes a single change applied during a provisioning run.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Action   string    `json:"action"`
+	Resource string    `json:"resource"`
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Log is a record of all the changes applied to a cluster during a single
+// provisioning run. A nil Log can be used safely and records nothing.
+type Log struct {
+	mutex     sync.Mutex
+	ClusterID string    `json:"cluster_id"`
+	Operation string    `json:"operation"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Entries   []*Entry  `json:"entries"`
+}
+
+// NewLog initializes a new audit Log for an operation on the cluster.
+func NewLog(clusterID, operation string) *Log {
+	return &Log{
+		ClusterID: clusterID,
+		Operation: operation,
+		Started:   time.Now().UTC(),
+		Entries:   make([]*Entry, 0),
+	}
+}
+
+// Record adds an entry for an action on a resource to the log. The result of
+// the action is derived from err.
+func (l *Log) Record(kind, action, resource string, err error) {
+	if l == nil {
+		return
+	}
+
+	entry := &Entry{
+		Time:     time.Now().UTC(),
+		Kind:     kind,
+		Action:   action,
+		Resource: resource,
+		Result:   resultSuccess,
+	}
+
+	if err != nil {
+		entry.Result = resultFailure
+		entry.Error = err.Error()
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.Entries = append(l.Entries, entry)
+}
+
+// Finish marks the log as finished.
+func (l *Log) Finish() {
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.Finished = time.Now().UTC()
+}
+
+// MarshalJSON returns the JSON representation of the log.
+func (l *Log) MarshalJSON() ([]byte, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	type plainLog Log
+	return json.Marshal(&struct {
+		*plainLog
+	}{
+		plainLog: (*plainLog)(l),
+	})
+}
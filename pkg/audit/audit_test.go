@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	log := NewLog("aws:123456789012:eu-central-1:kube-1", "provision")
+	log.Record(KindAWS, "create-stack", "kube-1", nil)
+	log.Record(KindKubernetes, "apply", "deployment/kube-system/foo", errors.New("failed"))
+	log.Finish()
+
+	require.Len(t, log.Entries, 2)
+	require.Equal(t, resultSuccess, log.Entries[0].Result)
+	require.Equal(t, resultFailure, log.Entries[1].Result)
+	require.Equal(t, "failed", log.Entries[1].Error)
+	require.False(t, log.Finished.IsZero())
+
+	// a nil log is a no-op
+	var disabled *Log
+	disabled.Record(KindAWS, "delete-stack", "kube-1", nil)
+	disabled.Finish()
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewStore(dir, nil)
+	require.NoError(t, err)
+
+	log := NewLog("aws:123456789012:eu-central-1:kube-1", "provision")
+	log.Record(KindAWS, "create-stack", "kube-1", nil)
+
+	location, err := store.Store(log)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(location, "file://"+dir))
+
+	data, err := ioutil.ReadFile(strings.TrimPrefix(location, "file://"))
+	require.NoError(t, err)
+
+	var stored Log
+	require.NoError(t, json.Unmarshal(data, &stored))
+	require.Equal(t, log.ClusterID, stored.ClusterID)
+	require.Len(t, stored.Entries, 1)
+}
+
+func TestNewStoreUnknownScheme(t *testing.T) {
+	_, err := NewStore("ftp://example.org/audit", nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Store defines an interface for persisting audit logs.
+type Store interface {
+	// Store persists the log and returns a reference to the stored log.
+	Store(log *Log) (string, error)
+}
+
+// NewStore initializes a new Store based on the location. The location can
+// either be an S3 URL (s3://bucket/prefix) or a path to a local directory. The
+// session is used for uploading logs to S3.
+func NewStore(location string, sess *session.Session) (Store, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "s3":
+		return &s3Store{
+			uploader: s3manager.NewUploader(sess),
+			bucket:   u.Host,
+			prefix:   strings.TrimPrefix(u.Path, "/"),
+		}, nil
+	case "file", "":
+		return &fileStore{dir: u.Host + u.Path}, nil
+	default:
+		return nil, fmt.Errorf("unknown audit log location type: %s", u.Scheme)
+	}
+}
+
+// logName returns a unique name for the log.
+func logName(log *Log) string {
+	return fmt.Sprintf("%s/%s-%s.json", strings.Replace(log.ClusterID, ":", "-", -1), log.Started.Format("20060102T150405Z"), log.Operation)
+}
+
+// fileStore stores audit logs in a local directory.
+type fileStore struct {
+	dir string
+}
+
+func (s *fileStore) Store(log *Log) (string, error) {
+	data, err := json.Marshal(log)
+	if err != nil {
+		return "", err
+	}
+
+	file := path.Join(s.dir, logName(log))
+	err = os.MkdirAll(path.Dir(file), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	err = ioutil.WriteFile(file, data, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return "file://" + file, nil
+}
+
+// s3UploaderAPI is a minimal interface containing only the methods we use
+// from the S3 uploader.
+type s3UploaderAPI interface {
+	Upload(input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error)
+}
+
+// s3Store stores audit logs in an S3 bucket.
+type s3Store struct {
+	uploader s3UploaderAPI
+	bucket   string
+	prefix   string
+}
+
+func (s *s3Store) Store(log *Log) (string, error) {
+	data, err := json.Marshal(log)
+	if err != nil {
+		return "", err
+	}
+
+	key := path.Join(s.prefix, logName(log))
+	_, err = s.uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
+}
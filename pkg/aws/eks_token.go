@@ -0,0 +1,80 @@
+package aws
+
+import (
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"golang.org/x/oauth2"
+)
+
+const (
+	eksTokenPrefix     = "k8s-aws-v1."
+	eksClusterIDHeader = "x-k8s-aws-id"
+	// presigned URLs are valid for 15 minutes, independent of the
+	// requested expiry.
+	eksTokenValidity = 15 * time.Minute
+	// refresh tokens before they expire to account for clock skew.
+	eksTokenRefreshMargin = time.Minute
+)
+
+// EKSTokenSource is an oauth2.TokenSource returning tokens accepted by the
+// AWS IAM authenticator of EKS clusters. The tokens are presigned STS
+// GetCallerIdentity requests identifying the IAM role of the session.
+type EKSTokenSource struct {
+	clusterName string
+	sts         *sts.STS
+	mutex       sync.Mutex
+	token       *oauth2.Token
+	now         func() time.Time
+}
+
+// NewEKSTokenSource initializes a new EKSTokenSource for the EKS cluster.
+func NewEKSTokenSource(sess *session.Session, clusterName string) *EKSTokenSource {
+	return &EKSTokenSource{
+		clusterName: clusterName,
+		sts:         sts.New(sess),
+		now:         time.Now,
+	}
+}
+
+// Token returns a valid token, generating a new one if the current one is
+// about to expire.
+func (s *EKSTokenSource) Token() (*oauth2.Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	if s.token != nil && now.Add(eksTokenRefreshMargin).Before(s.token.Expiry) {
+		return s.token, nil
+	}
+
+	req, _ := s.sts.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	token, err := presignEKSToken(req, s.clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.token = &oauth2.Token{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		Expiry:      now.Add(eksTokenValidity),
+	}
+	return s.token, nil
+}
+
+// presignEKSToken presigns the GetCallerIdentity request for the cluster
+// and encodes it as an IAM authenticator token.
+func presignEKSToken(req *request.Request, clusterName string) (string, error) {
+	req.HTTPRequest.Header.Add(eksClusterIDHeader, clusterName)
+
+	url, err := req.Presign(eksTokenValidity)
+	if err != nil {
+		return "", err
+	}
+
+	return eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(url)), nil
+}
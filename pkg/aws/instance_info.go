@@ -18,7 +18,14 @@ type Instance struct {
 	InstanceType string
 	VCPU         int64
 	Memory       int64
-	Pricing      map[string]string
+	GPU          int64
+	GPUModel     string
+	// InstanceStorageDevices is the number of instance store volumes of
+	// InstanceStorageSize GiB each.
+	InstanceStorageDevices int64
+	InstanceStorageSize    int64
+	InstanceStorageNVMe    bool
+	Pricing                map[string]string
 }
 
 type pricing struct {
@@ -29,10 +36,19 @@ type osPricing struct {
 	Linux pricing `json:"linux"`
 }
 
+type storage struct {
+	Devices int64 `json:"devices"`
+	Size    int64 `json:"size"`
+	NVMe    bool  `json:"nvme_ssd"`
+}
+
 type instanceInfo struct {
 	InstanceType string               `json:"instance_type"`
 	VCPU         interface{}          `json:"vCPU"`
 	Memory       float64              `json:"memory"`
+	GPU          int64                `json:"GPU"`
+	GPUModel     string               `json:"GPU_model"`
+	Storage      *storage             `json:"storage"`
 	Pricing      map[string]osPricing `json:"pricing"`
 }
 
@@ -86,12 +102,20 @@ func loadInstanceInfo() map[string]Instance {
 			pricing[az] = azPricing.Linux.OnDemand
 		}
 
-		result[instance.InstanceType] = Instance{
+		info := Instance{
 			InstanceType: instance.InstanceType,
 			VCPU:         vCPU,
 			Memory:       int64(instance.Memory * gigabyte),
+			GPU:          instance.GPU,
+			GPUModel:     instance.GPUModel,
 			Pricing:      pricing,
 		}
+		if instance.Storage != nil {
+			info.InstanceStorageDevices = instance.Storage.Devices
+			info.InstanceStorageSize = instance.Storage.Size
+			info.InstanceStorageNVMe = instance.Storage.NVMe
+		}
+		result[instance.InstanceType] = info
 	}
 
 	return result
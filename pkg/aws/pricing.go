@@ -0,0 +1,174 @@
+package aws
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awspricing "github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/aws/aws-sdk-go/service/pricing/pricingiface"
+)
+
+const (
+	// PricingRegion is the region serving the AWS Pricing API.
+	PricingRegion = "us-east-1"
+
+	pricingServiceCodeEC2 = "AmazonEC2"
+	pricingCurrency       = "USD"
+)
+
+// pricingLocations maps the region names to the location names used by the
+// AWS Pricing API.
+var pricingLocations = map[string]string{
+	"ap-northeast-1": "Asia Pacific (Tokyo)",
+	"ap-northeast-2": "Asia Pacific (Seoul)",
+	"ap-south-1":     "Asia Pacific (Mumbai)",
+	"ap-southeast-1": "Asia Pacific (Singapore)",
+	"ap-southeast-2": "Asia Pacific (Sydney)",
+	"ca-central-1":   "Canada (Central)",
+	"eu-central-1":   "EU (Frankfurt)",
+	"eu-west-1":      "EU (Ireland)",
+	"eu-west-2":      "EU (London)",
+	"eu-west-3":      "EU (Paris)",
+	"sa-east-1":      "South America (Sao Paulo)",
+	"us-east-1":      "US East (N. Virginia)",
+	"us-east-2":      "US East (Ohio)",
+	"us-west-1":      "US West (N. California)",
+	"us-west-2":      "US West (Oregon)",
+}
+
+type cachedPrice struct {
+	price   float64
+	expires time.Time
+}
+
+// PriceCache looks up the hourly on-demand price of EC2 instances using the
+// AWS Pricing API. The prices are cached for the configured TTL since they
+// rarely change and the Pricing API is rate limited. If the Pricing API can't
+// be queried the price from the bundled instance data is used instead, without
+// caching it.
+type PriceCache struct {
+	ttl    time.Duration
+	mutex  sync.Mutex
+	prices map[string]cachedPrice
+}
+
+// NewPriceCache returns a new PriceCache caching prices for the ttl.
+func NewPriceCache(ttl time.Duration) *PriceCache {
+	return &PriceCache{
+		ttl:    ttl,
+		prices: make(map[string]cachedPrice),
+	}
+}
+
+// InstancePrice returns the hourly on-demand price in USD of a Linux instance
+// of the instance type in the region.
+func (c *PriceCache) InstancePrice(client pricingiface.PricingAPI, region, instanceType string) (float64, error) {
+	key := region + "/" + instanceType
+
+	c.mutex.Lock()
+	cached, ok := c.prices[key]
+	c.mutex.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.price, nil
+	}
+
+	price, err := queryInstancePrice(client, region, instanceType)
+	if err != nil {
+		// the bundled price isn't cached, so the Pricing API is queried
+		// again once it recovers from a transient error.
+		price, fallbackErr := bundledInstancePrice(region, instanceType)
+		if fallbackErr != nil {
+			return 0, fmt.Errorf("failed to get price of %s in %s: %v", instanceType, region, err)
+		}
+		return price, nil
+	}
+
+	c.mutex.Lock()
+	c.prices[key] = cachedPrice{price: price, expires: time.Now().Add(c.ttl)}
+	c.mutex.Unlock()
+
+	return price, nil
+}
+
+// queryInstancePrice queries the Pricing API for the hourly on-demand price
+// of a shared tenancy Linux instance.
+func queryInstancePrice(client pricingiface.PricingAPI, region, instanceType string) (float64, error) {
+	location, ok := pricingLocations[region]
+	if !ok {
+		return 0, fmt.Errorf("unknown pricing location for region %s", region)
+	}
+
+	filter := func(field, value string) *awspricing.Filter {
+		return &awspricing.Filter{
+			Type:  aws.String(awspricing.FilterTypeTermMatch),
+			Field: aws.String(field),
+			Value: aws.String(value),
+		}
+	}
+
+	output, err := client.GetProducts(&awspricing.GetProductsInput{
+		ServiceCode: aws.String(pricingServiceCodeEC2),
+		Filters: []*awspricing.Filter{
+			filter("instanceType", instanceType),
+			filter("location", location),
+			filter("operatingSystem", "Linux"),
+			filter("tenancy", "Shared"),
+			filter("preInstalledSw", "NA"),
+			filter("capacitystatus", "Used"),
+		},
+		MaxResults: aws.Int64(1),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(output.PriceList) == 0 {
+		return 0, fmt.Errorf("no price found for %s in %s", instanceType, region)
+	}
+
+	return onDemandPrice(output.PriceList[0])
+}
+
+// onDemandPrice extracts the hourly on-demand price from a price list item
+// returned by the Pricing API. The relevant part of the item looks like:
+//
+//	{"terms": {"OnDemand": {"<offer>": {"priceDimensions": {"<rate>": {"pricePerUnit": {"USD": "0.1000000000"}}}}}}}
+func onDemandPrice(item aws.JSONValue) (float64, error) {
+	terms, _ := item["terms"].(map[string]interface{})
+	onDemand, _ := terms["OnDemand"].(map[string]interface{})
+
+	for _, offer := range onDemand {
+		offer, _ := offer.(map[string]interface{})
+		dimensions, _ := offer["priceDimensions"].(map[string]interface{})
+
+		for _, dimension := range dimensions {
+			dimension, _ := dimension.(map[string]interface{})
+			pricePerUnit, _ := dimension["pricePerUnit"].(map[string]interface{})
+
+			if price, ok := pricePerUnit[pricingCurrency].(string); ok {
+				return strconv.ParseFloat(price, 64)
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("no on-demand price found in price list")
+}
+
+// bundledInstancePrice returns the hourly on-demand price from the bundled
+// instance data.
+func bundledInstancePrice(region, instanceType string) (float64, error) {
+	instanceInfo, err := InstanceInfo(instanceType)
+	if err != nil {
+		return 0, err
+	}
+
+	price, ok := instanceInfo.Pricing[region]
+	if !ok {
+		return 0, fmt.Errorf("no price for %s in %s", instanceType, region)
+	}
+
+	return strconv.ParseFloat(price, 64)
+}
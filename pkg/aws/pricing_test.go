@@ -0,0 +1,73 @@
+package aws
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awspricing "github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/aws/aws-sdk-go/service/pricing/pricingiface"
+	"github.com/stretchr/testify/require"
+)
+
+type pricingAPIStub struct {
+	pricingiface.PricingAPI
+	price string
+	err   error
+	calls int
+}
+
+func (p *pricingAPIStub) GetProducts(input *awspricing.GetProductsInput) (*awspricing.GetProductsOutput, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &awspricing.GetProductsOutput{PriceList: []aws.JSONValue{
+		{"terms": map[string]interface{}{"OnDemand": map[string]interface{}{"offer": map[string]interface{}{
+			"priceDimensions": map[string]interface{}{"rate": map[string]interface{}{
+				"pricePerUnit": map[string]interface{}{"USD": p.price},
+			}},
+		}}}},
+	}}, nil
+}
+
+func TestInstancePrice(t *testing.T) {
+	cache := NewPriceCache(time.Hour)
+	client := &pricingAPIStub{price: "0.5000000000"}
+
+	price, err := cache.InstancePrice(client, "eu-central-1", "m5.large")
+	require.NoError(t, err)
+	require.Equal(t, 0.5, price)
+
+	// the price is cached
+	client.price = "0.6000000000"
+	price, err = cache.InstancePrice(client, "eu-central-1", "m5.large")
+	require.NoError(t, err)
+	require.Equal(t, 0.5, price)
+	require.Equal(t, 1, client.calls)
+}
+
+func TestInstancePriceFallback(t *testing.T) {
+	bundled, err := bundledInstancePrice("eu-central-1", "m5.large")
+	require.NoError(t, err)
+
+	cache := NewPriceCache(time.Hour)
+	client := &pricingAPIStub{price: "0.5000000000", err: errors.New("throttled")}
+
+	price, err := cache.InstancePrice(client, "eu-central-1", "m5.large")
+	require.NoError(t, err)
+	require.Equal(t, bundled, price)
+
+	// the bundled price isn't cached, the Pricing API is queried again
+	client.err = nil
+	price, err = cache.InstancePrice(client, "eu-central-1", "m5.large")
+	require.NoError(t, err)
+	require.Equal(t, 0.5, price)
+	require.Equal(t, 2, client.calls)
+
+	// the price is unknown if neither is available
+	client.err = errors.New("throttled")
+	_, err = cache.InstancePrice(client, "eu-central-1", "unknown.large")
+	require.Error(t, err)
+}
@@ -0,0 +1,191 @@
+package aws
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/metrics"
+)
+
+const (
+	rateLimitHandlerName = "clm.RateLimit"
+	throttleHandlerName  = "clm.Throttle"
+	minThrottleBackoff   = time.Second
+	maxThrottleBackoff   = time.Minute
+)
+
+var (
+	// metrics per API (service.Operation), exposed at /debug/vars.
+	apiRequests       = metrics.NewMap("aws_api_requests")
+	apiThrottled      = metrics.NewMap("aws_api_throttled")
+	apiRateLimitDelay = metrics.NewMap("aws_api_rate_limit_delay_seconds")
+)
+
+// RateLimiter limits the rate of the AWS API calls per account and region,
+// shared by all the sessions it's attached to. If AWS throttles a call, all
+// the calls to the same account and region are delayed with an exponential
+// backoff, so that parallel updates don't exhaust the API limits of the
+// account.
+type RateLimiter struct {
+	rate       float64
+	burst      float64
+	maxBackoff time.Duration
+	mutex      sync.Mutex
+	limiters   map[string]*accountLimiter
+	now        func() time.Time
+	sleep      func(ctx aws.Context, duration time.Duration) error
+}
+
+// accountLimiter is a token bucket for a single account and region.
+type accountLimiter struct {
+	tokens         float64
+	updated        time.Time
+	backoff        time.Duration
+	throttledUntil time.Time
+}
+
+// NewRateLimiter initializes a new RateLimiter allowing rate calls per second
+// with bursts of up to burst calls per account and region. nil is returned if
+// rate is 0, disabling rate limiting.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		rate:       rate,
+		burst:      float64(burst),
+		maxBackoff: maxThrottleBackoff,
+		limiters:   make(map[string]*accountLimiter),
+		now:        time.Now,
+		sleep:      aws.SleepWithContext,
+	}
+}
+
+// Attach rate limits the calls made with sess, and any copy of it, to the
+// account. It's a no-op if the rate limiter is nil.
+func (l *RateLimiter) Attach(sess *session.Session, account string) {
+	if l == nil {
+		return
+	}
+
+	// requests are delayed before signing them, so that the signature
+	// doesn't expire while waiting. Errors set while signing abort the
+	// request.
+	sess.Handlers.Sign.PushFrontNamed(request.NamedHandler{
+		Name: rateLimitHandlerName,
+		Fn: func(r *request.Request) {
+			l.wait(r, limiterKey(account, r))
+		},
+	})
+	sess.Handlers.Retry.PushFrontNamed(request.NamedHandler{
+		Name: throttleHandlerName,
+		Fn: func(r *request.Request) {
+			if request.IsErrorThrottle(r.Error) {
+				l.throttled(r, limiterKey(account, r))
+			}
+		},
+	})
+}
+
+// limiterKey returns the key of the limiter for the account and the region
+// of the request.
+func limiterKey(account string, r *request.Request) string {
+	return account + "/" + aws.StringValue(r.Config.Region)
+}
+
+// apiName returns the name of the API called by the request, e.g.
+// ec2.DescribeInstances.
+func apiName(r *request.Request) string {
+	return r.ClientInfo.ServiceName + "." + r.Operation.Name
+}
+
+// wait delays the request until it's allowed by the rate limit of the
+// account. The request fails if its context is canceled while waiting.
+func (l *RateLimiter) wait(r *request.Request, key string) {
+	delay := l.reserve(key)
+
+	apiRequests.Add(apiName(r), 1)
+	if delay <= 0 {
+		return
+	}
+	apiRateLimitDelay.AddFloat(apiName(r), delay.Seconds())
+
+	err := l.sleep(r.Context(), delay)
+	if err != nil {
+		r.Error = err
+	}
+}
+
+// reserve takes a token from the bucket of the account and returns how long
+// the caller has to wait before using it.
+func (l *RateLimiter) reserve(key string) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	limiter := l.limiter(key, now)
+
+	limiter.tokens += now.Sub(limiter.updated).Seconds() * l.rate
+	if limiter.tokens > l.burst {
+		limiter.tokens = l.burst
+	}
+	limiter.updated = now
+	limiter.tokens--
+
+	var delay time.Duration
+	if limiter.tokens < 0 {
+		delay = time.Duration(-limiter.tokens / l.rate * float64(time.Second))
+	}
+
+	if throttled := limiter.throttledUntil.Sub(now); throttled > delay {
+		delay = throttled
+	}
+
+	return delay
+}
+
+// limiter returns the limiter for the key, starting with a full bucket.
+func (l *RateLimiter) limiter(key string, now time.Time) *accountLimiter {
+	limiter, ok := l.limiters[key]
+	if !ok {
+		limiter = &accountLimiter{tokens: l.burst, updated: now}
+		l.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// throttled records that AWS throttled a request and pauses all the requests
+// to the account. The pause doubles if requests are throttled again right
+// after a pause, up to the maximum backoff.
+func (l *RateLimiter) throttled(r *request.Request, key string) {
+	apiThrottled.Add(apiName(r), 1)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	limiter := l.limiter(key, now)
+
+	switch {
+	case now.Before(limiter.throttledUntil):
+		// the request was sent before the current pause
+		return
+	case limiter.backoff > 0 && now.Before(limiter.throttledUntil.Add(limiter.backoff)):
+		limiter.backoff *= 2
+		if limiter.backoff > l.maxBackoff {
+			limiter.backoff = l.maxBackoff
+		}
+	default:
+		limiter.backoff = minThrottleBackoff
+	}
+
+	limiter.throttledUntil = now.Add(limiter.backoff)
+}
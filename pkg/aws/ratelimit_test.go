@@ -0,0 +1,81 @@
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRateLimiter(rate float64, burst int) (*RateLimiter, *time.Time) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(rate, burst)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestNewRateLimiterDisabled(t *testing.T) {
+	limiter := NewRateLimiter(0, 10)
+	require.Nil(t, limiter)
+
+	// attaching a disabled rate limiter is a no-op
+	limiter.Attach(nil, "123456789012")
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	limiter, now := newTestRateLimiter(2, 3)
+
+	// the burst is allowed right away
+	for i := 0; i < 3; i++ {
+		require.Equal(t, time.Duration(0), limiter.reserve("a/eu-central-1"))
+	}
+	require.Equal(t, 500*time.Millisecond, limiter.reserve("a/eu-central-1"))
+	require.Equal(t, time.Second, limiter.reserve("a/eu-central-1"))
+
+	// accounts and regions are limited independently
+	require.Equal(t, time.Duration(0), limiter.reserve("a/eu-west-1"))
+	require.Equal(t, time.Duration(0), limiter.reserve("b/eu-central-1"))
+
+	// tokens are refilled over time
+	*now = now.Add(2 * time.Second)
+	require.Equal(t, time.Duration(0), limiter.reserve("a/eu-central-1"))
+}
+
+func TestRateLimiterThrottled(t *testing.T) {
+	limiter, now := newTestRateLimiter(100, 100)
+	key := "a/eu-central-1"
+	req := &request.Request{
+		ClientInfo: metadata.ClientInfo{ServiceName: "ec2"},
+		Operation:  &request.Operation{Name: "DescribeInstances"},
+	}
+
+	limiter.throttled(req, key)
+	require.Equal(t, time.Second, limiter.reserve(key))
+
+	// requests sent before the pause don't extend it
+	*now = now.Add(500 * time.Millisecond)
+	limiter.throttled(req, key)
+	require.Equal(t, 500*time.Millisecond, limiter.reserve(key))
+
+	// throttling right after the pause doubles it
+	*now = now.Add(time.Second)
+	limiter.throttled(req, key)
+	require.Equal(t, 2*time.Second, limiter.reserve(key))
+
+	// the pause is limited to the max backoff
+	for i := 0; i < 10; i++ {
+		*now = now.Add(limiter.reserve(key))
+		limiter.throttled(req, key)
+	}
+	require.Equal(t, maxThrottleBackoff, limiter.reserve(key))
+
+	// throttling long after the last pause starts over
+	*now = now.Add(10 * time.Minute)
+	limiter.throttled(req, key)
+	require.Equal(t, time.Second, limiter.reserve(key))
+
+	// other accounts aren't paused
+	require.Equal(t, time.Duration(0), limiter.reserve("b/eu-central-1"))
+}
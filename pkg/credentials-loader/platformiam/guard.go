@@ -0,0 +1,63 @@
+package platformiam
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// expiryGuardTokenSource caches the tokens of a token source as long as
+// they're valid for at least minValidity and re-fetches them otherwise.
+type expiryGuardTokenSource struct {
+	sync.Mutex
+	source      oauth2.TokenSource
+	minValidity time.Duration
+	token       *oauth2.Token
+	now         func() time.Time
+}
+
+// NewExpiryGuardTokenSource returns a token source which re-fetches the token
+// from source once it's within minValidity of its expiry, such that tokens
+// handed out, e.g. to kubectl, don't expire while they're used. Tokens
+// without an expiry are always valid.
+func NewExpiryGuardTokenSource(source oauth2.TokenSource, minValidity time.Duration) oauth2.TokenSource {
+	return &expiryGuardTokenSource{
+		source:      source,
+		minValidity: minValidity,
+		now:         time.Now,
+	}
+}
+
+// expiresSoon returns true if the token expires within the minimum validity.
+func (s *expiryGuardTokenSource) expiresSoon(token *oauth2.Token) bool {
+	return !token.Expiry.IsZero() && token.Expiry.Before(s.now().Add(s.minValidity))
+}
+
+// Token returns the cached token or a new one from the token source if the
+// cached one expires soon. A new token expiring soon is still returned as
+// long as it's valid, but not cached, so it's re-fetched on the next call.
+func (s *expiryGuardTokenSource) Token() (*oauth2.Token, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.token != nil && !s.expiresSoon(s.token) {
+		return s.token, nil
+	}
+
+	token, err := s.source.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Expiry.IsZero() && !token.Expiry.After(s.now()) {
+		return nil, fmt.Errorf("token expired at %s", token.Expiry)
+	}
+
+	s.token = nil
+	if !s.expiresSoon(token) {
+		s.token = token
+	}
+	return token, nil
+}
@@ -0,0 +1,59 @@
+package platformiam
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+type countingTokenSource struct {
+	tokens []*oauth2.Token
+	calls  int
+}
+
+func (s *countingTokenSource) Token() (*oauth2.Token, error) {
+	token := s.tokens[s.calls]
+	s.calls++
+	return token, nil
+}
+
+func TestExpiryGuardTokenSource(t *testing.T) {
+	now := time.Date(2018, 01, 01, 12, 0, 0, 0, time.UTC)
+	source := &countingTokenSource{
+		tokens: []*oauth2.Token{
+			{AccessToken: "valid", Expiry: now.Add(time.Hour)},
+			{AccessToken: "expiring", Expiry: now.Add(time.Hour + 2*time.Minute)},
+			{AccessToken: "renewed", Expiry: now.Add(2 * time.Hour)},
+			{AccessToken: "expired", Expiry: now.Add(time.Hour)},
+		},
+	}
+	guard := NewExpiryGuardTokenSource(source, 5*time.Minute).(*expiryGuardTokenSource)
+	guard.now = func() time.Time { return now }
+
+	expect := func(accessToken string, calls int) {
+		token, err := guard.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != accessToken || source.calls != calls {
+			t.Errorf("Error, expecting token %s after %d calls, got: %s after %d calls", accessToken, calls, token.AccessToken, source.calls)
+		}
+	}
+
+	// the token is cached while it's valid long enough
+	expect("valid", 1)
+	expect("valid", 1)
+
+	// tokens expiring soon are re-fetched on every call
+	now = now.Add(58 * time.Minute)
+	expect("expiring", 2)
+	expect("renewed", 3)
+	expect("renewed", 3)
+
+	now = now.Add(2 * time.Hour)
+	_, err := guard.Token()
+	if err == nil {
+		t.Error("Error, expecting an error for an expired token")
+	}
+}
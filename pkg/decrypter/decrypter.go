@@ -5,13 +5,22 @@ import "strings"
 // SecretDecrypter is a map of decrypters.
 type SecretDecrypter map[string]Decrypter
 
+// secretPrefixes are the prefixes of the secrets decrypted by the supported
+// decrypters.
+var secretPrefixes = []string{
+	AWSKMSSecretPrefix,
+	AWSSecretsManagerSecretPrefix,
+}
+
 // Decrypt tries to find the right decrypter for the secret based on the secret
 // prefix e.g. 'aws:kms:'. If the decrypter is found it will attempt to decrypt
 // the secret and return it in plaintext.
 func (s SecretDecrypter) Decrypt(secret string) (string, error) {
-	if strings.HasPrefix(secret, AWSKMSSecretPrefix) {
-		if decrypter, ok := s[AWSKMSSecretPrefix]; ok {
-			return decrypter.Decrypt(strings.TrimPrefix(secret, AWSKMSSecretPrefix))
+	for _, prefix := range secretPrefixes {
+		if strings.HasPrefix(secret, prefix) {
+			if decrypter, ok := s[prefix]; ok {
+				return decrypter.Decrypt(strings.TrimPrefix(secret, prefix))
+			}
 		}
 	}
 
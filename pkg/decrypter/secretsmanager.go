@@ -0,0 +1,52 @@
+package decrypter
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+const (
+	// AWSSecretsManagerSecretPrefix is the secret prefix for secrets which
+	// are references to secrets stored in AWS Secrets Manager, e.g.
+	// 'aws:secretsmanager:my-secret'.
+	AWSSecretsManagerSecretPrefix = "aws:secretsmanager:"
+)
+
+// secretsManagerClient is the part of the Secrets Manager API used by the
+// awsSecretsManager decrypter.
+type secretsManagerClient interface {
+	GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// awsSecretsManager is a decrypter which resolves secrets stored in AWS
+// Secrets Manager.
+type awsSecretsManager struct {
+	client secretsManagerClient
+}
+
+// NewAWSSecretsManagerDecrypter initializes a new awsSecretsManager based
+// Decrypter.
+func NewAWSSecretsManagerDecrypter(sess *session.Session) Decrypter {
+	return &awsSecretsManager{
+		client: secretsmanager.New(sess),
+	}
+}
+
+// Decrypt returns the current value of the secret with the name or ARN.
+func (a *awsSecretsManager) Decrypt(secret string) (string, error) {
+	resp, err := a.client.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secret),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if resp.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", secret)
+	}
+
+	return aws.StringValue(resp.SecretString), nil
+}
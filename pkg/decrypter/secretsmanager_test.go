@@ -0,0 +1,72 @@
+package decrypter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+type mockSecretsManagerClient struct {
+	secrets map[string]*secretsmanager.GetSecretValueOutput
+}
+
+func (c *mockSecretsManagerClient) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	if output, ok := c.secrets[aws.StringValue(input.SecretId)]; ok {
+		return output, nil
+	}
+	return nil, fmt.Errorf("secret %s not found", aws.StringValue(input.SecretId))
+}
+
+func TestAWSSecretsManagerDecrypt(t *testing.T) {
+	decrypter := SecretDecrypter(map[string]Decrypter{
+		AWSSecretsManagerSecretPrefix: &awsSecretsManager{
+			client: &mockSecretsManagerClient{
+				secrets: map[string]*secretsmanager.GetSecretValueOutput{
+					"client-key": {SecretString: aws.String("my-key")},
+					"binary":     {SecretBinary: []byte("my-key")},
+				},
+			},
+		},
+	})
+
+	for _, ti := range []struct {
+		msg      string
+		secret   string
+		expected string
+		success  bool
+	}{
+		{
+			msg:      "test resolving a secret",
+			secret:   AWSSecretsManagerSecretPrefix + "client-key",
+			expected: "my-key",
+			success:  true,
+		},
+		{
+			msg:     "test when the secret doesn't exist",
+			secret:  AWSSecretsManagerSecretPrefix + "missing",
+			success: false,
+		},
+		{
+			msg:     "test when the secret isn't a string",
+			secret:  AWSSecretsManagerSecretPrefix + "binary",
+			success: false,
+		},
+	} {
+		t.Run(ti.msg, func(t *testing.T) {
+			value, err := decrypter.Decrypt(ti.secret)
+			if err != nil && ti.success {
+				t.Errorf("should not fail: %s", err)
+			}
+
+			if err == nil && !ti.success {
+				t.Errorf("expected error")
+			}
+
+			if value != ti.expected {
+				t.Errorf("expected %q, got %q", ti.expected, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	stateLeader = "StateLeader"
+)
+
+// Member is a member of an etcd cluster.
+type Member struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs"`
+}
+
+// MemberStatus is the status of a single member as reported by the member
+// itself.
+type MemberStatus struct {
+	Member *Member
+	// Healthy is true if the member reported itself as healthy.
+	Healthy bool
+	// Leader is true if the member is the raft leader.
+	Leader bool
+	// LeaderID is the ID of the leader as seen by the member.
+	LeaderID string
+	// Version is the etcd server version of the member.
+	Version string
+	// Err is the error encountered when getting the status, if any.
+	Err error
+}
+
+// ClusterStatus is the status of all the members of an etcd cluster.
+type ClusterStatus struct {
+	Members []*MemberStatus
+}
+
+// Client is a minimal client for the etcd HTTP API used to manage the
+// members of an etcd cluster.
+type Client struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewClient returns a new Client. The endpoint is used for all cluster wide
+// requests and should be load balanced between the members e.g. by DNS.
+func NewClient(endpoint string, client *http.Client) *Client {
+	return &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   client,
+	}
+}
+
+// do makes a request to the etcd API and decodes the JSON response into
+// result if it's not nil.
+func (c *Client) do(ctx context.Context, method, url string, expectedStatus int, result interface{}) error {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expectedStatus {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: unexpected status code %d: %s", method, url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Members returns the members of the cluster.
+func (c *Client) Members(ctx context.Context) ([]*Member, error) {
+	var result struct {
+		Members []*Member `json:"members"`
+	}
+	err := c.do(ctx, http.MethodGet, c.endpoint+"/v2/members", http.StatusOK, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Members, nil
+}
+
+// RemoveMember removes the member from the cluster.
+func (c *Client) RemoveMember(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, c.endpoint+"/v2/members/"+id, http.StatusNoContent, nil)
+}
+
+// MemberStatus returns the status of the member by querying the member
+// directly. Errors are reported in the Err field of the status.
+func (c *Client) MemberStatus(ctx context.Context, member *Member) *MemberStatus {
+	status := &MemberStatus{Member: member}
+	if len(member.ClientURLs) == 0 {
+		status.Err = fmt.Errorf("member %s has no client URLs", member.Name)
+		return status
+	}
+	endpoint := strings.TrimSuffix(member.ClientURLs[0], "/")
+
+	var health struct {
+		Health string `json:"health"`
+	}
+	status.Err = c.do(ctx, http.MethodGet, endpoint+"/health", http.StatusOK, &health)
+	if status.Err != nil {
+		return status
+	}
+	status.Healthy = health.Health == "true"
+
+	var self struct {
+		ID         string `json:"id"`
+		State      string `json:"state"`
+		LeaderInfo struct {
+			Leader string `json:"leader"`
+		} `json:"leaderInfo"`
+	}
+	status.Err = c.do(ctx, http.MethodGet, endpoint+"/v2/stats/self", http.StatusOK, &self)
+	if status.Err != nil {
+		return status
+	}
+	status.Leader = self.State == stateLeader
+	status.LeaderID = self.LeaderInfo.Leader
+
+	var version struct {
+		Server string `json:"etcdserver"`
+	}
+	status.Err = c.do(ctx, http.MethodGet, endpoint+"/version", http.StatusOK, &version)
+	status.Version = version.Server
+	return status
+}
+
+// Status returns the status of all the members of the cluster.
+func (c *Client) Status(ctx context.Context) (*ClusterStatus, error) {
+	members, err := c.Members(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ClusterStatus{}
+	for _, member := range members {
+		status.Members = append(status.Members, c.MemberStatus(ctx, member))
+	}
+	return status, nil
+}
+
+// Leader returns the status of the leader or nil if no member is the leader.
+func (s *ClusterStatus) Leader() *MemberStatus {
+	for _, member := range s.Members {
+		if member.Leader {
+			return member
+		}
+	}
+	return nil
+}
+
+// VerifyQuorum verifies that all the members are healthy and agree on a
+// single leader. Requiring all members to be healthy rather than just a
+// quorum ensures that taking down another member for maintenance can't
+// result in a loss of quorum.
+func (s *ClusterStatus) VerifyQuorum() error {
+	if len(s.Members) == 0 {
+		return fmt.Errorf("no members")
+	}
+
+	healthy := 0
+	leaders := make(map[string]bool)
+	for _, member := range s.Members {
+		if member.Err != nil {
+			continue
+		}
+		if member.Healthy {
+			healthy++
+		}
+		if member.LeaderID != "" {
+			leaders[member.LeaderID] = true
+		}
+	}
+
+	quorum := len(s.Members)/2 + 1
+	if healthy < quorum {
+		return fmt.Errorf("quorum lost: %d of %d members healthy", healthy, len(s.Members))
+	}
+
+	if healthy < len(s.Members) {
+		return fmt.Errorf("%d of %d members healthy", healthy, len(s.Members))
+	}
+
+	if len(leaders) != 1 {
+		return fmt.Errorf("members don't agree on a single leader (%d leaders)", len(leaders))
+	}
+
+	return nil
+}
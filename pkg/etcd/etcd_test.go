@@ -0,0 +1,108 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMemberServer returns a server emulating an etcd member.
+func newMemberServer(id, leader string, healthy bool, version string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"health": "%t"}`, healthy)
+	})
+	mux.HandleFunc("/v2/stats/self", func(w http.ResponseWriter, r *http.Request) {
+		state := "StateFollower"
+		if id == leader {
+			state = "StateLeader"
+		}
+		fmt.Fprintf(w, `{"id": "%s", "state": "%s", "leaderInfo": {"leader": "%s"}}`, id, state, leader)
+	})
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"etcdserver": "%s", "etcdcluster": "3.3.0"}`, version)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestClusterStatus(t *testing.T) {
+	member1 := newMemberServer("a", "a", true, "3.3.10")
+	defer member1.Close()
+	member2 := newMemberServer("b", "a", true, "3.3.9")
+	defer member2.Close()
+
+	removed := ""
+	cluster := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/members":
+			fmt.Fprintf(w, `{"members": [{"id": "a", "name": "member1", "clientURLs": ["%s"]}, {"id": "b", "name": "member2", "clientURLs": ["%s"]}]}`, member1.URL, member2.URL)
+		case r.Method == http.MethodDelete && r.URL.Path == "/v2/members/b":
+			removed = "b"
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer cluster.Close()
+
+	client := NewClient(cluster.URL+"/", http.DefaultClient)
+
+	status, err := client.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, status.Members, 2)
+	assert.NoError(t, status.VerifyQuorum())
+	assert.Equal(t, "a", status.Leader().Member.ID)
+	assert.Equal(t, "3.3.9", status.Members[1].Version)
+
+	require.NoError(t, client.RemoveMember(context.Background(), "b"))
+	assert.Equal(t, "b", removed)
+	assert.Error(t, client.RemoveMember(context.Background(), "c"))
+}
+
+func TestVerifyQuorum(t *testing.T) {
+	healthy := func(id string) *MemberStatus {
+		return &MemberStatus{Member: &Member{ID: id}, Healthy: true, LeaderID: "a"}
+	}
+
+	for _, tc := range []struct {
+		msg     string
+		members []*MemberStatus
+		valid   bool
+	}{
+		{
+			msg:     "all members healthy",
+			members: []*MemberStatus{healthy("a"), healthy("b"), healthy("c")},
+			valid:   true,
+		},
+		{
+			msg:     "no members",
+			members: nil,
+		},
+		{
+			msg:     "unhealthy member",
+			members: []*MemberStatus{healthy("a"), healthy("b"), {Member: &Member{ID: "c"}, Err: fmt.Errorf("timeout")}},
+		},
+		{
+			msg:     "quorum lost",
+			members: []*MemberStatus{healthy("a"), {Member: &Member{ID: "b"}}, {Member: &Member{ID: "c"}}},
+		},
+		{
+			msg:     "split leadership",
+			members: []*MemberStatus{healthy("a"), {Member: &Member{ID: "b"}, Healthy: true, LeaderID: "b"}},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := (&ClusterStatus{Members: tc.members}).VerifyQuorum()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package events
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+const (
+	// SpecVersion is the version of the CloudEvents specification the
+	// events conform to.
+	SpecVersion = "1.0"
+
+	// Source is the source of all events published by the CLM.
+	Source = "/cluster-lifecycle-manager"
+
+	// TypeClusterCreated is the type of events published when a requested
+	// cluster has been provisioned for the first time.
+	TypeClusterCreated = "org.zalando.cluster-lifecycle-manager.cluster.created"
+	// TypeClusterUpdated is the type of events published when a cluster
+	// has been updated to a new channel version.
+	TypeClusterUpdated = "org.zalando.cluster-lifecycle-manager.cluster.updated"
+	// TypeClusterDecommissioned is the type of events published when a
+	// cluster has been decommissioned.
+	TypeClusterDecommissioned = "org.zalando.cluster-lifecycle-manager.cluster.decommissioned"
+	// TypeClusterFailed is the type of events published when provisioning
+	// or decommissioning a cluster failed.
+	TypeClusterFailed = "org.zalando.cluster-lifecycle-manager.cluster.failed"
+
+	snsTopicPrefix  = "arn:aws:sns:"
+	contentTypeJSON = "application/json"
+	// contentTypeCloudEvents is the content type of events in the
+	// structured mode of the HTTP binding.
+	contentTypeCloudEvents = "application/cloudevents+json"
+)
+
+// Event is a CloudEvent in the structured JSON format.
+type Event struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// ClusterData is the data of the cluster events.
+type ClusterData struct {
+	ClusterID               string `json:"cluster_id"`
+	Alias                   string `json:"alias"`
+	InfrastructureAccount   string `json:"infrastructure_account"`
+	Region                  string `json:"region"`
+	Provider                string `json:"provider"`
+	Environment             string `json:"environment"`
+	LifecycleStatus         string `json:"lifecycle_status"`
+	PreviousLifecycleStatus string `json:"previous_lifecycle_status"`
+	ChannelVersion          string `json:"channel_version,omitempty"`
+	Error                   string `json:"error,omitempty"`
+}
+
+// NewEvent returns an event of the type about the subject, e.g. the ID of a
+// cluster, with a random ID.
+func NewEvent(eventType, subject string, data interface{}) (*Event, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		SpecVersion:     SpecVersion,
+		ID:              hex.EncodeToString(id),
+		Source:          Source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: contentTypeJSON,
+		Data:            data,
+	}, nil
+}
+
+// Publisher defines an interface for publishing events to external
+// consumers.
+type Publisher interface {
+	Publish(event *Event) error
+}
+
+// NewPublisher initializes a new Publisher based on the location. The
+// location can either be the ARN of an SNS topic or an HTTP(S) URL the events
+// are posted to, e.g. a Knative broker or a bridge to Kafka or NATS. The
+// session is used for accessing SNS and the client for posting to URLs.
+func NewPublisher(location string, sess *session.Session, client *http.Client) (Publisher, error) {
+	if strings.HasPrefix(location, snsTopicPrefix) {
+		return &snsPublisher{client: sns.New(sess), topicARN: location}, nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return &httpPublisher{client: client, url: u.String()}, nil
+	default:
+		return nil, fmt.Errorf("unknown event sink type: %s", location)
+	}
+}
+
+// snsAPI is a minimal interface containing only the methods we use from the
+// SNS API.
+type snsAPI interface {
+	Publish(input *sns.PublishInput) (*sns.PublishOutput, error)
+}
+
+// snsPublisher publishes the events to an SNS topic. The type is also set as
+// a message attribute so subscribers can filter on it.
+type snsPublisher struct {
+	client   snsAPI
+	topicARN string
+}
+
+func (p *snsPublisher) Publish(event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.client.Publish(&sns.PublishInput{
+		TopicArn: aws.String(p.topicARN),
+		Message:  aws.String(string(data)),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			"type": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(event.Type),
+			},
+		},
+	})
+	return err
+}
+
+// httpPublisher posts the events to a URL in the structured mode of the
+// CloudEvents HTTP binding.
+type httpPublisher struct {
+	client *http.Client
+	url    string
+}
+
+func (p *httpPublisher) Publish(event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Post(p.url, contentTypeCloudEvents, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to publish event %s: %s", event.ID, resp.Status)
+	}
+	return nil
+}
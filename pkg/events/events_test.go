@@ -0,0 +1,97 @@
+package events
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/stretchr/testify/require"
+)
+
+type snsAPIStub struct {
+	published []*sns.PublishInput
+}
+
+func (s *snsAPIStub) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	s.published = append(s.published, input)
+	return &sns.PublishOutput{}, nil
+}
+
+func TestNewEvent(t *testing.T) {
+	event, err := NewEvent(TypeClusterCreated, "kube-1", &ClusterData{ClusterID: "kube-1"})
+	require.NoError(t, err)
+	require.Equal(t, SpecVersion, event.SpecVersion)
+	require.Equal(t, Source, event.Source)
+	require.Len(t, event.ID, 32)
+
+	other, err := NewEvent(TypeClusterCreated, "kube-1", nil)
+	require.NoError(t, err)
+	require.NotEqual(t, event.ID, other.ID)
+}
+
+func TestNewPublisher(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("eu-central-1")}))
+
+	publisher, err := NewPublisher("arn:aws:sns:eu-central-1:123456789012:clusters", sess, nil)
+	require.NoError(t, err)
+	require.IsType(t, &snsPublisher{}, publisher)
+
+	publisher, err = NewPublisher("https://broker.example.org/clusters", sess, http.DefaultClient)
+	require.NoError(t, err)
+	require.IsType(t, &httpPublisher{}, publisher)
+
+	_, err = NewPublisher("kafka://broker:9092/clusters", sess, nil)
+	require.Error(t, err)
+}
+
+func TestSNSPublisher(t *testing.T) {
+	client := &snsAPIStub{}
+	publisher := &snsPublisher{client: client, topicARN: "arn:aws:sns:eu-central-1:123456789012:clusters"}
+
+	event, err := NewEvent(TypeClusterDecommissioned, "kube-1", &ClusterData{ClusterID: "kube-1"})
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(event))
+
+	require.Len(t, client.published, 1)
+	require.Equal(t, TypeClusterDecommissioned, aws.StringValue(client.published[0].MessageAttributes["type"].StringValue))
+
+	var published Event
+	require.NoError(t, json.Unmarshal([]byte(aws.StringValue(client.published[0].Message)), &published))
+	require.Equal(t, event.ID, published.ID)
+}
+
+func TestHTTPPublisher(t *testing.T) {
+	var contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	publisher := &httpPublisher{client: server.Client(), url: server.URL}
+
+	event, err := NewEvent(TypeClusterCreated, "kube-1", &ClusterData{ClusterID: "kube-1"})
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(event))
+
+	require.Equal(t, contentTypeCloudEvents, contentType)
+	var published Event
+	require.NoError(t, json.Unmarshal(body, &published))
+	require.Equal(t, TypeClusterCreated, published.Type)
+
+	// errors of the sink are returned
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	publisher.url = failing.URL
+	require.Error(t, publisher.Publish(event))
+}
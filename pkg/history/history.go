@@ -0,0 +1,241 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// ResultSuccess is the result of successful provisioning attempts.
+	ResultSuccess = "success"
+	// ResultFailure is the result of failed provisioning attempts.
+	ResultFailure = "failure"
+)
+
+// Entry describes a single provisioning attempt of a cluster.
+type Entry struct {
+	ClusterID      string    `json:"cluster_id"`
+	Operation      string    `json:"operation"`
+	ChannelVersion string    `json:"channel_version"`
+	Started        time.Time `json:"started"`
+	Finished       time.Time `json:"finished"`
+	// Duration is the duration of the attempt in seconds.
+	Duration float64 `json:"duration"`
+	Result   string  `json:"result"`
+	Error    string  `json:"error,omitempty"`
+	// AuditLog is the reference to the audit log of the attempt, if any.
+	AuditLog string `json:"audit_log,omitempty"`
+	// Urgent is set if the attempt was part of an urgent update.
+	Urgent *Urgent `json:"urgent,omitempty"`
+}
+
+// Urgent describes who triggered an urgent update and why.
+type Urgent struct {
+	Reason      string `json:"reason"`
+	TriggeredBy string `json:"triggered_by"`
+}
+
+// NewEntry returns an entry for an attempt started at started and finished
+// now. The result is derived from err.
+func NewEntry(clusterID, operation, channelVersion string, started time.Time, err error) *Entry {
+	finished := time.Now().UTC()
+	entry := &Entry{
+		ClusterID:      clusterID,
+		Operation:      operation,
+		ChannelVersion: channelVersion,
+		Started:        started.UTC(),
+		Finished:       finished,
+		Duration:       finished.Sub(started).Seconds(),
+		Result:         ResultSuccess,
+	}
+
+	if err != nil {
+		entry.Result = ResultFailure
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// Store defines an interface for persisting and querying the provisioning
+// history of clusters.
+type Store interface {
+	// Record persists the entry.
+	Record(entry *Entry) error
+	// List returns the latest entries of the cluster, newest first. At
+	// most limit entries are returned, all if limit is 0.
+	List(clusterID string, limit int) ([]*Entry, error)
+}
+
+// NewStore initializes a new Store based on the location. The location can
+// either be an S3 URL (s3://bucket/prefix) or a path to a local directory. The
+// session is used for accessing S3.
+func NewStore(location string, sess *session.Session) (Store, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "s3":
+		return &s3Store{
+			client: s3.New(sess),
+			bucket: u.Host,
+			prefix: strings.TrimPrefix(u.Path, "/"),
+		}, nil
+	case "file", "":
+		return &fileStore{dir: u.Host + u.Path}, nil
+	default:
+		return nil, fmt.Errorf("unknown history location type: %s", u.Scheme)
+	}
+}
+
+// clusterDir returns the directory of the entries of the cluster.
+func clusterDir(clusterID string) string {
+	return strings.Replace(clusterID, ":", "-", -1)
+}
+
+// entryName returns a unique name for the entry. Names of a cluster sort in
+// the order the attempts started.
+func entryName(entry *Entry) string {
+	return fmt.Sprintf("%s/%s-%s.json", clusterDir(entry.ClusterID), entry.Started.Format("20060102T150405.000Z"), entry.Operation)
+}
+
+// latest returns the last limit names in reverse order, all if limit is 0.
+func latest(names []string, limit int) []string {
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	if limit > 0 && len(names) > limit {
+		names = names[:limit]
+	}
+	return names
+}
+
+// fileStore stores the history in a local directory.
+type fileStore struct {
+	dir string
+}
+
+func (s *fileStore) Record(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file := path.Join(s.dir, entryName(entry))
+	err = os.MkdirAll(path.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+func (s *fileStore) List(clusterID string, limit int) ([]*Entry, error) {
+	dir := path.Join(s.dir, clusterDir(clusterID))
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Entry{}, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+			names = append(names, file.Name())
+		}
+	}
+
+	entries := make([]*Entry, 0, len(names))
+	for _, name := range latest(names, limit) {
+		data, err := ioutil.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		var entry Entry
+		err = json.Unmarshal(data, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid history entry %s: %v", name, err)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+// s3API is a minimal interface containing only the methods we use from the S3
+// API.
+type s3API interface {
+	PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error
+}
+
+// s3Store stores the history in an S3 bucket.
+type s3Store struct {
+	client s3API
+	bucket string
+	prefix string
+}
+
+func (s *s3Store) Record(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path.Join(s.prefix, entryName(entry))),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (s *s3Store) List(clusterID string, limit int) ([]*Entry, error) {
+	var keys []string
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(path.Join(s.prefix, clusterDir(clusterID)) + "/"),
+	}, func(resp *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range resp.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, len(keys))
+	for _, key := range latest(keys, limit) {
+		resp, err := s.client.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var entry Entry
+		err = json.NewDecoder(resp.Body).Decode(&entry)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid history entry %s: %v", key, err)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
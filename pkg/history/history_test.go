@@ -0,0 +1,120 @@
+package history
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+const clusterID = "aws:123456789012:eu-central-1:kube-1"
+
+func testEntries() []*Entry {
+	started := time.Date(2019, 11, 20, 10, 0, 0, 0, time.UTC)
+	var entries []*Entry
+	for i := 0; i < 3; i++ {
+		entry := NewEntry(clusterID, "provision", "abc", started.Add(time.Duration(i)*time.Hour), nil)
+		entries = append(entries, entry)
+	}
+	entries[1] = NewEntry(clusterID, "provision", "def", started.Add(time.Hour), errors.New("stack failed"))
+	return entries
+}
+
+func TestNewEntry(t *testing.T) {
+	entry := NewEntry(clusterID, "provision", "abc", time.Now().Add(-time.Minute), errors.New("failed"))
+	require.Equal(t, ResultFailure, entry.Result)
+	require.Equal(t, "failed", entry.Error)
+	require.True(t, entry.Duration >= 60)
+
+	entry = NewEntry(clusterID, "provision", "abc", time.Now(), nil)
+	require.Equal(t, ResultSuccess, entry.Result)
+	require.Empty(t, entry.Error)
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewStore(dir, nil)
+	require.NoError(t, err)
+
+	entries, err := store.List(clusterID, 0)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	for _, entry := range testEntries() {
+		require.NoError(t, store.Record(entry))
+	}
+
+	entries, err = store.List(clusterID, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, "abc", entries[0].ChannelVersion)
+	require.Equal(t, ResultFailure, entries[1].Result)
+	require.Equal(t, "stack failed", entries[1].Error)
+	require.True(t, entries[0].Started.After(entries[1].Started))
+
+	entries, err = store.List(clusterID, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, 12, entries[0].Started.Hour())
+
+	_, err = NewStore("gs://bucket", nil)
+	require.Error(t, err)
+}
+
+type s3APIStub struct {
+	objects map[string][]byte
+}
+
+func (s *s3APIStub) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.objects[aws.StringValue(input.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (s *s3APIStub) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(s.objects[aws.StringValue(input.Key)]))}, nil
+}
+
+func (s *s3APIStub) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	var contents []*s3.Object
+	for key := range s.objects {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			contents = append(contents, &s3.Object{Key: aws.String(key)})
+		}
+	}
+	fn(&s3.ListObjectsV2Output{Contents: contents}, true)
+	return nil
+}
+
+func TestS3Store(t *testing.T) {
+	client := &s3APIStub{objects: make(map[string][]byte)}
+	store := &s3Store{client: client, bucket: "bucket", prefix: "history"}
+
+	for _, entry := range testEntries() {
+		require.NoError(t, store.Record(entry))
+	}
+	require.Contains(t, client.objects, "history/aws-123456789012-eu-central-1-kube-1/20191120T100000.000Z-provision.json")
+
+	entries, err := store.List(clusterID, 2)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, 12, entries[0].Started.Hour())
+	require.Equal(t, "def", entries[1].ChannelVersion)
+
+	entries, err = store.List("aws:123456789012:eu-central-1:kube-2", 0)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
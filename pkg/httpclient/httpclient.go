@@ -0,0 +1,137 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	dialTimeout         = 30 * time.Second
+	dialKeepAlive       = 30 * time.Second
+	idleConnTimeout     = 90 * time.Second
+	tlsHandshakeTimeout = 10 * time.Second
+
+	// ec2MetadataHost is the address of the EC2 metadata service which
+	// must never be accessed through a proxy.
+	ec2MetadataHost = "169.254.169.254"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+}
+
+// Config is the configuration shared by all outbound HTTP clients.
+type Config struct {
+	// ProxyURL is the proxy used for all requests. If not set, the proxy
+	// is configured from the HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment
+	// variables.
+	ProxyURL *url.URL
+	// CABundle is the path to a PEM encoded bundle of CA certificates
+	// which are trusted in addition to the system CAs.
+	CABundle string
+	// TLSMinVersion is the minimum TLS version accepted. Defaults to
+	// TLS 1.2 if not set.
+	TLSMinVersion uint16
+}
+
+// ParseTLSVersion parses a TLS version string e.g. "1.2".
+func ParseTLSVersion(version string) (uint16, error) {
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version: %s", version)
+	}
+	return v, nil
+}
+
+// Transport returns a new HTTP transport based on the config. The PEM encoded
+// caData is trusted in addition to the system CAs and the configured CA
+// bundle, this can be used to trust e.g. the CA of a cluster's API server. A
+// nil Config returns a transport with the default settings.
+func (c *Config) Transport(caData []byte) (*http.Transport, error) {
+	if c == nil {
+		c = &Config{}
+	}
+
+	rootCAs, err := c.rootCAs(caData)
+	if err != nil {
+		return nil, err
+	}
+
+	minVersion := c.TLSMinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if c.ProxyURL != nil {
+		proxy = func(req *http.Request) (*url.URL, error) {
+			if req.URL.Hostname() == ec2MetadataHost {
+				return nil, nil
+			}
+			return c.ProxyURL, nil
+		}
+	}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: dialKeepAlive,
+		}).DialContext,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     idleConnTimeout,
+		TLSHandshakeTimeout: tlsHandshakeTimeout,
+		TLSClientConfig: &tls.Config{
+			RootCAs:    rootCAs,
+			MinVersion: minVersion,
+		},
+	}, nil
+}
+
+// Client returns a new HTTP client based on the config. See Transport for
+// the meaning of caData.
+func (c *Config) Client(caData []byte) (*http.Client, error) {
+	transport, err := c.Transport(caData)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// rootCAs returns the pool of trusted CAs. nil is returned if no custom CAs
+// are configured such that the system CAs are used.
+func (c *Config) rootCAs(caData []byte) (*x509.CertPool, error) {
+	if c.CABundle == "" && len(caData) == 0 {
+		return nil, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if c.CABundle != "" {
+		bundle, err := ioutil.ReadFile(c.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle %s: %v", c.CABundle, err)
+		}
+
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no valid certificates found in CA bundle %s", c.CABundle)
+		}
+	}
+
+	if len(caData) > 0 && !pool.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("no valid CA certificates found")
+	}
+
+	return pool, nil
+}
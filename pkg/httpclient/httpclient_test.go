@@ -0,0 +1,91 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	// untrusted CA
+	client, err := (&Config{}).Client(nil)
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	// CA passed as data
+	client, err = (&Config{}).Client(caData)
+	require.NoError(t, err)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// CA configured as bundle
+	bundle, err := ioutil.TempFile("", "ca-bundle")
+	require.NoError(t, err)
+	defer os.Remove(bundle.Name())
+	_, err = bundle.Write(caData)
+	require.NoError(t, err)
+	require.NoError(t, bundle.Close())
+
+	client, err = (&Config{CABundle: bundle.Name()}).Client(nil)
+	require.NoError(t, err)
+	resp, err = client.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// invalid CA data
+	_, err = (&Config{}).Client([]byte("invalid"))
+	assert.Error(t, err)
+}
+
+func TestTransport(t *testing.T) {
+	var config *Config
+	transport, err := config.Transport(nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), transport.TLSClientConfig.MinVersion)
+	assert.Nil(t, transport.TLSClientConfig.RootCAs)
+
+	proxyURL, err := url.Parse("http://proxy.example.org:3128")
+	require.NoError(t, err)
+	config = &Config{ProxyURL: proxyURL, TLSMinVersion: tls.VersionTLS11}
+	transport, err = config.Transport(nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS11), transport.TLSClientConfig.MinVersion)
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.org", nil)
+	require.NoError(t, err)
+	proxy, err := transport.Proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, proxyURL, proxy)
+
+	req, err = http.NewRequest(http.MethodGet, "http://169.254.169.254/latest/meta-data/", nil)
+	require.NoError(t, err)
+	proxy, err = transport.Proxy(req)
+	require.NoError(t, err)
+	assert.Nil(t, proxy)
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	version, err := ParseTLSVersion("1.2")
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), version)
+
+	_, err = ParseTLSVersion("0.9")
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package kubectl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const (
+	binaryName = "kubectl"
+)
+
+// Manager downloads kubectl binaries of pinned versions and caches them on
+// disk.
+type Manager struct {
+	cacheDir    string
+	downloadURL string
+	client      *http.Client
+	mutex       sync.Mutex
+	// verified are the paths of the cached binaries whose checksum was
+	// verified by this process, by version and checksum.
+	verified map[string]string
+}
+
+// NewManager initializes a new Manager caching the binaries in cacheDir and
+// downloading them from downloadURL, the base URL of the Kubernetes release
+// binaries.
+func NewManager(cacheDir, downloadURL string, client *http.Client) *Manager {
+	return &Manager{
+		cacheDir:    cacheDir,
+		downloadURL: strings.TrimSuffix(downloadURL, "/"),
+		client:      client,
+		verified:    make(map[string]string),
+	}
+}
+
+// Binary returns the path of the kubectl binary of the version, e.g. v1.14.8,
+// downloading it if it isn't cached yet. The binary must match the SHA-256
+// checksum, cached binaries which don't match are downloaded again.
+func (m *Manager) Binary(version, checksum string) (string, error) {
+	checksum = strings.ToLower(checksum)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := version + "@" + checksum
+	if binary, ok := m.verified[key]; ok {
+		return binary, nil
+	}
+
+	binary := path.Join(m.cacheDir, version, binaryName)
+
+	cached, err := fileChecksum(binary)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if cached != checksum {
+		err = m.download(version, checksum, binary)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	m.verified[key] = binary
+	return binary, nil
+}
+
+// download downloads the binary of the version to dest. The binary is only
+// moved to dest if it matches the checksum.
+func (m *Manager) download(version, checksum, dest string) error {
+	url := fmt.Sprintf("%s/%s/bin/%s/%s/%s", m.downloadURL, version, runtime.GOOS, runtime.GOARCH, binaryName)
+
+	err := os.MkdirAll(path.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.client.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to download kubectl %s: %v", version, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download kubectl %s from %s: unexpected status %s", version, url, resp.Status)
+	}
+
+	tmp, err := ioutil.TempFile(path.Dir(dest), binaryName)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download kubectl %s: %v", version, err)
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != checksum {
+		return fmt.Errorf("checksum mismatch for kubectl %s from %s: expected %s, got %s", version, url, checksum, actual)
+	}
+
+	err = os.Chmod(tmp.Name(), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
+
+// fileChecksum returns the hex encoded SHA-256 checksum of the file.
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,77 @@
+package kubectl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerBinary(t *testing.T) {
+	content := []byte("kubectl v1.14.8")
+	hash := sha256.Sum256(content)
+	checksum := hex.EncodeToString(hash[:])
+
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf("/v1.14.8/bin/%s/%s/kubectl", runtime.GOOS, runtime.GOARCH) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		downloads++
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "kubectl")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	manager := NewManager(cacheDir, server.URL+"/", server.Client())
+
+	binary, err := manager.Binary("v1.14.8", checksum)
+	require.NoError(t, err)
+	require.Equal(t, 1, downloads)
+
+	data, err := ioutil.ReadFile(binary)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+
+	info, err := os.Stat(binary)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// verified binaries are reused
+	_, err = manager.Binary("v1.14.8", checksum)
+	require.NoError(t, err)
+	require.Equal(t, 1, downloads)
+
+	// cached binaries are reused by new processes
+	manager = NewManager(cacheDir, server.URL, server.Client())
+	_, err = manager.Binary("v1.14.8", checksum)
+	require.NoError(t, err)
+	require.Equal(t, 1, downloads)
+
+	// corrupted binaries are downloaded again
+	err = ioutil.WriteFile(binary, []byte("corrupted"), 0755)
+	require.NoError(t, err)
+	manager = NewManager(cacheDir, server.URL, server.Client())
+	_, err = manager.Binary("v1.14.8", checksum)
+	require.NoError(t, err)
+	require.Equal(t, 2, downloads)
+
+	// binaries which don't match the checksum aren't used
+	_, err = manager.Binary("v1.14.8", hex.EncodeToString(make([]byte, sha256.Size)))
+	require.Error(t, err)
+
+	// unknown versions
+	_, err = manager.Binary("v1.99.0", checksum)
+	require.Error(t, err)
+}
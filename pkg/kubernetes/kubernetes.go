@@ -9,17 +9,27 @@ import (
 )
 
 // NewKubeClientWithTokenSource initializes a Kubernetes client with the
-// specified token source.
-func NewKubeClientWithTokenSource(host string, tokenSrc oauth2.TokenSource) (kubernetes.Interface, error) {
-	cfg := &rest.Config{
-		Host: host,
-		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+// specified token source. If transport is nil the default transport is used.
+func NewKubeClientWithTokenSource(host string, tokenSrc oauth2.TokenSource, transport http.RoundTripper) (kubernetes.Interface, error) {
+	return kubernetes.NewForConfig(NewConfigWithTokenSource(host, tokenSrc, transport))
+}
+
+// NewConfigWithTokenSource returns a client config authenticating with the
+// specified token source, e.g. for initializing dynamic clients. If transport
+// is nil the default transport is used. If tokenSrc is nil no token is sent,
+// e.g. for transports authenticating with a client certificate.
+func NewConfigWithTokenSource(host string, tokenSrc oauth2.TokenSource, transport http.RoundTripper) *rest.Config {
+	config := &rest.Config{
+		Host:      host,
+		Transport: transport,
+	}
+	if tokenSrc != nil {
+		config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
 			return &oauth2.Transport{
 				Source: tokenSrc,
 				Base:   rt,
 			}
-		},
+		}
 	}
-
-	return kubernetes.NewForConfig(cfg)
+	return config
 }
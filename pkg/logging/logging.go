@@ -0,0 +1,141 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Fields carried by the log entries of the CLM. Aggregated logs of a fleet of
+// clusters can be queried by them.
+const (
+	// FieldCluster is the ID of the cluster the entry is about.
+	FieldCluster = "cluster_id"
+	// FieldProvider is the provider of the cluster.
+	FieldProvider = "provider"
+	// FieldOperation is the operation performed on the cluster, e.g.
+	// provision or decommission.
+	FieldOperation = "operation"
+	// FieldStep is the step of the operation, e.g. etcd or node-pools.
+	FieldStep = "step"
+	// FieldAttempt is the number of the attempt of the operation. It's
+	// reset once an attempt succeeds.
+	FieldAttempt = "attempt"
+	// FieldModule is the module logging the entry. The log level can be
+	// configured per module.
+	FieldModule = "module"
+)
+
+const (
+	// FormatText logs human readable text.
+	FormatText = "text"
+	// FormatJSON logs one JSON object per entry.
+	FormatJSON = "json"
+)
+
+// Config configures the logging of the CLM.
+type Config struct {
+	// Format is the format of the log entries, text or json.
+	Format string
+	// Level is the default log level.
+	Level string
+	// ModuleLevels are the log levels of individual modules, as
+	// <module>=<level>.
+	ModuleLevels []string
+	// Redactor masks sensitive values in the log entries if set.
+	Redactor *Redactor
+}
+
+// Setup configures the logger according to the config.
+func Setup(logger *log.Logger, config Config) error {
+	level, err := log.ParseLevel(config.Level)
+	if err != nil {
+		return err
+	}
+
+	moduleLevels, err := parseModuleLevels(config.ModuleLevels)
+	if err != nil {
+		return err
+	}
+
+	var formatter log.Formatter
+	switch config.Format {
+	case FormatText, "":
+		formatter = &log.TextFormatter{}
+	case FormatJSON:
+		formatter = &log.JSONFormatter{}
+	default:
+		return fmt.Errorf("unknown log format: %s", config.Format)
+	}
+
+	// the logger has to let through the entries of the most verbose
+	// module, the formatter drops the entries of the other modules.
+	maxLevel := level
+	for _, moduleLevel := range moduleLevels {
+		if moduleLevel > maxLevel {
+			maxLevel = moduleLevel
+		}
+	}
+
+	if config.Redactor != nil {
+		formatter = &redactingFormatter{
+			Formatter: formatter,
+			redactor:  config.Redactor,
+		}
+	}
+
+	logger.Formatter = &moduleLevelFormatter{
+		Formatter:    formatter,
+		level:        level,
+		moduleLevels: moduleLevels,
+	}
+	logger.Level = maxLevel
+	return nil
+}
+
+// parseModuleLevels parses a list of <module>=<level>.
+func parseModuleLevels(values []string) (map[string]log.Level, error) {
+	levels := make(map[string]log.Level, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid module log level %s, expected <module>=<level>", value)
+		}
+
+		level, err := log.ParseLevel(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid module log level %s: %v", value, err)
+		}
+		levels[parts[0]] = level
+	}
+	return levels, nil
+}
+
+// moduleLevelFormatter wraps a formatter and drops the entries which are
+// below the log level of their module.
+type moduleLevelFormatter struct {
+	log.Formatter
+	level        log.Level
+	moduleLevels map[string]log.Level
+}
+
+// Format formats the entry or returns nothing if the entry is dropped.
+func (f *moduleLevelFormatter) Format(entry *log.Entry) ([]byte, error) {
+	level := f.level
+	if module, ok := entry.Data[FieldModule].(string); ok {
+		if moduleLevel, ok := f.moduleLevels[module]; ok {
+			level = moduleLevel
+		}
+	}
+
+	if entry.Level > level {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
+
+// WithModule returns a logger for the module.
+func WithModule(logger *log.Entry, module string) *log.Entry {
+	return logger.WithField(FieldModule, module)
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetup(t *testing.T) {
+	var output bytes.Buffer
+	logger := log.New()
+	logger.Out = &output
+
+	err := Setup(logger, Config{
+		Format:       FormatJSON,
+		Level:        "info",
+		ModuleLevels: []string{"updatestrategy=debug", "channel=error"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, log.DebugLevel, logger.Level)
+
+	entry := log.NewEntry(logger).WithField(FieldCluster, "aws:123456789012:eu-central-1:kube-1")
+	entry.Debug("dropped")
+	WithModule(entry, "updatestrategy").Debug("logged")
+	WithModule(entry, "channel").Warn("dropped")
+	WithModule(entry, "channel").Error("logged")
+	entry.Info("logged")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 3)
+	for _, line := range lines {
+		var fields map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &fields))
+		require.Equal(t, "logged", fields["msg"])
+		require.Equal(t, "aws:123456789012:eu-central-1:kube-1", fields[FieldCluster])
+	}
+}
+
+func TestSetupInvalid(t *testing.T) {
+	for _, config := range []Config{
+		{Format: "xml", Level: "info"},
+		{Format: FormatText, Level: "verbose"},
+		{Format: FormatText, Level: "info", ModuleLevels: []string{"provisioner"}},
+		{Format: FormatText, Level: "info", ModuleLevels: []string{"provisioner=verbose"}},
+	} {
+		require.Error(t, Setup(log.New(), config))
+	}
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Redacted replaces the sensitive values.
+	Redacted = "<redacted>"
+
+	// minRedactedLength is the minimum length of the values to redact.
+	// Shorter values, e.g. true or 1, would mask large parts of the logs
+	// without protecting anything.
+	minRedactedLength = 4
+)
+
+// Redactor masks sensitive values, e.g. the values of sensitive config items,
+// in strings. The values are registered by owner, e.g. the cluster they
+// belong to. It's safe for concurrent use and a nil Redactor doesn't mask
+// anything.
+type Redactor struct {
+	sync.RWMutex
+	values map[string][]string
+	// sorted are the values of all owners, longest first so values
+	// containing other values are masked completely.
+	sorted []string
+}
+
+// NewRedactor initializes a new Redactor without any values.
+func NewRedactor() *Redactor {
+	return &Redactor{values: make(map[string][]string)}
+}
+
+// SetValues sets the sensitive values of the owner, replacing the ones set
+// before.
+func (r *Redactor) SetValues(owner string, values []string) {
+	if r == nil {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	var ownerValues []string
+	for _, value := range values {
+		if len(value) >= minRedactedLength {
+			ownerValues = append(ownerValues, value)
+		}
+	}
+
+	if len(ownerValues) == 0 {
+		delete(r.values, owner)
+	} else {
+		r.values[owner] = ownerValues
+	}
+
+	r.sorted = nil
+	for _, ownerValues := range r.values {
+		r.sorted = append(r.sorted, ownerValues...)
+	}
+	sort.Slice(r.sorted, func(i, j int) bool {
+		return len(r.sorted[i]) > len(r.sorted[j])
+	})
+}
+
+// Redact returns s with all the sensitive values masked.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, value := range r.sorted {
+		s = strings.Replace(s, value, Redacted, -1)
+	}
+	return s
+}
+
+// redactingFormatter wraps a formatter and masks the sensitive values in the
+// message and the fields of the entries.
+type redactingFormatter struct {
+	log.Formatter
+	redactor *Redactor
+}
+
+// Format formats a copy of the entry with the sensitive values masked.
+func (f *redactingFormatter) Format(entry *log.Entry) ([]byte, error) {
+	redacted := *entry
+	redacted.Message = f.redactor.Redact(entry.Message)
+	redacted.Data = make(log.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			value = f.redactor.Redact(v)
+		case error:
+			value = f.redactor.Redact(v.Error())
+		}
+		redacted.Data[key] = value
+	}
+	return f.Formatter.Format(&redacted)
+}
@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor(t *testing.T) {
+	redactor := NewRedactor()
+	redactor.SetValues("cluster-1", []string{"secret", "secret-password", "1"})
+	redactor.SetValues("cluster-2", []string{"other"})
+	require.Equal(t, "<redacted> <redacted> <redacted> 1", redactor.Redact("secret secret-password other 1"))
+
+	redactor.SetValues("cluster-2", nil)
+	require.Equal(t, "<redacted> other", redactor.Redact("secret other"))
+
+	var nilRedactor *Redactor
+	nilRedactor.SetValues("cluster-1", []string{"secret"})
+	require.Equal(t, "secret", nilRedactor.Redact("secret"))
+}
+
+func TestSetupRedactor(t *testing.T) {
+	var output bytes.Buffer
+	logger := log.New()
+	logger.Out = &output
+
+	redactor := NewRedactor()
+	redactor.SetValues("cluster-1", []string{"secret"})
+	err := Setup(logger, Config{Format: FormatJSON, Level: "info", Redactor: redactor})
+	require.NoError(t, err)
+
+	log.NewEntry(logger).WithFields(log.Fields{"value": "secret", "error": fmt.Errorf("invalid secret")}).Info("value secret")
+
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(output.Bytes(), &fields))
+	require.Equal(t, "value <redacted>", fields["msg"])
+	require.Equal(t, "<redacted>", fields["value"])
+	require.Equal(t, "invalid <redacted>", fields["error"])
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+var (
+	mutex sync.RWMutex
+	// maps are the metrics served by the handler. Unlike the maps published
+	// with expvar they don't include the command line, which contains
+	// secrets such as the token.
+	maps = make(map[string]*expvar.Map)
+)
+
+// NewMap returns a new map of metrics which is served under name by the
+// handler. It panics if the name is already used.
+func NewMap(name string) *expvar.Map {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if _, ok := maps[name]; ok {
+		panic(fmt.Sprintf("metrics %s already registered", name))
+	}
+
+	metrics := new(expvar.Map).Init()
+	maps[name] = metrics
+	return metrics
+}
+
+// Handler returns a handler serving the metrics as a JSON object in the
+// format of /debug/vars.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mutex.RLock()
+		defer mutex.RUnlock()
+
+		names := make([]string, 0, len(maps))
+		for name := range maps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, "{\n")
+		for i, name := range names {
+			if i > 0 {
+				fmt.Fprint(w, ",\n")
+			}
+			fmt.Fprintf(w, "%q: %s", name, maps[name].String())
+		}
+		fmt.Fprint(w, "\n}\n")
+	})
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	requests := NewMap("test_requests")
+	requests.Add("ec2.DescribeInstances", 2)
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/vars", nil))
+	require.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+
+	var served map[string]map[string]float64
+	err := json.Unmarshal(recorder.Body.Bytes(), &served)
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[string]float64{"test_requests": {"ec2.DescribeInstances": 2}}, served)
+
+	// the command line published by expvar isn't served
+	require.NotNil(t, expvar.Get("cmdline"))
+	require.NotContains(t, recorder.Body.String(), "cmdline")
+}
+
+func TestNewMapDuplicate(t *testing.T) {
+	NewMap("test_duplicate")
+	require.Panics(t, func() { NewMap("test_duplicate") })
+}
@@ -0,0 +1,337 @@
+package openstack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	orchestrationServiceType = "orchestration"
+	publicInterface          = "public"
+	tokenHeader              = "X-Auth-Token"
+	subjectTokenHeader       = "X-Subject-Token"
+	// tokenExpiryMargin is the time before the expiry of a token when it's
+	// renewed.
+	tokenExpiryMargin = 5 * time.Minute
+	// statusDeleteComplete is the status of deleted stacks, which are still
+	// returned by the API for a while.
+	statusDeleteComplete = "DELETE_COMPLETE"
+)
+
+// Credentials are the Keystone v3 credentials of a user.
+type Credentials struct {
+	AuthURL           string
+	Username          string
+	Password          string
+	UserDomainName    string
+	ProjectDomainName string
+}
+
+// CredentialsFromEnv returns the credentials configured by the usual OS_*
+// environment variables, nil if OS_AUTH_URL isn't set.
+func CredentialsFromEnv() *Credentials {
+	authURL := os.Getenv("OS_AUTH_URL")
+	if authURL == "" {
+		return nil
+	}
+
+	credentials := &Credentials{
+		AuthURL:           strings.TrimSuffix(authURL, "/"),
+		Username:          os.Getenv("OS_USERNAME"),
+		Password:          os.Getenv("OS_PASSWORD"),
+		UserDomainName:    os.Getenv("OS_USER_DOMAIN_NAME"),
+		ProjectDomainName: os.Getenv("OS_PROJECT_DOMAIN_NAME"),
+	}
+	if credentials.UserDomainName == "" {
+		credentials.UserDomainName = "Default"
+	}
+	if credentials.ProjectDomainName == "" {
+		credentials.ProjectDomainName = credentials.UserDomainName
+	}
+	return credentials
+}
+
+// Output is an output of a Heat stack.
+type Output struct {
+	Key   string      `json:"output_key"`
+	Value interface{} `json:"output_value"`
+}
+
+// Stack is a Heat stack.
+type Stack struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"stack_name"`
+	Status       string    `json:"stack_status"`
+	StatusReason string    `json:"stack_status_reason"`
+	Tags         []string  `json:"tags"`
+	Outputs      []*Output `json:"outputs"`
+}
+
+// Output returns the value of the output of the stack as a string, empty if
+// the stack has no such output.
+func (s *Stack) Output(key string) string {
+	for _, output := range s.Outputs {
+		if output.Key == key {
+			if value, ok := output.Value.(string); ok {
+				return value
+			}
+			return fmt.Sprintf("%v", output.Value)
+		}
+	}
+	return ""
+}
+
+// StackInput is the template and parameters a stack is created or updated
+// with.
+type StackInput struct {
+	Name       string            `json:"stack_name,omitempty"`
+	Template   string            `json:"template"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Tags       string            `json:"tags,omitempty"`
+	Timeout    int               `json:"timeout_mins,omitempty"`
+}
+
+// Client is a minimal client for the Heat orchestration API of a project,
+// authenticating with Keystone v3.
+type Client struct {
+	credentials *Credentials
+	projectID   string
+	region      string
+	client      *http.Client
+
+	sync.Mutex
+	token   string
+	expiry  time.Time
+	heatURL string
+}
+
+// NewClient returns a new Client for the stacks of the project in the
+// region.
+func NewClient(credentials *Credentials, projectID, region string, client *http.Client) *Client {
+	return &Client{
+		credentials: credentials,
+		projectID:   projectID,
+		region:      region,
+		client:      client,
+	}
+}
+
+// authenticate returns a valid token and the endpoint of the Heat API from
+// the service catalog, requesting a new token if the current one is about to
+// expire.
+func (c *Client) authenticate(ctx context.Context) (string, string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.token != "" && time.Now().Add(tokenExpiryMargin).Before(c.expiry) {
+		return c.token, c.heatURL, nil
+	}
+
+	var request struct {
+		Auth struct {
+			Identity struct {
+				Methods  []string `json:"methods"`
+				Password struct {
+					User struct {
+						Name     string `json:"name"`
+						Password string `json:"password"`
+						Domain   struct {
+							Name string `json:"name"`
+						} `json:"domain"`
+					} `json:"user"`
+				} `json:"password"`
+			} `json:"identity"`
+			Scope struct {
+				Project struct {
+					ID string `json:"id"`
+				} `json:"project"`
+			} `json:"scope"`
+		} `json:"auth"`
+	}
+	request.Auth.Identity.Methods = []string{"password"}
+	request.Auth.Identity.Password.User.Name = c.credentials.Username
+	request.Auth.Identity.Password.User.Password = c.credentials.Password
+	request.Auth.Identity.Password.User.Domain.Name = c.credentials.UserDomainName
+	request.Auth.Scope.Project.ID = c.projectID
+
+	body, err := json.Marshal(&request)
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.credentials.AuthURL+"/v3/auth/tokens", bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", "", unexpectedStatus(req, resp)
+	}
+
+	var result struct {
+		Token struct {
+			ExpiresAt time.Time `json:"expires_at"`
+			Catalog   []struct {
+				Type      string `json:"type"`
+				Endpoints []struct {
+					Interface string `json:"interface"`
+					Region    string `json:"region"`
+					URL       string `json:"url"`
+				} `json:"endpoints"`
+			} `json:"catalog"`
+		} `json:"token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return "", "", err
+	}
+
+	heatURL := ""
+	for _, service := range result.Token.Catalog {
+		if service.Type != orchestrationServiceType {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface == publicInterface && (c.region == "" || endpoint.Region == c.region) {
+				heatURL = strings.TrimSuffix(endpoint.URL, "/")
+			}
+		}
+	}
+	if heatURL == "" {
+		return "", "", fmt.Errorf("no public orchestration endpoint found in region %s", c.region)
+	}
+
+	c.token = resp.Header.Get(subjectTokenHeader)
+	c.expiry = result.Token.ExpiresAt
+	c.heatURL = heatURL
+	return c.token, c.heatURL, nil
+}
+
+// do makes a request to the Heat API and decodes the JSON response into
+// result if it's not nil. A 404 response is reported as errNotFound.
+func (c *Client) do(ctx context.Context, method, path string, input interface{}, result interface{}) error {
+	token, heatURL, err := c.authenticate(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with %s: %v", c.credentials.AuthURL, err)
+	}
+
+	var body io.Reader
+	if input != nil {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, heatURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(tokenHeader, token)
+	req.Header.Set("Accept", "application/json")
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return unexpectedStatus(req, resp)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// GetStack returns the stack or nil if it doesn't exist or was deleted.
+func (c *Client) GetStack(ctx context.Context, name string) (*Stack, error) {
+	var result struct {
+		Stack *Stack `json:"stack"`
+	}
+	err := c.do(ctx, http.MethodGet, "/stacks/"+url.PathEscape(name), nil, &result)
+	if err != nil {
+		if err == errNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if result.Stack == nil || result.Stack.Status == statusDeleteComplete {
+		return nil, nil
+	}
+	return result.Stack, nil
+}
+
+// ListStacks returns the stacks having all the tags.
+func (c *Client) ListStacks(ctx context.Context, tags []string) ([]*Stack, error) {
+	var result struct {
+		Stacks []*Stack `json:"stacks"`
+	}
+	query := url.Values{"tags": []string{strings.Join(tags, ",")}}
+	err := c.do(ctx, http.MethodGet, "/stacks?"+query.Encode(), nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Stacks, nil
+}
+
+// CreateStack creates a stack.
+func (c *Client) CreateStack(ctx context.Context, input *StackInput) error {
+	return c.do(ctx, http.MethodPost, "/stacks", input, nil)
+}
+
+// UpdateStack updates the stack with a new template and parameters.
+func (c *Client) UpdateStack(ctx context.Context, stack *Stack, input *StackInput) error {
+	update := *input
+	update.Name = ""
+	return c.do(ctx, http.MethodPut, stackPath(stack), &update, nil)
+}
+
+// DeleteStack deletes the stack.
+func (c *Client) DeleteStack(ctx context.Context, stack *Stack) error {
+	err := c.do(ctx, http.MethodDelete, stackPath(stack), nil, nil)
+	if err == errNotFound {
+		return nil
+	}
+	return err
+}
+
+// stackPath returns the path of the stack in the Heat API.
+func stackPath(stack *Stack) string {
+	return "/stacks/" + url.PathEscape(stack.Name) + "/" + url.PathEscape(stack.ID)
+}
+
+var errNotFound = fmt.Errorf("not found")
+
+// unexpectedStatus returns an error describing an unexpected response.
+func unexpectedStatus(req *http.Request, resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s %s: unexpected status code %d: %s", req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,132 @@
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOpenStackServer returns a server emulating Keystone and Heat, keeping
+// the stacks created through it.
+func newOpenStackServer(t *testing.T, stacks map[string]*Stack) (*httptest.Server, *int) {
+	authentications := 0
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		authentications++
+		w.Header().Set(subjectTokenHeader, "token")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": {"expires_at": "%s", "catalog": [
+			{"type": "compute", "endpoints": [{"interface": "public", "region": "dc1", "url": "%s/compute"}]},
+			{"type": "orchestration", "endpoints": [
+				{"interface": "internal", "region": "dc1", "url": "%s/internal"},
+				{"interface": "public", "region": "dc1", "url": "%s/heat/"}
+			]}
+		]}}`, time.Now().Add(time.Hour).Format(time.RFC3339), server.URL, server.URL, server.URL)
+	})
+	mux.HandleFunc("/heat/stacks", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "token", r.Header.Get(tokenHeader))
+		switch r.Method {
+		case http.MethodGet:
+			var result []*Stack
+			for _, stack := range stacks {
+				result = append(result, stack)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"stacks": result})
+		case http.MethodPost:
+			var input StackInput
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+			stacks[input.Name] = &Stack{ID: "id-" + input.Name, Name: input.Name, Status: "CREATE_IN_PROGRESS"}
+			w.WriteHeader(http.StatusCreated)
+		}
+	})
+	mux.HandleFunc("/heat/stacks/", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "token", r.Header.Get(tokenHeader))
+		name := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/heat/stacks/"), "/", 2)[0]
+		stack, ok := stacks[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(map[string]interface{}{"stack": stack})
+		case http.MethodPut:
+			stack.Status = "UPDATE_IN_PROGRESS"
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodDelete:
+			delete(stacks, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	server = httptest.NewServer(mux)
+	return server, &authentications
+}
+
+func TestStacks(t *testing.T) {
+	stacks := map[string]*Stack{
+		"existing": {
+			ID:      "id-existing",
+			Name:    "existing",
+			Status:  "CREATE_COMPLETE",
+			Outputs: []*Output{{Key: "api_server_ip", Value: "10.0.0.1"}, {Key: "port", Value: 443}},
+		},
+		"deleted": {ID: "id-deleted", Name: "deleted", Status: statusDeleteComplete},
+	}
+	server, authentications := newOpenStackServer(t, stacks)
+	defer server.Close()
+
+	client := NewClient(&Credentials{AuthURL: server.URL, Username: "clm", Password: "secret"}, "project", "dc1", http.DefaultClient)
+	ctx := context.Background()
+
+	stack, err := client.GetStack(ctx, "existing")
+	require.NoError(t, err)
+	require.NotNil(t, stack)
+	assert.Equal(t, "10.0.0.1", stack.Output("api_server_ip"))
+	assert.Equal(t, "443", stack.Output("port"))
+	assert.Equal(t, "", stack.Output("missing"))
+
+	stack, err = client.GetStack(ctx, "missing")
+	require.NoError(t, err)
+	require.Nil(t, stack)
+
+	stack, err = client.GetStack(ctx, "deleted")
+	require.NoError(t, err)
+	require.Nil(t, stack)
+
+	require.NoError(t, client.CreateStack(ctx, &StackInput{Name: "new", Template: "{}"}))
+	stack, err = client.GetStack(ctx, "new")
+	require.NoError(t, err)
+	require.NotNil(t, stack)
+
+	require.NoError(t, client.UpdateStack(ctx, stack, &StackInput{Name: "new", Template: "{}"}))
+	assert.Equal(t, "UPDATE_IN_PROGRESS", stacks["new"].Status)
+
+	list, err := client.ListStacks(ctx, []string{"cluster=a"})
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+
+	require.NoError(t, client.DeleteStack(ctx, stack))
+	require.NotContains(t, stacks, "new")
+	require.NoError(t, client.DeleteStack(ctx, stack))
+
+	// the token is reused until it expires
+	assert.Equal(t, 1, *authentications)
+}
+
+func TestMissingEndpoint(t *testing.T) {
+	server, _ := newOpenStackServer(t, map[string]*Stack{})
+	defer server.Close()
+
+	client := NewClient(&Credentials{AuthURL: server.URL}, "project", "dc2", http.DefaultClient)
+	_, err := client.GetStack(context.Background(), "existing")
+	require.Error(t, err)
+}
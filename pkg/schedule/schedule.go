@@ -0,0 +1,190 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// weekdays maps the abbreviated names of the days used in schedules to the
+// days of the week.
+var weekdays = map[string]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+// Schedule is a set of weekly recurring time windows, e.g. the windows in
+// which a cluster is hibernated.
+type Schedule struct {
+	windows []*window
+}
+
+// window is a daily time window on a set of days. Windows ending before they
+// start span midnight and end on the following day.
+type window struct {
+	days     map[time.Weekday]bool
+	start    time.Duration
+	end      time.Duration
+	location *time.Location
+}
+
+// Parse parses a schedule of one or more windows separated by
+// semicolons. A window consists of the days it starts on, the time of day
+// it's active and the timezone, e.g. "Mon-Fri 20:00-06:00 Europe/Berlin" or
+// "Sat,Sun 00:00-24:00 UTC". A window ending before it starts ends on the
+// following day.
+func Parse(schedule string) (*Schedule, error) {
+	result := &Schedule{}
+	for _, definition := range strings.Split(schedule, ";") {
+		definition = strings.TrimSpace(definition)
+		if definition == "" {
+			continue
+		}
+
+		w, err := parseWindow(definition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window '%s': %v", definition, err)
+		}
+		result.windows = append(result.windows, w)
+	}
+
+	if len(result.windows) == 0 {
+		return nil, fmt.Errorf("no windows in schedule '%s'", schedule)
+	}
+	return result, nil
+}
+
+func parseWindow(definition string) (*window, error) {
+	fields := strings.Fields(definition)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("expected <days> <start>-<end> <timezone>")
+	}
+
+	days, err := parseDays(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	times := strings.Split(fields[1], "-")
+	if len(times) != 2 {
+		return nil, fmt.Errorf("expected <start>-<end>, got %s", fields[1])
+	}
+
+	start, err := parseTimeOfDay(times[0])
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseTimeOfDay(times[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if start == end {
+		return nil, fmt.Errorf("window starts and ends at %s", times[0])
+	}
+
+	location, err := time.LoadLocation(fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return &window{
+		days:     days,
+		start:    start,
+		end:      end,
+		location: location,
+	}, nil
+}
+
+// parseDays parses a comma separated list of days or ranges of days, e.g.
+// Mon-Fri or Sat,Sun. Ranges can wrap around the end of the week, e.g.
+// Fri-Mon.
+func parseDays(definition string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, part := range strings.Split(definition, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("invalid range of days %s", part)
+		}
+
+		first, ok := weekdays[bounds[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %s", bounds[0])
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			last, ok = weekdays[bounds[1]]
+			if !ok {
+				return nil, fmt.Errorf("unknown day %s", bounds[1])
+			}
+		}
+
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseTimeOfDay parses a time of day in the format hh:mm as the duration
+// since midnight. 24:00 is the end of the day.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %s, expected hh:mm", value)
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %s, expected hh:mm", value)
+	}
+
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("invalid time %s, expected hh:mm", value)
+	}
+
+	if hours < 0 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time %s, expected hh:mm", value)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// Active returns true if the time is within one of the windows of the
+// schedule.
+func (s *Schedule) Active(t time.Time) bool {
+	for _, w := range s.windows {
+		if w.active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *window) active(t time.Time) bool {
+	local := t.In(w.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, w.location)
+	timeOfDay := local.Sub(midnight)
+
+	if w.start < w.end {
+		return w.days[local.Weekday()] && timeOfDay >= w.start && timeOfDay < w.end
+	}
+
+	// the window spans midnight, it's either active since the start on
+	// the current day or since the start on the previous day.
+	if w.days[local.Weekday()] && timeOfDay >= w.start {
+		return true
+	}
+	return w.days[(local.Weekday()+6)%7] && timeOfDay < w.end
+}
@@ -0,0 +1,67 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for _, schedule := range []string{
+		"Mon-Fri 20:00-06:00 Europe/Berlin",
+		"Sat,Sun 00:00-24:00 UTC",
+		"Mon-Fri 20:00-06:00 Europe/Berlin; Sat,Sun 00:00-24:00 Europe/Berlin",
+		"Fri-Mon 09:30-17:45 UTC",
+	} {
+		_, err := Parse(schedule)
+		require.NoError(t, err, schedule)
+	}
+
+	for _, schedule := range []string{
+		"",
+		"Mon-Fri 20:00-06:00",
+		"Monday 20:00-06:00 UTC",
+		"Mon-Fri-Sat 20:00-06:00 UTC",
+		"Mon-Fri 20:00 UTC",
+		"Mon-Fri 25:00-06:00 UTC",
+		"Mon-Fri 20:60-06:00 UTC",
+		"Mon-Fri 24:30-06:00 UTC",
+		"Mon-Fri 20:00-20:00 UTC",
+		"Mon-Fri 20:00-06:00 Europe/Nowhere",
+	} {
+		_, err := Parse(schedule)
+		require.Error(t, err, schedule)
+	}
+}
+
+func TestScheduleActive(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	schedule, err := Parse("Mon-Fri 20:00-06:00 Europe/Berlin; Sat,Sun 00:00-24:00 Europe/Berlin")
+	require.NoError(t, err)
+
+	for _, ti := range []struct {
+		time   time.Time
+		active bool
+	}{
+		// Monday
+		{time: time.Date(2019, 11, 18, 12, 0, 0, 0, berlin), active: false},
+		{time: time.Date(2019, 11, 18, 19, 59, 0, 0, berlin), active: false},
+		{time: time.Date(2019, 11, 18, 20, 0, 0, 0, berlin), active: true},
+		// Tuesday, window started on Monday
+		{time: time.Date(2019, 11, 19, 5, 59, 0, 0, berlin), active: true},
+		{time: time.Date(2019, 11, 19, 6, 0, 0, 0, berlin), active: false},
+		// the same time in UTC
+		{time: time.Date(2019, 11, 19, 4, 59, 0, 0, time.UTC), active: true},
+		{time: time.Date(2019, 11, 19, 5, 0, 0, 0, time.UTC), active: false},
+		// Saturday and Sunday
+		{time: time.Date(2019, 11, 23, 12, 0, 0, 0, berlin), active: true},
+		{time: time.Date(2019, 11, 24, 23, 59, 0, 0, berlin), active: true},
+		// Monday morning, the Sunday window ended at midnight
+		{time: time.Date(2019, 11, 25, 3, 0, 0, 0, berlin), active: false},
+	} {
+		require.Equal(t, ti.active, schedule.Active(ti.time), ti.time.String())
+	}
+}
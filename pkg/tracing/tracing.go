@@ -0,0 +1,221 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	tracesPath       = "/v1/traces"
+	exportTimeout    = 10 * time.Second
+	spanKindInternal = 1
+	statusCodeOK     = 1
+	statusCodeError  = 2
+)
+
+type contextKey struct{}
+
+// Tracer records the spans of operations and exports them to an OTLP/HTTP
+// endpoint once the root span of a trace ends. A nil Tracer records nothing.
+type Tracer struct {
+	endpoint string
+	service  string
+	client   *http.Client
+}
+
+// NewTracer initializes a new Tracer exporting the traces of the service to
+// the OTLP/HTTP endpoint, e.g. http://otel-collector:4318.
+func NewTracer(endpoint, service string) *Tracer {
+	return &Tracer{
+		endpoint: strings.TrimSuffix(endpoint, "/") + tracesPath,
+		service:  service,
+		client:   &http.Client{Timeout: exportTimeout},
+	}
+}
+
+// Span is a timed operation within a trace. All methods of a nil Span are
+// no-ops so callers don't have to check whether tracing is enabled.
+type Span struct {
+	trace      *trace
+	id         string
+	parentID   string
+	name       string
+	attributes map[string]string
+	start      time.Time
+	end        time.Time
+	err        error
+}
+
+// trace collects the ended spans of a trace until its root span ends.
+type trace struct {
+	tracer *Tracer
+	id     string
+
+	sync.Mutex
+	spans []*Span
+}
+
+// Start starts the root span of a new trace and returns a context carrying
+// it.
+func (t *Tracer) Start(ctx context.Context, name string, attributes map[string]string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := newSpan(&trace{tracer: t, id: randomID(16)}, "", name, attributes)
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+// StartSpan starts a child of the span carried by the context and returns a
+// context carrying the child. If the context doesn't carry a span nothing is
+// recorded.
+func StartSpan(ctx context.Context, name string, attributes map[string]string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	span := newSpan(parent.trace, parent.id, name, attributes)
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+// FromContext returns the span carried by the context or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
+
+func newSpan(trace *trace, parentID, name string, attributes map[string]string) *Span {
+	attrs := make(map[string]string, len(attributes))
+	for key, value := range attributes {
+		attrs[key] = value
+	}
+
+	return &Span{
+		trace:      trace,
+		id:         randomID(8),
+		parentID:   parentID,
+		name:       name,
+		attributes: attrs,
+		start:      time.Now(),
+	}
+}
+
+// SetAttribute sets an attribute of the span.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.trace.Lock()
+	defer s.trace.Unlock()
+	s.attributes[key] = value
+}
+
+// End ends the span, marking it as failed if err is not nil. Ending the root
+// span exports the trace.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.trace.Lock()
+	s.end = time.Now()
+	s.err = err
+	s.trace.spans = append(s.trace.spans, s)
+	s.trace.Unlock()
+
+	if s.parentID != "" {
+		return
+	}
+
+	exportErr := s.trace.export()
+	if exportErr != nil {
+		log.Errorf("Failed to export trace %s: %v", s.trace.id, exportErr)
+	}
+}
+
+// export sends the ended spans of the trace to the OTLP endpoint.
+func (t *trace) export() error {
+	t.Lock()
+	spans := make([]otlpSpan, 0, len(t.spans))
+	for _, span := range t.spans {
+		spans = append(spans, span.otlp())
+	}
+	t.Unlock()
+
+	request := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: otlpAttributes(map[string]string{"service.name": t.tracer.service}),
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: t.tracer.service},
+						Spans: spans,
+					},
+				},
+			},
+		},
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.tracer.client.Post(t.tracer.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// otlp converts the span to its OTLP JSON representation.
+func (s *Span) otlp() otlpSpan {
+	status := otlpStatus{Code: statusCodeOK}
+	if s.err != nil {
+		status = otlpStatus{Code: statusCodeError, Message: s.err.Error()}
+	}
+
+	return otlpSpan{
+		TraceID:           s.trace.id,
+		SpanID:            s.id,
+		ParentSpanID:      s.parentID,
+		Name:              s.name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        otlpAttributes(s.attributes),
+		Status:            status,
+	}
+}
+
+// randomID returns a random hex encoded ID of n bytes.
+func randomID(n int) string {
+	id := make([]byte, n)
+	_, err := rand.Read(id)
+	if err != nil {
+		// crypto/rand only fails if the system's entropy source is
+		// broken, fall back to a time based ID.
+		return fmt.Sprintf("%0*x", n*2, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer(t *testing.T) {
+	requests := make(chan otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, tracesPath, r.URL.Path)
+
+		var request otlpRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests <- request
+	}))
+	defer server.Close()
+
+	tracer := NewTracer(server.URL, "cluster-lifecycle-manager")
+
+	ctx, root := tracer.Start(context.Background(), "provision", map[string]string{"cluster_id": "kube-1"})
+	stepCtx, step := StartSpan(ctx, "node-pool-update", nil)
+	_, call := StartSpan(stepCtx, "cloudformation", map[string]string{"stack": "kube-1"})
+	call.End(errors.New("failed"))
+	step.End(nil)
+	root.End(nil)
+
+	request := <-requests
+	require.Len(t, request.ResourceSpans, 1)
+	require.Equal(t, []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: "cluster-lifecycle-manager"}}}, request.ResourceSpans[0].Resource.Attributes)
+
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 3)
+	for _, span := range spans {
+		require.Equal(t, spans[2].TraceID, span.TraceID)
+	}
+	require.Equal(t, "cloudformation", spans[0].Name)
+	require.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	require.Equal(t, otlpStatus{Code: statusCodeError, Message: "failed"}, spans[0].Status)
+	require.Equal(t, "node-pool-update", spans[1].Name)
+	require.Equal(t, spans[2].SpanID, spans[1].ParentSpanID)
+	require.Equal(t, "provision", spans[2].Name)
+	require.Empty(t, spans[2].ParentSpanID)
+	require.Equal(t, []otlpAttribute{{Key: "cluster_id", Value: otlpValue{StringValue: "kube-1"}}}, spans[2].Attributes)
+}
+
+func TestDisabledTracer(t *testing.T) {
+	var tracer *Tracer
+
+	ctx, root := tracer.Start(context.Background(), "provision", nil)
+	require.Nil(t, root)
+
+	_, span := StartSpan(ctx, "manifests", nil)
+	require.Nil(t, span)
+
+	// nil spans can be used like any other span
+	span.SetAttribute("manifest", "kube-system/coredns")
+	span.End(nil)
+	root.End(nil)
+}
@@ -7,8 +7,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
@@ -16,6 +18,8 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/elb"
 	"github.com/aws/aws-sdk-go/service/elb/elbiface"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
 	"github.com/cenkalti/backoff"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 )
@@ -30,6 +34,9 @@ const (
 	instanceIdFilter            = "instance-id"
 	instanceHealthStatusHealthy = "Healthy"
 	ec2AutoscalingGroupTagKey   = "aws:autoscaling:groupName"
+	nodePoolConfigHashTagKey    = "kubernetes.io/node-pool/config-hash"
+	terminationHookName         = "cluster-lifecycle-manager-drain"
+	lifecycleActionContinue     = "CONTINUE"
 )
 
 const (
@@ -39,20 +46,28 @@ const (
 
 // ASGNodePoolsBackend defines a node pool backed by an AWS Auto Scaling Group.
 type ASGNodePoolsBackend struct {
-	asgClient autoscalingiface.AutoScalingAPI
-	ec2Client ec2iface.EC2API
-	elbClient elbiface.ELBAPI
-	clusterID string
+	asgClient   autoscalingiface.AutoScalingAPI
+	ec2Client   ec2iface.EC2API
+	elbClient   elbiface.ELBAPI
+	elbv2Client elbv2iface.ELBV2API
+	clusterID   string
+	// deregistrationTimeout limits how long Terminate waits for the load
+	// balancers of the ASG to drain the connections of an instance.
+	deregistrationTimeout time.Duration
 }
 
-// NewASGNodePoolsBackend initializes a new ASGNodePoolsBackend for the given clusterID and AWS
-// session and.
-func NewASGNodePoolsBackend(clusterID string, sess *session.Session) *ASGNodePoolsBackend {
+// NewASGNodePoolsBackend initializes a new ASGNodePoolsBackend for the given
+// clusterID and AWS session. Instances are deregistered from the load
+// balancers of their ASG before they're terminated, a deregistrationTimeout
+// of 0 disables it.
+func NewASGNodePoolsBackend(clusterID string, sess *session.Session, deregistrationTimeout time.Duration) *ASGNodePoolsBackend {
 	return &ASGNodePoolsBackend{
-		asgClient: autoscaling.New(sess),
-		ec2Client: ec2.New(sess),
-		elbClient: elb.New(sess),
-		clusterID: clusterID,
+		asgClient:             autoscaling.New(sess),
+		ec2Client:             ec2.New(sess),
+		elbClient:             elb.New(sess),
+		elbv2Client:           elbv2.New(sess),
+		clusterID:             clusterID,
+		deregistrationTimeout: deregistrationTimeout,
 	}
 }
 
@@ -67,6 +82,7 @@ func (n *ASGNodePoolsBackend) Get(nodePool *api.NodePool) (*NodePool, error) {
 	}
 
 	nodes := make([]*Node, 0)
+	launchConfigurations := make([]string, 0, len(asgs))
 	minSize := 0
 	maxSize := 0
 	desiredCapacity := 0
@@ -74,8 +90,9 @@ func (n *ASGNodePoolsBackend) Get(nodePool *api.NodePool) (*NodePool, error) {
 		minSize += int(aws.Int64Value(asg.MinSize))
 		maxSize += int(aws.Int64Value(asg.MaxSize))
 		desiredCapacity += int(aws.Int64Value(asg.DesiredCapacity))
+		launchConfigurations = append(launchConfigurations, aws.StringValue(asg.LaunchConfigurationName))
 
-		oldInstances, err := n.getInstancesToUpdate(asg)
+		oldInstances, launchConfigHashes, err := n.getInstancesToUpdate(asg)
 		if err != nil {
 			return nil, err
 		}
@@ -87,13 +104,17 @@ func (n *ASGNodePoolsBackend) Get(nodePool *api.NodePool) (*NodePool, error) {
 
 		// TODO: also lookup target groups for ALBs attached to the ASG (for Ingress)
 
+		configHash := asgTagValue(asg, nodePoolConfigHashTagKey)
+
 		for _, instance := range asg.Instances {
 			instanceID := aws.StringValue(instance.InstanceId)
 			node := &Node{
-				ProviderID:    fmt.Sprintf("aws:///%s/%s", aws.StringValue(instance.AvailabilityZone), instanceID),
-				FailureDomain: aws.StringValue(instance.AvailabilityZone),
-				Generation:    currentNodeGeneration,
-				Ready:         aws.StringValue(instance.HealthStatus) == instanceHealthStatusHealthy && aws.StringValue(instance.LifecycleState) == autoscaling.LifecycleStateInService,
+				ProviderID:       fmt.Sprintf("aws:///%s/%s", aws.StringValue(instance.AvailabilityZone), instanceID),
+				FailureDomain:    aws.StringValue(instance.AvailabilityZone),
+				Generation:       currentNodeGeneration,
+				ConfigHash:       configHash,
+				LaunchConfigHash: launchConfigHashes[instanceID],
+				Ready:            aws.StringValue(instance.HealthStatus) == instanceHealthStatusHealthy && aws.StringValue(instance.LifecycleState) == autoscaling.LifecycleStateInService,
 			}
 
 			if oldInstances[instanceID] {
@@ -111,13 +132,16 @@ func (n *ASGNodePoolsBackend) Get(nodePool *api.NodePool) (*NodePool, error) {
 		}
 	}
 
+	sort.Strings(launchConfigurations)
+
 	return &NodePool{
-		Min:        minSize,
-		Max:        maxSize,
-		Desired:    desiredCapacity,
-		Current:    len(nodes),
-		Generation: currentNodeGeneration,
-		Nodes:      nodes,
+		Min:           minSize,
+		Max:           maxSize,
+		Desired:       desiredCapacity,
+		Current:       len(nodes),
+		Generation:    currentNodeGeneration,
+		Configuration: strings.Join(launchConfigurations, ","),
+		Nodes:         nodes,
 	}, nil
 }
 
@@ -246,40 +270,23 @@ func (n *ASGNodePoolsBackend) deleteTags(nodePool *api.NodePool, tags map[string
 func (n *ASGNodePoolsBackend) Terminate(node *Node, decrementDesired bool) error {
 	instanceId := instanceIDFromProviderID(node.ProviderID, node.FailureDomain)
 
-	// if desired should be decremented check if we also need to decrement
-	// the minSize of the ASG.
-	if decrementDesired {
-		// lookup ASG name in the EC2 tags of the instance
-		var asgName string
-		params := &ec2.DescribeTagsInput{
-			Filters: []*ec2.Filter{
-				{
-					Name:   aws.String("resource-id"),
-					Values: []*string{aws.String(instanceId)},
-				},
-				{
-					Name:   aws.String("key"),
-					Values: []*string{aws.String(ec2AutoscalingGroupTagKey)},
-				},
-			},
-		}
-		err := n.ec2Client.DescribeTagsPages(params, func(resp *ec2.DescribeTagsOutput, lastPage bool) bool {
-			for _, tag := range resp.Tags {
-				if aws.StringValue(tag.Key) == ec2AutoscalingGroupTagKey {
-					asgName = aws.StringValue(tag.Value)
-					return false
-				}
-			}
-			return true
-		})
+	var asgName string
+	if decrementDesired || n.deregistrationTimeout > 0 {
+		var err error
+		asgName, err = n.instanceASGName(instanceId)
 		if err != nil {
 			return err
 		}
+	}
 
-		if asgName == "" {
-			return fmt.Errorf("failed to get Autoscaling Group name from EC2 tags of instance '%s'", instanceId)
-		}
+	err := n.deregisterFromLoadBalancers(instanceId, asgName)
+	if err != nil {
+		return err
+	}
 
+	// if desired should be decremented check if we also need to decrement
+	// the minSize of the ASG.
+	if decrementDesired {
 		// get current sizes in the ASG
 		asgParams := &autoscaling.DescribeAutoScalingGroupsInput{
 			AutoScalingGroupNames: []*string{aws.String(asgName)},
@@ -318,7 +325,7 @@ func (n *ASGNodePoolsBackend) Terminate(node *Node, decrementDesired bool) error
 		ShouldDecrementDesiredCapacity: aws.Bool(decrementDesired),
 	}
 
-	_, err := n.asgClient.TerminateInstanceInAutoScalingGroup(params)
+	_, err = n.asgClient.TerminateInstanceInAutoScalingGroup(params)
 	if err != nil {
 		_, serr := n.instanceState(instanceId)
 		if serr != nil {
@@ -338,6 +345,14 @@ func (n *ASGNodePoolsBackend) Terminate(node *Node, decrementDesired bool) error
 			return errors.New("instance shutting down")
 		case ec2.InstanceStateNameTerminated, ec2.InstanceStateNameStopped:
 			return nil
+		case ec2.InstanceStateNameRunning:
+			// the node is already drained so there is no
+			// need to wait for the termination hook.
+			err := n.completeTermination(instanceId)
+			if err != nil {
+				return backoff.Permanent(err)
+			}
+			return fmt.Errorf("unexpected instance state '%s'", state)
 		default:
 			return fmt.Errorf("unexpected instance state '%s'", state)
 		}
@@ -347,6 +362,153 @@ func (n *ASGNodePoolsBackend) Terminate(node *Node, decrementDesired bool) error
 	return backoff.Retry(instanceState, backoffCfg)
 }
 
+// instanceASGName looks up the name of the ASG of the instance in its EC2
+// tags.
+func (n *ASGNodePoolsBackend) instanceASGName(instanceId string) (string, error) {
+	var asgName string
+	params := &ec2.DescribeTagsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("resource-id"),
+				Values: []*string{aws.String(instanceId)},
+			},
+			{
+				Name:   aws.String("key"),
+				Values: []*string{aws.String(ec2AutoscalingGroupTagKey)},
+			},
+		},
+	}
+	err := n.ec2Client.DescribeTagsPages(params, func(resp *ec2.DescribeTagsOutput, lastPage bool) bool {
+		for _, tag := range resp.Tags {
+			if aws.StringValue(tag.Key) == ec2AutoscalingGroupTagKey {
+				asgName = aws.StringValue(tag.Value)
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if asgName == "" {
+		return "", fmt.Errorf("failed to get Autoscaling Group name from EC2 tags of instance '%s'", instanceId)
+	}
+	return asgName, nil
+}
+
+// EnsureTerminationHook adds a lifecycle hook to the ASGs of the node pool
+// which holds back terminating instances until they're drained or the timeout
+// expires. A timeout of 0 removes the hook.
+func (n *ASGNodePoolsBackend) EnsureTerminationHook(nodePool *api.NodePool, timeout time.Duration) error {
+	asgs, err := n.getNodePoolASGs(nodePool)
+	if err != nil {
+		return err
+	}
+
+	for _, asg := range asgs {
+		hooks, err := n.asgClient.DescribeLifecycleHooks(&autoscaling.DescribeLifecycleHooksInput{
+			AutoScalingGroupName: asg.AutoScalingGroupName,
+			LifecycleHookNames:   []*string{aws.String(terminationHookName)},
+		})
+		if err != nil {
+			return err
+		}
+
+		if timeout == 0 {
+			if len(hooks.LifecycleHooks) > 0 {
+				_, err = n.asgClient.DeleteLifecycleHook(&autoscaling.DeleteLifecycleHookInput{
+					AutoScalingGroupName: asg.AutoScalingGroupName,
+					LifecycleHookName:    aws.String(terminationHookName),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		seconds := int64(timeout.Seconds())
+		if len(hooks.LifecycleHooks) > 0 && aws.Int64Value(hooks.LifecycleHooks[0].HeartbeatTimeout) == seconds {
+			continue
+		}
+
+		_, err = n.asgClient.PutLifecycleHook(&autoscaling.PutLifecycleHookInput{
+			AutoScalingGroupName: asg.AutoScalingGroupName,
+			LifecycleHookName:    aws.String(terminationHookName),
+			LifecycleTransition:  aws.String("autoscaling:EC2_INSTANCE_TERMINATING"),
+			HeartbeatTimeout:     aws.Int64(seconds),
+			DefaultResult:        aws.String(lifecycleActionContinue),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TerminatingNodes returns the nodes of the node pool which are held back by
+// the termination hook.
+func (n *ASGNodePoolsBackend) TerminatingNodes(nodePool *api.NodePool) ([]*Node, error) {
+	asgs, err := n.getNodePoolASGs(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*Node, 0)
+	for _, asg := range asgs {
+		for _, instance := range asg.Instances {
+			if aws.StringValue(instance.LifecycleState) != autoscaling.LifecycleStateTerminatingWait {
+				continue
+			}
+
+			nodes = append(nodes, &Node{
+				ProviderID:    fmt.Sprintf("aws:///%s/%s", aws.StringValue(instance.AvailabilityZone), aws.StringValue(instance.InstanceId)),
+				FailureDomain: aws.StringValue(instance.AvailabilityZone),
+			})
+		}
+	}
+	return nodes, nil
+}
+
+// CompleteTermination lets the termination of a node held back by the
+// termination hook continue.
+func (n *ASGNodePoolsBackend) CompleteTermination(node *Node) error {
+	return n.completeTermination(instanceIDFromProviderID(node.ProviderID, node.FailureDomain))
+}
+
+// completeTermination completes the termination hook of the instance if the
+// instance is waiting for it.
+func (n *ASGNodePoolsBackend) completeTermination(instanceId string) error {
+	resp, err := n.asgClient.DescribeAutoScalingInstances(&autoscaling.DescribeAutoScalingInstancesInput{
+		InstanceIds: []*string{aws.String(instanceId)},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range resp.AutoScalingInstances {
+		if aws.StringValue(instance.LifecycleState) != autoscaling.LifecycleStateTerminatingWait {
+			continue
+		}
+
+		_, err := n.asgClient.CompleteLifecycleAction(&autoscaling.CompleteLifecycleActionInput{
+			AutoScalingGroupName:  instance.AutoScalingGroupName,
+			LifecycleHookName:     aws.String(terminationHookName),
+			InstanceId:            instance.InstanceId,
+			LifecycleActionResult: aws.String(lifecycleActionContinue),
+		})
+		if err != nil {
+			// the instance isn't held back by our hook
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "ValidationError" {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
 // instanceState returns the current state of the instance e.g. 'terminated'.
 // If no state is found it's assumed to be 'terminated'.
 func (n *ASGNodePoolsBackend) instanceState(instanceId string) (string, error) {
@@ -432,21 +594,23 @@ func (n *ASGNodePoolsBackend) getLaunchConfiguration(asg *autoscaling.Group) (*a
 	return lc, nil
 }
 
-// getInstancesToUpdate returns a list of instances with outdated userData.
-func (n *ASGNodePoolsBackend) getInstancesToUpdate(asg *autoscaling.Group) (map[string]bool, error) {
+// getInstancesToUpdate returns a list of instances with outdated userData
+// and the node pool config hashes the instances were launched with.
+func (n *ASGNodePoolsBackend) getInstancesToUpdate(asg *autoscaling.Group) (map[string]bool, map[string]string, error) {
 	// return early if the ASG is empty
 	if len(asg.Instances) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	launchConfig, err := n.getLaunchConfiguration(asg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	oldInstances := make(map[string]bool)
 
 	instancesAMIs := make(map[string]string)
+	configHashes := make(map[string]string)
 
 	instanceIds := make([]*string, 0, len(asg.Instances))
 	for _, instance := range asg.Instances {
@@ -461,12 +625,17 @@ func (n *ASGNodePoolsBackend) getInstancesToUpdate(asg *autoscaling.Group) (map[
 		for _, reservation := range resp.Reservations {
 			for _, instance := range reservation.Instances {
 				instancesAMIs[aws.StringValue(instance.InstanceId)] = aws.StringValue(instance.ImageId)
+				for _, tag := range instance.Tags {
+					if aws.StringValue(tag.Key) == nodePoolConfigHashTagKey {
+						configHashes[aws.StringValue(instance.InstanceId)] = aws.StringValue(tag.Value)
+					}
+				}
 			}
 		}
 		return true
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	for _, instance := range asg.Instances {
@@ -476,13 +645,13 @@ func (n *ASGNodePoolsBackend) getInstancesToUpdate(asg *autoscaling.Group) (map[
 		}
 		userDataResp, err := n.ec2Client.DescribeInstanceAttribute(params)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		params.Attribute = aws.String(instanceTypeAttribute)
 		instanceTypeResp, err := n.ec2Client.DescribeInstanceAttribute(params)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		var instanceSpotPrice *string
@@ -495,7 +664,7 @@ func (n *ASGNodePoolsBackend) getInstancesToUpdate(asg *autoscaling.Group) (map[
 			},
 		})
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if len(spotPriceResp.SpotInstanceRequests) != 0 {
 			instanceSpotPrice = spotPriceResp.SpotInstanceRequests[0].SpotPrice
@@ -503,7 +672,7 @@ func (n *ASGNodePoolsBackend) getInstancesToUpdate(asg *autoscaling.Group) (map[
 
 		spotPricesMatch, err := compareSpotPrices(launchConfig.SpotPrice, instanceSpotPrice)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		// an instance is considered old when userdata, instance type
@@ -517,7 +686,7 @@ func (n *ASGNodePoolsBackend) getInstancesToUpdate(asg *autoscaling.Group) (map[
 		}
 	}
 
-	return oldInstances, nil
+	return oldInstances, configHashes, nil
 }
 
 func parseSpotPrice(spotPrice *string) (float64, error) {
@@ -601,6 +770,17 @@ func (n *ASGNodePoolsBackend) getLoadBalancerAttachedInstancesReadiness(asg *aut
 	return instanceReadiness, nil
 }
 
+// asgTagValue returns the value of the tag of the ASG or an empty string if
+// the ASG doesn't have the tag.
+func asgTagValue(asg *autoscaling.Group, key string) string {
+	for _, tag := range asg.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	return ""
+}
+
 // asgHasAllTags returns true if the asg tags matches the expected tags.
 // autoscaling tag keys are unique
 func asgHasAllTags(expected, tags []*autoscaling.TagDescription) bool {
@@ -3,6 +3,7 @@ package updatestrategy
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 
@@ -18,10 +19,39 @@ import (
 
 type mockASGAPI struct {
 	autoscalingiface.AutoScalingAPI
-	err    error
-	asgs   []*autoscaling.Group
-	descLC *autoscaling.DescribeLaunchConfigurationsOutput
-	descLB *autoscaling.DescribeLoadBalancersOutput
+	err          error
+	asgs         []*autoscaling.Group
+	descLC       *autoscaling.DescribeLaunchConfigurationsOutput
+	descLB       *autoscaling.DescribeLoadBalancersOutput
+	descTG       *autoscaling.DescribeLoadBalancerTargetGroupsOutput
+	hooks        []*autoscaling.LifecycleHook
+	putHook      *autoscaling.PutLifecycleHookInput
+	hookDeleted  bool
+	asgInstances []*autoscaling.InstanceDetails
+	completed    []string
+}
+
+func (a *mockASGAPI) DescribeLifecycleHooks(input *autoscaling.DescribeLifecycleHooksInput) (*autoscaling.DescribeLifecycleHooksOutput, error) {
+	return &autoscaling.DescribeLifecycleHooksOutput{LifecycleHooks: a.hooks}, a.err
+}
+
+func (a *mockASGAPI) PutLifecycleHook(input *autoscaling.PutLifecycleHookInput) (*autoscaling.PutLifecycleHookOutput, error) {
+	a.putHook = input
+	return &autoscaling.PutLifecycleHookOutput{}, a.err
+}
+
+func (a *mockASGAPI) DeleteLifecycleHook(input *autoscaling.DeleteLifecycleHookInput) (*autoscaling.DeleteLifecycleHookOutput, error) {
+	a.hookDeleted = true
+	return &autoscaling.DeleteLifecycleHookOutput{}, a.err
+}
+
+func (a *mockASGAPI) DescribeAutoScalingInstances(input *autoscaling.DescribeAutoScalingInstancesInput) (*autoscaling.DescribeAutoScalingInstancesOutput, error) {
+	return &autoscaling.DescribeAutoScalingInstancesOutput{AutoScalingInstances: a.asgInstances}, a.err
+}
+
+func (a *mockASGAPI) CompleteLifecycleAction(input *autoscaling.CompleteLifecycleActionInput) (*autoscaling.CompleteLifecycleActionOutput, error) {
+	a.completed = append(a.completed, aws.StringValue(input.InstanceId))
+	return &autoscaling.CompleteLifecycleActionOutput{}, a.err
 }
 
 func (a *mockASGAPI) DescribeAutoScalingGroupsPages(input *autoscaling.DescribeAutoScalingGroupsInput, fn func(*autoscaling.DescribeAutoScalingGroupsOutput, bool) bool) error {
@@ -49,6 +79,10 @@ func (a *mockASGAPI) DescribeLoadBalancers(input *autoscaling.DescribeLoadBalanc
 	return a.descLB, a.err
 }
 
+func (a *mockASGAPI) DescribeLoadBalancerTargetGroups(input *autoscaling.DescribeLoadBalancerTargetGroupsInput) (*autoscaling.DescribeLoadBalancerTargetGroupsOutput, error) {
+	return a.descTG, a.err
+}
+
 func (a *mockASGAPI) DeleteTags(input *autoscaling.DeleteTagsInput) (*autoscaling.DeleteTagsOutput, error) {
 	return nil, a.err
 }
@@ -93,6 +127,7 @@ type mockELBAPI struct {
 	err                error
 	descLBs            *elb.DescribeLoadBalancersOutput
 	descInstanceHealth *elb.DescribeInstanceHealthOutput
+	deregistered       []string
 }
 
 func (e *mockELBAPI) DescribeLoadBalancers(input *elb.DescribeLoadBalancersInput) (*elb.DescribeLoadBalancersOutput, error) {
@@ -103,6 +138,11 @@ func (e *mockELBAPI) DescribeInstanceHealth(input *elb.DescribeInstanceHealthInp
 	return e.descInstanceHealth, e.err
 }
 
+func (e *mockELBAPI) DeregisterInstancesFromLoadBalancer(input *elb.DeregisterInstancesFromLoadBalancerInput) (*elb.DeregisterInstancesFromLoadBalancerOutput, error) {
+	e.deregistered = append(e.deregistered, aws.StringValue(input.LoadBalancerName))
+	return &elb.DeregisterInstancesFromLoadBalancerOutput{}, e.err
+}
+
 func TestGet(tt *testing.T) {
 	for _, tc := range []struct {
 		msg       string
@@ -481,6 +521,64 @@ func TestTerminate(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestTerminationHook(t *testing.T) {
+	asgClient := &mockASGAPI{
+		asgs: []*autoscaling.Group{
+			{
+				AutoScalingGroupName: aws.String("asg-name"),
+				Tags: []*autoscaling.TagDescription{
+					{Key: aws.String(clusterIDTagPrefix), Value: aws.String(resourceLifecycleOwned)},
+					{Key: aws.String(nodePoolTag), Value: aws.String("test")},
+				},
+				Instances: []*autoscaling.Instance{
+					{
+						InstanceId:       aws.String("i-1"),
+						AvailabilityZone: aws.String("eu-central-1a"),
+						LifecycleState:   aws.String(autoscaling.LifecycleStateInService),
+					},
+					{
+						InstanceId:       aws.String("i-2"),
+						AvailabilityZone: aws.String("eu-central-1b"),
+						LifecycleState:   aws.String(autoscaling.LifecycleStateTerminatingWait),
+					},
+				},
+			},
+		},
+		asgInstances: []*autoscaling.InstanceDetails{
+			{
+				AutoScalingGroupName: aws.String("asg-name"),
+				InstanceId:           aws.String("i-2"),
+				LifecycleState:       aws.String(autoscaling.LifecycleStateTerminatingWait),
+			},
+		},
+	}
+	backend := &ASGNodePoolsBackend{asgClient: asgClient}
+	nodePool := &api.NodePool{Name: "test"}
+
+	err := backend.EnsureTerminationHook(nodePool, 10*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(600), aws.Int64Value(asgClient.putHook.HeartbeatTimeout))
+
+	// unchanged hooks aren't updated
+	asgClient.putHook = nil
+	asgClient.hooks = []*autoscaling.LifecycleHook{{HeartbeatTimeout: aws.Int64(600)}}
+	err = backend.EnsureTerminationHook(nodePool, 10*time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, asgClient.putHook)
+
+	err = backend.EnsureTerminationHook(nodePool, 0)
+	assert.NoError(t, err)
+	assert.True(t, asgClient.hookDeleted)
+
+	nodes, err := backend.TerminatingNodes(nodePool)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Node{{ProviderID: "aws:///eu-central-1b/i-2", FailureDomain: "eu-central-1b"}}, nodes)
+
+	err = backend.CompleteTermination(nodes[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"i-2"}, asgClient.completed)
+}
+
 func TestAsgHasAllTags(t *testing.T) {
 	expected := []*autoscaling.TagDescription{
 		{Key: aws.String("key-1"), Value: aws.String("value-1")},
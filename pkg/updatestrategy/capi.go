@@ -0,0 +1,364 @@
+package updatestrategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// CAPIMachineDeploymentConfigItem is the node pool config item naming
+	// the MachineDeployment of a node pool, by default
+	// <cluster>-<node pool>.
+	CAPIMachineDeploymentConfigItem = "capi_machine_deployment"
+
+	capiGroup                    = "cluster.x-k8s.io"
+	capiVersion                  = "v1beta1"
+	capiDeploymentNameLabel      = "cluster.x-k8s.io/deployment-name"
+	capiTemplateHashLabel        = "machine-template-hash"
+	capiRevisionAnnotation       = "machinedeployment.clusters.x-k8s.io/revision"
+	capiDeleteMachineAnnotation  = "cluster.x-k8s.io/delete-machine"
+	capiExcludeDrainAnnotation   = "machine.cluster.x-k8s.io/exclude-node-draining"
+	capiAutoscalerMinAnnotation  = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"
+	capiAutoscalerMaxAnnotation  = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+	capiOnDeleteStrategy         = "OnDelete"
+	capiMachinePhaseRunning      = "Running"
+	capiMachineDeploymentsPlural = "machinedeployments"
+	capiMachineSetsPlural        = "machinesets"
+	capiMachinesPlural           = "machines"
+)
+
+// capiResourceClient is the part of the dynamic client used to manage the
+// Cluster API resources.
+type capiResourceClient interface {
+	Get(name string) (*unstructured.Unstructured, error)
+	List(opts metav1.ListOptions) (runtime.Object, error)
+	Update(obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	Delete(name string, opts *metav1.DeleteOptions) error
+}
+
+// capiMachineDeployment is the part of a MachineDeployment the backend uses.
+type capiMachineDeployment struct {
+	Spec struct {
+		Replicas *int `json:"replicas"`
+		Strategy struct {
+			Type string `json:"type"`
+		} `json:"strategy"`
+	} `json:"spec"`
+}
+
+// capiMachine is the part of a Machine the backend uses.
+type capiMachine struct {
+	Spec struct {
+		ProviderID    string `json:"providerID"`
+		FailureDomain string `json:"failureDomain"`
+	} `json:"spec"`
+	Status struct {
+		Phase   string `json:"phase"`
+		NodeRef *struct {
+			Name string `json:"name"`
+		} `json:"nodeRef"`
+	} `json:"status"`
+}
+
+// CAPINodePoolsBackend defines node pools backed by Cluster API
+// MachineDeployments. The MachineDeployments must use the OnDelete strategy,
+// such that their machines are only replaced when the update strategies of
+// the CLM delete them.
+type CAPINodePoolsBackend struct {
+	clusterName        string
+	machineDeployments capiResourceClient
+	machineSets        capiResourceClient
+	machines           capiResourceClient
+}
+
+// NewCAPINodePoolsBackend initializes a new CAPINodePoolsBackend managing the
+// MachineDeployments of the cluster in the namespace of the management
+// cluster described by config.
+func NewCAPINodePoolsBackend(config *rest.Config, namespace, clusterName string) (*CAPINodePoolsBackend, error) {
+	groupConfig := *config
+	groupConfig.GroupVersion = &schema.GroupVersion{Group: capiGroup, Version: capiVersion}
+	groupConfig.APIPath = "/apis"
+
+	client, err := dynamic.NewClient(&groupConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	resource := func(name, kind string) capiResourceClient {
+		return client.Resource(&metav1.APIResource{Name: name, Namespaced: true, Kind: kind}, namespace)
+	}
+
+	return &CAPINodePoolsBackend{
+		clusterName:        clusterName,
+		machineDeployments: resource(capiMachineDeploymentsPlural, "MachineDeployment"),
+		machineSets:        resource(capiMachineSetsPlural, "MachineSet"),
+		machines:           resource(capiMachinesPlural, "Machine"),
+	}, nil
+}
+
+// machineDeploymentName returns the name of the MachineDeployment of the
+// node pool.
+func (c *CAPINodePoolsBackend) machineDeploymentName(nodePool *api.NodePool) string {
+	if name, ok := nodePool.ConfigItems[CAPIMachineDeploymentConfigItem]; ok {
+		return name
+	}
+	return c.clusterName + "-" + nodePool.Name
+}
+
+// decodeCAPIObject decodes the unstructured object into the typed one.
+func decodeCAPIObject(obj *unstructured.Unstructured, into interface{}) error {
+	data, err := json.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
+
+// listCAPIObjects lists the objects of the MachineDeployment.
+func listCAPIObjects(client capiResourceClient, machineDeployment string) ([]*unstructured.Unstructured, error) {
+	list, err := client.List(metav1.ListOptions{LabelSelector: capiDeploymentNameLabel + "=" + machineDeployment})
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]*unstructured.Unstructured, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object %T", item)
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// currentTemplateHash returns the template hash of the MachineSet of the
+// latest revision of the MachineDeployment.
+func (c *CAPINodePoolsBackend) currentTemplateHash(machineDeployment string) (string, error) {
+	machineSets, err := listCAPIObjects(c.machineSets, machineDeployment)
+	if err != nil {
+		return "", err
+	}
+
+	hash := ""
+	latest := -1
+	for _, machineSet := range machineSets {
+		revision, err := strconv.Atoi(machineSet.GetAnnotations()[capiRevisionAnnotation])
+		if err != nil {
+			continue
+		}
+		if revision > latest {
+			latest = revision
+			hash = machineSet.GetLabels()[capiTemplateHashLabel]
+		}
+	}
+
+	if hash == "" {
+		return "", fmt.Errorf("no MachineSet found for MachineDeployment %s", machineDeployment)
+	}
+	return hash, nil
+}
+
+// Get returns the machines of the MachineDeployment of the node pool. The
+// machines of the MachineSet of the latest revision are of the current
+// generation, the ones of older MachineSets are outdated.
+func (c *CAPINodePoolsBackend) Get(nodePool *api.NodePool) (*NodePool, error) {
+	name := c.machineDeploymentName(nodePool)
+
+	obj, err := c.machineDeployments.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var machineDeployment capiMachineDeployment
+	err = decodeCAPIObject(obj, &machineDeployment)
+	if err != nil {
+		return nil, err
+	}
+
+	if machineDeployment.Spec.Strategy.Type != capiOnDeleteStrategy {
+		return nil, fmt.Errorf("MachineDeployment %s must use the %s strategy to be updated by the CLM", name, capiOnDeleteStrategy)
+	}
+
+	desired := 1
+	if machineDeployment.Spec.Replicas != nil {
+		desired = *machineDeployment.Spec.Replicas
+	}
+
+	hash, err := c.currentTemplateHash(name)
+	if err != nil {
+		return nil, err
+	}
+
+	machines, err := listCAPIObjects(c.machines, name)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*Node, 0, len(machines))
+	for _, obj := range machines {
+		var machine capiMachine
+		err = decodeCAPIObject(obj, &machine)
+		if err != nil {
+			return nil, err
+		}
+
+		generation := outdatedNodeGeneration
+		if obj.GetLabels()[capiTemplateHashLabel] == hash {
+			generation = currentNodeGeneration
+		}
+
+		nodes = append(nodes, &Node{
+			ProviderID:    machine.Spec.ProviderID,
+			FailureDomain: machine.Spec.FailureDomain,
+			Generation:    generation,
+			Ready:         machine.Status.Phase == capiMachinePhaseRunning && machine.Status.NodeRef != nil,
+		})
+	}
+
+	return &NodePool{
+		Min:           int(nodePool.MinSize),
+		Desired:       desired,
+		Current:       len(nodes),
+		Max:           int(nodePool.MaxSize),
+		Generation:    currentNodeGeneration,
+		Configuration: hash,
+		Nodes:         nodes,
+	}, nil
+}
+
+// Scale sets the replicas of the MachineDeployment of the node pool.
+func (c *CAPINodePoolsBackend) Scale(nodePool *api.NodePool, replicas int) error {
+	return c.scaleMachineDeployment(c.machineDeploymentName(nodePool), func(int) int { return replicas })
+}
+
+// scaleMachineDeployment updates the replicas of the MachineDeployment with
+// the result of scale.
+func (c *CAPINodePoolsBackend) scaleMachineDeployment(name string, scale func(replicas int) int) error {
+	obj, err := c.machineDeployments.Get(name)
+	if err != nil {
+		return err
+	}
+
+	var machineDeployment capiMachineDeployment
+	err = decodeCAPIObject(obj, &machineDeployment)
+	if err != nil {
+		return err
+	}
+
+	replicas := 1
+	if machineDeployment.Spec.Replicas != nil {
+		replicas = *machineDeployment.Spec.Replicas
+	}
+
+	spec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("MachineDeployment %s has no spec", name)
+	}
+	spec["replicas"] = int64(scale(replicas))
+
+	_, err = c.machineDeployments.Update(obj)
+	return err
+}
+
+// SuspendAutoscaling removes the cluster-autoscaler annotations of the
+// MachineDeployment, such that the cluster-autoscaler stops managing it.
+func (c *CAPINodePoolsBackend) SuspendAutoscaling(nodePool *api.NodePool) error {
+	obj, err := c.machineDeployments.Get(c.machineDeploymentName(nodePool))
+	if err != nil {
+		return err
+	}
+
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[capiAutoscalerMinAnnotation]; !ok {
+		if _, ok := annotations[capiAutoscalerMaxAnnotation]; !ok {
+			return nil
+		}
+	}
+
+	delete(annotations, capiAutoscalerMinAnnotation)
+	delete(annotations, capiAutoscalerMaxAnnotation)
+	obj.SetAnnotations(annotations)
+
+	_, err = c.machineDeployments.Update(obj)
+	return err
+}
+
+// Terminate deletes the machine of the drained node, which the MachineSet
+// replaces unless decrementDesired is set. In that case the machine is
+// marked for deletion and the MachineDeployment is scaled down, so the
+// MachineSet removes exactly this machine. The node isn't drained again by
+// Cluster API.
+func (c *CAPINodePoolsBackend) Terminate(node *Node, decrementDesired bool) error {
+	obj, err := c.findMachine(node.ProviderID)
+	if err != nil {
+		return err
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[capiExcludeDrainAnnotation] = "true"
+	if decrementDesired {
+		annotations[capiDeleteMachineAnnotation] = "yes"
+	}
+	obj.SetAnnotations(annotations)
+
+	obj, err = c.machines.Update(obj)
+	if err != nil {
+		return err
+	}
+
+	if decrementDesired {
+		return c.scaleMachineDeployment(obj.GetLabels()[capiDeploymentNameLabel], func(replicas int) int {
+			return replicas - 1
+		})
+	}
+	return c.machines.Delete(obj.GetName(), nil)
+}
+
+// findMachine returns the machine with the provider ID.
+func (c *CAPINodePoolsBackend) findMachine(providerID string) (*unstructured.Unstructured, error) {
+	list, err := c.machines.List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		obj, ok := item.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		var machine capiMachine
+		err = decodeCAPIObject(obj, &machine)
+		if err != nil {
+			return nil, err
+		}
+		if machine.Spec.ProviderID == providerID {
+			return obj, nil
+		}
+	}
+	return nil, fmt.Errorf("no machine found for node %s", providerID)
+}
@@ -0,0 +1,191 @@
+package updatestrategy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// capiClientStub is an in-memory resource client for a single resource.
+type capiClientStub struct {
+	objects map[string]*unstructured.Unstructured
+}
+
+func newCAPIClientStub(objects ...*unstructured.Unstructured) *capiClientStub {
+	stub := &capiClientStub{objects: make(map[string]*unstructured.Unstructured)}
+	for _, obj := range objects {
+		stub.objects[obj.GetName()] = obj
+	}
+	return stub
+}
+
+func (c *capiClientStub) Get(name string) (*unstructured.Unstructured, error) {
+	obj, ok := c.objects[name]
+	if !ok {
+		return nil, apiErrors.NewNotFound(schema.GroupResource{}, name)
+	}
+	return obj, nil
+}
+
+func (c *capiClientStub) List(opts metav1.ListOptions) (runtime.Object, error) {
+	var objects []runtime.Object
+	for _, obj := range c.objects {
+		if opts.LabelSelector != "" {
+			selector := strings.SplitN(opts.LabelSelector, "=", 2)
+			if obj.GetLabels()[selector[0]] != selector[1] {
+				continue
+			}
+		}
+		objects = append(objects, obj)
+	}
+
+	list := &unstructured.UnstructuredList{Object: map[string]interface{}{}}
+	err := meta.SetList(list, objects)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (c *capiClientStub) Update(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if _, ok := c.objects[obj.GetName()]; !ok {
+		return nil, apiErrors.NewNotFound(schema.GroupResource{}, obj.GetName())
+	}
+	c.objects[obj.GetName()] = obj
+	return obj, nil
+}
+
+func (c *capiClientStub) Delete(name string, opts *metav1.DeleteOptions) error {
+	if _, ok := c.objects[name]; !ok {
+		return apiErrors.NewNotFound(schema.GroupResource{}, name)
+	}
+	delete(c.objects, name)
+	return nil
+}
+
+func capiObject(name string, labels, annotations map[string]string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetName(name)
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+	return obj
+}
+
+func capiMachineObject(name, hash string, running bool) *unstructured.Unstructured {
+	machine := capiObject(name, map[string]string{
+		capiDeploymentNameLabel: "cluster-1-default-worker",
+		capiTemplateHashLabel:   hash,
+	}, nil, map[string]interface{}{
+		"providerID":    "aws:///eu-central-1a/" + name,
+		"failureDomain": "eu-central-1a",
+	})
+	if running {
+		machine.Object["status"] = map[string]interface{}{
+			"phase":   capiMachinePhaseRunning,
+			"nodeRef": map[string]interface{}{"name": name},
+		}
+	}
+	return machine
+}
+
+func newTestCAPIBackend(strategy string) *CAPINodePoolsBackend {
+	name := "cluster-1-default-worker"
+	return &CAPINodePoolsBackend{
+		clusterName: "cluster-1",
+		machineDeployments: newCAPIClientStub(capiObject(name, nil, map[string]string{
+			capiAutoscalerMinAnnotation: "1",
+			capiAutoscalerMaxAnnotation: "3",
+		}, map[string]interface{}{
+			"replicas": int64(2),
+			"strategy": map[string]interface{}{"type": strategy},
+		})),
+		machineSets: newCAPIClientStub(
+			capiObject("ms-old", map[string]string{capiDeploymentNameLabel: name, capiTemplateHashLabel: "old"}, map[string]string{capiRevisionAnnotation: "1"}, nil),
+			capiObject("ms-new", map[string]string{capiDeploymentNameLabel: name, capiTemplateHashLabel: "new"}, map[string]string{capiRevisionAnnotation: "2"}, nil),
+		),
+		machines: newCAPIClientStub(
+			capiMachineObject("machine-1", "old", true),
+			capiMachineObject("machine-2", "new", false),
+		),
+	}
+}
+
+func TestCAPINodePoolsBackendGet(t *testing.T) {
+	backend := newTestCAPIBackend(capiOnDeleteStrategy)
+	nodePool := &api.NodePool{Name: "default-worker", MinSize: 1, MaxSize: 3}
+
+	pool, err := backend.Get(nodePool)
+	require.NoError(t, err)
+	require.Equal(t, 1, pool.Min)
+	require.Equal(t, 2, pool.Desired)
+	require.Equal(t, 2, pool.Current)
+	require.Equal(t, 3, pool.Max)
+	require.Equal(t, "new", pool.Configuration)
+	require.Len(t, pool.Nodes, 2)
+
+	nodes := make(map[string]*Node)
+	for _, node := range pool.Nodes {
+		nodes[node.ProviderID] = node
+	}
+	old := nodes["aws:///eu-central-1a/machine-1"]
+	require.Equal(t, outdatedNodeGeneration, old.Generation)
+	require.True(t, old.Ready)
+	require.Equal(t, "eu-central-1a", old.FailureDomain)
+	current := nodes["aws:///eu-central-1a/machine-2"]
+	require.Equal(t, currentNodeGeneration, current.Generation)
+	require.False(t, current.Ready)
+
+	// the MachineDeployment name can be overridden
+	_, err = backend.Get(&api.NodePool{Name: "other", ConfigItems: map[string]string{CAPIMachineDeploymentConfigItem: "cluster-1-default-worker"}})
+	require.NoError(t, err)
+	_, err = backend.Get(&api.NodePool{Name: "other"})
+	require.Error(t, err)
+
+	// machines would be replaced without the CLM draining them
+	_, err = newTestCAPIBackend("RollingUpdate").Get(nodePool)
+	require.Error(t, err)
+}
+
+func TestCAPINodePoolsBackendScale(t *testing.T) {
+	backend := newTestCAPIBackend(capiOnDeleteStrategy)
+	nodePool := &api.NodePool{Name: "default-worker"}
+
+	require.NoError(t, backend.SuspendAutoscaling(nodePool))
+	md, err := backend.machineDeployments.Get("cluster-1-default-worker")
+	require.NoError(t, err)
+	require.NotContains(t, md.GetAnnotations(), capiAutoscalerMinAnnotation)
+	require.NotContains(t, md.GetAnnotations(), capiAutoscalerMaxAnnotation)
+
+	require.NoError(t, backend.Scale(nodePool, 4))
+	pool, err := backend.Get(nodePool)
+	require.NoError(t, err)
+	require.Equal(t, 4, pool.Desired)
+}
+
+func TestCAPINodePoolsBackendTerminate(t *testing.T) {
+	backend := newTestCAPIBackend(capiOnDeleteStrategy)
+	machines := backend.machines.(*capiClientStub)
+
+	// the machine is replaced by its MachineSet
+	require.NoError(t, backend.Terminate(&Node{ProviderID: "aws:///eu-central-1a/machine-1"}, false))
+	require.NotContains(t, machines.objects, "machine-1")
+
+	// the machine is removed by scaling down the MachineDeployment
+	require.NoError(t, backend.Terminate(&Node{ProviderID: "aws:///eu-central-1a/machine-2"}, true))
+	machine := machines.objects["machine-2"]
+	require.Equal(t, "yes", machine.GetAnnotations()[capiDeleteMachineAnnotation])
+	require.Equal(t, "true", machine.GetAnnotations()[capiExcludeDrainAnnotation])
+	pool, err := backend.Get(&api.NodePool{Name: "default-worker"})
+	require.NoError(t, err)
+	require.Equal(t, 1, pool.Desired)
+
+	require.Error(t, backend.Terminate(&Node{ProviderID: "aws:///eu-central-1a/missing"}, false))
+}
@@ -0,0 +1,223 @@
+package updatestrategy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	pauseConfigMapPrefix = "cluster-lifecycle-manager-pause-"
+	pauseConfigMapKey    = "reason"
+)
+
+// ControlPlaneHealthChecker verifies the health of the control plane of a
+// cluster.
+type ControlPlaneHealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// PauseStore persists the pauses of node pool updates.
+type PauseStore interface {
+	// Paused returns the reason the update of the node pool was paused
+	// or an empty string if it isn't paused.
+	Paused(nodePool *api.NodePool) (string, error)
+	Pause(nodePool *api.NodePool, reason string) error
+}
+
+// ConfigMapPauseStore persists the pauses of node pool updates as ConfigMaps
+// in the cluster. Deleting the ConfigMap resumes the update.
+type ConfigMapPauseStore struct {
+	kube      kubernetes.Interface
+	namespace string
+}
+
+// NewConfigMapPauseStore initializes a new ConfigMapPauseStore storing the
+// ConfigMaps in the specified namespace.
+func NewConfigMapPauseStore(kubeClient kubernetes.Interface, namespace string) *ConfigMapPauseStore {
+	return &ConfigMapPauseStore{
+		kube:      kubeClient,
+		namespace: namespace,
+	}
+}
+
+// Paused returns the reason the update of the node pool was paused.
+func (s *ConfigMapPauseStore) Paused(nodePool *api.NodePool) (string, error) {
+	configMap, err := s.kube.CoreV1().ConfigMaps(s.namespace).Get(pauseConfigMapPrefix+nodePool.Name, metav1.GetOptions{})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	reason := configMap.Data[pauseConfigMapKey]
+	if reason == "" {
+		reason = "unknown"
+	}
+	return reason, nil
+}
+
+// Pause pauses the update of the node pool.
+func (s *ConfigMapPauseStore) Pause(nodePool *api.NodePool, reason string) error {
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pauseConfigMapPrefix + nodePool.Name,
+			Namespace: s.namespace,
+		},
+		Data: map[string]string{
+			pauseConfigMapKey: reason,
+		},
+	}
+
+	_, err := s.kube.CoreV1().ConfigMaps(s.namespace).Create(configMap)
+	if err != nil && apiErrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// ControlPlaneUpdateStrategy is an update strategy for control plane node
+// pools. The nodes are replaced one at a time, a new node is added before an
+// old one is terminated and the health of the control plane is verified
+// before the next node is replaced. If the control plane doesn't become
+// healthy again the update is paused until an operator resumes it.
+type ControlPlaneUpdateStrategy struct {
+	nodePoolManager NodePoolManager
+	healthChecker   ControlPlaneHealthChecker
+	pauses          PauseStore
+	healthTimeout   time.Duration
+	logger          *log.Entry
+}
+
+// NewControlPlaneUpdateStrategy initializes a new ControlPlaneUpdateStrategy.
+func NewControlPlaneUpdateStrategy(logger *log.Entry, nodePoolManager NodePoolManager, healthChecker ControlPlaneHealthChecker, pauses PauseStore, healthTimeout time.Duration) *ControlPlaneUpdateStrategy {
+	return &ControlPlaneUpdateStrategy{
+		nodePoolManager: nodePoolManager,
+		healthChecker:   healthChecker,
+		pauses:          pauses,
+		healthTimeout:   healthTimeout,
+		logger:          logger.WithField("strategy", "control-plane"),
+	}
+}
+
+// Update replaces the old nodes of a control plane node pool one by one.
+func (c *ControlPlaneUpdateStrategy) Update(ctx context.Context, nodePoolDesc *api.NodePool) error {
+	c.logger.Infof("Initializing update of control plane node pool '%s'", nodePoolDesc.Name)
+
+	if nodePoolDesc.MaxSize < 1 {
+		return nil
+	}
+
+	reason, err := c.pauses.Paused(nodePoolDesc)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return fmt.Errorf("update of control plane node pool '%s' is paused: %s", nodePoolDesc.Name, reason)
+	}
+
+	// the control plane isn't touched unless it's healthy
+	err = c.healthChecker.CheckHealth(ctx)
+	if err != nil {
+		return fmt.Errorf("control plane unhealthy, not updating node pool '%s': %v", nodePoolDesc.Name, err)
+	}
+
+	for {
+		nodePool, err := WaitForDesiredNodes(ctx, c.logger, c.nodePoolManager, nodePoolDesc)
+		if err != nil {
+			return err
+		}
+
+		var oldNodes []*Node
+		for _, node := range nodePool.Nodes {
+			if node.Generation != nodePool.Generation {
+				oldNodes = append(oldNodes, node)
+			}
+		}
+		if len(oldNodes) == 0 {
+			break
+		}
+
+		err = c.replaceNode(ctx, nodePoolDesc, nodePool, oldNodes[0])
+		if err != nil {
+			return err
+		}
+
+		// pause the update if the control plane doesn't recover
+		// from the replacement.
+		err = c.waitForHealth(ctx)
+		if err != nil {
+			reason := fmt.Sprintf("control plane unhealthy after replacing node %s: %v", oldNodes[0].Name, err)
+			pauseErr := c.pauses.Pause(nodePoolDesc, reason)
+			if pauseErr != nil {
+				c.logger.Errorf("Failed to pause the update of node pool '%s': %v", nodePoolDesc.Name, pauseErr)
+			}
+			return fmt.Errorf("paused update of control plane node pool '%s': %s", nodePoolDesc.Name, reason)
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	c.logger.Infof("Control plane node pool '%s' successfully updated", nodePoolDesc.Name)
+	return nil
+}
+
+// replaceNode adds a new node to the node pool and terminates the old node
+// once the new node is ready.
+func (c *ControlPlaneUpdateStrategy) replaceNode(ctx context.Context, nodePoolDesc *api.NodePool, nodePool *NodePool, node *Node) error {
+	c.logger.Infof("Replacing control plane node '%s'", node.Name)
+
+	err := c.nodePoolManager.MarkNodeForDecommission(node)
+	if err != nil {
+		return err
+	}
+
+	err = c.nodePoolManager.ScalePool(ctx, nodePoolDesc, nodePool.Desired+1)
+	if err != nil {
+		return err
+	}
+
+	_, err = WaitForDesiredNodes(ctx, c.logger, c.nodePoolManager, nodePoolDesc)
+	if err != nil {
+		return err
+	}
+
+	err = c.nodePoolManager.CordonNode(node)
+	if err != nil {
+		return err
+	}
+
+	return c.nodePoolManager.TerminateNode(ctx, node, true)
+}
+
+// waitForHealth waits until the control plane is healthy or the health
+// timeout expired.
+func (c *ControlPlaneUpdateStrategy) waitForHealth(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.healthTimeout)
+	defer cancel()
+
+	for {
+		err := c.healthChecker.CheckHealth(ctx)
+		if err == nil {
+			return nil
+		}
+
+		c.logger.Infof("Waiting for the control plane to become healthy: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(operationCheckInterval):
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package updatestrategy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type mockHealthChecker struct {
+	// failAfter is the number of checks succeeding before the control
+	// plane becomes unhealthy, -1 keeps it healthy.
+	failAfter int
+	checks    int
+}
+
+func (m *mockHealthChecker) CheckHealth(ctx context.Context) error {
+	m.checks++
+	if m.failAfter >= 0 && m.checks > m.failAfter {
+		return errors.New("etcd quorum lost")
+	}
+	return nil
+}
+
+type mockPauseStore struct {
+	reasons map[string]string
+}
+
+func (m *mockPauseStore) Paused(nodePool *api.NodePool) (string, error) {
+	return m.reasons[nodePool.Name], nil
+}
+
+func (m *mockPauseStore) Pause(nodePool *api.NodePool, reason string) error {
+	m.reasons[nodePool.Name] = reason
+	return nil
+}
+
+func controlPlaneNodePool() *NodePool {
+	return &NodePool{
+		Min:        3,
+		Max:        3,
+		Current:    3,
+		Desired:    3,
+		Generation: 2,
+		Nodes: []*Node{
+			mockNode("a", 1, false, false),
+			mockNode("b", 1, false, false),
+			mockNode("c", 1, false, false),
+		},
+	}
+}
+
+func TestControlPlaneUpdate(t *testing.T) {
+	nodePoolDesc := &api.NodePool{Name: "master", MaxSize: 3}
+
+	manager := &mockNodePoolManager{nodePool: controlPlaneNodePool()}
+	pauses := &mockPauseStore{reasons: map[string]string{}}
+	checker := &mockHealthChecker{failAfter: -1}
+	strategy := NewControlPlaneUpdateStrategy(log.WithField("test", true), manager, checker, pauses, time.Millisecond)
+
+	require.NoError(t, strategy.Update(context.Background(), nodePoolDesc))
+	require.Len(t, manager.nodePool.Nodes, 3)
+	for _, node := range manager.nodePool.Nodes {
+		require.Equal(t, 2, node.Generation)
+	}
+	// once before the update and after every replacement
+	require.Equal(t, 4, checker.checks)
+	require.Empty(t, pauses.reasons)
+}
+
+func TestControlPlaneUpdatePausesOnAnomaly(t *testing.T) {
+	nodePoolDesc := &api.NodePool{Name: "master", MaxSize: 3}
+
+	manager := &mockNodePoolManager{nodePool: controlPlaneNodePool()}
+	pauses := &mockPauseStore{reasons: map[string]string{}}
+	checker := &mockHealthChecker{failAfter: 1}
+	strategy := NewControlPlaneUpdateStrategy(log.WithField("test", true), manager, checker, pauses, time.Millisecond)
+
+	require.Error(t, strategy.Update(context.Background(), nodePoolDesc))
+	require.NotEmpty(t, pauses.reasons["master"])
+
+	// only the first node was replaced
+	old := 0
+	for _, node := range manager.nodePool.Nodes {
+		if node.Generation != manager.nodePool.Generation {
+			old++
+		}
+	}
+	require.Equal(t, 2, old)
+
+	// the update stays paused
+	checker.failAfter = -1
+	require.Error(t, strategy.Update(context.Background(), nodePoolDesc))
+
+	delete(pauses.reasons, "master")
+	require.NoError(t, strategy.Update(context.Background(), nodePoolDesc))
+}
+
+func TestControlPlaneUpdateUnhealthy(t *testing.T) {
+	manager := &mockNodePoolManager{nodePool: controlPlaneNodePool()}
+	pauses := &mockPauseStore{reasons: map[string]string{}}
+	strategy := NewControlPlaneUpdateStrategy(log.WithField("test", true), manager, &mockHealthChecker{failAfter: 0}, pauses, time.Millisecond)
+
+	require.Error(t, strategy.Update(context.Background(), &api.NodePool{Name: "master", MaxSize: 3}))
+	// nothing was changed so the update isn't paused
+	require.Empty(t, pauses.reasons)
+	require.Equal(t, 1, manager.nodePool.Nodes[0].Generation)
+}
@@ -0,0 +1,107 @@
+package updatestrategy
+
+import (
+	"time"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// evictLastAnnotation marks pods which are only evicted once all the
+	// other pods of a node are gone.
+	evictLastAnnotation   = "cluster-lifecycle-manager.zalando.org/evict-last"
+	criticalPodAnnotation = "scheduler.alpha.kubernetes.io/critical-pod"
+)
+
+const (
+	evictionWaveFirst = iota
+	evictionWaveDefault
+	evictionWaveLast
+)
+
+// DrainPolicy defines the order in which the pods of a node are evicted and
+// how long they're given to terminate. The pods of a node are evicted in
+// waves: batch pods (owned by a Job) and the pods of the FirstNamespaces
+// first, then all regular pods and finally critical pods and pods annotated
+// with cluster-lifecycle-manager.zalando.org/evict-last. The pods of a wave
+// are evicted in parallel. The zero value, like a nil policy, only orders
+// batch and critical pods.
+type DrainPolicy struct {
+	FirstNamespaces []string
+	// GracePeriods override the termination grace period of the pods by
+	// namespace.
+	GracePeriods map[string]time.Duration
+	// StuckFinalizers are removed from pods not terminated after force
+	// deleting them, e.g. finalizers of controllers which can't reach the
+	// node anymore.
+	StuckFinalizers []string
+}
+
+// evictionWaves groups the pods by the wave they're evicted in, in order.
+// Empty waves are omitted.
+func (p *DrainPolicy) evictionWaves(pods []v1.Pod) [][]v1.Pod {
+	waves := make([][]v1.Pod, evictionWaveLast+1)
+	for _, pod := range pods {
+		wave := p.evictionWave(&pod)
+		waves[wave] = append(waves[wave], p.withGracePeriod(pod))
+	}
+
+	result := make([][]v1.Pod, 0, len(waves))
+	for _, wave := range waves {
+		if len(wave) > 0 {
+			result = append(result, wave)
+		}
+	}
+	return result
+}
+
+// evictionWave returns the wave the pod is evicted in.
+func (p *DrainPolicy) evictionWave(pod *v1.Pod) int {
+	if pod.Annotations[evictLastAnnotation] == "true" {
+		return evictionWaveLast
+	}
+	if _, ok := pod.Annotations[criticalPodAnnotation]; ok {
+		return evictionWaveLast
+	}
+
+	if p != nil {
+		for _, namespace := range p.FirstNamespaces {
+			if pod.Namespace == namespace {
+				return evictionWaveFirst
+			}
+		}
+	}
+	for _, owner := range pod.GetOwnerReferences() {
+		if owner.Kind == "Job" {
+			return evictionWaveFirst
+		}
+	}
+	return evictionWaveDefault
+}
+
+// withGracePeriod returns the pod with the termination grace period of its
+// namespace, if one is configured.
+func (p *DrainPolicy) withGracePeriod(pod v1.Pod) v1.Pod {
+	if p == nil {
+		return pod
+	}
+
+	gracePeriod, ok := p.GracePeriods[pod.Namespace]
+	if !ok {
+		return pod
+	}
+
+	seconds := int64(gracePeriod.Seconds())
+	pod.Spec.TerminationGracePeriodSeconds = &seconds
+	return pod
+}
+
+// stuckFinalizer returns true if the finalizer is removed from stuck pods.
+func (p *DrainPolicy) stuckFinalizer(finalizer string) bool {
+	for _, stuck := range p.StuckFinalizers {
+		if finalizer == stuck {
+			return true
+		}
+	}
+	return false
+}
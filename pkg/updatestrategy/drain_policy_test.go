@@ -0,0 +1,56 @@
+package updatestrategy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func TestEvictionWaves(t *testing.T) {
+	pods := []v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "regular", Namespace: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "last", Namespace: "default", Annotations: map[string]string{evictLastAnnotation: "true"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "critical", Namespace: "kube-system", Annotations: map[string]string{criticalPodAnnotation: ""}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "default", OwnerReferences: []metav1.OwnerReference{{Kind: "Job"}}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "batch"}},
+	}
+
+	names := func(waves [][]v1.Pod) [][]string {
+		result := make([][]string, 0, len(waves))
+		for _, wave := range waves {
+			var wavePods []string
+			for _, pod := range wave {
+				wavePods = append(wavePods, pod.Name)
+			}
+			result = append(result, wavePods)
+		}
+		return result
+	}
+
+	var policy *DrainPolicy
+	assert.Equal(t, [][]string{{"job"}, {"regular", "batch"}, {"last", "critical"}}, names(policy.evictionWaves(pods)))
+
+	policy = &DrainPolicy{FirstNamespaces: []string{"batch"}}
+	assert.Equal(t, [][]string{{"job", "batch"}, {"regular"}, {"last", "critical"}}, names(policy.evictionWaves(pods)))
+
+	assert.Equal(t, [][]string{{"regular"}}, names(policy.evictionWaves(pods[:1])))
+}
+
+func TestWithGracePeriod(t *testing.T) {
+	gracePeriod := int64(300)
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "batch"},
+		Spec:       v1.PodSpec{TerminationGracePeriodSeconds: &gracePeriod},
+	}
+
+	policy := &DrainPolicy{GracePeriods: map[string]time.Duration{"batch": 30 * time.Second}}
+	assert.EqualValues(t, 30, *policy.withGracePeriod(pod).Spec.TerminationGracePeriodSeconds)
+	// the original pod isn't modified
+	assert.EqualValues(t, 300, *pod.Spec.TerminationGracePeriodSeconds)
+
+	pod.Namespace = "default"
+	assert.EqualValues(t, 300, *policy.withGracePeriod(pod).Spec.TerminationGracePeriodSeconds)
+}
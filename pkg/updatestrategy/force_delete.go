@@ -0,0 +1,87 @@
+package updatestrategy
+
+import (
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// forceDeletePod deletes a pod which wasn't terminated within its grace
+// period without waiting for it to terminate. If the pod is still kept by
+// one of the finalizers of the drain policy which are removed for stuck pods
+// they're removed too. The pod is recorded as force deleted.
+func (m *KubernetesNodePoolManager) forceDeletePod(logger *log.Entry, pod v1.Pod) error {
+	logger.Warnf("Force deleting pod")
+	m.recordForceDeleted(pod)
+
+	gracePeriod := int64(0)
+	err := m.kube.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+	})
+	if err != nil && !apiErrors.IsNotFound(err) {
+		return err
+	}
+
+	pod.Spec.TerminationGracePeriodSeconds = &gracePeriod
+	if waitForPodTermination(m.kube, pod) == nil {
+		return nil
+	}
+
+	if m.drainPolicy == nil || len(m.drainPolicy.StuckFinalizers) == 0 {
+		logger.Warnf("Pod not terminated after force deletion")
+		return nil
+	}
+
+	current, err := m.kube.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if current.UID != pod.UID {
+		return nil
+	}
+
+	finalizers := make([]string, 0, len(current.Finalizers))
+	for _, finalizer := range current.Finalizers {
+		if !m.drainPolicy.stuckFinalizer(finalizer) {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	if len(finalizers) == len(current.Finalizers) {
+		logger.Warnf("Pod not terminated after force deletion")
+		return nil
+	}
+
+	logger.Warnf("Removing finalizers of stuck pod: %v", current.Finalizers)
+	current.Finalizers = finalizers
+	_, err = m.kube.CoreV1().Pods(pod.Namespace).Update(current)
+	if err != nil && !apiErrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// recordForceDeleted records a pod as force deleted.
+func (m *KubernetesNodePoolManager) recordForceDeleted(pod v1.Pod) {
+	m.forceDeletedMutex.Lock()
+	defer m.forceDeletedMutex.Unlock()
+	m.forceDeleted = append(m.forceDeleted, pod.Namespace+"/"+pod.Name)
+}
+
+// ForceDeletedPods returns the pods, as <namespace>/<name>, which had to be
+// force deleted because they weren't terminated within their grace period
+// while draining nodes.
+func (m *KubernetesNodePoolManager) ForceDeletedPods() []string {
+	m.forceDeletedMutex.Lock()
+	defer m.forceDeletedMutex.Unlock()
+
+	pods := make([]string, len(m.forceDeleted))
+	copy(pods, m.forceDeleted)
+	sort.Strings(pods)
+	return pods
+}
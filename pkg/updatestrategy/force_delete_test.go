@@ -0,0 +1,39 @@
+package updatestrategy
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func TestForceDeletePod(t *testing.T) {
+	pods := []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "stuck", Namespace: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "stuck-system", Namespace: "kube-system"}},
+	}
+	mgr := NewKubernetesNodePoolManager(log.WithField("test", true), "", setupMockKubernetes(t, nil, pods), nil, 0, nil)
+
+	for _, pod := range pods {
+		err := mgr.forceDeletePod(log.WithField("test", true), *pod)
+		assert.NoError(t, err)
+
+		_, err = mgr.kube.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+		assert.True(t, apiErrors.IsNotFound(err))
+	}
+
+	// pods which are already gone are still recorded
+	err := mgr.forceDeletePod(log.WithField("test", true), *pods[0])
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"default/stuck", "default/stuck", "kube-system/stuck-system"}, mgr.ForceDeletedPods())
+}
+
+func TestStuckFinalizer(t *testing.T) {
+	policy := &DrainPolicy{StuckFinalizers: []string{"example.org/volume-cleanup"}}
+	assert.True(t, policy.stuckFinalizer("example.org/volume-cleanup"))
+	assert.False(t, policy.stuckFinalizer("foregroundDeletion"))
+}
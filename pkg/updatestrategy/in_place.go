@@ -0,0 +1,73 @@
+package updatestrategy
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// InPlaceUpdateStrategy is an update strategy for node pools which can't be
+// scaled, e.g. static inventories. The old nodes are drained and terminated
+// one at a time, leaving it to the backend to bring them back with the new
+// configuration, and the next node is only updated once the previous one is
+// ready again.
+type InPlaceUpdateStrategy struct {
+	nodePoolManager NodePoolManager
+	logger          *log.Entry
+}
+
+// NewInPlaceUpdateStrategy initializes a new InPlaceUpdateStrategy.
+func NewInPlaceUpdateStrategy(logger *log.Entry, nodePoolManager NodePoolManager) *InPlaceUpdateStrategy {
+	return &InPlaceUpdateStrategy{
+		nodePoolManager: nodePoolManager,
+		logger:          logger.WithField("strategy", "in-place"),
+	}
+}
+
+// Update updates the old nodes of the node pool one by one.
+func (i *InPlaceUpdateStrategy) Update(ctx context.Context, nodePoolDesc *api.NodePool) error {
+	i.logger.Infof("Initializing update of node pool '%s'", nodePoolDesc.Name)
+
+	for {
+		nodePool, err := WaitForDesiredNodes(ctx, i.logger, i.nodePoolManager, nodePoolDesc)
+		if err != nil {
+			return err
+		}
+
+		var oldNode *Node
+		for _, node := range nodePool.Nodes {
+			if node.Generation != nodePool.Generation {
+				oldNode = node
+				break
+			}
+		}
+		if oldNode == nil {
+			break
+		}
+
+		i.logger.Infof("Updating node '%s' in place", oldNode.Name)
+
+		err = i.nodePoolManager.MarkNodeForDecommission(oldNode)
+		if err != nil {
+			return err
+		}
+
+		err = i.nodePoolManager.CordonNode(oldNode)
+		if err != nil {
+			return err
+		}
+
+		err = i.nodePoolManager.TerminateNode(ctx, oldNode, false)
+		if err != nil {
+			return err
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	i.logger.Infof("Node pool '%s' successfully updated", nodePoolDesc.Name)
+	return nil
+}
@@ -0,0 +1,161 @@
+package updatestrategy
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/cenkalti/backoff"
+)
+
+const (
+	// elbInvalidInstanceErrCode is returned by the classic ELB API for
+	// instances which aren't registered with the load balancer.
+	elbInvalidInstanceErrCode = "InvalidInstance"
+	elbInstanceStateInService = "InService"
+)
+
+// deregisterFromLoadBalancers deregisters the instance from the classic load
+// balancers and target groups attached to the ASG and waits until connection
+// draining finished, so in-flight requests aren't dropped when the instance
+// is terminated. If draining doesn't finish within the deregistration
+// timeout the instance is terminated anyway. A timeout of 0 disables
+// deregistration.
+func (n *ASGNodePoolsBackend) deregisterFromLoadBalancers(instanceId, asgName string) error {
+	if n.deregistrationTimeout <= 0 {
+		return nil
+	}
+
+	lbResp, err := n.asgClient.DescribeLoadBalancers(&autoscaling.DescribeLoadBalancersInput{
+		AutoScalingGroupName: aws.String(asgName),
+	})
+	if err != nil {
+		return err
+	}
+
+	var loadBalancers []*string
+	for _, lb := range lbResp.LoadBalancers {
+		_, err := n.elbClient.DeregisterInstancesFromLoadBalancer(&elb.DeregisterInstancesFromLoadBalancerInput{
+			LoadBalancerName: lb.LoadBalancerName,
+			Instances:        []*elb.Instance{{InstanceId: aws.String(instanceId)}},
+		})
+		if err != nil {
+			if isELBInvalidInstance(err) {
+				continue
+			}
+			return fmt.Errorf("failed to deregister instance '%s' from load balancer '%s': %v", instanceId, aws.StringValue(lb.LoadBalancerName), err)
+		}
+		loadBalancers = append(loadBalancers, lb.LoadBalancerName)
+	}
+
+	tgResp, err := n.asgClient.DescribeLoadBalancerTargetGroups(&autoscaling.DescribeLoadBalancerTargetGroupsInput{
+		AutoScalingGroupName: aws.String(asgName),
+	})
+	if err != nil {
+		return err
+	}
+
+	var targetGroups []*string
+	for _, tg := range tgResp.LoadBalancerTargetGroups {
+		_, err := n.elbv2Client.DeregisterTargets(&elbv2.DeregisterTargetsInput{
+			TargetGroupArn: tg.LoadBalancerTargetGroupARN,
+			Targets:        []*elbv2.TargetDescription{{Id: aws.String(instanceId)}},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to deregister instance '%s' from target group '%s': %v", instanceId, aws.StringValue(tg.LoadBalancerTargetGroupARN), err)
+		}
+		targetGroups = append(targetGroups, tg.LoadBalancerTargetGroupARN)
+	}
+
+	if len(loadBalancers) == 0 && len(targetGroups) == 0 {
+		return nil
+	}
+
+	var drainErr error
+	drained := func() error {
+		for _, lb := range loadBalancers {
+			done, err := n.drainedFromLoadBalancer(instanceId, lb)
+			if err != nil {
+				drainErr = err
+				return backoff.Permanent(err)
+			}
+			if !done {
+				return fmt.Errorf("instance '%s' still draining from load balancer '%s'", instanceId, aws.StringValue(lb))
+			}
+		}
+
+		for _, tg := range targetGroups {
+			done, err := n.drainedFromTargetGroup(instanceId, tg)
+			if err != nil {
+				drainErr = err
+				return backoff.Permanent(err)
+			}
+			if !done {
+				return fmt.Errorf("instance '%s' still draining from target group '%s'", instanceId, aws.StringValue(tg))
+			}
+		}
+		return nil
+	}
+
+	backoffCfg := backoff.NewExponentialBackOff()
+	backoffCfg.MaxElapsedTime = n.deregistrationTimeout
+	// the load balancers drain connections for at most their own timeout,
+	// so termination proceeds once ours expired.
+	_ = backoff.Retry(drained, backoffCfg)
+	return drainErr
+}
+
+// drainedFromLoadBalancer returns true once the classic load balancer
+// finished connection draining for the instance. Instances stay InService
+// while deregistration is in progress.
+func (n *ASGNodePoolsBackend) drainedFromLoadBalancer(instanceId string, loadBalancer *string) (bool, error) {
+	resp, err := n.elbClient.DescribeInstanceHealth(&elb.DescribeInstanceHealthInput{
+		LoadBalancerName: loadBalancer,
+		Instances:        []*elb.Instance{{InstanceId: aws.String(instanceId)}},
+	})
+	if err != nil {
+		if isELBInvalidInstance(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	for _, state := range resp.InstanceStates {
+		if aws.StringValue(state.InstanceId) == instanceId && aws.StringValue(state.State) == elbInstanceStateInService {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// drainedFromTargetGroup returns true once the target group finished
+// connection draining for the instance.
+func (n *ASGNodePoolsBackend) drainedFromTargetGroup(instanceId string, targetGroup *string) (bool, error) {
+	resp, err := n.elbv2Client.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: targetGroup,
+		Targets:        []*elbv2.TargetDescription{{Id: aws.String(instanceId)}},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, target := range resp.TargetHealthDescriptions {
+		if target.Target == nil || aws.StringValue(target.Target.Id) != instanceId || target.TargetHealth == nil {
+			continue
+		}
+		if aws.StringValue(target.TargetHealth.State) != elbv2.TargetHealthStateEnumUnused {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// isELBInvalidInstance returns true if the error indicates that the instance
+// isn't registered with the classic load balancer.
+func isELBInvalidInstance(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == elbInvalidInstanceErrCode
+}
@@ -0,0 +1,132 @@
+package updatestrategy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	"github.com/stretchr/testify/require"
+)
+
+type mockELBV2API struct {
+	elbv2iface.ELBV2API
+	err          error
+	targetState  string
+	deregistered []string
+}
+
+func (e *mockELBV2API) DeregisterTargets(input *elbv2.DeregisterTargetsInput) (*elbv2.DeregisterTargetsOutput, error) {
+	e.deregistered = append(e.deregistered, aws.StringValue(input.TargetGroupArn))
+	return &elbv2.DeregisterTargetsOutput{}, e.err
+}
+
+func (e *mockELBV2API) DescribeTargetHealth(input *elbv2.DescribeTargetHealthInput) (*elbv2.DescribeTargetHealthOutput, error) {
+	return &elbv2.DescribeTargetHealthOutput{
+		TargetHealthDescriptions: []*elbv2.TargetHealthDescription{
+			{
+				Target:       input.Targets[0],
+				TargetHealth: &elbv2.TargetHealth{State: aws.String(e.targetState)},
+			},
+		},
+	}, e.err
+}
+
+func TestDeregisterFromLoadBalancers(t *testing.T) {
+	asgClient := &mockASGAPI{
+		descLB: &autoscaling.DescribeLoadBalancersOutput{
+			LoadBalancers: []*autoscaling.LoadBalancerState{
+				{LoadBalancerName: aws.String("classic")},
+			},
+		},
+		descTG: &autoscaling.DescribeLoadBalancerTargetGroupsOutput{
+			LoadBalancerTargetGroups: []*autoscaling.LoadBalancerTargetGroupState{
+				{LoadBalancerTargetGroupARN: aws.String("target-group")},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		msg          string
+		timeout      time.Duration
+		elbClient    *mockELBAPI
+		elbv2Client  *mockELBV2API
+		deregistered bool
+		valid        bool
+	}{
+		{
+			msg:     "drained",
+			timeout: time.Minute,
+			elbClient: &mockELBAPI{
+				descInstanceHealth: &elb.DescribeInstanceHealthOutput{},
+			},
+			elbv2Client:  &mockELBV2API{targetState: elbv2.TargetHealthStateEnumUnused},
+			deregistered: true,
+			valid:        true,
+		},
+		{
+			msg:     "not registered with the classic load balancer",
+			timeout: time.Minute,
+			elbClient: &mockELBAPI{
+				err: awserr.New(elbInvalidInstanceErrCode, "not registered", nil),
+			},
+			elbv2Client: &mockELBV2API{targetState: elbv2.TargetHealthStateEnumUnused},
+			valid:       true,
+		},
+		{
+			msg:     "draining timeout expired",
+			timeout: time.Millisecond,
+			elbClient: &mockELBAPI{
+				descInstanceHealth: &elb.DescribeInstanceHealthOutput{},
+			},
+			elbv2Client:  &mockELBV2API{targetState: elbv2.TargetHealthStateEnumDraining},
+			deregistered: true,
+			valid:        true,
+		},
+		{
+			msg:          "disabled",
+			elbClient:    &mockELBAPI{},
+			elbv2Client:  &mockELBV2API{},
+			deregistered: false,
+			valid:        true,
+		},
+		{
+			msg:     "failed to deregister",
+			timeout: time.Minute,
+			elbClient: &mockELBAPI{
+				descInstanceHealth: &elb.DescribeInstanceHealthOutput{},
+			},
+			elbv2Client: &mockELBV2API{err: errors.New("failed")},
+			valid:       false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			backend := &ASGNodePoolsBackend{
+				asgClient:             asgClient,
+				elbClient:             tc.elbClient,
+				elbv2Client:           tc.elbv2Client,
+				deregistrationTimeout: tc.timeout,
+			}
+
+			err := backend.deregisterFromLoadBalancers("i-1", "asg-name")
+			if !tc.valid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if tc.deregistered {
+				require.Equal(t, []string{"classic"}, tc.elbClient.deregistered)
+				require.Equal(t, []string{"target-group"}, tc.elbv2Client.deregistered)
+			} else if tc.timeout == 0 {
+				require.Empty(t, tc.elbClient.deregistered)
+				require.Empty(t, tc.elbv2Client.deregistered)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package updatestrategy
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/metrics"
+)
+
+var (
+	// metrics per node pool (<cluster ID>/<node pool>), exposed at
+	// /debug/vars. The gauges are updated whenever the node pool is looked
+	// up, e.g. while updating it.
+	nodePoolOldestNodeAge      = metrics.NewMap("node_pool_oldest_node_age_seconds")
+	nodePoolPendingReplacement = metrics.NewMap("node_pool_nodes_pending_replacement")
+	nodePoolLastDrainDuration  = metrics.NewMap("node_pool_last_drain_duration_seconds")
+	nodePoolEvictionFailures   = metrics.NewMap("node_pool_eviction_failures")
+	nodePoolRepairedNodes      = metrics.NewMap("node_pool_repaired_nodes")
+)
+
+// metricsKey returns the key of the metrics of the node pool.
+func (m *KubernetesNodePoolManager) metricsKey(nodePool string) string {
+	return m.clusterID + "/" + nodePool
+}
+
+// recordPoolMetrics records the age of the oldest node of the node pool and
+// the number of nodes which don't match the generation of the node pool yet.
+// An oldest creation time of zero means the node pool has no nodes.
+func (m *KubernetesNodePoolManager) recordPoolMetrics(nodePoolDesc *api.NodePool, nodePool *NodePool, oldest time.Time) {
+	key := m.metricsKey(nodePoolDesc.Name)
+
+	age := 0.0
+	if !oldest.IsZero() {
+		age = time.Since(oldest).Seconds()
+	}
+	setGauge(nodePoolOldestNodeAge, key, age)
+
+	pending := 0
+	for _, node := range nodePool.Nodes {
+		if node.Generation != nodePool.Generation {
+			pending++
+		}
+	}
+	setGauge(nodePoolPendingReplacement, key, float64(pending))
+}
+
+// setGauge sets the value of the key of the map.
+func setGauge(gauges *expvar.Map, key string, value float64) {
+	gauge := new(expvar.Float)
+	gauge.Set(value)
+	gauges.Set(key, gauge)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -35,6 +36,10 @@ const (
 
 	decommissionPendingTaintKey   = "decommission-pending"
 	decommissionPendingTaintValue = "rolling-upgrade"
+
+	// configHashAnnotation records the hash of the node pool configuration
+	// a node was found to be running with.
+	configHashAnnotation = "cluster-lifecycle-manager.zalando.org/node-pool-config-hash"
 )
 
 // NodePoolManager defines an interface for managing node pools when performing
@@ -45,27 +50,54 @@ type NodePoolManager interface {
 	ScalePool(ctx context.Context, nodePool *api.NodePool, replicas int) error
 	TerminateNode(ctx context.Context, node *Node, decrementDesired bool) error
 	CordonNode(node *Node) error
+	HandleTerminations(ctx context.Context, nodePool *api.NodePool, hookTimeout time.Duration) error
+	RepairNodes(ctx context.Context, nodePool *api.NodePool, notReadyTimeout time.Duration) (*Node, error)
+	NodesForPendingPods(nodePool *NodePool) (int, error)
+	ForceDeletedPods() []string
 }
 
 // KubernetesNodePoolManager defines a node pool manager which uses the
 // Kubernetes API along with a node pool provider backend to manage node pools.
 type KubernetesNodePoolManager struct {
+	clusterID       string
 	kube            kubernetes.Interface
 	backend         ProviderNodePoolsBackend
 	logger          *log.Entry
 	maxEvictTimeout time.Duration
+	drainPolicy     *DrainPolicy
+	// readOnly is set if getting node pools must not change the nodes.
+	readOnly bool
+
+	forceDeletedMutex sync.Mutex
+	forceDeleted      []string
 }
 
 // NewKubernetesNodePoolManager initializes a new Kubernetes NodePool manager
 // which can manage single node pools based on the nodes registered in the
 // Kubernetes API and the related NodePoolBackend for those nodes e.g.
-// ASGNodePool.
-func NewKubernetesNodePoolManager(logger *log.Entry, kubeClient kubernetes.Interface, poolBackend ProviderNodePoolsBackend, maxEvictTimeout time.Duration) *KubernetesNodePoolManager {
+// ASGNodePool. The metrics of the node pools are recorded for clusterID.
+// Nodes are drained according to drainPolicy.
+func NewKubernetesNodePoolManager(logger *log.Entry, clusterID string, kubeClient kubernetes.Interface, poolBackend ProviderNodePoolsBackend, maxEvictTimeout time.Duration, drainPolicy *DrainPolicy) *KubernetesNodePoolManager {
 	return &KubernetesNodePoolManager{
+		clusterID:       clusterID,
 		kube:            kubeClient,
 		backend:         poolBackend,
 		logger:          logger,
 		maxEvictTimeout: maxEvictTimeout,
+		drainPolicy:     drainPolicy,
+	}
+}
+
+// NewReadOnlyKubernetesNodePoolManager initializes a Kubernetes NodePool
+// manager which only observes the node pools, getting a node pool doesn't
+// change its nodes. It must not be used to update node pools.
+func NewReadOnlyKubernetesNodePoolManager(logger *log.Entry, clusterID string, kubeClient kubernetes.Interface, poolBackend ProviderNodePoolsBackend) *KubernetesNodePoolManager {
+	return &KubernetesNodePoolManager{
+		clusterID: clusterID,
+		kube:      kubeClient,
+		backend:   poolBackend,
+		logger:    logger,
+		readOnly:  true,
 	}
 }
 
@@ -90,10 +122,12 @@ func (m *KubernetesNodePoolManager) GetPool(nodePoolDesc *api.NodePool) (*NodePo
 	}
 
 	nodes := make([]*Node, 0, len(instanceIDMap))
+	var oldest time.Time
 
 	for _, npNode := range nodePool.Nodes {
 		if node, ok := instanceIDMap[npNode.ProviderID]; ok {
 			n := &Node{
+				NodePool:        nodePoolDesc.Name,
 				ProviderID:      npNode.ProviderID,
 				FailureDomain:   npNode.FailureDomain,
 				Generation:      npNode.Generation,
@@ -103,6 +137,28 @@ func (m *KubernetesNodePoolManager) GetPool(nodePoolDesc *api.NodePool) (*NodePo
 				Taints:          node.Spec.Taints,
 				Cordoned:        node.Spec.Unschedulable,
 				VolumesAttached: len(node.Status.VolumesAttached) > 0,
+				ConfigHash:      npNode.ConfigHash,
+			}
+
+			// nodes annotated with the current configuration hash are
+			// current and nodes annotated with a previous one are
+			// outdated, independent of what the backend reports.
+			// Current nodes launched with the current configuration
+			// are annotated so the generation is stable across runs.
+			if n.ConfigHash != "" {
+				switch node.Annotations[configHashAnnotation] {
+				case n.ConfigHash:
+					n.Generation = nodePool.Generation
+				case "":
+					if n.Generation == nodePool.Generation && npNode.LaunchConfigHash == n.ConfigHash && !m.readOnly {
+						err := m.annotateNode(n, configHashAnnotation, n.ConfigHash)
+						if err != nil {
+							return nil, err
+						}
+					}
+				default:
+					n.Generation = outdatedNodeGeneration
+				}
 			}
 
 			// TODO(mlarsen): Think about how this could be
@@ -114,6 +170,10 @@ func (m *KubernetesNodePoolManager) GetPool(nodePoolDesc *api.NodePool) (*NodePo
 			// 	n.Ready = v1.IsNodeReady(&node)
 			// }
 
+			if oldest.IsZero() || node.CreationTimestamp.Time.Before(oldest) {
+				oldest = node.CreationTimestamp.Time
+			}
+
 			nodes = append(nodes, n)
 		}
 	}
@@ -122,6 +182,7 @@ func (m *KubernetesNodePoolManager) GetPool(nodePoolDesc *api.NodePool) (*NodePo
 	// and thus doesn't include it in the list of nodes
 	nodePool.Current = len(nodes)
 	nodePool.Nodes = nodes
+	m.recordPoolMetrics(nodePoolDesc, nodePool, oldest)
 	return nodePool, nil
 }
 
@@ -153,6 +214,13 @@ func (m *KubernetesNodePoolManager) labelNode(node *Node, labelKey, labelValue s
 	return nil
 }
 
+// annotateNode annotates a Kubernetes node object.
+func (m *KubernetesNodePoolManager) annotateNode(node *Node, annotationKey, annotationValue string) error {
+	annotation := []byte(fmt.Sprintf(`{"metadata": {"annotations": {"%s": "%s"}}}`, annotationKey, annotationValue))
+	_, err := m.kube.CoreV1().Nodes().Patch(node.Name, types.StrategicMergePatchType, annotation)
+	return err
+}
+
 // updateTaint adds a taint with the provided key, value and effect if it isn't present or
 // updates an existing one. Returns true if anything was changed.
 func updateTaint(node *v1.Node, taintKey, taintValue string, effect v1.TaintEffect) bool {
@@ -230,9 +298,78 @@ func (m *KubernetesNodePoolManager) TerminateNode(ctx context.Context, node *Nod
 	return m.backend.Terminate(node, decrementDesired)
 }
 
+// HandleTerminations ensures the termination hook of the node pool is
+// configured with hookTimeout, 0 disables it, and drains the nodes held back
+// by the hook before letting their termination continue. It's a no-op for
+// backends without support for termination hooks.
+func (m *KubernetesNodePoolManager) HandleTerminations(ctx context.Context, nodePool *api.NodePool, hookTimeout time.Duration) error {
+	backend, ok := m.backend.(TerminationHookBackend)
+	if !ok {
+		return nil
+	}
+
+	err := backend.EnsureTerminationHook(nodePool, hookTimeout)
+	if err != nil {
+		return err
+	}
+
+	if hookTimeout == 0 {
+		return nil
+	}
+
+	terminating, err := backend.TerminatingNodes(nodePool)
+	if err != nil {
+		return err
+	}
+
+	if len(terminating) == 0 {
+		return nil
+	}
+
+	kubeNodes, err := m.kube.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]string, len(kubeNodes.Items))
+	for _, node := range kubeNodes.Items {
+		names[node.Spec.ProviderID] = node.Name
+	}
+
+	for _, node := range terminating {
+		// nodes which never registered have nothing to drain
+		if name, ok := names[node.ProviderID]; ok {
+			node.Name = name
+			node.NodePool = nodePool.Name
+			m.logger.WithField("node", node.Name).Info("Draining node terminated outside of the CLM")
+
+			err = m.CordonNode(node)
+			if err != nil {
+				return err
+			}
+
+			err = m.drain(ctx, node)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = backend.CompleteTermination(node)
+		if err != nil {
+			return err
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ScalePool scales a nodePool to the specified number of replicas.
 // On scale down it will attempt to do it gracefully by draining the nodes
-// before terminating them.
+// before terminating them. When scaling down to 0 replicas all nodes are
+// cordoned before the first one is drained.
 func (m *KubernetesNodePoolManager) ScalePool(ctx context.Context, nodePool *api.NodePool, replicas int) error {
 	var pool *NodePool
 	var err error
@@ -256,13 +393,22 @@ func (m *KubernetesNodePoolManager) ScalePool(ctx context.Context, nodePool *api
 			return fmt.Errorf("refusing to scale down: current %d, desired %d nodes", pool.Current, replicas)
 		}
 
-		// mark nodes to be removed
+		// mark nodes to be removed and cordon them all upfront so pods
+		// evicted from one node are not rescheduled to another node of
+		// the pool being removed.
 		if replicas == 0 {
 			for _, node := range pool.Nodes {
 				err := m.MarkNodeForDecommission(node)
 				if err != nil {
 					return err
 				}
+
+				if !node.Cordoned {
+					err = m.CordonNode(node)
+					if err != nil {
+						return err
+					}
+				}
 			}
 		}
 
@@ -298,10 +444,16 @@ func (m *KubernetesNodePoolManager) ScalePool(ctx context.Context, nodePool *api
 }
 
 // drain tries to evict all of the pods on a node.
-// pods are evicted in parallel.
+// pods are evicted in the waves of the drain policy, the pods of a wave in
+// parallel.
 func (m *KubernetesNodePoolManager) drain(ctx context.Context, node *Node) error {
 	m.logger.WithField("node", node.Name).Info("Draining node")
 
+	start := time.Now()
+	defer func() {
+		setGauge(nodePoolLastDrainDuration, m.metricsKey(node.NodePool), time.Since(start).Seconds())
+	}()
+
 	err := m.labelNode(node, lifecycleStatusLabel, lifecycleStatusDraining)
 	if err != nil {
 		return err
@@ -312,60 +464,64 @@ func (m *KubernetesNodePoolManager) drain(ctx context.Context, node *Node) error
 		return err
 	}
 
-	var evictionGroup errgroup.Group
-	for _, pod := range pods.Items {
-		pod := pod
-		evictionGroup.Go(func() error {
-			evictPod := func() error {
-				// we check at the start because there's a continue in the loop body
-				err := ctx.Err()
-				if err != nil {
-					return backoff.Permanent(err)
-				}
+	// evict the pods wave by wave, the pods of a wave in parallel
+	for _, wave := range m.drainPolicy.evictionWaves(pods.Items) {
+		var evictionGroup errgroup.Group
+		for _, pod := range wave {
+			pod := pod
+			evictionGroup.Go(func() error {
+				evictPod := func() error {
+					// we check at the start because there's a continue in the loop body
+					err := ctx.Err()
+					if err != nil {
+						return backoff.Permanent(err)
+					}
+
+					// Don't bother with this pod if it's not evictable.
+					if !m.isEvictablePod(pod) {
+						return nil
+					}
 
-				// Don't bother with this pod if it's not evictable.
-				if !m.isEvictablePod(pod) {
+					err = evictPod(m.kube, m.logger, &pod)
+					if err != nil {
+						nodePoolEvictionFailures.Add(m.metricsKey(node.NodePool), 1)
+						if apiErrors.IsTooManyRequests(err) || isMultiplePDBsErr(err) {
+							m.logger.WithFields(log.Fields{
+								"ns":   pod.Namespace,
+								"pod":  pod.Name,
+								"node": pod.Spec.NodeName,
+							}).Info("Pod Disruption Budget violated")
+						}
+						return err
+					}
 					return nil
 				}
 
-				err = evictPod(m.kube, m.logger, &pod)
+				// We try to evict all pods of a node by calling evict on all of them once. If we encounter an
+				// error we will backoff and try again for as long as `maxEvictTimeout`. If after `maxEvictTimeout`
+				// we still receive an error related to pod disruption budget violations we will continue and
+				// forcefully shutdown the pod in the next step.
+				backoffCfg := backoff.NewExponentialBackOff()
+				backoffCfg.MaxElapsedTime = m.maxEvictTimeout
+				err := backoff.Retry(evictPod, backoffCfg)
 				if err != nil {
-					if apiErrors.IsTooManyRequests(err) || isMultiplePDBsErr(err) {
+					if !apiErrors.IsTooManyRequests(err) && !isMultiplePDBsErr(err) {
 						m.logger.WithFields(log.Fields{
 							"ns":   pod.Namespace,
 							"pod":  pod.Name,
 							"node": pod.Spec.NodeName,
-						}).Info("Pod Disruption Budget violated")
+						}).Errorf("Failed to evict pod: %v", err)
+						return err
 					}
-					return err
 				}
 				return nil
-			}
-
-			// We try to evict all pods of a node by calling evict on all of them once. If we encounter an
-			// error we will backoff and try again for as long as `maxEvictTimeout`. If after `maxEvictTimeout`
-			// we still receive an error related to pod disruption budget violations we will continue and
-			// forcefully shutdown the pod in the next step.
-			backoffCfg := backoff.NewExponentialBackOff()
-			backoffCfg.MaxElapsedTime = m.maxEvictTimeout
-			err := backoff.Retry(evictPod, backoffCfg)
-			if err != nil {
-				if !apiErrors.IsTooManyRequests(err) && !isMultiplePDBsErr(err) {
-					m.logger.WithFields(log.Fields{
-						"ns":   pod.Namespace,
-						"pod":  pod.Name,
-						"node": pod.Spec.NodeName,
-					}).Errorf("Failed to evict pod: %v", err)
-					return err
-				}
-			}
-			return nil
-		})
-	}
+			})
+		}
 
-	err = evictionGroup.Wait()
-	if err != nil {
-		return err
+		err = evictionGroup.Wait()
+		if err != nil {
+			return err
+		}
 	}
 
 	// Delete all remaining evictable pods disregarding their pod disruption budgets. It's necessary
@@ -377,7 +533,7 @@ func (m *KubernetesNodePoolManager) drain(ctx context.Context, node *Node) error
 
 	var deleteGroup errgroup.Group
 	for _, pod := range pods.Items {
-		pod := pod
+		pod := m.drainPolicy.withGracePeriod(pod)
 
 		deleteGroup.Go(func() error {
 			// Don't bother with this pod if it's not evictable.
@@ -403,10 +559,17 @@ func (m *KubernetesNodePoolManager) drain(ctx context.Context, node *Node) error
 				return err
 			}
 
-			// wait for pod to be terminated and gone from the node.
+			// wait for pod to be terminated and gone from the node,
+			// force deleting it if it's stuck.
 			err = waitForPodTermination(m.kube, pod)
 			if err != nil {
 				logger.Warnf("Pod not terminated within grace period: %s", err)
+
+				err = m.forceDeletePod(logger, pod)
+				if err != nil {
+					logger.Errorf("Failed to force delete pod: %v", err)
+					return err
+				}
 			}
 
 			logger.Info("Pod deleted")
@@ -580,6 +743,9 @@ func WaitForDesiredNodes(ctx context.Context, logger *log.Entry, n NodePoolManag
 
 		select {
 		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, newNodesNotReadyError(nodePoolDesc.Name, nodePool, ctx.Err())
+			}
 			return nil, ctx.Err()
 		case <-time.After(operationCheckInterval):
 		}
@@ -587,3 +753,27 @@ func WaitForDesiredNodes(ctx context.Context, logger *log.Entry, n NodePoolManag
 
 	return nodePool, nil
 }
+
+// NodesNotReadyError is returned if the nodes of a node pool don't become
+// ready in time, e.g. because new instances fail to join the cluster.
+type NodesNotReadyError struct {
+	NodePool string
+	Ready    int
+	Desired  int
+	// ReadyNodes are the provider IDs of the ready nodes.
+	ReadyNodes []string
+	Err        error
+}
+
+func newNodesNotReadyError(name string, nodePool *NodePool, err error) *NodesNotReadyError {
+	result := &NodesNotReadyError{NodePool: name, Desired: nodePool.Desired, Err: err}
+	for _, node := range nodePool.ReadyNodes() {
+		result.ReadyNodes = append(result.ReadyNodes, node.ProviderID)
+	}
+	result.Ready = len(result.ReadyNodes)
+	return result
+}
+
+func (e *NodesNotReadyError) Error() string {
+	return fmt.Sprintf("only %d of %d nodes of node pool %s are ready: %v", e.Ready, e.Desired, e.NodePool, e.Err)
+}
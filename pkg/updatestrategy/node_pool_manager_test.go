@@ -2,6 +2,7 @@ package updatestrategy
 
 import (
 	"context"
+	"expvar"
 	"net/http"
 	"sync"
 	"sync/atomic"
@@ -17,6 +18,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/pkg/api/v1"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func setupMockKubernetes(t *testing.T, nodes []*v1.Node, pods []*v1.Pod) kubernetes.Interface {
@@ -69,6 +71,55 @@ func (n *mockProviderNodePoolsBackend) SuspendAutoscaling(nodePool *api.NodePool
 	return n.err
 }
 
+// mockTerminationHookBackend implements the TerminationHookBackend interface
+// for testing.
+type mockTerminationHookBackend struct {
+	mockProviderNodePoolsBackend
+	hookTimeout time.Duration
+	terminating []*Node
+	completed   []string
+}
+
+func (n *mockTerminationHookBackend) EnsureTerminationHook(nodePool *api.NodePool, timeout time.Duration) error {
+	n.hookTimeout = timeout
+	return n.err
+}
+
+func (n *mockTerminationHookBackend) TerminatingNodes(nodePool *api.NodePool) ([]*Node, error) {
+	return n.terminating, n.err
+}
+
+func (n *mockTerminationHookBackend) CompleteTermination(node *Node) error {
+	n.completed = append(n.completed, node.ProviderID)
+	return n.err
+}
+
+func TestHandleTerminations(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Spec:       v1.NodeSpec{ProviderID: "registered"},
+	}
+	backend := &mockTerminationHookBackend{
+		terminating: []*Node{{ProviderID: "registered"}, {ProviderID: "unregistered"}},
+	}
+	mgr := NewKubernetesNodePoolManager(log.WithField("test", true), "", setupMockKubernetes(t, []*v1.Node{node}, nil), backend, 0, nil)
+
+	// disabled hooks don't complete any terminations
+	err := mgr.HandleTerminations(context.Background(), &api.NodePool{Name: "test"}, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, backend.completed)
+
+	err = mgr.HandleTerminations(context.Background(), &api.NodePool{Name: "test"}, 10*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, backend.hookTimeout)
+	assert.Equal(t, []string{"registered", "unregistered"}, backend.completed)
+
+	// backends without termination hooks are ignored
+	mgr = NewKubernetesNodePoolManager(log.WithField("test", true), "", setupMockKubernetes(t, nil, nil), &mockProviderNodePoolsBackend{}, 0, nil)
+	err = mgr.HandleTerminations(context.Background(), &api.NodePool{Name: "test"}, 10*time.Minute)
+	assert.NoError(t, err)
+}
+
 func TestGetPool(t *testing.T) {
 	node := &v1.Node{
 		ObjectMeta: metav1.ObjectMeta{
@@ -93,9 +144,11 @@ func TestGetPool(t *testing.T) {
 	}
 	mgr := NewKubernetesNodePoolManager(
 		logger,
+		"",
 		setupMockKubernetes(t, []*v1.Node{node}, nil),
 		backend,
 		0,
+		nil,
 	)
 
 	// test getting nodes successfully
@@ -114,6 +167,130 @@ func TestGetPool(t *testing.T) {
 	assert.Equal(t, nodePool.Nodes[0].Labels[lifecycleStatusLabel], lifecycleStatusDraining)
 }
 
+func TestGetPoolMetrics(t *testing.T) {
+	created := metav1.NewTime(time.Now().Add(-time.Hour))
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "old", CreationTimestamp: created},
+			Spec:       v1.NodeSpec{ProviderID: "old"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "new", CreationTimestamp: metav1.Now()},
+			Spec:       v1.NodeSpec{ProviderID: "new"},
+		},
+	}
+	backend := &mockProviderNodePoolsBackend{
+		nodePool: &NodePool{
+			Generation: 2,
+			Nodes: []*Node{
+				{ProviderID: "old", Generation: 1},
+				{ProviderID: "new", Generation: 2},
+			},
+		},
+	}
+	mgr := NewKubernetesNodePoolManager(log.WithField("test", true), "kube-1", setupMockKubernetes(t, nodes, nil), backend, 0, nil)
+
+	_, err := mgr.GetPool(&api.NodePool{Name: "metrics"})
+	assert.NoError(t, err)
+
+	age := nodePoolOldestNodeAge.Get("kube-1/metrics").(*expvar.Float).Value()
+	assert.InDelta(t, time.Hour.Seconds(), age, 60)
+	assert.Equal(t, 1.0, nodePoolPendingReplacement.Get("kube-1/metrics").(*expvar.Float).Value())
+}
+
+func TestGetPoolConfigHash(t *testing.T) {
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "annotated",
+				Annotations: map[string]string{configHashAnnotation: "abc"},
+			},
+			Spec: v1.NodeSpec{ProviderID: "annotated"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "outdated",
+				Annotations: map[string]string{configHashAnnotation: "def"},
+			},
+			Spec: v1.NodeSpec{ProviderID: "outdated"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "stale",
+				Annotations: map[string]string{configHashAnnotation: "def"},
+			},
+			Spec: v1.NodeSpec{ProviderID: "stale"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "current"},
+			Spec:       v1.NodeSpec{ProviderID: "current"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "unknown"},
+			Spec:       v1.NodeSpec{ProviderID: "unknown"},
+		},
+	}
+	backend := &mockProviderNodePoolsBackend{
+		nodePool: &NodePool{
+			Generation: currentNodeGeneration,
+			Nodes: []*Node{
+				{ProviderID: "annotated", Generation: outdatedNodeGeneration, ConfigHash: "abc"},
+				{ProviderID: "outdated", Generation: outdatedNodeGeneration, ConfigHash: "abc"},
+				{ProviderID: "stale", Generation: currentNodeGeneration, ConfigHash: "abc", LaunchConfigHash: "def"},
+				{ProviderID: "current", Generation: currentNodeGeneration, ConfigHash: "abc", LaunchConfigHash: "abc"},
+				{ProviderID: "unknown", Generation: currentNodeGeneration, ConfigHash: "abc"},
+			},
+		},
+	}
+	kube := setupMockKubernetes(t, nodes, nil)
+	mgr := NewKubernetesNodePoolManager(log.WithField("test", true), "", kube, backend, 0, nil)
+
+	nodePool, err := mgr.GetPool(&api.NodePool{Name: "test"})
+	assert.NoError(t, err)
+	assert.Len(t, nodePool.Nodes, 5)
+	assert.Equal(t, currentNodeGeneration, nodePool.Nodes[0].Generation)
+	assert.Equal(t, outdatedNodeGeneration, nodePool.Nodes[1].Generation)
+	assert.Equal(t, outdatedNodeGeneration, nodePool.Nodes[2].Generation)
+	assert.Equal(t, currentNodeGeneration, nodePool.Nodes[3].Generation)
+	assert.Equal(t, currentNodeGeneration, nodePool.Nodes[4].Generation)
+
+	// only nodes launched with the current configuration are annotated
+	assert.Equal(t, []string{"current"}, patchedNodes(kube))
+}
+
+// patchedNodes returns the names of the nodes patched with the fake client.
+func patchedNodes(kube kubernetes.Interface) []string {
+	var names []string
+	for _, action := range kube.(*fake.Clientset).Actions() {
+		if patch, ok := action.(k8stesting.PatchActionImpl); ok && patch.GetResource().Resource == "nodes" {
+			names = append(names, patch.GetName())
+		}
+	}
+	return names
+}
+
+func TestGetPoolReadOnly(t *testing.T) {
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "current"},
+			Spec:       v1.NodeSpec{ProviderID: "current"},
+		},
+	}
+	backend := &mockProviderNodePoolsBackend{
+		nodePool: &NodePool{
+			Generation: currentNodeGeneration,
+			Nodes:      []*Node{{ProviderID: "current", Generation: currentNodeGeneration, ConfigHash: "abc", LaunchConfigHash: "abc"}},
+		},
+	}
+	kube := setupMockKubernetes(t, nodes, nil)
+	mgr := NewReadOnlyKubernetesNodePoolManager(log.WithField("test", true), "", kube, backend)
+
+	nodePool, err := mgr.GetPool(&api.NodePool{Name: "test"})
+	assert.NoError(t, err)
+	assert.Len(t, nodePool.Nodes, 1)
+	assert.Empty(t, patchedNodes(kube))
+}
+
 func TestLabelNodes(t *testing.T) {
 	node := &v1.Node{
 		ObjectMeta: metav1.ObjectMeta{
@@ -542,3 +719,24 @@ func TestTerminateNodeCancelled(t *testing.T) {
 		assert.Error(t, err)
 	}
 }
+
+func TestWaitForDesiredNodesNotReady(t *testing.T) {
+	manager := &mockNodePoolManager{nodePool: &NodePool{
+		Desired: 2,
+		Nodes: []*Node{
+			{ProviderID: "aws:///eu-central-1a/i-1", Ready: true},
+			{ProviderID: "aws:///eu-central-1b/i-2"},
+		},
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := WaitForDesiredNodes(ctx, log.WithField("test", true), manager, &api.NodePool{Name: "worker"})
+	notReady, ok := err.(*NodesNotReadyError)
+	assert.True(t, ok)
+	assert.Equal(t, 1, notReady.Ready)
+	assert.Equal(t, 2, notReady.Desired)
+	assert.Equal(t, []string{"aws:///eu-central-1a/i-1"}, notReady.ReadyNodes)
+	assert.Equal(t, "only 1 of 2 nodes of node pool worker are ready: context deadline exceeded", err.Error())
+}
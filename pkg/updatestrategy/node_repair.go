@@ -0,0 +1,100 @@
+package updatestrategy
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// RepairNodes terminates a node of the node pool which has been NotReady for
+// longer than notReadyTimeout so it's replaced by the node pool backend. The
+// node is drained first, but failing to drain it doesn't prevent the
+// termination as the pods of a NotReady node usually can't be evicted. Only
+// one node is repaired per call so a problem affecting all the nodes, e.g.
+// of the network, doesn't terminate the whole node pool at once. The
+// terminated node is returned, or nil if no node was repaired.
+func (m *KubernetesNodePoolManager) RepairNodes(ctx context.Context, nodePool *api.NodePool, notReadyTimeout time.Duration) (*Node, error) {
+	pool, err := m.backend.Get(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pool.Nodes) == 0 {
+		return nil, nil
+	}
+
+	kubeNodes, err := m.kube.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	instanceIDMap := make(map[string]v1.Node, len(kubeNodes.Items))
+	for _, node := range kubeNodes.Items {
+		instanceIDMap[node.Spec.ProviderID] = node
+	}
+
+	now := time.Now()
+	for _, npNode := range pool.Nodes {
+		kubeNode, ok := instanceIDMap[npNode.ProviderID]
+		if !ok {
+			// nodes which never registered are left to the health
+			// checks of the node pool backend
+			continue
+		}
+
+		since, notReady := nodeNotReadySince(&kubeNode)
+		if !notReady || now.Sub(since) < notReadyTimeout {
+			continue
+		}
+
+		node := &Node{
+			Name:       kubeNode.Name,
+			NodePool:   nodePool.Name,
+			ProviderID: npNode.ProviderID,
+		}
+		logger := m.logger.WithFields(log.Fields{"node": node.Name, "node-pool": nodePool.Name})
+		logger.Warnf("Repairing node NotReady since %s", since.Format(time.RFC3339))
+
+		err = m.CordonNode(node)
+		if err != nil {
+			logger.Warnf("Failed to cordon node: %v", err)
+		}
+
+		err = m.drain(ctx, node)
+		if err != nil {
+			logger.Warnf("Failed to drain node, terminating it anyway: %v", err)
+		}
+
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		err = m.backend.Terminate(node, false)
+		if err != nil {
+			return nil, err
+		}
+		nodePoolRepairedNodes.Add(m.metricsKey(nodePool.Name), 1)
+		return node, nil
+	}
+	return nil, nil
+}
+
+// nodeNotReadySince returns since when the node isn't ready and true, or
+// false if the node is ready. Nodes without a Ready condition are considered
+// not ready since they were created.
+func nodeNotReadySince(node *v1.Node) (time.Time, bool) {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != v1.NodeReady {
+			continue
+		}
+		if condition.Status == v1.ConditionTrue {
+			return time.Time{}, false
+		}
+		return condition.LastTransitionTime.Time, true
+	}
+	return node.CreationTimestamp.Time, true
+}
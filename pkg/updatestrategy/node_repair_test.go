@@ -0,0 +1,71 @@
+package updatestrategy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func kubeNode(name string, ready v1.ConditionStatus, since time.Time) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1.NodeSpec{ProviderID: name},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: ready, LastTransitionTime: metav1.NewTime(since)},
+			},
+		},
+	}
+}
+
+func TestRepairNodes(t *testing.T) {
+	nodes := []*v1.Node{
+		kubeNode("ready", v1.ConditionTrue, time.Now().Add(-time.Hour)),
+		kubeNode("not-ready", v1.ConditionFalse, time.Now().Add(-time.Hour)),
+		kubeNode("recently-not-ready", v1.ConditionUnknown, time.Now()),
+	}
+	backend := &mockProviderNodePoolsBackend{
+		nodePool: &NodePool{
+			Nodes: []*Node{
+				{Name: "ready", ProviderID: "ready"},
+				{Name: "not-ready", ProviderID: "not-ready"},
+				{Name: "recently-not-ready", ProviderID: "recently-not-ready"},
+				{Name: "unregistered", ProviderID: "unregistered"},
+			},
+		},
+	}
+	mgr := NewKubernetesNodePoolManager(log.WithField("test", true), "", setupMockKubernetes(t, nodes, nil), backend, 0, nil)
+
+	node, err := mgr.RepairNodes(context.Background(), &api.NodePool{Name: "test"}, 10*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "not-ready", node.Name)
+	assert.Len(t, backend.nodePool.Nodes, 3)
+
+	// the other nodes are either ready or within the timeout
+	node, err = mgr.RepairNodes(context.Background(), &api.NodePool{Name: "test"}, 10*time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, node)
+}
+
+func TestNodeNotReadySince(t *testing.T) {
+	since := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	_, notReady := nodeNotReadySince(kubeNode("ready", v1.ConditionTrue, since))
+	assert.False(t, notReady)
+
+	notReadySince, notReady := nodeNotReadySince(kubeNode("not-ready", v1.ConditionFalse, since))
+	assert.True(t, notReady)
+	assert.Equal(t, since, notReadySince)
+
+	// nodes without conditions aren't ready since they were created
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(since)}}
+	notReadySince, notReady = nodeNotReadySince(node)
+	assert.True(t, notReady)
+	assert.Equal(t, since, notReadySince)
+}
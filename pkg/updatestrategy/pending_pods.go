@@ -0,0 +1,76 @@
+package updatestrategy
+
+import (
+	"math"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// podReasonUnschedulable is the reason of the PodScheduled condition of pods
+// the scheduler failed to find a node for.
+const podReasonUnschedulable = "Unschedulable"
+
+// NodesForPendingPods returns the number of nodes like the ones of the node
+// pool needed to fit the resource requests of the pods the scheduler failed
+// to schedule. The size of a node is the allocatable CPU and memory of the
+// first ready node of the node pool, 0 is returned if there is none.
+func (m *KubernetesNodePoolManager) NodesForPendingPods(nodePool *NodePool) (int, error) {
+	var allocatable v1.ResourceList
+	for _, node := range nodePool.ReadyNodes() {
+		kubeNode, err := m.kube.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+		if err != nil {
+			return 0, err
+		}
+		allocatable = kubeNode.Status.Allocatable
+		break
+	}
+
+	cpu := allocatable[v1.ResourceCPU]
+	memory := allocatable[v1.ResourceMemory]
+	if cpu.IsZero() || memory.IsZero() {
+		return 0, nil
+	}
+
+	pods, err := m.kube.CoreV1().Pods(v1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: "status.phase=" + string(v1.PodPending),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var requestedCPU, requestedMemory int64
+	for _, pod := range pods.Items {
+		if !unschedulable(&pod) {
+			continue
+		}
+		for _, container := range pod.Spec.Containers {
+			if request, ok := container.Resources.Requests[v1.ResourceCPU]; ok {
+				requestedCPU += request.MilliValue()
+			}
+			if request, ok := container.Resources.Requests[v1.ResourceMemory]; ok {
+				requestedMemory += request.Value()
+			}
+		}
+	}
+
+	nodes := math.Max(
+		float64(requestedCPU)/float64(cpu.MilliValue()),
+		float64(requestedMemory)/float64(memory.Value()),
+	)
+	return int(math.Ceil(nodes)), nil
+}
+
+// unschedulable returns true if the scheduler failed to find a node for the
+// pod.
+func unschedulable(pod *v1.Pod) bool {
+	if pod.Spec.NodeName != "" {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Reason == podReasonUnschedulable {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package updatestrategy
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func pendingPod(name, cpu, memory string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Resources: v1.ResourceRequirements{
+						Requests: v1.ResourceList{
+							v1.ResourceCPU:    resource.MustParse(cpu),
+							v1.ResourceMemory: resource.MustParse(memory),
+						},
+					},
+				},
+			},
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodScheduled, Status: v1.ConditionFalse, Reason: podReasonUnschedulable},
+			},
+		},
+	}
+}
+
+func TestNodesForPendingPods(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("2"),
+				v1.ResourceMemory: resource.MustParse("8Gi"),
+			},
+		},
+	}
+	scheduled := pendingPod("scheduled", "4", "1Gi")
+	scheduled.Spec.NodeName = "node-1"
+
+	pods := []*v1.Pod{
+		pendingPod("cpu", "1500m", "1Gi"),
+		pendingPod("memory", "100m", "10Gi"),
+		scheduled,
+	}
+	mgr := NewKubernetesNodePoolManager(log.WithField("test", true), "", setupMockKubernetes(t, []*v1.Node{node}, pods), nil, 0, nil)
+
+	// 11Gi of memory need two nodes
+	nodes, err := mgr.NodesForPendingPods(&NodePool{Nodes: []*Node{{Name: "node-1", Ready: true}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, nodes)
+
+	// the size of the nodes is unknown without ready nodes
+	nodes, err = mgr.NodesForPendingPods(&NodePool{Nodes: []*Node{{Name: "node-1"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, nodes)
+}
@@ -0,0 +1,241 @@
+package updatestrategy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	progressConfigMapPrefix = "cluster-lifecycle-manager-update-"
+	progressConfigMapKey    = "progress"
+)
+
+// UpdateProgress describes the progress of the update of a node pool.
+type UpdateProgress struct {
+	// Configuration identifies the configuration the nodes are updated
+	// to.
+	Configuration string `json:"configuration"`
+	// Started is the time the update was started.
+	Started time.Time `json:"started"`
+	// OldNodes are the provider IDs of the nodes which were outdated when
+	// the update was started.
+	OldNodes []string `json:"old_nodes"`
+	// Replaced are the provider IDs of the old nodes which were already
+	// terminated.
+	Replaced []string `json:"replaced"`
+}
+
+// isOld returns true if the node was outdated when the update was started.
+func (p *UpdateProgress) isOld(providerID string) bool {
+	for _, id := range p.OldNodes {
+		if id == providerID {
+			return true
+		}
+	}
+	return false
+}
+
+// ProgressStore defines an interface for persisting the progress of node pool
+// updates.
+type ProgressStore interface {
+	// Load returns the progress of the update of the node pool or nil if
+	// no update is in progress.
+	Load(nodePool *api.NodePool) (*UpdateProgress, error)
+	Save(nodePool *api.NodePool, progress *UpdateProgress) error
+	Delete(nodePool *api.NodePool) error
+}
+
+// ConfigMapProgressStore persists the progress of node pool updates as
+// ConfigMaps in the cluster.
+type ConfigMapProgressStore struct {
+	kube      kubernetes.Interface
+	namespace string
+}
+
+// NewConfigMapProgressStore initializes a new ConfigMapProgressStore storing
+// the ConfigMaps in the specified namespace.
+func NewConfigMapProgressStore(kubeClient kubernetes.Interface, namespace string) *ConfigMapProgressStore {
+	return &ConfigMapProgressStore{
+		kube:      kubeClient,
+		namespace: namespace,
+	}
+}
+
+// Load returns the progress of the update of the node pool.
+func (s *ConfigMapProgressStore) Load(nodePool *api.NodePool) (*UpdateProgress, error) {
+	configMap, err := s.kube.CoreV1().ConfigMaps(s.namespace).Get(progressConfigMapPrefix+nodePool.Name, metav1.GetOptions{})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var progress UpdateProgress
+	err = json.Unmarshal([]byte(configMap.Data[progressConfigMapKey]), &progress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update progress of node pool '%s': %v", nodePool.Name, err)
+	}
+	return &progress, nil
+}
+
+// Save persists the progress of the update of the node pool.
+func (s *ConfigMapProgressStore) Save(nodePool *api.NodePool, progress *UpdateProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      progressConfigMapPrefix + nodePool.Name,
+			Namespace: s.namespace,
+		},
+		Data: map[string]string{
+			progressConfigMapKey: string(data),
+		},
+	}
+
+	_, err = s.kube.CoreV1().ConfigMaps(s.namespace).Update(configMap)
+	if err != nil && apiErrors.IsNotFound(err) {
+		_, err = s.kube.CoreV1().ConfigMaps(s.namespace).Create(configMap)
+	}
+	return err
+}
+
+// Delete deletes the progress of the update of the node pool.
+func (s *ConfigMapProgressStore) Delete(nodePool *api.NodePool) error {
+	err := s.kube.CoreV1().ConfigMaps(s.namespace).Delete(progressConfigMapPrefix+nodePool.Name, &metav1.DeleteOptions{})
+	if err != nil && !apiErrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// ProgressTrackingNodePoolManager wraps a NodePoolManager and persists the
+// progress of node pool updates so an interrupted update, e.g. because the
+// CLM was restarted, is resumed instead of started over. Nodes launched
+// during an update to the same configuration are considered current even if
+// the backend reports them as outdated.
+type ProgressTrackingNodePoolManager struct {
+	NodePoolManager
+	store  ProgressStore
+	logger *log.Entry
+
+	sync.Mutex
+	// pools maps the provider IDs of old nodes to their node pool.
+	pools map[string]*api.NodePool
+}
+
+// NewProgressTrackingNodePoolManager initializes a new
+// ProgressTrackingNodePoolManager.
+func NewProgressTrackingNodePoolManager(logger *log.Entry, manager NodePoolManager, store ProgressStore) *ProgressTrackingNodePoolManager {
+	return &ProgressTrackingNodePoolManager{
+		NodePoolManager: manager,
+		store:           store,
+		logger:          logger,
+		pools:           make(map[string]*api.NodePool),
+	}
+}
+
+// GetPool gets the node pool and starts, resumes or finishes tracking the
+// progress of its update.
+func (m *ProgressTrackingNodePoolManager) GetPool(nodePoolDesc *api.NodePool) (*NodePool, error) {
+	nodePool, err := m.NodePoolManager.GetPool(nodePoolDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	progress, err := m.store.Load(nodePoolDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	// nodes launched during the update are current
+	if progress != nil && progress.Configuration == nodePool.Configuration {
+		for _, node := range nodePool.Nodes {
+			if !progress.isOld(node.ProviderID) {
+				node.Generation = nodePool.Generation
+			}
+		}
+	}
+
+	var oldNodes []string
+	for _, node := range nodePool.Nodes {
+		if node.Generation != nodePool.Generation {
+			oldNodes = append(oldNodes, node.ProviderID)
+		}
+	}
+
+	if len(oldNodes) == 0 {
+		if progress != nil {
+			return nodePool, m.store.Delete(nodePoolDesc)
+		}
+		return nodePool, nil
+	}
+
+	switch {
+	case progress == nil || progress.Configuration != nodePool.Configuration:
+		progress = &UpdateProgress{
+			Configuration: nodePool.Configuration,
+			Started:       time.Now().UTC(),
+			OldNodes:      oldNodes,
+		}
+		err = m.store.Save(nodePoolDesc, progress)
+		if err != nil {
+			return nil, err
+		}
+	case !m.tracked(oldNodes[0]):
+		m.logger.Infof("Resuming update of node pool '%s' started at %s, %d of %d nodes replaced", nodePoolDesc.Name, progress.Started.Format(time.RFC3339), len(progress.Replaced), len(progress.OldNodes))
+	}
+
+	m.Lock()
+	for _, providerID := range oldNodes {
+		m.pools[providerID] = nodePoolDesc
+	}
+	m.Unlock()
+
+	return nodePool, nil
+}
+
+// tracked returns true if the node is tracked as an old node.
+func (m *ProgressTrackingNodePoolManager) tracked(providerID string) bool {
+	m.Lock()
+	defer m.Unlock()
+	_, ok := m.pools[providerID]
+	return ok
+}
+
+// TerminateNode terminates the node and records it as replaced.
+func (m *ProgressTrackingNodePoolManager) TerminateNode(ctx context.Context, node *Node, decrementDesired bool) error {
+	err := m.NodePoolManager.TerminateNode(ctx, node, decrementDesired)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	nodePoolDesc, ok := m.pools[node.ProviderID]
+	delete(m.pools, node.ProviderID)
+	m.Unlock()
+	if !ok {
+		return nil
+	}
+
+	progress, err := m.store.Load(nodePoolDesc)
+	if err != nil || progress == nil {
+		return err
+	}
+
+	progress.Replaced = append(progress.Replaced, node.ProviderID)
+	return m.store.Save(nodePoolDesc, progress)
+}
@@ -0,0 +1,118 @@
+package updatestrategy
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapProgressStore(t *testing.T) {
+	store := NewConfigMapProgressStore(fake.NewSimpleClientset(), "kube-system")
+	nodePool := &api.NodePool{Name: "default-worker"}
+
+	progress, err := store.Load(nodePool)
+	require.NoError(t, err)
+	require.Nil(t, progress)
+
+	require.NoError(t, store.Save(nodePool, &UpdateProgress{Configuration: "lc-1", OldNodes: []string{"a"}}))
+	require.NoError(t, store.Save(nodePool, &UpdateProgress{Configuration: "lc-1", OldNodes: []string{"a"}, Replaced: []string{"a"}}))
+
+	progress, err = store.Load(nodePool)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, progress.Replaced)
+
+	require.NoError(t, store.Delete(nodePool))
+	require.NoError(t, store.Delete(nodePool))
+
+	progress, err = store.Load(nodePool)
+	require.NoError(t, err)
+	require.Nil(t, progress)
+}
+
+func TestProgressTrackingNodePoolManager(t *testing.T) {
+	logger := log.WithField("test", true)
+	store := NewConfigMapProgressStore(fake.NewSimpleClientset(), "kube-system")
+	nodePoolDesc := &api.NodePool{Name: "default-worker"}
+
+	old1 := mockNode("a", outdatedNodeGeneration, false, false)
+	old2 := mockNode("b", outdatedNodeGeneration, false, false)
+	current := mockNode("a", currentNodeGeneration, false, false)
+	backend := &mockNodePoolManager{
+		nodePool: &NodePool{
+			Generation:    currentNodeGeneration,
+			Configuration: "lc-2",
+			Current:       3,
+			Desired:       3,
+			Nodes:         []*Node{old1, old2, current},
+		},
+	}
+
+	manager := NewProgressTrackingNodePoolManager(logger, backend, store)
+	_, err := manager.GetPool(nodePoolDesc)
+	require.NoError(t, err)
+
+	progress, err := store.Load(nodePoolDesc)
+	require.NoError(t, err)
+	require.Equal(t, "lc-2", progress.Configuration)
+	require.Equal(t, []string{old1.ProviderID, old2.ProviderID}, progress.OldNodes)
+
+	require.NoError(t, manager.TerminateNode(context.Background(), old1, true))
+	progress, err = store.Load(nodePoolDesc)
+	require.NoError(t, err)
+	require.Equal(t, []string{old1.ProviderID}, progress.Replaced)
+
+	// a restarted manager resumes the update and considers nodes launched
+	// during the update current
+	launched := mockNode("b", outdatedNodeGeneration, false, false)
+	backend.nodePool.Nodes = append(backend.nodePool.Nodes, launched)
+
+	manager = NewProgressTrackingNodePoolManager(logger, backend, store)
+	nodePool, err := manager.GetPool(nodePoolDesc)
+	require.NoError(t, err)
+	assert.Equal(t, currentNodeGeneration, launched.Generation)
+	assert.Equal(t, outdatedNodeGeneration, old2.Generation)
+	require.Len(t, nodePool.Nodes, 3)
+
+	progress, err = store.Load(nodePoolDesc)
+	require.NoError(t, err)
+	require.Equal(t, []string{old1.ProviderID}, progress.Replaced)
+
+	// the progress is removed once the update is done
+	require.NoError(t, manager.TerminateNode(context.Background(), old2, true))
+	_, err = manager.GetPool(nodePoolDesc)
+	require.NoError(t, err)
+
+	progress, err = store.Load(nodePoolDesc)
+	require.NoError(t, err)
+	require.Nil(t, progress)
+}
+
+func TestProgressTrackingNodePoolManagerConfigurationChange(t *testing.T) {
+	store := NewConfigMapProgressStore(fake.NewSimpleClientset(), "kube-system")
+	nodePoolDesc := &api.NodePool{Name: "default-worker"}
+	require.NoError(t, store.Save(nodePoolDesc, &UpdateProgress{Configuration: "lc-1", OldNodes: []string{"a"}, Replaced: []string{"a"}}))
+
+	old := mockNode("a", outdatedNodeGeneration, false, false)
+	backend := &mockNodePoolManager{
+		nodePool: &NodePool{
+			Generation:    currentNodeGeneration,
+			Configuration: "lc-2",
+			Nodes:         []*Node{old},
+		},
+	}
+
+	manager := NewProgressTrackingNodePoolManager(log.WithField("test", true), backend, store)
+	_, err := manager.GetPool(nodePoolDesc)
+	require.NoError(t, err)
+
+	progress, err := store.Load(nodePoolDesc)
+	require.NoError(t, err)
+	require.Equal(t, "lc-2", progress.Configuration)
+	require.Equal(t, []string{old.ProviderID}, progress.OldNodes)
+	require.Empty(t, progress.Replaced)
+}
@@ -20,15 +20,20 @@ var (
 type RollingUpdateStrategy struct {
 	nodePoolManager NodePoolManager
 	surge           int
-	logger          *log.Entry
+	// maxPendingScaleUp is the maximum number of nodes added on top of the
+	// surge for pods which can't be scheduled while old nodes are drained,
+	// 0 disables it.
+	maxPendingScaleUp int
+	logger            *log.Entry
 }
 
 // NewRollingUpdateStrategy initializes a new RollingUpdateStrategy.
-func NewRollingUpdateStrategy(logger *log.Entry, nodePoolManager NodePoolManager, surge int) *RollingUpdateStrategy {
+func NewRollingUpdateStrategy(logger *log.Entry, nodePoolManager NodePoolManager, surge, maxPendingScaleUp int) *RollingUpdateStrategy {
 	return &RollingUpdateStrategy{
-		nodePoolManager: nodePoolManager,
-		surge:           surge,
-		logger:          logger.WithField("strategy", "rolling"),
+		nodePoolManager:   nodePoolManager,
+		surge:             surge,
+		maxPendingScaleUp: maxPendingScaleUp,
+		logger:            logger.WithField("strategy", "rolling"),
 	}
 }
 
@@ -102,6 +107,34 @@ func (r *RollingUpdateStrategy) increaseByUnmatchedNodes(ctx context.Context, no
 	return nil
 }
 
+// scaleUpForPendingPods increases the node pool by the number of nodes needed
+// for the pods which can't be scheduled, e.g. after draining old nodes. At
+// most maxPendingScaleUp nodes are added per update, extra is the number of
+// nodes already added. The new number of extra nodes is returned.
+func (r *RollingUpdateStrategy) scaleUpForPendingPods(ctx context.Context, nodePool *NodePool, nodePoolDesc *api.NodePool, extra int) (int, error) {
+	if extra >= r.maxPendingScaleUp {
+		return extra, nil
+	}
+
+	needed, err := r.nodePoolManager.NodesForPendingPods(nodePool)
+	if err != nil {
+		return extra, err
+	}
+
+	add := int(math.Min(float64(needed), float64(r.maxPendingScaleUp-extra)))
+	add = int(math.Min(float64(add), float64(int(nodePoolDesc.MaxSize)-nodePool.Desired)))
+	if add <= 0 {
+		return extra, nil
+	}
+
+	r.logger.Infof("Adding %d nodes to node pool '%s' for pending pods", add, nodePoolDesc.Name)
+	err = r.nodePoolManager.ScalePool(ctx, nodePoolDesc, nodePool.Desired+add)
+	if err != nil {
+		return extra, err
+	}
+	return extra + add, nil
+}
+
 // Update performs a rolling update of a single node pool. Passing a context
 // allows stopping the update loop in case the context is canceled.
 func (r *RollingUpdateStrategy) Update(ctx context.Context, nodePoolDesc *api.NodePool) error {
@@ -114,6 +147,10 @@ func (r *RollingUpdateStrategy) Update(ctx context.Context, nodePoolDesc *api.No
 	// limit surge to max size of the node pool
 	surge := int(math.Min(float64(nodePoolDesc.MaxSize), float64(r.surge)))
 
+	// nodes added for pending pods, they're removed again by not replacing
+	// the last old nodes.
+	extra := 0
+
 	for {
 		// wait/scale to ensure that we have at least 'surge' new nodes in the node pool
 		nodePool, err := r.scaleOutAndWaitForNodesToBeReady(ctx, nodePoolDesc, surge)
@@ -139,10 +176,17 @@ func (r *RollingUpdateStrategy) Update(ctx context.Context, nodePoolDesc *api.No
 			break
 		}
 
+		// add capacity for pods which couldn't be scheduled after
+		// draining the previous nodes
+		extra, err = r.scaleUpForPendingPods(ctx, nodePool, nodePoolDesc, extra)
+		if err != nil {
+			return err
+		}
+
 		// terminate all cordoned nodes and conditionally scale
-		// down the node pool in case there are less than surge old
-		// nodes left to update
-		err = r.terminateCordonedNodes(ctx, nodePool, surge)
+		// down the node pool in case there are less than surge (plus
+		// the nodes added for pending pods) old nodes left to update
+		err = r.terminateCordonedNodes(ctx, nodePool, surge+extra)
 		if err != nil {
 			return err
 		}
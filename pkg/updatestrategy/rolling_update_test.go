@@ -40,7 +40,8 @@ func mockNode(failureDomain string, generation int, cordoned, volumesAttached bo
 // mockNodePoolManager implements the NodePoolManager interface for testing. It
 // works by maintaining a NodePool.
 type mockNodePoolManager struct {
-	nodePool *NodePool
+	nodePool     *NodePool
+	pendingNodes int
 }
 
 func (m *mockNodePoolManager) GetPool(nodePool *api.NodePool) (*NodePool, error) {
@@ -92,6 +93,22 @@ func (m *mockNodePoolManager) TerminateNode(ctx context.Context, node *Node, dec
 	return nil
 }
 
+func (m *mockNodePoolManager) HandleTerminations(ctx context.Context, nodePool *api.NodePool, hookTimeout time.Duration) error {
+	return nil
+}
+
+func (m *mockNodePoolManager) NodesForPendingPods(nodePool *NodePool) (int, error) {
+	return m.pendingNodes, nil
+}
+
+func (m *mockNodePoolManager) ForceDeletedPods() []string {
+	return nil
+}
+
+func (m *mockNodePoolManager) RepairNodes(ctx context.Context, nodePool *api.NodePool, notReadyTimeout time.Duration) (*Node, error) {
+	return nil, nil
+}
+
 func (m *mockNodePoolManager) CordonNode(node *Node) error {
 	for _, n := range m.nodePool.Nodes {
 		if n.ProviderID == node.ProviderID {
@@ -273,7 +290,7 @@ func TestUpdate(tt *testing.T) {
 		tt.Run(tc.msg, func(t *testing.T) {
 			logger := log.WithField("test", true)
 			np := &api.NodePool{Name: "test", MaxSize: tc.nodePoolMaxSize}
-			strategy := NewRollingUpdateStrategy(logger, tc.nodePoolManager, tc.surge)
+			strategy := NewRollingUpdateStrategy(logger, tc.nodePoolManager, tc.surge, 0)
 			err := strategy.Update(context.Background(), np)
 			if err != nil && tc.success {
 				t.Errorf("should not fail: %v", err)
@@ -320,3 +337,44 @@ func equalNodePool(a, b *NodePool) bool {
 
 	return true
 }
+
+func TestScaleUpForPendingPods(t *testing.T) {
+	for _, tc := range []struct {
+		msg          string
+		pendingNodes int
+		maxScaleUp   int
+		maxSize      int64
+		extra        int
+		expected     int
+	}{
+		{msg: "disabled", pendingNodes: 2, maxScaleUp: 0, maxSize: 10, expected: 0},
+		{msg: "no pending pods", pendingNodes: 0, maxScaleUp: 3, maxSize: 10, expected: 0},
+		{msg: "pending pods", pendingNodes: 2, maxScaleUp: 3, maxSize: 10, expected: 2},
+		{msg: "limited by max scale up", pendingNodes: 5, maxScaleUp: 3, maxSize: 10, extra: 1, expected: 3},
+		{msg: "limited by max size", pendingNodes: 5, maxScaleUp: 3, maxSize: 3, expected: 1},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			manager := &mockNodePoolManager{
+				nodePool: &NodePool{
+					Current:    2,
+					Desired:    2,
+					Generation: 1,
+					Nodes:      []*Node{mockNode("a", 0, true, false), mockNode("b", 1, false, false)},
+				},
+				pendingNodes: tc.pendingNodes,
+			}
+			strategy := NewRollingUpdateStrategy(log.WithField("test", true), manager, 1, tc.maxScaleUp)
+
+			extra, err := strategy.scaleUpForPendingPods(context.Background(), manager.nodePool, &api.NodePool{Name: "test", MaxSize: tc.maxSize}, tc.extra)
+			if err != nil {
+				t.Fatalf("should not fail: %v", err)
+			}
+			if extra != tc.expected {
+				t.Errorf("expected %d extra nodes, got %d", tc.expected, extra)
+			}
+			if added := extra - tc.extra; manager.nodePool.Desired != 2+added {
+				t.Errorf("expected %d desired nodes, got %d", 2+added, manager.nodePool.Desired)
+			}
+		})
+	}
+}
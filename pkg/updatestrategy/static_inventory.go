@@ -0,0 +1,324 @@
+package updatestrategy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// StaticNodesConfigItem is the node pool config item listing the
+	// names of the nodes of a static node pool, separated by commas.
+	StaticNodesConfigItem = "static_nodes"
+
+	inventoryConfigMapName = "cluster-lifecycle-manager-inventory"
+	failureDomainLabel     = "failure-domain.beta.kubernetes.io/zone"
+)
+
+// Reprovisioner reinstalls a node of a static inventory with the
+// configuration of its node pool, e.g. by triggering a PXE boot.
+type Reprovisioner interface {
+	Reprovision(node *Node, configuration string) error
+}
+
+// WebhookReprovisioner requests the reprovisioning of nodes from an external
+// system by posting a ReprovisionRequest to a URL.
+type WebhookReprovisioner struct {
+	clusterID string
+	url       string
+	client    *http.Client
+}
+
+// ReprovisionRequest is the payload sent by the WebhookReprovisioner.
+type ReprovisionRequest struct {
+	ClusterID     string `json:"cluster_id"`
+	NodePool      string `json:"node_pool"`
+	Node          string `json:"node"`
+	ProviderID    string `json:"provider_id"`
+	ConfigHash    string `json:"config_hash"`
+	Configuration string `json:"configuration"`
+}
+
+// NewWebhookReprovisioner initializes a new WebhookReprovisioner posting the
+// requests for nodes of the cluster to the URL.
+func NewWebhookReprovisioner(clusterID, url string, client *http.Client) *WebhookReprovisioner {
+	return &WebhookReprovisioner{
+		clusterID: clusterID,
+		url:       url,
+		client:    client,
+	}
+}
+
+// Reprovision posts the reprovisioning request for the node. Any 2xx status
+// is considered an acknowledgement.
+func (w *WebhookReprovisioner) Reprovision(node *Node, configuration string) error {
+	body, err := json.Marshal(&ReprovisionRequest{
+		ClusterID:     w.clusterID,
+		NodePool:      node.NodePool,
+		Node:          node.Name,
+		ProviderID:    node.ProviderID,
+		ConfigHash:    configurationHash(configuration),
+		Configuration: configuration,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to request reprovisioning of node %s: %v", node.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to request reprovisioning of node %s: unexpected status code %d", node.Name, resp.StatusCode)
+	}
+	return nil
+}
+
+// StaticInventoryBackend defines node pools backed by a static inventory of
+// pre-existing nodes, e.g. bare-metal machines. The nodes of a node pool are
+// listed in its static_nodes config item. The pools can't be scaled, instead
+// the nodes are updated in place by reprovisioning them with the new
+// configuration of their node pool.
+//
+// The hash of the configuration each node was provisioned with is recorded
+// in a ConfigMap in the cluster. Nodes seen for the first time are adopted
+// with the current configuration, so an existing cluster isn't reprovisioned
+// when it's taken over by the CLM. Without a Reprovisioner all nodes are
+// considered current.
+type StaticInventoryBackend struct {
+	kube          kubernetes.Interface
+	namespace     string
+	reprovisioner Reprovisioner
+	configuration func(nodePool *api.NodePool) (string, error)
+
+	sync.Mutex
+	// configurations are the last configurations of the node pools by
+	// name, which are the ones terminated nodes are reprovisioned with.
+	configurations map[string]string
+}
+
+// NewStaticInventoryBackend initializes a new StaticInventoryBackend storing
+// the configuration hashes of the nodes in the namespace. configuration
+// returns the configuration, e.g. the user data, of a node pool.
+func NewStaticInventoryBackend(kubeClient kubernetes.Interface, namespace string, reprovisioner Reprovisioner, configuration func(nodePool *api.NodePool) (string, error)) *StaticInventoryBackend {
+	return &StaticInventoryBackend{
+		kube:           kubeClient,
+		namespace:      namespace,
+		reprovisioner:  reprovisioner,
+		configuration:  configuration,
+		configurations: make(map[string]string),
+	}
+}
+
+// staticNodes returns the names of the nodes of the node pool.
+func staticNodes(nodePool *api.NodePool) []string {
+	var names []string
+	for _, name := range strings.Split(nodePool.ConfigItems[StaticNodesConfigItem], ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configurationHash returns the hash identifying a configuration.
+func configurationHash(configuration string) string {
+	hash := sha256.Sum256([]byte(configuration))
+	return hex.EncodeToString(hash[:])[:16]
+}
+
+// Get returns the nodes of the inventory registered in the cluster. Nodes
+// reprovisioned with the current configuration of the node pool are of the
+// current generation.
+func (s *StaticInventoryBackend) Get(nodePool *api.NodePool) (*NodePool, error) {
+	configuration, err := s.configuration(nodePool)
+	if err != nil {
+		return nil, err
+	}
+	hash := configurationHash(configuration)
+
+	s.Lock()
+	s.configurations[nodePool.Name] = configuration
+	s.Unlock()
+
+	recorded, err := s.recordedHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	names := staticNodes(nodePool)
+	pool := &NodePool{
+		Min:           len(names),
+		Desired:       len(names),
+		Max:           len(names),
+		Generation:    currentNodeGeneration,
+		Configuration: hash,
+	}
+
+	adopted := make(map[string]string)
+	for _, name := range names {
+		kubeNode, err := s.kube.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+		if err != nil {
+			if apiErrors.IsNotFound(err) {
+				// the node is being reprovisioned or
+				// didn't join the cluster yet
+				continue
+			}
+			return nil, err
+		}
+
+		if kubeNode.Spec.ProviderID == "" {
+			return nil, fmt.Errorf("node %s of static node pool %s has no provider ID, start its kubelet with --provider-id", name, nodePool.Name)
+		}
+
+		if _, ok := recorded[name]; !ok {
+			adopted[name] = hash
+			recorded[name] = hash
+		}
+
+		generation := currentNodeGeneration
+		if s.reprovisioner != nil && recorded[name] != hash {
+			generation = outdatedNodeGeneration
+		}
+
+		pool.Nodes = append(pool.Nodes, &Node{
+			Name:          name,
+			ProviderID:    kubeNode.Spec.ProviderID,
+			FailureDomain: kubeNode.Labels[failureDomainLabel],
+			Generation:    generation,
+			Ready:         isNodeReady(kubeNode),
+		})
+	}
+	pool.Current = len(pool.Nodes)
+
+	if len(adopted) > 0 {
+		err = s.recordHashes(adopted)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pool, nil
+}
+
+// isNodeReady returns true if the node reports the Ready condition.
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Scale fails unless the number of replicas matches the size of the
+// inventory, because nodes can't be added to or removed from a static
+// inventory by the CLM.
+func (s *StaticInventoryBackend) Scale(nodePool *api.NodePool, replicas int) error {
+	if size := len(staticNodes(nodePool)); replicas != size {
+		return fmt.Errorf("static node pool %s can't be scaled from %d to %d nodes", nodePool.Name, size, replicas)
+	}
+	return nil
+}
+
+// SuspendAutoscaling is a no-op, static node pools aren't autoscaled.
+func (s *StaticInventoryBackend) SuspendAutoscaling(nodePool *api.NodePool) error {
+	return nil
+}
+
+// Terminate reprovisions the drained node with the current configuration of
+// its node pool and removes it from the cluster until it registers again.
+func (s *StaticInventoryBackend) Terminate(node *Node, decrementDesired bool) error {
+	if decrementDesired {
+		return fmt.Errorf("nodes can't be removed from static node pool %s", node.NodePool)
+	}
+	if s.reprovisioner == nil {
+		return fmt.Errorf("no reprovisioner configured for static node pool %s", node.NodePool)
+	}
+
+	s.Lock()
+	configuration, ok := s.configurations[node.NodePool]
+	s.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown configuration of static node pool %s", node.NodePool)
+	}
+
+	err := s.reprovisioner.Reprovision(node, configuration)
+	if err != nil {
+		return err
+	}
+
+	err = s.recordHashes(map[string]string{node.Name: configurationHash(configuration)})
+	if err != nil {
+		return err
+	}
+
+	err = s.kube.CoreV1().Nodes().Delete(node.Name, nil)
+	if err != nil && !apiErrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// recordedHashes returns the configuration hashes of the nodes by name.
+func (s *StaticInventoryBackend) recordedHashes() (map[string]string, error) {
+	configMap, err := s.kube.CoreV1().ConfigMaps(s.namespace).Get(inventoryConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return make(map[string]string), nil
+		}
+		return nil, err
+	}
+
+	hashes := make(map[string]string, len(configMap.Data))
+	for name, hash := range configMap.Data {
+		hashes[name] = hash
+	}
+	return hashes, nil
+}
+
+// recordHashes records the configuration hashes of the nodes.
+func (s *StaticInventoryBackend) recordHashes(hashes map[string]string) error {
+	configMaps := s.kube.CoreV1().ConfigMaps(s.namespace)
+
+	configMap, err := configMaps.Get(inventoryConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if !apiErrors.IsNotFound(err) {
+			return err
+		}
+
+		_, err = configMaps.Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      inventoryConfigMapName,
+				Namespace: s.namespace,
+			},
+			Data: hashes,
+		})
+		return err
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string, len(hashes))
+	}
+	for name, hash := range hashes {
+		configMap.Data[name] = hash
+	}
+	_, err = configMaps.Update(configMap)
+	return err
+}
@@ -0,0 +1,174 @@
+package updatestrategy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+type recordingReprovisioner struct {
+	reprovisioned []string
+}
+
+func (r *recordingReprovisioner) Reprovision(node *Node, configuration string) error {
+	r.reprovisioned = append(r.reprovisioned, node.Name+":"+configuration)
+	return nil
+}
+
+func staticNode(name string, ready bool) *v1.Node {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{failureDomainLabel: "rack-1"},
+		},
+		Spec: v1.NodeSpec{ProviderID: "static://" + name},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}},
+		},
+	}
+}
+
+func TestStaticInventoryBackend(t *testing.T) {
+	client := fake.NewSimpleClientset(staticNode("node-1", true), staticNode("node-2", false))
+	reprovisioner := &recordingReprovisioner{}
+	configuration := "v1"
+	backend := NewStaticInventoryBackend(client, "kube-system", reprovisioner, func(nodePool *api.NodePool) (string, error) {
+		return configuration, nil
+	})
+	nodePool := &api.NodePool{
+		Name:        "default-worker",
+		ConfigItems: map[string]string{StaticNodesConfigItem: "node-2, node-1,node-3"},
+	}
+
+	// existing nodes are adopted with the current configuration
+	pool, err := backend.Get(nodePool)
+	require.NoError(t, err)
+	require.Equal(t, 3, pool.Desired)
+	require.Equal(t, 2, pool.Current)
+	require.Len(t, pool.Nodes, 2)
+	require.Equal(t, "node-1", pool.Nodes[0].Name)
+	require.True(t, pool.Nodes[0].Ready)
+	require.False(t, pool.Nodes[1].Ready)
+	require.Equal(t, "rack-1", pool.Nodes[0].FailureDomain)
+	for _, node := range pool.Nodes {
+		require.Equal(t, pool.Generation, node.Generation)
+	}
+
+	// a new configuration makes the nodes outdated
+	configuration = "v2"
+	pool, err = backend.Get(nodePool)
+	require.NoError(t, err)
+	for _, node := range pool.Nodes {
+		require.NotEqual(t, pool.Generation, node.Generation)
+	}
+
+	node := pool.Nodes[0]
+	node.NodePool = nodePool.Name
+	require.NoError(t, backend.Terminate(node, false))
+	require.Equal(t, []string{"node-1:v2"}, reprovisioner.reprovisioned)
+	_, err = client.CoreV1().Nodes().Get("node-1", metav1.GetOptions{})
+	require.True(t, apiErrors.IsNotFound(err))
+
+	// the reprovisioned node is current once it registers again
+	_, err = client.CoreV1().Nodes().Create(staticNode("node-1", true))
+	require.NoError(t, err)
+	pool, err = backend.Get(nodePool)
+	require.NoError(t, err)
+	require.Equal(t, pool.Generation, pool.Nodes[0].Generation)
+	require.NotEqual(t, pool.Generation, pool.Nodes[1].Generation)
+
+	require.Error(t, backend.Terminate(node, true))
+	require.NoError(t, backend.Scale(nodePool, 3))
+	require.Error(t, backend.Scale(nodePool, 4))
+}
+
+func TestStaticInventoryBackendWithoutReprovisioner(t *testing.T) {
+	node := staticNode("node-1", true)
+	client := fake.NewSimpleClientset(node)
+	backend := NewStaticInventoryBackend(client, "kube-system", nil, func(nodePool *api.NodePool) (string, error) {
+		return "v1", nil
+	})
+	nodePool := &api.NodePool{Name: "default-worker", ConfigItems: map[string]string{StaticNodesConfigItem: "node-1"}}
+
+	_, err := backend.Get(nodePool)
+	require.NoError(t, err)
+	backend.configuration = func(nodePool *api.NodePool) (string, error) {
+		return "v2", nil
+	}
+
+	// nodes can't be updated without a reprovisioner
+	pool, err := backend.Get(nodePool)
+	require.NoError(t, err)
+	require.Equal(t, pool.Generation, pool.Nodes[0].Generation)
+	require.Error(t, backend.Terminate(&Node{Name: "node-1", NodePool: nodePool.Name}, false))
+
+	// nodes must have a provider ID
+	node.Spec.ProviderID = ""
+	_, err = client.CoreV1().Nodes().Update(node)
+	require.NoError(t, err)
+	_, err = backend.Get(nodePool)
+	require.Error(t, err)
+}
+
+func TestWebhookReprovisioner(t *testing.T) {
+	var request ReprovisionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		if request.Node == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	reprovisioner := NewWebhookReprovisioner("cluster-1", server.URL, http.DefaultClient)
+	require.NoError(t, reprovisioner.Reprovision(&Node{Name: "node-1", NodePool: "default-worker", ProviderID: "static://node-1"}, "v1"))
+	require.Equal(t, ReprovisionRequest{
+		ClusterID:     "cluster-1",
+		NodePool:      "default-worker",
+		Node:          "node-1",
+		ProviderID:    "static://node-1",
+		ConfigHash:    configurationHash("v1"),
+		Configuration: "v1",
+	}, request)
+
+	require.Error(t, reprovisioner.Reprovision(&Node{Name: "broken"}, "v1"))
+}
+
+func TestInPlaceUpdate(t *testing.T) {
+	manager := &mockNodePoolManager{
+		nodePool: &NodePool{
+			Min:        2,
+			Max:        2,
+			Current:    2,
+			Desired:    2,
+			Generation: 2,
+			Nodes: []*Node{
+				mockNode("a", 1, false, false),
+				mockNode("b", 2, false, false),
+			},
+		},
+	}
+	strategy := NewInPlaceUpdateStrategy(log.WithField("test", true), manager)
+
+	require.NoError(t, strategy.Update(context.Background(), &api.NodePool{Name: "default-worker"}))
+	require.Len(t, manager.nodePool.Nodes, 2)
+	for _, node := range manager.nodePool.Nodes {
+		require.Equal(t, 2, node.Generation)
+	}
+}
@@ -2,6 +2,7 @@ package updatestrategy
 
 import (
 	"context"
+	"time"
 
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"k8s.io/client-go/pkg/api/v1"
@@ -21,6 +22,15 @@ type ProviderNodePoolsBackend interface {
 	Terminate(node *Node, decrementDesired bool) error
 }
 
+// TerminationHookBackend is an optional interface of node pool backends which
+// can hold back the termination of nodes initiated outside of the CLM, e.g.
+// scale-in by an autoscaler, until the nodes are drained.
+type TerminationHookBackend interface {
+	EnsureTerminationHook(nodePool *api.NodePool, timeout time.Duration) error
+	TerminatingNodes(nodePool *api.NodePool) ([]*Node, error)
+	CompleteTermination(node *Node) error
+}
+
 // NodePool defines a node pool including all nodes.
 type NodePool struct {
 	Min        int
@@ -28,7 +38,10 @@ type NodePool struct {
 	Current    int
 	Max        int
 	Generation int
-	Nodes      []*Node
+	// Configuration identifies the configuration new nodes are launched
+	// with.
+	Configuration string
+	Nodes         []*Node
 }
 
 // ReadyNodes returns a list of nodes which are marked as ready.
@@ -46,7 +59,9 @@ func (n *NodePool) ReadyNodes() []*Node {
 // Node is an abstract node object which combines the node information from the
 // node pool backend along with the corresponding Kubernetes node object.
 type Node struct {
-	Name            string
+	Name string
+	// NodePool is the name of the node pool the node belongs to.
+	NodePool        string
 	Labels          map[string]string
 	Taints          []v1.Taint
 	Cordoned        bool
@@ -55,4 +70,11 @@ type Node struct {
 	Generation      int
 	VolumesAttached bool
 	Ready           bool
+	// ConfigHash is the hash of the node pool configuration the node is
+	// expected to run with. It's empty if the node pool doesn't provide
+	// one.
+	ConfigHash string
+	// LaunchConfigHash is the hash of the node pool configuration the node
+	// was launched with. It's empty if it isn't known.
+	LaunchConfigHash string
 }
@@ -4,15 +4,45 @@ import (
 	"bytes"
 	"io"
 	"os/exec"
+	"regexp"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// tokenPattern matches tokens passed as arguments or in Authorization
+// headers.
+var tokenPattern = regexp.MustCompile(`(?i)(--token[= ]|token: |bearer )[^\s"']+`)
+
 func outputLines(output string) []string {
 	return strings.Split(strings.TrimRight(output, "\n"), "\n")
 }
 
+// Redact masks the tokens in s, e.g. in the output of a command.
+func Redact(s string) string {
+	return tokenPattern.ReplaceAllString(s, "${1}<redacted>")
+}
+
+// String returns the command line of the command with the tokens masked,
+// for logging the command.
+func String(cmd *exec.Cmd) string {
+	return Redact(strings.Join(cmd.Args, " "))
+}
+
+// redactingWriter masks the tokens in everything written to it. Tokens split
+// across writes aren't masked.
+type redactingWriter struct {
+	writer io.Writer
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	_, err := w.writer.Write([]byte(Redact(string(p))))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
 // RunSilently runs an exec.Cmd, capturing its output and additionally logging it
 // only if the command fails (or if debug logging is enabled)
 func RunSilently(logger *log.Entry, cmd *exec.Cmd) (string, error) {
@@ -20,23 +50,23 @@ func RunSilently(logger *log.Entry, cmd *exec.Cmd) (string, error) {
 	out := string(rawOut)
 	if err != nil {
 		for _, line := range outputLines(out) {
-			logger.Errorln(line)
+			logger.Errorln(Redact(line))
 		}
 	} else if logger.Logger.Level >= log.DebugLevel {
 		for _, line := range outputLines(out) {
-			logger.Debugln(line)
+			logger.Debugln(Redact(line))
 		}
 	}
 	return string(out), err
 }
 
 // Run runs an exec.Cmd, capturing its output and additionally redirecting
-// it to a logger
+// it to a logger with the tokens masked
 func Run(logger *log.Entry, cmd *exec.Cmd) (string, error) {
 	var output bytes.Buffer
 
-	cmd.Stdout = io.MultiWriter(&output, logger.WriterLevel(log.InfoLevel))
-	cmd.Stderr = io.MultiWriter(&output, logger.WriterLevel(log.ErrorLevel))
+	cmd.Stdout = io.MultiWriter(&output, &redactingWriter{writer: logger.WriterLevel(log.InfoLevel)})
+	cmd.Stderr = io.MultiWriter(&output, &redactingWriter{writer: logger.WriterLevel(log.ErrorLevel)})
 
 	err := cmd.Run()
 	return output.String(), err
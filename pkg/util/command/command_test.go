@@ -91,3 +91,20 @@ func TestRunFailing(t *testing.T) {
 	require.Contains(t, out, "go version")
 	require.NotEmpty(t, logger.writer.String())
 }
+
+func TestRedact(t *testing.T) {
+	require.Equal(t, "kubectl --token=<redacted> apply", Redact("kubectl --token=secret apply"))
+	require.Equal(t, "Authorization: Bearer <redacted>", Redact("Authorization: Bearer secret"))
+	require.Equal(t, "    token: <redacted>", Redact("    token: secret"))
+	require.Equal(t, "kubectl apply -f -", String(exec.Command("kubectl", "apply", "-f", "-")))
+	require.Equal(t, "kubectl --token <redacted>", String(exec.Command("kubectl", "--token", "secret")))
+}
+
+func TestRunRedacted(t *testing.T) {
+	cmd := exec.Command("echo", "--token=secret")
+	logger := newTestLogger(log.InfoLevel)
+	_, err := Run(logger.entry, cmd)
+	require.NoError(t, err)
+	require.Contains(t, logger.writer.String(), "--token=<redacted>")
+	require.NotContains(t, logger.writer.String(), "secret")
+}
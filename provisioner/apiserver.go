@@ -0,0 +1,192 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/cenkalti/backoff"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const (
+	configKeyAPIServerHealthCheckTarget = "api_server_health_check_target"
+	configKeyAPIServerQuorumTimeout     = "api_server_quorum_timeout"
+	defaultAPIServerHealthCheckTarget   = "SSL:443"
+	defaultAPIServerQuorumTimeout       = 15 * time.Minute
+	elbInstanceStateInService           = "InService"
+	apiServerHealthCheckTargetParameter = "APIServerHealthCheckTarget"
+)
+
+// apiServerCount returns the number of API servers of the cluster, the sum of
+// the minimum sizes of the control plane node pools. Every cluster has at
+// least one API server.
+func apiServerCount(cluster *api.Cluster) int {
+	count := 0
+	for _, nodePool := range cluster.NodePools {
+		if isControlPlaneNodePool(nodePool) {
+			count += int(nodePool.MinSize)
+		}
+	}
+	if count < 1 {
+		return 1
+	}
+	return count
+}
+
+// apiServerQuorum returns the number of API servers which have to stay
+// healthy while control plane nodes are replaced, the majority of them.
+func apiServerQuorum(count int) int {
+	return count/2 + 1
+}
+
+// apiServerHealthCheckParameter returns the stack parameter setting the
+// health check target of the API server load balancer of the cluster stack.
+// Only clusters with several API servers get the parameter, so requests are
+// only routed to healthy API servers.
+func apiServerHealthCheckParameter(cluster *api.Cluster) (string, bool) {
+	if apiServerCount(cluster) < 2 {
+		return "", false
+	}
+
+	target := defaultAPIServerHealthCheckTarget
+	if value, ok := cluster.ConfigItems[configKeyAPIServerHealthCheckTarget]; ok {
+		target = value
+	}
+	return fmt.Sprintf("%s=%s", apiServerHealthCheckTargetParameter, target), true
+}
+
+// healthyAPIServers returns the IDs of the instances in service of the API
+// server load balancer.
+func (a *awsAdapter) healthyAPIServers(cluster *api.Cluster) (map[string]bool, error) {
+	loadBalancer, err := a.apiServerLoadBalancer(cluster.LocalID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.elbClient.DescribeInstanceHealth(&elb.DescribeInstanceHealthInput{
+		LoadBalancerName: loadBalancer.LoadBalancerName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	healthy := make(map[string]bool, len(resp.InstanceStates))
+	for _, state := range resp.InstanceStates {
+		if aws.StringValue(state.State) == elbInstanceStateInService {
+			healthy[aws.StringValue(state.InstanceId)] = true
+		}
+	}
+	return healthy, nil
+}
+
+// apiServerQuorumNodePoolManager wraps a NodePoolManager and holds back the
+// termination of control plane nodes until enough of the other API servers
+// are healthy to keep the quorum after the node is gone.
+type apiServerQuorumNodePoolManager struct {
+	updatestrategy.NodePoolManager
+	adapter *awsAdapter
+	cluster *api.Cluster
+	timeout time.Duration
+	logger  *log.Entry
+}
+
+// newAPIServerQuorumNodePoolManager wraps the node pool manager if the
+// cluster has several API servers.
+func newAPIServerQuorumNodePoolManager(logger *log.Entry, manager updatestrategy.NodePoolManager, adapter *awsAdapter, cluster *api.Cluster) (updatestrategy.NodePoolManager, error) {
+	if apiServerCount(cluster) < 2 {
+		return manager, nil
+	}
+
+	timeout := defaultAPIServerQuorumTimeout
+	if value, ok := cluster.ConfigItems[configKeyAPIServerQuorumTimeout]; ok {
+		var err error
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid value for %s: %s", configKeyAPIServerQuorumTimeout, value)
+		}
+	}
+
+	return &apiServerQuorumNodePoolManager{
+		NodePoolManager: manager,
+		adapter:         adapter,
+		cluster:         cluster,
+		timeout:         timeout,
+		logger:          logger,
+	}, nil
+}
+
+// TerminateNode waits until the API server quorum is kept without the node
+// before terminating a control plane node.
+func (m *apiServerQuorumNodePoolManager) TerminateNode(ctx context.Context, node *updatestrategy.Node, decrementDesired bool) error {
+	if m.controlPlaneNode(node) {
+		err := m.waitForQuorum(ctx, node)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.NodePoolManager.TerminateNode(ctx, node, decrementDesired)
+}
+
+// controlPlaneNode returns true if the node belongs to a control plane node
+// pool of the cluster.
+func (m *apiServerQuorumNodePoolManager) controlPlaneNode(node *updatestrategy.Node) bool {
+	for _, nodePool := range m.cluster.NodePools {
+		if nodePool.Name == node.NodePool && isControlPlaneNodePool(nodePool) {
+			return true
+		}
+	}
+
+	// the replacements of migrated legacy node pools
+	for _, nodePool := range getNonLegacyNodePools(m.cluster) {
+		if nodePool.Name == node.NodePool && isControlPlaneNodePool(nodePool) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForQuorum waits until at least a quorum of API servers other than the
+// node are in service of the API server load balancer.
+func (m *apiServerQuorumNodePoolManager) waitForQuorum(ctx context.Context, node *updatestrategy.Node) error {
+	count := apiServerCount(m.cluster)
+	quorum := apiServerQuorum(count)
+	parts := strings.Split(node.ProviderID, "/")
+	instanceID := parts[len(parts)-1]
+
+	var others int
+	check := func() error {
+		if err := ctx.Err(); err != nil {
+			return backoff.Permanent(err)
+		}
+
+		healthy, err := m.adapter.healthyAPIServers(m.cluster)
+		if err != nil {
+			return err
+		}
+
+		others = len(healthy)
+		if healthy[instanceID] {
+			others--
+		}
+		if others < quorum {
+			m.logger.Infof("Waiting for API servers to become healthy before terminating node %s (%d/%d)", node.Name, others, quorum)
+			return fmt.Errorf("only %d other API servers are healthy", others)
+		}
+		return nil
+	}
+
+	backoffCfg := backoff.NewExponentialBackOff()
+	backoffCfg.MaxElapsedTime = m.timeout
+	err := backoff.Retry(check, backoffCfg)
+	if err != nil {
+		return fmt.Errorf("not terminating node %s: %d of %d API servers would remain healthy, %d needed: %v", node.Name, others, count, quorum, err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package provisioner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/elb"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+type elbHealthAPIStub struct {
+	elbAPIStub
+	instanceStates []*elb.InstanceState
+}
+
+func (e *elbHealthAPIStub) DescribeInstanceHealth(input *elb.DescribeInstanceHealthInput) (*elb.DescribeInstanceHealthOutput, error) {
+	return &elb.DescribeInstanceHealthOutput{InstanceStates: e.instanceStates}, nil
+}
+
+func apiServerTestAdapter(elbClient elbAPI) *awsAdapter {
+	return &awsAdapter{
+		cloudformationClient: &cloudFormationAPIStub{
+			statusMutex: &sync.Mutex{},
+			status:      aws.String(cloudformation.StackStatusCreateComplete),
+			outputs: []*cloudformation.Output{
+				{OutputKey: aws.String(apiServerLoadBalancerOutput), OutputValue: aws.String("kube-1-api")},
+			},
+		},
+		elbClient: elbClient,
+		logger:    log.WithField("test", true),
+	}
+}
+
+func haCluster() *api.Cluster {
+	return &api.Cluster{
+		LocalID:     "kube-1",
+		ConfigItems: map[string]string{},
+		NodePools: []*api.NodePool{
+			{Name: "master-a", Profile: "master-default", MinSize: 2},
+			{Name: "master-b", Profile: "master-default", MinSize: 1},
+			{Name: "worker", Profile: "worker-default", MinSize: 5},
+		},
+	}
+}
+
+func TestAPIServerCount(t *testing.T) {
+	require.Equal(t, 3, apiServerCount(haCluster()))
+	require.Equal(t, 1, apiServerCount(&api.Cluster{NodePools: []*api.NodePool{{Name: "worker", Profile: "worker-default", MinSize: 3}}}))
+
+	require.Equal(t, 1, apiServerQuorum(1))
+	require.Equal(t, 2, apiServerQuorum(2))
+	require.Equal(t, 2, apiServerQuorum(3))
+}
+
+func TestAPIServerHealthCheckParameter(t *testing.T) {
+	// single API server clusters keep the health check of the template
+	_, ok := apiServerHealthCheckParameter(&api.Cluster{LocalID: "kube-1"})
+	require.False(t, ok)
+
+	cluster := haCluster()
+	parameter, ok := apiServerHealthCheckParameter(cluster)
+	require.True(t, ok)
+	require.Equal(t, "APIServerHealthCheckTarget=SSL:443", parameter)
+
+	cluster.ConfigItems[configKeyAPIServerHealthCheckTarget] = "HTTPS:443/healthz"
+	parameter, _ = apiServerHealthCheckParameter(cluster)
+	require.Equal(t, "APIServerHealthCheckTarget=HTTPS:443/healthz", parameter)
+}
+
+func TestClusterStackTemplateHealthCheckParameter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "senza")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	definition := path.Join(dir, clusterStackDefinitionFile)
+	writeTemplateTestFile(t, definition, "SenzaInfo:\n  Parameters:\n    - HostedZone:\n        Description: \"Hosted Zone\"\n")
+
+	cluster := haCluster()
+	cluster.APIServerURL = "https://kube-1.example.org"
+	_, err = (&awsAdapter{}).clusterStackTemplate("kube-1", definition, cluster)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must declare the parameter APIServerHealthCheckTarget")
+}
+
+func TestAPIServerQuorumNodePoolManager(t *testing.T) {
+	state := func(id, state string) *elb.InstanceState {
+		return &elb.InstanceState{InstanceId: aws.String(id), State: aws.String(state)}
+	}
+
+	for _, tc := range []struct {
+		msg    string
+		node   *updatestrategy.Node
+		states []*elb.InstanceState
+		valid  bool
+	}{
+		{
+			msg:    "quorum kept",
+			node:   &updatestrategy.Node{Name: "node-1", NodePool: "master-a", ProviderID: "aws:///eu-central-1a/i-1"},
+			states: []*elb.InstanceState{state("i-1", "InService"), state("i-2", "InService"), state("i-3", "InService")},
+			valid:  true,
+		},
+		{
+			msg:    "quorum lost",
+			node:   &updatestrategy.Node{Name: "node-1", NodePool: "master-a", ProviderID: "aws:///eu-central-1a/i-1"},
+			states: []*elb.InstanceState{state("i-1", "InService"), state("i-2", "InService"), state("i-3", "OutOfService")},
+			valid:  false,
+		},
+		{
+			msg:   "worker node",
+			node:  &updatestrategy.Node{Name: "node-5", NodePool: "worker", ProviderID: "aws:///eu-central-1a/i-5"},
+			valid: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := haCluster()
+			cluster.ConfigItems[configKeyAPIServerQuorumTimeout] = "1ms"
+
+			terminator := &terminatingNodePoolManager{}
+			manager, err := newAPIServerQuorumNodePoolManager(log.WithField("test", true), terminator, apiServerTestAdapter(&elbHealthAPIStub{instanceStates: tc.states}), cluster)
+			require.NoError(t, err)
+
+			err = manager.TerminateNode(context.Background(), tc.node, false)
+			if tc.valid {
+				require.NoError(t, err)
+				require.Equal(t, []string{tc.node.Name}, terminator.terminated)
+			} else {
+				require.Error(t, err)
+				require.Empty(t, terminator.terminated)
+			}
+		})
+	}
+
+	_, err := newAPIServerQuorumNodePoolManager(log.WithField("test", true), &mockNodePoolManager{}, nil, &api.Cluster{
+		ConfigItems: map[string]string{configKeyAPIServerQuorumTimeout: "0s"},
+		NodePools:   haCluster().NodePools,
+	})
+	require.Error(t, err)
+}
+
+type terminatingNodePoolManager struct {
+	updatestrategy.NodePoolManager
+	terminated []string
+}
+
+func (m *terminatingNodePoolManager) TerminateNode(ctx context.Context, node *updatestrategy.Node, decrementDesired bool) error {
+	m.terminated = append(m.terminated, node.Name)
+	return nil
+}
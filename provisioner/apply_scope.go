@@ -0,0 +1,181 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ConfigKeyApplyComponents is the config item limiting the manifests
+	// applied and the deletions run to a comma separated list of components.
+	ConfigKeyApplyComponents = "apply_components"
+	// ConfigKeyApplyNamespaces is the config item limiting the manifests
+	// applied and the deletions run to a comma separated list of namespaces.
+	ConfigKeyApplyNamespaces = "apply_namespaces"
+
+	namespaceKind = "namespace"
+)
+
+// applyScope limits the apply to a set of components and/or namespaces, e.g.
+// for emergency fixes which can't wait for the full apply.
+type applyScope struct {
+	components map[string]struct{}
+	namespaces map[string]struct{}
+}
+
+// newApplyScope returns the apply scope configured for the cluster or nil if
+// everything is applied.
+func newApplyScope(cluster *api.Cluster) *applyScope {
+	scope := &applyScope{
+		components: scopeSet(cluster.ConfigItems[ConfigKeyApplyComponents]),
+		namespaces: scopeSet(cluster.ConfigItems[ConfigKeyApplyNamespaces]),
+	}
+	if scope.components == nil && scope.namespaces == nil {
+		return nil
+	}
+	return scope
+}
+
+func scopeSet(value string) map[string]struct{} {
+	var set map[string]struct{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if set == nil {
+			set = make(map[string]struct{})
+		}
+		set[item] = struct{}{}
+	}
+	return set
+}
+
+func scopeList(set map[string]struct{}) string {
+	items := make([]string, 0, len(set))
+	for item := range set {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ", ")
+}
+
+func (s *applyScope) String() string {
+	var parts []string
+	if s.components != nil {
+		parts = append(parts, fmt.Sprintf("components %s", scopeList(s.components)))
+	}
+	if s.namespaces != nil {
+		parts = append(parts, fmt.Sprintf("namespaces %s", scopeList(s.namespaces)))
+	}
+	return strings.Join(parts, " in ")
+}
+
+// component returns true if the component is in the scope. The top-level
+// deletions, which don't belong to a component, are only in the scope if it
+// isn't limited to components.
+func (s *applyScope) component(component string) bool {
+	if s.components == nil {
+		return true
+	}
+	_, ok := s.components[component]
+	return component != "" && ok
+}
+
+// object returns true if the object of the kind, namespace and name is in the
+// scope. Objects without a namespace are considered in the default
+// namespace, namespaces are in the scope of themselves.
+func (s *applyScope) object(kind, namespace, name string) bool {
+	if s.namespaces == nil {
+		return true
+	}
+	if strings.EqualFold(kind, namespaceKind) || strings.EqualFold(kind, "namespaces") {
+		namespace = name
+	}
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	_, ok := s.namespaces[namespace]
+	return ok
+}
+
+// manifests returns the manifests of the components in the scope with only
+// the documents of the objects in the scope. Manifests without documents in
+// the scope are dropped.
+func (s *applyScope) manifests(manifests []*renderedManifest) []*renderedManifest {
+	var result []*renderedManifest
+	for _, manifest := range manifests {
+		if !s.component(manifest.Component) {
+			continue
+		}
+		if s.namespaces == nil {
+			result = append(result, manifest)
+			continue
+		}
+
+		var documents []string
+		for _, document := range yamlDocumentSeparator.Split(manifest.Content, -1) {
+			if stripWhitespace(document) == "" {
+				continue
+			}
+
+			var object manifestObject
+			err := yaml.Unmarshal([]byte(document), &object)
+			if err != nil || !s.object(object.Kind, object.Metadata.Namespace, object.Metadata.Name) {
+				continue
+			}
+			documents = append(documents, document)
+		}
+
+		if len(documents) == 0 {
+			continue
+		}
+		result = append(result, &renderedManifest{
+			File:      manifest.File,
+			Component: manifest.Component,
+			Content:   strings.Join(documents, "---\n"),
+		})
+	}
+	return result
+}
+
+// resources returns the resources to delete of the component which are in
+// the scope.
+func (s *applyScope) resources(resources []*resource, component string) []*resource {
+	if !s.component(component) {
+		return nil
+	}
+
+	var result []*resource
+	for _, resource := range resources {
+		if s.object(resource.Kind, resource.Namespace, resource.Name) {
+			result = append(result, resource)
+		}
+	}
+	return result
+}
+
+// deletions returns the top-level and component deletions in the scope.
+func (s *applyScope) deletions(d *deletions) *deletions {
+	result := &deletions{
+		PreApply:  s.resources(d.PreApply, ""),
+		PostApply: s.resources(d.PostApply, ""),
+	}
+	for component, componentDeletions := range d.components {
+		if !s.component(component) {
+			continue
+		}
+		if result.components == nil {
+			result.components = make(map[string]*deletions)
+		}
+		result.components[component] = &deletions{
+			PreApply:  s.resources(componentDeletions.PreApply, component),
+			PostApply: s.resources(componentDeletions.PostApply, component),
+		}
+	}
+	return result
+}
@@ -0,0 +1,101 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestNewApplyScope(t *testing.T) {
+	require.Nil(t, newApplyScope(&api.Cluster{}))
+	require.Nil(t, newApplyScope(&api.Cluster{ConfigItems: map[string]string{ConfigKeyApplyComponents: " , "}}))
+
+	scope := newApplyScope(&api.Cluster{ConfigItems: map[string]string{
+		ConfigKeyApplyComponents: "ingress, external-dns",
+		ConfigKeyApplyNamespaces: "kube-system",
+	}})
+	require.NotNil(t, scope)
+	require.Equal(t, "components external-dns, ingress in namespaces kube-system", scope.String())
+}
+
+func TestApplyScopeManifests(t *testing.T) {
+	manifests := []*renderedManifest{
+		{
+			File:      "ingress/deployment.yaml",
+			Component: "ingress",
+			Content: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ingress
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: ingress
+`,
+		},
+		{
+			File:      "ingress/namespace.yaml",
+			Component: "ingress",
+			Content: `apiVersion: v1
+kind: Namespace
+metadata:
+  name: kube-system
+`,
+		},
+		{
+			File:      "visibility/deployment.yaml",
+			Component: "visibility",
+			Content: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: logging-agent
+  namespace: visibility
+`,
+		},
+	}
+
+	scope := newApplyScope(&api.Cluster{ConfigItems: map[string]string{ConfigKeyApplyComponents: "ingress"}})
+	require.Equal(t, manifests[:2], scope.manifests(manifests))
+
+	scope = newApplyScope(&api.Cluster{ConfigItems: map[string]string{ConfigKeyApplyNamespaces: "kube-system"}})
+	scoped := scope.manifests(manifests)
+	require.Len(t, scoped, 2)
+	require.Equal(t, []string{"kube-system/Deployment/ingress"}, manifestResources(scoped[0].Content))
+	require.Equal(t, manifests[1], scoped[1])
+}
+
+func TestApplyScopeDeletions(t *testing.T) {
+	d := &deletions{
+		PreApply: []*resource{
+			{Kind: "Deployment", Namespace: "kube-system", Name: "mate"},
+		},
+		components: map[string]*deletions{
+			"ingress": {
+				PostApply: []*resource{
+					{Kind: "Service", Namespace: "kube-system", Name: "ingress-old"},
+					{Kind: "namespace", Name: "ingress"},
+				},
+			},
+			"visibility": {
+				PreApply: []*resource{
+					{Kind: "Deployment", Namespace: "visibility", Name: "logging-agent-old"},
+				},
+			},
+		},
+	}
+
+	scope := newApplyScope(&api.Cluster{ConfigItems: map[string]string{ConfigKeyApplyComponents: "ingress"}})
+	scoped := scope.deletions(d)
+	require.Empty(t, scoped.PreApply)
+	require.Len(t, scoped.components, 1)
+	require.Equal(t, d.components["ingress"].PostApply, scoped.component("ingress").PostApply)
+
+	scope = newApplyScope(&api.Cluster{ConfigItems: map[string]string{ConfigKeyApplyNamespaces: "kube-system,ingress"}})
+	scoped = scope.deletions(d)
+	require.Equal(t, d.PreApply, scoped.PreApply)
+	require.Equal(t, d.components["ingress"].PostApply, scoped.component("ingress").PostApply)
+	require.Empty(t, scoped.component("visibility").PreApply)
+}
@@ -0,0 +1,123 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	auditOperationProvision    = "provision"
+	auditOperationDecommission = "decommission"
+	auditOperationRestoreEtcd  = "restore-etcd"
+	// single steps run with the CLI.
+	auditOperationApplyManifests = "apply-manifests"
+	auditOperationUpdateNodePool = "update-node-pool"
+)
+
+var yamlDocumentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// newAuditLog initializes a new audit log for the operation on the cluster. nil
+// is returned if no audit store is configured.
+func (p *clusterpyProvisioner) newAuditLog(cluster *api.Cluster, operation string) *audit.Log {
+	if p.auditStore == nil {
+		return nil
+	}
+	return audit.NewLog(cluster.ID, operation)
+}
+
+// storeAuditLog finishes and stores the audit log and references it in the
+// cluster status. Failing to store the audit log is only logged since it
+// should not fail the provisioning run.
+func (p *clusterpyProvisioner) storeAuditLog(logger *log.Entry, cluster *api.Cluster, auditLog *audit.Log) {
+	if auditLog == nil {
+		return
+	}
+
+	auditLog.Finish()
+
+	ref, err := p.auditStore.Store(auditLog)
+	if err != nil {
+		logger.Errorf("Failed to store audit log: %v", err)
+		return
+	}
+
+	if cluster.Status == nil {
+		cluster.Status = &api.ClusterStatus{}
+	}
+	cluster.Status.AuditLog = ref
+}
+
+// kubernetesResourceName returns a name identifying a Kubernetes resource in
+// the audit log.
+func kubernetesResourceName(kind, namespace, name string) string {
+	if namespace == "" {
+		return fmt.Sprintf("%s/%s", kind, name)
+	}
+	return fmt.Sprintf("%s/%s/%s", namespace, kind, name)
+}
+
+// manifestResources returns the names of all the resources defined in the
+// (multi document) manifest.
+func manifestResources(manifest string) []string {
+	var resources []string
+	for _, document := range yamlDocumentSeparator.Split(manifest, -1) {
+		var object struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+
+		err := yaml.Unmarshal([]byte(document), &object)
+		if err != nil || object.Kind == "" {
+			continue
+		}
+
+		resources = append(resources, kubernetesResourceName(object.Kind, object.Metadata.Namespace, object.Metadata.Name))
+	}
+	return resources
+}
+
+// auditingNodePoolManager wraps a NodePoolManager and records the changes
+// made to the node pools in the audit log.
+type auditingNodePoolManager struct {
+	updatestrategy.NodePoolManager
+	auditLog *audit.Log
+}
+
+// ScalePool scales the node pool and records the result.
+func (m *auditingNodePoolManager) ScalePool(ctx context.Context, nodePool *api.NodePool, replicas int) error {
+	err := m.NodePoolManager.ScalePool(ctx, nodePool, replicas)
+	m.auditLog.Record(audit.KindAWS, fmt.Sprintf("scale-pool:%d", replicas), nodePool.Name, err)
+	return err
+}
+
+// TerminateNode terminates the node and records the result.
+func (m *auditingNodePoolManager) TerminateNode(ctx context.Context, node *updatestrategy.Node, decrementDesired bool) error {
+	err := m.NodePoolManager.TerminateNode(ctx, node, decrementDesired)
+	m.auditLog.Record(audit.KindAWS, "terminate-instance", node.ProviderID, err)
+	return err
+}
+
+// RepairNodes repairs the nodes of the node pool and records the terminated
+// node, if any.
+func (m *auditingNodePoolManager) RepairNodes(ctx context.Context, nodePool *api.NodePool, notReadyTimeout time.Duration) (*updatestrategy.Node, error) {
+	node, err := m.NodePoolManager.RepairNodes(ctx, nodePool, notReadyTimeout)
+	if node != nil || err != nil {
+		instance := nodePool.Name
+		if node != nil {
+			instance = node.ProviderID
+		}
+		m.auditLog.Record(audit.KindAWS, "repair-instance", instance, err)
+	}
+	return node, err
+}
@@ -0,0 +1,24 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestResources(t *testing.T) {
+	manifest := `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: foo
+  namespace: kube-system
+---
+# comment only document
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: foo
+`
+	assert.Equal(t, []string{"kube-system/ServiceAccount/foo", "ClusterRole/foo"}, manifestResources(manifest))
+}
@@ -0,0 +1,273 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+const (
+	configKeyAutoscalerDeployments = "autoscaler_deployments"
+	defaultAutoscalerDeployments   = "kube-system/cluster-autoscaler,kube-system/kube-downscaler"
+	// suspendedReplicasAnnotation stores the number of replicas of a
+	// suspended deployment. It's persisted on the deployment so the
+	// replicas can be restored even if the CLM is restarted while the
+	// deployment is suspended.
+	suspendedReplicasAnnotation = "cluster-lifecycle-manager.zalando.org/suspended-replicas"
+)
+
+// autoscalerDeployment identifies a deployment of an autoscaling component.
+type autoscalerDeployment struct {
+	namespace string
+	name      string
+}
+
+// autoscalerDeployments returns the deployments of the autoscaling components
+// which are suspended during node pool updates. They're configured as a comma
+// separated list of <namespace>/<name> with the autoscaler_deployments config
+// item, an empty value disables the suspension.
+func autoscalerDeployments(cluster *api.Cluster) ([]autoscalerDeployment, error) {
+	value, ok := cluster.ConfigItems[configKeyAutoscalerDeployments]
+	if !ok {
+		value = defaultAutoscalerDeployments
+	}
+
+	var deployments []autoscalerDeployment
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid value for %s: %s, expected <namespace>/<name>", configKeyAutoscalerDeployments, item)
+		}
+		deployments = append(deployments, autoscalerDeployment{namespace: parts[0], name: parts[1]})
+	}
+	return deployments, nil
+}
+
+// autoscalerSuspender suspends the autoscaling components of a cluster by
+// scaling their deployments to zero so they don't change the desired capacity
+// of the node pools while the nodes are replaced.
+type autoscalerSuspender struct {
+	logger      *log.Entry
+	client      clientset.Interface
+	deployments []autoscalerDeployment
+	auditLog    *audit.Log
+}
+
+// suspend scales the deployments to zero. Deployments which don't exist are
+// ignored. Deployments which are already suspended e.g. by a previous run
+// which was interrupted keep their original number of replicas.
+func (s *autoscalerSuspender) suspend() error {
+	for _, d := range s.deployments {
+		deployment, err := s.client.AppsV1beta1().Deployments(d.namespace).Get(d.name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+
+		if deployment.Annotations == nil {
+			deployment.Annotations = map[string]string{}
+		}
+
+		if _, ok := deployment.Annotations[suspendedReplicasAnnotation]; !ok {
+			deployment.Annotations[suspendedReplicasAnnotation] = strconv.Itoa(int(int32Value(deployment.Spec.Replicas)))
+		} else if int32Value(deployment.Spec.Replicas) == 0 {
+			continue
+		}
+
+		s.logger.Infof("Suspending deployment %s/%s during node pool updates", d.namespace, d.name)
+		deployment.Spec.Replicas = int32Ptr(0)
+		_, err = s.client.AppsV1beta1().Deployments(d.namespace).Update(deployment)
+		s.auditLog.Record(audit.KindKubernetes, "suspend", kubernetesResourceName("deployment", d.namespace, d.name), err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resume restores the replicas of the suspended deployments.
+func (s *autoscalerSuspender) resume() error {
+	for _, d := range s.deployments {
+		deployment, err := s.client.AppsV1beta1().Deployments(d.namespace).Get(d.name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+
+		value, ok := deployment.Annotations[suspendedReplicasAnnotation]
+		if !ok {
+			continue
+		}
+
+		replicas, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation of deployment %s/%s: %s", suspendedReplicasAnnotation, d.namespace, d.name, value)
+		}
+
+		s.logger.Infof("Resuming deployment %s/%s with %d replicas", d.namespace, d.name, replicas)
+		delete(deployment.Annotations, suspendedReplicasAnnotation)
+		deployment.Spec.Replicas = int32Ptr(int32(replicas))
+		_, err = s.client.AppsV1beta1().Deployments(d.namespace).Update(deployment)
+		s.auditLog.Record(audit.KindKubernetes, "resume", kubernetesResourceName("deployment", d.namespace, d.name), err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newAutoscalerSuspender returns the suspender of the autoscaling components
+// of the cluster.
+func (p *clusterpyProvisioner) newAutoscalerSuspender(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster) (*autoscalerSuspender, error) {
+	deployments, err := autoscalerDeployments(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSource, err := p.clusterTokenSource(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, tokenSource, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	return &autoscalerSuspender{
+		logger:      logger,
+		client:      client,
+		deployments: deployments,
+		auditLog:    adapter.audit,
+	}, nil
+}
+
+// pendingReplacements returns true if any of the node pools has nodes which
+// are replaced by the update. Node pools which can't be observed are expected
+// to have nodes to replace.
+func pendingReplacements(logger *log.Entry, nodePoolManager updatestrategy.NodePoolManager, nodePools []*api.NodePool) bool {
+	for _, nodePool := range nodePools {
+		pool, err := nodePoolManager.GetPool(nodePool)
+		if err != nil {
+			logger.Warnf("Failed to get node pool %s: %v", nodePool.Name, err)
+			return true
+		}
+
+		for _, node := range pool.Nodes {
+			if node.Generation != pool.Generation {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updateNodePools updates the node pools of the cluster. The autoscaling
+// components are suspended while nodes are replaced and resumed even if the
+// update fails. Node pools whose new nodes can't be launched for lack of
+// capacity are switched to their next fallback instance type and updated
+// again.
+func (p *clusterpyProvisioner) updateNodePools(ctx context.Context, logger *log.Entry, adapter *awsAdapter, updater updatestrategy.UpdateStrategy, nodePoolProvisioner *AWSNodePoolProvisioner, values map[string]interface{}, cluster *api.Cluster, nodePools []*api.NodePool) error {
+	var suspender *autoscalerSuspender
+	if !adapter.dryRun {
+		var err error
+		suspender, err = p.newAutoscalerSuspender(logger, adapter, cluster)
+		if err != nil {
+			return err
+		}
+
+		// deployments suspended by an interrupted update are resumed
+		// below even if there are no nodes to replace anymore.
+		if pendingReplacements(logger, nodePoolProvisioner.nodePoolManager, nodePools) {
+			err = suspender.suspend()
+			if err != nil {
+				return fmt.Errorf("failed to suspend autoscaling: %v", err)
+			}
+		}
+	}
+
+	err := func() error {
+		sort.Sort(api.NodePools(nodePools))
+		for _, nodePool := range nodePools {
+			err := updateNodePool(ctx, logger, adapter, updater, nodePoolProvisioner, values, cluster, nodePool)
+			if err != nil {
+				return err
+			}
+
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+
+	if suspender != nil {
+		resumeErr := suspender.resume()
+		if resumeErr != nil {
+			if err != nil {
+				logger.Errorf("Failed to resume autoscaling: %v", resumeErr)
+				return err
+			}
+			return fmt.Errorf("failed to resume autoscaling: %v", resumeErr)
+		}
+	}
+	return err
+}
+
+// updateNodePool updates the node pool. If the new nodes can't be launched
+// for lack of capacity the node pool stack is provisioned again with the next
+// fallback instance type, which is recorded in the node pool status, and the
+// update is retried.
+func updateNodePool(ctx context.Context, logger *log.Entry, adapter *awsAdapter, updater updatestrategy.UpdateStrategy, nodePoolProvisioner *AWSNodePoolProvisioner, values map[string]interface{}, cluster *api.Cluster, nodePool *api.NodePool) error {
+	for {
+		poolCtx, span := tracing.StartSpan(ctx, "node-pool-update", map[string]string{"node_pool": nodePool.Name})
+		err := updater.Update(poolCtx, nodePool)
+		span.End(err)
+		if err == nil {
+			return nil
+		}
+
+		fallback, ok := fallbackInstanceType(logger, adapter, cluster, nodePool, err)
+		if !ok {
+			return withBootDiagnostics(logger, adapter, cluster, nodePool, err)
+		}
+
+		logger.Warnf("Insufficient capacity for the nodes of node pool %s, switching to instance type %s: %v", nodePool.Name, fallback, err)
+		recordInstanceTypeSubstitution(nodePool, fallback)
+
+		err = nodePoolProvisioner.ProvisionNodePool(ctx, values, nodePool)
+		if err != nil {
+			return err
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
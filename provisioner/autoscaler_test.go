@@ -0,0 +1,124 @@
+package provisioner
+
+import (
+	"errors"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+)
+
+func TestAutoscalerDeployments(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		expected    []autoscalerDeployment
+		err         bool
+	}{
+		{
+			msg: "default",
+			expected: []autoscalerDeployment{
+				{namespace: "kube-system", name: "cluster-autoscaler"},
+				{namespace: "kube-system", name: "kube-downscaler"},
+			},
+		},
+		{
+			msg:         "custom",
+			configItems: map[string]string{configKeyAutoscalerDeployments: "autoscaling/autoscaler, "},
+			expected:    []autoscalerDeployment{{namespace: "autoscaling", name: "autoscaler"}},
+		},
+		{
+			msg:         "disabled",
+			configItems: map[string]string{configKeyAutoscalerDeployments: ""},
+		},
+		{
+			msg:         "invalid",
+			configItems: map[string]string{configKeyAutoscalerDeployments: "cluster-autoscaler"},
+			err:         true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			deployments, err := autoscalerDeployments(&api.Cluster{ConfigItems: tc.configItems})
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, deployments)
+		})
+	}
+}
+
+func TestAutoscalerSuspender(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "cluster-autoscaler"},
+		Spec:       v1beta1.DeploymentSpec{Replicas: int32Ptr(2)},
+	})
+	suspender := &autoscalerSuspender{
+		logger: log.WithField("test", true),
+		client: client,
+		deployments: []autoscalerDeployment{
+			{namespace: "kube-system", name: "cluster-autoscaler"},
+			{namespace: "kube-system", name: "kube-downscaler"},
+		},
+	}
+
+	replicas := func() (int32, string) {
+		deployment, err := client.AppsV1beta1().Deployments("kube-system").Get("cluster-autoscaler", metav1.GetOptions{})
+		require.NoError(t, err)
+		return int32Value(deployment.Spec.Replicas), deployment.Annotations[suspendedReplicasAnnotation]
+	}
+
+	require.NoError(t, suspender.suspend())
+	current, suspended := replicas()
+	require.EqualValues(t, 0, current)
+	require.Equal(t, "2", suspended)
+
+	// suspending again (e.g. after a restart) keeps the original replicas
+	require.NoError(t, suspender.suspend())
+	current, suspended = replicas()
+	require.EqualValues(t, 0, current)
+	require.Equal(t, "2", suspended)
+
+	require.NoError(t, suspender.resume())
+	current, suspended = replicas()
+	require.EqualValues(t, 2, current)
+	require.Empty(t, suspended)
+
+	// resuming deployments which aren't suspended doesn't change them
+	require.NoError(t, suspender.resume())
+	current, _ = replicas()
+	require.EqualValues(t, 2, current)
+}
+
+type nodePoolStatusManagerStub struct {
+	updatestrategy.NodePoolManager
+	pools map[string]*updatestrategy.NodePool
+}
+
+func (m *nodePoolStatusManagerStub) GetPool(nodePool *api.NodePool) (*updatestrategy.NodePool, error) {
+	pool, ok := m.pools[nodePool.Name]
+	if !ok {
+		return nil, errors.New("node pool not found")
+	}
+	return pool, nil
+}
+
+func TestPendingReplacements(t *testing.T) {
+	logger := log.WithField("test", true)
+	manager := &nodePoolStatusManagerStub{
+		pools: map[string]*updatestrategy.NodePool{
+			"current":  {Generation: 2, Nodes: []*updatestrategy.Node{{Name: "node-1", Generation: 2}}},
+			"outdated": {Generation: 2, Nodes: []*updatestrategy.Node{{Name: "node-2", Generation: 2}, {Name: "node-3", Generation: 1}}},
+		},
+	}
+
+	require.False(t, pendingReplacements(logger, manager, []*api.NodePool{{Name: "current"}}))
+	require.True(t, pendingReplacements(logger, manager, []*api.NodePool{{Name: "current"}, {Name: "outdated"}}))
+	require.True(t, pendingReplacements(logger, manager, []*api.NodePool{{Name: "missing"}}))
+}
@@ -18,17 +18,24 @@ import (
 	"github.com/coreos/container-linux-config-transpiler/config/platform"
 	log "github.com/sirupsen/logrus"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
 	"golang.org/x/oauth2"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/elb"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/sts"
 )
 
 const (
@@ -73,11 +80,25 @@ type cloudFormationAPI interface {
 	DeleteStack(input *cloudformation.DeleteStackInput) (*cloudformation.DeleteStackOutput, error)
 	UpdateTerminationProtection(intput *cloudformation.UpdateTerminationProtectionInput) (*cloudformation.UpdateTerminationProtectionOutput, error)
 	DescribeStacksPages(input *cloudformation.DescribeStacksInput, fn func(resp *cloudformation.DescribeStacksOutput, lastPage bool) bool) error
+	DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (*cloudformation.DescribeStackResourcesOutput, error)
+	ContinueUpdateRollback(input *cloudformation.ContinueUpdateRollbackInput) (*cloudformation.ContinueUpdateRollbackOutput, error)
+	DetectStackDrift(input *cloudformation.DetectStackDriftInput) (*cloudformation.DetectStackDriftOutput, error)
+	DescribeStackDriftDetectionStatus(input *cloudformation.DescribeStackDriftDetectionStatusInput) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error)
+	DescribeStackResourceDrifts(input *cloudformation.DescribeStackResourceDriftsInput) (*cloudformation.DescribeStackResourceDriftsOutput, error)
+	CreateChangeSet(input *cloudformation.CreateChangeSetInput) (*cloudformation.CreateChangeSetOutput, error)
+	DescribeChangeSet(input *cloudformation.DescribeChangeSetInput) (*cloudformation.DescribeChangeSetOutput, error)
+	DeleteChangeSet(input *cloudformation.DeleteChangeSetInput) (*cloudformation.DeleteChangeSetOutput, error)
+	ListExportsPages(input *cloudformation.ListExportsInput, fn func(resp *cloudformation.ListExportsOutput, lastPage bool) bool) error
+	DescribeStackEvents(input *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error)
 }
 
 // s3API is a minimal interface containing only the methods we use from the S3 API
 type s3API interface {
 	CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error)
+	HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error
+	GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput)
 }
 
 type autoscalingAPI interface {
@@ -87,23 +108,45 @@ type autoscalingAPI interface {
 	SuspendProcesses(input *autoscaling.ScalingProcessQuery) (*autoscaling.SuspendProcessesOutput, error)
 	ResumeProcesses(*autoscaling.ScalingProcessQuery) (*autoscaling.ResumeProcessesOutput, error)
 	TerminateInstanceInAutoScalingGroup(*autoscaling.TerminateInstanceInAutoScalingGroupInput) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error)
+	DescribeScalingActivities(input *autoscaling.DescribeScalingActivitiesInput) (*autoscaling.DescribeScalingActivitiesOutput, error)
 }
 
 type iamAPI interface {
 	ListAccountAliases(input *iam.ListAccountAliasesInput) (*iam.ListAccountAliasesOutput, error)
+	GetRole(input *iam.GetRoleInput) (*iam.GetRoleOutput, error)
+	SimulatePrincipalPolicyPages(input *iam.SimulatePrincipalPolicyInput, fn func(*iam.SimulatePolicyResponse, bool) bool) error
 }
 
 type ec2API interface {
 	DescribeInstanceAttribute(input *ec2.DescribeInstanceAttributeInput) (*ec2.DescribeInstanceAttributeOutput, error)
+	DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error)
+	DescribeImages(input *ec2.DescribeImagesInput) (*ec2.DescribeImagesOutput, error)
 	DescribeSpotInstanceRequests(input *ec2.DescribeSpotInstanceRequestsInput) (*ec2.DescribeSpotInstanceRequestsOutput, error)
 	DescribeVpcs(input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error)
 	DescribeVolumes(input *ec2.DescribeVolumesInput) (*ec2.DescribeVolumesOutput, error)
 	DescribeSubnets(input *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error)
+	DescribeNatGateways(input *ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error)
+	DescribeNatGatewaysPages(input *ec2.DescribeNatGatewaysInput, fn func(*ec2.DescribeNatGatewaysOutput, bool) bool) error
+	DescribeAddresses(input *ec2.DescribeAddressesInput) (*ec2.DescribeAddressesOutput, error)
+	DescribeSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error)
+	DescribeSnapshots(input *ec2.DescribeSnapshotsInput) (*ec2.DescribeSnapshotsOutput, error)
+	DescribeRegions(input *ec2.DescribeRegionsInput) (*ec2.DescribeRegionsOutput, error)
+	GetConsoleOutput(input *ec2.GetConsoleOutputInput) (*ec2.GetConsoleOutputOutput, error)
 
 	CreateTags(input *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error)
 	DeleteTags(input *ec2.DeleteTagsInput) (*ec2.DeleteTagsOutput, error)
 
 	DeleteVolume(input *ec2.DeleteVolumeInput) (*ec2.DeleteVolumeOutput, error)
+	DetachVolume(input *ec2.DetachVolumeInput) (*ec2.VolumeAttachment, error)
+	CreateSnapshot(input *ec2.CreateSnapshotInput) (*ec2.Snapshot, error)
+
+	AllocateAddress(input *ec2.AllocateAddressInput) (*ec2.AllocateAddressOutput, error)
+	ReleaseAddress(input *ec2.ReleaseAddressInput) (*ec2.ReleaseAddressOutput, error)
+	CreateNatGateway(input *ec2.CreateNatGatewayInput) (*ec2.CreateNatGatewayOutput, error)
+	DeleteNatGateway(input *ec2.DeleteNatGatewayInput) (*ec2.DeleteNatGatewayOutput, error)
+
+	AuthorizeSecurityGroupIngress(input *ec2.AuthorizeSecurityGroupIngressInput) (*ec2.AuthorizeSecurityGroupIngressOutput, error)
+	RevokeSecurityGroupIngress(input *ec2.RevokeSecurityGroupIngressInput) (*ec2.RevokeSecurityGroupIngressOutput, error)
 }
 
 type s3UploaderAPI interface {
@@ -118,11 +161,23 @@ type awsAdapter struct {
 	autoscalingClient    autoscalingAPI
 	iamClient            iamAPI
 	ec2Client            ec2API
+	eksClient            eksAPI
+	route53Client        route53API
+	elbClient            elbAPI
+	stsClient            stsAPI
 	region               string
 	apiServer            string
 	tokenSrc             oauth2.TokenSource
+	kubectl              string
 	dryRun               bool
 	logger               *log.Entry
+	audit                *audit.Log
+	regionalAdapters     map[string]*awsAdapter
+	stackOptions         stackOptions
+	// lookups caches the AWS lookups of the provisioning run.
+	lookups *awsLookupCache
+	// plan collects the changes instead of applying them if set.
+	plan *Plan
 }
 
 // newAWSAdapter initializes a new awsAdapter.
@@ -135,11 +190,17 @@ func newAWSAdapter(logger *log.Entry, apiServer string, region string, sess *ses
 		s3Uploader:           s3manager.NewUploader(sess),
 		autoscalingClient:    autoscaling.New(sess),
 		ec2Client:            ec2.New(sess),
+		eksClient:            eks.New(sess),
+		route53Client:        route53.New(sess),
+		elbClient:            elb.New(sess),
+		stsClient:            sts.New(sess),
 		region:               region,
 		apiServer:            apiServer,
 		tokenSrc:             tokenSrc,
+		kubectl:              defaultKubectl,
 		dryRun:               dryRun,
 		logger:               logger,
+		lookups:              newAWSLookupCache(),
 	}, nil
 }
 
@@ -182,21 +243,51 @@ func decodeUserData(encodedUserData string) (string, error) {
 
 // CreateOrUpdateClusterStack creates or updates a cluster cloudformation
 // stack. This function is idempotent.
-func (a *awsAdapter) CreateOrUpdateClusterStack(parentCtx context.Context, stackName, stackDefinitionPath string, cluster *api.Cluster) error {
-	name, version, err := splitStackName(stackName)
-	if err != nil {
-		return err
-	}
+func (a *awsAdapter) CreateOrUpdateClusterStack(parentCtx context.Context, stackName, stackDefinitionPath string, cluster *api.Cluster) (err error) {
+	parentCtx, span := tracing.StartSpan(parentCtx, "cloudformation", map[string]string{"stack": stackName, "action": "create-or-update"})
+	defer func() { span.End(err) }()
 
 	// create bucket name with aws account ID to ensure uniqueness across
 	// accounts.
 	s3BucketName := fmt.Sprintf(clmCFBucketPattern, strings.TrimPrefix(cluster.InfrastructureAccount, "aws:"), cluster.Region)
 
-	hostedZone, err := getHostedZone(cluster.APIServerURL)
+	output, err := a.clusterStackTemplate(stackName, stackDefinitionPath, cluster)
+	if err != nil {
+		return err
+	}
+
+	err = validateStackVolumes(cluster, stackName, output)
+	if err != nil {
+		return err
+	}
+
+	err = a.applyClusterStack(stackName, output, cluster, s3BucketName)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, a.stackApplyTimeout())
+	defer cancel()
+	err = a.waitForStack(ctx, waitTime, stackName)
 	if err != nil {
 		return err
 	}
 
+	return nil
+}
+
+// clusterStackTemplate renders the cluster stack from the senza definition.
+func (a *awsAdapter) clusterStackTemplate(stackName, stackDefinitionPath string, cluster *api.Cluster) ([]byte, error) {
+	name, version, err := splitStackName(stackName)
+	if err != nil {
+		return nil, err
+	}
+
+	hostedZone, err := getHostedZone(cluster.APIServerURL)
+	if err != nil {
+		return nil, err
+	}
+
 	args := []string{
 		"print",
 		stackDefinitionPath,
@@ -211,6 +302,19 @@ func (a *awsAdapter) CreateOrUpdateClusterStack(parentCtx context.Context, stack
 		args = append(args, fmt.Sprintf("EtcdS3BackupBucket=%s", bucket))
 	}
 
+	if parameter, ok := apiServerHealthCheckParameter(cluster); ok {
+		err = requireSenzaParameter(stackDefinitionPath, apiServerHealthCheckTargetParameter, "for clusters with several API servers")
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, parameter)
+	}
+
+	return a.senzaPrint(args)
+}
+
+// senzaPrint renders a stack template with senza print.
+func (a *awsAdapter) senzaPrint(args []string) ([]byte, error) {
 	cmd := exec.Command("senza", args...)
 
 	if a.dryRun {
@@ -219,7 +323,7 @@ func (a *awsAdapter) CreateOrUpdateClusterStack(parentCtx context.Context, stack
 
 	enVars, err := a.getEnvVars()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	cmd.Env = enVars
@@ -227,24 +331,11 @@ func (a *awsAdapter) CreateOrUpdateClusterStack(parentCtx context.Context, stack
 	output, err := cmd.Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			return fmt.Errorf("%v: %s", err, string(exitErr.Stderr))
+			return nil, fmt.Errorf("%v: %s", err, string(exitErr.Stderr))
 		}
-		return err
-	}
-
-	err = a.applyClusterStack(stackName, output, cluster, s3BucketName)
-	if err != nil {
-		return err
-	}
-
-	ctx, cancel := context.WithTimeout(parentCtx, maxWaitTimeout)
-	defer cancel()
-	err = a.waitForStack(ctx, waitTime, stackName)
-	if err != nil {
-		return err
+		return nil, err
 	}
-
-	return nil
+	return output, nil
 }
 
 // applyClusterStack creates or updates a stack specified by stackName and
@@ -259,8 +350,23 @@ func (a *awsAdapter) applyClusterStack(stackName string, stackTemplate []byte, c
 		return err
 	}
 
+	templateKey := fmt.Sprintf("%s.template", cluster.ID)
+	if a.plan != nil {
+		// don't overwrite the template of the last update
+		templateKey = fmt.Sprintf("%s.plan.template", cluster.ID)
+	}
+
 	var templateURL string
 	if stackBuffer.Len() > stackMaxSize {
+		// new stacks are planned without uploading the template, the
+		// bucket might not even exist yet.
+		if a.plan != nil {
+			_, err := a.getStackByName(stackName)
+			if isDoesNotExistsErr(err) {
+				return a.planStack(stackName, "", "", nil, true)
+			}
+		}
+
 		// create S3 bucket if it doesn't exist
 		err := a.createS3Bucket(s3BucketName)
 		if err != nil {
@@ -270,9 +376,10 @@ func (a *awsAdapter) applyClusterStack(stackName string, stackTemplate []byte, c
 		// Upload the stack template to S3
 		result, err := a.s3Uploader.Upload(&s3manager.UploadInput{
 			Bucket: aws.String(s3BucketName),
-			Key:    aws.String(fmt.Sprintf("%s.template", cluster.ID)),
+			Key:    aws.String(templateKey),
 			Body:   &stackBuffer,
 		})
+		a.audit.Record(audit.KindAWS, "s3-upload", fmt.Sprintf("s3://%s/%s", s3BucketName, templateKey), err)
 		if err != nil {
 			return err
 		}
@@ -284,6 +391,10 @@ func (a *awsAdapter) applyClusterStack(stackName string, stackTemplate []byte, c
 
 // applyStack applies a cloudformation stack.
 func (a *awsAdapter) applyStack(stackName string, stackTemplate string, stackTemplateURL string, tags []*cloudformation.Tag, updateStack bool) error {
+	if a.plan != nil {
+		return a.planStack(stackName, stackTemplate, stackTemplateURL, tags, updateStack)
+	}
+
 	createParams := &cloudformation.CreateStackInput{
 		StackName:                   aws.String(stackName),
 		OnFailure:                   aws.String(cloudformation.OnFailureDelete),
@@ -318,6 +429,13 @@ func (a *awsAdapter) applyStack(stackName string, stackTemplate string, stackTem
 				}
 
 				if updateStack {
+					// stacks stuck in UPDATE_ROLLBACK_FAILED
+					// can't be updated.
+					err = a.remediateUpdateRollbackFailed(stackName)
+					if err != nil {
+						return err
+					}
+
 					// update the stack
 					updateParams := &cloudformation.UpdateStackInput{
 						StackName:    createParams.StackName,
@@ -340,15 +458,19 @@ func (a *awsAdapter) applyStack(stackName string, stackTemplate string, stackTem
 								return nil
 							}
 						}
+						a.audit.Record(audit.KindAWS, "update-stack", stackName, err)
 						return err
 					}
+					a.audit.Record(audit.KindAWS, "update-stack", stackName, nil)
 				}
 				return nil
 			}
 		}
+		a.audit.Record(audit.KindAWS, "create-stack", stackName, err)
 		return err
 	}
 
+	a.audit.Record(audit.KindAWS, "create-stack", stackName, nil)
 	return nil
 }
 
@@ -368,6 +490,11 @@ func (a *awsAdapter) getStackByName(stackName string) (*cloudformation.Stack, er
 }
 
 func (a *awsAdapter) waitForStack(ctx context.Context, waitTime time.Duration, stackName string) error {
+	// planned stacks are never changed
+	if a.plan != nil {
+		return nil
+	}
+
 	for {
 		stack, err := a.getStackByName(stackName)
 		if err != nil {
@@ -446,7 +573,10 @@ func cloudformationHasTags(expected map[string]string, tags []*cloudformation.Ta
 }
 
 // DeleteStack deletes a cloudformation stack.
-func (a *awsAdapter) DeleteStack(parentCtx context.Context, stackName string) error {
+func (a *awsAdapter) DeleteStack(parentCtx context.Context, stackName string) (err error) {
+	parentCtx, span := tracing.StartSpan(parentCtx, "cloudformation", map[string]string{"stack": stackName, "action": "delete"})
+	defer func() { span.End(err) }()
+
 	a.logger.Infof("Deleting stack '%s'", stackName)
 
 	// disable termination protection on stack before deleting
@@ -455,7 +585,7 @@ func (a *awsAdapter) DeleteStack(parentCtx context.Context, stackName string) er
 		EnableTerminationProtection: aws.Bool(false),
 	}
 
-	_, err := a.cloudformationClient.UpdateTerminationProtection(terminationParams)
+	_, err = a.cloudformationClient.UpdateTerminationProtection(terminationParams)
 	if err != nil {
 		if isDoesNotExistsErr(err) {
 			return nil
@@ -472,12 +602,18 @@ func (a *awsAdapter) DeleteStack(parentCtx context.Context, stackName string) er
 		if isDoesNotExistsErr(err) {
 			return nil
 		}
+		a.audit.Record(audit.KindAWS, "delete-stack", stackName, err)
 		return err
 	}
+	a.audit.Record(audit.KindAWS, "delete-stack", stackName, nil)
 
-	ctx, cancel := context.WithTimeout(parentCtx, maxWaitTimeout)
+	ctx, cancel := context.WithTimeout(parentCtx, a.stackDeleteTimeout())
 	defer cancel()
 	err = a.waitForStack(ctx, waitTime, stackName)
+	if err == errDeleteFailed && a.stackOptions.retainFailedResources {
+		a.logger.Warnf("Failed to delete stack '%s', retrying while retaining the failed resources", stackName)
+		err = a.remediateDeleteFailed(parentCtx, stackName)
+	}
 	if err != nil {
 		if isDoesNotExistsErr(err) {
 			return nil
@@ -487,52 +623,33 @@ func (a *awsAdapter) DeleteStack(parentCtx context.Context, stackName string) er
 	return nil
 }
 
-// CreateOrUpdateEtcdStack creates or updates an etcd stack.
-func (a *awsAdapter) CreateOrUpdateEtcdStack(parentCtx context.Context, stackName string, stackDefinitionPath string, cluster *api.Cluster) error {
-	bucketName := fmt.Sprintf("zalando-kubernetes-etcd-%s-%s", getAWSAccountID(cluster.InfrastructureAccount), cluster.Region)
-
+// etcdBackupBucket returns the name of the S3 bucket storing the etcd
+// backups of the cluster.
+func etcdBackupBucket(cluster *api.Cluster) (string, error) {
 	if bucket, ok := cluster.ConfigItems[etcdS3BackupBucketKey]; ok {
-		bucketName = bucket
+		return bucket, nil
 	}
-
-	hostedZone, err := getHostedZone(cluster.APIServerURL)
+	accountID, err := getAWSAccountID(cluster.InfrastructureAccount)
 	if err != nil {
-		return err
-	}
-
-	args := []string{
-		"print",
-		stackDefinitionPath,
-		"etcd",
-		fmt.Sprintf("HostedZone=%s", hostedZone),
-		fmt.Sprintf("EtcdS3Backup=%s", bucketName),
-	}
-
-	if instanceType, ok := cluster.ConfigItems[etcdInstanceTypeKey]; ok {
-		args = append(args, fmt.Sprintf("InstanceType=%s", instanceType))
+		return "", err
 	}
+	return fmt.Sprintf("zalando-kubernetes-etcd-%s-%s", accountID, cluster.Region), nil
+}
 
-	cmd := exec.Command(
-		"senza",
-		args...,
-	)
-
-	if a.dryRun {
-		cmd.Args = append(cmd.Args, "--dry-run")
-	}
+// CreateOrUpdateEtcdStack creates or updates the etcd stack with the given
+// senza version. Additional stack parameters can be passed as 'key=value'.
+func (a *awsAdapter) CreateOrUpdateEtcdStack(parentCtx context.Context, stackVersion string, stackDefinitionPath string, cluster *api.Cluster, parameters ...string) (err error) {
+	stackName := etcdStackNamePrefix + stackVersion
+	parentCtx, span := tracing.StartSpan(parentCtx, "cloudformation", map[string]string{"stack": stackName, "action": "create-or-update"})
+	defer func() { span.End(err) }()
 
-	enVars, err := a.getEnvVars()
+	output, err := a.etcdStackTemplate(stackVersion, stackDefinitionPath, cluster, parameters...)
 	if err != nil {
 		return err
 	}
 
-	cmd.Env = enVars
-
-	output, err := cmd.Output()
+	err = validateStackVolumes(cluster, stackName, output)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return fmt.Errorf("%v: %s", err, string(exitErr.Stderr))
-		}
 		return err
 	}
 
@@ -541,7 +658,7 @@ func (a *awsAdapter) CreateOrUpdateEtcdStack(parentCtx context.Context, stackNam
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(parentCtx, maxWaitTimeout)
+	ctx, cancel := context.WithTimeout(parentCtx, a.stackApplyTimeout())
 	defer cancel()
 	err = a.waitForStack(ctx, waitTime, stackName)
 	if err != nil {
@@ -551,8 +668,41 @@ func (a *awsAdapter) CreateOrUpdateEtcdStack(parentCtx context.Context, stackNam
 	return nil
 }
 
+// etcdStackTemplate renders the etcd stack from the senza definition.
+func (a *awsAdapter) etcdStackTemplate(stackVersion string, stackDefinitionPath string, cluster *api.Cluster, parameters ...string) ([]byte, error) {
+	bucketName, err := etcdBackupBucket(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	hostedZone, err := getHostedZone(cluster.APIServerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"print",
+		stackDefinitionPath,
+		stackVersion,
+		fmt.Sprintf("HostedZone=%s", hostedZone),
+		fmt.Sprintf("EtcdS3Backup=%s", bucketName),
+	}
+
+	if instanceType, ok := cluster.ConfigItems[etcdInstanceTypeKey]; ok {
+		args = append(args, fmt.Sprintf("InstanceType=%s", instanceType))
+	}
+
+	args = append(args, parameters...)
+
+	return a.senzaPrint(args)
+}
+
 // createS3Bucket creates an s3 bucket if it doesn't exist.
 func (a *awsAdapter) createS3Bucket(bucket string) error {
+	if a.plan != nil {
+		return nil
+	}
+
 	params := &s3.CreateBucketInput{
 		Bucket: aws.String(bucket),
 		CreateBucketConfiguration: &s3.CreateBucketConfiguration{
@@ -560,7 +710,7 @@ func (a *awsAdapter) createS3Bucket(bucket string) error {
 		},
 	}
 
-	return backoff.Retry(
+	err := backoff.Retry(
 		func() error {
 			_, err := a.s3Client.CreateBucket(params)
 			if err != nil {
@@ -572,10 +722,16 @@ func (a *awsAdapter) createS3Bucket(bucket string) error {
 						return nil
 					}
 				}
+				return err
 			}
-			return err
+			a.audit.Record(audit.KindAWS, "create-bucket", bucket, nil)
+			return nil
 		},
 		backoff.WithMaxTries(backoff.NewExponentialBackOff(), 10))
+	if err != nil {
+		a.audit.Record(audit.KindAWS, "create-bucket", bucket, err)
+	}
+	return err
 }
 
 func clcToIgnition(data []byte) ([]byte, error) {
@@ -653,34 +809,109 @@ func (a *awsAdapter) DeleteVolume(id string) error {
 	_, err := a.ec2Client.DeleteVolume(&ec2.DeleteVolumeInput{
 		VolumeId: aws.String(id),
 	})
+	a.audit.Record(audit.KindAWS, "delete-volume", id, err)
 	return err
 }
 
+// DetachTerminatedVolume force detaches the volume from the instances it's
+// attached to once they're terminated. An error is returned while any of the
+// instances isn't terminated yet or the volume is already being detached.
+func (a *awsAdapter) DetachTerminatedVolume(logger *log.Entry, volume *ec2.Volume) error {
+	volumeID := aws.StringValue(volume.VolumeId)
+
+	for _, attachment := range volume.Attachments {
+		instanceID := aws.StringValue(attachment.InstanceId)
+		if aws.StringValue(attachment.State) == ec2.VolumeAttachmentStateDetaching {
+			return fmt.Errorf("EBS volume %s is being detached from instance %s", volumeID, instanceID)
+		}
+
+		state, err := a.instanceState(instanceID)
+		if err != nil {
+			return err
+		}
+		if state != ec2.InstanceStateNameTerminated {
+			return fmt.Errorf("EBS volume %s is attached to instance %s in state %s", volumeID, instanceID, state)
+		}
+
+		logger.Infof("Detaching EBS volume %s from terminated instance %s", volumeID, instanceID)
+		_, err = a.ec2Client.DetachVolume(&ec2.DetachVolumeInput{
+			VolumeId:   volume.VolumeId,
+			InstanceId: attachment.InstanceId,
+			Force:      aws.Bool(true),
+		})
+		a.audit.Record(audit.KindAWS, "detach-volume", volumeID, err)
+		if err != nil {
+			return fmt.Errorf("failed to detach EBS volume %s from instance %s: %v", volumeID, instanceID, err)
+		}
+	}
+	return nil
+}
+
+// instanceState returns the state of the instance. Instances which can't be
+// found anymore are terminated.
+func (a *awsAdapter) instanceState(instanceID string) (string, error) {
+	resp, err := a.ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice([]string{instanceID}),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidInstanceID.NotFound" {
+			return ec2.InstanceStateNameTerminated, nil
+		}
+		return "", err
+	}
+
+	for _, reservation := range resp.Reservations {
+		for _, instance := range reservation.Instances {
+			if instance.State != nil {
+				return aws.StringValue(instance.State.Name), nil
+			}
+		}
+	}
+	return ec2.InstanceStateNameTerminated, nil
+}
+
 // GetSubnets gets all subnets of the default VPC in the target account.
 func (a *awsAdapter) GetSubnets() ([]*ec2.Subnet, error) {
-	// find default VPC
+	defaultVpc, err := a.defaultVPC()
+	if err != nil {
+		return nil, err
+	}
+
+	return a.vpcSubnets(defaultVpc)
+}
+
+// defaultVPC returns the default VPC of the target account.
+func (a *awsAdapter) defaultVPC() (*ec2.Vpc, error) {
+	if vpc, ok := a.lookups.getDefaultVPC(); ok {
+		return vpc, nil
+	}
+
 	vpcResp, err := a.ec2Client.DescribeVpcs(&ec2.DescribeVpcsInput{})
 	if err != nil {
 		return nil, err
 	}
 
-	var defaultVpc *ec2.Vpc
 	for _, vpc := range vpcResp.Vpcs {
 		if aws.BoolValue(vpc.IsDefault) {
-			defaultVpc = vpc
-			break
+			a.lookups.setDefaultVPC(vpc)
+			return vpc, nil
 		}
 	}
 
-	if defaultVpc == nil {
-		return nil, fmt.Errorf("default VPC not found in account")
+	return nil, fmt.Errorf("default VPC not found in account")
+}
+
+// vpcSubnets returns the subnets of the VPC.
+func (a *awsAdapter) vpcSubnets(vpc *ec2.Vpc) ([]*ec2.Subnet, error) {
+	if subnets, ok := a.lookups.getSubnets(aws.StringValue(vpc.VpcId)); ok {
+		return subnets, nil
 	}
 
 	subnetParams := &ec2.DescribeSubnetsInput{
 		Filters: []*ec2.Filter{
 			{
 				Name:   aws.String("vpc-id"),
-				Values: []*string{defaultVpc.VpcId},
+				Values: []*string{vpc.VpcId},
 			},
 		},
 	}
@@ -690,6 +921,7 @@ func (a *awsAdapter) GetSubnets() ([]*ec2.Subnet, error) {
 		return nil, err
 	}
 
+	a.lookups.setSubnets(aws.StringValue(vpc.VpcId), subnetResp.Subnets)
 	return subnetResp.Subnets, nil
 }
 
@@ -701,6 +933,8 @@ func (a *awsAdapter) CreateTags(resource string, tags []*ec2.Tag) error {
 	}
 
 	_, err := a.ec2Client.CreateTags(params)
+	a.lookups.invalidateTags()
+	a.audit.Record(audit.KindAWS, "create-tags", resource, err)
 	return err
 }
 
@@ -712,6 +946,8 @@ func (a *awsAdapter) DeleteTags(resource string, tags []*ec2.Tag) error {
 	}
 
 	_, err := a.ec2Client.DeleteTags(params)
+	a.lookups.invalidateTags()
+	a.audit.Record(audit.KindAWS, "delete-tags", resource, err)
 	return err
 }
 
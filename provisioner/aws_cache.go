@@ -0,0 +1,104 @@
+package provisioner
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsLookupCache caches the results of the AWS lookups repeated during a
+// provisioning run, e.g. the subnets of the default VPC which are looked up
+// to compute the values, to tag them and to provision the node pools. It
+// lives as long as the adapter, which is created for every run, and the
+// mutations of the adapter invalidate the lookups they affect. A nil cache
+// caches nothing.
+type awsLookupCache struct {
+	sync.Mutex
+	defaultVPC *ec2.Vpc
+	// subnets and natGateways are keyed by VPC ID.
+	subnets     map[string][]*ec2.Subnet
+	natGateways map[string][]*ec2.NatGateway
+}
+
+func newAWSLookupCache() *awsLookupCache {
+	return &awsLookupCache{
+		subnets:     make(map[string][]*ec2.Subnet),
+		natGateways: make(map[string][]*ec2.NatGateway),
+	}
+}
+
+func (c *awsLookupCache) getDefaultVPC() (*ec2.Vpc, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	return c.defaultVPC, c.defaultVPC != nil
+}
+
+func (c *awsLookupCache) setDefaultVPC(vpc *ec2.Vpc) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.defaultVPC = vpc
+}
+
+func (c *awsLookupCache) getSubnets(vpcID string) ([]*ec2.Subnet, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	subnets, ok := c.subnets[vpcID]
+	return subnets, ok
+}
+
+func (c *awsLookupCache) setSubnets(vpcID string, subnets []*ec2.Subnet) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.subnets[vpcID] = subnets
+}
+
+func (c *awsLookupCache) getNatGateways(vpcID string) ([]*ec2.NatGateway, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	natGateways, ok := c.natGateways[vpcID]
+	return natGateways, ok
+}
+
+func (c *awsLookupCache) setNatGateways(vpcID string, natGateways []*ec2.NatGateway) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.natGateways[vpcID] = natGateways
+}
+
+// invalidateTags drops the cached lookups including the tags of the
+// resources, which are stale after the tags were changed.
+func (c *awsLookupCache) invalidateTags() {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.defaultVPC = nil
+	c.subnets = make(map[string][]*ec2.Subnet)
+	c.natGateways = make(map[string][]*ec2.NatGateway)
+}
@@ -0,0 +1,70 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type ec2LookupAPIStub struct {
+	ec2API
+	calls map[string]int
+}
+
+func (e *ec2LookupAPIStub) DescribeVpcs(input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	e.calls["DescribeVpcs"]++
+	return &ec2.DescribeVpcsOutput{Vpcs: []*ec2.Vpc{
+		{VpcId: aws.String("vpc-2")},
+		{VpcId: aws.String("vpc-1"), IsDefault: aws.Bool(true)},
+	}}, nil
+}
+
+func (e *ec2LookupAPIStub) DescribeSubnets(input *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	e.calls["DescribeSubnets"]++
+	return &ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{{SubnetId: aws.String("subnet-a")}}}, nil
+}
+
+func (e *ec2LookupAPIStub) DescribeNatGateways(input *ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error) {
+	e.calls["DescribeNatGateways"]++
+	return &ec2.DescribeNatGatewaysOutput{}, nil
+}
+
+func (e *ec2LookupAPIStub) CreateTags(input *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func TestAWSLookupCache(t *testing.T) {
+	stub := &ec2LookupAPIStub{calls: make(map[string]int)}
+	adapter := &awsAdapter{ec2Client: stub, lookups: newAWSLookupCache()}
+
+	for i := 0; i < 3; i++ {
+		subnets, err := adapter.GetSubnets()
+		require.NoError(t, err)
+		require.Len(t, subnets, 1)
+
+		vpc, err := adapter.defaultVPC()
+		require.NoError(t, err)
+		require.Equal(t, "vpc-1", aws.StringValue(vpc.VpcId))
+
+		_, err = adapter.vpcInfrastructureFacts(&api.Cluster{}, vpc, subnets)
+		require.NoError(t, err)
+	}
+	require.Equal(t, map[string]int{"DescribeVpcs": 1, "DescribeSubnets": 1, "DescribeNatGateways": 1}, stub.calls)
+
+	// changing tags invalidates the lookups
+	require.NoError(t, adapter.CreateTags("subnet-a", []*ec2.Tag{{Key: aws.String("foo"), Value: aws.String("bar")}}))
+	_, err := adapter.GetSubnets()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"DescribeVpcs": 2, "DescribeSubnets": 2, "DescribeNatGateways": 1}, stub.calls)
+
+	// adapters without a cache always look up
+	adapter.lookups = nil
+	_, err = adapter.GetSubnets()
+	require.NoError(t, err)
+	_, err = adapter.GetSubnets()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"DescribeVpcs": 4, "DescribeSubnets": 4, "DescribeNatGateways": 1}, stub.calls)
+}
@@ -11,6 +11,8 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
@@ -22,12 +24,52 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-type s3APIStub struct{}
+type s3APIStub struct {
+	objects []*s3.Object
+}
 
 func (s *s3APIStub) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
 	return nil, nil
 }
 
+func (s *s3APIStub) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	for _, object := range s.objects {
+		if aws.StringValue(object.Key) == aws.StringValue(input.Key) {
+			return &s3.HeadObjectOutput{LastModified: object.LastModified}, nil
+		}
+	}
+	return nil, awserr.New("NotFound", "Not Found", nil)
+}
+
+func (s *s3APIStub) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	for i, object := range s.objects {
+		if aws.StringValue(object.Key) == aws.StringValue(input.Key) {
+			s.objects = append(s.objects[:i], s.objects[i+1:]...)
+			break
+		}
+	}
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (s *s3APIStub) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	var contents []*s3.Object
+	for _, object := range s.objects {
+		if strings.HasPrefix(aws.StringValue(object.Key), aws.StringValue(input.Prefix)) {
+			contents = append(contents, object)
+		}
+	}
+	fn(&s3.ListObjectsV2Output{Contents: contents}, true)
+	return nil
+}
+
+func (s *s3APIStub) GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("eu-central-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+	return s3.New(sess).GetObjectRequest(input)
+}
+
 type cloudFormationAPIStub struct {
 	statusMutex         *sync.Mutex
 	status              *string
@@ -35,11 +77,17 @@ type cloudFormationAPIStub struct {
 	createErr           error
 	updateErr           error
 	deleteErr           error
+	drifts              []*cloudformation.StackResourceDrift
+	changeSet           *cloudformation.DescribeChangeSetOutput
+	changeSetDeleted    bool
+	outputs             []*cloudformation.Output
+	tags                []*cloudformation.Tag
+	exports             []*cloudformation.Export
 }
 
 func (c *cloudFormationAPIStub) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
 	name := "foobar"
-	s := cloudformation.Stack{StackName: aws.String(name), StackStatus: c.getStatus()}
+	s := cloudformation.Stack{StackName: aws.String(name), StackStatus: c.getStatus(), Outputs: c.outputs, Tags: c.tags}
 	if c.onDescribeStackChan != nil {
 		c.onDescribeStackChan <- struct{}{}
 	}
@@ -66,6 +114,56 @@ func (c *cloudFormationAPIStub) DescribeStacksPages(input *cloudformation.Descri
 	return nil
 }
 
+func (c *cloudFormationAPIStub) DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (*cloudformation.DescribeStackResourcesOutput, error) {
+	return &cloudformation.DescribeStackResourcesOutput{}, nil
+}
+
+func (c *cloudFormationAPIStub) ContinueUpdateRollback(input *cloudformation.ContinueUpdateRollbackInput) (*cloudformation.ContinueUpdateRollbackOutput, error) {
+	c.setStatus(cloudformation.StackStatusUpdateRollbackComplete)
+	return nil, nil
+}
+
+func (c *cloudFormationAPIStub) DetectStackDrift(input *cloudformation.DetectStackDriftInput) (*cloudformation.DetectStackDriftOutput, error) {
+	return &cloudformation.DetectStackDriftOutput{StackDriftDetectionId: aws.String("detection")}, nil
+}
+
+func (c *cloudFormationAPIStub) DescribeStackDriftDetectionStatus(input *cloudformation.DescribeStackDriftDetectionStatusInput) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+	status := cloudformation.StackDriftStatusInSync
+	if len(c.drifts) > 0 {
+		status = cloudformation.StackDriftStatusDrifted
+	}
+	return &cloudformation.DescribeStackDriftDetectionStatusOutput{
+		DetectionStatus:  aws.String(cloudformation.StackDriftDetectionStatusDetectionComplete),
+		StackDriftStatus: aws.String(status),
+	}, nil
+}
+
+func (c *cloudFormationAPIStub) DescribeStackResourceDrifts(input *cloudformation.DescribeStackResourceDriftsInput) (*cloudformation.DescribeStackResourceDriftsOutput, error) {
+	return &cloudformation.DescribeStackResourceDriftsOutput{StackResourceDrifts: c.drifts}, nil
+}
+
+func (c *cloudFormationAPIStub) CreateChangeSet(input *cloudformation.CreateChangeSetInput) (*cloudformation.CreateChangeSetOutput, error) {
+	return &cloudformation.CreateChangeSetOutput{Id: aws.String("changeset")}, nil
+}
+
+func (c *cloudFormationAPIStub) DescribeChangeSet(input *cloudformation.DescribeChangeSetInput) (*cloudformation.DescribeChangeSetOutput, error) {
+	return c.changeSet, nil
+}
+
+func (c *cloudFormationAPIStub) DeleteChangeSet(input *cloudformation.DeleteChangeSetInput) (*cloudformation.DeleteChangeSetOutput, error) {
+	c.changeSetDeleted = true
+	return &cloudformation.DeleteChangeSetOutput{}, nil
+}
+
+func (c *cloudFormationAPIStub) ListExportsPages(input *cloudformation.ListExportsInput, fn func(resp *cloudformation.ListExportsOutput, lastPage bool) bool) error {
+	fn(&cloudformation.ListExportsOutput{Exports: c.exports}, true)
+	return nil
+}
+
+func (c *cloudFormationAPIStub) DescribeStackEvents(input *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+	return &cloudformation.DescribeStackEventsOutput{}, nil
+}
+
 func (c *cloudFormationAPIStub) setStatus(status string) {
 	c.statusMutex.Lock()
 	c.status = &status
@@ -102,6 +200,9 @@ func (a *autoscalingAPIStub) ResumeProcesses(*autoscaling.ScalingProcessQuery) (
 func (a *autoscalingAPIStub) TerminateInstanceInAutoScalingGroup(*autoscaling.TerminateInstanceInAutoScalingGroupInput) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error) {
 	return nil, nil
 }
+func (a *autoscalingAPIStub) DescribeScalingActivities(input *autoscaling.DescribeScalingActivitiesInput) (*autoscaling.DescribeScalingActivitiesOutput, error) {
+	return &autoscaling.DescribeScalingActivitiesOutput{}, nil
+}
 
 type s3UploaderAPIStub struct {
 	err error
@@ -0,0 +1,260 @@
+package provisioner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const (
+	// bootDiagnosticsMaxInstances is the maximum number of instances the
+	// console output is collected of.
+	bootDiagnosticsMaxInstances = 3
+	// bootDiagnosticsConsoleLines is the number of console output lines
+	// of every instance included in the error.
+	bootDiagnosticsConsoleLines = 20
+	// bootDiagnosticsMaxEvents is the maximum number of scaling activities
+	// and stack events per ASG and stack.
+	bootDiagnosticsMaxEvents = 5
+
+	autoscalingGroupResourceType = "AWS::AutoScaling::AutoScalingGroup"
+)
+
+// bootDiagnostics are the forensics collected for the instances of a node
+// pool which didn't become ready.
+type bootDiagnostics struct {
+	nodePool    string
+	instances   []*instanceDiagnostics
+	activities  []string
+	stackEvents []string
+}
+
+// instanceDiagnostics are the forensics of a single instance.
+type instanceDiagnostics struct {
+	instanceID    string
+	state         string
+	consoleOutput string
+}
+
+// report returns the diagnostics, with at most lines lines of console output
+// per instance. All lines are included if lines is 0.
+func (d *bootDiagnostics) report(lines int) string {
+	var report bytes.Buffer
+	fmt.Fprintf(&report, "boot diagnostics of node pool %s:", d.nodePool)
+
+	for _, instance := range d.instances {
+		fmt.Fprintf(&report, "\ninstance %s (%s), console output:\n%s", instance.instanceID, instance.state, lastLines(instance.consoleOutput, lines))
+	}
+
+	if len(d.activities) > 0 {
+		fmt.Fprintf(&report, "\nscaling activities:\n%s", strings.Join(d.activities, "\n"))
+	}
+
+	if len(d.stackEvents) > 0 {
+		fmt.Fprintf(&report, "\nfailed stack events:\n%s", strings.Join(d.stackEvents, "\n"))
+	}
+	return report.String()
+}
+
+// lastLines returns the last n lines of s, or s if n is 0.
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if n == 0 || len(lines) <= n {
+		return strings.Join(lines, "\n")
+	}
+	return strings.Join(lines[len(lines)-n:], "\n")
+}
+
+// withBootDiagnostics adds the boot diagnostics of the node pool to err if
+// its nodes didn't become ready. The complete console output is logged.
+// Failing to collect the diagnostics doesn't change err.
+func withBootDiagnostics(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, nodePool *api.NodePool, err error) error {
+	notReady, ok := err.(*updatestrategy.NodesNotReadyError)
+	if !ok {
+		return err
+	}
+
+	diagnostics, diagErr := adapter.collectBootDiagnostics(cluster, nodePool, notReady.ReadyNodes)
+	if diagErr != nil {
+		logger.Warnf("Failed to collect boot diagnostics of node pool %s: %v", nodePool.Name, diagErr)
+		return err
+	}
+
+	logger.Warn(diagnostics.report(0))
+	return fmt.Errorf("%v\n%s", err, diagnostics.report(bootDiagnosticsConsoleLines))
+}
+
+// collectBootDiagnostics collects the console output of the instances of the
+// node pool which aren't ready, the recent scaling activities of its ASGs and
+// the failed events of its stacks.
+func (a *awsAdapter) collectBootDiagnostics(cluster *api.Cluster, nodePool *api.NodePool, readyNodes []string) (*bootDiagnostics, error) {
+	ready := make(map[string]bool, len(readyNodes))
+	for _, providerID := range readyNodes {
+		ready[providerID] = true
+	}
+
+	stacks, err := a.listNodePoolStacks(cluster, nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := &bootDiagnostics{nodePool: nodePool.Name}
+	for _, stack := range stacks {
+		events, err := a.failedStackEvents(aws.StringValue(stack.StackName))
+		if err != nil {
+			return nil, err
+		}
+		diagnostics.stackEvents = append(diagnostics.stackEvents, events...)
+
+		asgNames, err := a.stackAutoscalingGroups(aws.StringValue(stack.StackName))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, asgName := range asgNames {
+			err := a.collectASGDiagnostics(diagnostics, asgName, ready)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return diagnostics, nil
+}
+
+// listNodePoolStacks returns the stacks of the node pool, one per
+// availability zone for node pools with zonal stacks.
+func (a *awsAdapter) listNodePoolStacks(cluster *api.Cluster, nodePool *api.NodePool) ([]*cloudformation.Stack, error) {
+	return a.ListStacks(map[string]string{
+		tagNameKubernetesClusterPrefix + cluster.ID: resourceLifecycleOwned,
+		nodePoolTagKey: nodePool.Name,
+	})
+}
+
+// stackAutoscalingGroups returns the names of the ASGs of the stack.
+func (a *awsAdapter) stackAutoscalingGroups(stackName string) ([]string, error) {
+	resources, err := a.cloudformationClient.DescribeStackResources(&cloudformation.DescribeStackResourcesInput{
+		StackName: aws.String(stackName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var asgNames []string
+	for _, resource := range resources.StackResources {
+		if aws.StringValue(resource.ResourceType) == autoscalingGroupResourceType {
+			asgNames = append(asgNames, aws.StringValue(resource.PhysicalResourceId))
+		}
+	}
+	return asgNames, nil
+}
+
+// collectASGDiagnostics adds the scaling activities of the ASG and the
+// console output of its instances which aren't ready to the diagnostics.
+func (a *awsAdapter) collectASGDiagnostics(diagnostics *bootDiagnostics, asgName string, ready map[string]bool) error {
+	activities, err := a.autoscalingClient.DescribeScalingActivities(&autoscaling.DescribeScalingActivitiesInput{
+		AutoScalingGroupName: aws.String(asgName),
+		MaxRecords:           aws.Int64(bootDiagnosticsMaxEvents),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, activity := range activities.Activities {
+		description := aws.StringValue(activity.Description)
+		if message := aws.StringValue(activity.StatusMessage); message != "" {
+			description = fmt.Sprintf("%s (%s)", description, message)
+		}
+
+		diagnostics.activities = append(diagnostics.activities, fmt.Sprintf("%s %s: %s: %s",
+			aws.TimeValue(activity.StartTime).UTC().Format("2006-01-02T15:04:05Z"),
+			asgName,
+			aws.StringValue(activity.StatusCode),
+			description))
+	}
+
+	groups, err := a.autoscalingClient.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(asgName)},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups.AutoScalingGroups {
+		for _, instance := range group.Instances {
+			providerID := fmt.Sprintf("aws:///%s/%s", aws.StringValue(instance.AvailabilityZone), aws.StringValue(instance.InstanceId))
+			if ready[providerID] || len(diagnostics.instances) >= bootDiagnosticsMaxInstances {
+				continue
+			}
+
+			consoleOutput, err := a.consoleOutput(aws.StringValue(instance.InstanceId))
+			if err != nil {
+				return err
+			}
+
+			diagnostics.instances = append(diagnostics.instances, &instanceDiagnostics{
+				instanceID:    aws.StringValue(instance.InstanceId),
+				state:         fmt.Sprintf("%s, %s", aws.StringValue(instance.LifecycleState), aws.StringValue(instance.HealthStatus)),
+				consoleOutput: consoleOutput,
+			})
+		}
+	}
+	return nil
+}
+
+// consoleOutput returns the console output of the instance. It's only
+// available a few minutes after the instance started.
+func (a *awsAdapter) consoleOutput(instanceID string) (string, error) {
+	resp, err := a.ec2Client.GetConsoleOutput(&ec2.GetConsoleOutputInput{
+		InstanceId: aws.String(instanceID),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if aws.StringValue(resp.Output) == "" {
+		return "<no console output yet>", nil
+	}
+
+	output, err := base64.StdEncoding.DecodeString(aws.StringValue(resp.Output))
+	if err != nil {
+		return "", fmt.Errorf("invalid console output of instance %s: %v", instanceID, err)
+	}
+	return string(output), nil
+}
+
+// failedStackEvents returns the most recent failed events of the stack.
+func (a *awsAdapter) failedStackEvents(stackName string) ([]string, error) {
+	resp, err := a.cloudformationClient.DescribeStackEvents(&cloudformation.DescribeStackEventsInput{
+		StackName: aws.String(stackName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var events []string
+	for _, event := range resp.StackEvents {
+		if !strings.HasSuffix(aws.StringValue(event.ResourceStatus), "_FAILED") {
+			continue
+		}
+
+		events = append(events, fmt.Sprintf("%s %s %s: %s: %s",
+			aws.TimeValue(event.Timestamp).UTC().Format("2006-01-02T15:04:05Z"),
+			stackName,
+			aws.StringValue(event.LogicalResourceId),
+			aws.StringValue(event.ResourceStatus),
+			aws.StringValue(event.ResourceStatusReason)))
+		if len(events) == bootDiagnosticsMaxEvents {
+			break
+		}
+	}
+	return events, nil
+}
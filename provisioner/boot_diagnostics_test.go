@@ -0,0 +1,158 @@
+package provisioner
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+type bootDiagnosticsCloudFormationStub struct {
+	cloudFormationAPI
+	stacks    []*cloudformation.Stack
+	resources []*cloudformation.StackResource
+	events    []*cloudformation.StackEvent
+}
+
+func (s *bootDiagnosticsCloudFormationStub) DescribeStacksPages(input *cloudformation.DescribeStacksInput, fn func(*cloudformation.DescribeStacksOutput, bool) bool) error {
+	fn(&cloudformation.DescribeStacksOutput{Stacks: s.stacks}, true)
+	return nil
+}
+
+func (s *bootDiagnosticsCloudFormationStub) DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (*cloudformation.DescribeStackResourcesOutput, error) {
+	return &cloudformation.DescribeStackResourcesOutput{StackResources: s.resources}, nil
+}
+
+func (s *bootDiagnosticsCloudFormationStub) DescribeStackEvents(input *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+	return &cloudformation.DescribeStackEventsOutput{StackEvents: s.events}, nil
+}
+
+type bootDiagnosticsAutoscalingStub struct {
+	autoscalingAPI
+	instances  []*autoscaling.Instance
+	activities []*autoscaling.Activity
+}
+
+func (s *bootDiagnosticsAutoscalingStub) DescribeScalingActivities(input *autoscaling.DescribeScalingActivitiesInput) (*autoscaling.DescribeScalingActivitiesOutput, error) {
+	return &autoscaling.DescribeScalingActivitiesOutput{Activities: s.activities}, nil
+}
+
+func (s *bootDiagnosticsAutoscalingStub) DescribeAutoScalingGroups(input *autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	return &autoscaling.DescribeAutoScalingGroupsOutput{
+		AutoScalingGroups: []*autoscaling.Group{{AutoScalingGroupName: input.AutoScalingGroupNames[0], Instances: s.instances}},
+	}, nil
+}
+
+type ec2ConsoleOutputAPIStub struct {
+	ec2API
+	output map[string]string
+}
+
+func (s *ec2ConsoleOutputAPIStub) GetConsoleOutput(input *ec2.GetConsoleOutputInput) (*ec2.GetConsoleOutputOutput, error) {
+	output, ok := s.output[aws.StringValue(input.InstanceId)]
+	if !ok {
+		return &ec2.GetConsoleOutputOutput{InstanceId: input.InstanceId}, nil
+	}
+	return &ec2.GetConsoleOutputOutput{
+		InstanceId: input.InstanceId,
+		Output:     aws.String(base64.StdEncoding.EncodeToString([]byte(output))),
+	}, nil
+}
+
+func newBootDiagnosticsAdapter() *awsAdapter {
+	timestamp := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	return &awsAdapter{
+		cloudformationClient: &bootDiagnosticsCloudFormationStub{
+			stacks: []*cloudformation.Stack{{
+				StackName: aws.String("nodepool-worker-kube-1"),
+				Tags: []*cloudformation.Tag{
+					{Key: aws.String(tagNameKubernetesClusterPrefix + "kube-1"), Value: aws.String(resourceLifecycleOwned)},
+					{Key: aws.String(nodePoolTagKey), Value: aws.String("worker")},
+				},
+			}},
+			resources: []*cloudformation.StackResource{
+				{ResourceType: aws.String("AWS::EC2::LaunchTemplate"), PhysicalResourceId: aws.String("lt-123")},
+				{ResourceType: aws.String(autoscalingGroupResourceType), PhysicalResourceId: aws.String("worker-asg")},
+			},
+			events: []*cloudformation.StackEvent{
+				{Timestamp: aws.Time(timestamp), LogicalResourceId: aws.String("AutoScalingGroup"), ResourceStatus: aws.String(cloudformation.ResourceStatusUpdateFailed), ResourceStatusReason: aws.String("Received 0 SUCCESS signal(s)")},
+				{Timestamp: aws.Time(timestamp), LogicalResourceId: aws.String("LaunchTemplate"), ResourceStatus: aws.String(cloudformation.ResourceStatusUpdateComplete)},
+			},
+		},
+		autoscalingClient: &bootDiagnosticsAutoscalingStub{
+			instances: []*autoscaling.Instance{
+				{InstanceId: aws.String("i-ready"), AvailabilityZone: aws.String("eu-central-1a"), LifecycleState: aws.String(autoscaling.LifecycleStateInService), HealthStatus: aws.String("Healthy")},
+				{InstanceId: aws.String("i-broken"), AvailabilityZone: aws.String("eu-central-1b"), LifecycleState: aws.String(autoscaling.LifecycleStateInService), HealthStatus: aws.String("Healthy")},
+				{InstanceId: aws.String("i-new"), AvailabilityZone: aws.String("eu-central-1c"), LifecycleState: aws.String(autoscaling.LifecycleStatePending), HealthStatus: aws.String("Healthy")},
+			},
+			activities: []*autoscaling.Activity{
+				{StartTime: aws.Time(timestamp), StatusCode: aws.String(autoscaling.ScalingActivityStatusCodeSuccessful), Description: aws.String("Launching a new EC2 instance: i-broken")},
+			},
+		},
+		ec2Client: &ec2ConsoleOutputAPIStub{output: map[string]string{
+			"i-broken": "line 1\nline 2\nkubelet: failed to connect to the API server\n",
+		}},
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	require.Equal(t, "b\nc", lastLines("a\nb\nc\n", 2))
+	require.Equal(t, "a\nb\nc", lastLines("a\nb\nc\n", 0))
+	require.Equal(t, "a\nb\nc", lastLines("a\nb\nc", 5))
+}
+
+func TestCollectBootDiagnostics(t *testing.T) {
+	adapter := newBootDiagnosticsAdapter()
+
+	diagnostics, err := adapter.collectBootDiagnostics(&api.Cluster{ID: "kube-1"}, &api.NodePool{Name: "worker"}, []string{"aws:///eu-central-1a/i-ready"})
+	require.NoError(t, err)
+	require.Equal(t, []*instanceDiagnostics{
+		{instanceID: "i-broken", state: "InService, Healthy", consoleOutput: "line 1\nline 2\nkubelet: failed to connect to the API server\n"},
+		{instanceID: "i-new", state: "Pending, Healthy", consoleOutput: "<no console output yet>"},
+	}, diagnostics.instances)
+	require.Equal(t, []string{"2020-01-02T10:00:00Z worker-asg: Successful: Launching a new EC2 instance: i-broken"}, diagnostics.activities)
+	require.Equal(t, []string{"2020-01-02T10:00:00Z nodepool-worker-kube-1 AutoScalingGroup: UPDATE_FAILED: Received 0 SUCCESS signal(s)"}, diagnostics.stackEvents)
+
+	report := diagnostics.report(1)
+	require.Contains(t, report, "instance i-broken (InService, Healthy), console output:\nkubelet: failed to connect to the API server\n")
+	require.NotContains(t, report, "line 2")
+
+	// node pools of other clusters aren't inspected
+	diagnostics, err = adapter.collectBootDiagnostics(&api.Cluster{ID: "kube-2"}, &api.NodePool{Name: "worker"}, nil)
+	require.NoError(t, err)
+	require.Empty(t, diagnostics.instances)
+}
+
+func TestWithBootDiagnostics(t *testing.T) {
+	adapter := newBootDiagnosticsAdapter()
+	logger := log.WithField("cluster", "kube-1")
+	cluster := &api.Cluster{ID: "kube-1"}
+	nodePool := &api.NodePool{Name: "worker"}
+
+	// other errors are returned unchanged
+	err := errors.New("failed")
+	require.Equal(t, err, withBootDiagnostics(logger, adapter, cluster, nodePool, err))
+
+	notReady := &updatestrategy.NodesNotReadyError{
+		NodePool:   "worker",
+		Ready:      1,
+		Desired:    3,
+		ReadyNodes: []string{"aws:///eu-central-1a/i-ready"},
+		Err:        fmt.Errorf("context deadline exceeded"),
+	}
+	err = withBootDiagnostics(logger, adapter, cluster, nodePool, notReady)
+	require.True(t, strings.HasPrefix(err.Error(), notReady.Error()))
+	require.Contains(t, err.Error(), "boot diagnostics of node pool worker:")
+	require.Contains(t, err.Error(), "instance i-new (Pending, Healthy)")
+}
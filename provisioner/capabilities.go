@@ -0,0 +1,217 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+var errCapabilitiesNotAvailable = errors.New("cluster capabilities are not available in this context")
+
+// capabilitiesDiscoverer is the part of the discovery client used to discover
+// the capabilities of the API server.
+type capabilitiesDiscoverer interface {
+	resourceDiscoverer
+	ServerVersion() (*version.Info, error)
+}
+
+// clusterCapabilities exposes the APIs served by the cluster's API server to
+// the templates, so that manifests can be rendered only if the APIs they
+// depend on exist. The APIs are discovered on first use and cached for the
+// lifetime of the clusterCapabilities, which is a single provisioning run.
+type clusterCapabilities struct {
+	logger     *log.Entry
+	discovery  capabilitiesDiscoverer
+	mutex      sync.Mutex
+	discovered bool
+	err        error
+	version    string
+	// resources are the API resources by group version, e.g. apps/v1.
+	resources map[string][]metav1.APIResource
+}
+
+// newClusterCapabilities initializes a new clusterCapabilities for the API
+// server described by config.
+func newClusterCapabilities(logger *log.Entry, config *rest.Config) (*clusterCapabilities, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clusterCapabilities{logger: logger, discovery: discoveryClient}, nil
+}
+
+// discover discovers the version and the APIs of the API server once.
+func (c *clusterCapabilities) discover() error {
+	if c == nil {
+		return errCapabilitiesNotAvailable
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.discovered {
+		c.discovered = true
+		c.err = c.discoverAPIs()
+	}
+	return c.err
+}
+
+// discoverAPIs discovers the API resources of all the versions of all the API
+// groups. Like with kubectl, group versions whose resources can't be
+// discovered, e.g. because the aggregated API server serving them is
+// unavailable, are logged and skipped.
+func (c *clusterCapabilities) discoverAPIs() error {
+	info, err := c.discovery.ServerVersion()
+	if err != nil {
+		return fmt.Errorf("failed to discover the API server version: %v", err)
+	}
+	c.version = info.GitVersion
+
+	groups, err := c.discovery.ServerGroups()
+	if err != nil {
+		return fmt.Errorf("failed to discover API groups: %v", err)
+	}
+
+	c.resources = make(map[string][]metav1.APIResource)
+	failed := make(map[string]error)
+	for _, group := range groups.Groups {
+		for _, groupVersion := range group.Versions {
+			resources, err := c.discovery.ServerResourcesForGroupVersion(groupVersion.GroupVersion)
+			if err != nil {
+				failed[groupVersion.GroupVersion] = err
+				continue
+			}
+			c.resources[groupVersion.GroupVersion] = resources.APIResources
+		}
+	}
+
+	if len(failed) > 0 {
+		c.logger.Warnf("Skipping API group versions which couldn't be discovered: %s", discoveryFailures(failed))
+	}
+
+	return nil
+}
+
+// discoveryFailures formats the discovery errors by group version, sorted by
+// group version.
+func discoveryFailures(failed map[string]error) string {
+	groupVersions := make([]string, 0, len(failed))
+	for groupVersion := range failed {
+		groupVersions = append(groupVersions, groupVersion)
+	}
+	sort.Strings(groupVersions)
+
+	failures := make([]string, 0, len(groupVersions))
+	for _, groupVersion := range groupVersions {
+		failures = append(failures, fmt.Sprintf("%s: %v", groupVersion, failed[groupVersion]))
+	}
+	return strings.Join(failures, ", ")
+}
+
+// hasAPIVersion is a template function which returns true if the API server
+// serves the group version, e.g. policy/v1beta1.
+func (c *clusterCapabilities) hasAPIVersion(apiVersion string) (bool, error) {
+	err := c.discover()
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := c.resources[apiVersion]
+	return ok, nil
+}
+
+// hasKind is a template function which returns true if the API server serves
+// the kind, e.g. PodSecurityPolicy. The kind is looked up in all group
+// versions unless a group version is specified as second argument.
+func (c *clusterCapabilities) hasKind(kind string, apiVersion ...string) (bool, error) {
+	if len(apiVersion) > 1 {
+		return false, fmt.Errorf("hasKind expects at most one API version, got %d", len(apiVersion))
+	}
+
+	err := c.discover()
+	if err != nil {
+		return false, err
+	}
+
+	for groupVersion, resources := range c.resources {
+		if len(apiVersion) == 1 && groupVersion != apiVersion[0] {
+			continue
+		}
+
+		for _, resource := range resources {
+			if matchesKind(resource, kind) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// hasCRD is a template function which returns true if the API server serves
+// the custom resource definition, identified by its name, e.g.
+// stacksets.zalando.org.
+func (c *clusterCapabilities) hasCRD(name string) (bool, error) {
+	err := c.discover()
+	if err != nil {
+		return false, err
+	}
+
+	for groupVersion, resources := range c.resources {
+		// the core group doesn't serve custom resources
+		if !strings.Contains(groupVersion, "/") {
+			continue
+		}
+
+		group := strings.SplitN(groupVersion, "/", 2)[0]
+		for _, resource := range resources {
+			if resource.Name+"."+group == name {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// serverVersion is a template function which returns the version of the API
+// server, e.g. v1.14.8.
+func (c *clusterCapabilities) serverVersion() (string, error) {
+	err := c.discover()
+	if err != nil {
+		return "", err
+	}
+
+	return c.version, nil
+}
+
+// serverVersionAtLeast is a template function which returns true if the major
+// and minor version of the API server is at least the version, e.g. 1.14.
+func (c *clusterCapabilities) serverVersionAtLeast(minVersion string) (bool, error) {
+	min, err := parseKubeVersion(minVersion)
+	if err != nil {
+		return false, err
+	}
+
+	serverVersion, err := c.serverVersion()
+	if err != nil {
+		return false, err
+	}
+
+	current, err := parseKubeVersion(serverVersion)
+	if err != nil {
+		return false, err
+	}
+
+	if current.major != min.major {
+		return current.major > min.major, nil
+	}
+	return current.minor >= min.minor, nil
+}
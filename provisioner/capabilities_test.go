@@ -0,0 +1,125 @@
+package provisioner
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+type capabilitiesDiscovererStub struct {
+	calls int
+	fail  bool
+	// failing is a group version whose resources can't be discovered.
+	failing string
+}
+
+func (d *capabilitiesDiscovererStub) ServerVersion() (*version.Info, error) {
+	d.calls++
+	if d.fail {
+		return nil, errors.New("connection refused")
+	}
+	return &version.Info{GitVersion: "v1.14.8"}, nil
+}
+
+func (d *capabilitiesDiscovererStub) ServerGroups() (*metav1.APIGroupList, error) {
+	return &metav1.APIGroupList{
+		Groups: []metav1.APIGroup{
+			{Name: "", Versions: []metav1.GroupVersionForDiscovery{{GroupVersion: "v1"}}},
+			{Name: "policy", Versions: []metav1.GroupVersionForDiscovery{{GroupVersion: "policy/v1beta1"}}},
+			{Name: "zalando.org", Versions: []metav1.GroupVersionForDiscovery{{GroupVersion: "zalando.org/v1"}}},
+			{Name: "metrics.k8s.io", Versions: []metav1.GroupVersionForDiscovery{{GroupVersion: "metrics.k8s.io/v1beta1"}}},
+		},
+	}, nil
+}
+
+func (d *capabilitiesDiscovererStub) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	if groupVersion == d.failing {
+		return nil, errors.New("the server is currently unable to handle the request")
+	}
+
+	resources := map[string][]metav1.APIResource{
+		"v1":                     {{Name: "pods", Kind: "Pod", Namespaced: true}},
+		"policy/v1beta1":         {{Name: "podsecuritypolicies", Kind: "PodSecurityPolicy"}},
+		"zalando.org/v1":         {{Name: "stacksets", Kind: "StackSet", Namespaced: true}},
+		"metrics.k8s.io/v1beta1": {{Name: "pods", Kind: "PodMetrics", Namespaced: true}},
+	}
+	return &metav1.APIResourceList{GroupVersion: groupVersion, APIResources: resources[groupVersion]}, nil
+}
+
+func renderWithCapabilities(t *testing.T, template string, capabilities *clusterCapabilities) (string, error) {
+	basedir, err := ioutil.TempDir("", "capabilities")
+	require.NoError(t, err)
+	defer os.RemoveAll(basedir)
+
+	file := path.Join(basedir, "foo.yaml")
+	err = ioutil.WriteFile(file, []byte(template), 0644)
+	require.NoError(t, err)
+
+	context := newTemplateContext(basedir)
+	context.capabilities = capabilities
+	return renderTemplate(context, file, nil)
+}
+
+func TestClusterCapabilities(t *testing.T) {
+	stub := &capabilitiesDiscovererStub{}
+	capabilities := &clusterCapabilities{discovery: stub}
+
+	for _, tc := range []struct {
+		template string
+		expected string
+	}{
+		{template: `{{ hasAPIVersion "policy/v1beta1" }}`, expected: "true"},
+		{template: `{{ hasAPIVersion "policy/v1" }}`, expected: "false"},
+		{template: `{{ hasKind "PodSecurityPolicy" }}`, expected: "true"},
+		{template: `{{ hasKind "PodSecurityPolicy" "policy/v1beta1" }}`, expected: "true"},
+		{template: `{{ hasKind "PodSecurityPolicy" "v1" }}`, expected: "false"},
+		{template: `{{ hasKind "CronJob" }}`, expected: "false"},
+		{template: `{{ hasCRD "stacksets.zalando.org" }}`, expected: "true"},
+		{template: `{{ hasCRD "pods.v1" }}`, expected: "false"},
+		{template: `{{ serverVersion }}`, expected: "v1.14.8"},
+		{template: `{{ serverVersionAtLeast "1.14" }}`, expected: "true"},
+		{template: `{{ serverVersionAtLeast "1.15" }}`, expected: "false"},
+		{template: `{{ serverVersionAtLeast "2.0" }}`, expected: "false"},
+		{template: `{{ if hasKind "PodSecurityPolicy" }}psp{{ else }}pod-security{{ end }}`, expected: "psp"},
+	} {
+		t.Run(tc.template, func(t *testing.T) {
+			result, err := renderWithCapabilities(t, tc.template, capabilities)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, result)
+		})
+	}
+
+	// the APIs are only discovered once
+	require.Equal(t, 1, stub.calls)
+
+	_, err := renderWithCapabilities(t, `{{ hasKind "Pod" "v1" "v2" }}`, capabilities)
+	require.Error(t, err)
+}
+
+func TestClusterCapabilitiesFailingGroupVersion(t *testing.T) {
+	capabilities := &clusterCapabilities{
+		logger:    log.WithField("test", "capabilities"),
+		discovery: &capabilitiesDiscovererStub{failing: "metrics.k8s.io/v1beta1"},
+	}
+
+	// group versions which can't be discovered are skipped
+	result, err := renderWithCapabilities(t, `{{ hasKind "PodSecurityPolicy" }} {{ hasAPIVersion "metrics.k8s.io/v1beta1" }}`, capabilities)
+	require.NoError(t, err)
+	require.Equal(t, "true false", result)
+}
+
+func TestClusterCapabilitiesNotAvailable(t *testing.T) {
+	_, err := renderWithCapabilities(t, `{{ hasKind "PodSecurityPolicy" }}`, nil)
+	require.Error(t, err)
+
+	capabilities := &clusterCapabilities{discovery: &capabilitiesDiscovererStub{fail: true}}
+	_, err = capabilities.hasAPIVersion("v1")
+	require.Error(t, err)
+}
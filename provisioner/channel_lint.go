@@ -0,0 +1,400 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	clusterStackDefinitionFile = "cluster/senza-definition.yaml"
+	nodePoolProfilesDir        = "cluster/node-pools"
+)
+
+// ChannelLintIssue is a problem found in a file of a channel.
+type ChannelLintIssue struct {
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+func (i *ChannelLintIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.File, i.Message)
+}
+
+// channelLintError is returned if the channel of a cluster has lint issues.
+type channelLintError []*ChannelLintIssue
+
+func (e channelLintError) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, issue := range e {
+		lines = append(lines, issue.String())
+	}
+	return fmt.Sprintf("invalid channel configuration, %d issues found:\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+// LintChannel validates the structure of the channel: the required files
+// exist, files which aren't templates are valid YAML or JSON, the templates
+// parse and only reference known fields of the data they're rendered with,
+// and no Kubernetes resource is defined by more than one manifest. The
+// components disabled for the cluster are skipped unless cluster is nil. An
+// error is only returned if the channel can't be read.
+func LintChannel(channelConfig *channel.Config, cluster *api.Cluster) ([]*ChannelLintIssue, error) {
+	_, err := os.Stat(channelConfig.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	linter := &channelLinter{channelPath: channelConfig.Path, resources: make(map[string]string)}
+
+	if linter.requireFile(defaultsFile) {
+		linter.lintTemplate(defaultsFile, &api.Cluster{})
+	}
+	if linter.requireFile(clusterStackDefinitionFile) {
+		linter.lintYAML(clusterStackDefinitionFile)
+	}
+
+	for file, data := range map[string]interface{}{
+		channelValuesFile:      &api.Cluster{},
+		waitConditionsFile:     &api.Cluster{},
+		regionalStackFile:      &regionalStackParams{},
+		securityGroupRulesFile: &api.Cluster{},
+	} {
+		if linter.exists(file) {
+			linter.lintTemplate(file, data)
+		}
+	}
+	if linter.exists(etcdStackDefinitionFile) {
+		linter.lintYAML(etcdStackDefinitionFile)
+	}
+
+	linter.lintManifests(cluster)
+	linter.lintNodePoolProfiles()
+
+	sort.SliceStable(linter.issues, func(i, j int) bool {
+		return linter.issues[i].File < linter.issues[j].File
+	})
+	return linter.issues, nil
+}
+
+// checkChannel fails if the channel of the cluster has lint issues.
+func checkChannel(channelConfig *channel.Config, cluster *api.Cluster) error {
+	issues, err := LintChannel(channelConfig, cluster)
+	if err != nil {
+		return err
+	}
+
+	if len(issues) > 0 {
+		return channelLintError(issues)
+	}
+	return nil
+}
+
+// channelLinter collects the issues of the files of a channel. The files are
+// relative to the channel path.
+type channelLinter struct {
+	channelPath string
+	issues      []*ChannelLintIssue
+	// resources maps the Kubernetes resources defined by the manifests
+	// to the file defining them.
+	resources map[string]string
+}
+
+func (l *channelLinter) report(file, format string, args ...interface{}) {
+	l.issues = append(l.issues, &ChannelLintIssue{File: file, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *channelLinter) exists(file string) bool {
+	_, err := os.Stat(path.Join(l.channelPath, file))
+	return err == nil
+}
+
+// requireFile reports the file if it doesn't exist.
+func (l *channelLinter) requireFile(file string) bool {
+	if !l.exists(file) {
+		l.report(file, "required file is missing")
+		return false
+	}
+	return true
+}
+
+// lintYAML checks that every document of a file which isn't a Go template is
+// valid YAML.
+func (l *channelLinter) lintYAML(file string) {
+	content, err := ioutil.ReadFile(path.Join(l.channelPath, file))
+	if err != nil {
+		l.report(file, "%v", err)
+		return
+	}
+	l.lintContent(file, string(content))
+}
+
+// lintContent checks that the content of a file is valid YAML or JSON,
+// depending on its extension. Other files aren't checked.
+func (l *channelLinter) lintContent(file, content string) {
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml":
+		for _, document := range yamlDocumentSeparator.Split(content, -1) {
+			var value interface{}
+			err := yaml.Unmarshal([]byte(document), &value)
+			if err != nil {
+				l.report(file, "invalid YAML: %v", err)
+				return
+			}
+		}
+	case ".json":
+		var value interface{}
+		err := json.Unmarshal([]byte(content), &value)
+		if err != nil {
+			l.report(file, "invalid JSON: %v", err)
+		}
+	}
+}
+
+// lintTemplate parses the template and checks the fields it references
+// against the data it's rendered with. Templates without any actions are
+// checked like plain files.
+func (l *channelLinter) lintTemplate(file string, data interface{}) string {
+	filePath := path.Join(l.channelPath, file)
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		l.report(file, "%v", err)
+		return ""
+	}
+
+	t, err := template.New(file).Funcs(templateFuncs(newTemplateContext(path.Dir(filePath)), filePath, data)).Parse(string(content))
+	if err != nil {
+		l.report(file, "invalid template: %v", err)
+		return ""
+	}
+
+	if t.Tree == nil {
+		return string(content)
+	}
+
+	fields := make(map[string]bool)
+	templateFields(t.Tree.Root, true, fields)
+	for _, field := range sortedKeys(fields) {
+		if !knownField(reflect.TypeOf(data), strings.Split(field, ".")[1:]) {
+			l.report(file, "unknown template variable %s", field)
+		}
+	}
+
+	if len(t.Templates()) == 1 && plainTemplate(t.Tree.Root) {
+		l.lintContent(file, string(content))
+	}
+	return string(content)
+}
+
+// lintManifests lints the manifests of all components and reports the
+// Kubernetes resources defined by more than one of them. Disabled
+// components are skipped.
+func (l *channelLinter) lintManifests(cluster *api.Cluster) {
+	components, err := ioutil.ReadDir(path.Join(l.channelPath, manifestsPath))
+	if err != nil {
+		l.report(manifestsPath, "%v", err)
+		return
+	}
+
+	for _, component := range components {
+		if !component.IsDir() || (cluster != nil && componentDisabled(cluster, component.Name())) {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(path.Join(l.channelPath, manifestsPath, component.Name()))
+		if err != nil {
+			l.report(path.Join(manifestsPath, component.Name()), "%v", err)
+			continue
+		}
+
+		for _, f := range files {
+			if f.IsDir() || f.Name() == deletionsFile {
+				continue
+			}
+
+			file := path.Join(manifestsPath, component.Name(), f.Name())
+			content := l.lintTemplate(file, &api.Cluster{})
+			l.checkDuplicateResources(file, content)
+		}
+	}
+}
+
+// checkDuplicateResources reports the resources of the manifest already
+// defined by another one. Only documents whose kind and name aren't
+// templated are considered.
+func (l *channelLinter) checkDuplicateResources(file, content string) {
+	for _, resource := range manifestResources(content) {
+		if strings.Contains(resource, "{{") {
+			continue
+		}
+
+		other, ok := l.resources[resource]
+		if !ok {
+			l.resources[resource] = file
+			continue
+		}
+		if other != file {
+			l.report(file, "%s is already defined in %s", resource, other)
+		}
+	}
+}
+
+// lintNodePoolProfiles lints the stack, user data and IAM policies of every
+// node pool profile.
+func (l *channelLinter) lintNodePoolProfiles() {
+	profiles, err := ioutil.ReadDir(path.Join(l.channelPath, nodePoolProfilesDir))
+	if err != nil {
+		l.report(nodePoolProfilesDir, "%v", err)
+		return
+	}
+
+	for _, profile := range profiles {
+		if !profile.IsDir() {
+			continue
+		}
+		profileDir := path.Join(nodePoolProfilesDir, profile.Name())
+
+		stackFile := path.Join(profileDir, stackFileName)
+		if l.requireFile(stackFile) {
+			l.lintTemplate(stackFile, &stackParams{})
+		}
+
+		format, err := userDataFormat(path.Join(l.channelPath, profileDir))
+		if err != nil {
+			l.report(profileDir, "%v", err)
+		}
+
+		var userDataFiles []string
+		switch format {
+		case userDataFormatCLC:
+			userDataFiles = append(userDataFiles, path.Join(profileDir, userDataFileName))
+		case userDataFormatIgnition:
+			userDataFiles = append(userDataFiles, path.Join(profileDir, ignitionUserDataFileName))
+		case userDataFormatCloudInit:
+			userDataFiles = append(userDataFiles, l.listFiles(path.Join(profileDir, cloudInitUserDataDir))...)
+		}
+
+		if l.exists(path.Join(profileDir, iamPolicyFileName)) {
+			userDataFiles = append(userDataFiles, path.Join(profileDir, iamPolicyFileName))
+		}
+		userDataFiles = append(userDataFiles, l.listFiles(path.Join(profileDir, iamPoliciesDir))...)
+
+		for _, file := range userDataFiles {
+			l.lintTemplate(file, &userDataParams{})
+		}
+	}
+}
+
+// listFiles returns the files of the directory, or none if it doesn't exist.
+func (l *channelLinter) listFiles(dir string) []string {
+	files, err := ioutil.ReadDir(path.Join(l.channelPath, dir))
+	if err != nil {
+		return nil
+	}
+
+	var result []string
+	for _, file := range files {
+		if !file.IsDir() {
+			result = append(result, path.Join(dir, file.Name()))
+		}
+	}
+	return result
+}
+
+// plainTemplate returns true if the template doesn't contain any actions.
+func plainTemplate(root *parse.ListNode) bool {
+	for _, node := range root.Nodes {
+		if _, ok := node.(*parse.TextNode); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// templateFields collects the fields of the template data referenced by the
+// node, e.g. .Cluster.ID. Fields relative to the dot are only collected while
+// the dot is the template data, i.e. outside of range and with blocks, and
+// fields of $ everywhere.
+func templateFields(node parse.Node, topLevel bool, fields map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			templateFields(child, topLevel, fields)
+		}
+	case *parse.ActionNode:
+		templateFields(n.Pipe, topLevel, fields)
+	case *parse.IfNode:
+		templateFields(n.Pipe, topLevel, fields)
+		templateFields(n.List, topLevel, fields)
+		templateFields(n.ElseList, topLevel, fields)
+	case *parse.RangeNode:
+		templateFields(n.Pipe, topLevel, fields)
+		templateFields(n.List, false, fields)
+		templateFields(n.ElseList, topLevel, fields)
+	case *parse.WithNode:
+		templateFields(n.Pipe, topLevel, fields)
+		templateFields(n.List, false, fields)
+		templateFields(n.ElseList, topLevel, fields)
+	case *parse.TemplateNode:
+		templateFields(n.Pipe, topLevel, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			templateFields(cmd, topLevel, fields)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			templateFields(arg, topLevel, fields)
+		}
+	case *parse.FieldNode:
+		if topLevel {
+			fields["."+strings.Join(n.Ident, ".")] = true
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			fields["."+strings.Join(n.Ident[1:], ".")] = true
+		}
+	}
+}
+
+// knownField returns true if the chain of fields exists in the type. Fields
+// of maps and interfaces can't be checked and are always known, as are the
+// results of methods.
+func knownField(t reflect.Type, chain []string) bool {
+	for _, name := range chain {
+		if _, ok := t.MethodByName(name); ok {
+			return true
+		}
+
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if t.Kind() != reflect.Struct {
+			return t.Kind() == reflect.Map || t.Kind() == reflect.Interface
+		}
+
+		field, ok := t.FieldByName(name)
+		if !ok || field.PkgPath != "" {
+			return false
+		}
+		t = field.Type
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+// writeLintChannel writes a valid channel with the files overridden by
+// files, skipping the ones with empty content.
+func writeLintChannel(t *testing.T, dir string, files map[string]string) {
+	channelFiles := map[string]string{
+		defaultsFile:                                  "apiserver_count: \"{{ .Region }}\"\n",
+		clusterStackDefinitionFile:                    "SenzaInfo:\n  StackName: \"{{Arguments.StackName}}\"\n",
+		"cluster/manifests/a/deployment.yaml":         "kind: Deployment\nmetadata:\n  name: a\n  namespace: kube-system\n",
+		"cluster/manifests/b/service.yaml":            "kind: Service\nmetadata:\n  name: \"{{ .LocalID }}\"\n",
+		"cluster/node-pools/worker/stack.yaml":        "Resources:\n  InstanceType: \"{{ .NodePool.InstanceType }}\"\n",
+		"cluster/node-pools/worker/userdata.clc.yaml": "{{ range $key, $value := .NodePool.ConfigItems }}{{ $key }}{{ end }}{{ $.Values.foo }}\n",
+	}
+	for file, content := range files {
+		channelFiles[file] = content
+	}
+
+	for file, content := range channelFiles {
+		if content != "" {
+			writeTemplateTestFile(t, path.Join(dir, file), content)
+		}
+	}
+}
+
+func lintIssues(t *testing.T, files map[string]string, cluster *api.Cluster) []string {
+	dir, err := ioutil.TempDir("", "channel-lint")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeLintChannel(t, dir, files)
+
+	issues, err := LintChannel(&channel.Config{Path: dir}, cluster)
+	require.NoError(t, err)
+
+	result := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		result = append(result, issue.String())
+	}
+	return result
+}
+
+func TestLintChannel(t *testing.T) {
+	for _, tc := range []struct {
+		msg   string
+		files map[string]string
+		// issues are the expected prefixes of the issues
+		issues []string
+	}{
+		{
+			msg: "valid channel",
+		},
+		{
+			msg:    "missing required files",
+			files:  map[string]string{defaultsFile: "", clusterStackDefinitionFile: ""},
+			issues: []string{"cluster/config-defaults.yaml: required file is missing", "cluster/senza-definition.yaml: required file is missing"},
+		},
+		{
+			msg:    "invalid YAML",
+			files:  map[string]string{clusterStackDefinitionFile: "SenzaInfo: [\n", "cluster/manifests/a/deployment.yaml": "kind: Deployment\n---\nfoo: bar: baz\n"},
+			issues: []string{"cluster/manifests/a/deployment.yaml: invalid YAML: ", "cluster/senza-definition.yaml: invalid YAML: "},
+		},
+		{
+			msg:    "template parse error",
+			files:  map[string]string{channelValuesFile: "foo: {{ .ID }\n"},
+			issues: []string{"cluster/values.yaml: invalid template: "},
+		},
+		{
+			msg:   "unknown template variables",
+			files: map[string]string{"cluster/node-pools/worker/stack.yaml": "{{ .Cluster.Foo }}{{ .NodePool.ConfigItems.bar }}{{ with .Cluster }}{{ .Baz }}{{ $.Qux }}{{ end }}\n"},
+			issues: []string{
+				"cluster/node-pools/worker/stack.yaml: unknown template variable .Cluster.Foo",
+				"cluster/node-pools/worker/stack.yaml: unknown template variable .Qux",
+			},
+		},
+		{
+			msg:    "invalid node pool profile",
+			files:  map[string]string{"cluster/node-pools/worker/stack.yaml": "", "cluster/node-pools/worker/userdata.clc.yaml": "", "cluster/node-pools/worker/files/kubelet.conf": "{}\n"},
+			issues: []string{"cluster/node-pools/worker: node pool profile worker doesn't define user data", "cluster/node-pools/worker/stack.yaml: required file is missing"},
+		},
+		{
+			msg:    "duplicate resources",
+			files:  map[string]string{"cluster/manifests/b/deployment.yaml": "kind: Service\n---\nkind: Deployment\nmetadata:\n  name: a\n  namespace: kube-system\n"},
+			issues: []string{"cluster/manifests/b/deployment.yaml: kube-system/Deployment/a is already defined in cluster/manifests/a/deployment.yaml"},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			issues := lintIssues(t, tc.files, nil)
+			require.Len(t, issues, len(tc.issues), "%v", issues)
+			for i, issue := range tc.issues {
+				require.True(t, strings.HasPrefix(issues[i], issue), issues[i])
+			}
+		})
+	}
+}
+
+func TestLintChannelDisabledComponents(t *testing.T) {
+	files := map[string]string{"cluster/manifests/b/deployment.yaml": "kind: Deployment\nmetadata:\n  name: a\n  namespace: kube-system\n"}
+
+	issues := lintIssues(t, files, &api.Cluster{ConfigItems: map[string]string{configKeySkipComponentPrefix + "b": "true"}})
+	require.Equal(t, []string{}, issues)
+}
@@ -0,0 +1,123 @@
+package provisioner
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+)
+
+// cloneSkippedConfigItems are the config items referring to resources or
+// state of the source cluster, they aren't copied to clones.
+var cloneSkippedConfigItems = []string{
+	ConfigKeyDeletionProtectionOverride,
+	configKeyEtcdStackVersion,
+	configKeyEtcdEndpoint,
+	configKeyEtcdCA,
+	configKeyEtcdClientCert,
+	configKeyEtcdClientKey,
+	configKeyAPIServerExtraNames,
+}
+
+// CloneOptions describe the cluster created by CloneCluster. Empty fields
+// are taken from the source cluster.
+type CloneOptions struct {
+	LocalID               string
+	InfrastructureAccount string
+	Region                string
+	Alias                 string
+	// APIServerURL defaults to the API server URL of the source cluster
+	// with its local ID replaced by the one of the clone.
+	APIServerURL string
+	Channel      string
+	Environment  string
+}
+
+// CloneCluster returns a new cluster with the spec, config items and node
+// pools of the source cluster. The clone is in the requested lifecycle
+// status so it's provisioned from the channel of the source cluster once
+// it's created in the registry.
+func CloneCluster(source *api.Cluster, options *CloneOptions) (*api.Cluster, error) {
+	clone := &api.Cluster{
+		Alias:                 options.Alias,
+		APIServerURL:          options.APIServerURL,
+		Channel:               options.Channel,
+		CriticalityLevel:      source.CriticalityLevel,
+		Environment:           options.Environment,
+		InfrastructureAccount: options.InfrastructureAccount,
+		LifecycleStatus:       models.ClusterLifecycleStatusRequested,
+		LocalID:               options.LocalID,
+		Provider:              source.Provider,
+		Region:                options.Region,
+		Status:                &api.ClusterStatus{},
+		ConfigItems:           make(map[string]string, len(source.ConfigItems)),
+	}
+
+	if clone.LocalID == "" {
+		return nil, fmt.Errorf("the local ID of the clone of %s is required", source.ID)
+	}
+	if clone.Alias == "" {
+		clone.Alias = clone.LocalID
+	}
+	if clone.InfrastructureAccount == "" {
+		clone.InfrastructureAccount = source.InfrastructureAccount
+	}
+	if clone.Region == "" {
+		clone.Region = source.Region
+	}
+	if clone.Channel == "" {
+		clone.Channel = source.Channel
+	}
+	if clone.Environment == "" {
+		clone.Environment = source.Environment
+	}
+	clone.ID = fmt.Sprintf("%s:%s:%s", clone.InfrastructureAccount, clone.Region, clone.LocalID)
+
+	if clone.ID == source.ID {
+		return nil, fmt.Errorf("the clone of %s must differ in account, region or local ID", source.ID)
+	}
+
+	if clone.APIServerURL == "" {
+		apiServerURL, err := cloneAPIServerURL(source, clone.LocalID)
+		if err != nil {
+			return nil, err
+		}
+		clone.APIServerURL = apiServerURL
+	}
+
+	for key, value := range source.ConfigItems {
+		clone.ConfigItems[key] = value
+	}
+	for _, key := range cloneSkippedConfigItems {
+		delete(clone.ConfigItems, key)
+	}
+
+	for _, nodePool := range source.NodePools {
+		clonedPool := *nodePool
+		clonedPool.ConfigItems = make(map[string]string, len(nodePool.ConfigItems))
+		for key, value := range nodePool.ConfigItems {
+			clonedPool.ConfigItems[key] = value
+		}
+		clone.NodePools = append(clone.NodePools, &clonedPool)
+	}
+
+	return clone, nil
+}
+
+// cloneAPIServerURL derives the API server URL of a clone by replacing the
+// local ID of the source cluster in the host of its API server URL.
+func cloneAPIServerURL(source *api.Cluster, localID string) (string, error) {
+	u, err := url.Parse(source.APIServerURL)
+	if err != nil {
+		return "", err
+	}
+
+	if source.LocalID == "" || !strings.Contains(u.Host, source.LocalID) {
+		return "", fmt.Errorf("can't derive the API server URL of the clone from %s, it has to be specified", source.APIServerURL)
+	}
+
+	u.Host = strings.Replace(u.Host, source.LocalID, localID, 1)
+	return u.String(), nil
+}
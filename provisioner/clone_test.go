@@ -0,0 +1,81 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func cloneSource() *api.Cluster {
+	return &api.Cluster{
+		ID:                    "aws:123456789012:eu-central-1:kube-1",
+		Alias:                 "kube-1",
+		APIServerURL:          "https://kube-1.foo.example.org",
+		Channel:               "stable",
+		CriticalityLevel:      2,
+		Environment:           "production",
+		InfrastructureAccount: "aws:123456789012",
+		LifecycleStatus:       "ready",
+		LocalID:               "kube-1",
+		Provider:              providerID,
+		Region:                "eu-central-1",
+		Status:                &api.ClusterStatus{CurrentVersion: "abc#123"},
+		ConfigItems: map[string]string{
+			"foo":                               "bar",
+			configKeyEtcdStackVersion:           "restored",
+			ConfigKeyDeletionProtectionOverride: "aws:123456789012:eu-central-1:kube-1",
+		},
+		NodePools: []*api.NodePool{
+			{
+				Name:        "default-worker",
+				Profile:     "worker-default",
+				MinSize:     3,
+				MaxSize:     20,
+				ConfigItems: map[string]string{"taints": "foo=bar:NoSchedule"},
+			},
+		},
+	}
+}
+
+func TestCloneCluster(t *testing.T) {
+	source := cloneSource()
+
+	clone, err := CloneCluster(source, &CloneOptions{
+		LocalID: "kube-2",
+		Region:  "eu-west-1",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "aws:123456789012:eu-west-1:kube-2", clone.ID)
+	require.Equal(t, "kube-2", clone.Alias)
+	require.Equal(t, "https://kube-2.foo.example.org", clone.APIServerURL)
+	require.Equal(t, "stable", clone.Channel)
+	require.Equal(t, "production", clone.Environment)
+	require.Equal(t, "requested", clone.LifecycleStatus)
+	require.Equal(t, "", clone.Status.CurrentVersion)
+	require.Equal(t, map[string]string{"foo": "bar"}, clone.ConfigItems)
+	require.Equal(t, source.NodePools[0].Name, clone.NodePools[0].Name)
+
+	// the source cluster isn't changed
+	clone.NodePools[0].ConfigItems["taints"] = ""
+	require.Equal(t, "foo=bar:NoSchedule", source.NodePools[0].ConfigItems["taints"])
+	require.Len(t, source.ConfigItems, 3)
+}
+
+func TestCloneClusterInvalid(t *testing.T) {
+	source := cloneSource()
+
+	_, err := CloneCluster(source, &CloneOptions{})
+	require.Error(t, err)
+
+	_, err = CloneCluster(source, &CloneOptions{LocalID: "kube-1"})
+	require.Error(t, err)
+
+	source.APIServerURL = "https://api.example.org"
+	_, err = CloneCluster(source, &CloneOptions{LocalID: "kube-2"})
+	require.Error(t, err)
+
+	clone, err := CloneCluster(source, &CloneOptions{LocalID: "kube-2", APIServerURL: "https://api-2.example.org"})
+	require.NoError(t, err)
+	require.Equal(t, "https://api-2.example.org", clone.APIServerURL)
+}
@@ -0,0 +1,168 @@
+package provisioner
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"golang.org/x/oauth2"
+)
+
+const (
+	configKeyAPIServerAuth       = "api_server_auth"
+	configKeyAPIServerToken      = "api_server_token"
+	configKeyAPIServerExecPlugin = "api_server_exec_plugin"
+	configKeyAPIServerExecArgs   = "api_server_exec_args"
+	configKeyAPIServerClientCert = "api_server_client_cert"
+	configKeyAPIServerClientKey  = "api_server_client_key"
+
+	apiServerAuthToken       = "token"
+	apiServerAuthStaticToken = "static-token"
+	apiServerAuthExec        = "exec"
+	apiServerAuthClientCert  = "client-cert"
+
+	// execTokenDefaultValidity is how long tokens returned by exec
+	// commands without an expiry are reused.
+	execTokenDefaultValidity = 5 * time.Minute
+)
+
+// sensitiveAuthConfigItems are the config items carrying API server
+// credentials. Their values are always masked, independent of the config
+// schema of the channel.
+var sensitiveAuthConfigItems = []string{configKeyAPIServerToken, configKeyAPIServerClientKey}
+
+// apiServerAuth returns the method the CLM authenticates to the API server of
+// the cluster with, selected by the api_server_auth config item. By default
+// it's the token of the provisioner.
+func apiServerAuth(cluster *api.Cluster) (string, error) {
+	method, ok := cluster.ConfigItems[configKeyAPIServerAuth]
+	if !ok {
+		return apiServerAuthToken, nil
+	}
+
+	switch method {
+	case apiServerAuthToken, apiServerAuthStaticToken, apiServerAuthExec, apiServerAuthClientCert:
+		return method, nil
+	default:
+		return "", fmt.Errorf("invalid value for %s: %s", configKeyAPIServerAuth, method)
+	}
+}
+
+// clusterTokenSource returns the token source for authenticating to the API
+// server of the cluster:
+//
+// token: the token source of the provisioner.
+// static-token: the token of the api_server_token config item, which should
+// be encrypted.
+// exec: the token printed by the credential plugin selected by the
+// api_server_exec_plugin config item as an ExecCredential, e.g.
+// aws-iam-authenticator. Only the plugins allowed by the CLM can be selected,
+// clusters only pass the arguments of the api_server_exec_args config item.
+// client-cert: nil, the client certificate of the cluster transport is used
+// instead.
+func (p *clusterpyProvisioner) clusterTokenSource(cluster *api.Cluster) (oauth2.TokenSource, error) {
+	method, err := apiServerAuth(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case apiServerAuthStaticToken:
+		token, ok := cluster.ConfigItems[configKeyAPIServerToken]
+		if !ok || token == "" {
+			return nil, fmt.Errorf("%s must be set for %s authentication", configKeyAPIServerToken, method)
+		}
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), nil
+	case apiServerAuthExec:
+		plugin := cluster.ConfigItems[configKeyAPIServerExecPlugin]
+		if plugin == "" {
+			return nil, fmt.Errorf("%s must be set for %s authentication", configKeyAPIServerExecPlugin, method)
+		}
+		path, ok := p.credentialPlugins[plugin]
+		if !ok {
+			return nil, fmt.Errorf("invalid value for %s: %s, the credential plugin isn't allowed", configKeyAPIServerExecPlugin, plugin)
+		}
+		command := append([]string{path}, strings.Fields(cluster.ConfigItems[configKeyAPIServerExecArgs])...)
+		return oauth2.ReuseTokenSource(nil, &execTokenSource{command: command, now: time.Now}), nil
+	case apiServerAuthClientCert:
+		return nil, nil
+	default:
+		return p.tokenSource, nil
+	}
+}
+
+// clusterClientCertificate returns the client certificate for authenticating
+// to the API server of the cluster, if it uses client-cert authentication.
+// The certificate and the key are taken from the api_server_client_cert and
+// api_server_client_key config items, PEM encoded, usually referring to a
+// Secrets Manager secret.
+func clusterClientCertificate(cluster *api.Cluster) (*tls.Certificate, error) {
+	method, err := apiServerAuth(cluster)
+	if err != nil || method != apiServerAuthClientCert {
+		return nil, err
+	}
+
+	cert, key := cluster.ConfigItems[configKeyAPIServerClientCert], cluster.ConfigItems[configKeyAPIServerClientKey]
+	if cert == "" || key == "" {
+		return nil, fmt.Errorf("%s and %s must be set for %s authentication", configKeyAPIServerClientCert, configKeyAPIServerClientKey, method)
+	}
+
+	certificate, err := tls.X509KeyPair([]byte(cert), []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate for API server %s: %v", cluster.APIServerURL, err)
+	}
+	return &certificate, nil
+}
+
+// execCredential is the part of the ExecCredential printed by exec credential
+// plugins used by the CLM.
+type execCredential struct {
+	Status struct {
+		Token               string    `json:"token"`
+		ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+	} `json:"status"`
+}
+
+// execTokenSource returns the tokens printed by a credential plugin command.
+type execTokenSource struct {
+	command []string
+	now     func() time.Time
+}
+
+// Token runs the command and returns the token of its ExecCredential. Tokens
+// without an expiry are valid for execTokenDefaultValidity.
+func (s *execTokenSource) Token() (*oauth2.Token, error) {
+	cmd := exec.Command(s.command[0], s.command[1:]...)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("credential plugin %s failed: %v: %s", s.command[0], err, string(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("credential plugin %s failed: %v", s.command[0], err)
+	}
+
+	var credential execCredential
+	err = json.Unmarshal(output, &credential)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ExecCredential of credential plugin %s: %v", s.command[0], err)
+	}
+
+	if credential.Status.Token == "" {
+		return nil, fmt.Errorf("credential plugin %s returned no token", s.command[0])
+	}
+
+	expiry := credential.Status.ExpirationTimestamp
+	if expiry.IsZero() {
+		expiry = s.now().Add(execTokenDefaultValidity)
+	}
+
+	return &oauth2.Token{
+		AccessToken: credential.Status.Token,
+		TokenType:   "Bearer",
+		Expiry:      expiry,
+	}, nil
+}
@@ -0,0 +1,194 @@
+package provisioner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"golang.org/x/oauth2"
+)
+
+// testClientCertificate returns a PEM encoded self-signed certificate and
+// its key.
+func testClientCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "cluster-lifecycle-manager"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(cert), string(keyPEM)
+}
+
+func TestClusterTokenSource(t *testing.T) {
+	provisionerToken := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "provisioner"})
+	p := &clusterpyProvisioner{tokenSource: provisionerToken, credentialPlugins: map[string]string{"echo": "echo"}}
+
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		token       string
+		noToken     bool
+		success     bool
+	}{
+		{
+			msg:         "the provisioner token is used by default",
+			configItems: map[string]string{},
+			token:       "provisioner",
+			success:     true,
+		},
+		{
+			msg:         "static tokens are used as is",
+			configItems: map[string]string{configKeyAPIServerAuth: apiServerAuthStaticToken, configKeyAPIServerToken: "static"},
+			token:       "static",
+			success:     true,
+		},
+		{
+			msg:         "static tokens must be set",
+			configItems: map[string]string{configKeyAPIServerAuth: apiServerAuthStaticToken},
+			success:     false,
+		},
+		{
+			msg:         "exec tokens are printed by the plugin",
+			configItems: map[string]string{configKeyAPIServerAuth: apiServerAuthExec, configKeyAPIServerExecPlugin: "echo", configKeyAPIServerExecArgs: `{"status":{"token":"exec"}}`},
+			token:       "exec",
+			success:     true,
+		},
+		{
+			msg:         "exec plugins must be set",
+			configItems: map[string]string{configKeyAPIServerAuth: apiServerAuthExec},
+			success:     false,
+		},
+		{
+			msg:         "exec plugins must be allowed",
+			configItems: map[string]string{configKeyAPIServerAuth: apiServerAuthExec, configKeyAPIServerExecPlugin: "sh", configKeyAPIServerExecArgs: "-c id"},
+			success:     false,
+		},
+		{
+			msg:         "client certificates don't use tokens",
+			configItems: map[string]string{configKeyAPIServerAuth: apiServerAuthClientCert},
+			noToken:     true,
+			success:     true,
+		},
+		{
+			msg:         "unknown methods are rejected",
+			configItems: map[string]string{configKeyAPIServerAuth: "basic"},
+			success:     false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			tokenSource, err := p.clusterTokenSource(&api.Cluster{ConfigItems: tc.configItems})
+			if !tc.success {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if tc.noToken {
+				require.Nil(t, tokenSource)
+				return
+			}
+
+			token, err := tokenSource.Token()
+			require.NoError(t, err)
+			require.Equal(t, tc.token, token.AccessToken)
+		})
+	}
+}
+
+func TestExecTokenSource(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	source := &execTokenSource{
+		command: []string{"echo", `{"status":{"token":"exec","expirationTimestamp":"2020-01-01T01:00:00Z"}}`},
+		now:     func() time.Time { return now },
+	}
+	token, err := source.Token()
+	require.NoError(t, err)
+	require.Equal(t, "exec", token.AccessToken)
+	require.Equal(t, now.Add(time.Hour), token.Expiry.UTC())
+
+	// tokens without an expiry get the default validity
+	source.command = []string{"echo", `{"status":{"token":"exec"}}`}
+	token, err = source.Token()
+	require.NoError(t, err)
+	require.Equal(t, now.Add(execTokenDefaultValidity), token.Expiry)
+
+	for _, command := range [][]string{
+		{"false"},
+		{"echo", "not-json"},
+		{"echo", `{"status":{}}`},
+	} {
+		source.command = command
+		_, err = source.Token()
+		require.Error(t, err)
+	}
+}
+
+func TestClusterTransportClientCertificate(t *testing.T) {
+	cert, key := testClientCertificate(t)
+	p := &clusterpyProvisioner{}
+
+	cluster := &api.Cluster{
+		APIServerURL: "https://api.example.org",
+		ConfigItems: map[string]string{
+			configKeyAPIServerAuth:       apiServerAuthClientCert,
+			configKeyAPIServerClientCert: cert,
+			configKeyAPIServerClientKey:  key,
+		},
+	}
+
+	transport, err := p.clusterTransport(cluster)
+	require.NoError(t, err)
+	require.Len(t, transport.TLSClientConfig.Certificates, 1)
+
+	kubeconfigFile, cleanup, err := kubectlKubeconfig(cluster, nil)
+	require.NoError(t, err)
+	defer cleanup()
+
+	data, err := ioutil.ReadFile(kubeconfigFile)
+	require.NoError(t, err)
+
+	var config kubeconfig
+	require.NoError(t, yaml.Unmarshal(data, &config))
+	require.Empty(t, config.Users[0].User.Token)
+	require.Equal(t, []byte(cert), config.Users[0].User.ClientCertificateData)
+	require.Equal(t, []byte(key), config.Users[0].User.ClientKeyData)
+
+	// the key must match the certificate
+	otherCert, _ := testClientCertificate(t)
+	cluster.ConfigItems[configKeyAPIServerClientCert] = otherCert
+	_, err = p.clusterTransport(cluster)
+	require.Error(t, err)
+
+	delete(cluster.ConfigItems, configKeyAPIServerClientKey)
+	_, err = p.clusterTransport(cluster)
+	require.Error(t, err)
+
+	// other clusters don't present a certificate
+	transport, err = p.clusterTransport(&api.Cluster{ConfigItems: map[string]string{}})
+	require.NoError(t, err)
+	require.Empty(t, transport.TLSClientConfig.Certificates)
+}
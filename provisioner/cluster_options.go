@@ -0,0 +1,59 @@
+package provisioner
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	configKeyDryRun          = "dry_run"
+	configKeyApplyOnly       = "apply_only"
+	configKeyRemoveVolumes   = "remove_volumes"
+	configKeySnapshotVolumes = "snapshot_volumes"
+)
+
+// clusterOptions are the provisioner options effective for a single cluster.
+type clusterOptions struct {
+	dryRun          bool
+	applyOnly       bool
+	removeVolumes   bool
+	snapshotVolumes bool
+}
+
+// clusterOptions returns the provisioner options for the cluster. The
+// apply_only, remove_volumes and snapshot_volumes config items override the
+// global options in both directions. The dry_run config item can only enable
+// dry-run mode for a cluster, a globally enabled dry-run can't be disabled per
+// cluster.
+func (p *clusterpyProvisioner) clusterOptions(cluster *api.Cluster) (clusterOptions, error) {
+	options := clusterOptions{
+		dryRun:          p.dryRun,
+		applyOnly:       p.applyOnly,
+		removeVolumes:   p.removeVolumes,
+		snapshotVolumes: p.snapshotVolumes,
+	}
+
+	for key, option := range map[string]*bool{
+		configKeyDryRun:          &options.dryRun,
+		configKeyApplyOnly:       &options.applyOnly,
+		configKeyRemoveVolumes:   &options.removeVolumes,
+		configKeySnapshotVolumes: &options.snapshotVolumes,
+	} {
+		value, ok := cluster.ConfigItems[key]
+		if !ok {
+			continue
+		}
+
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return clusterOptions{}, fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		*option = enabled
+	}
+
+	options.dryRun = options.dryRun || p.dryRun
+
+	return options, nil
+}
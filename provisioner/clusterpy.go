@@ -2,6 +2,8 @@ package provisioner
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -9,6 +11,7 @@ import (
 	"os/exec"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -19,18 +22,25 @@ import (
 	"golang.org/x/oauth2"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/cenkalti/backoff"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
 
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
 	awsUtils "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/httpclient"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubectl"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/util/command"
 )
@@ -41,7 +51,6 @@ const (
 	deletionsFile                  = "deletions.yaml"
 	defaultsFile                   = "cluster/config-defaults.yaml"
 	defaultNamespace               = "default"
-	kubectlNotFound                = "(NotFound)"
 	tagNameKubernetesClusterPrefix = "kubernetes.io/cluster/"
 	subnetELBRoleTagName           = "kubernetes.io/role/elb"
 	resourceLifecycleShared        = "shared"
@@ -51,10 +60,30 @@ const (
 	maxApplyRetries                = 10
 	configKeyUpdateStrategy        = "update_strategy"
 	configKeyNodeMaxEvictTimeout   = "node_max_evict_timeout"
+	configKeyDeregistrationTimeout = "node_deregistration_timeout"
+	defaultDeregistrationTimeout   = 5 * time.Minute
 	updateStrategyRolling          = "rolling"
 	defaultMaxRetryTime            = 5 * time.Minute
+	configKeyClusterProfile        = "cluster_profile"
+	clusterProfileMinimal          = "minimal"
+	defaultRollingUpdateSurge      = 3
+	minimalRollingUpdateSurge      = 1
+	configKeyPendingPodsMaxScaleUp = "pending_pods_max_scale_up"
+	defaultAPIServerWaitTimeout    = 15 * time.Minute
+	minimalAPIServerWaitTimeout    = 30 * time.Minute
+	configKeySkipComponentPrefix   = "skip_component_"
+	configKeyAPIServerCA           = "api_server_ca"
+	configKeyApplyServiceAccount   = "apply_service_account"
+	configKeyApplyBatching         = "apply_batching"
+	updateProgressNamespace        = "kube-system"
+	priceCacheTTL                  = 24 * time.Hour
 )
 
+// apiServerPollInterval is the interval between probes when waiting for the
+// API server to become ready. It's defined as a variable so it can be changed
+// in tests.
+var apiServerPollInterval = 15 * time.Second
+
 type clusterpyProvisioner struct {
 	awsConfig      *aws.Config
 	assumedRole    string
@@ -63,6 +92,17 @@ type clusterpyProvisioner struct {
 	applyOnly      bool
 	updateStrategy config.UpdateStrategy
 	removeVolumes  bool
+	// snapshotVolumes snapshots the EBS volumes before they're removed.
+	snapshotVolumes         bool
+	volumeSnapshotRetention time.Duration
+	auditStore              audit.Store
+	httpConfig              *httpclient.Config
+	priceCache              *awsUtils.PriceCache
+	rateLimiter             *awsUtils.RateLimiter
+	kubectlManager          *kubectl.Manager
+	tracer                  *tracing.Tracer
+	valueOverrides          map[string]string
+	credentialPlugins       map[string]string
 }
 
 // NewClusterpyProvisioner returns a new ClusterPy provisioner by passing its location and and IAM role to use.
@@ -71,6 +111,7 @@ func NewClusterpyProvisioner(tokenSource oauth2.TokenSource, assumedRole string,
 		awsConfig:   awsConfig,
 		assumedRole: assumedRole,
 		tokenSource: tokenSource,
+		priceCache:  awsUtils.NewPriceCache(priceCacheTTL),
 	}
 
 	if options != nil {
@@ -78,6 +119,15 @@ func NewClusterpyProvisioner(tokenSource oauth2.TokenSource, assumedRole string,
 		provisioner.applyOnly = options.ApplyOnly
 		provisioner.updateStrategy = options.UpdateStrategy
 		provisioner.removeVolumes = options.RemoveVolumes
+		provisioner.snapshotVolumes = options.SnapshotVolumes
+		provisioner.volumeSnapshotRetention = options.VolumeSnapshotRetention
+		provisioner.auditStore = options.AuditStore
+		provisioner.httpConfig = options.HTTPConfig
+		provisioner.rateLimiter = options.RateLimiter
+		provisioner.kubectlManager = options.Kubectl
+		provisioner.tracer = options.Tracer
+		provisioner.valueOverrides = options.ValueOverrides
+		provisioner.credentialPlugins = options.CredentialPlugins
 	}
 
 	return provisioner
@@ -117,27 +167,138 @@ func (p *clusterpyProvisioner) updateDefaults(cluster *api.Cluster, channelConfi
 	return nil
 }
 
+// traceAttributes returns the attributes identifying the cluster and the
+// operation in traces.
+func traceAttributes(cluster *api.Cluster, operation string) map[string]string {
+	return map[string]string{
+		logging.FieldCluster:   cluster.ID,
+		logging.FieldProvider:  cluster.Provider,
+		logging.FieldOperation: operation,
+	}
+}
+
 // Provision provisions/updates a cluster on AWS. Provision is an idempotent
 // operation for the same input.
-func (p *clusterpyProvisioner) Provision(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error {
-	awsAdapter, updater, nodePoolManager, err := p.prepareProvision(logger, cluster, channelConfig)
+func (p *clusterpyProvisioner) Provision(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (err error) {
+	logger = logging.WithModule(logger, "provisioner")
+	ctx, span := p.tracer.Start(ctx, "provision", traceAttributes(cluster, auditOperationProvision))
+	defer func() { span.End(err) }()
+
+	// the step which is running is reported if the provision timeout
+	// expires
+	currentStep := "preflight"
+	stepLogger := func(step string) *log.Entry {
+		currentStep = step
+		return logger.WithField(logging.FieldStep, step)
+	}
+
+	timeout, err := provisionTimeout(cluster)
+	if err != nil {
+		return err
+	}
+	if timeout > 0 {
+		parent := ctx
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		defer func() {
+			if err != nil && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+				err = &ProvisionTimeoutError{Step: currentStep, Timeout: timeout, Err: err}
+			}
+		}()
+	}
+
+	auditLog := p.newAuditLog(cluster, auditOperationProvision)
+	awsAdapter, updater, nodePoolManager, err := p.prepareProvision(logger, cluster, channelConfig, auditLog)
+	if err != nil {
+		return err
+	}
+	defer p.storeAuditLog(logger, cluster, auditLog)
+	defer recordForceDeletedPods(cluster, nodePoolManager)
+
+	// validate the channel before rendering anything from it
+	err = checkChannel(channelConfig, cluster)
+	if err != nil {
+		return err
+	}
+
+	injector, err := newFailureInjector(cluster)
+	if err != nil {
+		return err
+	}
+
+	waitConditions, err := loadWaitConditions(cluster, channelConfig.Path)
+	if err != nil {
+		return err
+	}
+
+	securityGroups, err := loadSecurityGroupRules(cluster, channelConfig.Path)
+	if err != nil {
+		return err
+	}
+
+	// validate the version skew before changing anything.
+	err = p.checkVersionSkew(stepLogger("version-skew"), cluster)
 	if err != nil {
 		return err
 	}
 
-	// create etcd stack if needed.
-	etcdStackDefinitionPath := path.Join(channelConfig.Path, "cluster", "etcd-cluster.yaml")
+	err = p.checkEtcdCompatibility(ctx, stepLogger("etcd"), cluster, channelConfig)
+	if err != nil {
+		return err
+	}
 
-	err = awsAdapter.CreateOrUpdateEtcdStack(ctx, "etcd-cluster-etcd", etcdStackDefinitionPath, cluster)
+	err = checkIAMPermissions(stepLogger("iam-preflight"), awsAdapter, cluster)
 	if err != nil {
 		return err
 	}
 
+	minimal := isMinimalProfile(cluster)
+
+	// create etcd stack if needed. Clusters using the minimal profile
+	// run etcd on the single combined master/worker node and don't get a
+	// dedicated etcd stack.
+	if minimal {
+		logger.Infof("Minimal cluster profile, skipping etcd stack")
+	} else {
+		err = p.checkEtcdBackup(stepLogger("etcd"), awsAdapter, cluster)
+		if err != nil {
+			return err
+		}
+
+		etcdStackDefinitionPath := path.Join(channelConfig.Path, etcdStackDefinitionFile)
+
+		etcdParameters, err := p.etcdStackParameters(ctx, stepLogger("etcd"), awsAdapter, cluster, etcdStackDefinitionPath)
+		if err != nil {
+			return err
+		}
+
+		err = awsAdapter.CreateOrUpdateEtcdStack(ctx, etcdStackVersion(cluster), etcdStackDefinitionPath, cluster, etcdParameters...)
+		if err != nil {
+			return err
+		}
+
+		err = p.manageEtcd(ctx, stepLogger("etcd"), awsAdapter, cluster)
+		if err != nil {
+			return err
+		}
+
+		err = p.waitForConditions(ctx, stepLogger("etcd"), awsAdapter, cluster, waitConditions, stepEtcd)
+		if err != nil {
+			return err
+		}
+	}
+
 	if err = ctx.Err(); err != nil {
 		return err
 	}
 
-	err = p.tagSubnets(awsAdapter, cluster)
+	err = p.tagSubnets(logger, awsAdapter, cluster)
+	if err != nil {
+		return err
+	}
+
+	err = awsAdapter.ensureStaticEgress(ctx, stepLogger("static-egress"), cluster)
 	if err != nil {
 		return err
 	}
@@ -146,77 +307,104 @@ func (p *clusterpyProvisioner) Provision(ctx context.Context, logger *log.Entry,
 		return err
 	}
 
+	err = injector.inject(failurePointStackUpdate)
+	if err != nil {
+		return fmt.Errorf("failed to update cluster stack: %v", err)
+	}
+
 	stackDefinitionPath := path.Join(channelConfig.Path, "cluster", "senza-definition.yaml")
 
+	err = p.checkStackDrift(ctx, stepLogger("cluster-stack"), awsAdapter, cluster, cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
 	err = awsAdapter.CreateOrUpdateClusterStack(ctx, cluster.LocalID, stackDefinitionPath, cluster)
 	if err != nil {
 		return err
 	}
 
+	if apiServerDNSEnabled(cluster) {
+		err = awsAdapter.ensureAPIServerDNS(cluster)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.waitForConditions(ctx, stepLogger("cluster-stack"), awsAdapter, cluster, waitConditions, stepClusterStack)
+	if err != nil {
+		return err
+	}
+
 	if err = ctx.Err(); err != nil {
 		return err
 	}
 
-	cfgBaseDir := path.Join(channelConfig.Path, "cluster", "node-pools")
+	err = p.applyRegionalStacks(ctx, awsAdapter, cluster, channelConfig.Path)
+	if err != nil {
+		return err
+	}
 
 	// provision node pools
-	nodePoolProvisioner := &AWSNodePoolProvisioner{
-		awsAdapter:      awsAdapter,
-		nodePoolManager: nodePoolManager,
-		bucketName:      fmt.Sprintf(clmCFBucketPattern, strings.TrimPrefix(cluster.InfrastructureAccount, "aws:"), cluster.Region),
-		cfgBaseDir:      cfgBaseDir,
-		Cluster:         cluster,
-		logger:          logger,
+	hibernate, err := p.hibernate(logger, cluster)
+	if err != nil {
+		return err
 	}
+	poolCluster := nodePoolCluster(cluster, hibernate)
+	if hibernate {
+		logger.Infof("Cluster is hibernated, keeping only the control plane running")
+	}
+	nodePoolProvisioner := newNodePoolProvisioner(stepLogger("node-pools"), awsAdapter, nodePoolManager, poolCluster, channelConfig, p.httpConfig)
 
-	subnets, err := awsAdapter.GetSubnets()
+	values, err := p.clusterValues(awsAdapter, cluster, channelConfig.Path)
 	if err != nil {
 		return err
 	}
 
-	// if subnets are defined in the config items, filter the subnet list
-	if subnetIds, ok := cluster.ConfigItems[subnetsConfigItemKey]; ok {
-		subnets, err = filterSubnets(subnets, strings.Split(subnetIds, ","))
-		if err != nil {
-			return err
-		}
+	err = nodePoolProvisioner.Provision(ctx, values.Values)
+	if err != nil {
+		return err
 	}
 
-	// find the best subnet for each AZ
-	subnetsPerZone := selectSubnetIDs(subnets)
+	err = awsAdapter.reconcileSecurityGroups(stepLogger("security-groups"), cluster, securityGroups)
+	if err != nil {
+		return err
+	}
 
-	// build a subnet list for the virtual '*' AZ
-	for az, subnet := range subnetsPerZone {
-		if az == subnetAllAZName {
-			continue
-		}
-		if existing, ok := subnetsPerZone[subnetAllAZName]; ok {
-			subnetsPerZone[subnetAllAZName] = existing + "," + subnet
-		} else {
-			subnetsPerZone[subnetAllAZName] = subnet
-		}
+	p.updateCostEstimate(stepLogger("node-pools"), awsAdapter, poolCluster)
+
+	err = p.waitForConditions(ctx, stepLogger("node-pools"), awsAdapter, cluster, waitConditions, stepNodePools)
+	if err != nil {
+		return err
 	}
 
-	// TODO legacy, remove once we switch to Values in all clusters
-	if _, ok := cluster.ConfigItems[subnetsConfigItemKey]; !ok {
-		cluster.ConfigItems[subnetsConfigItemKey] = subnetsPerZone[subnetAllAZName]
+	// wait for API server to be ready. A single node cluster has to
+	// bootstrap etcd and the control plane on the same instance so we
+	// allow it more time before giving up.
+	apiServerWaitTimeout := defaultAPIServerWaitTimeout
+	if minimal {
+		apiServerWaitTimeout = minimalAPIServerWaitTimeout
 	}
 
-	values := map[string]interface{}{
-		// TODO(tech-debt): custom legacy value
-		"node_labels": fmt.Sprintf("lifecycle-status=%s", lifecycleStatusReady),
-		// TODO(tech-debt): custom legacy value
-		"apiserver_count": "1",
-		"subnets":         subnetsPerZone,
+	client, err := p.apiServerClient(cluster)
+	if err != nil {
+		return err
+	}
+
+	_, apiServerSpan := tracing.StartSpan(ctx, "api-server", nil)
+	apiServerVersion, err := waitForAPIServer(stepLogger("api-server"), client, cluster.APIServerURL, apiServerWaitTimeout, injector)
+	apiServerSpan.End(err)
+	if err != nil {
+		return err
 	}
+	logger = logger.WithField("apiserver_version", apiServerVersion.GitVersion)
 
-	err = nodePoolProvisioner.Provision(values)
+	err = p.waitForConditions(ctx, stepLogger("api-server"), awsAdapter, cluster, waitConditions, stepAPIServer)
 	if err != nil {
 		return err
 	}
 
-	// wait for API server to be ready
-	err = waitForAPIServer(logger, cluster.APIServerURL, 15*time.Minute)
+	awsAdapter.kubectl, err = p.kubectlBinary(logger, channelConfig, apiServerVersion.GitVersion)
 	if err != nil {
 		return err
 	}
@@ -225,24 +413,42 @@ func (p *clusterpyProvisioner) Provision(ctx context.Context, logger *log.Entry,
 		return err
 	}
 
-	if !p.applyOnly {
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return err
+	}
+
+	// drain nodes terminated outside of the CLM before updating any
+	// node pools.
+	if !awsAdapter.dryRun {
+		err = nodePoolProvisioner.HandleTerminations(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !options.applyOnly {
+		// replace nodes which are NotReady, unless the cluster is
+		// still being created.
+		if !awsAdapter.dryRun && cluster.LifecycleStatus == models.ClusterLifecycleStatusReady {
+			err = nodePoolProvisioner.RepairNodes(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
 		switch cluster.LifecycleStatus {
 		case models.ClusterLifecycleStatusRequested, models.ClusterUpdateLifecycleStatusCreating:
 			log.Warnf("New cluster (%s), skipping node pool update", cluster.LifecycleStatus)
 		default:
 			// update nodes
-			nodePools := cluster.NodePools
-
-			sort.Sort(api.NodePools(nodePools))
-			for _, nodePool := range nodePools {
-				err := updater.Update(ctx, nodePool)
-				if err != nil {
-					return err
-				}
-
-				if err = ctx.Err(); err != nil {
-					return err
-				}
+			nodePools := poolCluster.NodePools
+			if legacyNodePoolMigration(cluster) {
+				nodePools = getNonLegacyNodePools(poolCluster)
+			}
+			err = p.updateNodePools(ctx, stepLogger("node-pool-update"), awsAdapter, updater, nodePoolProvisioner, values.Values, cluster, nodePools)
+			if err != nil {
+				return err
 			}
 		}
 	}
@@ -253,11 +459,107 @@ func (p *clusterpyProvisioner) Provision(ctx context.Context, logger *log.Entry,
 		return err
 	}
 
+	updateNodePoolStatus(stepLogger("node-pools"), awsAdapter, nodePoolManager, cluster, time.Now())
+
 	if err = ctx.Err(); err != nil {
 		return err
 	}
 
-	return p.apply(logger, cluster, path.Join(channelConfig.Path, manifestsPath))
+	err = p.apply(ctx, stepLogger("manifests"), awsAdapter, cluster, path.Join(channelConfig.Path, manifestsPath))
+	if err != nil {
+		return err
+	}
+
+	err = p.waitForConditions(ctx, stepLogger("manifests"), awsAdapter, cluster, waitConditions, stepManifests)
+	if err != nil {
+		return err
+	}
+
+	return p.ensureAdminKubeconfig(stepLogger("kubeconfig"), awsAdapter, cluster)
+}
+
+// newNodePoolProvisioner initializes the provisioner of the node pools of the
+// cluster.
+func newNodePoolProvisioner(logger *log.Entry, adapter *awsAdapter, nodePoolManager updatestrategy.NodePoolManager, cluster *api.Cluster, channelConfig *channel.Config, httpConfig *httpclient.Config) *AWSNodePoolProvisioner {
+	return &AWSNodePoolProvisioner{
+		awsAdapter:      adapter,
+		nodePoolManager: nodePoolManager,
+		bucketName:      fmt.Sprintf(clmCFBucketPattern, strings.TrimPrefix(cluster.InfrastructureAccount, "aws:"), cluster.Region),
+		cfgBaseDir:      path.Join(channelConfig.Path, "cluster", "node-pools"),
+		Cluster:         cluster,
+		logger:          logger,
+		httpConfig:      httpConfig,
+		images:          newImageResolver(adapter, cluster),
+	}
+}
+
+// nodePoolValues returns the default values passed to the templates,
+// including the subnets selected for every availability zone and the
+// infrastructure facts of the cluster.
+func nodePoolValues(adapter *awsAdapter, cluster *api.Cluster) (map[string]interface{}, error) {
+	vpc, err := adapter.defaultVPC()
+	if err != nil {
+		return nil, err
+	}
+
+	subnets, err := adapter.vpcSubnets(vpc)
+	if err != nil {
+		return nil, err
+	}
+
+	infrastructure, err := adapter.vpcInfrastructureFacts(cluster, vpc, subnets)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := nodePoolValuesForSubnets(cluster, subnets)
+	if err != nil {
+		return nil, err
+	}
+	values[infrastructureValueKey] = infrastructure
+	return values, nil
+}
+
+// nodePoolValuesForSubnets returns the values passed to the node pool
+// templates for the subnets of the cluster's VPC.
+func nodePoolValuesForSubnets(cluster *api.Cluster, subnets []*ec2.Subnet) (map[string]interface{}, error) {
+	var err error
+
+	// if subnets are defined in the config items, filter the subnet list
+	if subnetIds, ok := cluster.ConfigItems[subnetsConfigItemKey]; ok {
+		subnets, err = filterSubnets(subnets, strings.Split(subnetIds, ","))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// find the best subnet for each AZ
+	subnetsPerZone := selectSubnetIDs(subnets)
+
+	// build a subnet list for the virtual '*' AZ
+	for az, subnet := range subnetsPerZone {
+		if az == subnetAllAZName {
+			continue
+		}
+		if existing, ok := subnetsPerZone[subnetAllAZName]; ok {
+			subnetsPerZone[subnetAllAZName] = existing + "," + subnet
+		} else {
+			subnetsPerZone[subnetAllAZName] = subnet
+		}
+	}
+
+	// TODO legacy, remove once we switch to Values in all clusters
+	if _, ok := cluster.ConfigItems[subnetsConfigItemKey]; !ok {
+		cluster.ConfigItems[subnetsConfigItemKey] = subnetsPerZone[subnetAllAZName]
+	}
+
+	return map[string]interface{}{
+		// TODO(tech-debt): custom legacy value
+		"node_labels":     fmt.Sprintf("lifecycle-status=%s", lifecycleStatusReady),
+		"apiserver_count": strconv.Itoa(apiServerCount(cluster)),
+		"subnets":         subnetsPerZone,
+		"minimal_profile": isMinimalProfile(cluster),
+	}, nil
 }
 
 func filterSubnets(allSubnets []*ec2.Subnet, subnetIds []string) ([]*ec2.Subnet, error) {
@@ -329,11 +631,44 @@ func selectSubnetIDs(subnets []*ec2.Subnet) map[string]string {
 }
 
 // Decommission decommissions a cluster provisioned in AWS.
-func (p *clusterpyProvisioner) Decommission(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error {
-	awsAdapter, _, _, err := p.prepareProvision(logger, cluster, channelConfig)
+func (p *clusterpyProvisioner) Decommission(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (err error) {
+	logger = logging.WithModule(logger, "provisioner")
+
+	// we don't support cancelling decommission operations yet
+	ctx, span := p.tracer.Start(context.Background(), "decommission", traceAttributes(cluster, auditOperationDecommission))
+	defer func() { span.End(err) }()
+
+	auditLog := p.newAuditLog(cluster, auditOperationDecommission)
+	awsAdapter, _, _, err := p.prepareProvision(logger, cluster, channelConfig, auditLog)
+	if err != nil {
+		return err
+	}
+
+	err = checkDecommission(cluster)
 	if err != nil {
 		return err
 	}
+	defer p.storeAuditLog(logger, cluster, auditLog)
+
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return err
+	}
+
+	if options.dryRun {
+		plan, err := p.planDecommission(logger, awsAdapter, cluster)
+		if err != nil {
+			return err
+		}
+
+		var summary strings.Builder
+		err = plan.Write(&summary)
+		if err != nil {
+			return err
+		}
+		logger.Infof("Dry-run: %s", strings.TrimSpace(summary.String()))
+		return nil
+	}
 
 	// scale down kube-system deployments
 	// This is done to ensure controllers stop running so they don't
@@ -347,9 +682,6 @@ func (p *clusterpyProvisioner) Decommission(logger *log.Entry, cluster *api.Clus
 		logger.Errorf("Unable to downscale the deployments, proceeding anyway: %s", err)
 	}
 
-	// we don't support cancelling decommission operations yet
-	ctx := context.Background()
-
 	// delete all cluster infrastructure stacks
 	// TODO: delete stacks in parallel
 	err = p.deleteClusterStacks(ctx, awsAdapter, cluster)
@@ -357,23 +689,45 @@ func (p *clusterpyProvisioner) Decommission(logger *log.Entry, cluster *api.Clus
 		return err
 	}
 
+	err = p.deleteRegionalStacks(ctx, awsAdapter, cluster)
+	if err != nil {
+		return err
+	}
+
+	if apiServerDNSEnabled(cluster) {
+		err = awsAdapter.deleteAPIServerDNS(cluster)
+		if err != nil {
+			return err
+		}
+	}
+
 	// delete the main cluster stack
 	err = awsAdapter.DeleteStack(ctx, cluster.LocalID)
 	if err != nil {
 		return err
 	}
 
-	err = p.untagSubnets(awsAdapter, cluster)
+	err = p.untagSubnets(logger, awsAdapter, cluster)
+	if err != nil {
+		return err
+	}
+
+	err = awsAdapter.deleteStaticEgress(ctx, logger, cluster)
+	if err != nil {
+		return err
+	}
+
+	err = deleteAdminKubeconfig(awsAdapter, cluster)
 	if err != nil {
 		return err
 	}
 
-	if p.removeVolumes {
+	if options.removeVolumes {
 		backoffCfg := backoff.NewExponentialBackOff()
 		backoffCfg.MaxElapsedTime = defaultMaxRetryTime
 		err = backoff.Retry(
 			func() error {
-				return p.removeEBSVolumes(awsAdapter, cluster)
+				return p.removeEBSVolumes(ctx, logger, awsAdapter, cluster, options)
 			},
 			backoffCfg)
 		if err != nil {
@@ -384,69 +738,203 @@ func (p *clusterpyProvisioner) Decommission(logger *log.Entry, cluster *api.Clus
 	return nil
 }
 
-func (p *clusterpyProvisioner) removeEBSVolumes(awsAdapter *awsAdapter, cluster *api.Cluster) error {
+// removeEBSVolumes deletes the available EBS volumes owned by the cluster,
+// snapshotting them first if enabled for the cluster. Volumes still attached
+// to terminated instances are detached first, the caller retries until all
+// volumes are deleted.
+func (p *clusterpyProvisioner) removeEBSVolumes(ctx context.Context, logger *log.Entry, awsAdapter *awsAdapter, cluster *api.Cluster, options clusterOptions) error {
 	clusterTag := fmt.Sprintf("kubernetes.io/cluster/%s", cluster.ID)
 	volumes, err := awsAdapter.GetVolumes(map[string]string{clusterTag: "owned"})
 	if err != nil {
 		return err
 	}
 
+	var pending error
 	for _, volume := range volumes {
 		switch aws.StringValue(volume.State) {
 		case ec2.VolumeStateDeleted, ec2.VolumeStateDeleting:
 			// skip
 		case ec2.VolumeStateAvailable:
+			if options.snapshotVolumes {
+				err := awsAdapter.snapshotVolume(ctx, logger, cluster, volume, p.volumeSnapshotRetention)
+				if err != nil {
+					return err
+				}
+			}
+
 			err := awsAdapter.DeleteVolume(aws.StringValue(volume.VolumeId))
 			if err != nil {
 				return fmt.Errorf("failed to delete EBS volume %s: %s", aws.StringValue(volume.VolumeId), err)
 			}
+		case ec2.VolumeStateInUse:
+			// volumes of instances terminated along with the
+			// stacks are detached and deleted by the next attempt
+			err := awsAdapter.DetachTerminatedVolume(logger, volume)
+			if err != nil {
+				pending = err
+				continue
+			}
+			pending = fmt.Errorf("EBS volume %s is being detached", aws.StringValue(volume.VolumeId))
 		default:
 			return fmt.Errorf("unable to delete EBS volume %s: volume in state %s", aws.StringValue(volume.VolumeId), aws.StringValue(volume.State))
 		}
 	}
 
-	return nil
+	return pending
 }
 
 // waitForAPIServer waits a cluster API server to be ready. It's considered
-// ready when it's reachable.
-func waitForAPIServer(logger *log.Entry, server string, maxTimeout time.Duration) error {
-	logger.Infof("Waiting for API Server to be reachable")
-	client := &http.Client{}
+// ready when the /healthz and /readyz endpoints report it healthy for the
+// authenticated client. The version of the API server is returned once it's
+// ready. The injector can be used to simulate the API server flapping.
+func waitForAPIServer(logger *log.Entry, client *http.Client, server string, maxTimeout time.Duration, injector *failureInjector) (*version.Info, error) {
+	logger.Infof("Waiting for API Server to be ready")
 	timeout := time.Now().UTC().Add(maxTimeout)
 
+	var lastErr error
 	for time.Now().UTC().Before(timeout) {
-		resp, err := client.Get(server)
-		if err == nil && resp.StatusCode < http.StatusInternalServerError {
-			return nil
+		lastErr = injector.inject(failurePointAPIServerFlap)
+		if lastErr == nil {
+			var serverVersion *version.Info
+			serverVersion, lastErr = probeAPIServer(client, server)
+			if lastErr == nil {
+				logger.Infof("API Server ready, version %s", serverVersion.GitVersion)
+				return serverVersion, nil
+			}
 		}
 
-		logger.Debugf("Waiting for API Server to be reachable")
+		if _, ok := lastErr.(*apiServerAuthError); ok {
+			logger.Warnf("API Server rejected the credentials: %v", lastErr)
+		} else {
+			logger.Debugf("API Server not ready: %v", lastErr)
+		}
 
-		time.Sleep(15 * time.Second)
+		time.Sleep(apiServerPollInterval)
 	}
 
-	return fmt.Errorf("'%s' was not ready after %s", server, maxTimeout.String())
+	return nil, fmt.Errorf("'%s' was not ready after %s: %v", server, maxTimeout.String(), lastErr)
 }
 
-// prepareProvision checks that a cluster can be handled by the provisioner and
-// prepares to provision a cluster by initializing the aws adapter.
-// TODO: this is doing a lot of things to glue everything together, this should
-// be refactored.
-func (p *clusterpyProvisioner) prepareProvision(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*awsAdapter, updatestrategy.UpdateStrategy, updatestrategy.NodePoolManager, error) {
-	if cluster.Provider != providerID {
-		return nil, nil, nil, ErrProviderNotSupported
+// apiServerAuthError is the error returned when the API server rejects the
+// credentials of the client.
+type apiServerAuthError struct {
+	endpoint   string
+	statusCode int
+}
+
+func (e *apiServerAuthError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.endpoint, e.statusCode, http.StatusText(e.statusCode))
+}
+
+// probeAPIServer checks the health and readiness of the API server and
+// returns its version. /readyz is not available in older versions of
+// Kubernetes, so the API server is considered ready if it's not found.
+func probeAPIServer(client *http.Client, server string) (*version.Info, error) {
+	server = strings.TrimSuffix(server, "/")
+	for _, endpoint := range []string{"/healthz", "/readyz"} {
+		resp, err := client.Get(server + endpoint)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			if endpoint != "/readyz" {
+				return nil, fmt.Errorf("%s: %s", endpoint, resp.Status)
+			}
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return nil, &apiServerAuthError{endpoint: endpoint, statusCode: resp.StatusCode}
+		default:
+			return nil, fmt.Errorf("%s: %s", endpoint, resp.Status)
+		}
 	}
 
-	logger.Infof("clusterpy: Prepare for provisioning cluster %s (%s)..", cluster.ID, cluster.LifecycleStatus)
+	resp, err := client.Get(server + "/version")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, &apiServerAuthError{endpoint: "/version", statusCode: resp.StatusCode}
+	default:
+		return nil, fmt.Errorf("/version: %s", resp.Status)
+	}
+
+	var serverVersion version.Info
+	err = json.NewDecoder(resp.Body).Decode(&serverVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode API server version: %v", err)
+	}
+
+	return &serverVersion, nil
+}
+
+// clusterTransport returns the HTTP transport used for talking to the API
+// server of the cluster. The CA of the API server can be configured with the
+// api_server_ca config item in case it's not signed by a trusted CA. The
+// transport presents the client certificate of clusters using client-cert
+// authentication.
+func (p *clusterpyProvisioner) clusterTransport(cluster *api.Cluster) (*http.Transport, error) {
+	var caData []byte
+	if ca, ok := cluster.ConfigItems[configKeyAPIServerCA]; ok {
+		caData = []byte(ca)
+	}
+
+	transport, err := p.httpConfig.Transport(caData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration for API server %s: %v", cluster.APIServerURL, err)
+	}
+
+	certificate, err := clusterClientCertificate(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if certificate != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*certificate}
+	}
+	return transport, nil
+}
+
+// apiServerClient returns an HTTP client authenticated with the token source
+// or the client certificate of the cluster for talking to its API server.
+func (p *clusterpyProvisioner) apiServerClient(cluster *api.Cluster) (*http.Client, error) {
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSource, err := p.clusterTokenSource(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokenSource == nil {
+		return &http.Client{Transport: transport}, nil
+	}
 
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: tokenSource,
+			Base:   transport,
+		},
+	}, nil
+}
+
+// awsSession returns an AWS session for the infrastructure account of the
+// cluster, assuming the configured role in the account if any.
+func (p *clusterpyProvisioner) awsSession(cluster *api.Cluster) (*session.Session, error) {
 	infrastructureAccount := strings.Split(cluster.InfrastructureAccount, ":")
 	if len(infrastructureAccount) != 2 {
-		return nil, nil, nil, fmt.Errorf("clusterpy: Unknown format for infrastructure account '%s", cluster.InfrastructureAccount)
+		return nil, fmt.Errorf("clusterpy: Unknown format for infrastructure account '%s", cluster.InfrastructureAccount)
 	}
 
 	if infrastructureAccount[0] != "aws" {
-		return nil, nil, nil, fmt.Errorf("clusterpy: Cannot work with cloud provider '%s", infrastructureAccount[0])
+		return nil, fmt.Errorf("clusterpy: Cannot work with cloud provider '%s", infrastructureAccount[0])
 	}
 
 	roleArn := p.assumedRole
@@ -455,20 +943,72 @@ func (p *clusterpyProvisioner) prepareProvision(logger *log.Entry, cluster *api.
 	}
 
 	sess, err := awsUtils.Session(p.awsConfig, roleArn)
+	if err != nil {
+		return nil, err
+	}
+
+	p.rateLimiter.Attach(sess, infrastructureAccount[1])
+	return sess, nil
+}
+
+// prepareProvision checks that a cluster can be handled by the provisioner and
+// prepares to provision a cluster by initializing the aws adapter.
+// TODO: this is doing a lot of things to glue everything together, this should
+// be refactored.
+func (p *clusterpyProvisioner) prepareProvision(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, auditLog *audit.Log) (*awsAdapter, updatestrategy.UpdateStrategy, updatestrategy.NodePoolManager, error) {
+	if cluster.Provider != providerID {
+		return nil, nil, nil, ErrProviderNotSupported
+	}
+
+	logger.Infof("clusterpy: Prepare for provisioning cluster %s (%s)..", cluster.ID, cluster.LifecycleStatus)
+
+	sess, err := p.awsSession(cluster)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	adapter, err := newAWSAdapter(logger, cluster.APIServerURL, cluster.Region, sess, p.tokenSource, p.dryRun)
+	tokenSource, err := p.clusterTokenSource(cluster)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
+	adapter, err := newAWSAdapter(logger, cluster.APIServerURL, cluster.Region, sess, tokenSource, p.dryRun)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	adapter.audit = auditLog
+
 	err = p.updateDefaults(cluster, channelConfig)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("unable to read configuration defaults: %v", err)
 	}
 
+	err = validateConfigSchema(logger, cluster, channelConfig)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	err = validateClusterProfile(cluster)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	adapter.stackOptions, err = newStackOptions(cluster)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	adapter.dryRun = options.dryRun
+
+	injector, err := newFailureInjector(cluster)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	// allow clusters to override their update strategy.
 	// use global update strategy if cluster doesn't define one.
 	updateStrategy, ok := cluster.ConfigItems[configKeyUpdateStrategy]
@@ -476,33 +1016,92 @@ func (p *clusterpyProvisioner) prepareProvision(logger *log.Entry, cluster *api.
 		updateStrategy = p.updateStrategy.Strategy
 	}
 
-	// allow clusters to override their max evict timeout
-	// use global max evict timeout if cluster doesn't define one.
-	maxEvictTimeout := p.updateStrategy.MaxEvictTimeout
-
-	maxEvictTimeoutStr, ok := cluster.ConfigItems[configKeyNodeMaxEvictTimeout]
-	if ok {
-		maxEvictTimeout, err = time.ParseDuration(maxEvictTimeoutStr)
-		if err != nil {
-			return nil, nil, nil, err
-		}
+	maxEvictTimeout, err := p.maxEvictTimeout(cluster)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	var updater updatestrategy.UpdateStrategy
 	var poolManager updatestrategy.NodePoolManager
 	switch updateStrategy {
 	case updateStrategyRolling:
-		client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, p.tokenSource)
+		transport, err := p.clusterTransport(cluster)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, tokenSource, transport)
 		if err != nil {
 			return nil, nil, nil, err
 		}
 
 		// setup updater
-		poolBackend := updatestrategy.NewASGNodePoolsBackend(cluster.ID, sess)
+		deregistrationTimeout := defaultDeregistrationTimeout
+		if value, ok := cluster.ConfigItems[configKeyDeregistrationTimeout]; ok {
+			deregistrationTimeout, err = time.ParseDuration(value)
+			if err != nil || deregistrationTimeout < 0 {
+				return nil, nil, nil, fmt.Errorf("invalid value for %s: %s", configKeyDeregistrationTimeout, value)
+			}
+		}
+
+		poolBackend := updatestrategy.NewASGNodePoolsBackend(cluster.ID, sess, deregistrationTimeout)
+
+		updateLogger := logging.WithModule(logger, "updatestrategy")
+		policy, err := drainPolicy(cluster)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		poolManager = updatestrategy.NewKubernetesNodePoolManager(updateLogger, cluster.ID, client, poolBackend, maxEvictTimeout, policy)
+
+		if injector != nil {
+			logger.Warnf("Failure injection enabled")
+			poolManager = &failureInjectingNodePoolManager{
+				NodePoolManager: poolManager,
+				injector:        injector,
+			}
+		}
+
+		// keep the API server quorum while replacing control plane
+		// nodes.
+		poolManager, err = newAPIServerQuorumNodePoolManager(updateLogger, poolManager, adapter, cluster)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if auditLog != nil {
+			poolManager = &auditingNodePoolManager{
+				NodePoolManager: poolManager,
+				auditLog:        auditLog,
+			}
+		}
 
-		poolManager = updatestrategy.NewKubernetesNodePoolManager(logger, client, poolBackend, maxEvictTimeout)
+		// persist the progress of updates so they're resumed after a
+		// restart.
+		progressStore := updatestrategy.NewConfigMapProgressStore(client, updateProgressNamespace)
+		poolManager = updatestrategy.NewProgressTrackingNodePoolManager(updateLogger, poolManager, progressStore)
+
+		// a minimal cluster only has a single node so there is no
+		// point in surging by more than one node.
+		surge := defaultRollingUpdateSurge
+		if isMinimalProfile(cluster) {
+			surge = minimalRollingUpdateSurge
+		}
+
+		maxPendingScaleUp := 0
+		if value, ok := cluster.ConfigItems[configKeyPendingPodsMaxScaleUp]; ok {
+			maxPendingScaleUp, err = strconv.Atoi(value)
+			if err != nil || maxPendingScaleUp < 0 {
+				return nil, nil, nil, fmt.Errorf("invalid value for %s: %s", configKeyPendingPodsMaxScaleUp, value)
+			}
+		}
 
-		updater = updatestrategy.NewRollingUpdateStrategy(logger, poolManager, 3)
+		updater = updatestrategy.NewRollingUpdateStrategy(updateLogger, poolManager, surge, maxPendingScaleUp)
+
+		updater, err = p.newControlPlaneUpdateStrategy(updateLogger, updater, poolManager, client, adapter, cluster)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 	default:
 		return nil, nil, nil, fmt.Errorf("unknown update strategy: %s", p.updateStrategy)
 	}
@@ -510,28 +1109,63 @@ func (p *clusterpyProvisioner) prepareProvision(logger *log.Entry, cluster *api.
 	return adapter, updater, poolManager, nil
 }
 
+// maxEvictTimeout returns the max evict timeout of the cluster. Clusters can
+// override the global max evict timeout.
+func (p *clusterpyProvisioner) maxEvictTimeout(cluster *api.Cluster) (time.Duration, error) {
+	if value, ok := cluster.ConfigItems[configKeyNodeMaxEvictTimeout]; ok {
+		return time.ParseDuration(value)
+	}
+	return p.updateStrategy.MaxEvictTimeout, nil
+}
+
+// isMinimalProfile returns true if the cluster is configured to use the
+// minimal-footprint cluster profile.
+func isMinimalProfile(cluster *api.Cluster) bool {
+	return cluster.ConfigItems[configKeyClusterProfile] == clusterProfileMinimal
+}
+
+// validateClusterProfile validates that the node pools of the cluster are
+// compatible with the configured cluster profile. The minimal profile requires
+// exactly one node pool of a single node which acts as both master and worker.
+func validateClusterProfile(cluster *api.Cluster) error {
+	profile, ok := cluster.ConfigItems[configKeyClusterProfile]
+	if !ok {
+		return nil
+	}
+
+	switch profile {
+	case clusterProfileMinimal:
+		if len(cluster.NodePools) != 1 {
+			return fmt.Errorf("cluster profile %s requires exactly one node pool, found %d", profile, len(cluster.NodePools))
+		}
+
+		nodePool := cluster.NodePools[0]
+		if !strings.HasPrefix(nodePool.Profile, "master") {
+			return fmt.Errorf("cluster profile %s requires a master node pool, found profile %s", profile, nodePool.Profile)
+		}
+
+		if nodePool.MinSize != 1 || nodePool.MaxSize != 1 {
+			return fmt.Errorf("cluster profile %s requires a node pool of size 1, found min %d max %d", profile, nodePool.MinSize, nodePool.MaxSize)
+		}
+	default:
+		return fmt.Errorf("unknown cluster profile: %s", profile)
+	}
+
+	return nil
+}
+
 // tagSubnets tags all subnets in the default VPC with the kubernetes cluster
-// id tag.
-func (p *clusterpyProvisioner) tagSubnets(awsAdapter *awsAdapter, cluster *api.Cluster) error {
+// id tag, keeping the tags of the other clusters sharing them.
+func (p *clusterpyProvisioner) tagSubnets(logger *log.Entry, awsAdapter *awsAdapter, cluster *api.Cluster) error {
 	subnets, err := awsAdapter.GetSubnets()
 	if err != nil {
 		return err
 	}
 
-	tag := &ec2.Tag{
-		Key:   aws.String(tagNameKubernetesClusterPrefix + cluster.ID),
-		Value: aws.String(resourceLifecycleShared),
-	}
-
 	for _, subnet := range subnets {
-		if !hasTag(subnet.Tags, tag) {
-			err = awsAdapter.CreateTags(
-				aws.StringValue(subnet.SubnetId),
-				[]*ec2.Tag{tag},
-			)
-			if err != nil {
-				return err
-			}
+		err = reconcileSubnetTag(logger, awsAdapter, subnet, cluster)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -539,27 +1173,17 @@ func (p *clusterpyProvisioner) tagSubnets(awsAdapter *awsAdapter, cluster *api.C
 }
 
 // untagSubnets removes the kubernetes cluster id tag from all subnets in the
-// default vpc.
-func (p *clusterpyProvisioner) untagSubnets(awsAdapter *awsAdapter, cluster *api.Cluster) error {
+// default vpc. The tags of other clusters sharing the subnets are kept.
+func (p *clusterpyProvisioner) untagSubnets(logger *log.Entry, awsAdapter *awsAdapter, cluster *api.Cluster) error {
 	subnets, err := awsAdapter.GetSubnets()
 	if err != nil {
 		return err
 	}
 
-	tag := &ec2.Tag{
-		Key:   aws.String(tagNameKubernetesClusterPrefix + cluster.ID),
-		Value: aws.String(resourceLifecycleShared),
-	}
-
 	for _, subnet := range subnets {
-		if hasTag(subnet.Tags, tag) {
-			err = awsAdapter.DeleteTags(
-				aws.StringValue(subnet.SubnetId),
-				[]*ec2.Tag{tag},
-			)
-			if err != nil {
-				return err
-			}
+		err = releaseSubnetTag(logger, awsAdapter, subnet, cluster)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -569,7 +1193,17 @@ func (p *clusterpyProvisioner) untagSubnets(awsAdapter *awsAdapter, cluster *api
 // downscaleDeployments scales down all deployments of a cluster in the
 // specified namespace.
 func (p *clusterpyProvisioner) downscaleDeployments(logger *log.Entry, cluster *api.Cluster, namespace string) error {
-	client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, p.tokenSource)
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return err
+	}
+
+	tokenSource, err := p.clusterTokenSource(cluster)
+	if err != nil {
+		return err
+	}
+
+	client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, tokenSource, transport)
 	if err != nil {
 		return err
 	}
@@ -656,11 +1290,18 @@ func hasTag(tags []*ec2.Tag, tag *ec2.Tag) bool {
 	return false
 }
 
-// TODO(tech-depth): Remove when new node poole feature is enabled by default.
+// getNonLegacyNodePools returns the node pools provisioned as node pool
+// stacks. The legacy node pools are left out unless they're migrated, in
+// which case their replacements are returned instead.
 func getNonLegacyNodePools(cluster *api.Cluster) []*api.NodePool {
+	migrate := legacyNodePoolMigration(cluster)
+
 	nodePools := make([]*api.NodePool, 0, len(cluster.NodePools))
 	for _, np := range cluster.NodePools {
-		if np.Name == "master-default" || np.Name == "worker-default" {
+		if isLegacyNodePool(np) {
+			if migrate {
+				nodePools = append(nodePools, replacementNodePool(np))
+			}
 			continue
 		}
 		nodePools = append(nodePools, np)
@@ -684,7 +1325,22 @@ type resource struct {
 	Name      string `yaml:"name"`
 	Namespace string `yaml:"namespace"`
 	Kind      string `yaml:"kind"`
-	Labels    labels `yaml:"labels"`
+	// APIVersion is the group version serving the kind, e.g. for custom
+	// resources. The preferred version of the first group serving the
+	// kind is used if not set.
+	APIVersion    string `yaml:"api_version"`
+	Labels        labels `yaml:"labels"`
+	FieldSelector string `yaml:"field_selector"`
+	// PropagationPolicy is one of Foreground, Background or Orphan. The
+	// default is Background.
+	PropagationPolicy string `yaml:"propagation_policy"`
+	// GracePeriod in seconds, the default grace period of the resource is
+	// used if not set.
+	GracePeriod *int64 `yaml:"grace_period"`
+	// Wait for the resources to be gone, e.g. because of finalizers,
+	// before continuing. WaitTimeout defaults to 5m.
+	Wait        bool   `yaml:"wait"`
+	WaitTimeout string `yaml:"wait_timeout"`
 }
 
 // deletions defines two list of resources to be deleted. One before applying
@@ -692,64 +1348,122 @@ type resource struct {
 type deletions struct {
 	PreApply  []*resource `yaml:"pre_apply"`
 	PostApply []*resource `yaml:"post_apply"`
+	// components are the deletions shipped by the components in their own
+	// deletions.yaml by component name, run before and after applying the
+	// component.
+	components map[string]*deletions
+}
+
+// kubectlKubeconfig writes a kubeconfig for connecting to the API server of
+// the cluster with a token from the token source to a temporary file, which
+// must be removed by calling the returned cleanup function. The token is
+// fetched for every kubectl invocation, such that long-running applies don't
+// outlive it, and passed in the file only readable by the CLM instead of the
+// command line, where it would show up in process listings and logs. If the
+// token source is nil the client certificate of the cluster is used instead.
+func kubectlKubeconfig(cluster *api.Cluster, tokenSource oauth2.TokenSource) (string, func(), error) {
+	var kubeconfig []byte
+	if tokenSource == nil {
+		var err error
+		kubeconfig, err = clientCertKubeconfig(cluster, kubectlUser)
+		if err != nil {
+			return "", nil, err
+		}
+	} else {
+		token, err := tokenSource.Token()
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "no valid token")
+		}
+
+		kubeconfig, err = tokenKubeconfig(cluster, kubectlUser, token.AccessToken)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	// the file is created with mode 0600
+	kubeconfigFile, err := ioutil.TempFile("", "clm-kubeconfig")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(kubeconfigFile.Name()) }
+
+	_, err = kubeconfigFile.Write(kubeconfig)
+	if closeErr := kubeconfigFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return kubeconfigFile.Name(), cleanup, nil
 }
 
-// Deletions uses kubectl delete to delete the provided kubernetes resources.
-func (p *clusterpyProvisioner) Deletions(logger *log.Entry, cluster *api.Cluster, deletions []*resource) error {
-	token, err := p.tokenSource.Token()
+// impersonationArgs returns the kubectl arguments for impersonating the
+// service account configured with the apply_service_account config item, in
+// the format <namespace>/<name>, including the groups the API server puts
+// service accounts in so that RBAC rules bound to those groups apply as well.
+// No arguments are returned if the config item isn't set.
+func impersonationArgs(cluster *api.Cluster) ([]string, error) {
+	serviceAccount, ok := cluster.ConfigItems[configKeyApplyServiceAccount]
+	if !ok {
+		return nil, nil
+	}
+
+	parts := strings.Split(serviceAccount, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid value for %s: %s, must be <namespace>/<name>", configKeyApplyServiceAccount, serviceAccount)
+	}
+
+	return []string{
+		fmt.Sprintf("--as=system:serviceaccount:%s:%s", parts[0], parts[1]),
+		"--as-group=system:serviceaccounts",
+		fmt.Sprintf("--as-group=system:serviceaccounts:%s", parts[0]),
+	}, nil
+}
+
+// parseDeletions reads and parses the deletions.yaml of the manifests and
+// the ones of the components.
+func parseDeletions(manifestsPath string) (*deletions, error) {
+	result, err := parseDeletionsFile(path.Join(manifestsPath, deletionsFile))
 	if err != nil {
-		return errors.Wrapf(err, "no valid token")
+		return nil, err
 	}
 
-	for _, deletion := range deletions {
-		args := []string{
-			"kubectl",
-			fmt.Sprintf("--server=%s", cluster.APIServerURL),
-			fmt.Sprintf("--token=%s", token.AccessToken),
-			fmt.Sprintf("--namespace=%s", deletion.Namespace),
-			"delete",
-			deletion.Kind,
+	components, err := ioutil.ReadDir(manifestsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
 		}
+		return nil, err
+	}
 
-		// indentify the resource to be deleted either by name or
-		// labels. name AND labels cannot be defined at the same time,
-		// but one of them MUST be defined.
-		if deletion.Name != "" && len(deletion.Labels) > 0 {
-			return fmt.Errorf("only one of 'name' or 'labels' must be specified")
+	for _, c := range components {
+		if !c.IsDir() {
+			continue
 		}
 
-		if deletion.Name != "" {
-			args = append(args, deletion.Name)
-		} else if len(deletion.Labels) > 0 {
-			args = append(args, fmt.Sprintf("--selector=%s", deletion.Labels))
-		} else {
-			return fmt.Errorf("either name or labels must be specified to identify a resource")
+		componentDeletions, err := parseDeletionsFile(path.Join(manifestsPath, c.Name(), deletionsFile))
+		if err != nil {
+			return nil, fmt.Errorf("invalid deletions of component %s: %v", c.Name(), err)
 		}
 
-		cmd := exec.Command(args[0], args[1:]...)
-		cmd.Env = []string{}
+		if len(componentDeletions.PreApply) == 0 && len(componentDeletions.PostApply) == 0 {
+			continue
+		}
 
-		out, err := command.Run(logger, cmd)
-		if err != nil {
-			// if kubectl failed because the resource didn't
-			// exists, we don't treat it as an error since the
-			// resource was already deleted.
-			// We can only check this by inspecting the content of
-			// Stderr (which is provided in the err).
-			if strings.Contains(out, kubectlNotFound) {
-				continue
-			}
-			return errors.Wrap(err, "cannot run kubectl command")
+		if result.components == nil {
+			result.components = make(map[string]*deletions)
 		}
+		result.components[c.Name()] = componentDeletions
 	}
 
-	return nil
+	return result, nil
 }
 
-// parseDeletions reads and parses the deletions.yaml.
-func parseDeletions(manifestsPath string) (*deletions, error) {
-	file := path.Join(manifestsPath, deletionsFile)
-
+// parseDeletionsFile reads and parses a deletions.yaml.
+func parseDeletionsFile(file string) (*deletions, error) {
 	d, err := ioutil.ReadFile(file)
 	if err != nil {
 		// if the file doesn't exist we just treat it as if it was
@@ -771,49 +1485,76 @@ func parseDeletions(manifestsPath string) (*deletions, error) {
 		if deletion.Namespace == "" {
 			deletion.Namespace = defaultNamespace
 		}
+
+		err = deletion.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid pre_apply deletion of %s: %v", deletion.Kind, err)
+		}
 	}
 
 	for _, deletion := range deletions.PostApply {
 		if deletion.Namespace == "" {
 			deletion.Namespace = defaultNamespace
 		}
+
+		err = deletion.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid post_apply deletion of %s: %v", deletion.Kind, err)
+		}
 	}
 
 	return &deletions, nil
 }
 
-// apply calls kubectl apply for all the manifests in manifestsPath.
-func (p *clusterpyProvisioner) apply(logger *log.Entry, cluster *api.Cluster, manifestsPath string) error {
-	logger.Debugf("Checking for deletions.yaml")
-	deletions, err := parseDeletions(manifestsPath)
-	if err != nil {
-		return err
-	}
-
-	logger.Debugf("Running PreApply deletions (%d)", len(deletions.PreApply))
-	err = p.Deletions(logger, cluster, deletions.PreApply)
-	if err != nil {
-		return err
-	}
+// renderedManifest is a rendered manifest file ready to be applied.
+type renderedManifest struct {
+	File      string
+	Component string
+	Content   string
+	// ForceConflicts takes over the fields owned by other field managers
+	// when applying the manifest server-side.
+	ForceConflicts bool
+}
 
-	logger.Debugf("Starting Apply")
+// templateErrors is an aggregated report of all the manifest templates which
+// failed to render.
+type templateErrors map[string]error
 
-	//validating input
-	if !strings.HasPrefix(cluster.InfrastructureAccount, "aws:") {
-		return fmt.Errorf("Wrong format for string InfrastructureAccount: %s", cluster.InfrastructureAccount)
+func (e templateErrors) Error() string {
+	files := make([]string, 0, len(e))
+	for file := range e {
+		files = append(files, file)
 	}
+	sort.Strings(files)
 
-	components, err := ioutil.ReadDir(manifestsPath)
-	if err != nil {
-		return errors.Wrapf(err, "cannot read directory")
+	lines := make([]string, 0, len(files))
+	for _, file := range files {
+		lines = append(lines, fmt.Sprintf("%s: %v", file, e[file]))
 	}
 
-	token, err := p.tokenSource.Token()
+	return fmt.Sprintf("failed to render %d manifest templates:\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+// renderManifests renders all the manifests of the enabled components in
+// manifestsPath. Rendering doesn't stop at the first broken template, instead
+// all render errors are collected and returned as templateErrors. If secrets,
+// capabilities or values are nil, the secret lookup, the capability check or
+// the values and infrastructure template functions will fail.
+func (p *clusterpyProvisioner) renderManifests(logger *log.Entry, cluster *api.Cluster, manifestsPath string, secrets *secretsSource, capabilities *clusterCapabilities, values *ClusterValues) ([]*renderedManifest, error) {
+	components, err := ioutil.ReadDir(manifestsPath)
 	if err != nil {
-		return errors.Wrapf(err, "no valid token")
+		return nil, errors.Wrapf(err, "cannot read directory")
 	}
 
 	applyContext := newTemplateContext(manifestsPath)
+	applyContext.secrets = secrets
+	applyContext.capabilities = capabilities
+	applyContext.infrastructure = values.infrastructure()
+	applyContext.values = values
+
+	var manifests []*renderedManifest
+	var skippedComponents []string
+	renderErrors := make(templateErrors)
 
 	for _, c := range components {
 		// skip deletions.yaml if found
@@ -825,66 +1566,332 @@ func (p *clusterpyProvisioner) apply(logger *log.Entry, cluster *api.Cluster, ma
 		if !c.IsDir() {
 			continue
 		}
+
+		if componentDisabled(cluster, c.Name()) {
+			skippedComponents = append(skippedComponents, c.Name())
+			continue
+		}
+
 		componentFolder := path.Join(manifestsPath, c.Name())
 		files, err := ioutil.ReadDir(componentFolder)
 		if err != nil {
-			return errors.Wrapf(err, "cannot read directory")
+			return nil, errors.Wrapf(err, "cannot read directory")
 		}
 
 		for _, f := range files {
-			// Workaround for CRD issue in Kubernetes <v1.8.4
-			// https://github.bus.zalan.do/teapot/issues/issues/772
-			// TODO: Remove after v1.8.4 is rolled out to all
-			// clusters.
-			allowFailure := f.Name() == "credentials.yaml"
+			// the deletions of the component aren't a manifest
+			if f.Name() == deletionsFile {
+				continue
+			}
 
 			file := path.Join(componentFolder, f.Name())
 			manifest, err := renderTemplate(applyContext, file, cluster)
 			if err != nil {
-				logger.Errorf("Error applying template %v", err)
+				renderErrors[file] = err
+				continue
 			}
 
 			// If there's no content we skip the file.
 			if stripWhitespace(manifest) == "" {
-				log.Debugf("Skipping empty file: %s", file)
+				logger.Debugf("Skipping empty file: %s", file)
 				continue
 			}
 
-			args := []string{
-				"kubectl",
-				"apply",
-				fmt.Sprintf("--server=%s", cluster.APIServerURL),
-				fmt.Sprintf("--token=%s", token.AccessToken),
-				"-f",
-				"-",
+			manifests = append(manifests, &renderedManifest{
+				File:      file,
+				Component: c.Name(),
+				Content:   manifest,
+			})
+		}
+	}
+
+	if len(skippedComponents) > 0 {
+		logger.Infof("Skipped disabled components: %s", strings.Join(skippedComponents, ", "))
+	}
+
+	if len(renderErrors) > 0 {
+		return nil, renderErrors
+	}
+
+	return manifests, nil
+}
+
+// prepareManifests parses the deletions and renders the manifests in
+// manifestsPath.
+func (p *clusterpyProvisioner) prepareManifests(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, manifestsPath string) (*deletions, []*renderedManifest, error) {
+	logger.Debugf("Checking for deletions.yaml")
+	deletions, err := parseDeletions(manifestsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//validating input
+	if !strings.HasPrefix(cluster.InfrastructureAccount, "aws:") {
+		return nil, nil, fmt.Errorf("Wrong format for string InfrastructureAccount: %s", cluster.InfrastructureAccount)
+	}
+
+	secrets := newSecretsSource(adapter.session)
+	for _, region := range secondaryRegions(cluster) {
+		regionalAdapter, err := adapter.forRegion(region)
+		if err != nil {
+			return nil, nil, err
+		}
+		secrets.addRegion(region, newSecretsSource(regionalAdapter.session))
+	}
+
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	capabilities, err := newClusterCapabilities(logger, kubernetes.NewConfigWithTokenSource(cluster.APIServerURL, adapter.tokenSrc, transport))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values, err := p.clusterValues(adapter, cluster, path.Dir(manifestsPath))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifests, err := p.renderManifests(logger, cluster, manifestsPath, secrets, capabilities, values)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return deletions, manifests, nil
+}
+
+// apply calls kubectl apply for all the manifests in manifestsPath. All
+// manifests are rendered before anything is applied or deleted, such that a
+// single broken template fails the apply without touching the cluster. Custom
+// resource definitions are applied and established before everything else.
+func (p *clusterpyProvisioner) apply(ctx context.Context, logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, manifestsPath string) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "manifests", nil)
+	defer func() { span.End(err) }()
+
+	deletions, manifests, err := p.prepareManifests(logger, adapter, cluster, manifestsPath)
+	if err != nil {
+		return err
+	}
+
+	return p.applyRendered(ctx, logger, adapter, cluster, deletions, manifests)
+}
+
+// applyGeneric renders the manifests in manifestsPath and applies them to a
+// cluster not running on AWS. Secrets can't be looked up in the secret stores
+// of AWS.
+func (p *clusterpyProvisioner) applyGeneric(ctx context.Context, logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, manifestsPath string, values *ClusterValues) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "manifests", nil)
+	defer func() { span.End(err) }()
+
+	deletions, err := parseDeletions(manifestsPath)
+	if err != nil {
+		return err
+	}
+
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return err
+	}
+
+	capabilities, err := newClusterCapabilities(logger, kubernetes.NewConfigWithTokenSource(cluster.APIServerURL, adapter.tokenSrc, transport))
+	if err != nil {
+		return err
+	}
+
+	manifests, err := p.renderManifests(logger, cluster, manifestsPath, nil, capabilities, values)
+	if err != nil {
+		return err
+	}
+
+	return p.applyRendered(ctx, logger, adapter, cluster, deletions, manifests)
+}
+
+// applyRendered runs the deletions and applies the rendered manifests
+// component by component.
+func (p *clusterpyProvisioner) applyRendered(ctx context.Context, logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, deletions *deletions, manifests []*renderedManifest) error {
+	tokenSource, err := p.serviceIdentityTokenSource(logger, adapter, cluster)
+	if err != nil {
+		return err
+	}
+
+	if scope := newApplyScope(cluster); scope != nil {
+		logger.Warnf("Applying only %s", scope)
+		deletions, manifests = scope.deletions(deletions), scope.manifests(manifests)
+	}
+
+	logger.Debugf("Running PreApply deletions (%d)", len(deletions.PreApply))
+	err = p.Deletions(logger, cluster, tokenSource, deletions.PreApply, adapter.audit, adapter.dryRun)
+	if err != nil {
+		return err
+	}
+
+	logger.Debugf("Starting Apply")
+
+	// manifests can be applied as a dedicated service account, such that
+	// missing RBAC permissions fail the apply
+	asArgs, err := impersonationArgs(cluster)
+	if err != nil {
+		return err
+	}
+
+	serverSide, err := newServerSideApply(cluster)
+	if err != nil {
+		return err
+	}
+
+	applyManifest := func(manifest *renderedManifest, maxTries uint64) error {
+		newApplyCommand := func() (*exec.Cmd, func(), error) {
+			kubeconfig, cleanup, err := kubectlKubeconfig(cluster, tokenSource)
+			if err != nil {
+				return nil, nil, err
 			}
 
-			newApplyCommand := func() *exec.Cmd {
-				cmd := exec.Command(args[0], args[1:]...)
-				// prevent kubectl to find the in-cluster config
-				cmd.Env = []string{}
-				return cmd
+			args := append([]string{adapter.kubectl, "apply", "--kubeconfig=" + kubeconfig}, asArgs...)
+			if serverSide != nil {
+				args = append(args, serverSide.args(manifest.ForceConflicts)...)
 			}
+			args = append(args, "-f", "-")
 
-			if p.dryRun {
-				logger.Debug(newApplyCommand())
-			} else {
-				applyManifest := func() error {
-					cmd := newApplyCommand()
-					cmd.Stdin = strings.NewReader(manifest)
-					_, err := command.Run(logger, cmd)
-					return err
+			cmd := exec.Command(args[0], args[1:]...)
+			// prevent kubectl to find the in-cluster config
+			cmd.Env = []string{}
+			return cmd, cleanup, nil
+		}
+
+		if adapter.dryRun {
+			cmd, cleanup, err := newApplyCommand()
+			if err != nil {
+				return err
+			}
+			cleanup()
+			logger.Debug(command.String(cmd))
+			return nil
+		}
+
+		run := func() error {
+			cmd, cleanup, err := newApplyCommand()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			cmd.Stdin = strings.NewReader(manifest.Content)
+			_, err = command.Run(logger, cmd)
+			return err
+		}
+		_, applySpan := tracing.StartSpan(ctx, "kubectl-apply", map[string]string{"manifest": manifest.File})
+		err := backoff.Retry(run, backoff.WithMaxTries(backoff.NewExponentialBackOff(), maxTries))
+		applySpan.End(err)
+		return err
+	}
+
+	batching := applyBatching(cluster)
+	applyBatch := func(name string, manifests []*renderedManifest) error {
+		// the manifests are applied with a single kubectl invocation first,
+		// if it fails they're applied one by one to attribute the error to
+		// the manifest causing it.
+		if batching && len(manifests) > 1 {
+			batch := manifestBatch(name, manifests)
+			err := applyManifest(batch, 1)
+			if err == nil {
+				if !adapter.dryRun {
+					for _, resource := range manifestResources(batch.Content) {
+						adapter.audit.Record(audit.KindKubernetes, "apply", resource, nil)
+					}
 				}
-				err = backoff.Retry(applyManifest, backoff.WithMaxTries(backoff.NewExponentialBackOff(), maxApplyRetries))
-				if err != nil && !allowFailure {
-					return errors.Wrapf(err, "run kubectl failed")
+				return nil
+			}
+			logger.Warnf("Failed to apply the manifests of %s at once, applying them one by one: %v", name, err)
+		}
+
+		for _, manifest := range manifests {
+			err := applyManifest(manifest, maxApplyRetries)
+			if !adapter.dryRun {
+				for _, resource := range manifestResources(manifest.Content) {
+					adapter.audit.Record(audit.KindKubernetes, "apply", resource, err)
 				}
 			}
+			if err != nil {
+				return errors.Wrapf(err, "run kubectl failed for %s", manifest.File)
+			}
+		}
+		return nil
+	}
+
+	applyManifests := func(name string, manifests []*renderedManifest) error {
+		if serverSide == nil {
+			return applyBatch(name, manifests)
+		}
+
+		// the resources whose conflicts are forced are applied with a
+		// separate kubectl invocation after the others.
+		var forced, others []*renderedManifest
+		for _, manifest := range serverSide.splitManifests(manifests) {
+			if manifest.ForceConflicts {
+				forced = append(forced, manifest)
+				continue
+			}
+			others = append(others, manifest)
+		}
+
+		err := applyBatch(name, others)
+		if err != nil {
+			return err
+		}
+		return applyBatch(name, forced)
+	}
+
+	// custom resource definitions are applied first and must be established
+	// before the custom resources depending on them can be applied
+	crdManifests, manifests, crdNames := splitCRDs(manifests)
+	if len(crdManifests) > 0 {
+		logger.Debugf("Applying custom resource definitions (%d)", len(crdNames))
+		err = applyManifests("custom resource definitions", crdManifests)
+		if err != nil {
+			return err
+		}
+
+		if !adapter.dryRun {
+			err = p.waitForCRDs(cluster, tokenSource, crdNames)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, component := range applyOrder(cluster, manifests, deletions) {
+		componentDeletions := deletions.component(component)
+
+		if len(componentDeletions.PreApply) > 0 {
+			logger.Debugf("Running PreApply deletions of component %s (%d)", component, len(componentDeletions.PreApply))
+			err = p.Deletions(logger, cluster, tokenSource, componentDeletions.PreApply, adapter.audit, adapter.dryRun)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = applyManifests("component "+component, componentManifests(manifests, component))
+		if err != nil {
+			return err
+		}
+
+		err = p.waitForRollouts(ctx, logger, adapter, cluster, tokenSource, component, componentManifests(manifests, component))
+		if err != nil {
+			return err
+		}
+
+		if len(componentDeletions.PostApply) > 0 {
+			logger.Debugf("Running PostApply deletions of component %s (%d)", component, len(componentDeletions.PostApply))
+			err = p.Deletions(logger, cluster, tokenSource, componentDeletions.PostApply, adapter.audit, adapter.dryRun)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	logger.Debugf("Running PostApply deletions (%d)", len(deletions.PostApply))
-	err = p.Deletions(logger, cluster, deletions.PostApply)
+	err = p.Deletions(logger, cluster, tokenSource, deletions.PostApply, adapter.audit, adapter.dryRun)
 	if err != nil {
 		return err
 	}
@@ -892,6 +1899,83 @@ func (p *clusterpyProvisioner) apply(logger *log.Entry, cluster *api.Cluster, ma
 	return nil
 }
 
+// component returns the deletions of the component, which are empty if the
+// component doesn't ship any.
+func (d *deletions) component(name string) *deletions {
+	if componentDeletions, ok := d.components[name]; ok {
+		return componentDeletions
+	}
+	return &deletions{}
+}
+
+// applyOrder returns the components to apply in order of their names: the
+// components with manifests and the enabled components only shipping
+// deletions.
+func applyOrder(cluster *api.Cluster, manifests []*renderedManifest, deletions *deletions) []string {
+	set := make(map[string]struct{})
+	for _, manifest := range manifests {
+		set[manifest.Component] = struct{}{}
+	}
+	for component := range deletions.components {
+		if !componentDisabled(cluster, component) {
+			set[component] = struct{}{}
+		}
+	}
+
+	components := make([]string, 0, len(set))
+	for component := range set {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	return components
+}
+
+// componentManifests returns the manifests of the component.
+func componentManifests(manifests []*renderedManifest, component string) []*renderedManifest {
+	var result []*renderedManifest
+	for _, manifest := range manifests {
+		if manifest.Component == component {
+			result = append(result, manifest)
+		}
+	}
+	return result
+}
+
+// applyBatching returns true if the manifests of a component are applied
+// with a single kubectl invocation. It's enabled unless the apply_batching
+// config item is set to false.
+func applyBatching(cluster *api.Cluster) bool {
+	return cluster.ConfigItems[configKeyApplyBatching] != "false"
+}
+
+// manifestBatch combines the documents of the manifests, which must have the
+// same conflict policy, into a single manifest, keeping their order.
+func manifestBatch(name string, manifests []*renderedManifest) *renderedManifest {
+	var content strings.Builder
+	for _, manifest := range manifests {
+		content.WriteString("---\n")
+		content.WriteString(manifest.Content)
+		if !strings.HasSuffix(manifest.Content, "\n") {
+			content.WriteString("\n")
+		}
+	}
+
+	return &renderedManifest{
+		File:           name,
+		Content:        content.String(),
+		ForceConflicts: manifests[0].ForceConflicts,
+	}
+}
+
+// componentDisabled returns true if the component has been disabled for the
+// cluster via the skip_component_<name> config item. Dashes in the component
+// name are replaced by underscores to match the config item naming e.g. the
+// component 'external-dns' is disabled by 'skip_component_external_dns: true'.
+func componentDisabled(cluster *api.Cluster, component string) bool {
+	key := configKeySkipComponentPrefix + strings.Replace(component, "-", "_", -1)
+	return cluster.ConfigItems[key] == "true"
+}
+
 func stripWhitespace(content string) string {
 	return strings.Map(func(r rune) rune {
 		if unicode.IsSpace(r) {
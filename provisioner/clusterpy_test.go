@@ -1,20 +1,43 @@
 package provisioner
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"golang.org/x/oauth2"
+
+	log "github.com/sirupsen/logrus"
 )
 
 func TestGetInfrastructureID(t *testing.T) {
 	expected := "12345678910"
-	awsAccountID := getAWSAccountID(fmt.Sprintf("aws:%s", expected))
+	awsAccountID, err := getAWSAccountID(fmt.Sprintf("aws:%s", expected))
+	if err != nil {
+		t.Errorf("should not fail: %v", err)
+	}
 	if awsAccountID != expected {
 		t.Errorf("expected: %s, got: %s", expected, awsAccountID)
 	}
+
+	for _, invalid := range []string{"", "aws", "aws:"} {
+		_, err = getAWSAccountID(invalid)
+		if err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
 }
 
 func TestHasTag(t *testing.T) {
@@ -67,3 +90,412 @@ func TestHasTag(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateClusterProfile(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		nodePools   []*api.NodePool
+		valid       bool
+	}{
+		{
+			msg:         "no profile is always valid",
+			configItems: map[string]string{},
+			nodePools: []*api.NodePool{
+				{Profile: "master-default", MinSize: 2, MaxSize: 2},
+				{Profile: "worker-default", MinSize: 3, MaxSize: 20},
+			},
+			valid: true,
+		},
+		{
+			msg:         "minimal profile with single master node",
+			configItems: map[string]string{configKeyClusterProfile: clusterProfileMinimal},
+			nodePools: []*api.NodePool{
+				{Profile: "master-default", MinSize: 1, MaxSize: 1},
+			},
+			valid: true,
+		},
+		{
+			msg:         "minimal profile with multiple node pools",
+			configItems: map[string]string{configKeyClusterProfile: clusterProfileMinimal},
+			nodePools: []*api.NodePool{
+				{Profile: "master-default", MinSize: 1, MaxSize: 1},
+				{Profile: "worker-default", MinSize: 1, MaxSize: 1},
+			},
+			valid: false,
+		},
+		{
+			msg:         "minimal profile with worker node pool",
+			configItems: map[string]string{configKeyClusterProfile: clusterProfileMinimal},
+			nodePools: []*api.NodePool{
+				{Profile: "worker-default", MinSize: 1, MaxSize: 1},
+			},
+			valid: false,
+		},
+		{
+			msg:         "minimal profile with more than one node",
+			configItems: map[string]string{configKeyClusterProfile: clusterProfileMinimal},
+			nodePools: []*api.NodePool{
+				{Profile: "master-default", MinSize: 1, MaxSize: 2},
+			},
+			valid: false,
+		},
+		{
+			msg:         "unknown profile",
+			configItems: map[string]string{configKeyClusterProfile: "huge"},
+			nodePools:   []*api.NodePool{},
+			valid:       false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := &api.Cluster{
+				ConfigItems: tc.configItems,
+				NodePools:   tc.nodePools,
+			}
+			err := validateClusterProfile(cluster)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestComponentDisabled(t *testing.T) {
+	cluster := &api.Cluster{
+		ConfigItems: map[string]string{
+			"skip_component_ingress":      "true",
+			"skip_component_external_dns": "true",
+			"skip_component_kube2iam":     "false",
+		},
+	}
+
+	assert.True(t, componentDisabled(cluster, "ingress"))
+	assert.True(t, componentDisabled(cluster, "external-dns"))
+	assert.False(t, componentDisabled(cluster, "kube2iam"))
+	assert.False(t, componentDisabled(cluster, "flannel"))
+}
+
+func TestManifestBatch(t *testing.T) {
+	require.True(t, applyBatching(&api.Cluster{}))
+	require.False(t, applyBatching(&api.Cluster{ConfigItems: map[string]string{configKeyApplyBatching: "false"}}))
+
+	batch := manifestBatch("component ingress", []*renderedManifest{
+		{
+			File:      "ingress/namespace.yaml",
+			Component: "ingress",
+			Content:   "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: ingress",
+		},
+		{
+			File:      "ingress/deployment.yaml",
+			Component: "ingress",
+			Content:   "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: ingress\n  namespace: ingress\n",
+		},
+	})
+	require.Equal(t, "component ingress", batch.File)
+	require.Equal(t, []string{"Namespace/ingress", "ingress/Deployment/ingress"}, manifestResources(batch.Content))
+}
+
+func TestRenderManifestsAggregatesErrors(t *testing.T) {
+	manifestsPath, err := ioutil.TempDir(os.TempDir(), t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(manifestsPath)
+
+	for name, content := range map[string]string{
+		"good/deployment.yaml":  "foo: {{ .Region }}",
+		"good/empty.yaml":       "{{ if false }}foo: bar{{ end }}",
+		"broken/service.yaml":   "foo: {{ .Region ",
+		"broken/configmap.yaml": "foo: {{ .ConfigItems.missing }}",
+	} {
+		file := path.Join(manifestsPath, name)
+		require.NoError(t, os.MkdirAll(path.Dir(file), 0755))
+		require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+
+	cluster := &api.Cluster{Region: "eu-central-1", ConfigItems: map[string]string{}}
+	logger := log.WithField("cluster", "foobar")
+
+	p := &clusterpyProvisioner{}
+	_, err = p.renderManifests(logger, cluster, manifestsPath, nil, nil, nil)
+	require.Error(t, err)
+
+	renderErrors, ok := err.(templateErrors)
+	require.True(t, ok)
+	require.Len(t, renderErrors, 2)
+	require.Contains(t, renderErrors, path.Join(manifestsPath, "broken/service.yaml"))
+	require.Contains(t, renderErrors, path.Join(manifestsPath, "broken/configmap.yaml"))
+
+	// disabling the broken component makes rendering succeed
+	cluster.ConfigItems["skip_component_broken"] = "true"
+	manifests, err := p.renderManifests(logger, cluster, manifestsPath, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	require.Equal(t, "foo: eu-central-1", manifests[0].Content)
+}
+
+func TestProbeAPIServer(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		statusCodes map[string]int
+		suffix      string
+		ready       bool
+		authError   bool
+	}{
+		{
+			msg:         "healthy and ready",
+			statusCodes: map[string]int{},
+			ready:       true,
+		},
+		{
+			msg:         "trailing slash",
+			statusCodes: map[string]int{},
+			suffix:      "/",
+			ready:       true,
+		},
+		{
+			msg:         "readyz not available",
+			statusCodes: map[string]int{"/readyz": http.StatusNotFound},
+			ready:       true,
+		},
+		{
+			msg:         "not ready",
+			statusCodes: map[string]int{"/readyz": http.StatusInternalServerError},
+			ready:       false,
+		},
+		{
+			msg:         "unauthorized",
+			statusCodes: map[string]int{"/healthz": http.StatusUnauthorized},
+			ready:       false,
+			authError:   true,
+		},
+		{
+			msg:         "forbidden",
+			statusCodes: map[string]int{"/version": http.StatusForbidden},
+			ready:       false,
+			authError:   true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if statusCode, ok := tc.statusCodes[r.URL.Path]; ok {
+					w.WriteHeader(statusCode)
+					return
+				}
+				switch r.URL.Path {
+				case "/version":
+					fmt.Fprint(w, `{"major": "1", "minor": "9", "gitVersion": "v1.9.6"}`)
+				case "/healthz", "/readyz":
+					fmt.Fprint(w, "ok")
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			serverVersion, err := probeAPIServer(server.Client(), server.URL+tc.suffix)
+			if !tc.ready {
+				require.Error(t, err)
+				_, ok := err.(*apiServerAuthError)
+				assert.Equal(t, tc.authError, ok)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "v1.9.6", serverVersion.GitVersion)
+		})
+	}
+}
+
+func TestWaitForAPIServerTimeout(t *testing.T) {
+	origInterval := apiServerPollInterval
+	defer func() { apiServerPollInterval = origInterval }()
+	apiServerPollInterval = time.Millisecond
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := waitForAPIServer(log.StandardLogger().WithFields(log.Fields{}), server.Client(), server.URL, 10*time.Millisecond, nil)
+	assert.Error(t, err)
+}
+
+func TestKubectlKubeconfig(t *testing.T) {
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	cluster := &api.Cluster{
+		ID:           "cluster-1",
+		APIServerURL: "https://api.example.org",
+		ConfigItems:  map[string]string{configKeyAPIServerCA: "ca"},
+	}
+
+	kubeconfigFile, cleanup, err := kubectlKubeconfig(cluster, tokenSource)
+	require.NoError(t, err)
+
+	info, err := os.Stat(kubeconfigFile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	kubeconfig, err := ioutil.ReadFile(kubeconfigFile)
+	require.NoError(t, err)
+	expected, err := tokenKubeconfig(cluster, kubectlUser, "token")
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(kubeconfig))
+
+	cleanup()
+	_, err = os.Stat(kubeconfigFile)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestImpersonationArgs(t *testing.T) {
+	cluster := &api.Cluster{ConfigItems: map[string]string{}}
+
+	args, err := impersonationArgs(cluster)
+	require.NoError(t, err)
+	require.Empty(t, args)
+
+	cluster.ConfigItems[configKeyApplyServiceAccount] = "kube-system/manifest-applier"
+	args, err = impersonationArgs(cluster)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"--as=system:serviceaccount:kube-system:manifest-applier",
+		"--as-group=system:serviceaccounts",
+		"--as-group=system:serviceaccounts:kube-system",
+	}, args)
+
+	for _, invalid := range []string{"", "manifest-applier", "kube-system/", "/manifest-applier", "a/b/c"} {
+		cluster.ConfigItems[configKeyApplyServiceAccount] = invalid
+		_, err = impersonationArgs(cluster)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestClusterOptions(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		provisioner *clusterpyProvisioner
+		configItems map[string]string
+		expected    clusterOptions
+		expectErr   bool
+	}{
+		{
+			msg:         "global options are used by default",
+			provisioner: &clusterpyProvisioner{applyOnly: true, removeVolumes: true},
+			configItems: map[string]string{},
+			expected:    clusterOptions{applyOnly: true, removeVolumes: true},
+		},
+		{
+			msg:         "config items override global options",
+			provisioner: &clusterpyProvisioner{applyOnly: true},
+			configItems: map[string]string{
+				configKeyApplyOnly:       "false",
+				configKeyRemoveVolumes:   "true",
+				configKeySnapshotVolumes: "true",
+				configKeyDryRun:          "true",
+			},
+			expected: clusterOptions{dryRun: true, removeVolumes: true, snapshotVolumes: true},
+		},
+		{
+			msg:         "global dry-run can't be disabled",
+			provisioner: &clusterpyProvisioner{dryRun: true},
+			configItems: map[string]string{configKeyDryRun: "false"},
+			expected:    clusterOptions{dryRun: true},
+		},
+		{
+			msg:         "invalid value",
+			provisioner: &clusterpyProvisioner{},
+			configItems: map[string]string{configKeyApplyOnly: "maybe"},
+			expectErr:   true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			options, err := tc.provisioner.clusterOptions(&api.Cluster{ConfigItems: tc.configItems})
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, options)
+		})
+	}
+}
+
+type ec2VolumesAPIStub struct {
+	ec2API
+	volumes []*ec2.Volume
+	// instances are the states of the instances which can be found.
+	instances map[string]string
+	detached  []string
+	deleted   []string
+}
+
+func (e *ec2VolumesAPIStub) DescribeVolumes(input *ec2.DescribeVolumesInput) (*ec2.DescribeVolumesOutput, error) {
+	return &ec2.DescribeVolumesOutput{Volumes: e.volumes}, nil
+}
+
+func (e *ec2VolumesAPIStub) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	state, ok := e.instances[aws.StringValue(input.InstanceIds[0])]
+	if !ok {
+		return nil, awserr.New("InvalidInstanceID.NotFound", "not found", nil)
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{
+		{Instances: []*ec2.Instance{{InstanceId: input.InstanceIds[0], State: &ec2.InstanceState{Name: aws.String(state)}}}},
+	}}, nil
+}
+
+func (e *ec2VolumesAPIStub) DetachVolume(input *ec2.DetachVolumeInput) (*ec2.VolumeAttachment, error) {
+	e.detached = append(e.detached, aws.StringValue(input.VolumeId))
+	return &ec2.VolumeAttachment{State: aws.String(ec2.VolumeAttachmentStateDetaching)}, nil
+}
+
+func (e *ec2VolumesAPIStub) DeleteVolume(input *ec2.DeleteVolumeInput) (*ec2.DeleteVolumeOutput, error) {
+	e.deleted = append(e.deleted, aws.StringValue(input.VolumeId))
+	return &ec2.DeleteVolumeOutput{}, nil
+}
+
+func inUseVolume(id, instanceID string) *ec2.Volume {
+	return &ec2.Volume{
+		VolumeId:    aws.String(id),
+		State:       aws.String(ec2.VolumeStateInUse),
+		Attachments: []*ec2.VolumeAttachment{{InstanceId: aws.String(instanceID), State: aws.String(ec2.VolumeAttachmentStateAttached)}},
+	}
+}
+
+func TestRemoveEBSVolumes(t *testing.T) {
+	logger := log.WithField("cluster", "kube-1")
+	cluster := &api.Cluster{ID: "kube-1"}
+	stub := &ec2VolumesAPIStub{
+		volumes: []*ec2.Volume{
+			{VolumeId: aws.String("vol-1"), State: aws.String(ec2.VolumeStateAvailable)},
+			inUseVolume("vol-2", "i-running"),
+			inUseVolume("vol-3", "i-terminated"),
+			inUseVolume("vol-4", "i-gone"),
+		},
+		instances: map[string]string{
+			"i-running":    ec2.InstanceStateNameShuttingDown,
+			"i-terminated": ec2.InstanceStateNameTerminated,
+		},
+	}
+	provisioner := &clusterpyProvisioner{}
+	adapter := &awsAdapter{ec2Client: stub}
+
+	err := provisioner.removeEBSVolumes(context.Background(), logger, adapter, cluster, clusterOptions{removeVolumes: true})
+	require.Error(t, err)
+	require.Equal(t, []string{"vol-1"}, stub.deleted)
+	require.Equal(t, []string{"vol-3", "vol-4"}, stub.detached)
+
+	// the detached volumes are deleted by the next attempt
+	stub.volumes = []*ec2.Volume{
+		inUseVolume("vol-2", "i-running"),
+		{VolumeId: aws.String("vol-3"), State: aws.String(ec2.VolumeStateAvailable)},
+		{VolumeId: aws.String("vol-4"), State: aws.String(ec2.VolumeStateAvailable)},
+	}
+	err = provisioner.removeEBSVolumes(context.Background(), logger, adapter, cluster, clusterOptions{removeVolumes: true})
+	require.EqualError(t, err, "EBS volume vol-2 is attached to instance i-running in state shutting-down")
+	require.Equal(t, []string{"vol-1", "vol-3", "vol-4"}, stub.deleted)
+
+	stub.instances["i-running"] = ec2.InstanceStateNameTerminated
+	stub.volumes = []*ec2.Volume{{VolumeId: aws.String("vol-2"), State: aws.String(ec2.VolumeStateAvailable)}}
+	err = provisioner.removeEBSVolumes(context.Background(), logger, adapter, cluster, clusterOptions{removeVolumes: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"vol-1", "vol-3", "vol-4", "vol-2"}, stub.deleted)
+}
@@ -0,0 +1,307 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	configSchemaFile = "cluster/config-schema.yaml"
+
+	configItemTypeString   = "string"
+	configItemTypeBool     = "bool"
+	configItemTypeInt      = "int"
+	configItemTypeFloat    = "float"
+	configItemTypeDuration = "duration"
+	configItemTypeList     = "list"
+)
+
+// configSchema describes the config items supported by a channel.
+type configSchema struct {
+	// Strict rejects config items which aren't described by the schema.
+	Strict              bool                         `yaml:"strict"`
+	ConfigItems         map[string]*configItemSchema `yaml:"config_items"`
+	NodePoolConfigItems map[string]*configItemSchema `yaml:"node_pool_config_items"`
+}
+
+// configItemSchema describes a single config item.
+type configItemSchema struct {
+	Type        string `yaml:"type"`
+	Description string `yaml:"description"`
+	// AllowedValues lists the valid values. Every element of a list must
+	// be one of the allowed values.
+	AllowedValues []string `yaml:"allowed_values"`
+	// Pattern is a regular expression the value (or every element of a
+	// list) must match.
+	Pattern  string `yaml:"pattern"`
+	Required bool   `yaml:"required"`
+	// Default is used if the config item isn't set.
+	Default *string `yaml:"default"`
+	// Deprecated is a message explaining what to use instead. Deprecated
+	// config items are still accepted but logged.
+	Deprecated string `yaml:"deprecated"`
+	// Sensitive config items, e.g. passwords, are masked in the logs, the
+	// status of the cluster, the history and the plans.
+	Sensitive bool `yaml:"sensitive"`
+}
+
+// configSchemaErrors are the validation errors of all the config items, by
+// config item.
+type configSchemaErrors map[string]error
+
+func (e configSchemaErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%s: %v", key, e[key]))
+	}
+
+	return fmt.Sprintf("%d invalid config items:\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+// loadConfigSchema reads the config schema of the channel. nil is returned if
+// the channel doesn't have a schema.
+func loadConfigSchema(channelConfig *channel.Config) (*configSchema, error) {
+	data, err := ioutil.ReadFile(path.Join(channelConfig.Path, configSchemaFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var schema configSchema
+	err = yaml.UnmarshalStrict(data, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config schema %s: %v", configSchemaFile, err)
+	}
+
+	for name, item := range schema.ConfigItems {
+		err = item.validateSchema()
+		if err != nil {
+			return nil, fmt.Errorf("invalid config schema %s: config item %s: %v", configSchemaFile, name, err)
+		}
+	}
+
+	for name, item := range schema.NodePoolConfigItems {
+		err = item.validateSchema()
+		if err != nil {
+			return nil, fmt.Errorf("invalid config schema %s: node pool config item %s: %v", configSchemaFile, name, err)
+		}
+	}
+
+	return &schema, nil
+}
+
+// validateSchema validates the schema of the config item itself, including
+// the default value.
+func (s *configItemSchema) validateSchema() error {
+	switch s.Type {
+	case "":
+		s.Type = configItemTypeString
+	case configItemTypeString, configItemTypeBool, configItemTypeInt, configItemTypeFloat, configItemTypeDuration, configItemTypeList:
+	default:
+		return fmt.Errorf("unknown type %s", s.Type)
+	}
+
+	if s.Pattern != "" {
+		_, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+	}
+
+	if s.Default != nil {
+		err := s.validate(*s.Default)
+		if err != nil {
+			return fmt.Errorf("invalid default: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// validate validates the value of the config item.
+func (s *configItemSchema) validate(value string) error {
+	values := []string{value}
+
+	switch s.Type {
+	case configItemTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("'%s' is not a bool, use 'true' or 'false'", value)
+		}
+	case configItemTypeInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("'%s' is not an integer", value)
+		}
+	case configItemTypeFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("'%s' is not a number", value)
+		}
+	case configItemTypeDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("'%s' is not a duration, use e.g. '90s', '15m' or '2h'", value)
+		}
+	case configItemTypeList:
+		values = strings.Split(value, ",")
+	}
+
+	for _, value := range values {
+		if len(s.AllowedValues) > 0 && !containsString(s.AllowedValues, value) {
+			return fmt.Errorf("'%s' is not allowed, use one of: %s", value, strings.Join(s.AllowedValues, ", "))
+		}
+
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(value) {
+			return fmt.Errorf("'%s' doesn't match the pattern %s", value, s.Pattern)
+		}
+	}
+
+	return nil
+}
+
+// containsString returns true if the value is in the list.
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateConfigItems validates the config items against the schema, setting
+// the defaults of unset config items. All invalid config items are reported
+// together, prefixed with prefix.
+func validateConfigItems(logger *log.Entry, prefix string, configItems map[string]string, schemas map[string]*configItemSchema, strict bool, errs configSchemaErrors) {
+	for name, schema := range schemas {
+		value, ok := configItems[name]
+		if !ok {
+			switch {
+			case schema.Default != nil:
+				configItems[name] = *schema.Default
+			case schema.Required:
+				errs[prefix+name] = describeConfigItemError(schema, fmt.Errorf("required config item is not set"))
+			}
+			continue
+		}
+
+		if schema.Deprecated != "" {
+			logger.Warnf("Config item %s%s is deprecated: %s", prefix, name, schema.Deprecated)
+		}
+
+		err := schema.validate(value)
+		if err != nil {
+			if schema.Sensitive && value != "" {
+				err = errors.New(strings.Replace(err.Error(), value, logging.Redacted, -1))
+			}
+			errs[prefix+name] = describeConfigItemError(schema, err)
+		}
+	}
+
+	if !strict {
+		return
+	}
+
+	for name := range configItems {
+		if _, ok := schemas[name]; !ok {
+			errs[prefix+name] = fmt.Errorf("unknown config item, it's not described by %s", configSchemaFile)
+		}
+	}
+}
+
+// describeConfigItemError adds the description of the config item to the
+// error to make it actionable.
+func describeConfigItemError(schema *configItemSchema, err error) error {
+	if schema.Description == "" {
+		return err
+	}
+	return fmt.Errorf("%v (%s)", err, schema.Description)
+}
+
+// validateConfigSchema validates the config items of the cluster and its node
+// pools against the config schema of the channel, if it has one. Defaults
+// from the schema are set for unset config items.
+func validateConfigSchema(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error {
+	schema, err := loadConfigSchema(channelConfig)
+	if err != nil {
+		return err
+	}
+
+	if schema == nil {
+		return nil
+	}
+
+	errs := make(configSchemaErrors)
+
+	if cluster.ConfigItems == nil {
+		cluster.ConfigItems = make(map[string]string)
+	}
+	validateConfigItems(logger, "", cluster.ConfigItems, schema.ConfigItems, schema.Strict, errs)
+
+	for _, nodePool := range cluster.NodePools {
+		if nodePool.ConfigItems == nil {
+			nodePool.ConfigItems = make(map[string]string)
+		}
+		validateConfigItems(logger, fmt.Sprintf("node pool %s: ", nodePool.Name), nodePool.ConfigItems, schema.NodePoolConfigItems, schema.Strict, errs)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// SensitiveConfigValues returns the values of the config items of the cluster
+// and its node pools which are marked as sensitive by the config schema of
+// the channel, to be masked wherever they could show up. The API server
+// credentials are always sensitive.
+func SensitiveConfigValues(cluster *api.Cluster, channelConfig *channel.Config) ([]string, error) {
+	schema, err := loadConfigSchema(channelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, name := range sensitiveAuthConfigItems {
+		if value := cluster.ConfigItems[name]; value != "" {
+			values = append(values, value)
+		}
+	}
+
+	if schema == nil {
+		return values, nil
+	}
+
+	addValues := func(configItems map[string]string, schemas map[string]*configItemSchema) {
+		for name, schema := range schemas {
+			if value, ok := configItems[name]; ok && schema.Sensitive && value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+
+	addValues(cluster.ConfigItems, schema.ConfigItems)
+	for _, nodePool := range cluster.NodePools {
+		addValues(nodePool.ConfigItems, schema.NodePoolConfigItems)
+	}
+	return values, nil
+}
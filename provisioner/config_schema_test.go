@@ -0,0 +1,157 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+const testConfigSchema = `
+config_items:
+  cluster_profile:
+    allowed_values: [minimal]
+  stack_drift_action:
+    allowed_values: [ignore, warn, fail]
+    default: warn
+  etcd_instance_count:
+    type: int
+  etcd_backup_max_age:
+    type: duration
+  apply_only:
+    type: bool
+  secondary_regions:
+    type: list
+    pattern: "^[a-z]+-[a-z]+-[0-9]$"
+  eks_role_arn:
+    required: true
+    description: IAM role of the EKS control plane
+  legacy_item:
+    deprecated: use new_item instead
+node_pool_config_items:
+  gpu:
+    type: bool
+`
+
+func newConfigSchemaChannel(t *testing.T, schema string) *channel.Config {
+	dir, err := ioutil.TempDir("", "config-schema")
+	require.NoError(t, err)
+
+	err = os.MkdirAll(path.Join(dir, "cluster"), 0755)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(path.Join(dir, configSchemaFile), []byte(schema), 0644)
+	require.NoError(t, err)
+
+	return &channel.Config{Path: dir}
+}
+
+func TestValidateConfigSchema(t *testing.T) {
+	logger := log.WithField("cluster", "foobar")
+	channelConfig := newConfigSchemaChannel(t, testConfigSchema)
+	defer os.RemoveAll(channelConfig.Path)
+
+	cluster := &api.Cluster{
+		ConfigItems: map[string]string{
+			"eks_role_arn":        "arn:aws:iam::123456789012:role/eks",
+			"etcd_instance_count": "5",
+			"secondary_regions":   "eu-west-1,us-east-1",
+			"legacy_item":         "true",
+			"unknown_item":        "value",
+		},
+		NodePools: []*api.NodePool{{Name: "default"}},
+	}
+	require.NoError(t, validateConfigSchema(logger, cluster, channelConfig))
+	require.Equal(t, "warn", cluster.ConfigItems["stack_drift_action"])
+
+	cluster = &api.Cluster{
+		ConfigItems: map[string]string{
+			"cluster_profile":     "tiny",
+			"etcd_instance_count": "three",
+			"etcd_backup_max_age": "1 day",
+			"apply_only":          "yes",
+			"secondary_regions":   "eu-west-1,EU-CENTRAL-1",
+		},
+		NodePools: []*api.NodePool{{Name: "gpu", ConfigItems: map[string]string{"gpu": "maybe"}}},
+	}
+	err := validateConfigSchema(logger, cluster, channelConfig)
+	require.Error(t, err)
+	require.IsType(t, configSchemaErrors{}, err)
+	errs := err.(configSchemaErrors)
+	require.Len(t, errs, 7)
+	for _, key := range []string{"cluster_profile", "etcd_instance_count", "etcd_backup_max_age", "apply_only", "secondary_regions", "eks_role_arn", "node pool gpu: gpu"} {
+		require.Contains(t, errs, key)
+	}
+	require.Contains(t, errs["eks_role_arn"].Error(), "IAM role of the EKS control plane")
+}
+
+func TestValidateConfigSchemaStrict(t *testing.T) {
+	channelConfig := newConfigSchemaChannel(t, "strict: true\nconfig_items:\n  known: {}\n")
+	defer os.RemoveAll(channelConfig.Path)
+
+	cluster := &api.Cluster{ConfigItems: map[string]string{"known": "a", "unknown": "b"}}
+	err := validateConfigSchema(log.WithField("cluster", "foobar"), cluster, channelConfig)
+	require.Error(t, err)
+	require.Len(t, err.(configSchemaErrors), 1)
+	require.Contains(t, err.(configSchemaErrors), "unknown")
+}
+
+func TestLoadConfigSchema(t *testing.T) {
+	// channels without a schema aren't validated
+	schema, err := loadConfigSchema(&channel.Config{Path: "invalid_folder"})
+	require.NoError(t, err)
+	require.Nil(t, schema)
+
+	for _, invalid := range []string{
+		"config_items:\n  item:\n    type: date\n",
+		"config_items:\n  item:\n    type: int\n    default: one\n",
+		"config_items:\n  item:\n    pattern: '['\n",
+		"config_items:\n  item:\n    unknown_field: true\n",
+	} {
+		channelConfig := newConfigSchemaChannel(t, invalid)
+		_, err := loadConfigSchema(channelConfig)
+		require.Error(t, err, invalid)
+		os.RemoveAll(channelConfig.Path)
+	}
+}
+
+func TestSensitiveConfigValues(t *testing.T) {
+	channelConfig := newConfigSchemaChannel(t, `
+config_items:
+  password:
+    sensitive: true
+    pattern: "^[a-z]+$"
+  name: {}
+node_pool_config_items:
+  token:
+    sensitive: true
+`)
+	defer os.RemoveAll(channelConfig.Path)
+
+	cluster := &api.Cluster{
+		ConfigItems: map[string]string{"password": "hunter", "name": "kube-1"},
+		NodePools:   []*api.NodePool{{Name: "default", ConfigItems: map[string]string{"token": "pool-token"}}},
+	}
+	values, err := SensitiveConfigValues(cluster, channelConfig)
+	require.NoError(t, err)
+	sort.Strings(values)
+	require.Equal(t, []string{"hunter", "pool-token"}, values)
+
+	// API server credentials are sensitive without a schema
+	cluster.ConfigItems[configKeyAPIServerToken] = "api-token"
+	values, err = SensitiveConfigValues(cluster, &channel.Config{Path: channelConfig.Path + "-missing"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"api-token"}, values)
+
+	// invalid sensitive values aren't part of the errors
+	cluster.ConfigItems["password"] = "Hunter2"
+	err = validateConfigSchema(log.WithField("cluster", "foobar"), cluster, channelConfig)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "Hunter2")
+}
@@ -0,0 +1,173 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/etcd"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	configKeyControlPlaneUpdateStrategy = "control_plane_update_strategy"
+	configKeyControlPlaneHealthTimeout  = "control_plane_health_timeout"
+	controlPlaneUpdateStrategyHealth    = "health-checked"
+	defaultControlPlaneHealthTimeout    = 10 * time.Minute
+	// leaderAnnotation is the annotation of the endpoints used by the
+	// controller-manager and the scheduler for leader election.
+	leaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+)
+
+// leaderElectedComponents are the components of the control plane running
+// with leader election.
+var leaderElectedComponents = []string{"kube-controller-manager", "kube-scheduler"}
+
+// leaderElectionRecord is the leader election record of a component.
+type leaderElectionRecord struct {
+	HolderIdentity       string    `json:"holderIdentity"`
+	LeaseDurationSeconds int       `json:"leaseDurationSeconds"`
+	RenewTime            time.Time `json:"renewTime"`
+}
+
+// controlPlaneHealthChecker verifies the health of the control plane: the
+// etcd quorum if the etcd_endpoint config item is set, the availability of
+// the API servers and a current leader of the controller-manager and the
+// scheduler.
+type controlPlaneHealthChecker struct {
+	kube    kubernetes.Interface
+	etcd    etcdClient
+	adapter *awsAdapter
+	cluster *api.Cluster
+}
+
+// CheckHealth returns an error describing the first anomaly found.
+func (c *controlPlaneHealthChecker) CheckHealth(ctx context.Context) error {
+	if c.etcd != nil {
+		status, err := c.etcd.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get etcd status: %v", err)
+		}
+		err = status.VerifyQuorum()
+		if err != nil {
+			return fmt.Errorf("etcd unhealthy: %v", err)
+		}
+	}
+
+	_, err := c.kube.Discovery().ServerVersion()
+	if err != nil {
+		return fmt.Errorf("API server unavailable: %v", err)
+	}
+
+	count := apiServerCount(c.cluster)
+	if count > 1 {
+		healthy, err := c.adapter.healthyAPIServers(c.cluster)
+		if err != nil {
+			return err
+		}
+		if len(healthy) < count {
+			return fmt.Errorf("only %d of %d API servers are healthy", len(healthy), count)
+		}
+	}
+
+	for _, component := range leaderElectedComponents {
+		err = c.checkLeader(component)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLeader verifies that the component has a leader which renewed its
+// lease in time.
+func (c *controlPlaneHealthChecker) checkLeader(component string) error {
+	endpoints, err := c.kube.CoreV1().Endpoints("kube-system").Get(component, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get the leader of %s: %v", component, err)
+	}
+
+	var record leaderElectionRecord
+	err = json.Unmarshal([]byte(endpoints.Annotations[leaderAnnotation]), &record)
+	if err != nil {
+		return fmt.Errorf("invalid leader election record of %s: %v", component, err)
+	}
+
+	return record.verify(component, time.Now())
+}
+
+// verify returns an error if the record has no holder or the lease expired.
+func (r *leaderElectionRecord) verify(component string, now time.Time) error {
+	if r.HolderIdentity == "" {
+		return fmt.Errorf("%s has no leader", component)
+	}
+
+	expiry := r.RenewTime.Add(time.Duration(r.LeaseDurationSeconds) * time.Second)
+	if now.After(expiry) {
+		return fmt.Errorf("lease of the %s leader %s expired at %s", component, r.HolderIdentity, expiry.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// controlPlaneUpdateStrategy updates the control plane node pools with the
+// control plane strategy and all other node pools with the default one.
+type controlPlaneUpdateStrategy struct {
+	controlPlane updatestrategy.UpdateStrategy
+	fallback     updatestrategy.UpdateStrategy
+}
+
+// Update updates the node pool with the strategy of its role.
+func (s *controlPlaneUpdateStrategy) Update(ctx context.Context, nodePool *api.NodePool) error {
+	if isControlPlaneNodePool(nodePool) {
+		return s.controlPlane.Update(ctx, nodePool)
+	}
+	return s.fallback.Update(ctx, nodePool)
+}
+
+// newControlPlaneUpdateStrategy wraps the update strategy to update the
+// control plane node pools one node at a time, verifying the health of the
+// control plane after each replacement, if enabled by the
+// control_plane_update_strategy config item.
+func (p *clusterpyProvisioner) newControlPlaneUpdateStrategy(logger *log.Entry, updater updatestrategy.UpdateStrategy, manager updatestrategy.NodePoolManager, kube kubernetes.Interface, adapter *awsAdapter, cluster *api.Cluster) (updatestrategy.UpdateStrategy, error) {
+	strategy, ok := cluster.ConfigItems[configKeyControlPlaneUpdateStrategy]
+	if !ok || strategy == updateStrategyRolling {
+		return updater, nil
+	}
+	if strategy != controlPlaneUpdateStrategyHealth {
+		return nil, fmt.Errorf("invalid value for %s: %s", configKeyControlPlaneUpdateStrategy, strategy)
+	}
+
+	timeout := defaultControlPlaneHealthTimeout
+	if value, ok := cluster.ConfigItems[configKeyControlPlaneHealthTimeout]; ok {
+		var err error
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid value for %s: %s", configKeyControlPlaneHealthTimeout, value)
+		}
+	}
+
+	checker := &controlPlaneHealthChecker{
+		kube:    kube,
+		adapter: adapter,
+		cluster: cluster,
+	}
+	if endpoint, ok := cluster.ConfigItems[configKeyEtcdEndpoint]; ok {
+		client, err := p.etcdHTTPClient(cluster)
+		if err != nil {
+			return nil, err
+		}
+		checker.etcd = etcd.NewClient(endpoint, client)
+	}
+
+	pauses := updatestrategy.NewConfigMapPauseStore(kube, updateProgressNamespace)
+
+	return &controlPlaneUpdateStrategy{
+		controlPlane: updatestrategy.NewControlPlaneUpdateStrategy(logger, manager, checker, pauses, timeout),
+		fallback:     updater,
+	}, nil
+}
@@ -0,0 +1,70 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func leaderEndpoints(component, record string) *v1.Endpoints {
+	return &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        component,
+			Namespace:   "kube-system",
+			Annotations: map[string]string{leaderAnnotation: record},
+		},
+	}
+}
+
+func TestCheckLeader(t *testing.T) {
+	renewed := time.Now().UTC().Format(time.RFC3339)
+	client := fake.NewSimpleClientset(
+		leaderEndpoints("kube-controller-manager", fmt.Sprintf(`{"holderIdentity":"ip-172-31-0-1","leaseDurationSeconds":15,"renewTime":"%s"}`, renewed)),
+		leaderEndpoints("kube-scheduler", `{"holderIdentity":"ip-172-31-0-1","leaseDurationSeconds":15,"renewTime":"2017-01-01T00:00:00Z"}`),
+		leaderEndpoints("broken", `{`),
+	)
+	checker := &controlPlaneHealthChecker{kube: client}
+
+	require.NoError(t, checker.checkLeader("kube-controller-manager"))
+	require.Error(t, checker.checkLeader("kube-scheduler"))
+	require.Error(t, checker.checkLeader("broken"))
+	require.Error(t, checker.checkLeader("missing"))
+
+	record := &leaderElectionRecord{LeaseDurationSeconds: 15, RenewTime: time.Now()}
+	require.Error(t, record.verify("kube-scheduler", time.Now()))
+}
+
+type recordingUpdateStrategy struct {
+	updated []string
+}
+
+func (s *recordingUpdateStrategy) Update(ctx context.Context, nodePool *api.NodePool) error {
+	s.updated = append(s.updated, nodePool.Name)
+	return nil
+}
+
+func TestControlPlaneUpdateStrategy(t *testing.T) {
+	controlPlane := &recordingUpdateStrategy{}
+	fallback := &recordingUpdateStrategy{}
+	strategy := &controlPlaneUpdateStrategy{controlPlane: controlPlane, fallback: fallback}
+
+	require.NoError(t, strategy.Update(context.Background(), &api.NodePool{Name: "master", Profile: "master-default"}))
+	require.NoError(t, strategy.Update(context.Background(), &api.NodePool{Name: "worker", Profile: "worker-default"}))
+	require.Equal(t, []string{"master"}, controlPlane.updated)
+	require.Equal(t, []string{"worker"}, fallback.updated)
+
+	p := &clusterpyProvisioner{}
+	updater, err := p.newControlPlaneUpdateStrategy(nil, fallback, nil, nil, nil, &api.Cluster{ConfigItems: map[string]string{}})
+	require.NoError(t, err)
+	require.Equal(t, fallback, updater)
+
+	_, err = p.newControlPlaneUpdateStrategy(nil, fallback, nil, nil, nil, &api.Cluster{ConfigItems: map[string]string{configKeyControlPlaneUpdateStrategy: "surge"}})
+	require.Error(t, err)
+}
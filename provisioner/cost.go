@@ -0,0 +1,122 @@
+package provisioner
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsUtils "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+const (
+	configKeyEtcdInstanceCount = "etcd_instance_count"
+	defaultEtcdInstanceCount   = 3
+	hoursPerMonth              = 730
+	costCurrency               = "USD"
+)
+
+// instanceCapacity describes the number of instances of a single instance
+// type which are part of a cluster.
+type instanceCapacity struct {
+	instanceType string
+	min          int64
+	max          int64
+}
+
+// clusterCapacity returns the instances of the cluster's node pools and etcd
+// stack.
+func clusterCapacity(cluster *api.Cluster) []instanceCapacity {
+	var capacity []instanceCapacity
+	for _, nodePool := range cluster.NodePools {
+		capacity = append(capacity, instanceCapacity{
+			instanceType: nodePool.InstanceType,
+			min:          nodePool.MinSize,
+			max:          nodePool.MaxSize,
+		})
+	}
+
+	// minimal clusters don't have a dedicated etcd stack and the size of
+	// the etcd stack is only known if the instance type is configured.
+	etcdInstanceType, ok := cluster.ConfigItems[etcdInstanceTypeKey]
+	if !isMinimalProfile(cluster) && ok {
+		count := int64(defaultEtcdInstanceCount)
+		if value, ok := cluster.ConfigItems[configKeyEtcdInstanceCount]; ok {
+			if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+				count = parsed
+			}
+		}
+
+		capacity = append(capacity, instanceCapacity{
+			instanceType: etcdInstanceType,
+			min:          count,
+			max:          count,
+		})
+	}
+
+	return capacity
+}
+
+// estimateCost estimates the monthly cost of the instances in the capacity
+// based on the hourly price returned by instancePrice. Spot instances are
+// estimated at the on-demand price so the estimate is an upper bound.
+func estimateCost(capacity []instanceCapacity, instancePrice func(instanceType string) (float64, error)) (*api.CostEstimate, error) {
+	estimate := &api.CostEstimate{Currency: costCurrency}
+	for _, instances := range capacity {
+		price, err := instancePrice(instances.instanceType)
+		if err != nil {
+			return nil, err
+		}
+
+		estimate.MinMonthly += float64(instances.min) * price * hoursPerMonth
+		estimate.MaxMonthly += float64(instances.max) * price * hoursPerMonth
+	}
+
+	estimate.MinMonthly = roundCents(estimate.MinMonthly)
+	estimate.MaxMonthly = roundCents(estimate.MaxMonthly)
+	return estimate, nil
+}
+
+func roundCents(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// updateCostEstimate estimates the monthly cost of the cluster and logs the
+// difference to the estimate of the previous provisioning run if the
+// capacity changed. The estimate is stored in the cluster status. Failing to
+// estimate the cost is only logged since it should not fail the provisioning
+// run.
+func (p *clusterpyProvisioner) updateCostEstimate(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster) {
+	client := pricing.New(adapter.session, aws.NewConfig().WithRegion(awsUtils.PricingRegion))
+
+	estimate, err := estimateCost(clusterCapacity(cluster), func(instanceType string) (float64, error) {
+		return p.priceCache.InstancePrice(client, cluster.Region, instanceType)
+	})
+	if err != nil {
+		logger.Warnf("Failed to estimate the cluster cost: %v", err)
+		return
+	}
+
+	if cluster.Status == nil {
+		cluster.Status = &api.ClusterStatus{}
+	}
+
+	previous := cluster.Status.CostEstimate
+	switch {
+	case previous == nil:
+		logger.Infof("Estimated monthly cost: %.2f-%.2f %s", estimate.MinMonthly, estimate.MaxMonthly, estimate.Currency)
+	case *previous != *estimate:
+		logger.Infof(
+			"Estimated monthly cost changed: %.2f-%.2f %s (%+.2f/%+.2f)",
+			estimate.MinMonthly,
+			estimate.MaxMonthly,
+			estimate.Currency,
+			estimate.MinMonthly-previous.MinMonthly,
+			estimate.MaxMonthly-previous.MaxMonthly,
+		)
+	}
+
+	cluster.Status.CostEstimate = estimate
+}
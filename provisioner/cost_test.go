@@ -0,0 +1,57 @@
+package provisioner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestClusterCapacity(t *testing.T) {
+	cluster := &api.Cluster{
+		ConfigItems: map[string]string{
+			etcdInstanceTypeKey:        "t2.medium",
+			configKeyEtcdInstanceCount: "5",
+		},
+		NodePools: []*api.NodePool{
+			{InstanceType: "m4.large", MinSize: 1, MaxSize: 2},
+			{InstanceType: "m4.xlarge", MinSize: 0, MaxSize: 10},
+		},
+	}
+
+	expected := []instanceCapacity{
+		{instanceType: "m4.large", min: 1, max: 2},
+		{instanceType: "m4.xlarge", min: 0, max: 10},
+		{instanceType: "t2.medium", min: 5, max: 5},
+	}
+	assert.Equal(t, expected, clusterCapacity(cluster))
+
+	cluster.ConfigItems[configKeyClusterProfile] = clusterProfileMinimal
+	assert.Equal(t, expected[:2], clusterCapacity(cluster))
+}
+
+func TestEstimateCost(t *testing.T) {
+	prices := map[string]float64{
+		"m4.large":  0.1,
+		"t2.medium": 0.05,
+	}
+	instancePrice := func(instanceType string) (float64, error) {
+		price, ok := prices[instanceType]
+		if !ok {
+			return 0, fmt.Errorf("unknown instance type: %s", instanceType)
+		}
+		return price, nil
+	}
+
+	estimate, err := estimateCost([]instanceCapacity{
+		{instanceType: "m4.large", min: 1, max: 3},
+		{instanceType: "t2.medium", min: 3, max: 3},
+	}, instancePrice)
+	require.NoError(t, err)
+	assert.Equal(t, &api.CostEstimate{MinMonthly: 182.5, MaxMonthly: 328.5, Currency: costCurrency}, estimate)
+
+	_, err = estimateCost([]instanceCapacity{{instanceType: "x1.32xlarge", min: 1, max: 1}}, instancePrice)
+	assert.Error(t, err)
+}
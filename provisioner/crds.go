@@ -0,0 +1,169 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	crdKind     = "CustomResourceDefinition"
+	crdAPIGroup = "apiextensions.k8s.io"
+	// crdResource is the qualified resource name of custom resource
+	// definitions used to look them up with the dynamic client.
+	crdResource                = "customresourcedefinitions." + crdAPIGroup
+	crdEstablishedTimeout      = 2 * time.Minute
+	crdEstablishedPollInterval = 2 * time.Second
+)
+
+// manifestObject is the part of a manifest document needed to identify the
+// resource defined by it.
+type manifestObject struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+}
+
+// isCRD returns true if the object is a custom resource definition.
+func (o *manifestObject) isCRD() bool {
+	return o.Kind == crdKind && strings.HasPrefix(o.APIVersion, crdAPIGroup+"/")
+}
+
+// splitCRDs moves the custom resource definitions out of the manifests, such
+// that they can be applied before the resources depending on them. It returns
+// the manifests containing only custom resource definitions, the remaining
+// manifests and the names of the custom resource definitions. Manifests which
+// only define custom resource definitions are not part of the remaining
+// manifests.
+func splitCRDs(manifests []*renderedManifest) ([]*renderedManifest, []*renderedManifest, []string) {
+	var crdManifests, otherManifests []*renderedManifest
+	var names []string
+
+	for _, manifest := range manifests {
+		var crdDocuments, otherDocuments []string
+		for _, document := range yamlDocumentSeparator.Split(manifest.Content, -1) {
+			if stripWhitespace(document) == "" {
+				continue
+			}
+
+			var object manifestObject
+			err := yaml.Unmarshal([]byte(document), &object)
+			if err == nil && object.isCRD() {
+				crdDocuments = append(crdDocuments, document)
+				names = append(names, object.Metadata.Name)
+				continue
+			}
+			otherDocuments = append(otherDocuments, document)
+		}
+
+		if len(crdDocuments) == 0 {
+			otherManifests = append(otherManifests, manifest)
+			continue
+		}
+
+		crdManifests = append(crdManifests, &renderedManifest{
+			File:      manifest.File,
+			Component: manifest.Component,
+			Content:   strings.Join(crdDocuments, "---\n"),
+		})
+
+		if len(otherDocuments) > 0 {
+			otherManifests = append(otherManifests, &renderedManifest{
+				File:      manifest.File,
+				Component: manifest.Component,
+				Content:   strings.Join(otherDocuments, "---\n"),
+			})
+		}
+	}
+
+	return crdManifests, otherManifests, names
+}
+
+// crdEstablished returns true if the Established condition of the custom
+// resource definition is true, i.e. the API server serves its resources.
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	status, ok := crd.Object["status"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	conditions, ok := status["conditions"].([]interface{})
+	if !ok {
+		return false
+	}
+
+	for _, condition := range conditions {
+		condition, ok := condition.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForEstablished waits until all the named custom resource definitions
+// are established or the timeout expires.
+func waitForEstablished(client resourceClient, names []string, timeout, pollInterval time.Duration) error {
+	deadline := time.After(timeout)
+	for _, name := range names {
+		for {
+			crd, err := client.Get(name)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+			if err == nil && crdEstablished(crd) {
+				break
+			}
+
+			select {
+			case <-time.After(pollInterval):
+			case <-deadline:
+				return fmt.Errorf("timed out after %s waiting for custom resource definition %s to be established", timeout, name)
+			}
+		}
+	}
+	return nil
+}
+
+// waitForCRDs waits until the API server has established all the named
+// custom resource definitions.
+func (p *clusterpyProvisioner) waitForCRDs(cluster *api.Cluster, tokenSource oauth2.TokenSource, names []string) error {
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return err
+	}
+
+	deleter, err := newResourceDeleter(kubernetes.NewConfigWithTokenSource(cluster.APIServerURL, tokenSource, transport))
+	if err != nil {
+		return err
+	}
+
+	resource, err := deleter.findResource(crdResource, "")
+	if err != nil {
+		return err
+	}
+	if resource == nil {
+		return fmt.Errorf("the server doesn't serve custom resource definitions")
+	}
+
+	client, err := deleter.client(resource, "")
+	if err != nil {
+		return err
+	}
+
+	return waitForEstablished(client, names, crdEstablishedTimeout, crdEstablishedPollInterval)
+}
@@ -0,0 +1,116 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestSplitCRDs(t *testing.T) {
+	manifests := []*renderedManifest{
+		{
+			File:      "credentials-provider/credentials.yaml",
+			Component: "credentials-provider",
+			Content: `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: platformcredentialssets.zalando.org
+---
+apiVersion: zalando.org/v1
+kind: PlatformCredentialsSet
+metadata:
+  name: foo
+`,
+		},
+		{
+			File:      "stackset/crd.yaml",
+			Component: "stackset",
+			Content: `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: stacksets.zalando.org
+`,
+		},
+		{
+			File:      "stackset/deployment.yaml",
+			Component: "stackset",
+			Content: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: stackset-controller
+`,
+		},
+		{
+			File:      "other/crd.yaml",
+			Component: "other",
+			Content: `apiVersion: example.org/v1
+kind: CustomResourceDefinition
+metadata:
+  name: not-a-crd
+`,
+		},
+	}
+
+	crds, others, names := splitCRDs(manifests)
+	require.Equal(t, []string{"platformcredentialssets.zalando.org", "stacksets.zalando.org"}, names)
+
+	require.Len(t, crds, 2)
+	require.Equal(t, "credentials-provider/credentials.yaml", crds[0].File)
+	require.Equal(t, []string{"CustomResourceDefinition/platformcredentialssets.zalando.org"}, manifestResources(crds[0].Content))
+	require.Equal(t, "stackset/crd.yaml", crds[1].File)
+
+	require.Len(t, others, 3)
+	require.Equal(t, "credentials-provider/credentials.yaml", others[0].File)
+	require.Equal(t, []string{"PlatformCredentialsSet/foo"}, manifestResources(others[0].Content))
+	require.Equal(t, manifests[2], others[1])
+	require.Equal(t, manifests[3], others[2])
+}
+
+type crdClientStub struct {
+	mockResourceClient
+	// pending is the number of times Get returns the custom resource
+	// definition as not established.
+	pending int
+}
+
+func (c *crdClientStub) Get(name string) (*unstructured.Unstructured, error) {
+	if name == "missing" {
+		return nil, apierrors.NewNotFound(schema.GroupResource{}, name)
+	}
+
+	status := "False"
+	if c.pending == 0 {
+		status = "True"
+	} else {
+		c.pending--
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "NamesAccepted", "status": "True"},
+				map[string]interface{}{"type": "Established", "status": status},
+			},
+		},
+	}}, nil
+}
+
+func TestWaitForEstablished(t *testing.T) {
+	client := &crdClientStub{pending: 3}
+	err := waitForEstablished(client, []string{"stacksets.zalando.org"}, time.Second, time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, 0, client.pending)
+
+	err = waitForEstablished(client, []string{"missing"}, 10*time.Millisecond, time.Millisecond)
+	require.Error(t, err)
+
+	client.pending = 1000
+	err = waitForEstablished(client, []string{"stacksets.zalando.org"}, 10*time.Millisecond, time.Millisecond)
+	require.Error(t, err)
+
+	require.False(t, crdEstablished(&unstructured.Unstructured{Object: map[string]interface{}{}}))
+}
@@ -0,0 +1,263 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DecommissionPlan lists the resources decommissioning a cluster would
+// touch.
+type DecommissionPlan struct {
+	Cluster string `json:"cluster"`
+	// DeletionProtected is true if the cluster is protected from deletion,
+	// in which case decommissioning it would fail.
+	DeletionProtected bool `json:"deletion_protected"`
+	// Deployments are the kube-system deployments which would be scaled
+	// down to stop the controllers of the cluster.
+	Deployments []string `json:"deployments"`
+	// Stacks are deleted in order: the stacks tagged with the cluster, the
+	// regional stacks and the cluster stack.
+	Stacks []*DecommissionStack `json:"stacks"`
+	// LoadBalancers are deleted along with the cluster stack.
+	LoadBalancers []string `json:"load_balancers"`
+	DNSRecords    []string `json:"dns_records"`
+	// SubnetTags are the subnets the cluster tag would be removed from.
+	SubnetTags []string `json:"subnet_tags"`
+	// ElasticIPs are the elastic IPs of the static egress of the cluster
+	// which would be released after deleting its NAT gateways.
+	ElasticIPs []string `json:"elastic_ips,omitempty"`
+	// Volumes are the EBS volumes of the cluster which would be deleted if
+	// removing volumes is enabled.
+	Volumes    []*DecommissionVolume `json:"volumes"`
+	Kubeconfig string                `json:"kubeconfig,omitempty"`
+	// Warnings are the resources which couldn't be listed.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// DecommissionStack is a stack which would be deleted.
+type DecommissionStack struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+}
+
+// DecommissionVolume is an EBS volume of the cluster. Volumes which are
+// neither available nor attached to instances would block decommissioning.
+type DecommissionVolume struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+	// Snapshot is true if the volume would be snapshotted before it's
+	// deleted.
+	Snapshot bool `json:"snapshot,omitempty"`
+}
+
+// PlanDecommission lists the resources decommissioning the cluster would
+// touch without deleting anything.
+func (p *clusterpyProvisioner) PlanDecommission(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*DecommissionPlan, error) {
+	logger = logging.WithModule(logger, "provisioner")
+
+	adapter, _, _, err := p.prepareProvision(logger, cluster, channelConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.planDecommission(logger, adapter, cluster)
+}
+
+func (p *clusterpyProvisioner) planDecommission(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster) (*DecommissionPlan, error) {
+	plan := &DecommissionPlan{
+		Cluster:           cluster.ID,
+		DeletionProtected: DeletionProtected(cluster),
+	}
+
+	// decommissioning proceeds if the deployments can't be scaled down, so
+	// the same applies to listing them.
+	deployments, err := p.runningDeployments(cluster, "kube-system")
+	if err != nil {
+		logger.Warnf("Unable to list the deployments: %v", err)
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("failed to list the deployments: %v", err))
+	}
+	plan.Deployments = deployments
+
+	stacks, err := adapter.ListStacks(map[string]string{
+		tagNameKubernetesClusterPrefix + cluster.ID: resourceLifecycleOwned,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, stack := range stacks {
+		plan.Stacks = append(plan.Stacks, &DecommissionStack{Name: aws.StringValue(stack.StackName), Region: cluster.Region})
+	}
+
+	regions, err := adapter.regionalStackRegions(cluster)
+	if err != nil {
+		return nil, err
+	}
+	for _, region := range regions {
+		plan.Stacks = append(plan.Stacks, &DecommissionStack{Name: regionalStackName(cluster), Region: region})
+	}
+
+	exists, err := stackExists(adapter, cluster.LocalID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		plan.Stacks = append(plan.Stacks, &DecommissionStack{Name: cluster.LocalID, Region: cluster.Region})
+
+		// not every channel exposes the load balancer of the API server.
+		loadBalancer, err := adapter.apiServerLoadBalancer(cluster.LocalID)
+		if err == nil {
+			plan.LoadBalancers = append(plan.LoadBalancers, aws.StringValue(loadBalancer.LoadBalancerName))
+		}
+	}
+
+	if apiServerDNSEnabled(cluster) {
+		names, err := apiServerNames(cluster)
+		if err != nil {
+			return nil, err
+		}
+		plan.DNSRecords = names
+	}
+
+	subnets, err := adapter.GetSubnets()
+	if err != nil {
+		return nil, err
+	}
+	tag := &ec2.Tag{
+		Key:   aws.String(tagNameKubernetesClusterPrefix + cluster.ID),
+		Value: aws.String(resourceLifecycleShared),
+	}
+	for _, subnet := range subnets {
+		if hasTag(subnet.Tags, tag) {
+			plan.SubnetTags = append(plan.SubnetTags, aws.StringValue(subnet.SubnetId))
+		}
+	}
+
+	plan.ElasticIPs, err = adapter.staticEgressIPs(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := newKubeconfigStore(adapter, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		plan.Kubeconfig = store.String()
+	}
+
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if options.removeVolumes {
+		volumes, err := adapter.GetVolumes(map[string]string{tagNameKubernetesClusterPrefix + cluster.ID: resourceLifecycleOwned})
+		if err != nil {
+			return nil, err
+		}
+		for _, volume := range volumes {
+			switch aws.StringValue(volume.State) {
+			case ec2.VolumeStateDeleted, ec2.VolumeStateDeleting:
+				continue
+			}
+			plan.Volumes = append(plan.Volumes, &DecommissionVolume{
+				ID:       aws.StringValue(volume.VolumeId),
+				State:    aws.StringValue(volume.State),
+				Snapshot: options.snapshotVolumes,
+			})
+		}
+	}
+
+	return plan, nil
+}
+
+// stackExists returns true if the stack exists.
+func stackExists(adapter *awsAdapter, stackName string) (bool, error) {
+	_, err := adapter.getStackByName(stackName)
+	if err != nil {
+		if isDoesNotExistsErr(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// runningDeployments returns the names of the deployments in the namespace
+// which have replicas.
+func (p *clusterpyProvisioner) runningDeployments(cluster *api.Cluster, namespace string) ([]string, error) {
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSource, err := p.clusterTokenSource(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, tokenSource, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	deployments, err := client.AppsV1beta1().Deployments(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, deployment := range deployments.Items {
+		if int32Value(deployment.Spec.Replicas) != 0 {
+			names = append(names, namespace+"/"+deployment.Name)
+		}
+	}
+	return names, nil
+}
+
+// Write writes a human readable summary of the decommission plan to w.
+func (p *DecommissionPlan) Write(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Decommissioning cluster %s would\n", p.Cluster)
+	if p.DeletionProtected {
+		fmt.Fprintf(&b, "  fail, the cluster is protected from deletion\n")
+	}
+	for _, deployment := range p.Deployments {
+		fmt.Fprintf(&b, "  scale down deployment %s\n", deployment)
+	}
+	for _, stack := range p.Stacks {
+		fmt.Fprintf(&b, "  delete stack %s (%s)\n", stack.Name, stack.Region)
+	}
+	for _, loadBalancer := range p.LoadBalancers {
+		fmt.Fprintf(&b, "  delete load balancer %s\n", loadBalancer)
+	}
+	for _, record := range p.DNSRecords {
+		fmt.Fprintf(&b, "  delete DNS record %s\n", record)
+	}
+	for _, subnet := range p.SubnetTags {
+		fmt.Fprintf(&b, "  untag subnet %s\n", subnet)
+	}
+	if p.Kubeconfig != "" {
+		fmt.Fprintf(&b, "  delete admin kubeconfig %s\n", p.Kubeconfig)
+	}
+	for _, volume := range p.Volumes {
+		fmt.Fprintf(&b, "  delete volume %s (%s)\n", volume.ID, volume.State)
+	}
+	for _, warning := range p.Warnings {
+		fmt.Fprintf(&b, "  warning: %s\n", warning)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,44 @@
+package provisioner
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecommissionPlanWrite(t *testing.T) {
+	plan := &DecommissionPlan{
+		Cluster:           "aws:123456789012:eu-central-1:kube-1",
+		DeletionProtected: true,
+		Deployments:       []string{"kube-system/ingress"},
+		Stacks: []*DecommissionStack{
+			{Name: "nodepool-default-worker-kube-1", Region: "eu-central-1"},
+			{Name: "cluster-regional-kube-1", Region: "eu-west-1"},
+			{Name: "kube-1", Region: "eu-central-1"},
+		},
+		LoadBalancers: []string{"kube-1-api"},
+		DNSRecords:    []string{"kube-1.example.org"},
+		SubnetTags:    []string{"subnet-1"},
+		Volumes:       []*DecommissionVolume{{ID: "vol-1", State: "in-use"}},
+		Kubeconfig:    "s3://bucket/kube-1/kubeconfig",
+		Warnings:      []string{"failed to list the deployments: timeout"},
+	}
+
+	var output bytes.Buffer
+	err := plan.Write(&output)
+	require.NoError(t, err)
+	require.Equal(t, `Decommissioning cluster aws:123456789012:eu-central-1:kube-1 would
+  fail, the cluster is protected from deletion
+  scale down deployment kube-system/ingress
+  delete stack nodepool-default-worker-kube-1 (eu-central-1)
+  delete stack cluster-regional-kube-1 (eu-west-1)
+  delete stack kube-1 (eu-central-1)
+  delete load balancer kube-1-api
+  delete DNS record kube-1.example.org
+  untag subnet subnet-1
+  delete admin kubeconfig s3://bucket/kube-1/kubeconfig
+  delete volume vol-1 (in-use)
+  warning: failed to list the deployments: timeout
+`, output.String())
+}
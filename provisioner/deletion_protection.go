@@ -0,0 +1,51 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+)
+
+const (
+	configKeyDeletionProtection = "deletion_protection"
+	// ConfigKeyDeletionProtectionOverride is the config item overriding the
+	// deletion protection of a cluster. It must be set to the ID of the
+	// cluster so it can't be copied to other clusters by accident.
+	ConfigKeyDeletionProtectionOverride = "deletion_protection_override"
+)
+
+var (
+	// ErrDeletionProtected is the error returned from provisioners when
+	// decommissioning a cluster protected from deletion.
+	ErrDeletionProtected = errors.New("cluster is protected from deletion")
+)
+
+// DeletionProtected returns true if the cluster is protected from deletion
+// with the deletion_protection config item and the protection isn't
+// overridden.
+func DeletionProtected(cluster *api.Cluster) bool {
+	if cluster.ConfigItems[configKeyDeletionProtection] != "true" {
+		return false
+	}
+	return cluster.ConfigItems[ConfigKeyDeletionProtectionOverride] != cluster.ID
+}
+
+// checkDecommission returns an error if the cluster must not be
+// decommissioned, either because it's protected from deletion or because its
+// lifecycle status is empty or unknown. Tearing down clusters with an
+// unexpected lifecycle status guards against registry bugs turning into the
+// loss of a cluster.
+func checkDecommission(cluster *api.Cluster) error {
+	switch cluster.LifecycleStatus {
+	case models.ClusterLifecycleStatusRequested, models.ClusterUpdateLifecycleStatusCreating, models.ClusterLifecycleStatusReady, models.ClusterLifecycleStatusDecommissionRequested:
+	default:
+		return fmt.Errorf("refusing to decommission cluster %s with lifecycle status '%s'", cluster.ID, cluster.LifecycleStatus)
+	}
+
+	if DeletionProtected(cluster) {
+		return ErrDeletionProtected
+	}
+	return nil
+}
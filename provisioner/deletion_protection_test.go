@@ -0,0 +1,32 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestCheckDecommission(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:              "aws:123456789012:eu-central-1:kube-1",
+		LifecycleStatus: "decommission-requested",
+		ConfigItems:     map[string]string{},
+	}
+	require.NoError(t, checkDecommission(cluster))
+
+	cluster.ConfigItems[configKeyDeletionProtection] = "true"
+	require.Equal(t, ErrDeletionProtected, checkDecommission(cluster))
+
+	// the override must match the cluster
+	cluster.ConfigItems[ConfigKeyDeletionProtectionOverride] = "aws:123456789012:eu-central-1:kube-2"
+	require.Equal(t, ErrDeletionProtected, checkDecommission(cluster))
+
+	cluster.ConfigItems[ConfigKeyDeletionProtectionOverride] = cluster.ID
+	require.NoError(t, checkDecommission(cluster))
+
+	for _, status := range []string{"", "decommissioned", "unknown"} {
+		cluster.LifecycleStatus = status
+		require.Error(t, checkDecommission(cluster), status)
+	}
+}
@@ -0,0 +1,446 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"golang.org/x/oauth2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	defaultDeletionWaitTimeout = 5 * time.Minute
+	deletionPollInterval       = 2 * time.Second
+)
+
+// validate checks that the resource to delete is identified either by name
+// or by label and field selectors and that the delete options are valid.
+func (r *resource) validate() error {
+	if r.Kind == "" {
+		return fmt.Errorf("'kind' must be specified")
+	}
+
+	if r.Name != "" && (len(r.Labels) > 0 || r.FieldSelector != "") {
+		return fmt.Errorf("only one of 'name' or 'labels'/'field_selector' must be specified")
+	}
+
+	if r.Name == "" && len(r.Labels) == 0 && r.FieldSelector == "" {
+		return fmt.Errorf("either name, labels or field_selector must be specified to identify a resource")
+	}
+
+	switch metav1.DeletionPropagation(r.PropagationPolicy) {
+	case "", metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan:
+	default:
+		return fmt.Errorf("invalid propagation_policy %s, must be one of Foreground, Background or Orphan", r.PropagationPolicy)
+	}
+
+	if r.GracePeriod != nil && *r.GracePeriod < 0 {
+		return fmt.Errorf("invalid grace_period %d, must not be negative", *r.GracePeriod)
+	}
+
+	if r.APIVersion != "" {
+		if strings.Contains(r.Kind, ".") {
+			return fmt.Errorf("'kind' must not be qualified by the API group if 'api_version' is specified")
+		}
+
+		_, err := schema.ParseGroupVersion(r.APIVersion)
+		if err != nil {
+			return fmt.Errorf("invalid api_version %s: %v", r.APIVersion, err)
+		}
+	}
+
+	if r.WaitTimeout != "" {
+		if !r.Wait {
+			return fmt.Errorf("'wait_timeout' requires 'wait'")
+		}
+
+		_, err := time.ParseDuration(r.WaitTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid wait_timeout %s: %v", r.WaitTimeout, err)
+		}
+	}
+
+	return nil
+}
+
+// waitTimeout returns how long to wait for the resources to be gone.
+func (r *resource) waitTimeout() time.Duration {
+	timeout, err := time.ParseDuration(r.WaitTimeout)
+	if err != nil {
+		return defaultDeletionWaitTimeout
+	}
+	return timeout
+}
+
+// labelSelector returns the label selector matching the labels of the
+// resource.
+func (r *resource) labelSelector() string {
+	return k8slabels.SelectorFromSet(k8slabels.Set(r.Labels)).String()
+}
+
+// selector returns the label and field selectors identifying the resources.
+func (r *resource) selector() string {
+	selectors := make([]string, 0, 2)
+	if len(r.Labels) > 0 {
+		selectors = append(selectors, r.labelSelector())
+	}
+	if r.FieldSelector != "" {
+		selectors = append(selectors, r.FieldSelector)
+	}
+	return strings.Join(selectors, ",")
+}
+
+// deleteOptions returns the options for deleting the resource.
+func (r *resource) deleteOptions() *metav1.DeleteOptions {
+	propagationPolicy := metav1.DeletePropagationBackground
+	if r.PropagationPolicy != "" {
+		propagationPolicy = metav1.DeletionPropagation(r.PropagationPolicy)
+	}
+
+	return &metav1.DeleteOptions{
+		PropagationPolicy:  &propagationPolicy,
+		GracePeriodSeconds: r.GracePeriod,
+	}
+}
+
+// resourceDiscoverer is the part of the discovery client used to find the API
+// resource of a kind.
+type resourceDiscoverer interface {
+	ServerGroups() (*metav1.APIGroupList, error)
+	ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error)
+}
+
+// resourceClient is the part of the dynamic client used to delete resources.
+type resourceClient interface {
+	Get(name string) (*unstructured.Unstructured, error)
+	List(opts metav1.ListOptions) (runtime.Object, error)
+	Delete(name string, opts *metav1.DeleteOptions) error
+}
+
+// apiResource is an API resource and the group version serving it.
+type apiResource struct {
+	groupVersion schema.GroupVersion
+	resource     metav1.APIResource
+}
+
+// resourceDeleter deletes resources of any kind with the dynamic client.
+type resourceDeleter struct {
+	discovery resourceDiscoverer
+	// client returns a client for the resource in the namespace.
+	client       func(resource *apiResource, namespace string) (resourceClient, error)
+	resources    map[string]*apiResource
+	pollInterval time.Duration
+}
+
+// newResourceDeleter initializes a resourceDeleter for the API server
+// described by config.
+func newResourceDeleter(config *rest.Config) (*resourceDeleter, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make(map[schema.GroupVersion]*dynamic.Client)
+
+	return &resourceDeleter{
+		discovery: discoveryClient,
+		client: func(resource *apiResource, namespace string) (resourceClient, error) {
+			client, ok := clients[resource.groupVersion]
+			if !ok {
+				groupConfig := *config
+				groupConfig.GroupVersion = &resource.groupVersion
+				groupConfig.APIPath = "/apis"
+				if resource.groupVersion.Group == "" {
+					groupConfig.APIPath = "/api"
+				}
+
+				client, err = dynamic.NewClient(&groupConfig)
+				if err != nil {
+					return nil, err
+				}
+				clients[resource.groupVersion] = client
+			}
+
+			if !resource.resource.Namespaced {
+				namespace = ""
+			}
+			return client.Resource(&resource.resource, namespace), nil
+		},
+		resources:    make(map[string]*apiResource),
+		pollInterval: deletionPollInterval,
+	}, nil
+}
+
+// matchesKind returns true if the kind refers to the API resource. Like with
+// kubectl the kind can be given as the kind, e.g. Deployment, the resource
+// name, e.g. deployments, or one of the short names discovered for the
+// resource, e.g. deploy, case insensitive.
+func matchesKind(resource metav1.APIResource, kind string) bool {
+	// skip subresources, e.g. deployments/scale
+	if strings.Contains(resource.Name, "/") {
+		return false
+	}
+
+	if strings.EqualFold(resource.Name, kind) || strings.EqualFold(resource.Kind, kind) {
+		return true
+	}
+
+	for _, shortName := range resource.ShortNames {
+		if strings.EqualFold(shortName, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// findResource returns the API resource of the kind. If apiVersion is set
+// the kind is looked up in that group version, otherwise in the preferred
+// version of the groups. The kind can be qualified by its group, e.g.
+// deployments.extensions, to distinguish kinds served by several groups. nil
+// is returned if the group version doesn't exist, e.g. because the custom
+// resource definition was already deleted.
+func (d *resourceDeleter) findResource(kind, apiVersion string) (*apiResource, error) {
+	key := kind + "@" + apiVersion
+	if resource, ok := d.resources[key]; ok {
+		return resource, nil
+	}
+
+	if apiVersion != "" {
+		resource, err := d.findResourceInGroupVersion(kind, apiVersion)
+		if err != nil {
+			return nil, err
+		}
+		d.resources[key] = resource
+		return resource, nil
+	}
+
+	name, group := kind, ""
+	qualified := false
+	if i := strings.Index(kind, "."); i > 0 {
+		name, group = kind[:i], kind[i+1:]
+		qualified = true
+	}
+
+	groups, err := d.discovery.ServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover API groups: %v", err)
+	}
+
+	for _, apiGroup := range groups.Groups {
+		if qualified && apiGroup.Name != group {
+			continue
+		}
+
+		groupVersion := apiGroup.PreferredVersion.GroupVersion
+		resources, err := d.discovery.ServerResourcesForGroupVersion(groupVersion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover API resources of %s: %v", groupVersion, err)
+		}
+
+		gv, err := schema.ParseGroupVersion(groupVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, resource := range resources.APIResources {
+			if matchesKind(resource, name) {
+				found := &apiResource{groupVersion: gv, resource: resource}
+				d.resources[key] = found
+				return found, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("the server doesn't have a resource type %s", kind)
+}
+
+// findResourceInGroupVersion returns the API resource of the kind served by
+// the group version or nil if the group version doesn't exist.
+func (d *resourceDeleter) findResourceInGroupVersion(kind, apiVersion string) (*apiResource, error) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := d.discovery.ServerResourcesForGroupVersion(apiVersion)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to discover API resources of %s: %v", apiVersion, err)
+	}
+
+	for _, resource := range resources.APIResources {
+		if matchesKind(resource, kind) {
+			return &apiResource{groupVersion: gv, resource: resource}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("the server doesn't have a resource type %s in %s", kind, apiVersion)
+}
+
+// delete deletes the resources identified by the deletion and returns the
+// names of the deleted resources. Resources which don't exist are ignored.
+func (d *resourceDeleter) delete(deletion *resource) ([]string, error) {
+	apiResource, err := d.findResource(deletion.Kind, deletion.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// without the API there are no resources to delete
+	if apiResource == nil {
+		return nil, nil
+	}
+
+	client, err := d.client(apiResource, deletion.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{deletion.Name}
+	if deletion.Name == "" {
+		names, err = listNames(client, metav1.ListOptions{
+			LabelSelector: deletion.labelSelector(),
+			FieldSelector: deletion.FieldSelector,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	deleted := make([]string, 0, len(names))
+	for _, name := range names {
+		err := client.Delete(name, deletion.deleteOptions())
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return deleted, fmt.Errorf("failed to delete %s %s: %v", deletion.Kind, name, err)
+		}
+		deleted = append(deleted, name)
+	}
+
+	if deletion.Wait {
+		err = d.waitForDeletion(client, deleted, deletion.waitTimeout())
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete %s: %v", deletion.Kind, err)
+		}
+	}
+
+	return deleted, nil
+}
+
+// waitForDeletion waits until the named resources are gone or the timeout
+// expires.
+func (d *resourceDeleter) waitForDeletion(client resourceClient, names []string, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for _, name := range names {
+		for {
+			_, err := client.Get(name)
+			if apierrors.IsNotFound(err) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			select {
+			case <-time.After(d.pollInterval):
+			case <-deadline:
+				return fmt.Errorf("timed out after %s waiting for %s to be deleted", timeout, name)
+			}
+		}
+	}
+	return nil
+}
+
+// listNames returns the names of the resources matching the list options.
+func listNames(client resourceClient, opts metav1.ListOptions) ([]string, error) {
+	list, err := client.List(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, accessor.GetName())
+	}
+
+	return names, nil
+}
+
+// Deletions deletes the provided kubernetes resources with the dynamic
+// client. Resources which have already been deleted are ignored. Deleted
+// resources are recorded in the audit log. In dry-run mode the deletions are
+// only logged.
+func (p *clusterpyProvisioner) Deletions(logger *log.Entry, cluster *api.Cluster, tokenSource oauth2.TokenSource, deletions []*resource, auditLog *audit.Log, dryRun bool) error {
+	if len(deletions) == 0 {
+		return nil
+	}
+
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return err
+	}
+
+	deleter, err := newResourceDeleter(kubernetes.NewConfigWithTokenSource(cluster.APIServerURL, tokenSource, transport))
+	if err != nil {
+		return err
+	}
+
+	return deleteResources(logger, deleter, deletions, auditLog, dryRun)
+}
+
+// deleteResources deletes the resources with the deleter, stopping at the
+// first failure. In dry-run mode nothing is deleted.
+func deleteResources(logger *log.Entry, deleter *resourceDeleter, deletions []*resource, auditLog *audit.Log, dryRun bool) error {
+	for _, deletion := range deletions {
+		if dryRun {
+			name := deletion.Name
+			if name == "" {
+				name = deletion.selector()
+			}
+			logger.Infof("Dry-run: would delete %s %s/%s", deletion.Kind, deletion.Namespace, name)
+			continue
+		}
+
+		deleted, err := deleter.delete(deletion)
+		for _, name := range deleted {
+			logger.Infof("Deleted %s %s/%s", deletion.Kind, deletion.Namespace, name)
+			auditLog.Record(audit.KindKubernetes, "delete", kubernetesResourceName(deletion.Kind, deletion.Namespace, name), nil)
+		}
+		if err != nil {
+			name := deletion.Name
+			if name == "" {
+				name = deletion.selector()
+			}
+			auditLog.Record(audit.KindKubernetes, "delete", kubernetesResourceName(deletion.Kind, deletion.Namespace, name), err)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,305 @@
+package provisioner
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+type mockDiscoverer struct {
+	resources map[string][]metav1.APIResource
+}
+
+func (d *mockDiscoverer) ServerGroups() (*metav1.APIGroupList, error) {
+	return &metav1.APIGroupList{
+		Groups: []metav1.APIGroup{
+			{Name: "", PreferredVersion: metav1.GroupVersionForDiscovery{GroupVersion: "v1"}},
+			{Name: "extensions", PreferredVersion: metav1.GroupVersionForDiscovery{GroupVersion: "extensions/v1beta1"}},
+			{Name: "apps", PreferredVersion: metav1.GroupVersionForDiscovery{GroupVersion: "apps/v1beta1"}},
+		},
+	}, nil
+}
+
+func (d *mockDiscoverer) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	resources, ok := d.resources[groupVersion]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{}, groupVersion)
+	}
+	return &metav1.APIResourceList{GroupVersion: groupVersion, APIResources: resources}, nil
+}
+
+type mockResourceClient struct {
+	namespace string
+	existing  []string
+	listOpts  metav1.ListOptions
+	deleted   map[string]*metav1.DeleteOptions
+	failing   string
+	// terminating is the number of times deleted resources are still
+	// returned by Get.
+	terminating int
+}
+
+func (c *mockResourceClient) Get(name string) (*unstructured.Unstructured, error) {
+	if _, ok := c.deleted[name]; ok && c.terminating > 0 {
+		c.terminating--
+		item := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		item.SetName(name)
+		return item, nil
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{}, name)
+}
+
+func (c *mockResourceClient) List(opts metav1.ListOptions) (runtime.Object, error) {
+	c.listOpts = opts
+
+	list := &v1.ConfigMapList{}
+	for _, name := range c.existing {
+		list.Items = append(list.Items, v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	return list, nil
+}
+
+func (c *mockResourceClient) Delete(name string, opts *metav1.DeleteOptions) error {
+	if name == c.failing {
+		return fmt.Errorf("failed")
+	}
+
+	for _, existing := range c.existing {
+		if existing == name {
+			c.deleted[name] = opts
+			return nil
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{Resource: "deployments"}, name)
+}
+
+func newMockResourceDeleter(client *mockResourceClient) (*resourceDeleter, *apiResource) {
+	var used apiResource
+	deleter := &resourceDeleter{
+		discovery: &mockDiscoverer{
+			resources: map[string][]metav1.APIResource{
+				"v1": {
+					{Name: "namespaces", Kind: "Namespace", ShortNames: []string{"ns"}},
+					{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, ShortNames: []string{"cm"}},
+				},
+				"extensions/v1beta1": {
+					{Name: "deployments", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}},
+					{Name: "deployments/scale", Kind: "Scale", Namespaced: true},
+				},
+				"apps/v1beta1": {
+					{Name: "deployments", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}},
+				},
+				"zalando.org/v1": {
+					{Name: "stacksets", Kind: "StackSet", Namespaced: true},
+				},
+			},
+		},
+		client: func(resource *apiResource, namespace string) (resourceClient, error) {
+			used = *resource
+			client.namespace = namespace
+			return client, nil
+		},
+		resources:    make(map[string]*apiResource),
+		pollInterval: time.Millisecond,
+	}
+	return deleter, &used
+}
+
+func TestResourceDeleterFindResource(t *testing.T) {
+	deleter, _ := newMockResourceDeleter(nil)
+
+	for _, tc := range []struct {
+		kind         string
+		apiVersion   string
+		groupVersion string
+		resource     string
+	}{
+		{kind: "deployment", groupVersion: "extensions/v1beta1", resource: "deployments"},
+		{kind: "Deployment", groupVersion: "extensions/v1beta1", resource: "deployments"},
+		{kind: "deployments", groupVersion: "extensions/v1beta1", resource: "deployments"},
+		{kind: "deployments.apps", groupVersion: "apps/v1beta1", resource: "deployments"},
+		{kind: "deploy", groupVersion: "extensions/v1beta1", resource: "deployments"},
+		{kind: "deploy.apps", groupVersion: "apps/v1beta1", resource: "deployments"},
+		{kind: "deploy", apiVersion: "apps/v1beta1", groupVersion: "apps/v1beta1", resource: "deployments"},
+		{kind: "cm", groupVersion: "v1", resource: "configmaps"},
+		{kind: "NS", groupVersion: "v1", resource: "namespaces"},
+		{kind: "deployment", apiVersion: "apps/v1beta1", groupVersion: "apps/v1beta1", resource: "deployments"},
+		{kind: "StackSet", apiVersion: "zalando.org/v1", groupVersion: "zalando.org/v1", resource: "stacksets"},
+		{kind: "configmap", groupVersion: "v1", resource: "configmaps"},
+		{kind: "Namespace", groupVersion: "v1", resource: "namespaces"},
+	} {
+		t.Run(tc.kind+"@"+tc.apiVersion, func(t *testing.T) {
+			resource, err := deleter.findResource(tc.kind, tc.apiVersion)
+			require.NoError(t, err)
+			require.Equal(t, tc.groupVersion, resource.groupVersion.String())
+			require.Equal(t, tc.resource, resource.resource.Name)
+		})
+	}
+
+	_, err := deleter.findResource("scale", "")
+	require.Error(t, err)
+
+	_, err = deleter.findResource("dep", "")
+	require.Error(t, err)
+
+	_, err = deleter.findResource("deployments.batch", "")
+	require.Error(t, err)
+
+	_, err = deleter.findResource("StackSet", "v1")
+	require.Error(t, err)
+
+	// group versions which don't exist have no resources
+	resource, err := deleter.findResource("StackSet", "zalando.org/v2")
+	require.NoError(t, err)
+	require.Nil(t, resource)
+}
+
+func TestResourceDeleterDelete(t *testing.T) {
+	client := &mockResourceClient{
+		existing: []string{"mate", "external-dns"},
+		deleted:  make(map[string]*metav1.DeleteOptions),
+	}
+	deleter, used := newMockResourceDeleter(client)
+
+	// by name
+	deleted, err := deleter.delete(&resource{Kind: "deployment", Namespace: "kube-system", Name: "mate"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"mate"}, deleted)
+	require.Equal(t, "kube-system", client.namespace)
+	require.Equal(t, metav1.DeletePropagationBackground, *client.deleted["mate"].PropagationPolicy)
+	require.Nil(t, client.deleted["mate"].GracePeriodSeconds)
+
+	// resources which don't exist are ignored
+	deleted, err = deleter.delete(&resource{Kind: "deployment", Namespace: "kube-system", Name: "secretary"})
+	require.NoError(t, err)
+	require.Empty(t, deleted)
+
+	// by selectors with delete options
+	gracePeriod := int64(0)
+	deleted, err = deleter.delete(&resource{
+		Kind:              "deployment",
+		Namespace:         "kube-system",
+		Labels:            labels{"application": "external-dns"},
+		FieldSelector:     "metadata.name!=mate",
+		PropagationPolicy: "Foreground",
+		GracePeriod:       &gracePeriod,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"mate", "external-dns"}, deleted)
+	require.Equal(t, "application=external-dns", client.listOpts.LabelSelector)
+	require.Equal(t, "metadata.name!=mate", client.listOpts.FieldSelector)
+	require.Equal(t, metav1.DeletePropagationForeground, *client.deleted["external-dns"].PropagationPolicy)
+	require.Equal(t, int64(0), *client.deleted["external-dns"].GracePeriodSeconds)
+
+	// cluster scoped resources ignore the namespace
+	_, err = deleter.delete(&resource{Kind: "namespace", Namespace: "kube-system", Name: "mate"})
+	require.NoError(t, err)
+	require.Equal(t, "namespaces", used.resource.Name)
+
+	// failures
+	client.failing = "mate"
+	auditLog := audit.NewLog("cluster", "provision")
+	err = deleteResources(log.WithField("cluster", "foobar"), deleter, []*resource{
+		{Kind: "deployment", Namespace: "kube-system", Name: "external-dns"},
+		{Kind: "deployment", Namespace: "kube-system", Name: "mate"},
+		{Kind: "deployment", Namespace: "kube-system", Name: "secretary"},
+	}, auditLog, false)
+	require.Error(t, err)
+
+	_, err = deleter.delete(&resource{Kind: "unknown", Name: "mate"})
+	require.Error(t, err)
+
+	// custom resources of removed custom resource definitions are gone
+	deleted, err = deleter.delete(&resource{Kind: "StackSet", APIVersion: "zalando.org/v2", Name: "mate"})
+	require.NoError(t, err)
+	require.Empty(t, deleted)
+}
+
+func TestDeleteResourcesDryRun(t *testing.T) {
+	client := &mockResourceClient{
+		existing: []string{"mate", "external-dns"},
+		deleted:  make(map[string]*metav1.DeleteOptions),
+	}
+	deleter, _ := newMockResourceDeleter(client)
+
+	auditLog := audit.NewLog("cluster", "provision")
+	err := deleteResources(log.WithField("cluster", "foobar"), deleter, []*resource{
+		{Kind: "deployment", Namespace: "kube-system", Name: "mate"},
+		{Kind: "deployment", Namespace: "kube-system", Labels: labels{"application": "external-dns"}},
+	}, auditLog, true)
+	require.NoError(t, err)
+	require.Empty(t, client.deleted)
+	require.Empty(t, auditLog.Entries)
+}
+
+func TestResourceDeleterWait(t *testing.T) {
+	client := &mockResourceClient{
+		existing:    []string{"kube-system", "visibility"},
+		deleted:     make(map[string]*metav1.DeleteOptions),
+		terminating: 3,
+	}
+	deleter, _ := newMockResourceDeleter(client)
+
+	deleted, err := deleter.delete(&resource{Kind: "namespace", Name: "visibility", Wait: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"visibility"}, deleted)
+	require.Equal(t, 0, client.terminating)
+
+	client.terminating = 1000
+	_, err = deleter.delete(&resource{Kind: "namespace", Name: "kube-system", Wait: true, WaitTimeout: "10ms"})
+	require.Error(t, err)
+}
+
+func TestResourceSelector(t *testing.T) {
+	deletion := &resource{Kind: "pod", Labels: labels{"component": "dns", "application": "mate"}}
+	require.Equal(t, "application=mate,component=dns", deletion.selector())
+
+	deletion.FieldSelector = "status.phase=Succeeded"
+	require.Equal(t, "application=mate,component=dns,status.phase=Succeeded", deletion.selector())
+}
+
+func TestResourceValidate(t *testing.T) {
+	gracePeriod := int64(-1)
+	for _, tc := range []struct {
+		msg      string
+		resource *resource
+		valid    bool
+	}{
+		{msg: "name", resource: &resource{Kind: "deployment", Name: "mate"}, valid: true},
+		{msg: "labels", resource: &resource{Kind: "deployment", Labels: labels{"application": "mate"}}, valid: true},
+		{msg: "field selector", resource: &resource{Kind: "pod", FieldSelector: "status.phase=Succeeded"}, valid: true},
+		{msg: "labels and field selector", resource: &resource{Kind: "pod", Labels: labels{"application": "mate"}, FieldSelector: "status.phase=Succeeded"}, valid: true},
+		{msg: "propagation policy", resource: &resource{Kind: "deployment", Name: "mate", PropagationPolicy: "Orphan"}, valid: true},
+		{msg: "no kind", resource: &resource{Name: "mate"}},
+		{msg: "name and labels", resource: &resource{Kind: "deployment", Name: "mate", Labels: labels{"application": "mate"}}},
+		{msg: "name and field selector", resource: &resource{Kind: "deployment", Name: "mate", FieldSelector: "metadata.name=mate"}},
+		{msg: "nothing", resource: &resource{Kind: "deployment"}},
+		{msg: "invalid propagation policy", resource: &resource{Kind: "deployment", Name: "mate", PropagationPolicy: "Cascade"}},
+		{msg: "negative grace period", resource: &resource{Kind: "deployment", Name: "mate", GracePeriod: &gracePeriod}},
+		{msg: "api version", resource: &resource{Kind: "StackSet", APIVersion: "zalando.org/v1", Name: "mate"}, valid: true},
+		{msg: "qualified kind and api version", resource: &resource{Kind: "stacksets.zalando.org", APIVersion: "zalando.org/v1", Name: "mate"}},
+		{msg: "invalid api version", resource: &resource{Kind: "StackSet", APIVersion: "zalando.org/v1/stacksets", Name: "mate"}},
+		{msg: "wait", resource: &resource{Kind: "namespace", Name: "mate", Wait: true, WaitTimeout: "10m"}, valid: true},
+		{msg: "wait timeout without wait", resource: &resource{Kind: "namespace", Name: "mate", WaitTimeout: "10m"}},
+		{msg: "invalid wait timeout", resource: &resource{Kind: "namespace", Name: "mate", Wait: true, WaitTimeout: "10"}},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := tc.resource.validate()
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
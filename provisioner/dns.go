@@ -0,0 +1,259 @@
+package provisioner
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+)
+
+const (
+	configKeyAPIServerDNS        = "api_server_dns"
+	configKeyAPIServerExtraNames = "api_server_extra_names"
+	// apiServerLoadBalancerOutput is the output of the cluster stack
+	// containing the name of the load balancer of the API server.
+	apiServerLoadBalancerOutput = "APIServerLoadBalancer"
+)
+
+// route53API is a minimal interface containing only the methods we use from
+// the Route53 API.
+type route53API interface {
+	ListHostedZonesByName(input *route53.ListHostedZonesByNameInput) (*route53.ListHostedZonesByNameOutput, error)
+	ListResourceRecordSets(input *route53.ListResourceRecordSetsInput) (*route53.ListResourceRecordSetsOutput, error)
+	ChangeResourceRecordSets(input *route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error)
+}
+
+// elbAPI is a minimal interface containing only the methods we use from the
+// ELB API.
+type elbAPI interface {
+	DescribeLoadBalancers(input *elb.DescribeLoadBalancersInput) (*elb.DescribeLoadBalancersOutput, error)
+	DescribeInstanceHealth(input *elb.DescribeInstanceHealthInput) (*elb.DescribeInstanceHealthOutput, error)
+}
+
+// apiServerDNSEnabled returns true if the DNS records of the API server are
+// managed by the CLM.
+func apiServerDNSEnabled(cluster *api.Cluster) bool {
+	return cluster.ConfigItems[configKeyAPIServerDNS] == "true"
+}
+
+// apiServerNames returns the DNS names of the API server, the host of the API
+// server URL followed by the names configured with the
+// api_server_extra_names config item. The function is available in the
+// templates, e.g. for adding the names as SANs to the API server
+// certificate.
+func apiServerNames(cluster *api.Cluster) ([]string, error) {
+	u, err := url.Parse(cluster.APIServerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("can't derive the API server name from URL %s", cluster.APIServerURL)
+	}
+
+	names := []string{u.Hostname()}
+	for _, name := range strings.Split(cluster.ConfigItems[configKeyAPIServerExtraNames], ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// dnsName returns the fully qualified form of the name as used by Route53.
+func dnsName(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
+
+// hostedZoneID returns the ID of the public hosted zone of the name's parent
+// domain.
+func (a *awsAdapter) hostedZoneID(name string) (string, error) {
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("can't derive hosted zone from name %s", name)
+	}
+	zone := dnsName(parts[1])
+
+	resp, err := a.route53Client.ListHostedZonesByName(&route53.ListHostedZonesByNameInput{
+		DNSName: aws.String(zone),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, hostedZone := range resp.HostedZones {
+		if aws.StringValue(hostedZone.Name) != zone {
+			continue
+		}
+		if hostedZone.Config != nil && aws.BoolValue(hostedZone.Config.PrivateZone) {
+			continue
+		}
+		return aws.StringValue(hostedZone.Id), nil
+	}
+	return "", fmt.Errorf("no public hosted zone %s found", zone)
+}
+
+// apiServerLoadBalancer returns the load balancer of the API server
+// referenced by the APIServerLoadBalancer output of the cluster stack.
+func (a *awsAdapter) apiServerLoadBalancer(stackName string) (*elb.LoadBalancerDescription, error) {
+	stack, err := a.getStackByName(stackName)
+	if err != nil {
+		return nil, err
+	}
+
+	var name string
+	for _, output := range stack.Outputs {
+		if aws.StringValue(output.OutputKey) == apiServerLoadBalancerOutput {
+			name = aws.StringValue(output.OutputValue)
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("stack %s has no %s output", stackName, apiServerLoadBalancerOutput)
+	}
+
+	resp, err := a.elbClient.DescribeLoadBalancers(&elb.DescribeLoadBalancersInput{
+		LoadBalancerNames: []*string{aws.String(name)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.LoadBalancerDescriptions) != 1 {
+		return nil, fmt.Errorf("load balancer %s of stack %s not found", name, stackName)
+	}
+	return resp.LoadBalancerDescriptions[0], nil
+}
+
+// aliasRecord returns the A record of the name if it exists.
+func (a *awsAdapter) aliasRecord(hostedZoneID, name string) (*route53.ResourceRecordSet, error) {
+	resp, err := a.route53Client.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(hostedZoneID),
+		StartRecordName: aws.String(dnsName(name)),
+		StartRecordType: aws.String(route53.RRTypeA),
+		MaxItems:        aws.String("1"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range resp.ResourceRecordSets {
+		if aws.StringValue(record.Name) == dnsName(name) && aws.StringValue(record.Type) == route53.RRTypeA {
+			return record, nil
+		}
+	}
+	return nil, nil
+}
+
+// changeRecord applies a single change to the records of the hosted zone.
+func (a *awsAdapter) changeRecord(hostedZoneID, action string, record *route53.ResourceRecordSet) error {
+	_, err := a.route53Client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Comment: aws.String("managed by the Cluster Lifecycle Manager"),
+			Changes: []*route53.Change{
+				{
+					Action:            aws.String(action),
+					ResourceRecordSet: record,
+				},
+			},
+		},
+	})
+	a.audit.Record(audit.KindAWS, strings.ToLower(action)+"-record", aws.StringValue(record.Name), err)
+	return err
+}
+
+// ensureAPIServerDNS creates or updates the alias records pointing the names
+// of the API server to the load balancer of the API server. Records already
+// pointing to the load balancer aren't changed.
+func (a *awsAdapter) ensureAPIServerDNS(cluster *api.Cluster) error {
+	names, err := apiServerNames(cluster)
+	if err != nil {
+		return err
+	}
+
+	loadBalancer, err := a.apiServerLoadBalancer(cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
+	target := &route53.AliasTarget{
+		DNSName:              aws.String(dnsName(aws.StringValue(loadBalancer.DNSName))),
+		HostedZoneId:         loadBalancer.CanonicalHostedZoneNameID,
+		EvaluateTargetHealth: aws.Bool(false),
+	}
+
+	for _, name := range names {
+		hostedZoneID, err := a.hostedZoneID(name)
+		if err != nil {
+			return err
+		}
+
+		record, err := a.aliasRecord(hostedZoneID, name)
+		if err != nil {
+			return err
+		}
+
+		if record != nil && record.AliasTarget != nil &&
+			strings.EqualFold(aws.StringValue(record.AliasTarget.DNSName), aws.StringValue(target.DNSName)) {
+			continue
+		}
+
+		if a.dryRun {
+			a.logger.Infof("Dry-run: would point %s to %s", name, aws.StringValue(target.DNSName))
+			continue
+		}
+
+		a.logger.Infof("Pointing %s to %s", name, aws.StringValue(target.DNSName))
+		err = a.changeRecord(hostedZoneID, route53.ChangeActionUpsert, &route53.ResourceRecordSet{
+			Name:        aws.String(dnsName(name)),
+			Type:        aws.String(route53.RRTypeA),
+			AliasTarget: target,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update record %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// deleteAPIServerDNS deletes the records of the names of the API server.
+func (a *awsAdapter) deleteAPIServerDNS(cluster *api.Cluster) error {
+	names, err := apiServerNames(cluster)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		hostedZoneID, err := a.hostedZoneID(name)
+		if err != nil {
+			return err
+		}
+
+		record, err := a.aliasRecord(hostedZoneID, name)
+		if err != nil {
+			return err
+		}
+
+		if record == nil {
+			continue
+		}
+
+		if a.dryRun {
+			a.logger.Infof("Dry-run: would delete record %s", name)
+			continue
+		}
+
+		a.logger.Infof("Deleting record %s", name)
+		err = a.changeRecord(hostedZoneID, route53.ChangeActionDelete, record)
+		if err != nil {
+			return fmt.Errorf("failed to delete record %s: %v", name, err)
+		}
+	}
+	return nil
+}
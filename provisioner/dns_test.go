@@ -0,0 +1,119 @@
+package provisioner
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type route53APIStub struct {
+	zones   []*route53.HostedZone
+	records map[string]*route53.ResourceRecordSet
+	changes int
+}
+
+func (r *route53APIStub) ListHostedZonesByName(input *route53.ListHostedZonesByNameInput) (*route53.ListHostedZonesByNameOutput, error) {
+	return &route53.ListHostedZonesByNameOutput{HostedZones: r.zones}, nil
+}
+
+func (r *route53APIStub) ListResourceRecordSets(input *route53.ListResourceRecordSetsInput) (*route53.ListResourceRecordSetsOutput, error) {
+	var records []*route53.ResourceRecordSet
+	if record, ok := r.records[aws.StringValue(input.StartRecordName)]; ok {
+		records = append(records, record)
+	}
+	return &route53.ListResourceRecordSetsOutput{ResourceRecordSets: records}, nil
+}
+
+func (r *route53APIStub) ChangeResourceRecordSets(input *route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error) {
+	r.changes++
+	for _, change := range input.ChangeBatch.Changes {
+		name := aws.StringValue(change.ResourceRecordSet.Name)
+		switch aws.StringValue(change.Action) {
+		case route53.ChangeActionUpsert:
+			r.records[name] = change.ResourceRecordSet
+		case route53.ChangeActionDelete:
+			delete(r.records, name)
+		}
+	}
+	return &route53.ChangeResourceRecordSetsOutput{}, nil
+}
+
+type elbAPIStub struct {
+	elbAPI
+}
+
+func (e *elbAPIStub) DescribeLoadBalancers(input *elb.DescribeLoadBalancersInput) (*elb.DescribeLoadBalancersOutput, error) {
+	return &elb.DescribeLoadBalancersOutput{
+		LoadBalancerDescriptions: []*elb.LoadBalancerDescription{
+			{
+				LoadBalancerName:          input.LoadBalancerNames[0],
+				DNSName:                   aws.String("kube-1-api.eu-central-1.elb.amazonaws.com"),
+				CanonicalHostedZoneNameID: aws.String("Z215JYRZR1TBD5"),
+			},
+		},
+	}, nil
+}
+
+func TestAPIServerNames(t *testing.T) {
+	cluster := &api.Cluster{
+		APIServerURL: "https://kube-1.example.org",
+		ConfigItems:  map[string]string{configKeyAPIServerExtraNames: "kube-1.example.com, api.example.org"},
+	}
+
+	names, err := apiServerNames(cluster)
+	require.NoError(t, err)
+	require.Equal(t, []string{"kube-1.example.org", "kube-1.example.com", "api.example.org"}, names)
+
+	_, err = apiServerNames(&api.Cluster{APIServerURL: "kube-1"})
+	require.Error(t, err)
+}
+
+func TestAPIServerDNS(t *testing.T) {
+	route53Client := &route53APIStub{
+		zones: []*route53.HostedZone{
+			{Id: aws.String("/hostedzone/private"), Name: aws.String("example.org."), Config: &route53.HostedZoneConfig{PrivateZone: aws.Bool(true)}},
+			{Id: aws.String("/hostedzone/public"), Name: aws.String("example.org.")},
+		},
+		records: make(map[string]*route53.ResourceRecordSet),
+	}
+	adapter := &awsAdapter{
+		cloudformationClient: &cloudFormationAPIStub{
+			statusMutex: &sync.Mutex{},
+			status:      aws.String(cloudformation.StackStatusCreateComplete),
+			outputs: []*cloudformation.Output{
+				{OutputKey: aws.String(apiServerLoadBalancerOutput), OutputValue: aws.String("kube-1-api")},
+			},
+		},
+		route53Client: route53Client,
+		elbClient:     &elbAPIStub{},
+		logger:        log.WithField("test", true),
+	}
+	cluster := &api.Cluster{
+		LocalID:      "kube-1",
+		APIServerURL: "https://kube-1.example.org",
+		ConfigItems:  map[string]string{},
+	}
+
+	require.NoError(t, adapter.ensureAPIServerDNS(cluster))
+	record := route53Client.records["kube-1.example.org."]
+	require.NotNil(t, record)
+	require.Equal(t, "kube-1-api.eu-central-1.elb.amazonaws.com.", aws.StringValue(record.AliasTarget.DNSName))
+	require.Equal(t, "Z215JYRZR1TBD5", aws.StringValue(record.AliasTarget.HostedZoneId))
+
+	// records pointing to the load balancer aren't changed
+	require.NoError(t, adapter.ensureAPIServerDNS(cluster))
+	require.Equal(t, 1, route53Client.changes)
+
+	require.NoError(t, adapter.deleteAPIServerDNS(cluster))
+	require.Empty(t, route53Client.records)
+
+	require.NoError(t, adapter.deleteAPIServerDNS(cluster))
+	require.Equal(t, 2, route53Client.changes)
+}
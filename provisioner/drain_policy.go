@@ -0,0 +1,74 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const (
+	configKeyDrainFirstNamespaces = "drain_first_namespaces"
+	configKeyDrainGracePeriods    = "drain_grace_periods"
+	configKeyDrainStuckFinalizers = "drain_stuck_finalizers"
+)
+
+// drainPolicy returns the drain policy of the cluster. drain_first_namespaces
+// is a comma separated list of the namespaces whose pods are evicted first,
+// drain_grace_periods a comma separated list of <namespace>=<duration>
+// overriding the termination grace period of the pods of a namespace and
+// drain_stuck_finalizers a comma separated list of the finalizers removed
+// from pods stuck after force deleting them.
+func drainPolicy(cluster *api.Cluster) (*updatestrategy.DrainPolicy, error) {
+	policy := &updatestrategy.DrainPolicy{
+		FirstNamespaces: configItemList(cluster, configKeyDrainFirstNamespaces),
+		StuckFinalizers: configItemList(cluster, configKeyDrainStuckFinalizers),
+	}
+
+	for _, item := range strings.Split(cluster.ConfigItems[configKeyDrainGracePeriods], ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid value for %s: %s", configKeyDrainGracePeriods, item)
+		}
+
+		gracePeriod, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || gracePeriod < 0 {
+			return nil, fmt.Errorf("invalid value for %s: %s", configKeyDrainGracePeriods, item)
+		}
+
+		if policy.GracePeriods == nil {
+			policy.GracePeriods = make(map[string]time.Duration)
+		}
+		policy.GracePeriods[strings.TrimSpace(parts[0])] = gracePeriod
+	}
+
+	return policy, nil
+}
+
+// configItemList returns the elements of a comma separated config item.
+func configItemList(cluster *api.Cluster, key string) []string {
+	var result []string
+	for _, element := range strings.Split(cluster.ConfigItems[key], ",") {
+		element = strings.TrimSpace(element)
+		if element != "" {
+			result = append(result, element)
+		}
+	}
+	return result
+}
+
+// recordForceDeletedPods records the pods force deleted while draining the
+// nodes of the cluster in its status, also if provisioning failed.
+func recordForceDeletedPods(cluster *api.Cluster, nodePoolManager updatestrategy.NodePoolManager) {
+	if cluster.Status == nil {
+		cluster.Status = &api.ClusterStatus{}
+	}
+	cluster.Status.ForceDeletedPods = nodePoolManager.ForceDeletedPods()
+}
@@ -0,0 +1,31 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestDrainPolicy(t *testing.T) {
+	policy, err := drainPolicy(&api.Cluster{ConfigItems: map[string]string{}})
+	require.NoError(t, err)
+	require.Empty(t, policy.FirstNamespaces)
+	require.Empty(t, policy.GracePeriods)
+
+	policy, err = drainPolicy(&api.Cluster{ConfigItems: map[string]string{
+		configKeyDrainFirstNamespaces: "batch, spark",
+		configKeyDrainGracePeriods:    "batch=30s, monitoring=5m",
+		configKeyDrainStuckFinalizers: "example.org/volume-cleanup",
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"batch", "spark"}, policy.FirstNamespaces)
+	require.Equal(t, []string{"example.org/volume-cleanup"}, policy.StuckFinalizers)
+	require.Equal(t, map[string]time.Duration{"batch": 30 * time.Second, "monitoring": 5 * time.Minute}, policy.GracePeriods)
+
+	for _, value := range []string{"batch", "=30s", "batch=forever", "batch=-1s"} {
+		_, err = drainPolicy(&api.Cluster{ConfigItems: map[string]string{configKeyDrainGracePeriods: value}})
+		require.Error(t, err, value)
+	}
+}
@@ -0,0 +1,174 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	configKeyStackDriftAction = "stack_drift_action"
+	configKeyForceStackDrift  = "force_stack_drift"
+	stackDriftActionIgnore    = "ignore"
+	stackDriftActionWarn      = "warn"
+	stackDriftActionFail      = "fail"
+	driftDetectionTimeout     = 5 * time.Minute
+)
+
+// driftDetectionPollInterval is the interval between checking the status of
+// a drift detection. It's defined as a variable so it can be changed in
+// tests.
+var driftDetectionPollInterval = 5 * time.Second
+
+// detectStackDrift runs a drift detection on the stack and returns the
+// resources which were modified or deleted outside of CloudFormation. Stacks
+// which don't exist yet have no drift.
+func (a *awsAdapter) detectStackDrift(parentCtx context.Context, stackName string) ([]*cloudformation.StackResourceDrift, error) {
+	detection, err := a.cloudformationClient.DetectStackDrift(&cloudformation.DetectStackDriftInput{
+		StackName: aws.String(stackName),
+	})
+	if err != nil {
+		if isDoesNotExistsErr(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, driftDetectionTimeout)
+	defer cancel()
+
+	status, err := a.waitForDriftDetection(ctx, stackName, detection.StackDriftDetectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if aws.StringValue(status.StackDriftStatus) != cloudformation.StackDriftStatusDrifted {
+		return nil, nil
+	}
+
+	var drifts []*cloudformation.StackResourceDrift
+	params := &cloudformation.DescribeStackResourceDriftsInput{
+		StackName: aws.String(stackName),
+		StackResourceDriftStatusFilters: []*string{
+			aws.String(cloudformation.StackResourceDriftStatusModified),
+			aws.String(cloudformation.StackResourceDriftStatusDeleted),
+		},
+	}
+	for {
+		resp, err := a.cloudformationClient.DescribeStackResourceDrifts(params)
+		if err != nil {
+			return nil, err
+		}
+
+		drifts = append(drifts, resp.StackResourceDrifts...)
+
+		if resp.NextToken == nil {
+			return drifts, nil
+		}
+		params.NextToken = resp.NextToken
+	}
+}
+
+// waitForDriftDetection waits for the drift detection to finish.
+func (a *awsAdapter) waitForDriftDetection(ctx context.Context, stackName string, detectionID *string) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+	for {
+		status, err := a.cloudformationClient.DescribeStackDriftDetectionStatus(&cloudformation.DescribeStackDriftDetectionStatusInput{
+			StackDriftDetectionId: detectionID,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		switch aws.StringValue(status.DetectionStatus) {
+		case cloudformation.StackDriftDetectionStatusDetectionComplete:
+			return status, nil
+		case cloudformation.StackDriftDetectionStatusDetectionFailed:
+			// the detection fails if some of the resources don't
+			// support drift detection, the supported ones are
+			// still checked.
+			a.logger.Warnf("Drift detection of stack '%s' incomplete: %s", stackName, aws.StringValue(status.DetectionStatusReason))
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("drift detection of stack %s timed out", stackName)
+		case <-time.After(driftDetectionPollInterval):
+		}
+	}
+}
+
+// formatStackDrift returns a human readable summary of the drifted resources.
+func formatStackDrift(drifts []*cloudformation.StackResourceDrift) string {
+	resources := make([]string, 0, len(drifts))
+	for _, drift := range drifts {
+		var properties []string
+		for _, difference := range drift.PropertyDifferences {
+			properties = append(properties, aws.StringValue(difference.PropertyPath))
+		}
+
+		resource := fmt.Sprintf("%s (%s) %s",
+			aws.StringValue(drift.LogicalResourceId),
+			aws.StringValue(drift.ResourceType),
+			strings.ToLower(aws.StringValue(drift.StackResourceDriftStatus)))
+		if len(properties) > 0 {
+			resource += fmt.Sprintf(": %s", strings.Join(properties, ", "))
+		}
+		resources = append(resources, resource)
+	}
+	return strings.Join(resources, "; ")
+}
+
+// checkStackDrift detects drift of the stack before it's updated, so manual
+// changes aren't silently overwritten. Depending on the stack_drift_action
+// config item drift is ignored, logged (the default) or fails the
+// provisioning. Failing can be overridden by setting the force_stack_drift
+// config item to 'true'.
+func (p *clusterpyProvisioner) checkStackDrift(ctx context.Context, logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, stackName string) error {
+	action, ok := cluster.ConfigItems[configKeyStackDriftAction]
+	if !ok {
+		action = stackDriftActionWarn
+	}
+
+	switch action {
+	case stackDriftActionIgnore:
+		return nil
+	case stackDriftActionWarn, stackDriftActionFail:
+	default:
+		return fmt.Errorf("invalid value for %s: %s", configKeyStackDriftAction, action)
+	}
+
+	drifts, err := adapter.detectStackDrift(ctx, stackName)
+	if err != nil {
+		// not being able to detect drift shouldn't block updates
+		// unless explicitly requested.
+		if action == stackDriftActionFail {
+			return fmt.Errorf("failed to detect drift of stack %s: %v", stackName, err)
+		}
+		logger.Warnf("Failed to detect drift of stack %s: %v", stackName, err)
+		return nil
+	}
+
+	if len(drifts) == 0 {
+		return nil
+	}
+
+	summary := formatStackDrift(drifts)
+	if action == stackDriftActionWarn {
+		logger.Warnf("Stack %s drifted, manual changes will be overwritten: %s", stackName, summary)
+		return nil
+	}
+
+	if cluster.ConfigItems[configKeyForceStackDrift] == "true" {
+		logger.Warnf("Overwriting manual changes of drifted stack %s: %s", stackName, summary)
+		return nil
+	}
+
+	return fmt.Errorf("refusing to update drifted stack %s (set %s to override): %s", stackName, configKeyForceStackDrift, summary)
+}
@@ -0,0 +1,96 @@
+package provisioner
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestCheckStackDrift(t *testing.T) {
+	drift := &cloudformation.StackResourceDrift{
+		LogicalResourceId:        aws.String("MasterLoadBalancer"),
+		ResourceType:             aws.String("AWS::ElasticLoadBalancing::LoadBalancer"),
+		StackResourceDriftStatus: aws.String(cloudformation.StackResourceDriftStatusModified),
+		PropertyDifferences: []*cloudformation.PropertyDifference{
+			{PropertyPath: aws.String("/HealthCheck/Interval")},
+		},
+	}
+
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		drifts      []*cloudformation.StackResourceDrift
+		expectErr   bool
+	}{
+		{
+			msg:         "no drift",
+			configItems: map[string]string{configKeyStackDriftAction: stackDriftActionFail},
+		},
+		{
+			msg:         "drift is logged by default",
+			configItems: map[string]string{},
+			drifts:      []*cloudformation.StackResourceDrift{drift},
+		},
+		{
+			msg:         "drift fails the update",
+			configItems: map[string]string{configKeyStackDriftAction: stackDriftActionFail},
+			drifts:      []*cloudformation.StackResourceDrift{drift},
+			expectErr:   true,
+		},
+		{
+			msg: "drift is forced",
+			configItems: map[string]string{
+				configKeyStackDriftAction: stackDriftActionFail,
+				configKeyForceStackDrift:  "true",
+			},
+			drifts: []*cloudformation.StackResourceDrift{drift},
+		},
+		{
+			msg:         "invalid action",
+			configItems: map[string]string{configKeyStackDriftAction: "foo"},
+			expectErr:   true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			adapter := newAWSAdapterWithStubs(cloudformation.StackStatusUpdateComplete, "123")
+			adapter.cloudformationClient = &cloudFormationAPIStub{statusMutex: &sync.Mutex{}, drifts: tc.drifts}
+
+			cluster := &api.Cluster{ConfigItems: tc.configItems}
+			p := &clusterpyProvisioner{}
+			err := p.checkStackDrift(context.Background(), adapter.logger, adapter, cluster, "foobar")
+			if tc.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFormatStackDrift(t *testing.T) {
+	drifts := []*cloudformation.StackResourceDrift{
+		{
+			LogicalResourceId:        aws.String("MasterLoadBalancer"),
+			ResourceType:             aws.String("AWS::ElasticLoadBalancing::LoadBalancer"),
+			StackResourceDriftStatus: aws.String(cloudformation.StackResourceDriftStatusModified),
+			PropertyDifferences: []*cloudformation.PropertyDifference{
+				{PropertyPath: aws.String("/HealthCheck/Interval")},
+				{PropertyPath: aws.String("/Listeners/0/InstancePort")},
+			},
+		},
+		{
+			LogicalResourceId:        aws.String("WorkerRole"),
+			ResourceType:             aws.String("AWS::IAM::Role"),
+			StackResourceDriftStatus: aws.String(cloudformation.StackResourceDriftStatusDeleted),
+		},
+	}
+
+	require.Equal(t,
+		"MasterLoadBalancer (AWS::ElasticLoadBalancing::LoadBalancer) modified: /HealthCheck/Interval, /Listeners/0/InstancePort; WorkerRole (AWS::IAM::Role) deleted",
+		formatStackDrift(drifts))
+}
@@ -0,0 +1,219 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	configKeyEBSVolumeType = "ebs_volume_type"
+	configKeyEBSIOPS       = "ebs_iops"
+	configKeyEBSThroughput = "ebs_throughput"
+	configKeyEBSEncryption = "ebs_encryption"
+	configKeyEBSKMSKey     = "ebs_kms_key"
+
+	ebsVolumePolicyValue = "ebs_volume"
+)
+
+// ebsVolumeIOPSLimits are the IOPS which can be provisioned by volume type.
+var ebsVolumeIOPSLimits = map[string][2]int64{
+	"gp2": {0, 0},
+	"gp3": {3000, 16000},
+	"io1": {100, 64000},
+	"io2": {100, 64000},
+}
+
+// ebsVolumePolicy is the EBS volume configuration of a cluster. The volume
+// type, IOPS and throughput are the defaults for the root volumes of the
+// nodes and the etcd volumes, encryption is enforced for all EBS volumes of
+// the cluster, node pool and etcd stacks. It's exposed to the node pool
+// templates as .Values.ebs_volume.
+type ebsVolumePolicy struct {
+	// VolumeType is the type all volumes must use, if set.
+	VolumeType string
+	IOPS       int64
+	Throughput int64
+	// Encrypted requires all volumes to be encrypted, with KMSKeyID if
+	// set.
+	Encrypted bool
+	KMSKeyID  string
+}
+
+// newEBSVolumePolicy returns the EBS volume policy configured by the config
+// items of the cluster.
+func newEBSVolumePolicy(cluster *api.Cluster) (*ebsVolumePolicy, error) {
+	policy := &ebsVolumePolicy{
+		VolumeType: cluster.ConfigItems[configKeyEBSVolumeType],
+		KMSKeyID:   cluster.ConfigItems[configKeyEBSKMSKey],
+	}
+
+	limits, ok := ebsVolumeIOPSLimits[policy.VolumeType]
+	if policy.VolumeType != "" && !ok {
+		return nil, fmt.Errorf("invalid value for %s: %s", configKeyEBSVolumeType, policy.VolumeType)
+	}
+
+	for key, option := range map[string]*int64{
+		configKeyEBSIOPS:       &policy.IOPS,
+		configKeyEBSThroughput: &policy.Throughput,
+	} {
+		value, ok := cluster.ConfigItems[key]
+		if !ok {
+			continue
+		}
+
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		*option = parsed
+	}
+
+	if policy.IOPS != 0 && (policy.IOPS < limits[0] || policy.IOPS > limits[1]) {
+		return nil, fmt.Errorf("%s %d isn't supported for volume type '%s'", configKeyEBSIOPS, policy.IOPS, policy.VolumeType)
+	}
+	if policy.Throughput != 0 && (policy.VolumeType != "gp3" || policy.Throughput < 125 || policy.Throughput > 1000) {
+		return nil, fmt.Errorf("%s %d isn't supported for volume type '%s'", configKeyEBSThroughput, policy.Throughput, policy.VolumeType)
+	}
+
+	if value, ok := cluster.ConfigItems[configKeyEBSEncryption]; ok {
+		encrypted, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %s", configKeyEBSEncryption, value)
+		}
+		policy.Encrypted = encrypted
+	}
+	if policy.KMSKeyID != "" && !policy.Encrypted {
+		return nil, fmt.Errorf("%s requires %s", configKeyEBSKMSKey, configKeyEBSEncryption)
+	}
+	return policy, nil
+}
+
+// setEBSVolumeValues sets the EBS volume policy of the cluster in the values
+// of the node pool templates.
+func setEBSVolumeValues(cluster *api.Cluster, values map[string]interface{}) error {
+	policy, err := newEBSVolumePolicy(cluster)
+	if err != nil {
+		return err
+	}
+	values[ebsVolumePolicyValue] = policy
+	return nil
+}
+
+// stackVolumes returns the EBS volume properties of the resources of a
+// CloudFormation template, keyed by a description of the volume: the
+// block device mappings of launch templates, launch configurations and
+// instances and the properties of volumes.
+func stackVolumes(template []byte) (map[string]map[interface{}]interface{}, error) {
+	var stack struct {
+		Resources map[string]struct {
+			Type       string                      `yaml:"Type"`
+			Properties map[interface{}]interface{} `yaml:"Properties"`
+		} `yaml:"Resources"`
+	}
+	err := yaml.Unmarshal(template, &stack)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := make(map[string]map[interface{}]interface{})
+	for name, resource := range stack.Resources {
+		properties := resource.Properties
+		switch resource.Type {
+		case "AWS::EC2::Volume":
+			volumes[name] = properties
+			continue
+		case "AWS::EC2::LaunchTemplate":
+			properties, _ = properties["LaunchTemplateData"].(map[interface{}]interface{})
+		case "AWS::AutoScaling::LaunchConfiguration", "AWS::EC2::Instance":
+		default:
+			continue
+		}
+
+		mappings, _ := properties["BlockDeviceMappings"].([]interface{})
+		for _, mapping := range mappings {
+			mapping, _ := mapping.(map[interface{}]interface{})
+			ebs, ok := mapping["Ebs"].(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			volumes[fmt.Sprintf("%s (%v)", name, mapping["DeviceName"])] = ebs
+		}
+	}
+	return volumes, nil
+}
+
+// violations returns how the EBS volume properties violate the policy.
+// Properties computed by intrinsic functions can't be checked and are
+// accepted.
+func (p *ebsVolumePolicy) violations(properties map[interface{}]interface{}) []string {
+	var result []string
+
+	if p.VolumeType != "" {
+		switch volumeType := properties["VolumeType"].(type) {
+		case nil:
+			result = append(result, fmt.Sprintf("no volume type instead of %s", p.VolumeType))
+		case string:
+			if volumeType != p.VolumeType {
+				result = append(result, fmt.Sprintf("volume type %s instead of %s", volumeType, p.VolumeType))
+			}
+		}
+	}
+
+	if p.Encrypted {
+		switch encrypted := properties["Encrypted"].(type) {
+		case nil:
+			result = append(result, "not encrypted")
+		case bool, string:
+			if fmt.Sprint(encrypted) != "true" {
+				result = append(result, "not encrypted")
+			}
+		}
+	}
+
+	if p.KMSKeyID != "" {
+		switch key := properties["KmsKeyId"].(type) {
+		case nil:
+			result = append(result, "not encrypted with the KMS key of the cluster")
+		case string:
+			if key != p.KMSKeyID {
+				result = append(result, fmt.Sprintf("encrypted with KMS key %s", key))
+			}
+		}
+	}
+	return result
+}
+
+// validateStackVolumes validates that all EBS volumes of the stack template
+// comply with the EBS volume policy of the cluster.
+func validateStackVolumes(cluster *api.Cluster, stackName string, template []byte) error {
+	policy, err := newEBSVolumePolicy(cluster)
+	if err != nil {
+		return err
+	}
+	if policy.VolumeType == "" && !policy.Encrypted {
+		return nil
+	}
+
+	volumes, err := stackVolumes(template)
+	if err != nil {
+		return fmt.Errorf("failed to parse the template of stack %s: %v", stackName, err)
+	}
+
+	var violations []string
+	for name, properties := range volumes {
+		for _, violation := range policy.violations(properties) {
+			violations = append(violations, fmt.Sprintf("%s: %s", name, violation))
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	sort.Strings(violations)
+	return fmt.Errorf("EBS volumes of stack %s violate the volume policy: %s", stackName, strings.Join(violations, ", "))
+}
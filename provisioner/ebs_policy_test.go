@@ -0,0 +1,109 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestNewEBSVolumePolicy(t *testing.T) {
+	policy, err := newEBSVolumePolicy(&api.Cluster{})
+	require.NoError(t, err)
+	require.Equal(t, &ebsVolumePolicy{}, policy)
+
+	policy, err = newEBSVolumePolicy(&api.Cluster{ConfigItems: map[string]string{
+		configKeyEBSVolumeType: "gp3",
+		configKeyEBSIOPS:       "6000",
+		configKeyEBSThroughput: "250",
+		configKeyEBSEncryption: "true",
+		configKeyEBSKMSKey:     "arn:aws:kms:eu-central-1:123456789012:key/kube-1",
+	}})
+	require.NoError(t, err)
+	require.Equal(t, &ebsVolumePolicy{
+		VolumeType: "gp3",
+		IOPS:       6000,
+		Throughput: 250,
+		Encrypted:  true,
+		KMSKeyID:   "arn:aws:kms:eu-central-1:123456789012:key/kube-1",
+	}, policy)
+
+	for _, invalid := range []map[string]string{
+		{configKeyEBSVolumeType: "st1"},
+		{configKeyEBSVolumeType: "gp2", configKeyEBSIOPS: "3000"},
+		{configKeyEBSVolumeType: "io2", configKeyEBSIOPS: "many"},
+		{configKeyEBSVolumeType: "io2", configKeyEBSIOPS: "100000"},
+		{configKeyEBSVolumeType: "io2", configKeyEBSThroughput: "250"},
+		{configKeyEBSVolumeType: "gp3", configKeyEBSThroughput: "2000"},
+		{configKeyEBSEncryption: "yes"},
+		{configKeyEBSKMSKey: "alias/kube-1"},
+	} {
+		_, err := newEBSVolumePolicy(&api.Cluster{ConfigItems: invalid})
+		require.Error(t, err, "%v", invalid)
+	}
+}
+
+func TestValidateStackVolumes(t *testing.T) {
+	template := `
+Resources:
+  LaunchTemplate:
+    Type: AWS::EC2::LaunchTemplate
+    Properties:
+      LaunchTemplateData:
+        BlockDeviceMappings:
+        - DeviceName: /dev/xvda
+          Ebs:
+            VolumeType: gp3
+            Encrypted: true
+            KmsKeyId: alias/kube-1
+        - DeviceName: /dev/sdb
+          VirtualName: ephemeral0
+  EtcdVolume:
+    Type: AWS::EC2::Volume
+    Properties:
+      VolumeType: gp2
+      Encrypted: "false"
+  Unencrypted:
+    Type: AWS::AutoScaling::LaunchConfiguration
+    Properties:
+      BlockDeviceMappings:
+      - DeviceName: /dev/xvda
+        Ebs:
+          VolumeType: gp3
+          KmsKeyId: {"Ref": "KmsKey"}
+  Role:
+    Type: AWS::IAM::Role
+`
+
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		err         string
+	}{
+		{
+			msg: "no policy",
+		},
+		{
+			msg:         "volume type",
+			configItems: map[string]string{configKeyEBSVolumeType: "gp3"},
+			err:         "EBS volumes of stack kube-1 violate the volume policy: EtcdVolume: volume type gp2 instead of gp3",
+		},
+		{
+			msg: "encryption with the KMS key of the cluster",
+			configItems: map[string]string{
+				configKeyEBSEncryption: "true",
+				configKeyEBSKMSKey:     "alias/kube-2",
+			},
+			err: "EBS volumes of stack kube-1 violate the volume policy: EtcdVolume: not encrypted, EtcdVolume: not encrypted with the KMS key of the cluster, LaunchTemplate (/dev/xvda): encrypted with KMS key alias/kube-1, Unencrypted (/dev/xvda): not encrypted",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateStackVolumes(&api.Cluster{ConfigItems: tc.configItems}, "kube-1", []byte(template))
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,728 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/eks"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	awsUtils "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+	"golang.org/x/oauth2"
+)
+
+const (
+	eksProviderID              = "zalando-eks"
+	configKeyEKSRoleARN        = "eks_role_arn"
+	configKeyEKSNodeRoleARN    = "eks_node_role_arn"
+	configKeyEKSVersion        = "eks_version"
+	configKeyEKSSecurityGroups = "eks_security_groups"
+	eksNodePoolLabel           = "node-pool"
+	eksNodePoolProfileLabel    = "node-pool-profile"
+	eksTimeout                 = 60 * time.Minute
+)
+
+// eksPollInterval is the interval between checking the status of an EKS
+// update. It's defined as a variable so it can be changed in tests.
+var eksPollInterval = 30 * time.Second
+
+// eksAPI is a minimal interface containing only the methods we use from the
+// EKS API.
+type eksAPI interface {
+	DescribeCluster(input *eks.DescribeClusterInput) (*eks.DescribeClusterOutput, error)
+	CreateCluster(input *eks.CreateClusterInput) (*eks.CreateClusterOutput, error)
+	UpdateClusterVersion(input *eks.UpdateClusterVersionInput) (*eks.UpdateClusterVersionOutput, error)
+	DeleteCluster(input *eks.DeleteClusterInput) (*eks.DeleteClusterOutput, error)
+	ListNodegroupsPages(input *eks.ListNodegroupsInput, fn func(*eks.ListNodegroupsOutput, bool) bool) error
+	DescribeNodegroup(input *eks.DescribeNodegroupInput) (*eks.DescribeNodegroupOutput, error)
+	CreateNodegroup(input *eks.CreateNodegroupInput) (*eks.CreateNodegroupOutput, error)
+	UpdateNodegroupConfig(input *eks.UpdateNodegroupConfigInput) (*eks.UpdateNodegroupConfigOutput, error)
+	UpdateNodegroupVersion(input *eks.UpdateNodegroupVersionInput) (*eks.UpdateNodegroupVersionOutput, error)
+	DeleteNodegroup(input *eks.DeleteNodegroupInput) (*eks.DeleteNodegroupOutput, error)
+	DescribeUpdate(input *eks.DescribeUpdateInput) (*eks.DescribeUpdateOutput, error)
+	WaitUntilClusterActiveWithContext(ctx aws.Context, input *eks.DescribeClusterInput, opts ...request.WaiterOption) error
+	WaitUntilClusterDeletedWithContext(ctx aws.Context, input *eks.DescribeClusterInput, opts ...request.WaiterOption) error
+	WaitUntilNodegroupActiveWithContext(ctx aws.Context, input *eks.DescribeNodegroupInput, opts ...request.WaiterOption) error
+	WaitUntilNodegroupDeletedWithContext(ctx aws.Context, input *eks.DescribeNodegroupInput, opts ...request.WaiterOption) error
+}
+
+// eksProvisioner provisions clusters with an EKS managed control plane and
+// EKS managed node groups. The manifests of the channel are applied the same
+// way as for clusterpy clusters, authenticating with IAM authenticator
+// tokens.
+type eksProvisioner struct {
+	*clusterpyProvisioner
+}
+
+// NewEKSProvisioner returns a new EKS provisioner using the IAM role to
+// manage the clusters.
+func NewEKSProvisioner(assumedRole string, awsConfig *aws.Config, options *Options) Provisioner {
+	return &eksProvisioner{
+		clusterpyProvisioner: NewClusterpyProvisioner(nil, assumedRole, awsConfig, options).(*clusterpyProvisioner),
+	}
+}
+
+func (p *eksProvisioner) Supports(cluster *api.Cluster) bool {
+	return cluster.Provider == eksProviderID
+}
+
+// prepareEKS checks that the cluster can be handled by the provisioner and
+// initializes an aws adapter authenticating against the API server of the
+// EKS cluster with IAM authenticator tokens.
+func (p *eksProvisioner) prepareEKS(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, auditLog *audit.Log) (*awsAdapter, error) {
+	if cluster.Provider != eksProviderID {
+		return nil, ErrProviderNotSupported
+	}
+
+	logger.Infof("eks: Prepare for provisioning cluster %s (%s)..", cluster.ID, cluster.LifecycleStatus)
+
+	sess, err := p.awsSession(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSource := awsUtils.NewEKSTokenSource(sess, cluster.LocalID)
+	adapter, err := newAWSAdapter(logger, cluster.APIServerURL, cluster.Region, sess, tokenSource, p.dryRun)
+	if err != nil {
+		return nil, err
+	}
+	adapter.audit = auditLog
+
+	err = p.updateDefaults(cluster, channelConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration defaults: %v", err)
+	}
+
+	err = validateConfigSchema(logger, cluster, channelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, nodePool := range cluster.NodePools {
+		if strings.HasPrefix(nodePool.Profile, "master") {
+			return nil, fmt.Errorf("node pool %s: EKS clusters have a managed control plane and don't support master node pools", nodePool.Name)
+		}
+		if nodePool.DiscountStrategy != "" && nodePool.DiscountStrategy != discountStrategyNone {
+			return nil, fmt.Errorf("node pool %s: unsupported discount_strategy %s for EKS node groups", nodePool.Name, nodePool.DiscountStrategy)
+		}
+	}
+
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return nil, err
+	}
+	adapter.dryRun = options.dryRun
+
+	return adapter, nil
+}
+
+// Provision creates or updates the EKS cluster and its managed node groups
+// and applies the manifests of the channel to the cluster.
+func (p *eksProvisioner) Provision(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (err error) {
+	ctx, span := p.tracer.Start(ctx, "provision", traceAttributes(cluster, auditOperationProvision))
+	defer func() { span.End(err) }()
+
+	auditLog := p.newAuditLog(cluster, auditOperationProvision)
+	adapter, err := p.prepareEKS(logger, cluster, channelConfig, auditLog)
+	if err != nil {
+		return err
+	}
+	defer p.storeAuditLog(logger, cluster, auditLog)
+
+	subnets, err := adapter.GetSubnets()
+	if err != nil {
+		return err
+	}
+
+	if subnetIds, ok := cluster.ConfigItems[subnetsConfigItemKey]; ok {
+		subnets, err = filterSubnets(subnets, strings.Split(subnetIds, ","))
+		if err != nil {
+			return err
+		}
+	}
+
+	subnetIDs := make([]string, 0, len(subnets))
+	for _, subnet := range subnets {
+		subnetIDs = append(subnetIDs, aws.StringValue(subnet.SubnetId))
+	}
+	sort.Strings(subnetIDs)
+
+	eksCluster, err := adapter.createOrUpdateEKSCluster(ctx, cluster, subnetIDs)
+	if err != nil {
+		return err
+	}
+
+	if eksCluster == nil {
+		logger.Infof("Dry-run: EKS cluster %s doesn't exist yet, skipping node groups and manifests", cluster.LocalID)
+		return nil
+	}
+
+	err = useEKSEndpoint(adapter, cluster, eksCluster)
+	if err != nil {
+		return err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return err
+	}
+
+	err = adapter.reconcileEKSNodegroups(ctx, cluster, subnetIDs, aws.StringValue(eksCluster.Version), !options.applyOnly)
+	if err != nil {
+		return err
+	}
+
+	p.updateCostEstimate(logger, adapter, cluster)
+
+	client, err := p.eksAPIServerClient(cluster, adapter.tokenSrc)
+	if err != nil {
+		return err
+	}
+
+	apiServerVersion, err := waitForAPIServer(logger, client, cluster.APIServerURL, defaultAPIServerWaitTimeout, nil)
+	if err != nil {
+		return err
+	}
+	logger = logger.WithField("apiserver_version", apiServerVersion.GitVersion)
+
+	adapter.kubectl, err = p.kubectlBinary(logger, channelConfig, apiServerVersion.GitVersion)
+	if err != nil {
+		return err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	err = p.apply(ctx, logger, adapter, cluster, path.Join(channelConfig.Path, manifestsPath))
+	if err != nil {
+		return err
+	}
+
+	return p.ensureAdminKubeconfig(logger, adapter, cluster)
+}
+
+// eksAPIServerClient returns an HTTP client authenticated with the IAM
+// authenticator token source for talking to the API server of the cluster.
+func (p *eksProvisioner) eksAPIServerClient(cluster *api.Cluster, tokenSource oauth2.TokenSource) (*http.Client, error) {
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: tokenSource,
+			Base:   transport,
+		},
+	}, nil
+}
+
+// Decommission deletes the managed node groups and the EKS cluster.
+func (p *eksProvisioner) Decommission(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (err error) {
+	// we don't support cancelling decommission operations yet
+	ctx, span := p.tracer.Start(context.Background(), "decommission", traceAttributes(cluster, auditOperationDecommission))
+	defer func() { span.End(err) }()
+
+	auditLog := p.newAuditLog(cluster, auditOperationDecommission)
+	adapter, err := p.prepareEKS(logger, cluster, channelConfig, auditLog)
+	if err != nil {
+		return err
+	}
+
+	err = checkDecommission(cluster)
+	if err != nil {
+		return err
+	}
+	defer p.storeAuditLog(logger, cluster, auditLog)
+
+	nodegroups, err := adapter.listEKSNodegroups(cluster.LocalID)
+	if err != nil {
+		if isEKSNotFoundErr(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, nodegroup := range nodegroups {
+		err = adapter.deleteEKSNodegroup(ctx, cluster.LocalID, nodegroup)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = adapter.deleteEKSCluster(ctx, cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
+	return deleteAdminKubeconfig(adapter, cluster)
+}
+
+// useEKSEndpoint points the cluster and the adapter to the API server of the
+// EKS cluster, trusting the CA of the cluster.
+func useEKSEndpoint(adapter *awsAdapter, cluster *api.Cluster, eksCluster *eks.Cluster) error {
+	if eksCluster.CertificateAuthority != nil {
+		ca, err := base64.StdEncoding.DecodeString(aws.StringValue(eksCluster.CertificateAuthority.Data))
+		if err != nil {
+			return fmt.Errorf("invalid certificate authority of EKS cluster %s: %v", aws.StringValue(eksCluster.Name), err)
+		}
+		cluster.ConfigItems[configKeyAPIServerCA] = string(ca)
+	}
+
+	cluster.APIServerURL = aws.StringValue(eksCluster.Endpoint)
+	adapter.apiServer = cluster.APIServerURL
+	return nil
+}
+
+// isEKSNotFoundErr returns true if the error indicates that an EKS cluster
+// or node group doesn't exist.
+func isEKSNotFoundErr(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == eks.ErrCodeResourceNotFoundException
+	}
+	return false
+}
+
+// eksTags returns the tags of the EKS resources of the cluster.
+func eksTags(cluster *api.Cluster) map[string]*string {
+	return map[string]*string{
+		tagNameKubernetesClusterPrefix + cluster.ID: aws.String(resourceLifecycleOwned),
+	}
+}
+
+// createOrUpdateEKSCluster creates the EKS cluster if it doesn't exist or
+// upgrades it to the version configured by the eks_version config item. nil
+// is returned in dry-run mode if the cluster doesn't exist.
+func (a *awsAdapter) createOrUpdateEKSCluster(parentCtx context.Context, cluster *api.Cluster, subnetIDs []string) (*eks.Cluster, error) {
+	ctx, cancel := context.WithTimeout(parentCtx, eksTimeout)
+	defer cancel()
+
+	name := cluster.LocalID
+	version := cluster.ConfigItems[configKeyEKSVersion]
+
+	resp, err := a.eksClient.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(name)})
+	if err != nil {
+		if !isEKSNotFoundErr(err) {
+			return nil, err
+		}
+		return a.createEKSCluster(ctx, cluster, subnetIDs)
+	}
+
+	eksCluster := resp.Cluster
+	if version == "" || aws.StringValue(eksCluster.Version) == version {
+		return eksCluster, nil
+	}
+
+	if a.dryRun {
+		a.logger.Infof("Dry-run: would upgrade EKS cluster %s from %s to %s", name, aws.StringValue(eksCluster.Version), version)
+		return eksCluster, nil
+	}
+
+	a.logger.Infof("Upgrading EKS cluster %s from %s to %s", name, aws.StringValue(eksCluster.Version), version)
+	update, err := a.eksClient.UpdateClusterVersion(&eks.UpdateClusterVersionInput{
+		Name:    aws.String(name),
+		Version: aws.String(version),
+	})
+	if err == nil {
+		err = a.waitForEKSUpdate(ctx, name, nil, update.Update.Id)
+	}
+	a.audit.Record(audit.KindAWS, "update-eks-cluster-version:"+version, name, err)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err = a.eksClient.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(name)})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Cluster, nil
+}
+
+// createEKSCluster creates the EKS cluster and waits for it to be active.
+func (a *awsAdapter) createEKSCluster(ctx context.Context, cluster *api.Cluster, subnetIDs []string) (*eks.Cluster, error) {
+	name := cluster.LocalID
+
+	roleARN, ok := cluster.ConfigItems[configKeyEKSRoleARN]
+	if !ok {
+		return nil, fmt.Errorf("the %s config item is required to create EKS cluster %s", configKeyEKSRoleARN, name)
+	}
+
+	params := &eks.CreateClusterInput{
+		Name:    aws.String(name),
+		RoleArn: aws.String(roleARN),
+		ResourcesVpcConfig: &eks.VpcConfigRequest{
+			SubnetIds: aws.StringSlice(subnetIDs),
+		},
+		Tags: eksTags(cluster),
+	}
+
+	if version, ok := cluster.ConfigItems[configKeyEKSVersion]; ok {
+		params.Version = aws.String(version)
+	}
+
+	if securityGroups, ok := cluster.ConfigItems[configKeyEKSSecurityGroups]; ok {
+		params.ResourcesVpcConfig.SecurityGroupIds = aws.StringSlice(strings.Split(securityGroups, ","))
+	}
+
+	if a.dryRun {
+		a.logger.Infof("Dry-run: would create EKS cluster %s", name)
+		return nil, nil
+	}
+
+	a.logger.Infof("Creating EKS cluster %s", name)
+	_, err := a.eksClient.CreateCluster(params)
+	if err == nil {
+		err = a.eksClient.WaitUntilClusterActiveWithContext(ctx, &eks.DescribeClusterInput{Name: aws.String(name)})
+	}
+	a.audit.Record(audit.KindAWS, "create-eks-cluster", name, err)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.eksClient.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(name)})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Cluster, nil
+}
+
+// deleteEKSCluster deletes the EKS cluster and waits until it's gone.
+func (a *awsAdapter) deleteEKSCluster(parentCtx context.Context, name string) error {
+	if a.dryRun {
+		a.logger.Infof("Dry-run: would delete EKS cluster %s", name)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, eksTimeout)
+	defer cancel()
+
+	_, err := a.eksClient.DeleteCluster(&eks.DeleteClusterInput{Name: aws.String(name)})
+	if err != nil {
+		if isEKSNotFoundErr(err) {
+			return nil
+		}
+		a.audit.Record(audit.KindAWS, "delete-eks-cluster", name, err)
+		return err
+	}
+
+	err = a.eksClient.WaitUntilClusterDeletedWithContext(ctx, &eks.DescribeClusterInput{Name: aws.String(name)})
+	a.audit.Record(audit.KindAWS, "delete-eks-cluster", name, err)
+	return err
+}
+
+// waitForEKSUpdate waits for the update of the cluster or node group (if
+// nodegroup isn't nil) to succeed.
+func (a *awsAdapter) waitForEKSUpdate(ctx context.Context, clusterName string, nodegroup *string, updateID *string) error {
+	for {
+		resp, err := a.eksClient.DescribeUpdate(&eks.DescribeUpdateInput{
+			Name:          aws.String(clusterName),
+			NodegroupName: nodegroup,
+			UpdateId:      updateID,
+		})
+		if err != nil {
+			return err
+		}
+
+		switch aws.StringValue(resp.Update.Status) {
+		case eks.UpdateStatusSuccessful:
+			return nil
+		case eks.UpdateStatusFailed, eks.UpdateStatusCancelled:
+			return fmt.Errorf("update %s of EKS cluster %s %s: %s", aws.StringValue(updateID), clusterName, strings.ToLower(aws.StringValue(resp.Update.Status)), formatEKSErrors(resp.Update.Errors))
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for update %s of EKS cluster %s", aws.StringValue(updateID), clusterName)
+		case <-time.After(eksPollInterval):
+		}
+	}
+}
+
+// formatEKSErrors returns a human readable summary of the update errors.
+func formatEKSErrors(errs []*eks.ErrorDetail) string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, fmt.Sprintf("%s: %s", aws.StringValue(err.ErrorCode), aws.StringValue(err.ErrorMessage)))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// listEKSNodegroups returns the names of the node groups of the cluster.
+func (a *awsAdapter) listEKSNodegroups(clusterName string) ([]string, error) {
+	var nodegroups []string
+	err := a.eksClient.ListNodegroupsPages(&eks.ListNodegroupsInput{ClusterName: aws.String(clusterName)}, func(resp *eks.ListNodegroupsOutput, lastPage bool) bool {
+		nodegroups = append(nodegroups, aws.StringValueSlice(resp.Nodegroups)...)
+		return true
+	})
+	return nodegroups, err
+}
+
+// eksNodegroupChange is a change of a managed node group required to match
+// the node pools of the cluster.
+type eksNodegroupChange struct {
+	nodePool *api.NodePool
+	// current is the existing node group or nil if it has to be created.
+	current *eks.Nodegroup
+	// updateScaling is true if the scaling config differs from the node
+	// pool.
+	updateScaling bool
+	// updateVersion is true if the node group runs an older Kubernetes
+	// version than the control plane.
+	updateVersion bool
+}
+
+// planEKSNodegroups compares the node pools with the existing node groups
+// and returns the changes required for every node pool and the names of
+// the node groups without a node pool.
+func planEKSNodegroups(nodePools []*api.NodePool, existing map[string]*eks.Nodegroup, version string) ([]*eksNodegroupChange, []string, error) {
+	var changes []*eksNodegroupChange
+	for _, nodePool := range nodePools {
+		change := &eksNodegroupChange{nodePool: nodePool}
+
+		if current, ok := existing[nodePool.Name]; ok {
+			if len(current.InstanceTypes) != 1 || aws.StringValue(current.InstanceTypes[0]) != nodePool.InstanceType {
+				return nil, nil, fmt.Errorf("node pool %s: the instance type of an EKS node group can't be changed, create a new node pool instead", nodePool.Name)
+			}
+
+			change.current = current
+			scaling := current.ScalingConfig
+			change.updateScaling = scaling == nil ||
+				aws.Int64Value(scaling.MinSize) != nodePool.MinSize ||
+				aws.Int64Value(scaling.MaxSize) != nodePool.MaxSize
+			change.updateVersion = version != "" && aws.StringValue(current.Version) != version
+		}
+
+		changes = append(changes, change)
+	}
+
+	var removed []string
+	for name := range existing {
+		found := false
+		for _, nodePool := range nodePools {
+			if nodePool.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+
+	return changes, removed, nil
+}
+
+// eksScalingConfig returns the scaling config of the node pool. The desired
+// size of an existing node group is kept within the new limits so the
+// autoscaler isn't overridden.
+func eksScalingConfig(nodePool *api.NodePool, current *eks.Nodegroup) *eks.NodegroupScalingConfig {
+	desired := nodePool.MinSize
+	if current != nil && current.ScalingConfig != nil {
+		desired = aws.Int64Value(current.ScalingConfig.DesiredSize)
+		if desired < nodePool.MinSize {
+			desired = nodePool.MinSize
+		}
+		if desired > nodePool.MaxSize {
+			desired = nodePool.MaxSize
+		}
+	}
+
+	return &eks.NodegroupScalingConfig{
+		MinSize:     aws.Int64(nodePool.MinSize),
+		MaxSize:     aws.Int64(nodePool.MaxSize),
+		DesiredSize: aws.Int64(desired),
+	}
+}
+
+// reconcileEKSNodegroups creates, updates and deletes the managed node groups
+// to match the node pools of the cluster. Node groups running an older
+// version than the control plane are upgraded if upgrade is true. EKS
+// replaces the nodes of upgraded node groups respecting pod disruption
+// budgets.
+func (a *awsAdapter) reconcileEKSNodegroups(parentCtx context.Context, cluster *api.Cluster, subnetIDs []string, version string, upgrade bool) error {
+	ctx, cancel := context.WithTimeout(parentCtx, eksTimeout)
+	defer cancel()
+
+	clusterName := cluster.LocalID
+
+	names, err := a.listEKSNodegroups(clusterName)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]*eks.Nodegroup, len(names))
+	for _, name := range names {
+		resp, err := a.eksClient.DescribeNodegroup(&eks.DescribeNodegroupInput{
+			ClusterName:   aws.String(clusterName),
+			NodegroupName: aws.String(name),
+		})
+		if err != nil {
+			return err
+		}
+		existing[name] = resp.Nodegroup
+	}
+
+	changes, removed, err := planEKSNodegroups(cluster.NodePools, existing, version)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if change.current == nil {
+			err = a.createEKSNodegroup(ctx, cluster, change.nodePool, subnetIDs)
+		} else {
+			err = a.updateEKSNodegroup(ctx, clusterName, change, version, upgrade)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range removed {
+		err = a.deleteEKSNodegroup(ctx, clusterName, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createEKSNodegroup creates a managed node group for the node pool and waits
+// for it to be active.
+func (a *awsAdapter) createEKSNodegroup(ctx context.Context, cluster *api.Cluster, nodePool *api.NodePool, subnetIDs []string) error {
+	clusterName := cluster.LocalID
+
+	nodeRoleARN, ok := cluster.ConfigItems[configKeyEKSNodeRoleARN]
+	if !ok {
+		return fmt.Errorf("the %s config item is required to create EKS node groups", configKeyEKSNodeRoleARN)
+	}
+
+	if a.dryRun {
+		a.logger.Infof("Dry-run: would create EKS node group %s", nodePool.Name)
+		return nil
+	}
+
+	a.logger.Infof("Creating EKS node group %s", nodePool.Name)
+	_, err := a.eksClient.CreateNodegroup(&eks.CreateNodegroupInput{
+		ClusterName:   aws.String(clusterName),
+		NodegroupName: aws.String(nodePool.Name),
+		NodeRole:      aws.String(nodeRoleARN),
+		Subnets:       aws.StringSlice(subnetIDs),
+		InstanceTypes: aws.StringSlice([]string{nodePool.InstanceType}),
+		ScalingConfig: eksScalingConfig(nodePool, nil),
+		Labels: map[string]*string{
+			eksNodePoolLabel:        aws.String(nodePool.Name),
+			eksNodePoolProfileLabel: aws.String(nodePool.Profile),
+		},
+		Tags: eksTags(cluster),
+	})
+	if err == nil {
+		err = a.eksClient.WaitUntilNodegroupActiveWithContext(ctx, &eks.DescribeNodegroupInput{
+			ClusterName:   aws.String(clusterName),
+			NodegroupName: aws.String(nodePool.Name),
+		})
+	}
+	a.audit.Record(audit.KindAWS, "create-eks-nodegroup", clusterName+"/"+nodePool.Name, err)
+	return err
+}
+
+// updateEKSNodegroup updates the scaling config and the version of an
+// existing node group.
+func (a *awsAdapter) updateEKSNodegroup(ctx context.Context, clusterName string, change *eksNodegroupChange, version string, upgrade bool) error {
+	name := aws.String(change.nodePool.Name)
+	resource := clusterName + "/" + change.nodePool.Name
+
+	if change.updateScaling {
+		if a.dryRun {
+			a.logger.Infof("Dry-run: would scale EKS node group %s to %d-%d nodes", *name, change.nodePool.MinSize, change.nodePool.MaxSize)
+		} else {
+			a.logger.Infof("Scaling EKS node group %s to %d-%d nodes", *name, change.nodePool.MinSize, change.nodePool.MaxSize)
+			resp, err := a.eksClient.UpdateNodegroupConfig(&eks.UpdateNodegroupConfigInput{
+				ClusterName:   aws.String(clusterName),
+				NodegroupName: name,
+				ScalingConfig: eksScalingConfig(change.nodePool, change.current),
+			})
+			if err == nil {
+				err = a.waitForEKSUpdate(ctx, clusterName, name, resp.Update.Id)
+			}
+			a.audit.Record(audit.KindAWS, "update-eks-nodegroup-config", resource, err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if !change.updateVersion {
+		return nil
+	}
+
+	if !upgrade {
+		a.logger.Infof("Apply only mode, not upgrading EKS node group %s to %s", *name, version)
+		return nil
+	}
+
+	if a.dryRun {
+		a.logger.Infof("Dry-run: would upgrade EKS node group %s to %s", *name, version)
+		return nil
+	}
+
+	a.logger.Infof("Upgrading EKS node group %s from %s to %s", *name, aws.StringValue(change.current.Version), version)
+	resp, err := a.eksClient.UpdateNodegroupVersion(&eks.UpdateNodegroupVersionInput{
+		ClusterName:   aws.String(clusterName),
+		NodegroupName: name,
+		Version:       aws.String(version),
+	})
+	if err == nil {
+		err = a.waitForEKSUpdate(ctx, clusterName, name, resp.Update.Id)
+	}
+	a.audit.Record(audit.KindAWS, "update-eks-nodegroup-version:"+version, resource, err)
+	return err
+}
+
+// deleteEKSNodegroup deletes the node group and waits until it's gone.
+func (a *awsAdapter) deleteEKSNodegroup(ctx context.Context, clusterName, name string) error {
+	if a.dryRun {
+		a.logger.Infof("Dry-run: would delete EKS node group %s", name)
+		return nil
+	}
+
+	a.logger.Infof("Deleting EKS node group %s", name)
+	params := &eks.DeleteNodegroupInput{
+		ClusterName:   aws.String(clusterName),
+		NodegroupName: aws.String(name),
+	}
+	_, err := a.eksClient.DeleteNodegroup(params)
+	if err != nil && isEKSNotFoundErr(err) {
+		return nil
+	}
+	if err == nil {
+		err = a.eksClient.WaitUntilNodegroupDeletedWithContext(ctx, &eks.DescribeNodegroupInput{
+			ClusterName:   aws.String(clusterName),
+			NodegroupName: aws.String(name),
+		})
+	}
+	a.audit.Record(audit.KindAWS, "delete-eks-nodegroup", clusterName+"/"+name, err)
+	return err
+}
@@ -0,0 +1,128 @@
+package provisioner
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func newNodegroup(instanceType string, min, max, desired int64, version string) *eks.Nodegroup {
+	return &eks.Nodegroup{
+		InstanceTypes: aws.StringSlice([]string{instanceType}),
+		ScalingConfig: &eks.NodegroupScalingConfig{
+			MinSize:     aws.Int64(min),
+			MaxSize:     aws.Int64(max),
+			DesiredSize: aws.Int64(desired),
+		},
+		Version: aws.String(version),
+	}
+}
+
+func TestPlanEKSNodegroups(t *testing.T) {
+	nodePools := []*api.NodePool{
+		{Name: "default", InstanceType: "m5.large", MinSize: 2, MaxSize: 10},
+		{Name: "new", InstanceType: "m5.xlarge", MinSize: 1, MaxSize: 3},
+		{Name: "unchanged", InstanceType: "c5.large", MinSize: 1, MaxSize: 2},
+	}
+	existing := map[string]*eks.Nodegroup{
+		"default":   newNodegroup("m5.large", 1, 10, 4, "1.13"),
+		"unchanged": newNodegroup("c5.large", 1, 2, 1, "1.14"),
+		"removed":   newNodegroup("m5.large", 1, 1, 1, "1.14"),
+	}
+
+	changes, removed, err := planEKSNodegroups(nodePools, existing, "1.14")
+	require.NoError(t, err)
+	require.Equal(t, []string{"removed"}, removed)
+	require.Len(t, changes, 3)
+
+	require.Equal(t, existing["default"], changes[0].current)
+	require.True(t, changes[0].updateScaling)
+	require.True(t, changes[0].updateVersion)
+
+	require.Nil(t, changes[1].current)
+
+	require.False(t, changes[2].updateScaling)
+	require.False(t, changes[2].updateVersion)
+
+	// instance types of node groups are immutable
+	nodePools[0].InstanceType = "m5.xlarge"
+	_, _, err = planEKSNodegroups(nodePools, existing, "1.14")
+	require.Error(t, err)
+}
+
+func TestEKSScalingConfig(t *testing.T) {
+	nodePool := &api.NodePool{MinSize: 2, MaxSize: 5}
+
+	for _, tc := range []struct {
+		msg     string
+		current *eks.Nodegroup
+		desired int64
+	}{
+		{
+			msg:     "new node group",
+			desired: 2,
+		},
+		{
+			msg:     "keep desired size",
+			current: newNodegroup("m5.large", 1, 10, 4, "1.14"),
+			desired: 4,
+		},
+		{
+			msg:     "scale down to max size",
+			current: newNodegroup("m5.large", 1, 10, 8, "1.14"),
+			desired: 5,
+		},
+		{
+			msg:     "scale up to min size",
+			current: newNodegroup("m5.large", 1, 10, 1, "1.14"),
+			desired: 2,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			config := eksScalingConfig(nodePool, tc.current)
+			require.Equal(t, int64(2), aws.Int64Value(config.MinSize))
+			require.Equal(t, int64(5), aws.Int64Value(config.MaxSize))
+			require.Equal(t, tc.desired, aws.Int64Value(config.DesiredSize))
+		})
+	}
+}
+
+func TestUseEKSEndpoint(t *testing.T) {
+	adapter := &awsAdapter{}
+	cluster := &api.Cluster{ConfigItems: map[string]string{}}
+
+	err := useEKSEndpoint(adapter, cluster, &eks.Cluster{
+		Name:     aws.String("kube-1"),
+		Endpoint: aws.String("https://abc.eks.amazonaws.com"),
+		CertificateAuthority: &eks.Certificate{
+			Data: aws.String(base64.StdEncoding.EncodeToString([]byte("ca"))),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "https://abc.eks.amazonaws.com", cluster.APIServerURL)
+	require.Equal(t, "https://abc.eks.amazonaws.com", adapter.apiServer)
+	require.Equal(t, "ca", cluster.ConfigItems[configKeyAPIServerCA])
+
+	err = useEKSEndpoint(adapter, cluster, &eks.Cluster{
+		Name:                 aws.String("kube-1"),
+		CertificateAuthority: &eks.Certificate{Data: aws.String("invalid base64")},
+	})
+	require.Error(t, err)
+}
+
+func TestMultiProvisioner(t *testing.T) {
+	managed := &eksProvisioner{clusterpyProvisioner: &clusterpyProvisioner{}}
+	p := NewMultiProvisioner(&clusterpyProvisioner{}, managed).(*multiProvisioner)
+
+	selected, err := p.provisioner(&api.Cluster{Provider: eksProviderID})
+	require.NoError(t, err)
+	require.Equal(t, managed, selected)
+
+	require.True(t, p.Supports(&api.Cluster{Provider: providerID}))
+	require.False(t, p.Supports(&api.Cluster{Provider: "unknown"}))
+	require.Equal(t, ErrProviderNotSupported, p.Decommission(nil, &api.Cluster{Provider: "unknown"}, nil))
+}
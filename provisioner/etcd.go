@@ -0,0 +1,540 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/etcd"
+)
+
+const (
+	configKeyEtcdEndpoint      = "etcd_endpoint"
+	configKeyEtcdVersion       = "etcd_version"
+	configKeyEtcdCA            = "etcd_ca"
+	configKeyEtcdClientCert    = "etcd_client_cert"
+	configKeyEtcdClientKey     = "etcd_client_key"
+	configKeyEtcdStackVersion  = "etcd_stack_version"
+	etcdStackNamePrefix        = "etcd-cluster-"
+	defaultEtcdStackVersion    = "etcd"
+	cloudformationStackNameTag = "aws:cloudformation:stack-name"
+	etcdStepTimeout            = 15 * time.Minute
+	etcdInstanceCountParameter = "InstanceCount"
+)
+
+// etcdPollInterval is the interval between checking the etcd cluster status
+// while waiting for a step to complete. It's defined as a variable so it can
+// be changed in tests.
+var etcdPollInterval = 15 * time.Second
+
+// etcdClient is the subset of the etcd client used to manage the members.
+type etcdClient interface {
+	Status(ctx context.Context) (*etcd.ClusterStatus, error)
+	RemoveMember(ctx context.Context, id string) error
+}
+
+// etcdInstance is an instance running an etcd member.
+type etcdInstance struct {
+	id string
+	// addresses are the private IPs and DNS names of the instance.
+	addresses []string
+}
+
+// etcdInstances manages the instances of the etcd cluster.
+type etcdInstances interface {
+	Instances() ([]*etcdInstance, error)
+	SetDesiredCapacity(capacity int) error
+	Terminate(instanceID string, decrementDesired bool) error
+}
+
+// etcdManager scales and upgrades an etcd cluster one member at a time. The
+// quorum is verified before and after every step.
+type etcdManager struct {
+	logger      *log.Entry
+	client      etcdClient
+	instances   etcdInstances
+	stepTimeout time.Duration
+}
+
+// manageEtcd scales the etcd cluster to the size configured by the
+// etcd_instance_count config item and upgrades the members to the version
+// configured by the etcd_version config item. It's a noop unless the
+// etcd_endpoint config item is set, since the CLM needs access to the etcd
+// API.
+func (p *clusterpyProvisioner) manageEtcd(ctx context.Context, logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster) error {
+	size := 0
+	if value, ok := cluster.ConfigItems[configKeyEtcdInstanceCount]; ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return fmt.Errorf("invalid value for %s: %s", configKeyEtcdInstanceCount, value)
+		}
+		size = parsed
+	}
+
+	manager, err := p.newEtcdManager(logger, adapter, cluster)
+	if err != nil || manager == nil {
+		return err
+	}
+
+	if adapter.dryRun {
+		status, err := manager.client.Status(ctx)
+		if err != nil {
+			return err
+		}
+		manager.logger.Infof("Dry-run: etcd cluster has %d members, not changing it", len(status.Members))
+		return nil
+	}
+
+	return manager.reconcile(ctx, size, cluster.ConfigItems[configKeyEtcdVersion])
+}
+
+// etcdStackParameters returns the parameters keeping the ASG of an existing
+// etcd stack at the current number of members, so updating the stack never
+// adds or removes members. The members are scaled one at a time by manageEtcd
+// after the stack update instead. New stacks and clusters without the
+// etcd_endpoint config item don't get any parameters. The senza definition of
+// the stack must declare the InstanceCount parameter.
+func (p *clusterpyProvisioner) etcdStackParameters(ctx context.Context, logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, stackDefinitionPath string) ([]string, error) {
+	manager, err := p.newEtcdManager(logger, adapter, cluster)
+	if err != nil || manager == nil {
+		return nil, err
+	}
+
+	_, err = adapter.getStackByName(etcdStackNamePrefix + etcdStackVersion(cluster))
+	if isDoesNotExistsErr(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireSenzaParameter(stackDefinitionPath, etcdInstanceCountParameter, "to keep the number of etcd members while updating the stack")
+	if err != nil {
+		return nil, err
+	}
+
+	return manager.stackParameters(ctx)
+}
+
+// newEtcdManager returns the manager of the etcd cluster or nil if the
+// etcd_endpoint config item isn't set.
+func (p *clusterpyProvisioner) newEtcdManager(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster) (*etcdManager, error) {
+	endpoint, ok := cluster.ConfigItems[configKeyEtcdEndpoint]
+	if !ok {
+		return nil, nil
+	}
+
+	client, err := p.etcdHTTPClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return &etcdManager{
+		logger:      logger.WithField("component", "etcd"),
+		client:      etcd.NewClient(endpoint, client),
+		instances:   &asgEtcdInstances{adapter: adapter, stackName: etcdStackNamePrefix + etcdStackVersion(cluster)},
+		stepTimeout: etcdStepTimeout,
+	}, nil
+}
+
+// etcdStackVersion returns the senza version of the etcd stack managed for
+// the cluster. It defaults to 'etcd' and can be changed with the
+// etcd_stack_version config item e.g. to switch to a restored stack.
+func etcdStackVersion(cluster *api.Cluster) string {
+	if version, ok := cluster.ConfigItems[configKeyEtcdStackVersion]; ok {
+		return version
+	}
+	return defaultEtcdStackVersion
+}
+
+// etcdHTTPClient returns an HTTP client for the etcd API of the cluster
+// trusting the etcd_ca and authenticating with the etcd_client_cert and
+// etcd_client_key config items if configured.
+func (p *clusterpyProvisioner) etcdHTTPClient(cluster *api.Cluster) (*http.Client, error) {
+	transport, err := p.httpConfig.Transport([]byte(cluster.ConfigItems[configKeyEtcdCA]))
+	if err != nil {
+		return nil, err
+	}
+
+	cert, hasCert := cluster.ConfigItems[configKeyEtcdClientCert]
+	key, hasKey := cluster.ConfigItems[configKeyEtcdClientKey]
+	if hasCert != hasKey {
+		return nil, fmt.Errorf("%s and %s must be configured together", configKeyEtcdClientCert, configKeyEtcdClientKey)
+	}
+
+	if hasCert {
+		keyPair, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid etcd client certificate: %v", err)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{keyPair}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// reconcile scales the cluster to size members and upgrades all members to
+// version. A size of 0 or an empty version skip the respective step.
+func (m *etcdManager) reconcile(ctx context.Context, size int, version string) error {
+	status, err := m.client.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = status.VerifyQuorum()
+	if err != nil {
+		return fmt.Errorf("etcd cluster unhealthy, not changing it: %v", err)
+	}
+
+	if size > 0 {
+		err = m.scale(ctx, len(status.Members), size)
+		if err != nil {
+			return err
+		}
+	}
+
+	if version != "" {
+		return m.upgrade(ctx, version)
+	}
+
+	return nil
+}
+
+// stackParameters returns the etcd stack parameters pinning the size of the
+// ASG to the current number of members. The quorum must be healthy, otherwise
+// the stack isn't updated at all.
+func (m *etcdManager) stackParameters(ctx context.Context) ([]string, error) {
+	status, err := m.client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = status.VerifyQuorum()
+	if err != nil {
+		return nil, fmt.Errorf("etcd cluster unhealthy, not updating the etcd stack: %v", err)
+	}
+
+	return []string{fmt.Sprintf("%s=%d", etcdInstanceCountParameter, len(status.Members))}, nil
+}
+
+// waitForMembers waits until the cluster has count members, has a healthy
+// quorum and check (if not nil) succeeds.
+func (m *etcdManager) waitForMembers(ctx context.Context, count int, check func(*etcd.ClusterStatus) error) (*etcd.ClusterStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.stepTimeout)
+	defer cancel()
+
+	for {
+		status, err := m.client.Status(ctx)
+		if err == nil {
+			if len(status.Members) != count {
+				err = fmt.Errorf("%d members, expected %d", len(status.Members), count)
+			} else {
+				err = status.VerifyQuorum()
+			}
+		}
+		if err == nil && check != nil {
+			err = check(status)
+		}
+		if err == nil {
+			return status, nil
+		}
+
+		m.logger.Debugf("Waiting for etcd cluster: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for etcd cluster: %v", err)
+		case <-time.After(etcdPollInterval):
+		}
+	}
+}
+
+// scale adds or removes one member at a time until the cluster has size
+// members.
+func (m *etcdManager) scale(ctx context.Context, current, size int) error {
+	for current < size {
+		m.logger.Infof("Scaling etcd cluster from %d to %d members", current, current+1)
+		err := m.instances.SetDesiredCapacity(current + 1)
+		if err != nil {
+			return err
+		}
+
+		_, err = m.waitForMembers(ctx, current+1, nil)
+		if err != nil {
+			return err
+		}
+		current++
+	}
+
+	for current > size {
+		m.logger.Infof("Scaling etcd cluster from %d to %d members", current, current-1)
+		status, err := m.client.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		candidates := followers(status)
+		if len(candidates) == 0 {
+			return fmt.Errorf("no follower found to remove")
+		}
+
+		err = m.removeMember(ctx, candidates[0].Member, true)
+		if err != nil {
+			return err
+		}
+
+		_, err = m.waitForMembers(ctx, current-1, nil)
+		if err != nil {
+			return err
+		}
+		current--
+	}
+
+	return nil
+}
+
+// upgrade replaces the members not running version one at a time, the leader
+// last to minimize the number of leader elections. The replacement instances
+// are expected to run the new version, which is configured by the etcd
+// stack.
+func (m *etcdManager) upgrade(ctx context.Context, version string) error {
+	for {
+		status, err := m.client.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		outdated := outdatedMembers(status, version)
+		if len(outdated) == 0 {
+			return nil
+		}
+
+		member := outdated[0].Member
+		m.logger.Infof("Upgrading etcd member %s from %s to %s (%d outdated)", member.Name, outdated[0].Version, version, len(outdated))
+
+		previous := make(map[string]bool, len(status.Members))
+		for _, existing := range status.Members {
+			previous[existing.Member.ID] = true
+		}
+
+		err = m.removeMember(ctx, member, false)
+		if err != nil {
+			return err
+		}
+
+		// the replacement must run the new version, otherwise the
+		// upgrade would never finish.
+		_, err = m.waitForMembers(ctx, len(status.Members), func(status *etcd.ClusterStatus) error {
+			for _, replacement := range status.Members {
+				if previous[replacement.Member.ID] {
+					continue
+				}
+				if replacement.Version != version {
+					return fmt.Errorf("replacement member %s runs %s, expected %s", replacement.Member.Name, replacement.Version, version)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// removeMember removes the member from the cluster and terminates its
+// instance. If decrementDesired is false the instance is replaced by a new
+// one joining the cluster.
+func (m *etcdManager) removeMember(ctx context.Context, member *etcd.Member, decrementDesired bool) error {
+	instances, err := m.instances.Instances()
+	if err != nil {
+		return err
+	}
+
+	instance := memberInstance(member, instances)
+	if instance == nil {
+		return fmt.Errorf("no instance found for etcd member %s", member.Name)
+	}
+
+	err = m.client.RemoveMember(ctx, member.ID)
+	if err != nil {
+		return fmt.Errorf("failed to remove etcd member %s: %v", member.Name, err)
+	}
+
+	return m.instances.Terminate(instance.id, decrementDesired)
+}
+
+// followers returns the healthy members which aren't the leader.
+func followers(status *etcd.ClusterStatus) []*etcd.MemberStatus {
+	var result []*etcd.MemberStatus
+	for _, member := range status.Members {
+		if member.Err == nil && !member.Leader {
+			result = append(result, member)
+		}
+	}
+	return result
+}
+
+// outdatedMembers returns the members not running version with the leader
+// ordered last.
+func outdatedMembers(status *etcd.ClusterStatus, version string) []*etcd.MemberStatus {
+	var result []*etcd.MemberStatus
+	var leader *etcd.MemberStatus
+	for _, member := range status.Members {
+		if member.Version == version {
+			continue
+		}
+		if member.Leader {
+			leader = member
+			continue
+		}
+		result = append(result, member)
+	}
+	if leader != nil {
+		result = append(result, leader)
+	}
+	return result
+}
+
+// memberInstance returns the instance running the member by matching the
+// hosts of the member's URLs with the addresses of the instances.
+func memberInstance(member *etcd.Member, instances []*etcdInstance) *etcdInstance {
+	hosts := make(map[string]bool)
+	for _, memberURL := range append(member.PeerURLs, member.ClientURLs...) {
+		parsed, err := url.Parse(memberURL)
+		if err != nil {
+			continue
+		}
+		hosts[parsed.Hostname()] = true
+	}
+
+	for _, instance := range instances {
+		for _, address := range instance.addresses {
+			if hosts[address] {
+				return instance
+			}
+		}
+	}
+	return nil
+}
+
+// asgEtcdInstances manages the instances of the ASG of the etcd stack.
+type asgEtcdInstances struct {
+	adapter   *awsAdapter
+	stackName string
+}
+
+// group returns the ASG of the etcd stack.
+func (a *asgEtcdInstances) group() (*autoscaling.Group, error) {
+	params := &autoscaling.DescribeAutoScalingGroupsInput{}
+	for {
+		resp, err := a.adapter.autoscalingClient.DescribeAutoScalingGroups(params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range resp.AutoScalingGroups {
+			for _, tag := range group.Tags {
+				if aws.StringValue(tag.Key) == cloudformationStackNameTag && aws.StringValue(tag.Value) == a.stackName {
+					return group, nil
+				}
+			}
+		}
+
+		if resp.NextToken == nil {
+			return nil, fmt.Errorf("no autoscaling group found for stack %s", a.stackName)
+		}
+		params.NextToken = resp.NextToken
+	}
+}
+
+// Instances returns the running instances of the ASG.
+func (a *asgEtcdInstances) Instances() ([]*etcdInstance, error) {
+	group, err := a.group()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(group.Instances) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]*string, 0, len(group.Instances))
+	for _, instance := range group.Instances {
+		ids = append(ids, instance.InstanceId)
+	}
+
+	resp, err := a.adapter.ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: ids})
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []*etcdInstance
+	for _, reservation := range resp.Reservations {
+		for _, instance := range reservation.Instances {
+			instances = append(instances, &etcdInstance{
+				id: aws.StringValue(instance.InstanceId),
+				addresses: []string{
+					aws.StringValue(instance.PrivateIpAddress),
+					aws.StringValue(instance.PrivateDnsName),
+				},
+			})
+		}
+	}
+	return instances, nil
+}
+
+// SetDesiredCapacity sets the size of the ASG.
+func (a *asgEtcdInstances) SetDesiredCapacity(capacity int) error {
+	group, err := a.group()
+	if err != nil {
+		return err
+	}
+
+	_, err = a.adapter.autoscalingClient.UpdateAutoScalingGroup(&autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: group.AutoScalingGroupName,
+		MinSize:              aws.Int64(int64(capacity)),
+		MaxSize:              aws.Int64(int64(capacity)),
+		DesiredCapacity:      aws.Int64(int64(capacity)),
+	})
+	a.adapter.audit.Record(audit.KindAWS, fmt.Sprintf("scale-etcd:%d", capacity), aws.StringValue(group.AutoScalingGroupName), err)
+	return err
+}
+
+// Terminate terminates the instance. If decrementDesired is true the ASG is
+// shrunk by one instance, otherwise the instance is replaced.
+func (a *asgEtcdInstances) Terminate(instanceID string, decrementDesired bool) error {
+	if decrementDesired {
+		group, err := a.group()
+		if err != nil {
+			return err
+		}
+
+		// the minimum size must be lowered to allow decrementing the
+		// desired capacity.
+		capacity := aws.Int64Value(group.DesiredCapacity) - 1
+		_, err = a.adapter.autoscalingClient.UpdateAutoScalingGroup(&autoscaling.UpdateAutoScalingGroupInput{
+			AutoScalingGroupName: group.AutoScalingGroupName,
+			MinSize:              aws.Int64(capacity),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := a.adapter.autoscalingClient.TerminateInstanceInAutoScalingGroup(&autoscaling.TerminateInstanceInAutoScalingGroupInput{
+		InstanceId:                     aws.String(instanceID),
+		ShouldDecrementDesiredCapacity: aws.Bool(decrementDesired),
+	})
+	a.adapter.audit.Record(audit.KindAWS, "terminate-instance", instanceID, err)
+	return err
+}
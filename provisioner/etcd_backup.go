@@ -0,0 +1,226 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+)
+
+const (
+	configKeyEtcdBackupMaxAge     = "etcd_backup_max_age"
+	configKeyEtcdBackupPrefix     = "etcd_backup_prefix"
+	configKeyForceEtcdBackup      = "force_etcd_backup"
+	defaultEtcdBackupMaxAge       = 24 * time.Hour
+	etcdRestoreStackVersionFormat = "restore20060102150405"
+	etcdRestoreSnapshotParameter  = "EtcdRestoreSnapshot"
+	etcdStackDefinitionFile       = "cluster/etcd-cluster.yaml"
+	s3ErrCodeNotFound             = "NotFound"
+)
+
+// latestEtcdBackup returns the most recent object in the backup bucket with
+// the given prefix or nil if there are no backups.
+func (a *awsAdapter) latestEtcdBackup(bucket, prefix string) (*s3.Object, error) {
+	var latest *s3.Object
+
+	params := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+	err := a.s3Client.ListObjectsV2Pages(params, func(resp *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range resp.Contents {
+			// skip 'directories' created by the S3 console.
+			if strings.HasSuffix(aws.StringValue(object.Key), "/") {
+				continue
+			}
+			if latest == nil || aws.TimeValue(object.LastModified).After(aws.TimeValue(latest.LastModified)) {
+				latest = object
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list etcd backups in s3://%s/%s: %v", bucket, prefix, err)
+	}
+	return latest, nil
+}
+
+// etcdBackupMaxAge returns the maximum age of the latest etcd backup
+// configured by the etcd_backup_max_age config item. 0 is returned if it's
+// not configured.
+func etcdBackupMaxAge(cluster *api.Cluster) (time.Duration, error) {
+	value, ok := cluster.ConfigItems[configKeyEtcdBackupMaxAge]
+	if !ok {
+		return 0, nil
+	}
+
+	maxAge, err := time.ParseDuration(value)
+	if err != nil || maxAge <= 0 {
+		return 0, fmt.Errorf("invalid value for %s: %s", configKeyEtcdBackupMaxAge, value)
+	}
+	return maxAge, nil
+}
+
+// verifyEtcdBackup verifies that the etcd backup bucket of the cluster
+// contains a backup which isn't older than maxAge.
+func verifyEtcdBackup(adapter *awsAdapter, cluster *api.Cluster, maxAge time.Duration, now time.Time) (*s3.Object, error) {
+	bucket, err := etcdBackupBucket(cluster)
+	if err != nil {
+		return nil, err
+	}
+	prefix := cluster.ConfigItems[configKeyEtcdBackupPrefix]
+
+	latest, err := adapter.latestEtcdBackup(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if latest == nil {
+		return nil, fmt.Errorf("no etcd backups found in s3://%s/%s", bucket, prefix)
+	}
+
+	age := now.Sub(aws.TimeValue(latest.LastModified))
+	if age > maxAge {
+		return latest, fmt.Errorf("latest etcd backup s3://%s/%s is %s old, expected at most %s", bucket, aws.StringValue(latest.Key), age.Round(time.Minute), maxAge)
+	}
+
+	return latest, nil
+}
+
+// checkEtcdBackup verifies that a recent etcd backup exists before the etcd
+// stack and the control plane of an existing cluster are updated. It's a
+// noop unless the etcd_backup_max_age config item is set. The check can be
+// overridden by setting the force_etcd_backup config item to 'true'.
+func (p *clusterpyProvisioner) checkEtcdBackup(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster) error {
+	maxAge, err := etcdBackupMaxAge(cluster)
+	if err != nil {
+		return err
+	}
+
+	if maxAge == 0 {
+		return nil
+	}
+
+	// new clusters don't have any data to back up yet.
+	switch cluster.LifecycleStatus {
+	case models.ClusterLifecycleStatusRequested, models.ClusterUpdateLifecycleStatusCreating:
+		return nil
+	}
+
+	backup, err := verifyEtcdBackup(adapter, cluster, maxAge, time.Now())
+	if err != nil {
+		if cluster.ConfigItems[configKeyForceEtcdBackup] == "true" {
+			logger.Warnf("Updating the control plane without a recent etcd backup: %v", err)
+			return nil
+		}
+		return fmt.Errorf("refusing to update the control plane (set %s to override): %v", configKeyForceEtcdBackup, err)
+	}
+
+	logger.Infof("Latest etcd backup %s created at %s", aws.StringValue(backup.Key), aws.TimeValue(backup.LastModified).Format(time.RFC3339))
+	return nil
+}
+
+// VerifyEtcdBackup verifies that the etcd backup bucket of the cluster
+// contains a backup which isn't older than the etcd_backup_max_age config
+// item (24h by default).
+func (p *clusterpyProvisioner) VerifyEtcdBackup(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error {
+	adapter, _, _, err := p.prepareProvision(logger, cluster, channelConfig, nil)
+	if err != nil {
+		return err
+	}
+
+	if isMinimalProfile(cluster) {
+		return fmt.Errorf("cluster %s uses the minimal profile and has no etcd stack", cluster.ID)
+	}
+
+	maxAge, err := etcdBackupMaxAge(cluster)
+	if err != nil {
+		return err
+	}
+
+	if maxAge == 0 {
+		maxAge = defaultEtcdBackupMaxAge
+	}
+
+	backup, err := verifyEtcdBackup(adapter, cluster, maxAge, time.Now())
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Latest etcd backup %s created at %s", aws.StringValue(backup.Key), aws.TimeValue(backup.LastModified).Format(time.RFC3339))
+	return nil
+}
+
+// RestoreEtcd provisions a new etcd stack restoring the snapshot, given as a
+// key in the etcd backup bucket of the cluster. The stack gets a new senza
+// version so the existing stack is left untouched. The cluster can be
+// switched to the restored stack by setting the etcd_stack_version config
+// item to the returned version.
+func (p *clusterpyProvisioner) RestoreEtcd(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, snapshot string) (string, error) {
+	auditLog := p.newAuditLog(cluster, auditOperationRestoreEtcd)
+	adapter, _, _, err := p.prepareProvision(logger, cluster, channelConfig, auditLog)
+	if err != nil {
+		return "", err
+	}
+	defer p.storeAuditLog(logger, cluster, auditLog)
+
+	if isMinimalProfile(cluster) {
+		return "", fmt.Errorf("cluster %s uses the minimal profile and has no etcd stack", cluster.ID)
+	}
+
+	bucket, err := etcdBackupBucket(cluster)
+	if err != nil {
+		return "", err
+	}
+	snapshotURL, err := adapter.etcdSnapshotURL(bucket, snapshot)
+	if err != nil {
+		return "", err
+	}
+
+	version := time.Now().UTC().Format(etcdRestoreStackVersionFormat)
+
+	logger.Infof("Restoring etcd snapshot %s into stack %s", snapshotURL, etcdStackNamePrefix+version)
+
+	err = adapter.CreateOrUpdateEtcdStack(
+		ctx,
+		version,
+		path.Join(channelConfig.Path, etcdStackDefinitionFile),
+		cluster,
+		fmt.Sprintf("%s=%s", etcdRestoreSnapshotParameter, snapshotURL),
+	)
+	adapter.audit.Record(audit.KindAWS, "restore-etcd", snapshotURL, err)
+	if err != nil {
+		return "", err
+	}
+
+	return version, nil
+}
+
+// etcdSnapshotURL verifies that the snapshot exists in the bucket and returns
+// its S3 URL.
+func (a *awsAdapter) etcdSnapshotURL(bucket, snapshot string) (string, error) {
+	snapshot = strings.TrimPrefix(snapshot, fmt.Sprintf("s3://%s/", bucket))
+
+	_, err := a.s3Client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(snapshot),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3ErrCodeNotFound {
+			return "", fmt.Errorf("etcd snapshot s3://%s/%s not found", bucket, snapshot)
+		}
+		return "", err
+	}
+
+	return fmt.Sprintf("s3://%s/%s", bucket, snapshot), nil
+}
@@ -0,0 +1,130 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+)
+
+func newEtcdBackupAdapter(now time.Time) *awsAdapter {
+	return &awsAdapter{
+		s3Client: &s3APIStub{
+			objects: []*s3.Object{
+				{Key: aws.String("backups/"), LastModified: aws.Time(now)},
+				{Key: aws.String("backups/snapshot-1.db"), LastModified: aws.Time(now.Add(-3 * time.Hour))},
+				{Key: aws.String("backups/snapshot-2.db"), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+				{Key: aws.String("other/snapshot.db"), LastModified: aws.Time(now.Add(-time.Hour))},
+			},
+		},
+		logger: log.WithField("cluster", "foobar"),
+	}
+}
+
+func TestVerifyEtcdBackup(t *testing.T) {
+	now := time.Now()
+	adapter := newEtcdBackupAdapter(now)
+	cluster := &api.Cluster{
+		InfrastructureAccount: "aws:123456789012",
+		Region:                "eu-central-1",
+		ConfigItems: map[string]string{
+			configKeyEtcdBackupPrefix: "backups/",
+		},
+	}
+
+	backup, err := verifyEtcdBackup(adapter, cluster, 3*time.Hour, now)
+	require.NoError(t, err)
+	require.Equal(t, "backups/snapshot-2.db", aws.StringValue(backup.Key))
+
+	_, err = verifyEtcdBackup(adapter, cluster, time.Hour, now)
+	require.Error(t, err)
+
+	cluster.ConfigItems[configKeyEtcdBackupPrefix] = "missing/"
+	_, err = verifyEtcdBackup(adapter, cluster, 3*time.Hour, now)
+	require.Error(t, err)
+}
+
+func TestCheckEtcdBackup(t *testing.T) {
+	adapter := newEtcdBackupAdapter(time.Now())
+	p := &clusterpyProvisioner{}
+	logger := log.WithField("cluster", "foobar")
+
+	for _, tc := range []struct {
+		msg             string
+		lifecycleStatus string
+		configItems     map[string]string
+		valid           bool
+	}{
+		{
+			msg:         "verification disabled",
+			configItems: map[string]string{},
+			valid:       true,
+		},
+		{
+			msg:         "recent backup",
+			configItems: map[string]string{configKeyEtcdBackupMaxAge: "90m"},
+			valid:       true,
+		},
+		{
+			msg:         "outdated backup",
+			configItems: map[string]string{configKeyEtcdBackupMaxAge: "30m"},
+		},
+		{
+			msg:         "outdated backup forced",
+			configItems: map[string]string{configKeyEtcdBackupMaxAge: "30m", configKeyForceEtcdBackup: "true"},
+			valid:       true,
+		},
+		{
+			msg:             "new cluster",
+			lifecycleStatus: models.ClusterLifecycleStatusRequested,
+			configItems:     map[string]string{configKeyEtcdBackupMaxAge: "30m"},
+			valid:           true,
+		},
+		{
+			msg:         "invalid max age",
+			configItems: map[string]string{configKeyEtcdBackupMaxAge: "yesterday"},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := &api.Cluster{
+				InfrastructureAccount: "aws:123456789012",
+				Region:                "eu-central-1",
+				LifecycleStatus:       tc.lifecycleStatus,
+				ConfigItems:           tc.configItems,
+			}
+			err := p.checkEtcdBackup(logger, adapter, cluster)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestEtcdSnapshotURL(t *testing.T) {
+	adapter := newEtcdBackupAdapter(time.Now())
+
+	url, err := adapter.etcdSnapshotURL("bucket", "backups/snapshot-1.db")
+	require.NoError(t, err)
+	require.Equal(t, "s3://bucket/backups/snapshot-1.db", url)
+
+	url, err = adapter.etcdSnapshotURL("bucket", "s3://bucket/backups/snapshot-1.db")
+	require.NoError(t, err)
+	require.Equal(t, "s3://bucket/backups/snapshot-1.db", url)
+
+	_, err = adapter.etcdSnapshotURL("bucket", "backups/snapshot-3.db")
+	require.Error(t, err)
+}
+
+func TestEtcdStackVersion(t *testing.T) {
+	require.Equal(t, "etcd", etcdStackVersion(&api.Cluster{}))
+	require.Equal(t, "restore20181010120000", etcdStackVersion(&api.Cluster{
+		ConfigItems: map[string]string{configKeyEtcdStackVersion: "restore20181010120000"},
+	}))
+}
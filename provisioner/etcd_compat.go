@@ -0,0 +1,203 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/etcd"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	etcdCompatibilityFile           = "cluster/etcd-compatibility.yaml"
+	configKeyForceEtcdCompatibility = "force_etcd_compatibility"
+)
+
+// loadEtcdCompatibility reads the compatibility matrix shipped in the
+// channel, the etcd minor versions supported by each Kubernetes minor version.
+// nil is returned if the channel doesn't ship a matrix.
+func loadEtcdCompatibility(channelConfig *channel.Config) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(path.Join(channelConfig.Path, etcdCompatibilityFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var matrix map[string][]string
+	err = yaml.UnmarshalStrict(data, &matrix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid etcd compatibility matrix %s: %v", etcdCompatibilityFile, err)
+	}
+
+	for kubernetes, etcdVersions := range matrix {
+		_, err := parseKubeVersion(kubernetes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid etcd compatibility matrix %s: %v", etcdCompatibilityFile, err)
+		}
+
+		for _, etcdVersion := range etcdVersions {
+			_, err := parseKubeVersion(etcdVersion)
+			if err != nil {
+				return nil, fmt.Errorf("invalid etcd compatibility matrix %s: invalid etcd version for Kubernetes %s: %s", etcdCompatibilityFile, kubernetes, etcdVersion)
+			}
+		}
+	}
+
+	return matrix, nil
+}
+
+// validateEtcdCompatibility validates that the Kubernetes version supports
+// the etcd version according to the matrix. Kubernetes versions missing from
+// the matrix are refused since nothing is known about them.
+func validateEtcdCompatibility(matrix map[string][]string, kubernetesVersion, etcdVersion string) error {
+	kubernetes, err := parseKubeVersion(kubernetesVersion)
+	if err != nil {
+		return err
+	}
+
+	etcdMinor, err := parseKubeVersion(etcdVersion)
+	if err != nil {
+		return fmt.Errorf("invalid etcd version: %s", etcdVersion)
+	}
+
+	supported, ok := matrix[kubernetes.String()]
+	if !ok {
+		return fmt.Errorf("Kubernetes %s is not in the etcd compatibility matrix", kubernetes)
+	}
+
+	for _, version := range supported {
+		// the versions are validated when loading the matrix
+		minor, _ := parseKubeVersion(version)
+		if minor == etcdMinor {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("etcd %s is not supported by Kubernetes %s", etcdMinor, kubernetes)
+}
+
+// checkEtcdCompatibility validates the etcd and Kubernetes versions of the
+// cluster against the compatibility matrix of the channel before the etcd
+// stack is updated. The etcd stack is updated before the control plane, so
+// the target etcd version (the etcd_version config item, or the running
+// version if not set) must be supported both by the running API server and
+// by the target Kubernetes version (the kubernetes_version config item). The
+// check can be overridden by setting the force_etcd_compatibility config item
+// to 'true'.
+func (p *clusterpyProvisioner) checkEtcdCompatibility(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if isMinimalProfile(cluster) {
+		return nil
+	}
+
+	matrix, err := loadEtcdCompatibility(channelConfig)
+	if err != nil || matrix == nil {
+		return err
+	}
+
+	err = p.etcdCompatibilityError(ctx, cluster, matrix)
+	if err == nil {
+		return nil
+	}
+
+	if cluster.ConfigItems[configKeyForceEtcdCompatibility] == "true" {
+		logger.Warnf("Ignoring etcd incompatibility: %v", err)
+		return nil
+	}
+
+	return fmt.Errorf("refusing to update the etcd stack (set %s to override): %v", configKeyForceEtcdCompatibility, err)
+}
+
+// etcdCompatibilityError returns an error if the target or running etcd
+// version isn't supported by the running or the target Kubernetes version.
+func (p *clusterpyProvisioner) etcdCompatibilityError(ctx context.Context, cluster *api.Cluster, matrix map[string][]string) error {
+	existing := true
+	switch cluster.LifecycleStatus {
+	case models.ClusterLifecycleStatusRequested, models.ClusterUpdateLifecycleStatusCreating:
+		existing = false
+	}
+
+	etcdVersion := cluster.ConfigItems[configKeyEtcdVersion]
+	if etcdVersion == "" && existing {
+		running, err := p.runningEtcdVersion(ctx, cluster)
+		if err != nil {
+			return err
+		}
+		etcdVersion = running
+	}
+	if etcdVersion == "" {
+		return nil
+	}
+
+	var kubernetesVersions []string
+	if existing {
+		client, err := p.apiServerClient(cluster)
+		if err != nil {
+			return err
+		}
+
+		serverVersion, err := probeAPIServer(client, cluster.APIServerURL)
+		if err != nil {
+			return fmt.Errorf("unable to get the API server version: %v", err)
+		}
+		kubernetesVersions = append(kubernetesVersions, serverVersion.GitVersion)
+	}
+	if target, ok := cluster.ConfigItems[configKeyKubernetesVersion]; ok && target != "" {
+		kubernetesVersions = append(kubernetesVersions, target)
+	}
+
+	for _, kubernetesVersion := range kubernetesVersions {
+		err := validateEtcdCompatibility(matrix, kubernetesVersion, etcdVersion)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runningEtcdVersion returns the oldest etcd version run by the members of
+// the etcd cluster, or an empty string if the CLM has no access to the etcd
+// API because the etcd_endpoint config item isn't set.
+func (p *clusterpyProvisioner) runningEtcdVersion(ctx context.Context, cluster *api.Cluster) (string, error) {
+	endpoint, ok := cluster.ConfigItems[configKeyEtcdEndpoint]
+	if !ok {
+		return "", nil
+	}
+
+	client, err := p.etcdHTTPClient(cluster)
+	if err != nil {
+		return "", err
+	}
+
+	status, err := etcd.NewClient(endpoint, client).Status(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the etcd version: %v", err)
+	}
+
+	var oldest string
+	var oldestVersion kubeVersion
+	for _, member := range status.Members {
+		if member.Err != nil {
+			return "", fmt.Errorf("unable to get the etcd version of member %s: %v", member.Member.Name, member.Err)
+		}
+
+		version, err := parseKubeVersion(member.Version)
+		if err != nil {
+			return "", fmt.Errorf("invalid etcd version of member %s: %s", member.Member.Name, member.Version)
+		}
+
+		if oldest == "" || version.major < oldestVersion.major || (version.major == oldestVersion.major && version.minor < oldestVersion.minor) {
+			oldest = member.Version
+			oldestVersion = version
+		}
+	}
+	return oldest, nil
+}
@@ -0,0 +1,118 @@
+package provisioner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+)
+
+const testEtcdCompatibility = `
+"1.15": ["3.3"]
+"1.16": ["3.3", "3.4"]
+`
+
+func newEtcdCompatibilityChannel(t *testing.T, matrix string) *channel.Config {
+	dir, err := ioutil.TempDir("", "etcd-compatibility")
+	require.NoError(t, err)
+
+	err = os.MkdirAll(path.Join(dir, "cluster"), 0755)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(path.Join(dir, etcdCompatibilityFile), []byte(matrix), 0644)
+	require.NoError(t, err)
+
+	return &channel.Config{Path: dir}
+}
+
+func TestLoadEtcdCompatibility(t *testing.T) {
+	channelConfig := newEtcdCompatibilityChannel(t, testEtcdCompatibility)
+	defer os.RemoveAll(channelConfig.Path)
+
+	matrix, err := loadEtcdCompatibility(channelConfig)
+	require.NoError(t, err)
+	require.Equal(t, []string{"3.3", "3.4"}, matrix["1.16"])
+
+	// channels without a matrix aren't checked
+	matrix, err = loadEtcdCompatibility(&channel.Config{Path: "invalid_folder"})
+	require.NoError(t, err)
+	require.Nil(t, matrix)
+
+	for _, invalid := range []string{
+		"\"1.16\": 3.4\n",
+		"latest: [\"3.4\"]\n",
+		"\"1.16\": [\"latest\"]\n",
+	} {
+		channelConfig := newEtcdCompatibilityChannel(t, invalid)
+		_, err := loadEtcdCompatibility(channelConfig)
+		require.Error(t, err, invalid)
+		os.RemoveAll(channelConfig.Path)
+	}
+}
+
+func TestValidateEtcdCompatibility(t *testing.T) {
+	matrix := map[string][]string{
+		"1.15": {"3.3"},
+		"1.16": {"3.3", "3.4"},
+	}
+
+	for _, tc := range []struct {
+		kubernetes string
+		etcd       string
+		valid      bool
+	}{
+		{kubernetes: "v1.16.2", etcd: "3.4.3", valid: true},
+		{kubernetes: "v1.16.2", etcd: "v3.3.17", valid: true},
+		{kubernetes: "1.15", etcd: "3.3.17", valid: true},
+		{kubernetes: "v1.15.5", etcd: "3.4.3", valid: false},
+		{kubernetes: "v1.17.0", etcd: "3.4.3", valid: false},
+		{kubernetes: "v1.16.2", etcd: "latest", valid: false},
+	} {
+		err := validateEtcdCompatibility(matrix, tc.kubernetes, tc.etcd)
+		if tc.valid {
+			require.NoError(t, err, "%s/%s", tc.kubernetes, tc.etcd)
+		} else {
+			require.Error(t, err, "%s/%s", tc.kubernetes, tc.etcd)
+		}
+	}
+}
+
+func TestCheckEtcdCompatibility(t *testing.T) {
+	channelConfig := newEtcdCompatibilityChannel(t, testEtcdCompatibility)
+	defer os.RemoveAll(channelConfig.Path)
+
+	p := &clusterpyProvisioner{}
+	logger := log.WithField("test", true)
+
+	// new clusters are checked against the target versions only
+	cluster := &api.Cluster{
+		LifecycleStatus: models.ClusterLifecycleStatusRequested,
+		ConfigItems: map[string]string{
+			configKeyKubernetesVersion: "v1.15.5",
+			configKeyEtcdVersion:       "3.4.3",
+		},
+	}
+	err := p.checkEtcdCompatibility(context.Background(), logger, cluster, channelConfig)
+	require.Error(t, err)
+
+	cluster.ConfigItems[configKeyForceEtcdCompatibility] = "true"
+	err = p.checkEtcdCompatibility(context.Background(), logger, cluster, channelConfig)
+	require.NoError(t, err)
+
+	delete(cluster.ConfigItems, configKeyForceEtcdCompatibility)
+	cluster.ConfigItems[configKeyKubernetesVersion] = "v1.16.2"
+	err = p.checkEtcdCompatibility(context.Background(), logger, cluster, channelConfig)
+	require.NoError(t, err)
+
+	// without the matrix nothing is checked
+	cluster.ConfigItems[configKeyKubernetesVersion] = "v1.15.5"
+	err = p.checkEtcdCompatibility(context.Background(), logger, cluster, &channel.Config{Path: "invalid_folder"})
+	require.NoError(t, err)
+}
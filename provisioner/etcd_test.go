@@ -0,0 +1,168 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/etcd"
+)
+
+// fakeEtcdCluster emulates an etcd cluster running on an ASG. New instances
+// join the cluster immediately running the configured version.
+type fakeEtcdCluster struct {
+	members    []*etcd.MemberStatus
+	version    string
+	nextID     int
+	terminated []string
+}
+
+func (c *fakeEtcdCluster) addMember() {
+	c.nextID++
+	id := fmt.Sprintf("m%d", c.nextID)
+	leader := id
+	if len(c.members) > 0 {
+		leader = c.members[0].LeaderID
+	}
+	c.members = append(c.members, &etcd.MemberStatus{
+		Member: &etcd.Member{
+			ID:         id,
+			Name:       id,
+			ClientURLs: []string{fmt.Sprintf("https://%s:2379", id)},
+		},
+		Healthy:  true,
+		Leader:   id == leader,
+		LeaderID: leader,
+		Version:  c.version,
+	})
+}
+
+func (c *fakeEtcdCluster) Status(ctx context.Context) (*etcd.ClusterStatus, error) {
+	return &etcd.ClusterStatus{Members: c.members}, nil
+}
+
+func (c *fakeEtcdCluster) RemoveMember(ctx context.Context, id string) error {
+	for i, member := range c.members {
+		if member.Member.ID == id {
+			c.members = append(c.members[:i], c.members[i+1:]...)
+
+			// elect a new leader
+			if member.Leader && len(c.members) > 0 {
+				leader := c.members[0].Member.ID
+				for _, other := range c.members {
+					other.Leader = other.Member.ID == leader
+					other.LeaderID = leader
+				}
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("member %s not found", id)
+}
+
+func (c *fakeEtcdCluster) Instances() ([]*etcdInstance, error) {
+	var instances []*etcdInstance
+	for _, member := range c.members {
+		instances = append(instances, &etcdInstance{id: "i-" + member.Member.ID, addresses: []string{member.Member.ID}})
+	}
+	return instances, nil
+}
+
+func (c *fakeEtcdCluster) SetDesiredCapacity(capacity int) error {
+	for len(c.members) < capacity {
+		c.addMember()
+	}
+	return nil
+}
+
+func (c *fakeEtcdCluster) Terminate(instanceID string, decrementDesired bool) error {
+	c.terminated = append(c.terminated, instanceID)
+	if !decrementDesired {
+		c.addMember()
+	}
+	return nil
+}
+
+func newFakeEtcdManager(size int, version string) (*etcdManager, *fakeEtcdCluster) {
+	cluster := &fakeEtcdCluster{version: version}
+	for i := 0; i < size; i++ {
+		cluster.addMember()
+	}
+
+	return &etcdManager{
+		logger:      log.WithField("component", "etcd"),
+		client:      cluster,
+		instances:   cluster,
+		stepTimeout: 100 * time.Millisecond,
+	}, cluster
+}
+
+func TestEtcdManagerScale(t *testing.T) {
+	etcdPollInterval = time.Millisecond
+
+	manager, cluster := newFakeEtcdManager(3, "3.3.9")
+	require.NoError(t, manager.reconcile(context.Background(), 5, ""))
+	require.Len(t, cluster.members, 5)
+
+	require.NoError(t, manager.reconcile(context.Background(), 3, ""))
+	require.Len(t, cluster.members, 3)
+	require.Equal(t, []string{"i-m2", "i-m3"}, cluster.terminated)
+	require.True(t, cluster.members[0].Leader)
+}
+
+func TestEtcdManagerUpgrade(t *testing.T) {
+	etcdPollInterval = time.Millisecond
+
+	manager, cluster := newFakeEtcdManager(3, "3.3.9")
+	cluster.version = "3.3.10"
+	require.NoError(t, manager.reconcile(context.Background(), 0, "3.3.10"))
+	// the leader is upgraded last
+	require.Equal(t, []string{"i-m2", "i-m3", "i-m1"}, cluster.terminated)
+	require.Len(t, cluster.members, 3)
+	for _, member := range cluster.members {
+		require.Equal(t, "3.3.10", member.Version)
+	}
+
+	// replacements running the old version fail the upgrade
+	manager, cluster = newFakeEtcdManager(3, "3.3.9")
+	err := manager.reconcile(context.Background(), 0, "3.3.10")
+	require.Error(t, err)
+	require.Equal(t, []string{"i-m2"}, cluster.terminated)
+}
+
+func TestEtcdManagerUnhealthy(t *testing.T) {
+	manager, cluster := newFakeEtcdManager(3, "3.3.9")
+	cluster.members[1].Healthy = false
+	require.Error(t, manager.reconcile(context.Background(), 5, ""))
+	require.Len(t, cluster.members, 3)
+}
+
+func TestEtcdManagerStackParameters(t *testing.T) {
+	manager, cluster := newFakeEtcdManager(3, "3.3.9")
+	parameters, err := manager.stackParameters(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"InstanceCount=3"}, parameters)
+
+	cluster.members[1].Healthy = false
+	_, err = manager.stackParameters(context.Background())
+	require.Error(t, err)
+}
+
+func TestMemberInstance(t *testing.T) {
+	instances := []*etcdInstance{
+		{id: "i-1", addresses: []string{"10.0.0.1", "ip-10-0-0-1.eu-central-1.compute.internal"}},
+		{id: "i-2", addresses: []string{"10.0.0.2", "ip-10-0-0-2.eu-central-1.compute.internal"}},
+	}
+
+	member := &etcd.Member{PeerURLs: []string{"https://10.0.0.2:2380"}}
+	require.Equal(t, instances[1], memberInstance(member, instances))
+
+	member = &etcd.Member{ClientURLs: []string{"https://ip-10-0-0-1.eu-central-1.compute.internal:2379"}}
+	require.Equal(t, instances[0], memberInstance(member, instances))
+
+	member = &etcd.Member{ClientURLs: []string{"https://10.0.0.3:2379"}}
+	require.Nil(t, memberInstance(member, instances))
+}
@@ -0,0 +1,135 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const (
+	configKeyFailureInjection   = "failure_injection"
+	failureInjectionEnvironment = "test"
+
+	failurePointStackUpdate   = "stack_update"
+	failurePointDrainTimeout  = "drain_timeout"
+	failurePointAPIServerFlap = "apiserver_flap"
+)
+
+var (
+	// failureInjectionRand returns a random number in [0.0,1.0). It's
+	// defined as a variable so it can be replaced in tests.
+	failureInjectionRand = func() func() float64 {
+		var mutex sync.Mutex
+		source := rand.New(rand.NewSource(time.Now().UnixNano()))
+		return func() float64 {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return source.Float64()
+		}
+	}()
+
+	knownFailurePoints = map[string]bool{
+		failurePointStackUpdate:   true,
+		failurePointDrainTimeout:  true,
+		failurePointAPIServerFlap: true,
+	}
+)
+
+// injectedFailureError is the error returned when a failure was injected.
+type injectedFailureError struct {
+	point string
+}
+
+func (e *injectedFailureError) Error() string {
+	return fmt.Sprintf("injected failure: %s", e.point)
+}
+
+// failureInjector injects failures at well-known points of a provisioning
+// run. It's configured by the failure_injection config item as a list of
+// point=probability pairs e.g. 'stack_update=0.1,apiserver_flap=0.5' and is
+// only ever enabled for clusters in the test environment. A nil
+// failureInjector never injects any failures.
+type failureInjector struct {
+	probabilities map[string]float64
+}
+
+// newFailureInjector initializes a failureInjector for the cluster. nil is
+// returned if failure injection is not enabled for the cluster.
+func newFailureInjector(cluster *api.Cluster) (*failureInjector, error) {
+	config, ok := cluster.ConfigItems[configKeyFailureInjection]
+	if !ok || config == "" {
+		return nil, nil
+	}
+
+	if cluster.Environment != failureInjectionEnvironment {
+		return nil, fmt.Errorf("failure injection is only allowed in the %s environment, not %s", failureInjectionEnvironment, cluster.Environment)
+	}
+
+	probabilities := make(map[string]float64)
+	for _, item := range strings.Split(config, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid failure injection item '%s', expected <point>=<probability>", item)
+		}
+
+		if !knownFailurePoints[kv[0]] {
+			return nil, fmt.Errorf("unknown failure injection point: %s", kv[0])
+		}
+
+		probability, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid probability for failure injection point %s: %v", kv[0], err)
+		}
+
+		if probability < 0 || probability > 1 {
+			return nil, fmt.Errorf("probability for failure injection point %s must be between 0 and 1", kv[0])
+		}
+
+		probabilities[kv[0]] = probability
+	}
+
+	return &failureInjector{probabilities: probabilities}, nil
+}
+
+// inject returns an injectedFailureError with the configured probability for
+// the failure point.
+func (f *failureInjector) inject(point string) error {
+	if f == nil {
+		return nil
+	}
+
+	probability, ok := f.probabilities[point]
+	if !ok {
+		return nil
+	}
+
+	if failureInjectionRand() < probability {
+		return &injectedFailureError{point: point}
+	}
+
+	return nil
+}
+
+// failureInjectingNodePoolManager wraps a NodePoolManager and injects drain
+// timeouts when terminating nodes.
+type failureInjectingNodePoolManager struct {
+	updatestrategy.NodePoolManager
+	injector *failureInjector
+}
+
+// TerminateNode simulates a drain timeout before terminating the node.
+func (m *failureInjectingNodePoolManager) TerminateNode(ctx context.Context, node *updatestrategy.Node, decrementDesired bool) error {
+	err := m.injector.inject(failurePointDrainTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to drain node %s: %v", node.Name, err)
+	}
+
+	return m.NodePoolManager.TerminateNode(ctx, node, decrementDesired)
+}
@@ -0,0 +1,92 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestNewFailureInjector(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		environment string
+		config      string
+		enabled     bool
+		valid       bool
+	}{
+		{
+			msg:         "not configured",
+			environment: "production",
+			config:      "",
+			enabled:     false,
+			valid:       true,
+		},
+		{
+			msg:         "configured in test environment",
+			environment: "test",
+			config:      "stack_update=0.5, apiserver_flap=1",
+			enabled:     true,
+			valid:       true,
+		},
+		{
+			msg:         "configured in production environment",
+			environment: "production",
+			config:      "stack_update=0.5",
+			valid:       false,
+		},
+		{
+			msg:         "unknown failure point",
+			environment: "test",
+			config:      "meteor_strike=0.5",
+			valid:       false,
+		},
+		{
+			msg:         "invalid probability",
+			environment: "test",
+			config:      "drain_timeout=2",
+			valid:       false,
+		},
+		{
+			msg:         "invalid format",
+			environment: "test",
+			config:      "drain_timeout",
+			valid:       false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := &api.Cluster{
+				Environment: tc.environment,
+				ConfigItems: map[string]string{configKeyFailureInjection: tc.config},
+			}
+			injector, err := newFailureInjector(cluster)
+			if !tc.valid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.enabled, injector != nil)
+		})
+	}
+}
+
+func TestFailureInjectorInject(t *testing.T) {
+	origRand := failureInjectionRand
+	defer func() { failureInjectionRand = origRand }()
+	failureInjectionRand = func() float64 { return 0.5 }
+
+	injector := &failureInjector{
+		probabilities: map[string]float64{
+			failurePointStackUpdate:  0.6,
+			failurePointDrainTimeout: 0.4,
+		},
+	}
+
+	assert.Error(t, injector.inject(failurePointStackUpdate))
+	assert.NoError(t, injector.inject(failurePointDrainTimeout))
+	assert.NoError(t, injector.inject(failurePointAPIServerFlap))
+
+	var disabled *failureInjector
+	assert.NoError(t, disabled.inject(failurePointStackUpdate))
+}
@@ -0,0 +1,101 @@
+package provisioner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+const (
+	gpuTaintKey    = "nvidia.com/gpu"
+	gpuTaintValue  = "present"
+	gpuTaintEffect = "NoSchedule"
+	gpuLabelKey    = "accelerator"
+)
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// gpuNodePool describes a node pool with GPU instances. It's exposed to the
+// manifest templates such that e.g. the NVIDIA device plugin can be scheduled
+// to the GPU nodes of each pool.
+type gpuNodePool struct {
+	Name         string
+	InstanceType string
+	GPU          int64
+	GPUModel     string
+	// Accelerator is the value of the accelerator node label.
+	Accelerator string
+	TaintKey    string
+	TaintValue  string
+	TaintEffect string
+}
+
+// acceleratorName returns a label safe name of the GPU model e.g.
+// 'nvidia-tesla-k80' for 'NVIDIA Tesla K80'.
+func acceleratorName(model string) string {
+	return strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(model), "-"), "-")
+}
+
+// newGPUNodePool returns the gpuNodePool for the node pool or nil if the
+// instance type of the node pool doesn't have any GPUs. Instance types missing
+// from the bundled instance data are treated as not having any GPUs so new
+// instance types can be used before the data is updated.
+func newGPUNodePool(nodePool *api.NodePool) *gpuNodePool {
+	instanceInfo, err := awsExt.InstanceInfo(nodePool.InstanceType)
+	if err != nil || instanceInfo.GPU == 0 {
+		return nil
+	}
+
+	accelerator := acceleratorName(instanceInfo.GPUModel)
+	if accelerator == "" {
+		accelerator = "gpu"
+	}
+
+	return &gpuNodePool{
+		Name:         nodePool.Name,
+		InstanceType: nodePool.InstanceType,
+		GPU:          instanceInfo.GPU,
+		GPUModel:     instanceInfo.GPUModel,
+		Accelerator:  accelerator,
+		TaintKey:     gpuTaintKey,
+		TaintValue:   gpuTaintValue,
+		TaintEffect:  gpuTaintEffect,
+	}
+}
+
+// gpuNodePools is a template function which returns all node pools with GPU
+// instances.
+func gpuNodePools(nodePools []*api.NodePool) []*gpuNodePool {
+	var result []*gpuNodePool
+	for _, nodePool := range nodePools {
+		if pool := newGPUNodePool(nodePool); pool != nil {
+			result = append(result, pool)
+		}
+	}
+	return result
+}
+
+// setGPUValues sets the values needed by the node pool templates to bootstrap
+// GPU nodes. GPU nodes are tainted such that only pods tolerating the taint,
+// like the device plugin and GPU workloads, are scheduled to them.
+func setGPUValues(nodePool *api.NodePool, values map[string]interface{}) {
+	pool := newGPUNodePool(nodePool)
+	if pool == nil {
+		values["gpu"] = false
+		return
+	}
+
+	values["gpu"] = true
+	values["gpu_count"] = pool.GPU
+	values["gpu_model"] = pool.GPUModel
+	values["node_taints"] = fmt.Sprintf("%s=%s:%s", pool.TaintKey, pool.TaintValue, pool.TaintEffect)
+
+	label := fmt.Sprintf("%s=%s", gpuLabelKey, pool.Accelerator)
+	if labels, ok := values["node_labels"].(string); ok && labels != "" {
+		label = labels + "," + label
+	}
+	values["node_labels"] = label
+}
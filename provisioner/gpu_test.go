@@ -0,0 +1,27 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestAcceleratorName(t *testing.T) {
+	assert.Equal(t, "nvidia-tesla-k80", acceleratorName("NVIDIA Tesla K80"))
+	assert.Equal(t, "nvidia-tesla-v100", acceleratorName(" NVIDIA Tesla V100 "))
+	assert.Equal(t, "", acceleratorName(""))
+}
+
+func TestSetGPUValues(t *testing.T) {
+	values := map[string]interface{}{"node_labels": "lifecycle-status=ready"}
+	setGPUValues(&api.NodePool{InstanceType: "p2.xlarge"}, values)
+	assert.Equal(t, true, values["gpu"])
+	assert.Equal(t, "nvidia.com/gpu=present:NoSchedule", values["node_taints"])
+	assert.Equal(t, "lifecycle-status=ready,accelerator=gpu", values["node_labels"])
+
+	values = map[string]interface{}{"node_labels": "lifecycle-status=ready"}
+	setGPUValues(&api.NodePool{InstanceType: "m4.large"}, values)
+	assert.Equal(t, false, values["gpu"])
+	assert.Equal(t, "lifecycle-status=ready", values["node_labels"])
+}
@@ -0,0 +1,166 @@
+package provisioner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/schedule"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	configKeyHibernate                = "hibernate"
+	configKeyHibernateDeleteNodePools = "hibernate_delete_node_pools"
+	configKeyHibernateSchedule        = "hibernate_schedule"
+	configKeyHibernateMaxPods         = "hibernate_max_pods"
+	controlPlaneProfilePrefix         = "master"
+)
+
+// hibernated returns true if the cluster is hibernated with the hibernate
+// config item.
+func hibernated(cluster *api.Cluster) bool {
+	return cluster.ConfigItems[configKeyHibernate] == "true"
+}
+
+// HibernationScheduled returns true if the hibernate_schedule config item of
+// the cluster hibernates it at the given time.
+func HibernationScheduled(cluster *api.Cluster, now time.Time) (bool, error) {
+	definition, ok := cluster.ConfigItems[configKeyHibernateSchedule]
+	if !ok {
+		return false, nil
+	}
+
+	hibernationSchedule, err := schedule.Parse(definition)
+	if err != nil {
+		return false, err
+	}
+	return hibernationSchedule.Active(now), nil
+}
+
+// hibernate returns true if the node pools of the cluster are to be
+// hibernated. That's the case if the hibernate config item is set or if the
+// hibernation schedule is active and no more than hibernate_max_pods workload
+// pods are running in the cluster, so a cluster still in use overnight isn't
+// scaled down. Clusters which were never provisioned aren't hibernated by the
+// schedule.
+func (p *clusterpyProvisioner) hibernate(logger *log.Entry, cluster *api.Cluster) (bool, error) {
+	if hibernated(cluster) {
+		return true, nil
+	}
+
+	scheduled, err := HibernationScheduled(cluster, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if !scheduled || cluster.Status == nil || cluster.Status.CurrentVersion == "" {
+		return false, nil
+	}
+
+	maxPods := 0
+	if value, ok := cluster.ConfigItems[configKeyHibernateMaxPods]; ok {
+		maxPods, err = strconv.Atoi(value)
+		if err != nil {
+			return false, fmt.Errorf("invalid value %s for %s: %v", value, configKeyHibernateMaxPods, err)
+		}
+	}
+
+	pods, err := p.workloadPods(cluster)
+	if err != nil {
+		return false, fmt.Errorf("failed to count the workload pods: %v", err)
+	}
+	if pods > maxPods {
+		logger.Warnf("Skipping scheduled hibernation, %d workload pods are running (at most %d allowed)", pods, maxPods)
+		return false, nil
+	}
+	return true, nil
+}
+
+// workloadPods returns the number of running pods outside of kube-system
+// which aren't part of a DaemonSet.
+func (p *clusterpyProvisioner) workloadPods(cluster *api.Cluster) (int, error) {
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return 0, err
+	}
+
+	tokenSource, err := p.clusterTokenSource(cluster)
+	if err != nil {
+		return 0, err
+	}
+
+	client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, tokenSource, transport)
+	if err != nil {
+		return 0, err
+	}
+
+	pods, err := client.CoreV1().Pods(v1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: "status.phase=" + string(v1.PodRunning),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, pod := range pods.Items {
+		if pod.Namespace == metav1.NamespaceSystem || daemonSetPod(pod) {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// daemonSetPod returns true if the pod is owned by a DaemonSet.
+func daemonSetPod(pod v1.Pod) bool {
+	for _, owner := range pod.GetOwnerReferences() {
+		if owner.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return false
+}
+
+// isControlPlaneNodePool returns true if the node pool runs the control
+// plane.
+func isControlPlaneNodePool(nodePool *api.NodePool) bool {
+	return strings.HasPrefix(nodePool.Profile, controlPlaneProfilePrefix)
+}
+
+// nodePoolCluster returns the cluster whose node pools are provisioned. If
+// the cluster is to be hibernated that's a copy of the cluster with the worker node pools
+// scaled to zero, or removed if hibernate_delete_node_pools is set so their
+// stacks are deleted like the ones of removed node pools. The control plane
+// node pools and the etcd stack are kept. Removing the hibernate config item
+// resumes the cluster with the next provisioning run.
+func nodePoolCluster(cluster *api.Cluster, hibernate bool) *api.Cluster {
+	if !hibernate {
+		return cluster
+	}
+
+	deleteNodePools := cluster.ConfigItems[configKeyHibernateDeleteNodePools] == "true"
+
+	hibernatedCluster := *cluster
+	hibernatedCluster.NodePools = make([]*api.NodePool, 0, len(cluster.NodePools))
+	for _, nodePool := range cluster.NodePools {
+		if isControlPlaneNodePool(nodePool) {
+			hibernatedCluster.NodePools = append(hibernatedCluster.NodePools, nodePool)
+			continue
+		}
+
+		if deleteNodePools {
+			continue
+		}
+
+		hibernatedPool := *nodePool
+		hibernatedPool.MinSize = 0
+		hibernatedPool.MaxSize = 0
+		hibernatedCluster.NodePools = append(hibernatedCluster.NodePools, &hibernatedPool)
+	}
+	return &hibernatedCluster
+}
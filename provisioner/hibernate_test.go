@@ -0,0 +1,81 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestNodePoolCluster(t *testing.T) {
+	cluster := &api.Cluster{
+		ConfigItems: map[string]string{},
+		NodePools: []*api.NodePool{
+			{Name: "default-master", Profile: "master-default", MinSize: 2, MaxSize: 2},
+			{Name: "default-worker", Profile: "worker-default", MinSize: 3, MaxSize: 20},
+		},
+	}
+
+	require.Equal(t, cluster, nodePoolCluster(cluster, hibernated(cluster)))
+
+	cluster.ConfigItems[configKeyHibernate] = "true"
+	hibernatedCluster := nodePoolCluster(cluster, hibernated(cluster))
+	require.Len(t, hibernatedCluster.NodePools, 2)
+	require.Equal(t, cluster.NodePools[0], hibernatedCluster.NodePools[0])
+	require.EqualValues(t, 0, hibernatedCluster.NodePools[1].MinSize)
+	require.EqualValues(t, 0, hibernatedCluster.NodePools[1].MaxSize)
+
+	// the cluster itself isn't changed
+	require.EqualValues(t, 3, cluster.NodePools[1].MinSize)
+	require.EqualValues(t, 20, cluster.NodePools[1].MaxSize)
+
+	cluster.ConfigItems[configKeyHibernateDeleteNodePools] = "true"
+	hibernatedCluster = nodePoolCluster(cluster, hibernated(cluster))
+	require.Equal(t, []*api.NodePool{cluster.NodePools[0]}, hibernatedCluster.NodePools)
+	require.Len(t, cluster.NodePools, 2)
+}
+
+func TestHibernationScheduled(t *testing.T) {
+	cluster := &api.Cluster{ConfigItems: map[string]string{}}
+
+	scheduled, err := HibernationScheduled(cluster, time.Now())
+	require.NoError(t, err)
+	require.False(t, scheduled)
+
+	cluster.ConfigItems[configKeyHibernateSchedule] = "Mon-Fri 20:00-06:00 UTC"
+	scheduled, err = HibernationScheduled(cluster, time.Date(2019, 11, 19, 2, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.True(t, scheduled)
+
+	scheduled, err = HibernationScheduled(cluster, time.Date(2019, 11, 19, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.False(t, scheduled)
+
+	cluster.ConfigItems[configKeyHibernateSchedule] = "weeknights"
+	_, err = HibernationScheduled(cluster, time.Now())
+	require.Error(t, err)
+}
+
+func TestHibernateUnprovisionedCluster(t *testing.T) {
+	logger := log.WithField("cluster", "foobar")
+	p := &clusterpyProvisioner{}
+	cluster := &api.Cluster{
+		ConfigItems: map[string]string{
+			configKeyHibernateSchedule: "Mon-Sun 00:00-24:00 UTC",
+		},
+		Status: &api.ClusterStatus{},
+	}
+
+	// the workloads of a cluster which was never provisioned aren't
+	// checked, it's not hibernated by the schedule.
+	hibernate, err := p.hibernate(logger, cluster)
+	require.NoError(t, err)
+	require.False(t, hibernate)
+
+	cluster.ConfigItems[configKeyHibernate] = "true"
+	hibernate, err = p.hibernate(logger, cluster)
+	require.NoError(t, err)
+	require.True(t, hibernate)
+}
@@ -0,0 +1,151 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	configKeyIAMPreflight  = "iam_preflight"
+	iamErrCodeAccessDenied = "AccessDenied"
+	iamEvalDecisionAllowed = "allowed"
+)
+
+// iamPreflightActions are the actions the CLM performs while provisioning a
+// cluster, which the role it's using must be allowed to perform.
+var iamPreflightActions = []string{
+	"cloudformation:CreateChangeSet",
+	"cloudformation:CreateStack",
+	"cloudformation:DeleteChangeSet",
+	"cloudformation:DeleteStack",
+	"cloudformation:DescribeChangeSet",
+	"cloudformation:DescribeStackEvents",
+	"cloudformation:DescribeStackResources",
+	"cloudformation:DescribeStacks",
+	"cloudformation:DetectStackDrift",
+	"cloudformation:UpdateStack",
+	"cloudformation:UpdateTerminationProtection",
+	"ec2:CreateTags",
+	"ec2:DeleteTags",
+	"ec2:DescribeImages",
+	"ec2:DescribeInstances",
+	"ec2:DescribeSubnets",
+	"ec2:DescribeVolumes",
+	"ec2:DescribeVpcs",
+	"ec2:GetConsoleOutput",
+	"autoscaling:DescribeAutoScalingGroups",
+	"autoscaling:DescribeScalingActivities",
+	"autoscaling:TerminateInstanceInAutoScalingGroup",
+	"autoscaling:UpdateAutoScalingGroup",
+	"s3:CreateBucket",
+	"s3:GetObject",
+	"s3:PutObject",
+	"elasticloadbalancing:ConfigureHealthCheck",
+	"elasticloadbalancing:DescribeInstanceHealth",
+	"elasticloadbalancing:DescribeLoadBalancers",
+}
+
+// stsAPI is a minimal interface containing only the methods we use from the
+// STS API.
+type stsAPI interface {
+	GetCallerIdentity(input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error)
+}
+
+// checkIAMPermissions simulates the actions the CLM performs with the IAM
+// policies of the role it's using and fails if any of them isn't allowed,
+// before a stack update fails halfway. Clusters opt out by setting the
+// iam_preflight config item to "false". If the role isn't allowed to
+// simulate its policies the check is skipped.
+func checkIAMPermissions(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster) error {
+	if cluster.ConfigItems[configKeyIAMPreflight] == "false" {
+		return nil
+	}
+
+	principal, err := adapter.callerPrincipalARN()
+	if err != nil {
+		if isAccessDeniedErr(err) {
+			logger.Warnf("Skipping the IAM permission preflight: %v", err)
+			return nil
+		}
+		return err
+	}
+
+	missing, err := adapter.deniedActions(principal, iamPreflightActions)
+	if err != nil {
+		if isAccessDeniedErr(err) {
+			logger.Warnf("Skipping the IAM permission preflight: %v", err)
+			return nil
+		}
+		return err
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%s is missing IAM permissions: %s", principal, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// callerPrincipalARN returns the ARN of the IAM principal the adapter is
+// using. The session ARN of an assumed role is resolved to the ARN of the
+// role, which includes its path.
+func (a *awsAdapter) callerPrincipalARN() (string, error) {
+	identity, err := a.stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+
+	// arn:<partition>:sts::<account>:assumed-role/<role name>/<session name>
+	callerARN := aws.StringValue(identity.Arn)
+	fields := strings.SplitN(callerARN, ":", 6)
+	if len(fields) != 6 {
+		return "", fmt.Errorf("invalid caller ARN: %s", callerARN)
+	}
+
+	parts := strings.Split(fields[5], "/")
+	if fields[2] != "sts" || parts[0] != "assumed-role" || len(parts) != 3 {
+		return callerARN, nil
+	}
+
+	role, err := a.iamClient.GetRole(&iam.GetRoleInput{RoleName: aws.String(parts[1])})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(role.Role.Arn), nil
+}
+
+// deniedActions returns the sorted actions the policies of the principal
+// don't allow.
+func (a *awsAdapter) deniedActions(principal string, actions []string) ([]string, error) {
+	var denied []string
+	err := a.iamClient.SimulatePrincipalPolicyPages(&iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principal),
+		ActionNames:     aws.StringSlice(actions),
+	}, func(resp *iam.SimulatePolicyResponse, lastPage bool) bool {
+		for _, result := range resp.EvaluationResults {
+			if aws.StringValue(result.EvalDecision) != iamEvalDecisionAllowed {
+				denied = append(denied, aws.StringValue(result.EvalActionName))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(denied)
+	return denied, nil
+}
+
+// isAccessDeniedErr returns true if the error is an AWS access denied error.
+func isAccessDeniedErr(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == iamErrCodeAccessDenied
+}
@@ -0,0 +1,102 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type stsAPIStub struct {
+	arn string
+}
+
+func (s *stsAPIStub) GetCallerIdentity(input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Arn: aws.String(s.arn)}, nil
+}
+
+type iamSimulationAPIStub struct {
+	iamAPI
+	roles   map[string]string
+	denied  map[string]bool
+	err     error
+	sources []string
+}
+
+func (s *iamSimulationAPIStub) GetRole(input *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	return &iam.GetRoleOutput{Role: &iam.Role{Arn: aws.String(s.roles[aws.StringValue(input.RoleName)])}}, nil
+}
+
+func (s *iamSimulationAPIStub) SimulatePrincipalPolicyPages(input *iam.SimulatePrincipalPolicyInput, fn func(*iam.SimulatePolicyResponse, bool) bool) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sources = append(s.sources, aws.StringValue(input.PolicySourceArn))
+
+	var results []*iam.EvaluationResult
+	for _, action := range input.ActionNames {
+		decision := iamEvalDecisionAllowed
+		if s.denied[aws.StringValue(action)] {
+			decision = "implicitDeny"
+		}
+		results = append(results, &iam.EvaluationResult{EvalActionName: action, EvalDecision: aws.String(decision)})
+	}
+
+	// the results are returned in two pages
+	fn(&iam.SimulatePolicyResponse{EvaluationResults: results[:1]}, false)
+	fn(&iam.SimulatePolicyResponse{EvaluationResults: results[1:]}, true)
+	return nil
+}
+
+func TestCheckIAMPermissions(t *testing.T) {
+	logger := log.WithField("cluster", "kube-1")
+	iamClient := &iamSimulationAPIStub{
+		roles: map[string]string{"cluster-lifecycle-manager": "arn:aws:iam::123456789012:role/system/cluster-lifecycle-manager"},
+	}
+	adapter := &awsAdapter{
+		stsClient: &stsAPIStub{arn: "arn:aws:sts::123456789012:assumed-role/cluster-lifecycle-manager/session"},
+		iamClient: iamClient,
+	}
+
+	err := checkIAMPermissions(logger, adapter, &api.Cluster{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"arn:aws:iam::123456789012:role/system/cluster-lifecycle-manager"}, iamClient.sources)
+
+	iamClient.denied = map[string]bool{"cloudformation:CreateChangeSet": true, "s3:PutObject": true, "ec2:CreateTags": true}
+	err = checkIAMPermissions(logger, adapter, &api.Cluster{})
+	require.Error(t, err)
+	require.Equal(t, "arn:aws:iam::123456789012:role/system/cluster-lifecycle-manager is missing IAM permissions: cloudformation:CreateChangeSet, ec2:CreateTags, s3:PutObject", err.Error())
+
+	// clusters can opt out
+	err = checkIAMPermissions(logger, adapter, &api.Cluster{ConfigItems: map[string]string{configKeyIAMPreflight: "false"}})
+	require.NoError(t, err)
+
+	// the check is skipped if the policies can't be simulated
+	iamClient.err = awserr.New(iamErrCodeAccessDenied, "not authorized to perform iam:SimulatePrincipalPolicy", nil)
+	err = checkIAMPermissions(logger, adapter, &api.Cluster{})
+	require.NoError(t, err)
+
+	iamClient.err = awserr.New("Throttling", "rate exceeded", nil)
+	err = checkIAMPermissions(logger, adapter, &api.Cluster{})
+	require.Error(t, err)
+}
+
+func TestCallerPrincipalARN(t *testing.T) {
+	adapter := &awsAdapter{
+		stsClient: &stsAPIStub{arn: "arn:aws:iam::123456789012:user/deployer"},
+		iamClient: &iamSimulationAPIStub{},
+	}
+
+	principal, err := adapter.callerPrincipalARN()
+	require.NoError(t, err)
+	require.Equal(t, "arn:aws:iam::123456789012:user/deployer", principal)
+
+	adapter.stsClient = &stsAPIStub{arn: "invalid"}
+	_, err = adapter.callerPrincipalARN()
+	require.Error(t, err)
+}
@@ -0,0 +1,315 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/httpclient"
+)
+
+const (
+	configKeyImageRolloutCanaryPool    = "image_rollout_canary_pool"
+	configKeyImageRolloutCanaryCluster = "image_rollout_canary_cluster"
+	configKeyImageRolloutSoakPeriod    = "image_rollout_soak_period"
+	configKeyImageRolloutPrometheusURL = "image_rollout_prometheus_url"
+	configKeyImageRolloutHealthQuery   = "image_rollout_health_query"
+	defaultImageRolloutSoakPeriod      = time.Hour
+	prometheusQueryTimeout             = 30 * time.Second
+)
+
+// imageRollout is the policy for rolling out new images to the node pools of
+// a cluster. New images are first rolled out to the canary node pool and
+// only given to the other node pools once the canary node pool ran the image
+// for the soak period and is healthy. Canary clusters approve the images
+// their node pools ran healthily for the soak period so other clusters can be
+// limited to approved images.
+type imageRollout struct {
+	canaryPool    string
+	canaryCluster bool
+	soakPeriod    time.Duration
+	prometheusURL string
+	healthQuery   string
+	// urgent skips the soak period of the canary node pool for urgent
+	// updates.
+	urgent     bool
+	httpConfig *httpclient.Config
+	// subnets are the subnets of the cluster per availability zone,
+	// used to find the stacks of a canary node pool with zonal stacks.
+	subnets map[string]string
+
+	canaryOnce   sync.Once
+	canaryImage  string
+	canaryReason string
+	canaryErr    error
+}
+
+// newImageRollout returns the image rollout policy configured for the
+// cluster.
+func newImageRollout(cluster *api.Cluster, httpConfig *httpclient.Config, subnets map[string]string) (*imageRollout, error) {
+	rollout := &imageRollout{
+		canaryPool:    cluster.ConfigItems[configKeyImageRolloutCanaryPool],
+		canaryCluster: cluster.ConfigItems[configKeyImageRolloutCanaryCluster] == "true",
+		soakPeriod:    defaultImageRolloutSoakPeriod,
+		prometheusURL: cluster.ConfigItems[configKeyImageRolloutPrometheusURL],
+		healthQuery:   cluster.ConfigItems[configKeyImageRolloutHealthQuery],
+		urgent:        urgentUpdate(cluster),
+		httpConfig:    httpConfig,
+		subnets:       subnets,
+	}
+
+	if value, ok := cluster.ConfigItems[configKeyImageRolloutSoakPeriod]; ok {
+		soakPeriod, err := time.ParseDuration(value)
+		if err != nil || soakPeriod < 0 {
+			return nil, fmt.Errorf("invalid value for %s: %s", configKeyImageRolloutSoakPeriod, value)
+		}
+		rollout.soakPeriod = soakPeriod
+	}
+
+	if rollout.healthQuery != "" && rollout.prometheusURL == "" {
+		return nil, fmt.Errorf("%s requires %s", configKeyImageRolloutHealthQuery, configKeyImageRolloutPrometheusURL)
+	}
+
+	return rollout, nil
+}
+
+// soaked returns an empty string if the image updated at the RFC 3339
+// timestamp passed the soak period, otherwise the reason why not.
+func (r *imageRollout) soaked(updated string) string {
+	since, err := time.Parse(time.RFC3339, updated)
+	if err != nil {
+		return fmt.Sprintf("invalid image update time %s", updated)
+	}
+
+	remaining := r.soakPeriod - time.Since(since)
+	if remaining > 0 {
+		return fmt.Sprintf("soak period ends in %s", remaining.Round(time.Second))
+	}
+	return ""
+}
+
+// imageRolloutBlocked returns an empty string if the image may be rolled out
+// to the node pool, otherwise the reason why the current image of the node
+// pool has to be kept.
+func (p *AWSNodePoolProvisioner) imageRolloutBlocked(nodePool *api.NodePool, image string) (string, error) {
+	if p.rollout == nil || p.rollout.canaryPool == "" || p.rollout.canaryPool == nodePool.Name {
+		return "", nil
+	}
+
+	if p.rollout.urgent {
+		p.logger.Warnf("Urgent update, rolling out image %s to node pool %s without waiting for the canary node pool", image, nodePool.Name)
+		return "", nil
+	}
+
+	r := p.rollout
+	r.canaryOnce.Do(func() {
+		r.canaryImage, r.canaryReason, r.canaryErr = p.canaryStatus()
+	})
+	if r.canaryErr != nil {
+		return "", r.canaryErr
+	}
+
+	if r.canaryImage != image {
+		return fmt.Sprintf("canary node pool %s doesn't run the image yet", r.canaryPool), nil
+	}
+	return r.canaryReason, nil
+}
+
+// canaryStatus returns the image of the canary node pool and an empty string
+// if it passed the soak period and is healthy, otherwise the reason why not.
+// The status is determined once per provisioning run, before the canary node
+// pool is updated.
+func (p *AWSNodePoolProvisioner) canaryStatus() (string, string, error) {
+	var canary *api.NodePool
+	for _, nodePool := range p.Cluster.NodePools {
+		if nodePool.Name == p.rollout.canaryPool {
+			canary = nodePool
+		}
+	}
+	if canary == nil {
+		return "", "", fmt.Errorf("canary node pool %s not found", p.rollout.canaryPool)
+	}
+
+	stackNames := []string{nodePoolStackName(p.Cluster, canary, "")}
+	if zonalStacks(canary) {
+		stackNames = nil
+		for _, zone := range nodePoolZones(p.rollout.subnets) {
+			stackNames = append(stackNames, nodePoolStackName(p.Cluster, canary, zone))
+		}
+	}
+
+	var image string
+	for _, stackName := range stackNames {
+		stack, err := p.awsAdapter.getStackByName(stackName)
+		if err != nil {
+			if isDoesNotExistsErr(err) {
+				return "", fmt.Sprintf("canary stack %s doesn't exist", stackName), nil
+			}
+			return "", "", err
+		}
+
+		var stackImage, updated string
+		for _, tag := range stack.Tags {
+			switch aws.StringValue(tag.Key) {
+			case nodePoolImageTagKey:
+				stackImage = aws.StringValue(tag.Value)
+			case nodePoolImageUpdatedTagKey:
+				updated = aws.StringValue(tag.Value)
+			}
+		}
+
+		if stackImage == "" || (image != "" && stackImage != image) {
+			return "", fmt.Sprintf("canary stack %s doesn't run the image of the canary node pool", stackName), nil
+		}
+		image = stackImage
+
+		if reason := p.rollout.soaked(updated); reason != "" {
+			return image, fmt.Sprintf("canary node pool %s: %s", canary.Name, reason), nil
+		}
+	}
+
+	reason, err := p.nodePoolHealth(canary)
+	if err != nil {
+		return "", "", err
+	}
+	return image, reason, nil
+}
+
+// nodePoolHealth returns an empty string if all nodes of the node pool are
+// updated and ready and the health query of the rollout policy returns no
+// results, otherwise the reason why the node pool is considered unhealthy.
+func (p *AWSNodePoolProvisioner) nodePoolHealth(nodePool *api.NodePool) (string, error) {
+	pool, err := p.nodePoolManager.GetPool(nodePool)
+	if err != nil {
+		return "", err
+	}
+
+	if len(pool.Nodes) == 0 {
+		return fmt.Sprintf("node pool %s has no nodes", nodePool.Name), nil
+	}
+
+	var unhealthy []string
+	for _, node := range pool.Nodes {
+		if !node.Ready || node.Generation != pool.Generation {
+			unhealthy = append(unhealthy, node.Name)
+		}
+	}
+	if len(unhealthy) > 0 {
+		sort.Strings(unhealthy)
+		return fmt.Sprintf("nodes of node pool %s are not updated and ready: %s", nodePool.Name, strings.Join(unhealthy, ", ")), nil
+	}
+
+	if p.rollout.healthQuery == "" {
+		return "", nil
+	}
+
+	series, err := p.rollout.prometheusQuery()
+	if err != nil {
+		return "", fmt.Errorf("failed to run health query: %v", err)
+	}
+	if series > 0 {
+		return fmt.Sprintf("health query returned %d series", series), nil
+	}
+	return "", nil
+}
+
+// prometheusQuery runs the health query against the Prometheus API and
+// returns the number of series in the result. Health queries are expected to
+// return no series for healthy clusters, e.g. firing alerts.
+func (r *imageRollout) prometheusQuery() (int, error) {
+	client, err := r.httpConfig.Client(nil)
+	if err != nil {
+		return 0, err
+	}
+	client.Timeout = prometheusQueryTimeout
+
+	query := strings.TrimSuffix(r.prometheusURL, "/") + "/api/v1/query?" + url.Values{"query": []string{r.healthQuery}}.Encode()
+	resp, err := client.Get(query)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			Result []json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected response with status code %d: %v", resp.StatusCode, err)
+	}
+
+	if result.Status != "success" {
+		return 0, fmt.Errorf("query failed: %s", result.Error)
+	}
+	return len(result.Data.Result), nil
+}
+
+// approveNodePoolImage approves the image of the node pool updated at the
+// RFC 3339 timestamp once it passed the soak period and the node pool is
+// healthy. Only canary clusters approve images.
+func (p *AWSNodePoolProvisioner) approveNodePoolImage(nodePool *api.NodePool, image, updated string) error {
+	if p.rollout == nil || !p.rollout.canaryCluster {
+		return nil
+	}
+
+	if p.images.isApproved(image) {
+		return nil
+	}
+
+	if reason := p.rollout.soaked(updated); reason != "" {
+		p.logger.Debugf("Not approving image %s of node pool %s yet: %s", image, nodePool.Name, reason)
+		return nil
+	}
+
+	reason, err := p.nodePoolHealth(nodePool)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		p.logger.Infof("Not approving image %s of node pool %s: %s", image, nodePool.Name, reason)
+		return nil
+	}
+
+	return p.awsAdapter.approveImage(image)
+}
+
+// approveImage tags the AMI as approved for clusters limited to approved
+// images.
+func (a *awsAdapter) approveImage(id string) error {
+	// planned and rendered updates never change the images
+	if a.plan != nil {
+		return nil
+	}
+
+	if a.dryRun {
+		a.logger.Infof("Dry-run: would approve image %s", id)
+		return nil
+	}
+
+	_, err := a.ec2Client.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String(id)},
+		Tags: []*ec2.Tag{
+			{
+				Key:   aws.String(imageApprovedTagKey),
+				Value: aws.String("true"),
+			},
+		},
+	})
+	a.audit.Record(audit.KindAWS, "approve-image", id, err)
+	if err != nil {
+		return fmt.Errorf("failed to approve image %s: %v", id, err)
+	}
+	return nil
+}
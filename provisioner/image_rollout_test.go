@@ -0,0 +1,228 @@
+package provisioner
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+type ec2TagsAPIStub struct {
+	ec2API
+	tagged []string
+}
+
+func (e *ec2TagsAPIStub) CreateTags(input *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	e.tagged = append(e.tagged, aws.StringValueSlice(input.Resources)...)
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func TestNewImageRollout(t *testing.T) {
+	rollout, err := newImageRollout(&api.Cluster{ConfigItems: map[string]string{}}, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, defaultImageRolloutSoakPeriod, rollout.soakPeriod)
+	require.Empty(t, rollout.canaryPool)
+
+	for _, configItems := range []map[string]string{
+		{configKeyImageRolloutSoakPeriod: "1 day"},
+		{configKeyImageRolloutSoakPeriod: "-1h"},
+		{configKeyImageRolloutHealthQuery: "ALERTS"},
+	} {
+		_, err = newImageRollout(&api.Cluster{ConfigItems: configItems}, nil, nil)
+		require.Error(t, err)
+	}
+}
+
+func TestImageRolloutSoaked(t *testing.T) {
+	rollout := &imageRollout{soakPeriod: time.Hour}
+	require.Empty(t, rollout.soaked(time.Now().Add(-2*time.Hour).Format(time.RFC3339)))
+	require.NotEmpty(t, rollout.soaked(time.Now().Add(-30*time.Minute).Format(time.RFC3339)))
+	require.NotEmpty(t, rollout.soaked(""))
+}
+
+func TestImageRolloutBlocked(t *testing.T) {
+	soaked := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	soaking := time.Now().UTC().Format(time.RFC3339)
+	readyNodes := []*updatestrategy.Node{{Name: "node-1", Ready: true}, {Name: "node-2", Ready: true}}
+
+	for _, tc := range []struct {
+		msg      string
+		nodePool string
+		image    string
+		updated  string
+		nodes    []*updatestrategy.Node
+		blocked  bool
+	}{
+		{
+			msg:      "canary node pool",
+			nodePool: "canary",
+			image:    "ami-2",
+			blocked:  false,
+		},
+		{
+			msg:      "soaked and healthy",
+			nodePool: "default-worker",
+			image:    "ami-1",
+			updated:  soaked,
+			nodes:    readyNodes,
+			blocked:  false,
+		},
+		{
+			msg:      "canary runs a different image",
+			nodePool: "default-worker",
+			image:    "ami-2",
+			updated:  soaked,
+			nodes:    readyNodes,
+			blocked:  true,
+		},
+		{
+			msg:      "soaking",
+			nodePool: "default-worker",
+			image:    "ami-1",
+			updated:  soaking,
+			nodes:    readyNodes,
+			blocked:  true,
+		},
+		{
+			msg:      "nodes not ready",
+			nodePool: "default-worker",
+			image:    "ami-1",
+			updated:  soaked,
+			nodes:    []*updatestrategy.Node{{Name: "node-1", Ready: true}, {Name: "node-2"}},
+			blocked:  true,
+		},
+		{
+			msg:      "no nodes",
+			nodePool: "default-worker",
+			image:    "ami-1",
+			updated:  soaked,
+			blocked:  true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := &api.Cluster{
+				ID: "aws:123456789012:eu-central-1:kube-1",
+				NodePools: []*api.NodePool{
+					{Name: "canary"},
+					{Name: "default-worker"},
+				},
+			}
+			provisioner := &AWSNodePoolProvisioner{
+				awsAdapter: &awsAdapter{
+					cloudformationClient: &cloudFormationAPIStub{
+						statusMutex: &sync.Mutex{},
+						status:      aws.String(cloudformation.StackStatusUpdateComplete),
+						tags: []*cloudformation.Tag{
+							{Key: aws.String(nodePoolImageTagKey), Value: aws.String("ami-1")},
+							{Key: aws.String(nodePoolImageUpdatedTagKey), Value: aws.String(tc.updated)},
+						},
+					},
+				},
+				nodePoolManager: &mockNodePoolManager{remaining: tc.nodes},
+				Cluster:         cluster,
+				logger:          log.WithField("test", true),
+				rollout:         &imageRollout{canaryPool: "canary", soakPeriod: time.Hour},
+			}
+
+			reason, err := provisioner.imageRolloutBlocked(&api.NodePool{Name: tc.nodePool}, tc.image)
+			require.NoError(t, err)
+			if tc.blocked {
+				require.NotEmpty(t, reason)
+			} else {
+				require.Empty(t, reason)
+			}
+		})
+	}
+}
+
+func TestImageRolloutUnknownCanary(t *testing.T) {
+	provisioner := &AWSNodePoolProvisioner{
+		Cluster: &api.Cluster{NodePools: []*api.NodePool{{Name: "default-worker"}}},
+		rollout: &imageRollout{canaryPool: "canary", soakPeriod: time.Hour},
+	}
+	_, err := provisioner.imageRolloutBlocked(&api.NodePool{Name: "default-worker"}, "ami-1")
+	require.Error(t, err)
+}
+
+func TestImageRolloutUrgent(t *testing.T) {
+	// the canary node pool isn't looked up for urgent updates
+	provisioner := &AWSNodePoolProvisioner{
+		Cluster: &api.Cluster{NodePools: []*api.NodePool{{Name: "default-worker"}}},
+		logger:  log.WithField("test", true),
+		rollout: &imageRollout{canaryPool: "canary", soakPeriod: time.Hour, urgent: true},
+	}
+	reason, err := provisioner.imageRolloutBlocked(&api.NodePool{Name: "default-worker"}, "ami-1")
+	require.NoError(t, err)
+	require.Empty(t, reason)
+}
+
+func TestPrometheusQuery(t *testing.T) {
+	series := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v1/query", r.URL.Path)
+		if r.URL.Query().Get("query") == "invalid" {
+			fmt.Fprint(w, `{"status":"error","error":"parse error"}`)
+			return
+		}
+		result := ""
+		for i := 0; i < series; i++ {
+			if i > 0 {
+				result += ","
+			}
+			result += `{"metric":{},"value":[0,"1"]}`
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%s]}}`, result)
+	}))
+	defer server.Close()
+
+	rollout := &imageRollout{prometheusURL: server.URL, healthQuery: "ALERTS"}
+	n, err := rollout.prometheusQuery()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	series = 2
+	n, err = rollout.prometheusQuery()
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	rollout.healthQuery = "invalid"
+	_, err = rollout.prometheusQuery()
+	require.Error(t, err)
+}
+
+func TestApproveNodePoolImage(t *testing.T) {
+	ec2Client := &ec2TagsAPIStub{}
+	provisioner := &AWSNodePoolProvisioner{
+		awsAdapter:      &awsAdapter{ec2Client: ec2Client, logger: log.WithField("test", true)},
+		nodePoolManager: &mockNodePoolManager{remaining: []*updatestrategy.Node{{Name: "node-1", Ready: true}}},
+		logger:          log.WithField("test", true),
+		images:          newTestImageResolver(),
+		rollout:         &imageRollout{canaryCluster: true, soakPeriod: time.Hour},
+	}
+	nodePool := &api.NodePool{Name: "default-worker"}
+
+	require.NoError(t, provisioner.approveNodePoolImage(nodePool, "ami-1", time.Now().Format(time.RFC3339)))
+	require.Empty(t, ec2Client.tagged)
+
+	require.NoError(t, provisioner.approveNodePoolImage(nodePool, "ami-1", time.Now().Add(-2*time.Hour).Format(time.RFC3339)))
+	require.Equal(t, []string{"ami-1"}, ec2Client.tagged)
+
+	provisioner.awsAdapter.plan = &Plan{}
+	require.NoError(t, provisioner.approveNodePoolImage(nodePool, "ami-3", time.Now().Add(-2*time.Hour).Format(time.RFC3339)))
+	require.Equal(t, []string{"ami-1"}, ec2Client.tagged)
+	provisioner.awsAdapter.plan = nil
+
+	provisioner.rollout.canaryCluster = false
+	require.NoError(t, provisioner.approveNodePoolImage(nodePool, "ami-2", time.Now().Add(-2*time.Hour).Format(time.RFC3339)))
+	require.Equal(t, []string{"ami-1"}, ec2Client.tagged)
+}
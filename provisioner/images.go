@@ -0,0 +1,290 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	nodePoolConfigKeyImage         = "image"
+	nodePoolConfigKeyImageRollback = "image_rollback"
+	configKeyImageOwners           = "image_owners"
+	configKeyImageApprovedOnly     = "image_approved_only"
+	defaultImageOwners             = "self"
+	nodePoolImageTagKey            = "kubernetes.io/node-pool/image"
+	nodePoolPreviousImageTagKey    = "kubernetes.io/node-pool/previous-image"
+	nodePoolImageUpdatedTagKey     = "kubernetes.io/node-pool/image-updated"
+	// imageApprovedTagKey is the tag canary clusters add to AMIs which
+	// passed the soak period.
+	imageApprovedTagKey = "cluster-lifecycle-manager.zalando.org/image-approved"
+	// imageValueKey is the node pool template value containing the
+	// resolved AMI ID.
+	imageValueKey           = "image"
+	imageVersionLatest      = "latest"
+	imageSSMParameterPrefix = "ssm:"
+)
+
+// imageResolver translates the symbolic images of node pools to AMI IDs.
+// Images are resolved once per provisioning run so all node pools get the
+// same AMI for the same image.
+type imageResolver struct {
+	ec2Client ec2API
+	ssmClient ssmAPI
+	owners    []string
+	// approvedOnly limits the images looked up by name to the ones
+	// approved by a canary cluster.
+	approvedOnly bool
+
+	sync.Mutex
+	cache    map[string]string
+	approved map[string]bool
+}
+
+// newImageResolver initializes a new imageResolver looking up images owned
+// by the accounts configured with the image_owners config item.
+func newImageResolver(adapter *awsAdapter, cluster *api.Cluster) *imageResolver {
+	owners, ok := cluster.ConfigItems[configKeyImageOwners]
+	if !ok {
+		owners = defaultImageOwners
+	}
+
+	return &imageResolver{
+		ec2Client:    adapter.ec2Client,
+		ssmClient:    ssm.New(adapter.session),
+		owners:       split(owners, ","),
+		approvedOnly: cluster.ConfigItems[configKeyImageApprovedOnly] == "true",
+		cache:        make(map[string]string),
+		approved:     make(map[string]bool),
+	}
+}
+
+// resolve returns the AMI ID of the image. The image is either an AMI ID
+// (ami-<id>), an SSM parameter containing the AMI ID (ssm:<parameter>), e.g.
+// one of the public parameters published by AWS, the AMI named
+// <name>-<version> (<name>:<version>) or the most recent AMI named
+// <name>-<version> (<name>:latest).
+func (r *imageResolver) resolve(image string) (string, error) {
+	if strings.HasPrefix(image, "ami-") {
+		return image, nil
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if id, ok := r.cache[image]; ok {
+		return id, nil
+	}
+
+	var id string
+	var err error
+	if strings.HasPrefix(image, imageSSMParameterPrefix) {
+		id, err = r.resolveSSMParameter(strings.TrimPrefix(image, imageSSMParameterPrefix))
+	} else {
+		id, err = r.resolveName(image)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve image %s: %v", image, err)
+	}
+
+	r.cache[image] = id
+	return id, nil
+}
+
+func (r *imageResolver) resolveSSMParameter(name string) (string, error) {
+	resp, err := r.ssmClient.GetParameter(&ssm.GetParameterInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	id := aws.StringValue(resp.Parameter.Value)
+	if !strings.HasPrefix(id, "ami-") {
+		return "", fmt.Errorf("parameter %s doesn't contain an AMI ID", name)
+	}
+	return id, nil
+}
+
+func (r *imageResolver) resolveName(image string) (string, error) {
+	parts := strings.Split(image, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("expected ami-<id>, ssm:<parameter> or <name>:<version>")
+	}
+
+	name := parts[0] + "-" + parts[1]
+	if parts[1] == imageVersionLatest {
+		name = parts[0] + "-*"
+	}
+
+	filters := []*ec2.Filter{
+		{
+			Name:   aws.String("name"),
+			Values: []*string{aws.String(name)},
+		},
+		{
+			Name:   aws.String("state"),
+			Values: []*string{aws.String(ec2.ImageStateAvailable)},
+		},
+	}
+	if r.approvedOnly {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("tag:" + imageApprovedTagKey),
+			Values: []*string{aws.String("true")},
+		})
+	}
+
+	resp, err := r.ec2Client.DescribeImages(&ec2.DescribeImagesInput{
+		Owners:  aws.StringSlice(r.owners),
+		Filters: filters,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.Images) == 0 {
+		if r.approvedOnly {
+			return "", fmt.Errorf("no approved image named %s found", name)
+		}
+		return "", fmt.Errorf("no image named %s found", name)
+	}
+
+	if parts[1] != imageVersionLatest && len(resp.Images) > 1 {
+		return "", fmt.Errorf("found %d images named %s", len(resp.Images), name)
+	}
+
+	// the creation dates are ISO 8601 timestamps which sort
+	// lexicographically.
+	images := resp.Images
+	sort.Slice(images, func(i, j int) bool {
+		return aws.StringValue(images[i].CreationDate) > aws.StringValue(images[j].CreationDate)
+	})
+
+	id := aws.StringValue(images[0].ImageId)
+	for _, tag := range images[0].Tags {
+		if aws.StringValue(tag.Key) == imageApprovedTagKey && aws.StringValue(tag.Value) == "true" {
+			r.approved[id] = true
+		}
+	}
+	return id, nil
+}
+
+// isApproved returns true if the image was approved by a canary cluster when
+// it was resolved. Only images looked up by name are known to be approved.
+func (r *imageResolver) isApproved(id string) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.approved[id]
+}
+
+// resolveNodePoolImage resolves the image configured for the node pool with
+// the image config item and sets it as the image value of the node pool
+// templates. The resolved AMI, the one it replaced and the time of the change
+// are recorded as tags of the node pool stack. A new AMI is held back if the
+// image rollout policy of the cluster doesn't allow it yet. Setting the
+// image_rollback config item of the node pool returns to the replaced AMI.
+// Returns the tags to add to the stack.
+func (p *AWSNodePoolProvisioner) resolveNodePoolImage(nodePool *api.NodePool, stackName string, values map[string]interface{}) ([]*cloudformation.Tag, error) {
+	image, ok := nodePool.ConfigItems[nodePoolConfigKeyImage]
+	if !ok {
+		return nil, nil
+	}
+
+	if p.images == nil {
+		return nil, fmt.Errorf("can't resolve image %s of node pool %s", image, nodePool.Name)
+	}
+
+	var current, previous, updated string
+	stack, err := p.awsAdapter.getStackByName(stackName)
+	if err != nil && !isDoesNotExistsErr(err) {
+		return nil, err
+	}
+	if stack != nil {
+		for _, tag := range stack.Tags {
+			switch aws.StringValue(tag.Key) {
+			case nodePoolImageTagKey:
+				current = aws.StringValue(tag.Value)
+			case nodePoolPreviousImageTagKey:
+				previous = aws.StringValue(tag.Value)
+			case nodePoolImageUpdatedTagKey:
+				updated = aws.StringValue(tag.Value)
+			}
+		}
+	}
+
+	var id string
+	rollback := nodePool.ConfigItems[nodePoolConfigKeyImageRollback] == "true"
+	if rollback {
+		if previous == "" {
+			return nil, fmt.Errorf("can't roll back the image of node pool %s, no previous image recorded", nodePool.Name)
+		}
+		// the previous image is kept so the rollback is stable until
+		// the config item is removed.
+		id = previous
+	} else {
+		id, err = p.images.resolve(image)
+		if err != nil {
+			return nil, err
+		}
+
+		if current != "" && current != id {
+			reason, err := p.imageRolloutBlocked(nodePool, id)
+			if err != nil {
+				return nil, err
+			}
+
+			if reason != "" {
+				p.logger.Infof("Holding back image %s (%s) of node pool %s: %s", id, image, nodePool.Name, reason)
+				id = current
+			} else {
+				previous = current
+			}
+		}
+	}
+
+	if id != current {
+		p.logger.Infof("Using image %s (%s) for node pool %s, previously %s", id, image, nodePool.Name, current)
+		updated = ""
+	}
+
+	// the soak period of the image starts when it's first seen on the
+	// stack.
+	if updated == "" {
+		updated = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	if !rollback && id == current {
+		err = p.approveNodePoolImage(nodePool, id, updated)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	values[imageValueKey] = id
+
+	tags := []*cloudformation.Tag{
+		{
+			Key:   aws.String(nodePoolImageTagKey),
+			Value: aws.String(id),
+		},
+		{
+			Key:   aws.String(nodePoolImageUpdatedTagKey),
+			Value: aws.String(updated),
+		},
+	}
+	if previous != "" {
+		tags = append(tags, &cloudformation.Tag{
+			Key:   aws.String(nodePoolPreviousImageTagKey),
+			Value: aws.String(previous),
+		})
+	}
+	return tags, nil
+}
@@ -0,0 +1,152 @@
+package provisioner
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type ec2ImagesAPIStub struct {
+	ec2API
+	images []*ec2.Image
+	calls  int
+}
+
+func (e *ec2ImagesAPIStub) DescribeImages(input *ec2.DescribeImagesInput) (*ec2.DescribeImagesOutput, error) {
+	e.calls++
+	pattern := aws.StringValue(input.Filters[0].Values[0])
+
+	var images []*ec2.Image
+	for _, image := range e.images {
+		name := aws.StringValue(image.Name)
+		if name == pattern || (pattern[len(pattern)-1] == '*' && len(name) >= len(pattern)-1 && name[:len(pattern)-1] == pattern[:len(pattern)-1]) {
+			images = append(images, image)
+		}
+	}
+	return &ec2.DescribeImagesOutput{Images: images}, nil
+}
+
+type imageSSMAPIStub struct{}
+
+func (s *imageSSMAPIStub) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	return &ssm.GetParameterOutput{
+		Parameter: &ssm.Parameter{Value: aws.String("ami-ssm")},
+	}, nil
+}
+
+func newTestImageResolver() *imageResolver {
+	return &imageResolver{
+		ec2Client: &ec2ImagesAPIStub{
+			images: []*ec2.Image{
+				{ImageId: aws.String("ami-1"), Name: aws.String("ubuntu-k8s-1.12-1"), CreationDate: aws.String("2019-01-01T10:00:00.000Z")},
+				{ImageId: aws.String("ami-3"), Name: aws.String("ubuntu-k8s-1.12-3"), CreationDate: aws.String("2019-03-01T10:00:00.000Z")},
+				{ImageId: aws.String("ami-2"), Name: aws.String("ubuntu-k8s-1.12-2"), CreationDate: aws.String("2019-02-01T10:00:00.000Z")},
+			},
+		},
+		ssmClient: &imageSSMAPIStub{},
+		owners:    []string{"self"},
+		cache:     make(map[string]string),
+	}
+}
+
+func TestImageResolver(t *testing.T) {
+	for _, tc := range []struct {
+		image    string
+		expected string
+		err      bool
+	}{
+		{image: "ami-pinned", expected: "ami-pinned"},
+		{image: "ssm:/aws/service/ubuntu/image_id", expected: "ami-ssm"},
+		{image: "ubuntu-k8s-1.12:latest", expected: "ami-3"},
+		{image: "ubuntu-k8s-1.12:2", expected: "ami-2"},
+		{image: "ubuntu-k8s-1.12:4", err: true},
+		{image: "ubuntu-k8s-1.12", err: true},
+	} {
+		t.Run(tc.image, func(t *testing.T) {
+			id, err := newTestImageResolver().resolve(tc.image)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, id)
+		})
+	}
+}
+
+func TestImageResolverCache(t *testing.T) {
+	resolver := newTestImageResolver()
+	for i := 0; i < 2; i++ {
+		id, err := resolver.resolve("ubuntu-k8s-1.12:latest")
+		require.NoError(t, err)
+		require.Equal(t, "ami-3", id)
+	}
+	require.Equal(t, 1, resolver.ec2Client.(*ec2ImagesAPIStub).calls)
+}
+
+func TestResolveNodePoolImage(t *testing.T) {
+	cloudformationClient := &cloudFormationAPIStub{
+		statusMutex: &sync.Mutex{},
+		status:      aws.String(cloudformation.StackStatusUpdateComplete),
+		tags: []*cloudformation.Tag{
+			{Key: aws.String(nodePoolImageTagKey), Value: aws.String("ami-2")},
+		},
+	}
+	provisioner := &AWSNodePoolProvisioner{
+		awsAdapter: &awsAdapter{cloudformationClient: cloudformationClient},
+		logger:     log.WithField("test", true),
+		images:     newTestImageResolver(),
+	}
+	nodePool := &api.NodePool{
+		Name:        "default-worker",
+		ConfigItems: map[string]string{nodePoolConfigKeyImage: "ubuntu-k8s-1.12:latest"},
+	}
+
+	tagValues := func(tags []*cloudformation.Tag) map[string]string {
+		result := make(map[string]string)
+		for _, tag := range tags {
+			result[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+		require.NotEmpty(t, result[nodePoolImageUpdatedTagKey])
+		delete(result, nodePoolImageUpdatedTagKey)
+		return result
+	}
+
+	// a new image replaces the current one
+	values := map[string]interface{}{}
+	tags, err := provisioner.resolveNodePoolImage(nodePool, "nodepool-default-worker", values)
+	require.NoError(t, err)
+	require.Equal(t, "ami-3", values[imageValueKey])
+	require.Equal(t, map[string]string{nodePoolImageTagKey: "ami-3", nodePoolPreviousImageTagKey: "ami-2"}, tagValues(tags))
+
+	// rolling back returns to the replaced image and stays there
+	cloudformationClient.tags = tags
+	nodePool.ConfigItems[nodePoolConfigKeyImageRollback] = "true"
+	for i := 0; i < 2; i++ {
+		values = map[string]interface{}{}
+		tags, err = provisioner.resolveNodePoolImage(nodePool, "nodepool-default-worker", values)
+		require.NoError(t, err)
+		require.Equal(t, "ami-2", values[imageValueKey])
+		require.Equal(t, map[string]string{nodePoolImageTagKey: "ami-2", nodePoolPreviousImageTagKey: "ami-2"}, tagValues(tags))
+		cloudformationClient.tags = tags
+	}
+
+	// rolling back without a previous image fails
+	cloudformationClient.tags = nil
+	_, err = provisioner.resolveNodePoolImage(nodePool, "nodepool-default-worker", map[string]interface{}{})
+	require.Error(t, err)
+
+	// node pools without an image don't get one
+	values = map[string]interface{}{}
+	tags, err = provisioner.resolveNodePoolImage(&api.NodePool{Name: "legacy"}, "nodepool-legacy", values)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+	require.NotContains(t, values, imageValueKey)
+}
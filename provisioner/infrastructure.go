@@ -0,0 +1,137 @@
+package provisioner
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// infrastructureValueKey is the key of the infrastructure facts in the
+	// values of the node pool templates.
+	infrastructureValueKey = "infrastructure"
+	offlineVPCID           = "vpc-offline"
+	offlineVPCCIDR         = "172.31.0.0/16"
+)
+
+var errInfrastructureNotAvailable = errors.New("infrastructure facts are not available in this context")
+
+// infrastructureFacts are the facts about the infrastructure of a cluster
+// exposed to the templates, so they don't have to derive them from config
+// items.
+type infrastructureFacts struct {
+	// AccountID is the AWS account ID of the infrastructure account.
+	AccountID string
+	Region    string
+	// AvailabilityZones are the availability zones of the subnets of the
+	// VPC, sorted by name.
+	AvailabilityZones []string
+	VPCID             string
+	VPCCIDR           string
+	// NATGatewayIPs are the public IPs of the available NAT gateways of the
+	// VPC, sorted.
+	NATGatewayIPs []string
+	// EgressIPs are the elastic IPs of the static egress of the cluster,
+	// sorted. They're only set if static egress is enabled.
+	EgressIPs []string
+}
+
+// newInfrastructureFacts returns the infrastructure facts of the cluster
+// running in the VPC.
+func newInfrastructureFacts(cluster *api.Cluster, vpc *ec2.Vpc, subnets []*ec2.Subnet, natGateways []*ec2.NatGateway) *infrastructureFacts {
+	facts := &infrastructureFacts{
+		AccountID: strings.TrimPrefix(cluster.InfrastructureAccount, "aws:"),
+		Region:    cluster.Region,
+		VPCID:     aws.StringValue(vpc.VpcId),
+		VPCCIDR:   aws.StringValue(vpc.CidrBlock),
+	}
+
+	zones := make(map[string]struct{})
+	for _, subnet := range subnets {
+		zones[aws.StringValue(subnet.AvailabilityZone)] = struct{}{}
+	}
+	for zone := range zones {
+		facts.AvailabilityZones = append(facts.AvailabilityZones, zone)
+	}
+	sort.Strings(facts.AvailabilityZones)
+
+	for _, natGateway := range natGateways {
+		for _, address := range natGateway.NatGatewayAddresses {
+			if ip := aws.StringValue(address.PublicIp); ip != "" {
+				facts.NATGatewayIPs = append(facts.NATGatewayIPs, ip)
+			}
+		}
+	}
+	sort.Strings(facts.NATGatewayIPs)
+
+	return facts
+}
+
+// offlineInfrastructureFacts returns placeholder infrastructure facts for
+// rendering templates without access to AWS. The availability zones match
+// the ones of the offline subnets.
+func offlineInfrastructureFacts(cluster *api.Cluster) *infrastructureFacts {
+	vpc := &ec2.Vpc{
+		VpcId:     aws.String(offlineVPCID),
+		CidrBlock: aws.String(offlineVPCCIDR),
+	}
+	return newInfrastructureFacts(cluster, vpc, offlineSubnets(cluster), nil)
+}
+
+// vpcInfrastructureFacts returns the infrastructure facts of the cluster for
+// the already discovered VPC and subnets.
+func (a *awsAdapter) vpcInfrastructureFacts(cluster *api.Cluster, vpc *ec2.Vpc, subnets []*ec2.Subnet) (*infrastructureFacts, error) {
+	natGateways, err := a.vpcNatGateways(vpc)
+	if err != nil {
+		return nil, err
+	}
+
+	facts := newInfrastructureFacts(cluster, vpc, subnets, natGateways)
+	if staticEgressEnabled(cluster) {
+		facts.EgressIPs, err = a.staticEgressIPs(cluster)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return facts, nil
+}
+
+// vpcNatGateways returns the available NAT gateways of the VPC.
+func (a *awsAdapter) vpcNatGateways(vpc *ec2.Vpc) ([]*ec2.NatGateway, error) {
+	if natGateways, ok := a.lookups.getNatGateways(aws.StringValue(vpc.VpcId)); ok {
+		return natGateways, nil
+	}
+
+	resp, err := a.ec2Client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{
+		Filter: []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{vpc.VpcId},
+			},
+			{
+				Name:   aws.String("state"),
+				Values: []*string{aws.String(ec2.NatGatewayStateAvailable)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.lookups.setNatGateways(aws.StringValue(vpc.VpcId), resp.NatGateways)
+	return resp.NatGateways, nil
+}
+
+// facts is the infrastructure template function. It fails if the
+// infrastructure facts aren't available, e.g. when rendering templates which
+// aren't rendered for a specific cluster.
+func (f *infrastructureFacts) facts() (*infrastructureFacts, error) {
+	if f == nil {
+		return nil, errInfrastructureNotAvailable
+	}
+	return f, nil
+}
@@ -0,0 +1,86 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type ec2InfrastructureAPIStub struct {
+	ec2API
+	natGateways []*ec2.NatGateway
+	filters     []*ec2.Filter
+}
+
+func (e *ec2InfrastructureAPIStub) DescribeNatGateways(input *ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error) {
+	e.filters = input.Filter
+	return &ec2.DescribeNatGatewaysOutput{NatGateways: e.natGateways}, nil
+}
+
+func TestInfrastructureFacts(t *testing.T) {
+	stub := &ec2InfrastructureAPIStub{
+		natGateways: []*ec2.NatGateway{
+			{NatGatewayAddresses: []*ec2.NatGatewayAddress{{PublicIp: aws.String("52.0.0.2")}}},
+			{NatGatewayAddresses: []*ec2.NatGatewayAddress{{PublicIp: aws.String("52.0.0.1")}, {PrivateIp: aws.String("172.31.0.5")}}},
+		},
+	}
+	adapter := &awsAdapter{ec2Client: stub}
+	cluster := &api.Cluster{InfrastructureAccount: "aws:123456789012", Region: "eu-central-1"}
+	vpc := &ec2.Vpc{VpcId: aws.String("vpc-1"), CidrBlock: aws.String("172.31.0.0/16")}
+	subnets := []*ec2.Subnet{
+		{SubnetId: aws.String("subnet-b"), AvailabilityZone: aws.String("eu-central-1b")},
+		{SubnetId: aws.String("subnet-a"), AvailabilityZone: aws.String("eu-central-1a")},
+		{SubnetId: aws.String("subnet-a2"), AvailabilityZone: aws.String("eu-central-1a")},
+	}
+
+	facts, err := adapter.vpcInfrastructureFacts(cluster, vpc, subnets)
+	require.NoError(t, err)
+	require.Equal(t, &infrastructureFacts{
+		AccountID:         "123456789012",
+		Region:            "eu-central-1",
+		AvailabilityZones: []string{"eu-central-1a", "eu-central-1b"},
+		VPCID:             "vpc-1",
+		VPCCIDR:           "172.31.0.0/16",
+		NATGatewayIPs:     []string{"52.0.0.1", "52.0.0.2"},
+	}, facts)
+	require.Equal(t, "vpc-1", aws.StringValue(stub.filters[0].Values[0]))
+}
+
+func TestOfflineInfrastructureFacts(t *testing.T) {
+	cluster := &api.Cluster{InfrastructureAccount: "aws:123456789012", Region: "eu-central-1", ConfigItems: map[string]string{}}
+	facts := offlineInfrastructureFacts(cluster)
+	require.Equal(t, "123456789012", facts.AccountID)
+	require.Equal(t, offlineVPCCIDR, facts.VPCCIDR)
+	require.Len(t, facts.AvailabilityZones, len(offlineZones))
+	require.Empty(t, facts.NATGatewayIPs)
+}
+
+func TestInfrastructureTemplateFunction(t *testing.T) {
+	basedir, err := ioutil.TempDir("", "infrastructure")
+	require.NoError(t, err)
+	defer os.RemoveAll(basedir)
+
+	file := path.Join(basedir, "foo.yaml")
+	err = ioutil.WriteFile(file, []byte(`{{ with infrastructure }}{{ .AccountID }} {{ .VPCCIDR }} {{ range .AvailabilityZones }}{{ . }},{{ end }}{{ end }}`), 0644)
+	require.NoError(t, err)
+
+	context := newTemplateContext(basedir)
+	_, err = renderTemplate(context, file, nil)
+	require.Error(t, err)
+
+	context = newTemplateContext(basedir)
+	context.infrastructure = &infrastructureFacts{
+		AccountID:         "123456789012",
+		VPCCIDR:           "172.31.0.0/16",
+		AvailabilityZones: []string{"eu-central-1a", "eu-central-1b"},
+	}
+	result, err := renderTemplate(context, file, nil)
+	require.NoError(t, err)
+	require.Equal(t, "123456789012 172.31.0.0/16 eu-central-1a,eu-central-1b,", result)
+}
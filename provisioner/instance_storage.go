@@ -0,0 +1,184 @@
+package provisioner
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"text/template"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+const (
+	configKeyInstanceStorage          = "instance_storage"
+	configKeyInstanceStorageMountPath = "instance_storage_mount_path"
+	configKeyInstanceStorageKubelet   = "instance_storage_kubelet"
+
+	instanceStorageRAID0  = "raid0"
+	instanceStorageSingle = "single"
+
+	defaultInstanceStorageMountPath = "/mnt/instance-storage"
+
+	// instanceStoragePartName is the name of the cloud-init part setting up
+	// the instance storage. It sorts before the parts of the profiles so the
+	// storage is ready before anything else runs.
+	instanceStoragePartName = "00-instance-storage.boothook"
+)
+
+var (
+	// instanceStorageMountPath restricts the mount path to paths which are
+	// safe to use in the setup script.
+	instanceStorageMountPath = regexp.MustCompile(`^(/[A-Za-z0-9._-]+)+$`)
+
+	// instanceStorageKubeletDirs are the directories of the kubelet and the
+	// container runtimes moved to the instance storage.
+	instanceStorageKubeletDirs = []string{"/var/lib/kubelet", "/var/lib/docker", "/var/lib/containerd"}
+
+	instanceStorageScript = template.Must(template.New("instance-storage").Parse(`#!/bin/bash
+# Sets up the instance storage of the node. Instance storage is lost when the
+# instance is stopped, so this runs on every boot.
+set -euo pipefail
+
+mount_path="{{ .MountPath }}"
+if mountpoint -q "$mount_path"; then
+  exit 0
+fi
+
+devices=()
+{{- if .NVMe }}
+for device in /dev/disk/by-id/nvme-Amazon_EC2_NVMe_Instance_Storage_*; do
+  if [[ -b "$device" && "$device" != *-part* ]]; then
+    devices+=("$(readlink -f "$device")")
+  fi
+done
+{{- else }}
+metadata="http://169.254.169.254/latest/meta-data/block-device-mapping"
+for name in $(curl -sf "$metadata/" | grep '^ephemeral'); do
+  device="/dev/$(curl -sf "$metadata/$name" | sed 's/^sd/xvd/')"
+  if [[ -b "$device" ]]; then
+    umount "$device" 2>/dev/null || true
+    devices+=("$device")
+  fi
+done
+{{- end }}
+
+if [[ ${#devices[@]} -eq 0 ]]; then
+  echo "No instance storage found" >&2
+  exit 1
+fi
+
+device="${devices[0]}"
+{{- if .RAID }}
+if [[ ${#devices[@]} -gt 1 ]]; then
+  device=/dev/md/instance-storage
+  mdadm --create "$device" --run --force --level=0 --raid-devices=${#devices[@]} "${devices[@]}"
+fi
+{{- end }}
+
+mkfs.ext4 -F -E lazy_itable_init=1,lazy_journal_init=1,nodiscard "$device"
+mkdir -p "$mount_path"
+mount -o defaults,noatime "$device" "$mount_path"
+{{- range .Dirs }}
+
+mkdir -p "$mount_path{{ . }}" "{{ . }}"
+mount --bind "$mount_path{{ . }}" "{{ . }}"
+{{- end }}
+`))
+)
+
+// instanceStorage describes how the instance storage of the nodes of a node
+// pool is set up. It's exposed to the node pool templates as
+// .Values.instance_storage.
+type instanceStorage struct {
+	// RAID combines all devices into a RAID 0 array, otherwise only the
+	// first device is used.
+	RAID bool
+	// Devices and Size (GiB per device) are taken from the instance data.
+	Devices   int64
+	Size      int64
+	NVMe      bool
+	MountPath string
+	// Dirs are bind mounted from the instance storage.
+	Dirs []string
+	// Script sets up the instance storage when run on the node.
+	Script string
+}
+
+// newInstanceStorage returns the instance storage configuration of the node
+// pool or nil if it isn't enabled.
+func newInstanceStorage(nodePool *api.NodePool) (*instanceStorage, error) {
+	layout := nodePool.ConfigItems[configKeyInstanceStorage]
+	switch layout {
+	case "":
+		return nil, nil
+	case instanceStorageRAID0, instanceStorageSingle:
+	default:
+		return nil, fmt.Errorf("invalid value for %s: %s", configKeyInstanceStorage, layout)
+	}
+
+	instanceInfo, err := awsExt.InstanceInfo(nodePool.InstanceType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to set up the instance storage of node pool %s: %v", nodePool.Name, err)
+	}
+	if instanceInfo.InstanceStorageDevices == 0 {
+		return nil, fmt.Errorf("instance type %s of node pool %s has no instance storage", nodePool.InstanceType, nodePool.Name)
+	}
+
+	storage := &instanceStorage{
+		RAID:      layout == instanceStorageRAID0,
+		Devices:   instanceInfo.InstanceStorageDevices,
+		Size:      instanceInfo.InstanceStorageSize,
+		NVMe:      instanceInfo.InstanceStorageNVMe,
+		MountPath: defaultInstanceStorageMountPath,
+	}
+
+	if mountPath, ok := nodePool.ConfigItems[configKeyInstanceStorageMountPath]; ok {
+		if !instanceStorageMountPath.MatchString(mountPath) {
+			return nil, fmt.Errorf("invalid value for %s: %s", configKeyInstanceStorageMountPath, mountPath)
+		}
+		storage.MountPath = mountPath
+	}
+
+	switch kubelet := nodePool.ConfigItems[configKeyInstanceStorageKubelet]; kubelet {
+	case "", "false":
+	case "true":
+		storage.Dirs = instanceStorageKubeletDirs
+	default:
+		return nil, fmt.Errorf("invalid value for %s: %s", configKeyInstanceStorageKubelet, kubelet)
+	}
+
+	var script bytes.Buffer
+	err = instanceStorageScript.Execute(&script, storage)
+	if err != nil {
+		return nil, err
+	}
+	storage.Script = script.String()
+	return storage, nil
+}
+
+// setInstanceStorageValues sets the instance storage configuration of the
+// node pool in the values of its templates. It's always set so the value of
+// a previous node pool doesn't leak.
+func setInstanceStorageValues(nodePool *api.NodePool, values map[string]interface{}) error {
+	storage, err := newInstanceStorage(nodePool)
+	if err != nil {
+		return err
+	}
+	values[configKeyInstanceStorage] = storage
+	return nil
+}
+
+// instanceStoragePart returns the cloud-init part setting up the instance
+// storage or nil if it isn't enabled for the node pool.
+func instanceStoragePart(values map[string]interface{}) *cloudInitPart {
+	storage, ok := values[configKeyInstanceStorage].(*instanceStorage)
+	if !ok || storage == nil {
+		return nil
+	}
+	return &cloudInitPart{
+		fileName:    instanceStoragePartName,
+		contentType: cloudInitContentTypes[".boothook"],
+		content:     storage.Script,
+	}
+}
@@ -0,0 +1,72 @@
+package provisioner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestSetInstanceStorageValues(t *testing.T) {
+	values := map[string]interface{}{}
+	err := setInstanceStorageValues(&api.NodePool{Name: "worker", InstanceType: "m4.large"}, values)
+	require.NoError(t, err)
+	require.Nil(t, values[configKeyInstanceStorage])
+	require.Nil(t, instanceStoragePart(values))
+
+	err = setInstanceStorageValues(&api.NodePool{
+		Name:         "io",
+		InstanceType: "i3.8xlarge",
+		ConfigItems: map[string]string{
+			configKeyInstanceStorage:        instanceStorageRAID0,
+			configKeyInstanceStorageKubelet: "true",
+		},
+	}, values)
+	require.NoError(t, err)
+	storage := values[configKeyInstanceStorage].(*instanceStorage)
+	require.True(t, storage.RAID)
+	require.True(t, storage.NVMe)
+	require.EqualValues(t, 4, storage.Devices)
+	require.Equal(t, defaultInstanceStorageMountPath, storage.MountPath)
+	require.Contains(t, storage.Script, "nvme-Amazon_EC2_NVMe_Instance_Storage_")
+	require.Contains(t, storage.Script, "mdadm --create")
+	require.Contains(t, storage.Script, `mount --bind "$mount_path/var/lib/kubelet" "/var/lib/kubelet"`)
+
+	part := instanceStoragePart(values)
+	require.NotNil(t, part)
+	require.Equal(t, "text/cloud-boothook", part.contentType)
+
+	err = setInstanceStorageValues(&api.NodePool{
+		Name:         "io",
+		InstanceType: "c3.large",
+		ConfigItems: map[string]string{
+			configKeyInstanceStorage:          instanceStorageSingle,
+			configKeyInstanceStorageMountPath: "/mnt/data",
+		},
+	}, values)
+	require.NoError(t, err)
+	storage = values[configKeyInstanceStorage].(*instanceStorage)
+	require.False(t, storage.NVMe)
+	require.Contains(t, storage.Script, `mount_path="/mnt/data"`)
+	require.Contains(t, storage.Script, "block-device-mapping")
+	require.False(t, strings.Contains(storage.Script, "mdadm"))
+	require.False(t, strings.Contains(storage.Script, "--bind"))
+}
+
+func TestInstanceStorageInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		instanceType string
+		configItems  map[string]string
+	}{
+		{"i3.xlarge", map[string]string{configKeyInstanceStorage: "raid1"}},
+		{"m4.large", map[string]string{configKeyInstanceStorage: instanceStorageSingle}},
+		{"unknown.large", map[string]string{configKeyInstanceStorage: instanceStorageSingle}},
+		{"i3.xlarge", map[string]string{configKeyInstanceStorage: instanceStorageSingle, configKeyInstanceStorageMountPath: "mnt"}},
+		{"i3.xlarge", map[string]string{configKeyInstanceStorage: instanceStorageSingle, configKeyInstanceStorageMountPath: "/mnt/$(reboot)"}},
+		{"i3.xlarge", map[string]string{configKeyInstanceStorage: instanceStorageSingle, configKeyInstanceStorageKubelet: "yes"}},
+	} {
+		_, err := newInstanceStorage(&api.NodePool{Name: "io", InstanceType: tc.instanceType, ConfigItems: tc.configItems})
+		require.Error(t, err, "%s: %v", tc.instanceType, tc.configItems)
+	}
+}
@@ -0,0 +1,159 @@
+package provisioner
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const (
+	nodePoolConfigKeyFallbackInstanceTypes = "fallback_instance_types"
+
+	// insufficientCapacityReason is the error code EC2 reports if it
+	// doesn't have capacity for the instance type in an availability zone.
+	insufficientCapacityReason = "InsufficientInstanceCapacity"
+)
+
+// fallbackInstanceTypes returns the instance types configured with the
+// fallback_instance_types config item of the node pool, in the order they
+// are tried.
+func fallbackInstanceTypes(nodePool *api.NodePool) []string {
+	var instanceTypes []string
+	for _, instanceType := range strings.Split(nodePool.ConfigItems[nodePoolConfigKeyFallbackInstanceTypes], ",") {
+		instanceType = strings.TrimSpace(instanceType)
+		if instanceType != "" && instanceType != nodePool.InstanceType {
+			instanceTypes = append(instanceTypes, instanceType)
+		}
+	}
+	return instanceTypes
+}
+
+// activeInstanceTypeSubstitution returns the instance type substitution
+// recorded in the status of the node pool. A substitution is dropped as soon
+// as the instance type of the node pool changes or the substitute is removed
+// from its fallback instance types.
+func activeInstanceTypeSubstitution(nodePool *api.NodePool) *api.InstanceTypeSubstitution {
+	if nodePool.Status == nil || nodePool.Status.InstanceTypeSubstitution == nil {
+		return nil
+	}
+
+	substitution := nodePool.Status.InstanceTypeSubstitution
+	if substitution.InstanceType != nodePool.InstanceType {
+		return nil
+	}
+
+	for _, instanceType := range fallbackInstanceTypes(nodePool) {
+		if instanceType == substitution.Substitute {
+			return substitution
+		}
+	}
+	return nil
+}
+
+// substitutedNodePool returns a copy of the node pool running the substitute
+// instance type if one is active, or the node pool itself otherwise.
+func substitutedNodePool(nodePool *api.NodePool) *api.NodePool {
+	substitution := activeInstanceTypeSubstitution(nodePool)
+	if substitution == nil {
+		return nodePool
+	}
+
+	substituted := *nodePool
+	substituted.InstanceType = substitution.Substitute
+	return &substituted
+}
+
+// nextFallbackInstanceType returns the fallback instance type following the
+// one the node pool currently runs, or false if all were tried.
+func nextFallbackInstanceType(nodePool *api.NodePool) (string, bool) {
+	fallbacks := fallbackInstanceTypes(nodePool)
+
+	substitution := activeInstanceTypeSubstitution(nodePool)
+	if substitution == nil {
+		if len(fallbacks) == 0 {
+			return "", false
+		}
+		return fallbacks[0], true
+	}
+
+	for i, instanceType := range fallbacks {
+		if instanceType == substitution.Substitute && i+1 < len(fallbacks) {
+			return fallbacks[i+1], true
+		}
+	}
+	return "", false
+}
+
+// recordInstanceTypeSubstitution records in the status of the node pool that
+// it runs the substitute instead of its configured instance type.
+func recordInstanceTypeSubstitution(nodePool *api.NodePool, substitute string) {
+	if nodePool.Status == nil {
+		nodePool.Status = &api.NodePoolStatus{}
+	}
+
+	nodePool.Status.InstanceTypeSubstitution = &api.InstanceTypeSubstitution{
+		InstanceType: nodePool.InstanceType,
+		Substitute:   substitute,
+		Reason:       insufficientCapacityReason,
+	}
+}
+
+// insufficientCapacity returns true if the most recent scaling activity of
+// one of the ASGs of the node pool failed because EC2 didn't have capacity
+// for its instance type.
+func (a *awsAdapter) insufficientCapacity(cluster *api.Cluster, nodePool *api.NodePool) (bool, error) {
+	stacks, err := a.listNodePoolStacks(cluster, nodePool)
+	if err != nil {
+		return false, err
+	}
+
+	for _, stack := range stacks {
+		asgNames, err := a.stackAutoscalingGroups(aws.StringValue(stack.StackName))
+		if err != nil {
+			return false, err
+		}
+
+		for _, asgName := range asgNames {
+			resp, err := a.autoscalingClient.DescribeScalingActivities(&autoscaling.DescribeScalingActivitiesInput{
+				AutoScalingGroupName: aws.String(asgName),
+				MaxRecords:           aws.Int64(1),
+			})
+			if err != nil {
+				return false, err
+			}
+
+			for _, activity := range resp.Activities {
+				if aws.StringValue(activity.StatusCode) == autoscaling.ScalingActivityStatusCodeFailed &&
+					strings.Contains(aws.StringValue(activity.StatusMessage), insufficientCapacityReason) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// fallbackInstanceType returns the instance type the node pool should be
+// switched to if its update failed because the new nodes couldn't be
+// launched for lack of capacity, or false if the update can't be retried.
+func fallbackInstanceType(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, nodePool *api.NodePool, err error) (string, bool) {
+	if _, ok := err.(*updatestrategy.NodesNotReadyError); !ok {
+		return "", false
+	}
+
+	fallback, ok := nextFallbackInstanceType(nodePool)
+	if !ok {
+		return "", false
+	}
+
+	insufficient, capacityErr := adapter.insufficientCapacity(cluster, nodePool)
+	if capacityErr != nil {
+		logger.Warnf("Failed to check the capacity errors of node pool %s: %v", nodePool.Name, capacityErr)
+		return "", false
+	}
+	return fallback, insufficient
+}
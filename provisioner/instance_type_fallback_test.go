@@ -0,0 +1,91 @@
+package provisioner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+func fallbackNodePool(substitute string) *api.NodePool {
+	nodePool := &api.NodePool{
+		Name:         "worker",
+		InstanceType: "m5.large",
+		ConfigItems: map[string]string{
+			nodePoolConfigKeyFallbackInstanceTypes: "m5a.large, m4.large,",
+		},
+	}
+	if substitute != "" {
+		recordInstanceTypeSubstitution(nodePool, substitute)
+	}
+	return nodePool
+}
+
+func TestNextFallbackInstanceType(t *testing.T) {
+	for _, tc := range []struct {
+		substitute string
+		fallback   string
+	}{
+		{substitute: "", fallback: "m5a.large"},
+		{substitute: "m5a.large", fallback: "m4.large"},
+		{substitute: "m4.large", fallback: ""},
+		// substitutes which aren't fallbacks anymore are ignored
+		{substitute: "c5.large", fallback: "m5a.large"},
+	} {
+		fallback, ok := nextFallbackInstanceType(fallbackNodePool(tc.substitute))
+		require.Equal(t, tc.fallback != "", ok, tc.substitute)
+		require.Equal(t, tc.fallback, fallback, tc.substitute)
+	}
+
+	_, ok := nextFallbackInstanceType(&api.NodePool{InstanceType: "m5.large"})
+	require.False(t, ok)
+}
+
+func TestSubstitutedNodePool(t *testing.T) {
+	nodePool := fallbackNodePool("m5a.large")
+	substituted := substitutedNodePool(nodePool)
+	require.Equal(t, "m5a.large", substituted.InstanceType)
+	require.Equal(t, "m5.large", nodePool.InstanceType)
+
+	// changing the instance type of the node pool drops the substitution
+	nodePool.InstanceType = "m5.xlarge"
+	require.Nil(t, activeInstanceTypeSubstitution(nodePool))
+	require.Equal(t, nodePool, substitutedNodePool(nodePool))
+}
+
+func TestInsufficientCapacity(t *testing.T) {
+	cluster := &api.Cluster{ID: "kube-1"}
+
+	adapter := newBootDiagnosticsAdapter()
+	insufficient, err := adapter.insufficientCapacity(cluster, &api.NodePool{Name: "worker"})
+	require.NoError(t, err)
+	require.False(t, insufficient)
+
+	adapter.autoscalingClient.(*bootDiagnosticsAutoscalingStub).activities = []*autoscaling.Activity{{
+		StatusCode:    aws.String(autoscaling.ScalingActivityStatusCodeFailed),
+		StatusMessage: aws.String("We currently do not have sufficient m5.large capacity in the Availability Zone you requested (eu-central-1a). Launching EC2 instance failed. Status Reason: InsufficientInstanceCapacity"),
+	}}
+	insufficient, err = adapter.insufficientCapacity(cluster, &api.NodePool{Name: "worker"})
+	require.NoError(t, err)
+	require.True(t, insufficient)
+
+	logger := log.WithField("cluster", "kube-1")
+	notReady := &updatestrategy.NodesNotReadyError{NodePool: "worker", Err: errors.New("context deadline exceeded")}
+
+	fallback, ok := fallbackInstanceType(logger, adapter, cluster, fallbackNodePool(""), notReady)
+	require.True(t, ok)
+	require.Equal(t, "m5a.large", fallback)
+
+	// other errors aren't retried
+	_, ok = fallbackInstanceType(logger, adapter, cluster, fallbackNodePool(""), errors.New("failed"))
+	require.False(t, ok)
+
+	// node pools without fallbacks aren't retried
+	_, ok = fallbackInstanceType(logger, adapter, cluster, &api.NodePool{Name: "worker"}, notReady)
+	require.False(t, ok)
+}
@@ -0,0 +1,303 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+)
+
+// Formats the inventory can be written in.
+const (
+	InventoryFormatJSON = "json"
+	InventoryFormatYAML = "yaml"
+)
+
+// Inventory lists the AWS resources and the Kubernetes objects the CLM
+// manages for a cluster.
+type Inventory struct {
+	Cluster               string `json:"cluster"`
+	InfrastructureAccount string `json:"infrastructure_account"`
+	Region                string `json:"region"`
+	Channel               string `json:"channel"`
+	// Stacks are the stacks tagged with the cluster, the cluster stack and
+	// the regional stacks, with their resources.
+	Stacks  []*InventoryStack  `json:"stacks"`
+	Volumes []*InventoryVolume `json:"volumes"`
+	// SharedSubnets are the subnets tagged as shared with the cluster.
+	SharedSubnets []string `json:"shared_subnets"`
+	// ElasticIPs and NatGateways are the resources of the static egress
+	// of the cluster.
+	ElasticIPs  []string `json:"elastic_ips,omitempty"`
+	NatGateways []string `json:"nat_gateways,omitempty"`
+	DNSRecords  []string `json:"dns_records,omitempty"`
+	Kubeconfig  string   `json:"kubeconfig,omitempty"`
+	// Objects are the Kubernetes objects declared by the manifests of the
+	// channel for the cluster.
+	Objects []*InventoryObject `json:"objects"`
+	// Warnings are the resources which couldn't be listed.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// InventoryStack is a CloudFormation stack of the cluster.
+type InventoryStack struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	Status string `json:"status"`
+	// NodePool is the name of the node pool if it's a node pool stack.
+	NodePool  string                    `json:"node_pool,omitempty"`
+	Resources []*InventoryStackResource `json:"resources"`
+}
+
+// InventoryStackResource is a resource of a stack.
+type InventoryStackResource struct {
+	LogicalID  string `json:"logical_id"`
+	PhysicalID string `json:"physical_id"`
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+}
+
+// InventoryVolume is an EBS volume owned by the cluster.
+type InventoryVolume struct {
+	ID        string `json:"id"`
+	State     string `json:"state"`
+	Type      string `json:"type"`
+	Size      int64  `json:"size"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+// InventoryObject is a Kubernetes object declared by a manifest.
+type InventoryObject struct {
+	// File is the path of the manifest in the manifests directory.
+	File string `json:"file"`
+	// Resource is the kind, namespace and name of the object.
+	Resource string `json:"resource"`
+}
+
+// ExportInventory lists the resources the CLM manages for the cluster. The
+// objects are listed by rendering the manifests, a cluster which can't be
+// reached is reported as a warning.
+func (p *clusterpyProvisioner) ExportInventory(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*Inventory, error) {
+	logger = logging.WithModule(logger, "provisioner")
+
+	adapter, _, _, err := p.prepareProvision(logger, cluster, channelConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := &Inventory{
+		Cluster:               cluster.ID,
+		InfrastructureAccount: cluster.InfrastructureAccount,
+		Region:                cluster.Region,
+		Channel:               cluster.Channel,
+	}
+
+	err = inventoryStacks(inventory, adapter, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	err = inventoryNetwork(inventory, adapter, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes, err := adapter.GetVolumes(map[string]string{tagNameKubernetesClusterPrefix + cluster.ID: resourceLifecycleOwned})
+	if err != nil {
+		return nil, err
+	}
+	for _, volume := range volumes {
+		inventory.Volumes = append(inventory.Volumes, &InventoryVolume{
+			ID:        aws.StringValue(volume.VolumeId),
+			State:     aws.StringValue(volume.State),
+			Type:      aws.StringValue(volume.VolumeType),
+			Size:      aws.Int64Value(volume.Size),
+			Encrypted: aws.BoolValue(volume.Encrypted),
+		})
+	}
+
+	if apiServerDNSEnabled(cluster) {
+		inventory.DNSRecords, err = apiServerNames(cluster)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	store, err := newKubeconfigStore(adapter, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		inventory.Kubeconfig = store.String()
+	}
+
+	manifestsDir := path.Join(channelConfig.Path, manifestsPath)
+	_, manifests, err := p.prepareManifests(logger, adapter, cluster, manifestsDir)
+	if err != nil {
+		logger.Warnf("Unable to render the manifests: %v", err)
+		inventory.Warnings = append(inventory.Warnings, fmt.Sprintf("failed to render the manifests: %v", err))
+	}
+	for _, manifest := range manifests {
+		for _, resource := range manifestResources(manifest.Content) {
+			inventory.Objects = append(inventory.Objects, &InventoryObject{
+				File:     strings.TrimPrefix(manifest.File, manifestsDir+"/"),
+				Resource: resource,
+			})
+		}
+	}
+
+	return inventory, nil
+}
+
+// inventoryStacks adds the stacks of the cluster and their resources to the
+// inventory.
+func inventoryStacks(inventory *Inventory, adapter *awsAdapter, cluster *api.Cluster) error {
+	stacks, err := adapter.ListStacks(map[string]string{
+		tagNameKubernetesClusterPrefix + cluster.ID: resourceLifecycleOwned,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the cluster stack isn't necessarily tagged with the cluster.
+	clusterStackListed := false
+	for _, stack := range stacks {
+		clusterStackListed = clusterStackListed || aws.StringValue(stack.StackName) == cluster.LocalID
+	}
+	if !clusterStackListed {
+		stack, err := adapter.getStackByName(cluster.LocalID)
+		if err != nil && !isDoesNotExistsErr(err) {
+			return err
+		}
+		if err == nil {
+			stacks = append(stacks, stack)
+		}
+	}
+
+	for _, stack := range stacks {
+		inventoryStack, err := newInventoryStack(adapter, stack, cluster.Region)
+		if err != nil {
+			return err
+		}
+		inventory.Stacks = append(inventory.Stacks, inventoryStack)
+	}
+
+	regions, err := adapter.regionalStackRegions(cluster)
+	if err != nil {
+		return err
+	}
+
+	for _, region := range regions {
+		regionalAdapter, err := adapter.forRegion(region)
+		if err != nil {
+			return err
+		}
+
+		stack, err := regionalAdapter.getStackByName(regionalStackName(cluster))
+		if err != nil {
+			return err
+		}
+
+		inventoryStack, err := newInventoryStack(regionalAdapter, stack, region)
+		if err != nil {
+			return err
+		}
+		inventory.Stacks = append(inventory.Stacks, inventoryStack)
+	}
+	return nil
+}
+
+func newInventoryStack(adapter *awsAdapter, stack *cloudformation.Stack, region string) (*InventoryStack, error) {
+	resp, err := adapter.cloudformationClient.DescribeStackResources(&cloudformation.DescribeStackResourcesInput{
+		StackName: stack.StackName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the resources of stack %s: %v", aws.StringValue(stack.StackName), err)
+	}
+
+	result := &InventoryStack{
+		Name:   aws.StringValue(stack.StackName),
+		Region: region,
+		Status: aws.StringValue(stack.StackStatus),
+	}
+	for _, tag := range stack.Tags {
+		if aws.StringValue(tag.Key) == nodePoolTagKey {
+			result.NodePool = aws.StringValue(tag.Value)
+		}
+	}
+	for _, resource := range resp.StackResources {
+		result.Resources = append(result.Resources, &InventoryStackResource{
+			LogicalID:  aws.StringValue(resource.LogicalResourceId),
+			PhysicalID: aws.StringValue(resource.PhysicalResourceId),
+			Type:       aws.StringValue(resource.ResourceType),
+			Status:     aws.StringValue(resource.ResourceStatus),
+		})
+	}
+	return result, nil
+}
+
+// inventoryNetwork adds the shared subnets and the static egress of the
+// cluster to the inventory.
+func inventoryNetwork(inventory *Inventory, adapter *awsAdapter, cluster *api.Cluster) error {
+	subnets, err := adapter.GetSubnets()
+	if err != nil {
+		return err
+	}
+	tag := &ec2.Tag{
+		Key:   aws.String(tagNameKubernetesClusterPrefix + cluster.ID),
+		Value: aws.String(resourceLifecycleShared),
+	}
+	for _, subnet := range subnets {
+		if hasTag(subnet.Tags, tag) {
+			inventory.SharedSubnets = append(inventory.SharedSubnets, aws.StringValue(subnet.SubnetId))
+		}
+	}
+
+	inventory.ElasticIPs, err = adapter.staticEgressIPs(cluster)
+	if err != nil {
+		return err
+	}
+
+	natGateways, err := adapter.staticEgressNatGateways(cluster)
+	if err != nil {
+		return err
+	}
+	for _, natGateway := range natGateways {
+		inventory.NatGateways = append(inventory.NatGateways, aws.StringValue(natGateway.NatGatewayId))
+	}
+	sort.Strings(inventory.NatGateways)
+	return nil
+}
+
+// Write writes the inventory to w in the format.
+func (i *Inventory) Write(w io.Writer, format string) error {
+	var data []byte
+	var err error
+	switch format {
+	case InventoryFormatJSON:
+		data, err = json.MarshalIndent(i, "", "  ")
+		data = append(data, '\n')
+	case InventoryFormatYAML:
+		data, err = yaml.Marshal(i)
+	default:
+		return fmt.Errorf("unknown inventory format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,120 @@
+package provisioner
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type cloudFormationInventoryAPIStub struct {
+	cloudFormationAPI
+	stacks []*cloudformation.Stack
+}
+
+func (c *cloudFormationInventoryAPIStub) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	for _, stack := range c.stacks {
+		if aws.StringValue(stack.StackName) == aws.StringValue(input.StackName) {
+			return &cloudformation.DescribeStacksOutput{Stacks: []*cloudformation.Stack{stack}}, nil
+		}
+	}
+	return nil, awserr.New("ValidationError", "Stack with id "+aws.StringValue(input.StackName)+" does not exist", nil)
+}
+
+func (c *cloudFormationInventoryAPIStub) DescribeStacksPages(input *cloudformation.DescribeStacksInput, fn func(*cloudformation.DescribeStacksOutput, bool) bool) error {
+	fn(&cloudformation.DescribeStacksOutput{Stacks: c.stacks}, true)
+	return nil
+}
+
+func (c *cloudFormationInventoryAPIStub) DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (*cloudformation.DescribeStackResourcesOutput, error) {
+	return &cloudformation.DescribeStackResourcesOutput{StackResources: []*cloudformation.StackResource{
+		{
+			LogicalResourceId:  aws.String("AutoScalingGroup"),
+			PhysicalResourceId: aws.String("asg-" + aws.StringValue(input.StackName)),
+			ResourceType:       aws.String("AWS::AutoScaling::AutoScalingGroup"),
+			ResourceStatus:     aws.String(cloudformation.ResourceStatusCreateComplete),
+		},
+	}}, nil
+}
+
+func TestInventoryStacks(t *testing.T) {
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1", LocalID: "kube-1", Region: "eu-central-1"}
+	stub := &cloudFormationInventoryAPIStub{stacks: []*cloudformation.Stack{
+		{
+			StackName:   aws.String("nodepool-default-worker-kube-1"),
+			StackStatus: aws.String(cloudformation.StackStatusUpdateComplete),
+			Tags: []*cloudformation.Tag{
+				{Key: aws.String(tagNameKubernetesClusterPrefix + cluster.ID), Value: aws.String(resourceLifecycleOwned)},
+				{Key: aws.String(nodePoolTagKey), Value: aws.String("default-worker")},
+			},
+		},
+		{
+			StackName:   aws.String("kube-1"),
+			StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+		},
+		{
+			StackName: aws.String("kube-2"),
+		},
+	}}
+
+	inventory := &Inventory{}
+	err := inventoryStacks(inventory, &awsAdapter{cloudformationClient: stub, ec2Client: &ec2RegionsAPIStub{regions: []string{"eu-central-1"}}}, cluster)
+	require.NoError(t, err)
+	require.Len(t, inventory.Stacks, 2)
+
+	require.Equal(t, "nodepool-default-worker-kube-1", inventory.Stacks[0].Name)
+	require.Equal(t, "default-worker", inventory.Stacks[0].NodePool)
+	require.Equal(t, "eu-central-1", inventory.Stacks[0].Region)
+	require.Equal(t, []*InventoryStackResource{
+		{
+			LogicalID:  "AutoScalingGroup",
+			PhysicalID: "asg-nodepool-default-worker-kube-1",
+			Type:       "AWS::AutoScaling::AutoScalingGroup",
+			Status:     cloudformation.ResourceStatusCreateComplete,
+		},
+	}, inventory.Stacks[0].Resources)
+
+	// the cluster stack is listed even if it isn't tagged
+	require.Equal(t, "kube-1", inventory.Stacks[1].Name)
+	require.Equal(t, cloudformation.StackStatusCreateComplete, inventory.Stacks[1].Status)
+}
+
+func TestInventoryWrite(t *testing.T) {
+	inventory := &Inventory{
+		Cluster: "kube-1",
+		Region:  "eu-central-1",
+		Stacks:  []*InventoryStack{{Name: "kube-1", Region: "eu-central-1", Status: "CREATE_COMPLETE"}},
+		Objects: []*InventoryObject{{File: "ingress/deployment.yaml", Resource: "Deployment/kube-system/ingress"}},
+	}
+
+	var output bytes.Buffer
+	err := inventory.Write(&output, InventoryFormatYAML)
+	require.NoError(t, err)
+	require.Equal(t, `channel: ""
+cluster: kube-1
+infrastructure_account: ""
+objects:
+- file: ingress/deployment.yaml
+  resource: Deployment/kube-system/ingress
+region: eu-central-1
+shared_subnets: null
+stacks:
+- name: kube-1
+  region: eu-central-1
+  resources: null
+  status: CREATE_COMPLETE
+volumes: null
+`, output.String())
+
+	output.Reset()
+	err = inventory.Write(&output, InventoryFormatJSON)
+	require.NoError(t, err)
+	require.Contains(t, output.String(), `"resource": "Deployment/kube-system/ingress"`)
+
+	err = inventory.Write(&output, "xml")
+	require.Error(t, err)
+}
@@ -0,0 +1,459 @@
+package provisioner
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/cenkalti/backoff"
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	rbac "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+)
+
+const (
+	configKeyAdminKubeconfigLocation = "admin_kubeconfig_location"
+	configKeyAdminKubeconfigKMSKey   = "admin_kubeconfig_kms_key"
+	adminServiceAccountNamespace     = "kube-system"
+	adminServiceAccountName          = "cluster-lifecycle-manager-admin"
+	adminClusterRole                 = "cluster-admin"
+	adminTokenKey                    = "token"
+	adminTokenTimeout                = 2 * time.Minute
+	kubeconfigFileName               = "kubeconfig"
+	kubectlUser                      = "cluster-lifecycle-manager"
+)
+
+// kubeconfigSecretsAPI is a minimal interface containing only the methods we
+// use from the Secrets Manager API for storing kubeconfigs.
+type kubeconfigSecretsAPI interface {
+	DescribeSecret(input *secretsmanager.DescribeSecretInput) (*secretsmanager.DescribeSecretOutput, error)
+	CreateSecret(input *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error)
+	DeleteSecret(input *secretsmanager.DeleteSecretInput) (*secretsmanager.DeleteSecretOutput, error)
+}
+
+// kubeconfigStore stores the admin kubeconfig of a single cluster.
+type kubeconfigStore interface {
+	exists() (bool, error)
+	store(kubeconfig []byte) error
+	delete() error
+	String() string
+}
+
+// newKubeconfigStore returns the store for the admin kubeconfig of the
+// cluster configured by the admin_kubeconfig_location config item. The
+// location can either be an S3 URL (s3://bucket/prefix) or a Secrets Manager
+// secret name prefix (secretsmanager://prefix). Returns nil if no location is
+// configured.
+func newKubeconfigStore(adapter *awsAdapter, cluster *api.Cluster) (kubeconfigStore, error) {
+	location := cluster.ConfigItems[configKeyAdminKubeconfigLocation]
+	if location == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for %s: %v", configKeyAdminKubeconfigLocation, err)
+	}
+
+	kmsKey := cluster.ConfigItems[configKeyAdminKubeconfigKMSKey]
+
+	switch u.Scheme {
+	case "s3":
+		return &s3KubeconfigStore{
+			client:   adapter.s3Client,
+			uploader: adapter.s3Uploader,
+			bucket:   u.Host,
+			key:      path.Join(strings.TrimPrefix(u.Path, "/"), cluster.ID, kubeconfigFileName),
+			kmsKey:   kmsKey,
+		}, nil
+	case "secretsmanager":
+		// secret names can't contain the colons of the cluster ID, they're
+		// replaced with the path separator.
+		return &secretsManagerKubeconfigStore{
+			client: secretsmanager.New(adapter.session),
+			name:   path.Join(u.Host, u.Path, strings.Replace(cluster.ID, ":", "/", -1), kubeconfigFileName),
+			kmsKey: kmsKey,
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid value for %s: unsupported scheme %s, must be s3 or secretsmanager", configKeyAdminKubeconfigLocation, u.Scheme)
+	}
+}
+
+// s3KubeconfigStore stores the kubeconfig as an S3 object encrypted with
+// KMS.
+type s3KubeconfigStore struct {
+	client   s3API
+	uploader s3UploaderAPI
+	bucket   string
+	key      string
+	kmsKey   string
+}
+
+func (s *s3KubeconfigStore) exists() (bool, error) {
+	_, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3ErrCodeNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *s3KubeconfigStore) store(kubeconfig []byte) error {
+	input := &s3manager.UploadInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(s.key),
+		Body:                 bytes.NewReader(kubeconfig),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+	}
+	if s.kmsKey != "" {
+		input.SSEKMSKeyId = aws.String(s.kmsKey)
+	}
+
+	_, err := s.uploader.Upload(input)
+	return err
+}
+
+func (s *s3KubeconfigStore) delete() error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+	})
+	return err
+}
+
+func (s *s3KubeconfigStore) String() string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, s.key)
+}
+
+// secretsManagerKubeconfigStore stores the kubeconfig as a Secrets Manager
+// secret.
+type secretsManagerKubeconfigStore struct {
+	client kubeconfigSecretsAPI
+	name   string
+	kmsKey string
+}
+
+func (s *secretsManagerKubeconfigStore) exists() (bool, error) {
+	_, err := s.client.DescribeSecret(&secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(s.name),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *secretsManagerKubeconfigStore) store(kubeconfig []byte) error {
+	input := &secretsmanager.CreateSecretInput{
+		Name:         aws.String(s.name),
+		Description:  aws.String("Admin kubeconfig created by the Cluster Lifecycle Manager"),
+		SecretString: aws.String(string(kubeconfig)),
+	}
+	if s.kmsKey != "" {
+		input.KmsKeyId = aws.String(s.kmsKey)
+	}
+
+	_, err := s.client.CreateSecret(input)
+	return err
+}
+
+func (s *secretsManagerKubeconfigStore) delete() error {
+	// the credentials are useless once the cluster is gone, the secret is
+	// deleted right away so a cluster with the same name can be created
+	// again.
+	_, err := s.client.DeleteSecret(&secretsmanager.DeleteSecretInput{
+		SecretId:                   aws.String(s.name),
+		ForceDeleteWithoutRecovery: aws.Bool(true),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *secretsManagerKubeconfigStore) String() string {
+	return "secretsmanager:" + s.name
+}
+
+// kubeconfig is the subset of the kubeconfig format used for the admin
+// kubeconfig.
+type kubeconfig struct {
+	APIVersion     string                   `json:"apiVersion"`
+	Kind           string                   `json:"kind"`
+	Clusters       []kubeconfigNamedCluster `json:"clusters"`
+	Users          []kubeconfigNamedUser    `json:"users"`
+	Contexts       []kubeconfigNamedContext `json:"contexts"`
+	CurrentContext string                   `json:"current-context"`
+}
+
+type kubeconfigNamedCluster struct {
+	Name    string            `json:"name"`
+	Cluster kubeconfigCluster `json:"cluster"`
+}
+
+type kubeconfigCluster struct {
+	Server                   string `json:"server"`
+	CertificateAuthorityData []byte `json:"certificate-authority-data,omitempty"`
+}
+
+type kubeconfigNamedUser struct {
+	Name string         `json:"name"`
+	User kubeconfigUser `json:"user"`
+}
+
+type kubeconfigUser struct {
+	Token                 string `json:"token,omitempty"`
+	ClientCertificateData []byte `json:"client-certificate-data,omitempty"`
+	ClientKeyData         []byte `json:"client-key-data,omitempty"`
+}
+
+type kubeconfigNamedContext struct {
+	Name    string            `json:"name"`
+	Context kubeconfigContext `json:"context"`
+}
+
+type kubeconfigContext struct {
+	Cluster string `json:"cluster"`
+	User    string `json:"user"`
+}
+
+// adminKubeconfig returns a kubeconfig for accessing the cluster with the
+// token of the admin service account.
+func adminKubeconfig(cluster *api.Cluster, token string) ([]byte, error) {
+	return tokenKubeconfig(cluster, adminServiceAccountName, token)
+}
+
+// tokenKubeconfig returns a kubeconfig for accessing the cluster as the user
+// with the token.
+func tokenKubeconfig(cluster *api.Cluster, user, token string) ([]byte, error) {
+	return clusterKubeconfig(cluster, user, kubeconfigUser{Token: token})
+}
+
+// clientCertKubeconfig returns a kubeconfig for connecting to the API server
+// of the cluster with its client certificate.
+func clientCertKubeconfig(cluster *api.Cluster, user string) ([]byte, error) {
+	// validates the certificate and the key
+	_, err := clusterClientCertificate(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return clusterKubeconfig(cluster, user, kubeconfigUser{
+		ClientCertificateData: []byte(cluster.ConfigItems[configKeyAPIServerClientCert]),
+		ClientKeyData:         []byte(cluster.ConfigItems[configKeyAPIServerClientKey]),
+	})
+}
+
+// clusterKubeconfig returns a kubeconfig for connecting to the API server of
+// the cluster with the credentials of the user. The CA of the API server is
+// only included if it's configured with the api_server_ca config item,
+// otherwise the API server is expected to use a certificate signed by a
+// trusted CA.
+func clusterKubeconfig(cluster *api.Cluster, user string, credentials kubeconfigUser) ([]byte, error) {
+	var caData []byte
+	if ca, ok := cluster.ConfigItems[configKeyAPIServerCA]; ok {
+		caData = []byte(ca)
+	}
+
+	return yaml.Marshal(&kubeconfig{
+		APIVersion: "v1",
+		Kind:       "Config",
+		Clusters: []kubeconfigNamedCluster{
+			{
+				Name: cluster.ID,
+				Cluster: kubeconfigCluster{
+					Server:                   cluster.APIServerURL,
+					CertificateAuthorityData: caData,
+				},
+			},
+		},
+		Users: []kubeconfigNamedUser{
+			{
+				Name: user,
+				User: credentials,
+			},
+		},
+		Contexts: []kubeconfigNamedContext{
+			{
+				Name: cluster.ID,
+				Context: kubeconfigContext{
+					Cluster: cluster.ID,
+					User:    user,
+				},
+			},
+		},
+		CurrentContext: cluster.ID,
+	})
+}
+
+// ensureAdminToken ensures the admin service account exists and is bound to
+// the cluster-admin role and returns its token.
+func ensureAdminToken(client clientset.Interface, auditLog *audit.Log, timeout time.Duration) (string, error) {
+	return ensureServiceAccountToken(client, auditLog, adminServiceAccountNamespace, adminServiceAccountName, adminClusterRole, timeout)
+}
+
+// ensureServiceAccountToken ensures the service account exists and is bound
+// to the cluster role by a binding of the same name and returns its token.
+func ensureServiceAccountToken(client clientset.Interface, auditLog *audit.Log, namespace, name, clusterRole string, timeout time.Duration) (string, error) {
+	serviceAccounts := client.CoreV1().ServiceAccounts(namespace)
+	_, err := serviceAccounts.Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = serviceAccounts.Create(&v1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+		})
+		auditLog.Record(audit.KindKubernetes, "create", kubernetesResourceName("ServiceAccount", namespace, name), err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	bindings := client.RbacV1beta1().ClusterRoleBindings()
+	_, err = bindings.Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = bindings.Create(&rbac.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Subjects: []rbac.Subject{
+				{
+					Kind:      "ServiceAccount",
+					Name:      name,
+					Namespace: namespace,
+				},
+			},
+			RoleRef: rbac.RoleRef{
+				APIGroup: rbac.GroupName,
+				Kind:     "ClusterRole",
+				Name:     clusterRole,
+			},
+		})
+		auditLog.Record(audit.KindKubernetes, "create", kubernetesResourceName("ClusterRoleBinding", "", name), err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// the token secret is created asynchronously by the token controller
+	var token string
+	backoffCfg := backoff.NewExponentialBackOff()
+	backoffCfg.MaxElapsedTime = timeout
+	err = backoff.Retry(func() error {
+		serviceAccount, err := serviceAccounts.Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range serviceAccount.Secrets {
+			secret, err := client.CoreV1().Secrets(namespace).Get(ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+
+			if secret.Type == v1.SecretTypeServiceAccountToken && len(secret.Data[adminTokenKey]) > 0 {
+				token = string(secret.Data[adminTokenKey])
+				return nil
+			}
+		}
+		return fmt.Errorf("no token for service account %s/%s", namespace, name)
+	}, backoffCfg)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ensureAdminKubeconfig stores an admin kubeconfig of the cluster at the
+// location configured by the admin_kubeconfig_location config item unless
+// it's already there. It's stored once after the cluster was created so
+// downstream tooling can access the cluster without manual steps.
+func (p *clusterpyProvisioner) ensureAdminKubeconfig(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster) error {
+	store, err := newKubeconfigStore(adapter, cluster)
+	if err != nil || store == nil {
+		return err
+	}
+
+	exists, err := store.exists()
+	if err != nil {
+		return fmt.Errorf("failed to check admin kubeconfig %s: %v", store, err)
+	}
+
+	if exists {
+		return nil
+	}
+
+	if adapter.dryRun {
+		logger.Infof("Dry-run: would store admin kubeconfig at %s", store)
+		return nil
+	}
+
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return err
+	}
+
+	client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, adapter.tokenSrc, transport)
+	if err != nil {
+		return err
+	}
+
+	token, err := ensureAdminToken(client, adapter.audit, adminTokenTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to get the admin token: %v", err)
+	}
+
+	config, err := adminKubeconfig(cluster, token)
+	if err != nil {
+		return err
+	}
+
+	err = store.store(config)
+	adapter.audit.Record(audit.KindAWS, "store-kubeconfig", store.String(), err)
+	if err != nil {
+		return fmt.Errorf("failed to store admin kubeconfig %s: %v", store, err)
+	}
+
+	logger.Infof("Stored admin kubeconfig at %s", store)
+	return nil
+}
+
+// deleteAdminKubeconfig deletes the admin kubeconfig of a decommissioned
+// cluster.
+func deleteAdminKubeconfig(adapter *awsAdapter, cluster *api.Cluster) error {
+	store, err := newKubeconfigStore(adapter, cluster)
+	if err != nil || store == nil {
+		return err
+	}
+
+	err = store.delete()
+	adapter.audit.Record(audit.KindAWS, "delete-kubeconfig", store.String(), err)
+	return err
+}
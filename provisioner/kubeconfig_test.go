@@ -0,0 +1,177 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+type kubeconfigSecretsAPIStub struct {
+	secrets map[string]*secretsmanager.CreateSecretInput
+}
+
+func (s *kubeconfigSecretsAPIStub) DescribeSecret(input *secretsmanager.DescribeSecretInput) (*secretsmanager.DescribeSecretOutput, error) {
+	if _, ok := s.secrets[aws.StringValue(input.SecretId)]; !ok {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+	return &secretsmanager.DescribeSecretOutput{Name: input.SecretId}, nil
+}
+
+func (s *kubeconfigSecretsAPIStub) CreateSecret(input *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+	s.secrets[aws.StringValue(input.Name)] = input
+	return &secretsmanager.CreateSecretOutput{Name: input.Name}, nil
+}
+
+func (s *kubeconfigSecretsAPIStub) DeleteSecret(input *secretsmanager.DeleteSecretInput) (*secretsmanager.DeleteSecretOutput, error) {
+	if _, ok := s.secrets[aws.StringValue(input.SecretId)]; !ok {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+	delete(s.secrets, aws.StringValue(input.SecretId))
+	return &secretsmanager.DeleteSecretOutput{Name: input.SecretId}, nil
+}
+
+func TestNewKubeconfigStore(t *testing.T) {
+	adapter := &awsAdapter{
+		session:    session.Must(session.NewSession(&aws.Config{Region: aws.String("eu-central-1")})),
+		s3Client:   &s3APIStub{},
+		s3Uploader: &s3UploaderAPIStub{},
+	}
+	cluster := &api.Cluster{
+		ID:          "aws:123456789012:eu-central-1:kube-1",
+		LocalID:     "kube-1",
+		ConfigItems: map[string]string{},
+	}
+
+	store, err := newKubeconfigStore(adapter, cluster)
+	require.NoError(t, err)
+	require.Nil(t, store)
+
+	cluster.ConfigItems[configKeyAdminKubeconfigLocation] = "s3://bucket/kubeconfigs"
+	store, err = newKubeconfigStore(adapter, cluster)
+	require.NoError(t, err)
+	require.Equal(t, "s3://bucket/kubeconfigs/aws:123456789012:eu-central-1:kube-1/kubeconfig", store.String())
+
+	cluster.ConfigItems[configKeyAdminKubeconfigLocation] = "secretsmanager://kubeconfig/"
+	store, err = newKubeconfigStore(adapter, cluster)
+	require.NoError(t, err)
+	require.Equal(t, "secretsmanager:kubeconfig/aws/123456789012/eu-central-1/kube-1/kubeconfig", store.String())
+
+	cluster.ConfigItems[configKeyAdminKubeconfigLocation] = "secretsmanager://kubeconfig"
+	store, err = newKubeconfigStore(adapter, cluster)
+	require.NoError(t, err)
+	require.Equal(t, "secretsmanager:kubeconfig/aws/123456789012/eu-central-1/kube-1/kubeconfig", store.String())
+
+	cluster.ConfigItems[configKeyAdminKubeconfigLocation] = "ssm://kubeconfig"
+	_, err = newKubeconfigStore(adapter, cluster)
+	require.Error(t, err)
+}
+
+func TestS3KubeconfigStore(t *testing.T) {
+	client := &s3APIStub{}
+	store := &s3KubeconfigStore{
+		client:   client,
+		uploader: &s3UploaderAPIStub{},
+		bucket:   "bucket",
+		key:      "kube-1/kubeconfig",
+	}
+
+	exists, err := store.exists()
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, store.store([]byte("kubeconfig")))
+
+	client.objects = []*s3.Object{{Key: aws.String("kube-1/kubeconfig")}}
+	exists, err = store.exists()
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.NoError(t, store.delete())
+	require.Empty(t, client.objects)
+}
+
+func TestSecretsManagerKubeconfigStore(t *testing.T) {
+	client := &kubeconfigSecretsAPIStub{secrets: make(map[string]*secretsmanager.CreateSecretInput)}
+	store := &secretsManagerKubeconfigStore{
+		client: client,
+		name:   "kubeconfig/kube-1",
+		kmsKey: "alias/kubeconfig",
+	}
+
+	exists, err := store.exists()
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, store.store([]byte("kubeconfig")))
+	require.Equal(t, "kubeconfig", aws.StringValue(client.secrets["kubeconfig/kube-1"].SecretString))
+	require.Equal(t, "alias/kubeconfig", aws.StringValue(client.secrets["kubeconfig/kube-1"].KmsKeyId))
+
+	exists, err = store.exists()
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.NoError(t, store.delete())
+	require.NoError(t, store.delete())
+	require.Empty(t, client.secrets)
+}
+
+func TestAdminKubeconfig(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:           "aws:123456789012:eu-central-1:kube-1",
+		APIServerURL: "https://kube-1.example.org",
+		ConfigItems:  map[string]string{configKeyAPIServerCA: "ca"},
+	}
+
+	data, err := adminKubeconfig(cluster, "token")
+	require.NoError(t, err)
+
+	var config kubeconfig
+	require.NoError(t, yaml.Unmarshal(data, &config))
+	require.Equal(t, cluster.ID, config.CurrentContext)
+	require.Equal(t, "https://kube-1.example.org", config.Clusters[0].Cluster.Server)
+	require.Equal(t, []byte("ca"), config.Clusters[0].Cluster.CertificateAuthorityData)
+	require.Equal(t, "token", config.Users[0].User.Token)
+	require.Equal(t, kubeconfigContext{Cluster: cluster.ID, User: adminServiceAccountName}, config.Contexts[0].Context)
+}
+
+func TestEnsureAdminToken(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Namespace: adminServiceAccountNamespace, Name: adminServiceAccountName},
+			Secrets:    []v1.ObjectReference{{Name: "admin-ca"}, {Name: "admin-token"}},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: adminServiceAccountNamespace, Name: "admin-ca"},
+			Data:       map[string][]byte{"ca.crt": []byte("ca")},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: adminServiceAccountNamespace, Name: "admin-token"},
+			Type:       v1.SecretTypeServiceAccountToken,
+			Data:       map[string][]byte{adminTokenKey: []byte("token")},
+		},
+	)
+
+	token, err := ensureAdminToken(client, nil, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "token", token)
+
+	binding, err := client.RbacV1beta1().ClusterRoleBindings().Get(adminServiceAccountName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, adminClusterRole, binding.RoleRef.Name)
+	require.Equal(t, adminServiceAccountName, binding.Subjects[0].Name)
+
+	// without the token controller the token never shows up
+	_, err = ensureAdminToken(fake.NewSimpleClientset(), nil, 10*time.Millisecond)
+	require.Error(t, err)
+}
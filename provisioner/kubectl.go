@@ -0,0 +1,98 @@
+package provisioner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	kubectlVersionsFile = "cluster/kubectl-versions.yaml"
+	// defaultKubectl is the kubectl binary used if the channel doesn't pin
+	// kubectl versions.
+	defaultKubectl = "kubectl"
+)
+
+// kubectlVersion is the kubectl release pinned for a Kubernetes minor
+// version.
+type kubectlVersion struct {
+	Version string `yaml:"version"`
+	SHA256  string `yaml:"sha256"`
+}
+
+// loadKubectlVersions reads the kubectl versions pinned by the channel, by
+// Kubernetes minor version. nil is returned if the channel doesn't pin any
+// kubectl versions.
+func loadKubectlVersions(channelConfig *channel.Config) (map[string]*kubectlVersion, error) {
+	data, err := ioutil.ReadFile(path.Join(channelConfig.Path, kubectlVersionsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var versions map[string]*kubectlVersion
+	err = yaml.UnmarshalStrict(data, &versions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubectl versions %s: %v", kubectlVersionsFile, err)
+	}
+
+	for minor, version := range versions {
+		pinned, err := parseKubeVersion(version.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kubectl versions %s: %s: %v", kubectlVersionsFile, minor, err)
+		}
+
+		if pinned.String() != minor {
+			return nil, fmt.Errorf("invalid kubectl versions %s: kubectl %s doesn't match Kubernetes %s", kubectlVersionsFile, version.Version, minor)
+		}
+
+		if version.SHA256 == "" {
+			return nil, fmt.Errorf("invalid kubectl versions %s: no sha256 checksum for kubectl %s", kubectlVersionsFile, version.Version)
+		}
+	}
+
+	return versions, nil
+}
+
+// kubectlBinary returns the kubectl binary matching the minor version of the
+// API server, downloading it if needed. The kubectl found in the PATH is used
+// if the channel doesn't pin kubectl versions.
+func (p *clusterpyProvisioner) kubectlBinary(logger *log.Entry, channelConfig *channel.Config, apiServerVersion string) (string, error) {
+	if p.kubectlManager == nil {
+		return defaultKubectl, nil
+	}
+
+	versions, err := loadKubectlVersions(channelConfig)
+	if err != nil {
+		return "", err
+	}
+
+	if versions == nil {
+		return defaultKubectl, nil
+	}
+
+	serverVersion, err := parseKubeVersion(apiServerVersion)
+	if err != nil {
+		return "", err
+	}
+
+	version, ok := versions[serverVersion.String()]
+	if !ok {
+		return "", fmt.Errorf("no kubectl version pinned in %s for Kubernetes %s", kubectlVersionsFile, serverVersion)
+	}
+
+	binary, err := p.kubectlManager.Binary(version.Version, version.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	logger.Debugf("Using kubectl %s for API server %s", version.Version, apiServerVersion)
+	return binary, nil
+}
@@ -0,0 +1,83 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubectl"
+)
+
+const testKubectlVersions = `
+"1.13":
+  version: v1.13.12
+  sha256: 1e5d6e8ec5c8ee7e2a1f7a6d4d6fbd309f8e8b0fc2ea1b4b6c8d3f2baf57e88f
+"1.14":
+  version: v1.14.8
+  sha256: 4d6f3fa6d8fc51b2cc4e0aee39e4da9b9d5c6b3d5e1a7a7d1e9c2ad9b1f4e0cc
+`
+
+func newKubectlVersionsChannel(t *testing.T, versions string) *channel.Config {
+	dir, err := ioutil.TempDir("", "kubectl-versions")
+	require.NoError(t, err)
+
+	err = os.MkdirAll(path.Join(dir, "cluster"), 0755)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(path.Join(dir, kubectlVersionsFile), []byte(versions), 0644)
+	require.NoError(t, err)
+
+	return &channel.Config{Path: dir}
+}
+
+func TestLoadKubectlVersions(t *testing.T) {
+	channelConfig := newKubectlVersionsChannel(t, testKubectlVersions)
+	defer os.RemoveAll(channelConfig.Path)
+
+	versions, err := loadKubectlVersions(channelConfig)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, "v1.14.8", versions["1.14"].Version)
+
+	// channels without pinned versions use the kubectl in the PATH
+	versions, err = loadKubectlVersions(&channel.Config{Path: "invalid_folder"})
+	require.NoError(t, err)
+	require.Nil(t, versions)
+
+	for _, invalid := range []string{
+		"\"1.14\":\n  version: v1.13.12\n  sha256: abc\n",
+		"\"1.14\":\n  version: v1.14.8\n",
+		"\"1.14\":\n  version: latest\n  sha256: abc\n",
+		"\"1.14\":\n  version: v1.14.8\n  sha256: abc\n  url: https://example.org\n",
+	} {
+		channelConfig := newKubectlVersionsChannel(t, invalid)
+		_, err := loadKubectlVersions(channelConfig)
+		require.Error(t, err, invalid)
+		os.RemoveAll(channelConfig.Path)
+	}
+}
+
+func TestKubectlBinary(t *testing.T) {
+	logger := log.WithField("cluster", "foobar")
+	channelConfig := newKubectlVersionsChannel(t, testKubectlVersions)
+	defer os.RemoveAll(channelConfig.Path)
+
+	// without a manager the kubectl in the PATH is used
+	p := &clusterpyProvisioner{}
+	binary, err := p.kubectlBinary(logger, channelConfig, "v1.14.8")
+	require.NoError(t, err)
+	require.Equal(t, defaultKubectl, binary)
+
+	p.kubectlManager = kubectl.NewManager("invalid_folder", "http://localhost", nil)
+	binary, err = p.kubectlBinary(logger, &channel.Config{Path: "invalid_folder"}, "v1.14.8")
+	require.NoError(t, err)
+	require.Equal(t, defaultKubectl, binary)
+
+	// API servers running an unpinned minor version aren't supported
+	_, err = p.kubectlBinary(logger, channelConfig, "v1.15.3")
+	require.Error(t, err)
+}
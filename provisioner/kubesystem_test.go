@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"strings"
 	"testing"
 
@@ -196,3 +197,47 @@ func TestParseDeletions(t *testing.T) {
 		t.Errorf("should not fail: %s", err)
 	}
 }
+
+func TestParseComponentDeletions(t *testing.T) {
+	manifestsPath, err := ioutil.TempDir("", "manifests")
+	require.NoError(t, err)
+	defer os.RemoveAll(manifestsPath)
+
+	for _, component := range []string{"mate", "external-dns", "without-deletions"} {
+		require.NoError(t, os.MkdirAll(path.Join(manifestsPath, component), 0755))
+	}
+	require.NoError(t, ioutil.WriteFile(path.Join(manifestsPath, deletionsFile), deletionsContent, 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(manifestsPath, "mate", deletionsFile), []byte(`
+post_apply:
+- name: mate-old
+  kind: deployment`), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(manifestsPath, "external-dns", deletionsFile), []byte(`
+pre_apply:
+- name: external-dns
+  namespace: kube-system
+  kind: deployment`), 0644))
+
+	deletions, err := parseDeletions(manifestsPath)
+	require.NoError(t, err)
+	require.Len(t, deletions.PreApply, 2)
+	require.Len(t, deletions.components, 2)
+	require.Len(t, deletions.component("mate").PostApply, 1)
+	require.Equal(t, defaultNamespace, deletions.component("mate").PostApply[0].Namespace)
+	require.Len(t, deletions.component("external-dns").PreApply, 1)
+	require.Empty(t, deletions.component("without-deletions").PreApply)
+
+	cluster := &api.Cluster{ConfigItems: map[string]string{"skip_component_external_dns": "true"}}
+	manifests := []*renderedManifest{
+		{Component: "without-deletions", File: "without-deletions/a.yaml"},
+		{Component: "mate", File: "mate/a.yaml"},
+		{Component: "mate", File: "mate/b.yaml"},
+	}
+	require.Equal(t, []string{"mate", "without-deletions"}, applyOrder(cluster, manifests, deletions))
+	require.Len(t, componentManifests(manifests, "mate"), 2)
+
+	require.NoError(t, ioutil.WriteFile(path.Join(manifestsPath, "mate", deletionsFile), []byte(`
+post_apply:
+- kind: deployment`), 0644))
+	_, err = parseDeletions(manifestsPath)
+	require.Error(t, err)
+}
@@ -0,0 +1,159 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// configKeyLegacyNodePoolMigration enables the migration of the legacy
+	// node pools of a cluster to regular node pool stacks.
+	configKeyLegacyNodePoolMigration = "legacy_node_pool_migration"
+)
+
+// legacyNodePoolReplacements maps the legacy node pools to the names of the
+// node pools replacing them.
+var legacyNodePoolReplacements = map[string]string{
+	"master-default": "default-master",
+	"worker-default": "default-worker",
+}
+
+// legacyNodePoolMigration returns true if the legacy node pools of the
+// cluster are migrated to their replacements.
+func legacyNodePoolMigration(cluster *api.Cluster) bool {
+	return cluster.ConfigItems[configKeyLegacyNodePoolMigration] == "true"
+}
+
+// isLegacyNodePool returns true for the node pools which aren't provisioned
+// as node pool stacks by the CLM.
+func isLegacyNodePool(nodePool *api.NodePool) bool {
+	_, ok := legacyNodePoolReplacements[nodePool.Name]
+	return ok
+}
+
+// replacementNodePool returns the node pool replacing a legacy node pool. It
+// has the same configuration as the legacy node pool under the new name.
+func replacementNodePool(nodePool *api.NodePool) *api.NodePool {
+	replacement := *nodePool
+	replacement.Name = legacyNodePoolReplacements[nodePool.Name]
+	return &replacement
+}
+
+// legacyNodePoolStacks returns the stacks backing the legacy node pool,
+// ignoring the cluster stack and the stacks of regular node pools.
+func legacyNodePoolStacks(stacks []*cloudformation.Stack, clusterStackName string) []*cloudformation.Stack {
+	legacy := make([]*cloudformation.Stack, 0, len(stacks))
+	for _, stack := range stacks {
+		if aws.StringValue(stack.StackName) == clusterStackName {
+			continue
+		}
+
+		regular := false
+		for _, tag := range stack.Tags {
+			if aws.StringValue(tag.Key) == nodePoolRoleTagKey {
+				regular = true
+			}
+		}
+		if !regular {
+			legacy = append(legacy, stack)
+		}
+	}
+	return legacy
+}
+
+// migrateLegacyNodePools decommissions the legacy node pools of the cluster
+// once the node pools replacing them are provisioned. The replacements are
+// provisioned and updated like any other node pool, the legacy node pools are
+// drained, moving the workloads to the replacements, and their stacks are
+// deleted. The migration resumes on the next run until the replacement of a
+// legacy node pool has ready nodes.
+func (p *AWSNodePoolProvisioner) migrateLegacyNodePools(ctx context.Context) error {
+	if !legacyNodePoolMigration(p.Cluster) {
+		return nil
+	}
+
+	for _, nodePool := range p.Cluster.NodePools {
+		if !isLegacyNodePool(nodePool) {
+			continue
+		}
+
+		tags := map[string]string{
+			tagNameKubernetesClusterPrefix + p.Cluster.ID: resourceLifecycleOwned,
+			nodePoolTagKeyLegacy:                          nodePool.Name,
+		}
+
+		stacks, err := p.awsAdapter.ListStacks(tags)
+		if err != nil {
+			return err
+		}
+
+		legacyStacks := legacyNodePoolStacks(stacks, p.Cluster.LocalID)
+		if len(legacyStacks) == 0 {
+			continue
+		}
+
+		replacement := replacementNodePool(nodePool)
+
+		if p.awsAdapter.plan != nil {
+			for _, stack := range legacyStacks {
+				p.awsAdapter.plan.addStack(&StackPlan{
+					Name:     aws.StringValue(stack.StackName),
+					NodePool: nodePool.Name,
+					Action:   StackActionDelete,
+				})
+			}
+			continue
+		}
+
+		ready, err := p.nodePoolReady(replacement)
+		if err != nil {
+			return err
+		}
+		if !ready {
+			p.logger.Infof("Waiting for node pool %s to replace legacy node pool %s", replacement.Name, nodePool.Name)
+			continue
+		}
+
+		p.logger.Infof("Migrating legacy node pool %s to node pool %s", nodePool.Name, replacement.Name)
+
+		err = p.drainNodePool(ctx, nodePool)
+		if err != nil {
+			return err
+		}
+
+		for _, stack := range legacyStacks {
+			err = p.awsAdapter.DeleteStack(ctx, aws.StringValue(stack.StackName))
+			if err != nil {
+				return err
+			}
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nodePoolReady returns true once the node pool has at least as many ready
+// nodes as its minimum size, and at least one.
+func (p *AWSNodePoolProvisioner) nodePoolReady(nodePool *api.NodePool) (bool, error) {
+	pool, err := p.nodePoolManager.GetPool(nodePool)
+	if err != nil {
+		return false, fmt.Errorf("failed to get node pool %s: %v", nodePool.Name, err)
+	}
+
+	ready := 0
+	for _, node := range pool.Nodes {
+		if node.Ready {
+			ready++
+		}
+	}
+
+	return ready > 0 && int64(ready) >= nodePool.MinSize, nil
+}
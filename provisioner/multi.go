@@ -0,0 +1,203 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+type multiProvisioner struct {
+	provisioners []Provisioner
+}
+
+// NewMultiProvisioner returns a provisioner delegating to the first of the
+// provisioners supporting the provider of a cluster.
+func NewMultiProvisioner(provisioners ...Provisioner) Provisioner {
+	return &multiProvisioner{provisioners: provisioners}
+}
+
+// provisioner returns the provisioner for the cluster.
+func (p *multiProvisioner) provisioner(cluster *api.Cluster) (Provisioner, error) {
+	for _, provisioner := range p.provisioners {
+		if provisioner.Supports(cluster) {
+			return provisioner, nil
+		}
+	}
+	return nil, ErrProviderNotSupported
+}
+
+func (p *multiProvisioner) Supports(cluster *api.Cluster) bool {
+	_, err := p.provisioner(cluster)
+	return err == nil
+}
+
+// Provision provisions the cluster with the provisioner supporting it.
+func (p *multiProvisioner) Provision(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error {
+	provisioner, err := p.provisioner(cluster)
+	if err != nil {
+		return err
+	}
+	return provisioner.Provision(ctx, logger, cluster, channelConfig)
+}
+
+// Decommission decommissions the cluster with the provisioner supporting it.
+func (p *multiProvisioner) Decommission(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error {
+	provisioner, err := p.provisioner(cluster)
+	if err != nil {
+		return err
+	}
+	return provisioner.Decommission(logger, cluster, channelConfig)
+}
+
+// etcdBackupProvisioner returns the provisioner for the cluster if it
+// supports managing etcd backups.
+func (p *multiProvisioner) etcdBackupProvisioner(cluster *api.Cluster) (EtcdBackupProvisioner, error) {
+	provisioner, err := p.provisioner(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	backups, ok := provisioner.(EtcdBackupProvisioner)
+	if !ok {
+		return nil, fmt.Errorf("provider %s doesn't support managing etcd backups", cluster.Provider)
+	}
+	return backups, nil
+}
+
+// VerifyEtcdBackup verifies the etcd backups of the cluster with the
+// provisioner supporting it.
+func (p *multiProvisioner) VerifyEtcdBackup(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error {
+	backups, err := p.etcdBackupProvisioner(cluster)
+	if err != nil {
+		return err
+	}
+	return backups.VerifyEtcdBackup(logger, cluster, channelConfig)
+}
+
+// RestoreEtcd restores an etcd snapshot of the cluster with the provisioner
+// supporting it.
+func (p *multiProvisioner) RestoreEtcd(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, snapshot string) (string, error) {
+	backups, err := p.etcdBackupProvisioner(cluster)
+	if err != nil {
+		return "", err
+	}
+	return backups.RestoreEtcd(ctx, logger, cluster, channelConfig, snapshot)
+}
+
+// Plan plans the provisioning of the cluster with the provisioner supporting
+// it.
+func (p *multiProvisioner) Plan(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*Plan, error) {
+	provisioner, err := p.provisioner(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	planner, ok := provisioner.(Planner)
+	if !ok {
+		return nil, fmt.Errorf("provider %s doesn't support planning", cluster.Provider)
+	}
+	return planner.Plan(ctx, logger, cluster, channelConfig)
+}
+
+// stepProvisioner returns the provisioner for the cluster if it supports
+// running single provisioning steps.
+func (p *multiProvisioner) stepProvisioner(cluster *api.Cluster) (StepProvisioner, error) {
+	provisioner, err := p.provisioner(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, ok := provisioner.(StepProvisioner)
+	if !ok {
+		return nil, fmt.Errorf("provider %s doesn't support running single provisioning steps", cluster.Provider)
+	}
+	return steps, nil
+}
+
+// ApplyManifests applies the manifests of the cluster with the provisioner
+// supporting it.
+func (p *multiProvisioner) ApplyManifests(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error {
+	steps, err := p.stepProvisioner(cluster)
+	if err != nil {
+		return err
+	}
+	return steps.ApplyManifests(ctx, logger, cluster, channelConfig)
+}
+
+// UpdateNodePool updates a single node pool of the cluster with the
+// provisioner supporting it.
+func (p *multiProvisioner) UpdateNodePool(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, nodePool string) error {
+	steps, err := p.stepProvisioner(cluster)
+	if err != nil {
+		return err
+	}
+	return steps.UpdateNodePool(ctx, logger, cluster, channelConfig, nodePool)
+}
+
+// PlanDecommission lists the resources decommissioning the cluster would
+// touch with the provisioner supporting it.
+func (p *multiProvisioner) PlanDecommission(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*DecommissionPlan, error) {
+	provisioner, err := p.provisioner(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	planner, ok := provisioner.(DecommissionPlanner)
+	if !ok {
+		return nil, fmt.Errorf("provider %s doesn't support planning decommissions", cluster.Provider)
+	}
+	return planner.PlanDecommission(ctx, logger, cluster, channelConfig)
+}
+
+// Render renders the templates of the cluster with the provisioner
+// supporting it.
+func (p *multiProvisioner) Render(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, options *RenderOptions) error {
+	steps, err := p.stepProvisioner(cluster)
+	if err != nil {
+		return err
+	}
+	return steps.Render(ctx, logger, cluster, channelConfig, options)
+}
+
+// Values returns the effective values of the cluster with the provisioner
+// supporting it.
+func (p *multiProvisioner) Values(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, offline bool) (*ClusterValues, error) {
+	steps, err := p.stepProvisioner(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return steps.Values(ctx, logger, cluster, channelConfig, offline)
+}
+
+// ExportInventory lists the resources managed for the cluster with the
+// provisioner supporting it.
+func (p *multiProvisioner) ExportInventory(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*Inventory, error) {
+	provisioner, err := p.provisioner(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, ok := provisioner.(InventoryExporter)
+	if !ok {
+		return nil, fmt.Errorf("provider %s doesn't support exporting inventories", cluster.Provider)
+	}
+	return exporter.ExportInventory(ctx, logger, cluster, channelConfig)
+}
+
+// NodePoolInsights returns the live view of the node pools of the cluster
+// with the provisioner supporting it.
+func (p *multiProvisioner) NodePoolInsights(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) ([]*NodePoolInsight, error) {
+	provisioner, err := p.provisioner(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	inspector, ok := provisioner.(NodePoolInspector)
+	if !ok {
+		return nil, fmt.Errorf("provider %s doesn't support node pool insights", cluster.Provider)
+	}
+	return inspector.NodePoolInsights(ctx, logger, cluster, channelConfig)
+}
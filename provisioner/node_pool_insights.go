@@ -0,0 +1,205 @@
+package provisioner
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// tagNameLaunchTemplateVersion is the tag EC2 sets on instances launched from
+// a launch template.
+const tagNameLaunchTemplateVersion = "aws:ec2launchtemplate:version"
+
+// NodePoolInsight is the live view of a node pool, showing how many of its
+// instances are still to be replaced by a rolling update.
+type NodePoolInsight struct {
+	Name    string `json:"name"`
+	Min     int    `json:"min"`
+	Desired int    `json:"desired"`
+	Current int    `json:"current"`
+	Max     int    `json:"max"`
+	// Configuration identifies the configuration new instances are
+	// launched with, e.g. the launch configurations of the ASGs.
+	Configuration string `json:"configuration"`
+	// PendingReplacements is the number of instances which don't run the
+	// current configuration of the node pool yet.
+	PendingReplacements int                 `json:"pending_replacements"`
+	Instances           []*NodePoolInstance `json:"instances"`
+	// Error is set if the node pool couldn't be observed.
+	Error string `json:"error,omitempty"`
+}
+
+// NodePoolInstance is an instance of a node pool and the node it runs.
+type NodePoolInstance struct {
+	ID                    string    `json:"id"`
+	Node                  string    `json:"node"`
+	InstanceType          string    `json:"instance_type"`
+	Image                 string    `json:"image"`
+	LaunchTemplateVersion string    `json:"launch_template_version,omitempty"`
+	LaunchTime            time.Time `json:"launch_time"`
+	Age                   string    `json:"age"`
+	KubeletVersion        string    `json:"kubelet_version"`
+	Ready                 bool      `json:"ready"`
+	Cordoned              bool      `json:"cordoned"`
+	// Outdated is true if the instance is replaced by the next rolling
+	// update of the node pool.
+	Outdated bool `json:"outdated"`
+}
+
+// NodePoolInsights returns the live view of the node pools of the cluster
+// assembled from the node pool backend, EC2 and the nodes of the cluster.
+// Failing to observe a single node pool is reported in its insight rather
+// than failing the whole view. The node pools are only observed, neither the
+// update progress nor the nodes are changed.
+func (p *clusterpyProvisioner) NodePoolInsights(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) ([]*NodePoolInsight, error) {
+	if cluster.Provider != providerID {
+		return nil, ErrProviderNotSupported
+	}
+
+	logger = logging.WithModule(logger, "provisioner")
+
+	sess, err := p.awsSession(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSource, err := p.clusterTokenSource(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter, err := newAWSAdapter(logger, cluster.APIServerURL, cluster.Region, sess, tokenSource, true)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	kubeClient, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, tokenSource, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	poolBackend := updatestrategy.NewASGNodePoolsBackend(cluster.ID, sess, defaultDeregistrationTimeout)
+	nodePoolManager := updatestrategy.NewReadOnlyKubernetesNodePoolManager(logging.WithModule(logger, "updatestrategy"), cluster.ID, kubeClient, poolBackend)
+
+	kubeletVersions, err := kubeletVersions(kubeClient)
+	if err != nil {
+		logger.Warnf("Failed to get the kubelet versions: %v", err)
+	}
+
+	now := time.Now()
+	insights := make([]*NodePoolInsight, 0, len(cluster.NodePools))
+	for _, nodePool := range cluster.NodePools {
+		insight, err := nodePoolInsight(adapter, nodePoolManager, nodePool, kubeletVersions, now)
+		if err != nil {
+			insight = &NodePoolInsight{Name: nodePool.Name, Error: err.Error()}
+		}
+		insights = append(insights, insight)
+	}
+	return insights, nil
+}
+
+// kubeletVersions returns the kubelet versions of the nodes of the cluster by
+// node name.
+func kubeletVersions(kubeClient clientset.Interface) (map[string]string, error) {
+	nodes, err := kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]string, len(nodes.Items))
+	for _, node := range nodes.Items {
+		versions[node.Name] = node.Status.NodeInfo.KubeletVersion
+	}
+	return versions, nil
+}
+
+// nodePoolInsight returns the insight of a node pool. Nodes of an older
+// generation than the node pool are pending replacement.
+func nodePoolInsight(adapter *awsAdapter, nodePoolManager updatestrategy.NodePoolManager, nodePool *api.NodePool, kubeletVersions map[string]string, now time.Time) (*NodePoolInsight, error) {
+	pool, err := nodePoolManager.GetPool(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	insight := &NodePoolInsight{
+		Name:          nodePool.Name,
+		Min:           pool.Min,
+		Desired:       pool.Desired,
+		Current:       pool.Current,
+		Max:           pool.Max,
+		Configuration: pool.Configuration,
+		Instances:     make([]*NodePoolInstance, 0, len(pool.Nodes)),
+	}
+
+	instanceIDs := make([]*string, 0, len(pool.Nodes))
+	for _, node := range pool.Nodes {
+		instance := &NodePoolInstance{
+			Node:           node.Name,
+			KubeletVersion: kubeletVersions[node.Name],
+			Ready:          node.Ready,
+			Cordoned:       node.Cordoned,
+			Outdated:       node.Generation != pool.Generation,
+		}
+		if instance.Outdated {
+			insight.PendingReplacements++
+		}
+
+		parts := strings.Split(node.ProviderID, "/")
+		if instanceID := parts[len(parts)-1]; strings.HasPrefix(instanceID, "i-") {
+			instance.ID = instanceID
+			instanceIDs = append(instanceIDs, aws.String(instanceID))
+		}
+		insight.Instances = append(insight.Instances, instance)
+	}
+
+	if len(instanceIDs) == 0 {
+		return insight, nil
+	}
+
+	resp, err := adapter.ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: instanceIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make(map[string]*ec2.Instance, len(instanceIDs))
+	for _, reservation := range resp.Reservations {
+		for _, instance := range reservation.Instances {
+			instances[aws.StringValue(instance.InstanceId)] = instance
+		}
+	}
+
+	for _, instance := range insight.Instances {
+		ec2Instance, ok := instances[instance.ID]
+		if !ok {
+			continue
+		}
+		instance.InstanceType = aws.StringValue(ec2Instance.InstanceType)
+		instance.Image = aws.StringValue(ec2Instance.ImageId)
+		if ec2Instance.LaunchTime != nil {
+			instance.LaunchTime = aws.TimeValue(ec2Instance.LaunchTime)
+			instance.Age = now.Sub(instance.LaunchTime).Round(time.Minute).String()
+		}
+		for _, tag := range ec2Instance.Tags {
+			if aws.StringValue(tag.Key) == tagNameLaunchTemplateVersion {
+				instance.LaunchTemplateVersion = aws.StringValue(tag.Value)
+			}
+		}
+	}
+	return insight, nil
+}
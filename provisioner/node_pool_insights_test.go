@@ -0,0 +1,92 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+func TestNodePoolInsight(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	adapter := &awsAdapter{
+		ec2Client: &ec2InstancesAPIStub{
+			instances: map[string]*ec2.Instance{
+				"i-1": {
+					InstanceId:   aws.String("i-1"),
+					InstanceType: aws.String("m5.large"),
+					ImageId:      aws.String("ami-new"),
+					LaunchTime:   aws.Time(now.Add(-time.Hour)),
+					Tags:         []*ec2.Tag{{Key: aws.String(tagNameLaunchTemplateVersion), Value: aws.String("3")}},
+				},
+				"i-2": {
+					InstanceId:   aws.String("i-2"),
+					InstanceType: aws.String("m5.large"),
+					ImageId:      aws.String("ami-old"),
+					LaunchTime:   aws.Time(now.Add(-48 * time.Hour)),
+				},
+			},
+		},
+	}
+	manager := &nodePoolStatusManagerStub{
+		pools: map[string]*updatestrategy.NodePool{
+			"worker": {
+				Min:           1,
+				Desired:       2,
+				Current:       2,
+				Max:           4,
+				Generation:    2,
+				Configuration: "worker-lc-2",
+				Nodes: []*updatestrategy.Node{
+					{Name: "node-1", ProviderID: "aws:///eu-central-1a/i-1", Generation: 2, Ready: true},
+					{Name: "node-2", ProviderID: "aws:///eu-central-1b/i-2", Generation: 1, Ready: true, Cordoned: true},
+				},
+			},
+		},
+	}
+	kubeletVersions := map[string]string{"node-1": "v1.10.3", "node-2": "v1.9.6"}
+
+	insight, err := nodePoolInsight(adapter, manager, &api.NodePool{Name: "worker"}, kubeletVersions, now)
+	require.NoError(t, err)
+	require.Equal(t, &NodePoolInsight{
+		Name:                "worker",
+		Min:                 1,
+		Desired:             2,
+		Current:             2,
+		Max:                 4,
+		Configuration:       "worker-lc-2",
+		PendingReplacements: 1,
+		Instances: []*NodePoolInstance{
+			{
+				ID:                    "i-1",
+				Node:                  "node-1",
+				InstanceType:          "m5.large",
+				Image:                 "ami-new",
+				LaunchTemplateVersion: "3",
+				LaunchTime:            now.Add(-time.Hour),
+				Age:                   "1h0m0s",
+				KubeletVersion:        "v1.10.3",
+				Ready:                 true,
+			},
+			{
+				ID:             "i-2",
+				Node:           "node-2",
+				InstanceType:   "m5.large",
+				Image:          "ami-old",
+				LaunchTime:     now.Add(-48 * time.Hour),
+				Age:            "48h0m0s",
+				KubeletVersion: "v1.9.6",
+				Ready:          true,
+				Cordoned:       true,
+				Outdated:       true,
+			},
+		},
+	}, insight)
+
+	_, err = nodePoolInsight(adapter, manager, &api.NodePool{Name: "missing"}, kubeletVersions, now)
+	require.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package provisioner
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+// updateNodePoolStatus records the observed status of the node pools of the
+// cluster, the number of instances and their instance types and images,
+// which is written back to the registry. Failing to observe a node pool is
+// only logged since it should not fail the provisioning run.
+func updateNodePoolStatus(logger *log.Entry, adapter *awsAdapter, nodePoolManager updatestrategy.NodePoolManager, cluster *api.Cluster, now time.Time) {
+	for _, nodePool := range cluster.NodePools {
+		status, err := observeNodePool(adapter, nodePoolManager, nodePool)
+		if err != nil {
+			logger.Warnf("Failed to observe the status of node pool %s: %v", nodePool.Name, err)
+			continue
+		}
+		status.LastUpdated = now
+		status.InstanceTypeSubstitution = activeInstanceTypeSubstitution(nodePool)
+		nodePool.Status = status
+	}
+}
+
+// observeNodePool returns the status of the node pool based on its nodes and
+// their EC2 instances.
+func observeNodePool(adapter *awsAdapter, nodePoolManager updatestrategy.NodePoolManager, nodePool *api.NodePool) (*api.NodePoolStatus, error) {
+	pool, err := nodePoolManager.GetPool(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &api.NodePoolStatus{
+		CurrentSize: int64(pool.Current),
+	}
+
+	instanceIDs := make([]*string, 0, len(pool.Nodes))
+	for _, node := range pool.Nodes {
+		parts := strings.Split(node.ProviderID, "/")
+		if instanceID := parts[len(parts)-1]; strings.HasPrefix(instanceID, "i-") {
+			instanceIDs = append(instanceIDs, aws.String(instanceID))
+		}
+	}
+
+	if len(instanceIDs) == 0 {
+		return status, nil
+	}
+
+	resp, err := adapter.ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: instanceIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	instanceTypes := make(map[string]bool)
+	images := make(map[string]bool)
+	for _, reservation := range resp.Reservations {
+		for _, instance := range reservation.Instances {
+			instanceTypes[aws.StringValue(instance.InstanceType)] = true
+			images[aws.StringValue(instance.ImageId)] = true
+		}
+	}
+
+	status.InstanceTypes = sortedKeys(instanceTypes)
+	status.Images = sortedKeys(images)
+	return status, nil
+}
+
+// sortedKeys returns the keys of the set in sorted order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
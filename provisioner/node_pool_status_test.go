@@ -0,0 +1,71 @@
+package provisioner
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+type ec2InstancesAPIStub struct {
+	ec2API
+	instances map[string]*ec2.Instance
+}
+
+func (s *ec2InstancesAPIStub) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	var instances []*ec2.Instance
+	for _, id := range input.InstanceIds {
+		instance, ok := s.instances[aws.StringValue(id)]
+		if !ok {
+			return nil, errors.New("instance not found")
+		}
+		instances = append(instances, instance)
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: instances}}}, nil
+}
+
+func TestUpdateNodePoolStatus(t *testing.T) {
+	adapter := &awsAdapter{
+		ec2Client: &ec2InstancesAPIStub{
+			instances: map[string]*ec2.Instance{
+				"i-1": {InstanceType: aws.String("m5.large"), ImageId: aws.String("ami-new")},
+				"i-2": {InstanceType: aws.String("m5.xlarge"), ImageId: aws.String("ami-old")},
+				"i-3": {InstanceType: aws.String("m5.large"), ImageId: aws.String("ami-new")},
+			},
+		},
+	}
+	manager := &nodePoolStatusManagerStub{
+		pools: map[string]*updatestrategy.NodePool{
+			"worker": {
+				Current: 3,
+				Nodes: []*updatestrategy.Node{
+					{ProviderID: "aws:///eu-central-1a/i-1"},
+					{ProviderID: "aws:///eu-central-1b/i-2"},
+					{ProviderID: "aws:///eu-central-1c/i-3"},
+				},
+			},
+			"empty": {},
+		},
+	}
+	cluster := &api.Cluster{
+		NodePools: []*api.NodePool{{Name: "worker"}, {Name: "empty"}, {Name: "missing"}},
+	}
+
+	now := time.Now()
+	updateNodePoolStatus(log.WithField("test", true), adapter, manager, cluster, now)
+
+	require.Equal(t, &api.NodePoolStatus{
+		CurrentSize:   3,
+		InstanceTypes: []string{"m5.large", "m5.xlarge"},
+		Images:        []string{"ami-new", "ami-old"},
+		LastUpdated:   now,
+	}, cluster.NodePools[0].Status)
+	require.Equal(t, &api.NodePoolStatus{LastUpdated: now}, cluster.NodePools[1].Status)
+	require.Nil(t, cluster.NodePools[2].Status)
+}
@@ -3,32 +3,56 @@ package provisioner
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/ghodss/yaml"
 	"github.com/mitchellh/copystructure"
 	log "github.com/sirupsen/logrus"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
 	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/httpclient"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
 )
 
 const (
 	userDataFileName      = "userdata.clc.yaml"
 	stackFileName         = "stack.yaml"
+	iamPolicyFileName     = "iam-policy.yaml"
+	iamPoliciesDir        = "iam-policies"
 	nodePoolTagKeyLegacy  = "NodePool"
 	nodePoolTagKey        = "kubernetes.io/node-pool"
 	nodePoolRoleTagKey    = "kubernetes.io/role/node-pool"
 	nodePoolProfileTagKey = "kubernetes.io/node-pool/profile"
+	nodePoolZoneTagKey    = "kubernetes.io/node-pool/availability-zone"
+	// nodePoolConfigHashTagKey is the tag carrying the hash of the
+	// rendered node pool stack. It's propagated to the ASGs and used by
+	// the update strategy to tell the generation of the nodes.
+	nodePoolConfigHashTagKey = "kubernetes.io/node-pool/config-hash"
+
+	nodePoolConfigKeyIAMPolicy       = "iam_policy"
+	nodePoolConfigKeyInstanceProfile = "instance_profile"
+	nodePoolConfigKeyZonalStacks     = "zonal_stacks"
+
+	configKeyNodeTerminationHookTimeout = "node_termination_hook_timeout"
+	configKeyNodeRepair                 = "node_repair"
+	configKeyNodeRepairNotReadyTimeout  = "node_repair_not_ready_timeout"
+	defaultNodeRepairNotReadyTimeout    = 15 * time.Minute
 )
 
 // NodePoolProvisioner is able to provision node pools for a cluster.
@@ -47,14 +71,23 @@ type AWSNodePoolProvisioner struct {
 	cfgBaseDir      string
 	Cluster         *api.Cluster
 	logger          *log.Entry
+	httpConfig      *httpclient.Config
+	images          *imageResolver
+	rollout         *imageRollout
 }
 
 // stackParams defined the parameters expected by a node pool stack template.
+// IAMPolicy is the JSON encoded IAM policy document of the node pool's own
+// role and InstanceProfile is the name or ARN of an existing instance profile
+// to use for the node pool. If neither is set the node pool should use the
+// shared worker role.
 type stackParams struct {
-	Cluster  *api.Cluster
-	NodePool *api.NodePool
-	UserData string
-	Values   map[string]interface{}
+	Cluster         *api.Cluster
+	NodePool        *api.NodePool
+	UserData        string
+	Values          map[string]interface{}
+	IAMPolicy       string
+	InstanceProfile string
 }
 
 type userDataParams struct {
@@ -63,15 +96,17 @@ type userDataParams struct {
 	Values   map[string]interface{}
 }
 
-func (p *AWSNodePoolProvisioner) generateNodePoolStackTemplate(nodePool *api.NodePool, values map[string]interface{}) (string, error) {
+// generateNodePoolStackTemplate renders the stack template of the node pool
+// and returns it with its config hash.
+func (p *AWSNodePoolProvisioner) generateNodePoolStackTemplate(nodePool *api.NodePool, values map[string]interface{}) (string, string, error) {
 	nodePoolProfilesPath := path.Join(p.cfgBaseDir, nodePool.Profile)
 	fi, err := os.Stat(nodePoolProfilesPath)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if !fi.IsDir() {
-		return "", fmt.Errorf("failed to find configuration for node pool profile '%s'", nodePool.Profile)
+		return "", "", fmt.Errorf("failed to find configuration for node pool profile '%s'", nodePool.Profile)
 	}
 
 	userDataParams := &userDataParams{
@@ -80,35 +115,117 @@ func (p *AWSNodePoolProvisioner) generateNodePoolStackTemplate(nodePool *api.Nod
 		Values:   values,
 	}
 
-	userDataPath := path.Join(nodePoolProfilesPath, userDataFileName)
-	renderedUserData, err := p.prepareUserData(nodePoolProfilesPath, userDataPath, userDataParams)
+	renderedUserData, stableUserData, err := p.prepareUserData(nodePoolProfilesPath, userDataParams)
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+
+	iamPolicy, err := renderIAMPolicy(nodePoolProfilesPath, userDataParams)
+	if err != nil {
+		return "", "", err
+	}
+
+	instanceProfile := nodePool.ConfigItems[nodePoolConfigKeyInstanceProfile]
+	if instanceProfile != "" && iamPolicy != "" {
+		return "", "", fmt.Errorf("only one of '%s' or an IAM policy can be specified for node pool %s", nodePoolConfigKeyInstanceProfile, nodePool.Name)
 	}
 
 	params := &stackParams{
-		Cluster:  p.Cluster,
-		NodePool: nodePool,
-		UserData: renderedUserData,
-		Values:   values,
+		Cluster:         p.Cluster,
+		NodePool:        nodePool,
+		UserData:        renderedUserData,
+		Values:          values,
+		IAMPolicy:       iamPolicy,
+		InstanceProfile: instanceProfile,
 	}
 
 	stackFilePath := path.Join(nodePoolProfilesPath, stackFileName)
-	return renderTemplate(newTemplateContext(nodePoolProfilesPath), stackFilePath, params)
+	template, err := renderTemplate(newTemplateContext(nodePoolProfilesPath), stackFilePath, params)
+	if err != nil {
+		return "", "", err
+	}
+
+	// presigned URLs are refreshed before they expire, which mustn't roll
+	// the nodes.
+	return template, nodePoolConfigHash(strings.Replace(template, renderedUserData, stableUserData, -1)), nil
+}
+
+// renderIAMPolicy renders the IAM policy document of a node pool and returns
+// it JSON encoded. The policy is read from the iam-policies/<name>.yaml file of
+// the node pool profile if the node pool selects one with the iam_policy
+// config item, otherwise from the iam-policy.yaml file of the profile. An empty
+// string is returned if the profile doesn't define an IAM policy.
+func renderIAMPolicy(nodePoolProfilesPath string, params *userDataParams) (string, error) {
+	policyPath := path.Join(nodePoolProfilesPath, iamPolicyFileName)
+
+	name, ok := params.NodePool.ConfigItems[nodePoolConfigKeyIAMPolicy]
+	if ok {
+		if name == "" || strings.ContainsAny(name, "/.") {
+			return "", fmt.Errorf("invalid IAM policy name '%s'", name)
+		}
+		policyPath = path.Join(nodePoolProfilesPath, iamPoliciesDir, name+".yaml")
+	}
+
+	_, err := os.Stat(policyPath)
+	if err != nil {
+		// a policy is only required if explicitly selected.
+		if os.IsNotExist(err) && !ok {
+			return "", nil
+		}
+		return "", err
+	}
+
+	rendered, err := renderTemplate(newTemplateContext(nodePoolProfilesPath), policyPath, params)
+	if err != nil {
+		return "", err
+	}
+
+	policy, err := yaml.YAMLToJSON([]byte(rendered))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse IAM policy %s: %v", policyPath, err)
+	}
+
+	var document struct {
+		Version   string        `json:"Version"`
+		Statement []interface{} `json:"Statement"`
+	}
+	err = json.Unmarshal(policy, &document)
+	if err != nil || len(document.Statement) == 0 {
+		return "", fmt.Errorf("IAM policy %s must be a policy document with at least one statement", policyPath)
+	}
+
+	return string(policy), nil
 }
 
 // Provision provisions node pools of the cluster.
-func (p *AWSNodePoolProvisioner) Provision(values map[string]interface{}) error {
+func (p *AWSNodePoolProvisioner) Provision(ctx context.Context, values map[string]interface{}) error {
+	return p.provision(ctx, values, getNonLegacyNodePools(p.Cluster))
+}
+
+// ProvisionNodePool provisions a single node pool of the cluster.
+func (p *AWSNodePoolProvisioner) ProvisionNodePool(ctx context.Context, values map[string]interface{}, nodePool *api.NodePool) error {
+	return p.provision(ctx, values, []*api.NodePool{nodePool})
+}
+
+// provision provisions the node pools in parallel.
+func (p *AWSNodePoolProvisioner) provision(ctx context.Context, values map[string]interface{}, nodePools []*api.NodePool) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "node-pools", nil)
+	defer func() { span.End(err) }()
+
 	// create S3 bucket if it doesn't exist
 	// the bucket is used for storing the ignition userdata for the node
 	// pools.
-	err := p.awsAdapter.createS3Bucket(p.bucketName)
+	err = p.awsAdapter.createS3Bucket(p.bucketName)
+	if err != nil {
+		return err
+	}
+
+	subnets, _ := values["subnets"].(map[string]string)
+	p.rollout, err = newImageRollout(p.Cluster, p.httpConfig, subnets)
 	if err != nil {
 		return err
 	}
 
-	// TODO(tech-depth): remove non-legacy node pool filter
-	nodePools := getNonLegacyNodePools(p.Cluster)
 	errorsc := make(chan error, len(nodePools))
 
 	// provision node pools in parallel
@@ -124,7 +241,9 @@ func (p *AWSNodePoolProvisioner) Provision(values map[string]interface{}) error
 		}
 
 		go func(nodePool api.NodePool, errorsc chan error) {
+			_, poolSpan := tracing.StartSpan(ctx, "node-pool-stack", map[string]string{"node_pool": nodePool.Name})
 			err := p.provisionNodePool(&nodePool, poolValues)
+			poolSpan.End(err)
 			if err != nil {
 				err = fmt.Errorf("failed to provision node pool %s: %s", nodePool.Name, err)
 			}
@@ -147,8 +266,104 @@ func (p *AWSNodePoolProvisioner) Provision(values map[string]interface{}) error
 	return nil
 }
 
+// HandleTerminations configures the termination hooks of the node pools and
+// drains the nodes terminated outside of the CLM, e.g. by an autoscaler,
+// which are held back by the hooks. The hooks are enabled by setting the
+// node_termination_hook_timeout config item of the cluster to the maximum
+// time a terminating node is held back.
+func (p *AWSNodePoolProvisioner) HandleTerminations(ctx context.Context) error {
+	var timeout time.Duration
+	if value, ok := p.Cluster.ConfigItems[configKeyNodeTerminationHookTimeout]; ok {
+		var err error
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("invalid value for %s: %s", configKeyNodeTerminationHookTimeout, value)
+		}
+	}
+
+	for _, nodePool := range getNonLegacyNodePools(p.Cluster) {
+		err := p.nodePoolManager.HandleTerminations(ctx, nodePool, timeout)
+		if err != nil {
+			return fmt.Errorf("failed to handle terminations of node pool %s: %v", nodePool.Name, err)
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RepairNodes terminates nodes which have been NotReady for longer than the
+// node_repair_not_ready_timeout config item of the cluster (15m by default)
+// so they're replaced, at most one per node pool. Setting the node_repair
+// config item to "false" opts the cluster out.
+func (p *AWSNodePoolProvisioner) RepairNodes(ctx context.Context) error {
+	if p.Cluster.ConfigItems[configKeyNodeRepair] == "false" {
+		return nil
+	}
+
+	timeout := defaultNodeRepairNotReadyTimeout
+	if value, ok := p.Cluster.ConfigItems[configKeyNodeRepairNotReadyTimeout]; ok {
+		var err error
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid value for %s: %s", configKeyNodeRepairNotReadyTimeout, value)
+		}
+	}
+
+	for _, nodePool := range getNonLegacyNodePools(p.Cluster) {
+		node, err := p.nodePoolManager.RepairNodes(ctx, nodePool, timeout)
+		if err != nil {
+			return fmt.Errorf("failed to repair the nodes of node pool %s: %v", nodePool.Name, err)
+		}
+		if node != nil {
+			p.logger.Infof("Terminated NotReady node %s of node pool %s", node.Name, nodePool.Name)
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // provisionNodePool provisions a single node pool.
 func (p *AWSNodePoolProvisioner) provisionNodePool(nodePool *api.NodePool, values map[string]interface{}) error {
+	stacks, err := p.nodePoolStacks(nodePool, values)
+	if err != nil {
+		return err
+	}
+
+	for _, stack := range stacks {
+		err = p.applyNodePoolStack(stack.nodePool, stack.name, stack.values, stack.tags)
+		if err != nil {
+			if stack.zone != "" {
+				return fmt.Errorf("zone %s: %v", stack.zone, err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nodePoolStack is a single stack of a node pool. Node pools with zonal
+// stacks have one stack per availability zone.
+type nodePoolStack struct {
+	name string
+	// zone is the availability zone of a zonal stack or empty.
+	zone     string
+	nodePool *api.NodePool
+	values   map[string]interface{}
+	tags     []*cloudformation.Tag
+}
+
+// nodePoolStacks returns the stacks of the node pool along with the values
+// to render them. Node pools substituting their instance type are rendered
+// with the substitute.
+func (p *AWSNodePoolProvisioner) nodePoolStacks(nodePool *api.NodePool, values map[string]interface{}) ([]*nodePoolStack, error) {
+	nodePool = substitutedNodePool(nodePool)
 	values["spot_price"] = ""
 
 	switch nodePool.DiscountStrategy {
@@ -157,26 +372,147 @@ func (p *AWSNodePoolProvisioner) provisionNodePool(nodePool *api.NodePool, value
 	case discountStrategySpotMaxPrice:
 		instanceInfo, err := awsExt.InstanceInfo(nodePool.InstanceType)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		onDemandPrice, ok := instanceInfo.Pricing[p.Cluster.Region]
 		if !ok {
-			return fmt.Errorf("no price data for region %s, instance type %s", p.Cluster.Region, nodePool.InstanceType)
+			return nil, fmt.Errorf("no price data for region %s, instance type %s", p.Cluster.Region, nodePool.InstanceType)
 		}
 
 		values["spot_price"] = onDemandPrice
 	default:
-		return fmt.Errorf("unsupported node pool discount_strategy %s", nodePool.DiscountStrategy)
+		return nil, fmt.Errorf("unsupported node pool discount_strategy %s", nodePool.DiscountStrategy)
 	}
 
-	template, err := p.generateNodePoolStackTemplate(nodePool, values)
+	setGPUValues(nodePool, values)
+
+	err := setInstanceStorageValues(nodePool, values)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	err = setEBSVolumeValues(p.Cluster, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if !zonalStacks(nodePool) {
+		stack := &nodePoolStack{
+			name:     nodePoolStackName(p.Cluster, nodePool, ""),
+			nodePool: nodePool,
+			values:   values,
+		}
+		return []*nodePoolStack{stack}, nil
+	}
+
+	subnets, ok := values["subnets"].(map[string]string)
+	if !ok {
+		return nil, fmt.Errorf("no subnets defined for node pool %s", nodePool.Name)
+	}
+
+	zones := nodePoolZones(subnets)
+	if len(zones) == 0 {
+		return nil, fmt.Errorf("no availability zones found for node pool %s", nodePool.Name)
 	}
 
+	// each zone gets an equal share of the node pool.
+	minSize, err := asgSize(nodePool.MinSize, int64(len(zones)))
+	if err != nil {
+		return nil, err
+	}
+
+	maxSize, err := asgSize(nodePool.MaxSize, int64(len(zones)))
+	if err != nil {
+		return nil, err
+	}
+
+	stacks := make([]*nodePoolStack, 0, len(zones))
+	for _, zone := range zones {
+		zoneValuesCopy, err := copystructure.Copy(values)
+		if err != nil {
+			return nil, err
+		}
+
+		zoneValues, ok := zoneValuesCopy.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unable to copy values for node pool %s", nodePool.Name)
+		}
+
+		zoneValues["subnets"] = map[string]string{
+			zone:            subnets[zone],
+			subnetAllAZName: subnets[zone],
+		}
+		zoneValues["availability_zone"] = zone
+
+		zoneNodePool := *nodePool
+		zoneNodePool.MinSize = minSize
+		zoneNodePool.MaxSize = maxSize
+
+		stacks = append(stacks, &nodePoolStack{
+			name:     nodePoolStackName(p.Cluster, nodePool, zone),
+			zone:     zone,
+			nodePool: &zoneNodePool,
+			values:   zoneValues,
+			tags: []*cloudformation.Tag{
+				{
+					Key:   aws.String(nodePoolZoneTagKey),
+					Value: aws.String(zone),
+				},
+			},
+		})
+	}
+
+	return stacks, nil
+}
+
+// nodePoolZones returns the sorted availability zones of the subnets.
+func nodePoolZones(subnets map[string]string) []string {
+	zones := make([]string, 0, len(subnets))
+	for zone := range subnets {
+		if zone != subnetAllAZName {
+			zones = append(zones, zone)
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// zonalStacks returns true if the node pool should be provisioned as one
+// stack per availability zone instead of a single multi-AZ stack.
+func zonalStacks(nodePool *api.NodePool) bool {
+	return nodePool.ConfigItems[nodePoolConfigKeyZonalStacks] == "true"
+}
+
+// nodePoolStackName returns the name of the node pool stack. zone is the
+// availability zone for node pools with one stack per zone or an empty string
+// otherwise.
+func nodePoolStackName(cluster *api.Cluster, nodePool *api.NodePool, zone string) string {
 	// TODO: stackname pattern
-	stackName := fmt.Sprintf("nodepool-%s-%s", nodePool.Name, strings.Replace(p.Cluster.ID, ":", "-", -1))
+	if zone == "" {
+		return fmt.Sprintf("nodepool-%s-%s", nodePool.Name, strings.Replace(cluster.ID, ":", "-", -1))
+	}
+	return fmt.Sprintf("nodepool-%s-%s-%s", nodePool.Name, azID(zone), strings.Replace(cluster.ID, ":", "-", -1))
+}
+
+// applyNodePoolStack renders and applies a single node pool stack and waits
+// for it to be ready. extraTags are added to the default node pool stack
+// tags.
+func (p *AWSNodePoolProvisioner) applyNodePoolStack(nodePool *api.NodePool, stackName string, values map[string]interface{}, extraTags []*cloudformation.Tag) error {
+	imageTags, err := p.resolveNodePoolImage(nodePool, stackName, values)
+	if err != nil {
+		return err
+	}
+
+	template, configHash, err := p.generateNodePoolStackTemplate(nodePool, values)
+	if err != nil {
+		return err
+	}
+
+	err = validateStackVolumes(p.Cluster, stackName, []byte(template))
+	if err != nil {
+		return err
+	}
 
 	tags := []*cloudformation.Tag{
 		{
@@ -199,14 +535,20 @@ func (p *AWSNodePoolProvisioner) provisionNodePool(nodePool *api.NodePool, value
 			Key:   aws.String(nodePoolProfileTagKey),
 			Value: aws.String(nodePool.Profile),
 		},
+		{
+			Key:   aws.String(nodePoolConfigHashTagKey),
+			Value: aws.String(configHash),
+		},
 	}
+	tags = append(tags, extraTags...)
+	tags = append(tags, imageTags...)
 
 	err = p.awsAdapter.applyStack(stackName, template, "", tags, true)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), maxWaitTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), p.awsAdapter.stackApplyTimeout())
 	defer cancel()
 	err = p.awsAdapter.waitForStack(ctx, waitTime, stackName)
 	if err != nil {
@@ -216,8 +558,17 @@ func (p *AWSNodePoolProvisioner) provisionNodePool(nodePool *api.NodePool, value
 	return nil
 }
 
+// nodePoolConfigHash returns the hash of the rendered node pool stack
+// template. The template references the user data by its content so the
+// hash changes whenever the configuration of the nodes changes.
+func nodePoolConfigHash(template string) string {
+	hash := sha256.Sum256([]byte(template))
+	return hex.EncodeToString(hash[:])
+}
+
 // Reconcile finds all orphaned node pool stacks and decommission the node
 // pools by scaling them down gracefully and deleting the corresponding stacks.
+// Afterwards the legacy node pools are migrated if enabled for the cluster.
 func (p *AWSNodePoolProvisioner) Reconcile(ctx context.Context) error {
 	// decommission orphaned node pools
 	tags := map[string]string{
@@ -231,19 +582,43 @@ func (p *AWSNodePoolProvisioner) Reconcile(ctx context.Context) error {
 	}
 
 	// find orphaned by comparing node pool stacks to node pools defined for cluster
-	orphaned := orphanedNodePoolStacks(nodePoolStacks, p.Cluster.NodePools)
+	nodePools := getNonLegacyNodePools(p.Cluster)
+	orphaned := orphanedNodePoolStacks(nodePoolStacks, nodePools)
 
 	if len(orphaned) > 0 {
 		p.logger.Infof("Found %d node pool stacks to decommission", len(orphaned))
 	}
 
+	if p.awsAdapter.plan != nil {
+		for _, stack := range orphaned {
+			p.awsAdapter.plan.addStack(&StackPlan{
+				Name:     aws.StringValue(stack.StackName),
+				NodePool: nodePoolStackToNodePool(stack).Name,
+				Action:   StackActionDelete,
+			})
+		}
+		return p.migrateLegacyNodePools(ctx)
+	}
+
+	for _, stack := range nodePoolStacks {
+		if nodePool := staleZonalNodePool(stack, nodePools); nodePool != nil {
+			p.logger.Warnf("Stack %s doesn't match the zonal_stacks setting of node pool %s and must be removed manually", aws.StringValue(stack.StackName), nodePool.Name)
+		}
+	}
+
+	// a node pool can be backed by several stacks (one per availability
+	// zone) so it's only scaled down once before deleting all of them.
+	scaledDown := make(map[string]bool)
 	for _, stack := range orphaned {
 		nodePool := nodePoolStackToNodePool(stack)
 
 		// gracefully downscale node pool
-		err := p.nodePoolManager.ScalePool(ctx, nodePool, 0)
-		if err != nil {
-			return err
+		if !scaledDown[nodePool.Name] {
+			err := p.drainNodePool(ctx, nodePool)
+			if err != nil {
+				return err
+			}
+			scaledDown[nodePool.Name] = true
 		}
 
 		// delete node pool stack
@@ -253,55 +628,117 @@ func (p *AWSNodePoolProvisioner) Reconcile(ctx context.Context) error {
 		}
 	}
 
+	return p.migrateLegacyNodePools(ctx)
+}
+
+// drainNodePool gracefully scales down a node pool to 0 nodes. All nodes are
+// cordoned and drained through the node pool manager, respecting pod
+// disruption budgets and evict timeouts, before they are terminated. An error
+// is returned if any nodes remain in the pool, such that the stack is never
+// deleted with running nodes.
+func (p *AWSNodePoolProvisioner) drainNodePool(ctx context.Context, nodePool *api.NodePool) error {
+	p.logger.Infof("Draining node pool %s", nodePool.Name)
+
+	err := p.nodePoolManager.ScalePool(ctx, nodePool, 0)
+	if err != nil {
+		return fmt.Errorf("failed to drain node pool %s: %v", nodePool.Name, err)
+	}
+
+	pool, err := p.nodePoolManager.GetPool(nodePool)
+	if err != nil {
+		return err
+	}
+
+	if len(pool.Nodes) > 0 {
+		return fmt.Errorf("node pool %s still has %d nodes after draining", nodePool.Name, len(pool.Nodes))
+	}
+
 	return nil
 }
 
-// prepareUserData prepares the user data by rendering the mustache template
-// and uploading the User Data to S3. A EC2 UserData ready base64 string will
-// be returned.
-func (p *AWSNodePoolProvisioner) prepareUserData(basedir, clcPath string, config interface{}) (string, error) {
-	rendered, err := renderTemplate(newTemplateContext(basedir), clcPath, config)
+// prepareUserData prepares the user data by rendering the templates of the
+// node pool profile. Ignition configs are uploaded to S3 and replaced by a
+// config pulling them from there, cloud-init messages are passed as is. A
+// EC2 UserData ready base64 string will be returned, along with the user data
+// referencing the Ignition config by its S3 URI which, unlike a presigned
+// URL, only changes with the config.
+func (p *AWSNodePoolProvisioner) prepareUserData(basedir string, params *userDataParams) (string, string, error) {
+	userData, err := renderUserData(basedir, params)
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+
+	if userData.format == userDataFormatCloudInit {
+		data, err := cloudInitUserData(userData.source)
+		if err != nil {
+			return "", "", err
+		}
+		encoded := base64.StdEncoding.EncodeToString(data)
+		return encoded, encoded, nil
+	}
+
+	hosting, err := nodePoolIgnitionHosting(params.NodePool)
+	if err != nil {
+		return "", "", err
 	}
 
 	// convert to ignition
-	ignCfg, err := clcToIgnition([]byte(rendered))
+	ignCfg, version, err := userData.ignition()
 	if err != nil {
-		return "", fmt.Errorf("failed to parse config %s: %v", clcPath, err)
+		return "", "", fmt.Errorf("failed to parse config %s: %v", path.Join(basedir, userData.fileName()), err)
+	}
+
+	if hosting.compression == ignitionCompressionGzip {
+		ignCfg, err = gzipCompress(ignCfg)
+		if err != nil {
+			return "", "", err
+		}
 	}
 
 	// upload to s3
-	uri, err := p.uploadUserDataToS3(ignCfg, p.bucketName)
+	var uri, source string
+	if hosting.presigned {
+		uri, source, err = p.presignUserData(ignCfg, p.bucketName, hosting.validity)
+	} else {
+		uri, err = p.uploadUserDataToS3(ignCfg, p.bucketName)
+		source = uri
+	}
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	// create ignition config pulling from s3
-	ignCfg = []byte(fmt.Sprintf(ignitionBaseTemplate, uri))
+	pointer, err := ignitionPointerConfig(version, source, hosting.compression)
+	if err != nil {
+		return "", "", err
+	}
 
-	return base64.StdEncoding.EncodeToString(ignCfg), nil
+	stablePointer, err := ignitionPointerConfig(version, uri, hosting.compression)
+	if err != nil {
+		return "", "", err
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(pointer)), base64.StdEncoding.EncodeToString([]byte(stablePointer)), nil
 }
 
 // uploadUserDataToS3 uploads the provided userData to the specified S3 bucket.
 // The S3 object will be named by the sha512 hash of the data.
 func (p *AWSNodePoolProvisioner) uploadUserDataToS3(userData []byte, bucketName string) (string, error) {
-	// hash the userData to use as object name
-	hasher := sha512.New()
-	_, err := hasher.Write(userData)
-	if err != nil {
-		return "", err
-	}
-	sha := hex.EncodeToString(hasher.Sum(nil))
+	objectName := userDataObjectName(userData)
 
-	objectName := fmt.Sprintf("%s.userdata", sha)
+	// the object name only depends on the user data, so planned stacks
+	// reference the same object without uploading it.
+	if p.awsAdapter.plan != nil {
+		return fmt.Sprintf("s3://%s/%s", bucketName, objectName), nil
+	}
 
 	// Upload the stack template to S3
-	_, err = p.awsAdapter.s3Uploader.Upload(&s3manager.UploadInput{
+	_, err := p.awsAdapter.s3Uploader.Upload(&s3manager.UploadInput{
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(objectName),
 		Body:   bytes.NewReader(userData),
 	})
+	p.awsAdapter.audit.Record(audit.KindAWS, "s3-upload", fmt.Sprintf("s3://%s/%s", bucketName, objectName), err)
 	if err != nil {
 		return "", err
 	}
@@ -309,6 +746,13 @@ func (p *AWSNodePoolProvisioner) uploadUserDataToS3(userData []byte, bucketName
 	return fmt.Sprintf("s3://%s/%s", bucketName, objectName), nil
 }
 
+// userDataObjectName returns the name of the S3 object storing the user
+// data, the sha512 hash of the data.
+func userDataObjectName(userData []byte) string {
+	hash := sha512.Sum512(userData)
+	return fmt.Sprintf("%s.userdata", hex.EncodeToString(hash[:]))
+}
+
 func orphanedNodePoolStacks(nodePoolStacks []*cloudformation.Stack, nodePools []*api.NodePool) []*cloudformation.Stack {
 	orphaned := make([]*cloudformation.Stack, 0, len(nodePoolStacks))
 	for _, stack := range nodePoolStacks {
@@ -320,6 +764,27 @@ func orphanedNodePoolStacks(nodePoolStacks []*cloudformation.Stack, nodePools []
 	return orphaned
 }
 
+// staleZonalNodePool returns the node pool of a stack if the stack doesn't
+// match the zonal_stacks setting of the node pool, e.g. the multi-AZ stack of
+// a node pool which was switched to one stack per zone.
+func staleZonalNodePool(stack *cloudformation.Stack, nodePools []*api.NodePool) *api.NodePool {
+	np := nodePoolStackToNodePool(stack)
+
+	zonal := false
+	for _, tag := range stack.Tags {
+		if aws.StringValue(tag.Key) == nodePoolZoneTagKey {
+			zonal = true
+		}
+	}
+
+	for _, nodePool := range nodePools {
+		if nodePool.Name == np.Name && zonalStacks(nodePool) != zonal {
+			return nodePool
+		}
+	}
+	return nil
+}
+
 func inNodePoolList(nodePool *api.NodePool, nodePools []*api.NodePool) bool {
 	for _, np := range nodePools {
 		if np.Name == nodePool.Name {
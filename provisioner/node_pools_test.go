@@ -0,0 +1,334 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRenderIAMPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-pool-profile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(path.Join(dir, iamPoliciesDir), 0755))
+
+	defaultPolicy := `Version: "2012-10-17"
+Statement:
+- Effect: Allow
+  Action: ec2:DescribeInstances
+  Resource: "*"
+`
+	ingressPolicy := `Version: "2012-10-17"
+Statement:
+- Effect: Allow
+  Action: route53:ChangeResourceRecordSets
+  Resource: "arn:aws:route53:::hostedzone/{{ .NodePool.Name }}"
+`
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, iamPolicyFileName), []byte(defaultPolicy), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, iamPoliciesDir, "ingress.yaml"), []byte(ingressPolicy), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, iamPoliciesDir, "empty.yaml"), []byte(`Version: "2012-10-17"`), 0644))
+
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		expected    string
+		valid       bool
+	}{
+		{
+			msg:      "profile default policy",
+			expected: `{"Statement":[{"Action":"ec2:DescribeInstances","Effect":"Allow","Resource":"*"}],"Version":"2012-10-17"}`,
+			valid:    true,
+		},
+		{
+			msg:         "selected policy",
+			configItems: map[string]string{nodePoolConfigKeyIAMPolicy: "ingress"},
+			expected:    `{"Statement":[{"Action":"route53:ChangeResourceRecordSets","Effect":"Allow","Resource":"arn:aws:route53:::hostedzone/pool-1"}],"Version":"2012-10-17"}`,
+			valid:       true,
+		},
+		{
+			msg:         "missing policy",
+			configItems: map[string]string{nodePoolConfigKeyIAMPolicy: "missing"},
+			valid:       false,
+		},
+		{
+			msg:         "invalid policy name",
+			configItems: map[string]string{nodePoolConfigKeyIAMPolicy: "../iam-policy"},
+			valid:       false,
+		},
+		{
+			msg:         "policy without statements",
+			configItems: map[string]string{nodePoolConfigKeyIAMPolicy: "empty"},
+			valid:       false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			params := &userDataParams{
+				Cluster:  &api.Cluster{},
+				NodePool: &api.NodePool{Name: "pool-1", ConfigItems: tc.configItems},
+			}
+
+			policy, err := renderIAMPolicy(dir, params)
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, policy)
+		})
+	}
+
+	// profiles without a policy use the shared role
+	policy, err := renderIAMPolicy(path.Join(dir, iamPoliciesDir), &userDataParams{NodePool: &api.NodePool{}})
+	require.NoError(t, err)
+	assert.Equal(t, "", policy)
+}
+
+func TestNodePoolStackName(t *testing.T) {
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1"}
+	nodePool := &api.NodePool{Name: "pool-1"}
+
+	assert.Equal(t, "nodepool-pool-1-aws-123456789012-eu-central-1-kube-1", nodePoolStackName(cluster, nodePool, ""))
+	assert.Equal(t, "nodepool-pool-1-1a-aws-123456789012-eu-central-1-kube-1", nodePoolStackName(cluster, nodePool, "eu-central-1a"))
+}
+
+func TestStaleZonalNodePool(t *testing.T) {
+	nodePools := []*api.NodePool{
+		{Name: "zonal", ConfigItems: map[string]string{nodePoolConfigKeyZonalStacks: "true"}},
+		{Name: "multi-az"},
+	}
+
+	stack := func(name, zone string) *cloudformation.Stack {
+		tags := []*cloudformation.Tag{{Key: aws.String(nodePoolTagKey), Value: aws.String(name)}}
+		if zone != "" {
+			tags = append(tags, &cloudformation.Tag{Key: aws.String(nodePoolZoneTagKey), Value: aws.String(zone)})
+		}
+		return &cloudformation.Stack{Tags: tags}
+	}
+
+	assert.Nil(t, staleZonalNodePool(stack("zonal", "eu-central-1a"), nodePools))
+	assert.Nil(t, staleZonalNodePool(stack("multi-az", ""), nodePools))
+	assert.Nil(t, staleZonalNodePool(stack("removed", ""), nodePools))
+	assert.Equal(t, nodePools[0], staleZonalNodePool(stack("zonal", ""), nodePools))
+	assert.Equal(t, nodePools[1], staleZonalNodePool(stack("multi-az", "eu-central-1a"), nodePools))
+}
+
+type mockNodePoolManager struct {
+	updatestrategy.NodePoolManager
+	scaleErr       error
+	remaining      []*updatestrategy.Node
+	scaled         map[string]int
+	hookTimeouts   map[string]time.Duration
+	repairTimeouts map[string]time.Duration
+}
+
+func (m *mockNodePoolManager) HandleTerminations(ctx context.Context, nodePool *api.NodePool, hookTimeout time.Duration) error {
+	if m.hookTimeouts == nil {
+		m.hookTimeouts = make(map[string]time.Duration)
+	}
+	m.hookTimeouts[nodePool.Name] = hookTimeout
+	return nil
+}
+
+func (m *mockNodePoolManager) RepairNodes(ctx context.Context, nodePool *api.NodePool, notReadyTimeout time.Duration) (*updatestrategy.Node, error) {
+	if m.repairTimeouts == nil {
+		m.repairTimeouts = make(map[string]time.Duration)
+	}
+	m.repairTimeouts[nodePool.Name] = notReadyTimeout
+	return nil, nil
+}
+
+func (m *mockNodePoolManager) ScalePool(ctx context.Context, nodePool *api.NodePool, replicas int) error {
+	if m.scaled == nil {
+		m.scaled = make(map[string]int)
+	}
+	m.scaled[nodePool.Name] = replicas
+	return m.scaleErr
+}
+
+func (m *mockNodePoolManager) GetPool(nodePool *api.NodePool) (*updatestrategy.NodePool, error) {
+	return &updatestrategy.NodePool{Nodes: m.remaining}, nil
+}
+
+func TestDrainNodePool(t *testing.T) {
+	for _, tc := range []struct {
+		msg     string
+		manager *mockNodePoolManager
+		valid   bool
+	}{
+		{
+			msg:     "drained",
+			manager: &mockNodePoolManager{},
+			valid:   true,
+		},
+		{
+			msg:     "scale down failed",
+			manager: &mockNodePoolManager{scaleErr: errors.New("eviction timeout")},
+			valid:   false,
+		},
+		{
+			msg:     "nodes remaining",
+			manager: &mockNodePoolManager{remaining: []*updatestrategy.Node{{Name: "node-1"}}},
+			valid:   false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			provisioner := &AWSNodePoolProvisioner{
+				nodePoolManager: tc.manager,
+				logger:          log.WithField("test", true),
+			}
+
+			err := provisioner.drainNodePool(context.Background(), &api.NodePool{Name: "pool-1"})
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+			assert.Equal(t, 0, tc.manager.scaled["pool-1"])
+		})
+	}
+}
+
+func TestHandleTerminations(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		value    string
+		expected time.Duration
+		valid    bool
+	}{
+		{msg: "disabled", expected: 0, valid: true},
+		{msg: "enabled", value: "30m", expected: 30 * time.Minute, valid: true},
+		{msg: "invalid", value: "forever", valid: false},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := &api.Cluster{
+				ConfigItems: map[string]string{},
+				NodePools:   []*api.NodePool{{Name: "pool-1"}},
+			}
+			if tc.value != "" {
+				cluster.ConfigItems[configKeyNodeTerminationHookTimeout] = tc.value
+			}
+
+			manager := &mockNodePoolManager{}
+			provisioner := &AWSNodePoolProvisioner{
+				nodePoolManager: manager,
+				Cluster:         cluster,
+				logger:          log.WithField("test", true),
+			}
+
+			err := provisioner.HandleTerminations(context.Background())
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, manager.hookTimeouts["pool-1"])
+		})
+	}
+}
+
+func TestRepairNodes(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		items    map[string]string
+		expected time.Duration
+		repaired bool
+		valid    bool
+	}{
+		{msg: "default", items: map[string]string{}, expected: defaultNodeRepairNotReadyTimeout, repaired: true, valid: true},
+		{msg: "custom timeout", items: map[string]string{configKeyNodeRepairNotReadyTimeout: "5m"}, expected: 5 * time.Minute, repaired: true, valid: true},
+		{msg: "disabled", items: map[string]string{configKeyNodeRepair: "false"}, repaired: false, valid: true},
+		{msg: "invalid", items: map[string]string{configKeyNodeRepairNotReadyTimeout: "0s"}, valid: false},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			manager := &mockNodePoolManager{}
+			provisioner := &AWSNodePoolProvisioner{
+				nodePoolManager: manager,
+				Cluster: &api.Cluster{
+					ConfigItems: tc.items,
+					NodePools:   []*api.NodePool{{Name: "pool-1"}},
+				},
+				logger: log.WithField("test", true),
+			}
+
+			err := provisioner.RepairNodes(context.Background())
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			timeout, repaired := manager.repairTimeouts["pool-1"]
+			assert.Equal(t, tc.repaired, repaired)
+			assert.Equal(t, tc.expected, timeout)
+		})
+	}
+}
+
+func TestGetNonLegacyNodePools(t *testing.T) {
+	cluster := &api.Cluster{
+		ConfigItems: map[string]string{},
+		NodePools: []*api.NodePool{
+			{Name: "master-default", Profile: "master-default", MinSize: 1},
+			{Name: "worker-default", Profile: "worker-default", MinSize: 2},
+			{Name: "pool-1"},
+		},
+	}
+
+	require.Equal(t, []*api.NodePool{{Name: "pool-1"}}, getNonLegacyNodePools(cluster))
+
+	cluster.ConfigItems[configKeyLegacyNodePoolMigration] = "true"
+	require.Equal(t, []*api.NodePool{
+		{Name: "default-master", Profile: "master-default", MinSize: 1},
+		{Name: "default-worker", Profile: "worker-default", MinSize: 2},
+		{Name: "pool-1"},
+	}, getNonLegacyNodePools(cluster))
+	require.Equal(t, "worker-default", cluster.NodePools[1].Name)
+}
+
+func TestLegacyNodePoolStacks(t *testing.T) {
+	stacks := []*cloudformation.Stack{
+		{StackName: aws.String("kube-1")},
+		{StackName: aws.String("nodepool-worker-default-kube-1"), Tags: []*cloudformation.Tag{{Key: aws.String(nodePoolRoleTagKey), Value: aws.String("true")}}},
+		{StackName: aws.String("kube-1-worker-default")},
+	}
+
+	legacy := legacyNodePoolStacks(stacks, "kube-1")
+	require.Len(t, legacy, 1)
+	require.Equal(t, "kube-1-worker-default", aws.StringValue(legacy[0].StackName))
+}
+
+func TestNodePoolReady(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		nodes    []*updatestrategy.Node
+		expected bool
+	}{
+		{msg: "no nodes", expected: false},
+		{msg: "not ready", nodes: []*updatestrategy.Node{{Name: "node-1"}, {Name: "node-2", Ready: true}}, expected: false},
+		{msg: "ready", nodes: []*updatestrategy.Node{{Name: "node-1", Ready: true}, {Name: "node-2", Ready: true}}, expected: true},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			provisioner := &AWSNodePoolProvisioner{
+				nodePoolManager: &mockNodePoolManager{remaining: tc.nodes},
+				logger:          log.WithField("test", true),
+			}
+
+			ready, err := provisioner.nodePoolReady(&api.NodePool{Name: "default-worker", MinSize: 2})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, ready)
+		})
+	}
+}
@@ -0,0 +1,446 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/openstack"
+	"golang.org/x/oauth2"
+)
+
+const (
+	openstackProviderID      = "zalando-openstack"
+	openstackAccountPrefix   = "openstack:"
+	heatStackFileName        = "heat-stack.yaml"
+	heatOutputAPIServerURL   = "api_server_url"
+	openstackClusterTagKey   = "cluster-lifecycle-manager.zalando.org/cluster"
+	openstackNodePoolTagKey  = "cluster-lifecycle-manager.zalando.org/node-pool"
+	openstackStackTimeout    = 60 * time.Minute
+	heatStatusCompleteSuffix = "_COMPLETE"
+	heatStatusFailedSuffix   = "_FAILED"
+	heatStatusProgressSuffix = "_IN_PROGRESS"
+)
+
+// openstackPollInterval is the interval between checking the status of a
+// Heat stack. It's defined as a variable so it can be changed in tests.
+var openstackPollInterval = 15 * time.Second
+
+// heatAPI is a minimal interface containing only the methods we use from the
+// Heat API.
+type heatAPI interface {
+	GetStack(ctx context.Context, name string) (*openstack.Stack, error)
+	ListStacks(ctx context.Context, tags []string) ([]*openstack.Stack, error)
+	CreateStack(ctx context.Context, input *openstack.StackInput) error
+	UpdateStack(ctx context.Context, stack *openstack.Stack, input *openstack.StackInput) error
+	DeleteStack(ctx context.Context, stack *openstack.Stack) error
+}
+
+// openstackProvisioner provisions clusters on OpenStack with Heat stacks
+// rendered from the same channel layout as the clusterpy clusters: a cluster
+// stack and a stack per node pool. The manifests of the channel are applied
+// the same way as for clusterpy clusters.
+type openstackProvisioner struct {
+	*clusterpyProvisioner
+	credentials *openstack.Credentials
+}
+
+// NewOpenStackProvisioner returns a new OpenStack provisioner managing the
+// stacks with the credentials and authenticating against the API servers of
+// the clusters with the token source.
+func NewOpenStackProvisioner(tokenSource oauth2.TokenSource, credentials *openstack.Credentials, options *Options) Provisioner {
+	return &openstackProvisioner{
+		clusterpyProvisioner: NewClusterpyProvisioner(tokenSource, "", nil, options).(*clusterpyProvisioner),
+		credentials:          credentials,
+	}
+}
+
+func (p *openstackProvisioner) Supports(cluster *api.Cluster) bool {
+	return cluster.Provider == openstackProviderID
+}
+
+// prepareOpenStack checks that the cluster can be handled by the provisioner
+// and initializes a Heat client for the project of the cluster and an adapter
+// for applying the manifests.
+func (p *openstackProvisioner) prepareOpenStack(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, auditLog *audit.Log) (*awsAdapter, heatAPI, error) {
+	if cluster.Provider != openstackProviderID {
+		return nil, nil, ErrProviderNotSupported
+	}
+
+	logger.Infof("openstack: Prepare for provisioning cluster %s (%s)..", cluster.ID, cluster.LifecycleStatus)
+
+	if !strings.HasPrefix(cluster.InfrastructureAccount, openstackAccountPrefix) {
+		return nil, nil, fmt.Errorf("openstack: Unknown format for infrastructure account '%s'", cluster.InfrastructureAccount)
+	}
+	project := strings.TrimPrefix(cluster.InfrastructureAccount, openstackAccountPrefix)
+
+	httpClient, err := p.httpConfig.Client(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	client := openstack.NewClient(p.credentials, project, cluster.Region, httpClient)
+
+	err = p.updateDefaults(cluster, channelConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read configuration defaults: %v", err)
+	}
+
+	err = validateConfigSchema(logger, cluster, channelConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokenSource, err := p.clusterTokenSource(cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	adapter := &awsAdapter{
+		apiServer: cluster.APIServerURL,
+		region:    cluster.Region,
+		tokenSrc:  tokenSource,
+		dryRun:    options.dryRun,
+		logger:    logger,
+		audit:     auditLog,
+	}
+	return adapter, client, nil
+}
+
+// Provision creates or updates the Heat stacks of the cluster and its node
+// pools and applies the manifests of the channel to the cluster.
+func (p *openstackProvisioner) Provision(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (err error) {
+	ctx, span := p.tracer.Start(ctx, "provision", traceAttributes(cluster, auditOperationProvision))
+	defer func() { span.End(err) }()
+
+	auditLog := p.newAuditLog(cluster, auditOperationProvision)
+	adapter, client, err := p.prepareOpenStack(logger, cluster, channelConfig, auditLog)
+	if err != nil {
+		return err
+	}
+	defer p.storeAuditLog(logger, cluster, auditLog)
+
+	values, err := p.genericClusterValues(cluster, channelConfig.Path)
+	if err != nil {
+		return err
+	}
+
+	template, err := renderTemplate(newTemplateContext(channelConfig.Path), path.Join(channelConfig.Path, "cluster", heatStackFileName), &stackParams{
+		Cluster: cluster,
+		Values:  values.Values,
+	})
+	if err != nil {
+		return err
+	}
+
+	clusterStack, err := applyHeatStack(ctx, adapter, client, &openstack.StackInput{
+		Name:     cluster.LocalID,
+		Template: template,
+		Tags:     strings.Join(heatStackTags(cluster, nil), ","),
+	})
+	if err != nil {
+		return err
+	}
+
+	if clusterStack == nil {
+		logger.Infof("Dry-run: Heat stack %s doesn't exist yet, skipping node pools and manifests", cluster.LocalID)
+		return nil
+	}
+
+	if apiServerURL := clusterStack.Output(heatOutputAPIServerURL); apiServerURL != "" {
+		cluster.APIServerURL = apiServerURL
+		adapter.apiServer = apiServerURL
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return err
+	}
+
+	if !options.applyOnly {
+		for _, nodePool := range cluster.NodePools {
+			err = p.applyNodePoolStack(ctx, adapter, client, cluster, nodePool, channelConfig.Path, values.Values)
+			if err != nil {
+				return err
+			}
+
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		err = deleteOrphanedNodePoolStacks(ctx, adapter, client, cluster)
+		if err != nil {
+			return err
+		}
+	}
+
+	apiClient, err := p.apiServerClient(cluster)
+	if err != nil {
+		return err
+	}
+
+	apiServerVersion, err := waitForAPIServer(logger, apiClient, cluster.APIServerURL, defaultAPIServerWaitTimeout, nil)
+	if err != nil {
+		return err
+	}
+	logger = logger.WithField("apiserver_version", apiServerVersion.GitVersion)
+
+	adapter.kubectl, err = p.kubectlBinary(logger, channelConfig, apiServerVersion.GitVersion)
+	if err != nil {
+		return err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	return p.applyGeneric(ctx, logger, adapter, cluster, path.Join(channelConfig.Path, manifestsPath), values)
+}
+
+// applyNodePoolStack creates or updates the Heat stack of the node pool. The
+// user data of the profile is converted to an Ignition config and passed to
+// the stack template as is, because unlike on AWS it isn't uploaded anywhere.
+func (p *openstackProvisioner) applyNodePoolStack(ctx context.Context, adapter *awsAdapter, client heatAPI, cluster *api.Cluster, nodePool *api.NodePool, channelPath string, values map[string]interface{}) error {
+	nodePoolProfilesPath := path.Join(channelPath, "cluster", "node-pools", nodePool.Profile)
+	fi, err := os.Stat(nodePoolProfilesPath)
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("failed to find configuration for node pool profile '%s'", nodePool.Profile)
+	}
+
+	userDataPath := path.Join(nodePoolProfilesPath, userDataFileName)
+	rendered, err := renderTemplate(newTemplateContext(nodePoolProfilesPath), userDataPath, &userDataParams{
+		Cluster:  cluster,
+		NodePool: nodePool,
+		Values:   values,
+	})
+	if err != nil {
+		return err
+	}
+
+	userData, err := clcToIgnition([]byte(rendered))
+	if err != nil {
+		return fmt.Errorf("failed to parse config %s: %v", userDataPath, err)
+	}
+
+	template, err := renderTemplate(newTemplateContext(nodePoolProfilesPath), path.Join(nodePoolProfilesPath, heatStackFileName), &stackParams{
+		Cluster:  cluster,
+		NodePool: nodePool,
+		UserData: string(userData),
+		Values:   values,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = applyHeatStack(ctx, adapter, client, &openstack.StackInput{
+		Name:     heatNodePoolStackName(cluster, nodePool.Name),
+		Template: template,
+		Tags:     strings.Join(heatStackTags(cluster, nodePool), ","),
+	})
+	return err
+}
+
+// Decommission deletes the Heat stacks of the node pools and the cluster.
+func (p *openstackProvisioner) Decommission(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (err error) {
+	// we don't support cancelling decommission operations yet
+	ctx, span := p.tracer.Start(context.Background(), "decommission", traceAttributes(cluster, auditOperationDecommission))
+	defer func() { span.End(err) }()
+
+	auditLog := p.newAuditLog(cluster, auditOperationDecommission)
+	adapter, client, err := p.prepareOpenStack(logger, cluster, channelConfig, auditLog)
+	if err != nil {
+		return err
+	}
+
+	err = checkDecommission(cluster)
+	if err != nil {
+		return err
+	}
+	defer p.storeAuditLog(logger, cluster, auditLog)
+
+	stacks, err := client.ListStacks(ctx, heatStackTags(cluster, nil))
+	if err != nil {
+		return err
+	}
+
+	// the node pools are deleted before the cluster stack they depend on
+	for _, stack := range stacks {
+		if heatStackNodePool(stack) == "" {
+			continue
+		}
+		err = deleteHeatStack(ctx, adapter, client, stack)
+		if err != nil {
+			return err
+		}
+	}
+
+	clusterStack, err := client.GetStack(ctx, cluster.LocalID)
+	if err != nil {
+		return err
+	}
+	if clusterStack == nil {
+		return nil
+	}
+	return deleteHeatStack(ctx, adapter, client, clusterStack)
+}
+
+// deleteOrphanedNodePoolStacks deletes the stacks of the node pools which
+// were removed from the cluster.
+func deleteOrphanedNodePoolStacks(ctx context.Context, adapter *awsAdapter, client heatAPI, cluster *api.Cluster) error {
+	stacks, err := client.ListStacks(ctx, heatStackTags(cluster, nil))
+	if err != nil {
+		return err
+	}
+
+	nodePools := make(map[string]bool, len(cluster.NodePools))
+	for _, nodePool := range cluster.NodePools {
+		nodePools[nodePool.Name] = true
+	}
+
+	for _, stack := range stacks {
+		name := heatStackNodePool(stack)
+		if name == "" || nodePools[name] {
+			continue
+		}
+		err = deleteHeatStack(ctx, adapter, client, stack)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// heatStackTags returns the tags of the cluster stack or, if nodePool is
+// set, of the stack of the node pool.
+func heatStackTags(cluster *api.Cluster, nodePool *api.NodePool) []string {
+	tags := []string{openstackClusterTagKey + "=" + cluster.LocalID}
+	if nodePool != nil {
+		tags = append(tags, openstackNodePoolTagKey+"="+nodePool.Name)
+	}
+	return tags
+}
+
+// heatStackNodePool returns the name of the node pool of the stack or an
+// empty string if it isn't a node pool stack.
+func heatStackNodePool(stack *openstack.Stack) string {
+	for _, tag := range stack.Tags {
+		if strings.HasPrefix(tag, openstackNodePoolTagKey+"=") {
+			return strings.TrimPrefix(tag, openstackNodePoolTagKey+"=")
+		}
+	}
+	return ""
+}
+
+// heatNodePoolStackName returns the name of the stack of the node pool.
+func heatNodePoolStackName(cluster *api.Cluster, nodePool string) string {
+	return cluster.LocalID + "-" + nodePool
+}
+
+// applyHeatStack creates the stack or updates it if it already exists and
+// waits for the operation to complete. In dry-run mode the current stack is
+// returned unchanged, nil if it doesn't exist.
+func applyHeatStack(ctx context.Context, adapter *awsAdapter, client heatAPI, input *openstack.StackInput) (*openstack.Stack, error) {
+	stack, err := client.GetStack(ctx, input.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if adapter.dryRun {
+		adapter.logger.Infof("Dry-run: would create or update Heat stack %s", input.Name)
+		return stack, nil
+	}
+
+	input.Timeout = int(openstackStackTimeout.Minutes())
+
+	// a stack can't be updated while another operation is in progress, a
+	// failed stack however can be fixed by an update
+	if stack != nil && strings.HasSuffix(stack.Status, heatStatusProgressSuffix) {
+		stack, err = waitForHeatStack(ctx, client, input.Name)
+		if err != nil && (stack == nil || !strings.HasSuffix(stack.Status, heatStatusFailedSuffix)) {
+			return nil, err
+		}
+	}
+
+	if stack == nil {
+		err = client.CreateStack(ctx, input)
+		adapter.audit.Record(audit.KindOpenStack, "create-stack", input.Name, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Heat stack %s: %v", input.Name, err)
+		}
+		return waitForHeatStack(ctx, client, input.Name)
+	}
+
+	err = client.UpdateStack(ctx, stack, input)
+	adapter.audit.Record(audit.KindOpenStack, "update-stack", input.Name, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update Heat stack %s: %v", input.Name, err)
+	}
+	return waitForHeatStack(ctx, client, input.Name)
+}
+
+// deleteHeatStack deletes the stack and waits until it's gone.
+func deleteHeatStack(ctx context.Context, adapter *awsAdapter, client heatAPI, stack *openstack.Stack) error {
+	if adapter.dryRun {
+		adapter.logger.Infof("Dry-run: would delete Heat stack %s", stack.Name)
+		return nil
+	}
+
+	err := client.DeleteStack(ctx, stack)
+	adapter.audit.Record(audit.KindOpenStack, "delete-stack", stack.Name, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete Heat stack %s: %v", stack.Name, err)
+	}
+
+	_, err = waitForHeatStack(ctx, client, stack.Name)
+	return err
+}
+
+// waitForHeatStack waits until no operation is in progress on the stack and
+// returns it, nil if it was deleted. A failed operation is returned as an
+// error together with the stack.
+func waitForHeatStack(ctx context.Context, client heatAPI, name string) (*openstack.Stack, error) {
+	ctx, cancel := context.WithTimeout(ctx, openstackStackTimeout)
+	defer cancel()
+
+	for {
+		stack, err := client.GetStack(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case stack == nil:
+			return nil, nil
+		case strings.HasSuffix(stack.Status, heatStatusCompleteSuffix):
+			return stack, nil
+		case strings.HasSuffix(stack.Status, heatStatusFailedSuffix):
+			return stack, fmt.Errorf("heat stack %s failed with status %s: %s", name, stack.Status, stack.StatusReason)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timeout waiting for Heat stack %s: %v", name, ctx.Err())
+		case <-time.After(openstackPollInterval):
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/openstack"
+)
+
+// heatAPIStub keeps the stacks in memory. Operations complete with the next
+// status check.
+type heatAPIStub struct {
+	stacks  map[string]*openstack.Stack
+	pending map[string]string
+	failed  map[string]bool
+}
+
+func newHeatAPIStub(stacks ...*openstack.Stack) *heatAPIStub {
+	stub := &heatAPIStub{
+		stacks:  make(map[string]*openstack.Stack),
+		pending: make(map[string]string),
+		failed:  make(map[string]bool),
+	}
+	for _, stack := range stacks {
+		stub.stacks[stack.Name] = stack
+	}
+	return stub
+}
+
+func (h *heatAPIStub) GetStack(ctx context.Context, name string) (*openstack.Stack, error) {
+	stack, ok := h.stacks[name]
+	if !ok {
+		return nil, nil
+	}
+
+	if operation, ok := h.pending[name]; ok {
+		delete(h.pending, name)
+		if operation == "DELETE" {
+			delete(h.stacks, name)
+			return nil, nil
+		}
+		stack.Status = operation + "_COMPLETE"
+		if h.failed[name] {
+			stack.Status = operation + "_FAILED"
+		}
+	}
+	return stack, nil
+}
+
+func (h *heatAPIStub) ListStacks(ctx context.Context, tags []string) ([]*openstack.Stack, error) {
+	var result []*openstack.Stack
+	for _, stack := range h.stacks {
+		if hasAllTags(stack.Tags, tags) {
+			result = append(result, stack)
+		}
+	}
+	return result, nil
+}
+
+func hasAllTags(tags []string, required []string) bool {
+	for _, tag := range required {
+		found := false
+		for _, t := range tags {
+			found = found || t == tag
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *heatAPIStub) CreateStack(ctx context.Context, input *openstack.StackInput) error {
+	h.stacks[input.Name] = &openstack.Stack{ID: "id-" + input.Name, Name: input.Name, Status: "CREATE_IN_PROGRESS"}
+	h.pending[input.Name] = "CREATE"
+	return nil
+}
+
+func (h *heatAPIStub) UpdateStack(ctx context.Context, stack *openstack.Stack, input *openstack.StackInput) error {
+	if _, ok := h.pending[stack.Name]; ok {
+		return errors.New("stack operation in progress")
+	}
+	h.stacks[stack.Name].Status = "UPDATE_IN_PROGRESS"
+	h.pending[stack.Name] = "UPDATE"
+	return nil
+}
+
+func (h *heatAPIStub) DeleteStack(ctx context.Context, stack *openstack.Stack) error {
+	h.pending[stack.Name] = "DELETE"
+	return nil
+}
+
+func openstackTestAdapter(dryRun bool) *awsAdapter {
+	return &awsAdapter{
+		dryRun: dryRun,
+		logger: log.WithField("test", true),
+		audit:  audit.NewLog("openstack:project:dc1:kube-1", auditOperationProvision),
+	}
+}
+
+func TestApplyHeatStack(t *testing.T) {
+	openstackPollInterval = time.Millisecond
+	client := newHeatAPIStub()
+	adapter := openstackTestAdapter(false)
+
+	stack, err := applyHeatStack(context.Background(), adapter, client, &openstack.StackInput{Name: "kube-1", Template: "{}"})
+	require.NoError(t, err)
+	require.Equal(t, "CREATE_COMPLETE", stack.Status)
+
+	stack, err = applyHeatStack(context.Background(), adapter, client, &openstack.StackInput{Name: "kube-1", Template: "{}"})
+	require.NoError(t, err)
+	require.Equal(t, "UPDATE_COMPLETE", stack.Status)
+
+	client.failed["kube-1"] = true
+	_, err = applyHeatStack(context.Background(), adapter, client, &openstack.StackInput{Name: "kube-1", Template: "{}"})
+	require.Error(t, err)
+	require.Len(t, adapter.audit.Entries, 3)
+
+	// in dry-run mode nothing is created
+	stack, err = applyHeatStack(context.Background(), openstackTestAdapter(true), client, &openstack.StackInput{Name: "kube-2", Template: "{}"})
+	require.NoError(t, err)
+	require.Nil(t, stack)
+	require.NotContains(t, client.stacks, "kube-2")
+}
+
+func TestDeleteOrphanedNodePoolStacks(t *testing.T) {
+	openstackPollInterval = time.Millisecond
+	cluster := &api.Cluster{
+		LocalID:   "kube-1",
+		NodePools: []*api.NodePool{{Name: "default-worker"}},
+	}
+	other := &api.Cluster{LocalID: "kube-2"}
+	stack := func(cluster *api.Cluster, nodePool string) *openstack.Stack {
+		if nodePool == "" {
+			return &openstack.Stack{Name: cluster.LocalID, Status: "CREATE_COMPLETE", Tags: heatStackTags(cluster, nil)}
+		}
+		return &openstack.Stack{Name: heatNodePoolStackName(cluster, nodePool), Status: "CREATE_COMPLETE", Tags: heatStackTags(cluster, &api.NodePool{Name: nodePool})}
+	}
+
+	client := newHeatAPIStub(
+		stack(cluster, ""),
+		stack(cluster, "default-worker"),
+		stack(cluster, "removed"),
+		stack(other, "removed"),
+	)
+
+	require.NoError(t, deleteOrphanedNodePoolStacks(context.Background(), openstackTestAdapter(true), client, cluster))
+	require.Len(t, client.stacks, 4)
+
+	require.NoError(t, deleteOrphanedNodePoolStacks(context.Background(), openstackTestAdapter(false), client, cluster))
+	require.Len(t, client.stacks, 3)
+	require.NotContains(t, client.stacks, "kube-1-removed")
+	require.Contains(t, client.stacks, "kube-2-removed")
+}
+
+func TestHeatStackNodePool(t *testing.T) {
+	cluster := &api.Cluster{LocalID: "kube-1"}
+	require.Equal(t, "", heatStackNodePool(&openstack.Stack{Tags: heatStackTags(cluster, nil)}))
+	require.Equal(t, "default-worker", heatStackNodePool(&openstack.Stack{Tags: heatStackTags(cluster, &api.NodePool{Name: "default-worker"})}))
+}
+
+func TestOpenStackSupports(t *testing.T) {
+	p := &openstackProvisioner{clusterpyProvisioner: &clusterpyProvisioner{}}
+	require.True(t, p.Supports(&api.Cluster{Provider: openstackProviderID}))
+	require.False(t, p.Supports(&api.Cluster{Provider: providerID}))
+
+	_, _, err := p.prepareOpenStack(log.WithField("test", true), &api.Cluster{Provider: openstackProviderID, InfrastructureAccount: "aws:123456789012"}, nil, nil)
+	require.Error(t, err)
+}
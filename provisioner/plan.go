@@ -0,0 +1,576 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+// Actions planned for a stack.
+const (
+	StackActionCreate    = "create"
+	StackActionUpdate    = "update"
+	StackActionDelete    = "delete"
+	StackActionUnchanged = "unchanged"
+)
+
+const (
+	changeSetNamePrefix = "clm-plan-"
+	changeSetTimeout    = 5 * time.Minute
+)
+
+// changeSetPollInterval is the interval between checking the status of a
+// change set. It's defined as a variable so it can be changed in tests.
+var changeSetPollInterval = 5 * time.Second
+
+// Plan describes the changes provisioning a cluster would make.
+type Plan struct {
+	Cluster string
+	// NewCluster is true if the cluster doesn't exist yet, in which case
+	// node replacements and manifests aren't planned.
+	NewCluster       bool
+	Stacks           []*StackPlan
+	NodeReplacements []*NodeReplacementPlan
+	Manifests        []*ManifestPlan
+	Deletions        []*DeletionPlan
+	// mutex guards Stacks, node pool stacks are planned in parallel.
+	mutex sync.Mutex
+}
+
+// StackPlan describes the planned changes of a CloudFormation stack.
+type StackPlan struct {
+	Name string
+	// NodePool is the name of the node pool if it's a node pool stack.
+	NodePool string
+	Action   string
+	Changes  []*StackResourceChange
+}
+
+// StackResourceChange is a change of a single stack resource as reported by
+// the change set of the stack.
+type StackResourceChange struct {
+	LogicalID    string
+	ResourceType string
+	Action       string
+	Replacement  string
+}
+
+// NodeReplacementPlan describes the nodes of a node pool which would be
+// replaced by the rolling update.
+type NodeReplacementPlan struct {
+	NodePool string
+	Nodes    int
+	Total    int
+	Reason   string
+}
+
+// ManifestPlan describes the changes applying a manifest would make.
+type ManifestPlan struct {
+	File      string
+	Resources []string
+	Diff      string
+	// Error is set if the changes couldn't be determined.
+	Error string
+}
+
+// DeletionPlan describes a resource deletion from deletions.yaml.
+type DeletionPlan struct {
+	Phase string
+	// Component is the component shipping the deletion, if it's not from
+	// the top-level deletions.yaml.
+	Component string
+	Kind      string
+	Namespace string
+	// Name is the name of the resource or the selector matching the
+	// resources.
+	Name string
+}
+
+func (p *Plan) addStack(stack *StackPlan) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Stacks = append(p.Stacks, stack)
+}
+
+// launchConfigurationChanged returns true if the launch configuration of a
+// stack of the node pool changes, which replaces all the nodes of the pool.
+func (p *Plan) launchConfigurationChanged(nodePool string) bool {
+	for _, stack := range p.Stacks {
+		if stack.NodePool != nodePool {
+			continue
+		}
+
+		for _, change := range stack.Changes {
+			switch change.ResourceType {
+			case "AWS::AutoScaling::LaunchConfiguration", "AWS::EC2::LaunchTemplate":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nodePoolCreated returns true if the stacks of the node pool don't exist
+// yet.
+func (p *Plan) nodePoolCreated(nodePool string) bool {
+	for _, stack := range p.Stacks {
+		if stack.NodePool == nodePool && stack.Action == StackActionCreate {
+			return true
+		}
+	}
+	return false
+}
+
+// redact masks the sensitive values in the manifest diffs.
+func (p *Plan) redact(redactor *logging.Redactor) {
+	for _, manifest := range p.Manifests {
+		manifest.Diff = redactor.Redact(manifest.Diff)
+		manifest.Error = redactor.Redact(manifest.Error)
+	}
+}
+
+// Write writes a human readable summary of the plan to w.
+func (p *Plan) Write(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Plan for cluster %s\n", p.Cluster)
+
+	fmt.Fprintf(&b, "\nStacks:\n")
+	for _, stack := range p.Stacks {
+		fmt.Fprintf(&b, "  %s %s\n", stack.Action, stack.Name)
+		for _, change := range stack.Changes {
+			fmt.Fprintf(&b, "    %s %s (%s)", change.Action, change.LogicalID, change.ResourceType)
+			if change.Replacement != "" {
+				fmt.Fprintf(&b, ", replacement: %s", change.Replacement)
+			}
+			fmt.Fprintf(&b, "\n")
+		}
+	}
+
+	if p.NewCluster {
+		fmt.Fprintf(&b, "\nNew cluster, all manifests will be applied once the API server is ready.\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	fmt.Fprintf(&b, "\nNode replacements:\n")
+	if len(p.NodeReplacements) == 0 {
+		fmt.Fprintf(&b, "  none\n")
+	}
+	for _, replacement := range p.NodeReplacements {
+		fmt.Fprintf(&b, "  %s: %d/%d nodes (%s)\n", replacement.NodePool, replacement.Nodes, replacement.Total, replacement.Reason)
+	}
+
+	fmt.Fprintf(&b, "\nManifests:\n")
+	if len(p.Manifests) == 0 {
+		fmt.Fprintf(&b, "  no changes\n")
+	}
+	for _, manifest := range p.Manifests {
+		fmt.Fprintf(&b, "  %s: %s\n", manifest.File, strings.Join(manifest.Resources, ", "))
+		if manifest.Error != "" {
+			fmt.Fprintf(&b, "    failed to diff: %s\n", manifest.Error)
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimRight(manifest.Diff, "\n"), "\n") {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nDeletions:\n")
+	if len(p.Deletions) == 0 {
+		fmt.Fprintf(&b, "  none\n")
+	}
+	for _, deletion := range p.Deletions {
+		phase := deletion.Phase
+		if deletion.Component != "" {
+			phase = fmt.Sprintf("%s (%s)", deletion.Phase, deletion.Component)
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", phase, kubernetesResourceName(deletion.Kind, deletion.Namespace, deletion.Name))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// planStack records the changes applying the stack would make in the plan.
+// The changes of existing stacks are determined with a change set which is
+// deleted afterwards.
+func (a *awsAdapter) planStack(stackName string, stackTemplate string, stackTemplateURL string, tags []*cloudformation.Tag, updateStack bool) error {
+	stack := &StackPlan{Name: stackName}
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == nodePoolTagKey {
+			stack.NodePool = aws.StringValue(tag.Value)
+		}
+	}
+
+	_, err := a.getStackByName(stackName)
+	if err != nil {
+		if !isDoesNotExistsErr(err) {
+			return err
+		}
+		stack.Action = StackActionCreate
+		a.plan.addStack(stack)
+		return nil
+	}
+
+	stack.Action = StackActionUnchanged
+	if updateStack {
+		stack.Changes, err = a.stackChanges(stackName, stackTemplate, stackTemplateURL, tags)
+		if err != nil {
+			return fmt.Errorf("failed to plan stack %s: %v", stackName, err)
+		}
+
+		if len(stack.Changes) > 0 {
+			stack.Action = StackActionUpdate
+		}
+	}
+
+	a.plan.addStack(stack)
+	return nil
+}
+
+// stackChanges creates a change set for updating the stack and returns its
+// changes.
+func (a *awsAdapter) stackChanges(stackName string, stackTemplate string, stackTemplateURL string, tags []*cloudformation.Tag) ([]*StackResourceChange, error) {
+	params := &cloudformation.CreateChangeSetInput{
+		StackName:     aws.String(stackName),
+		ChangeSetName: aws.String(fmt.Sprintf("%s%d", changeSetNamePrefix, time.Now().Unix())),
+		ChangeSetType: aws.String(cloudformation.ChangeSetTypeUpdate),
+		Capabilities:  []*string{aws.String(cloudformation.CapabilityCapabilityNamedIam)},
+		Tags:          tags,
+	}
+
+	if stackTemplateURL != "" {
+		params.TemplateURL = aws.String(stackTemplateURL)
+	} else {
+		params.TemplateBody = aws.String(stackTemplate)
+	}
+
+	changeSet, err := a.cloudformationClient.CreateChangeSet(params)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_, err := a.cloudformationClient.DeleteChangeSet(&cloudformation.DeleteChangeSetInput{
+			ChangeSetName: changeSet.Id,
+		})
+		if err != nil {
+			a.logger.Warnf("Failed to delete change set %s: %v", aws.StringValue(changeSet.Id), err)
+		}
+	}()
+
+	var changes []*StackResourceChange
+	describeParams := &cloudformation.DescribeChangeSetInput{ChangeSetName: changeSet.Id}
+	deadline := time.After(changeSetTimeout)
+	for {
+		resp, err := a.cloudformationClient.DescribeChangeSet(describeParams)
+		if err != nil {
+			return nil, err
+		}
+
+		switch aws.StringValue(resp.Status) {
+		case cloudformation.ChangeSetStatusCreateComplete:
+			for _, change := range resp.Changes {
+				if change.ResourceChange == nil {
+					continue
+				}
+				changes = append(changes, &StackResourceChange{
+					LogicalID:    aws.StringValue(change.ResourceChange.LogicalResourceId),
+					ResourceType: aws.StringValue(change.ResourceChange.ResourceType),
+					Action:       aws.StringValue(change.ResourceChange.Action),
+					Replacement:  aws.StringValue(change.ResourceChange.Replacement),
+				})
+			}
+
+			if resp.NextToken == nil {
+				return changes, nil
+			}
+			describeParams.NextToken = resp.NextToken
+			continue
+		case cloudformation.ChangeSetStatusFailed:
+			// change sets without changes fail to be created
+			reason := aws.StringValue(resp.StatusReason)
+			if strings.Contains(reason, "didn't contain changes") || strings.Contains(reason, cloudformationNoUpdateMsg) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("change set failed: %s", reason)
+		}
+
+		select {
+		case <-time.After(changeSetPollInterval):
+		case <-deadline:
+			return nil, fmt.Errorf("timed out after %s waiting for the change set", changeSetTimeout)
+		}
+	}
+}
+
+// Plan returns the changes provisioning the cluster with the channel config
+// would make without changing anything. Stacks are planned with
+// CloudFormation change sets, manifests are compared to the cluster with
+// kubectl diff.
+func (p *clusterpyProvisioner) Plan(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*Plan, error) {
+	adapter, _, nodePoolManager, err := p.prepareProvision(logger, cluster, channelConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// planning must not persist the progress of node pool updates
+	if tracking, ok := nodePoolManager.(*updatestrategy.ProgressTrackingNodePoolManager); ok {
+		nodePoolManager = tracking.NodePoolManager
+	}
+
+	plan := &Plan{Cluster: cluster.ID}
+	adapter.plan = plan
+
+	switch cluster.LifecycleStatus {
+	case models.ClusterLifecycleStatusRequested, models.ClusterUpdateLifecycleStatusCreating:
+		plan.NewCluster = true
+	default:
+		err = p.checkVersionSkew(logger, cluster)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = p.checkEtcdCompatibility(ctx, logger, cluster, channelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isMinimalProfile(cluster) {
+		etcdStackDefinitionPath := path.Join(channelConfig.Path, etcdStackDefinitionFile)
+
+		etcdParameters, err := p.etcdStackParameters(ctx, logger, adapter, cluster, etcdStackDefinitionPath)
+		if err != nil {
+			return nil, err
+		}
+
+		err = adapter.CreateOrUpdateEtcdStack(ctx, etcdStackVersion(cluster), etcdStackDefinitionPath, cluster, etcdParameters...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = adapter.CreateOrUpdateClusterStack(ctx, cluster.LocalID, path.Join(channelConfig.Path, "cluster", "senza-definition.yaml"), cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.applyRegionalStacks(ctx, adapter, cluster, channelConfig.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	hibernate, err := p.hibernate(logger, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	nodePoolProvisioner := newNodePoolProvisioner(logger, adapter, nodePoolManager, nodePoolCluster(cluster, hibernate), channelConfig, p.httpConfig)
+
+	values, err := p.clusterValues(adapter, cluster, channelConfig.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = nodePoolProvisioner.Provision(ctx, values.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	err = nodePoolProvisioner.Reconcile(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if plan.NewCluster {
+		return plan, nil
+	}
+
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	if !options.applyOnly {
+		err = planNodeReplacements(plan, nodePoolManager, cluster)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := p.apiServerClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	apiServerVersion, err := probeAPIServer(client, cluster.APIServerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter.kubectl, err = p.kubectlBinary(logger, channelConfig, apiServerVersion.GitVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.planManifests(logger, adapter, cluster, path.Join(channelConfig.Path, manifestsPath))
+	if err != nil {
+		return nil, err
+	}
+
+	// the diffs show the rendered manifests, which can contain the values
+	// of sensitive config items, also base64 encoded in secrets.
+	sensitiveValues, err := SensitiveConfigValues(cluster, channelConfig)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range sensitiveValues {
+		sensitiveValues = append(sensitiveValues, base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+	redactor := logging.NewRedactor()
+	redactor.SetValues(cluster.ID, sensitiveValues)
+	plan.redact(redactor)
+
+	return plan, nil
+}
+
+// planNodeReplacements records the nodes the rolling update would replace:
+// all nodes of node pools whose launch configuration changes and the nodes
+// which are already outdated otherwise.
+func planNodeReplacements(plan *Plan, nodePoolManager updatestrategy.NodePoolManager, cluster *api.Cluster) error {
+	for _, nodePool := range cluster.NodePools {
+		// new node pools have no nodes to replace
+		if plan.nodePoolCreated(nodePool.Name) {
+			continue
+		}
+
+		pool, err := nodePoolManager.GetPool(nodePool)
+		if err != nil {
+			return fmt.Errorf("failed to get node pool %s: %v", nodePool.Name, err)
+		}
+
+		replacement := &NodeReplacementPlan{
+			NodePool: nodePool.Name,
+			Total:    len(pool.Nodes),
+		}
+
+		if plan.launchConfigurationChanged(nodePool.Name) {
+			replacement.Nodes = len(pool.Nodes)
+			replacement.Reason = "launch configuration changes"
+		} else {
+			for _, node := range pool.Nodes {
+				if node.Generation != pool.Generation {
+					replacement.Nodes++
+				}
+			}
+			replacement.Reason = "outdated nodes"
+		}
+
+		if replacement.Nodes > 0 {
+			plan.NodeReplacements = append(plan.NodeReplacements, replacement)
+		}
+	}
+	return nil
+}
+
+// planManifests records the deletions and the manifests which would change
+// the cluster if applied.
+func (p *clusterpyProvisioner) planManifests(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, manifestsPath string) error {
+	clusterDeletions, manifests, err := p.prepareManifests(logger, adapter, cluster, manifestsPath)
+	if err != nil {
+		return err
+	}
+
+	addDeletions := func(component string, componentDeletions *deletions) {
+		for _, phase := range []struct {
+			name      string
+			resources []*resource
+		}{
+			{name: "pre_apply", resources: componentDeletions.PreApply},
+			{name: "post_apply", resources: componentDeletions.PostApply},
+		} {
+			for _, deletion := range phase.resources {
+				name := deletion.Name
+				if name == "" {
+					name = deletion.selector()
+				}
+				adapter.plan.Deletions = append(adapter.plan.Deletions, &DeletionPlan{
+					Phase:     phase.name,
+					Component: component,
+					Kind:      deletion.Kind,
+					Namespace: deletion.Namespace,
+					Name:      name,
+				})
+			}
+		}
+	}
+
+	addDeletions("", clusterDeletions)
+	for _, component := range applyOrder(cluster, manifests, clusterDeletions) {
+		addDeletions(component, clusterDeletions.component(component))
+	}
+
+	asArgs, err := impersonationArgs(cluster)
+	if err != nil {
+		return err
+	}
+
+	for _, manifest := range manifests {
+		kubeconfig, cleanup, err := kubectlKubeconfig(cluster, adapter.tokenSrc)
+		if err != nil {
+			return err
+		}
+
+		args := append([]string{adapter.kubectl, "diff", "--kubeconfig=" + kubeconfig}, asArgs...)
+		args = append(args, "-f", "-")
+
+		cmd := exec.Command(args[0], args[1:]...)
+		// prevent kubectl to find the in-cluster config, kubectl diff
+		// needs the PATH to find diff.
+		cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+		cmd.Stdin = strings.NewReader(manifest.Content)
+
+		output, err := cmd.Output()
+		cleanup()
+		if err == nil {
+			continue
+		}
+
+		planned := &ManifestPlan{
+			File:      strings.TrimPrefix(manifest.File, manifestsPath+"/"),
+			Resources: manifestResources(manifest.Content),
+		}
+
+		// kubectl diff exits with 1 if there are differences
+		exitErr, ok := err.(*exec.ExitError)
+		switch {
+		case ok && exitErr.ExitCode() == 1:
+			planned.Diff = string(output)
+		case ok:
+			planned.Error = strings.TrimSpace(string(exitErr.Stderr))
+		default:
+			return err
+		}
+		adapter.plan.Manifests = append(adapter.plan.Manifests, planned)
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package provisioner
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+func TestPlanStack(t *testing.T) {
+	adapter := newAWSAdapterWithStubs(cloudformation.StackStatusUpdateComplete, "123")
+	adapter.plan = &Plan{}
+	stub := adapter.cloudformationClient.(*cloudFormationAPIStub)
+
+	// changes
+	stub.changeSet = &cloudformation.DescribeChangeSetOutput{
+		Status: aws.String(cloudformation.ChangeSetStatusCreateComplete),
+		Changes: []*cloudformation.Change{
+			{
+				ResourceChange: &cloudformation.ResourceChange{
+					LogicalResourceId: aws.String("LaunchConfig"),
+					ResourceType:      aws.String("AWS::AutoScaling::LaunchConfiguration"),
+					Action:            aws.String(cloudformation.ChangeActionModify),
+					Replacement:       aws.String(cloudformation.ReplacementTrue),
+				},
+			},
+		},
+	}
+	tags := []*cloudformation.Tag{{Key: aws.String(nodePoolTagKey), Value: aws.String("pool-1")}}
+	err := adapter.applyStack("nodepool-pool-1", "{}", "", tags, true)
+	require.NoError(t, err)
+	require.True(t, stub.changeSetDeleted)
+	require.Len(t, adapter.plan.Stacks, 1)
+	require.Equal(t, &StackPlan{
+		Name:     "nodepool-pool-1",
+		NodePool: "pool-1",
+		Action:   StackActionUpdate,
+		Changes: []*StackResourceChange{
+			{
+				LogicalID:    "LaunchConfig",
+				ResourceType: "AWS::AutoScaling::LaunchConfiguration",
+				Action:       cloudformation.ChangeActionModify,
+				Replacement:  cloudformation.ReplacementTrue,
+			},
+		},
+	}, adapter.plan.Stacks[0])
+	require.True(t, adapter.plan.launchConfigurationChanged("pool-1"))
+
+	// no changes
+	stub.changeSet = &cloudformation.DescribeChangeSetOutput{
+		Status:       aws.String(cloudformation.ChangeSetStatusFailed),
+		StatusReason: aws.String("The submitted information didn't contain changes. Submit different information to create a change set."),
+	}
+	err = adapter.applyStack("cluster", "{}", "", nil, true)
+	require.NoError(t, err)
+	require.Equal(t, StackActionUnchanged, adapter.plan.Stacks[1].Action)
+
+	// failed change sets fail the plan
+	stub.changeSet = &cloudformation.DescribeChangeSetOutput{
+		Status:       aws.String(cloudformation.ChangeSetStatusFailed),
+		StatusReason: aws.String("Template format error"),
+	}
+	err = adapter.applyStack("cluster", "{}", "", nil, true)
+	require.Error(t, err)
+
+	// stacks which aren't updated are unchanged
+	err = adapter.applyStack("etcd-cluster-etcd", "{}", "", nil, false)
+	require.NoError(t, err)
+	require.Equal(t, StackActionUnchanged, adapter.plan.Stacks[2].Action)
+}
+
+func TestPlanNodeReplacements(t *testing.T) {
+	plan := &Plan{
+		Stacks: []*StackPlan{
+			{
+				Name:     "nodepool-pool-1",
+				NodePool: "pool-1",
+				Action:   StackActionUpdate,
+				Changes:  []*StackResourceChange{{ResourceType: "AWS::EC2::LaunchTemplate"}},
+			},
+			{Name: "nodepool-pool-3", NodePool: "pool-3", Action: StackActionCreate},
+		},
+	}
+	cluster := &api.Cluster{
+		NodePools: []*api.NodePool{{Name: "pool-1"}, {Name: "pool-2"}, {Name: "pool-3"}},
+	}
+	manager := &mockNodePoolManager{remaining: []*updatestrategy.Node{{Name: "node-1"}, {Name: "node-2"}}}
+
+	err := planNodeReplacements(plan, manager, cluster)
+	require.NoError(t, err)
+	require.Equal(t, []*NodeReplacementPlan{
+		{NodePool: "pool-1", Nodes: 2, Total: 2, Reason: "launch configuration changes"},
+	}, plan.NodeReplacements)
+
+	// outdated nodes are replaced even without stack changes
+	plan = &Plan{}
+	manager.remaining[1].Generation = 1
+	err = planNodeReplacements(plan, manager, cluster)
+	require.NoError(t, err)
+	require.Len(t, plan.NodeReplacements, 3)
+	require.Equal(t, &NodeReplacementPlan{NodePool: "pool-2", Nodes: 1, Total: 2, Reason: "outdated nodes"}, plan.NodeReplacements[1])
+}
+
+func TestPlanWrite(t *testing.T) {
+	plan := &Plan{
+		Cluster: "aws:123456789012:eu-central-1:kube-1",
+		Stacks: []*StackPlan{
+			{
+				Name:   "kube-1",
+				Action: StackActionUpdate,
+				Changes: []*StackResourceChange{
+					{LogicalID: "MasterRole", ResourceType: "AWS::IAM::Role", Action: "Modify", Replacement: "False"},
+				},
+			},
+			{Name: "nodepool-old-kube-1", Action: StackActionDelete},
+		},
+		NodeReplacements: []*NodeReplacementPlan{
+			{NodePool: "default-worker", Nodes: 3, Total: 3, Reason: "launch configuration changes"},
+		},
+		Manifests: []*ManifestPlan{
+			{File: "ingress/deployment.yaml", Resources: []string{"kube-system/Deployment/ingress"}, Diff: "-  replicas: 1\n+  replicas: 2\n"},
+		},
+		Deletions: []*DeletionPlan{
+			{Phase: "pre_apply", Kind: "deployment", Namespace: "kube-system", Name: "mate"},
+		},
+	}
+
+	var output bytes.Buffer
+	err := plan.Write(&output)
+	require.NoError(t, err)
+	require.Equal(t, `Plan for cluster aws:123456789012:eu-central-1:kube-1
+
+Stacks:
+  update kube-1
+    Modify MasterRole (AWS::IAM::Role), replacement: False
+  delete nodepool-old-kube-1
+
+Node replacements:
+  default-worker: 3/3 nodes (launch configuration changes)
+
+Manifests:
+  ingress/deployment.yaml: kube-system/Deployment/ingress
+    -  replicas: 1
+    +  replicas: 2
+
+Deletions:
+  pre_apply: kube-system/deployment/mate
+`, output.String())
+}
@@ -0,0 +1,44 @@
+package provisioner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const configKeyProvisionTimeout = "provision_timeout"
+
+// ProvisionTimeoutError is the error returned from Provision if provisioning
+// the cluster didn't finish within its provision_timeout.
+type ProvisionTimeoutError struct {
+	// Step is the provisioning step which was running when the timeout
+	// expired.
+	Step    string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *ProvisionTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s in step %s: %v", e.Timeout, e.Step, e.Err)
+}
+
+// Unwrap returns the error the step failed with.
+func (e *ProvisionTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// provisionTimeout returns the overall timeout for provisioning the cluster,
+// 0 if provisioning isn't limited.
+func provisionTimeout(cluster *api.Cluster) (time.Duration, error) {
+	value, ok := cluster.ConfigItems[configKeyProvisionTimeout]
+	if !ok {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid value for %s: %s", configKeyProvisionTimeout, value)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,41 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestProvisionTimeout(t *testing.T) {
+	timeout, err := provisionTimeout(&api.Cluster{})
+	require.NoError(t, err)
+	require.Zero(t, timeout)
+
+	timeout, err = provisionTimeout(&api.Cluster{ConfigItems: map[string]string{configKeyProvisionTimeout: "2h"}})
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Hour, timeout)
+
+	for _, invalid := range []string{"", "0", "-1h", "two hours"} {
+		_, err = provisionTimeout(&api.Cluster{ConfigItems: map[string]string{configKeyProvisionTimeout: invalid}})
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestProvisionTimeoutError(t *testing.T) {
+	err := fmt.Errorf("failed to update node pool: %w", &ProvisionTimeoutError{
+		Step:    "node-pool-update",
+		Timeout: 2 * time.Hour,
+		Err:     context.DeadlineExceeded,
+	})
+	require.EqualError(t, err, "failed to update node pool: timed out after 2h0m0s in step node-pool-update: context deadline exceeded")
+
+	var timeoutErr *ProvisionTimeoutError
+	require.True(t, errors.As(err, &timeoutErr))
+	require.Equal(t, "node-pool-update", timeoutErr.Step)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
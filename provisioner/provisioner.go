@@ -3,10 +3,17 @@ package provisioner
 import (
 	"context"
 	"errors"
+	"io"
+	"time"
 
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	awsUtils "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/httpclient"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubectl"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -23,6 +30,22 @@ type Options struct {
 	ApplyOnly      bool
 	UpdateStrategy config.UpdateStrategy
 	RemoveVolumes  bool
+	// SnapshotVolumes snapshots the EBS volumes before they're removed.
+	// The snapshots are tagged to be retained for
+	// VolumeSnapshotRetention.
+	SnapshotVolumes         bool
+	VolumeSnapshotRetention time.Duration
+	AuditStore              audit.Store
+	HTTPConfig              *httpclient.Config
+	RateLimiter             *awsUtils.RateLimiter
+	Kubectl                 *kubectl.Manager
+	Tracer                  *tracing.Tracer
+	// ValueOverrides override the values passed to the templates of all
+	// clusters.
+	ValueOverrides map[string]string
+	// CredentialPlugins are the paths of the credential plugins clusters
+	// can authenticate to their API servers with, by name.
+	CredentialPlugins map[string]string
 }
 
 // Provisioner is an interface describing how to provision or decommission
@@ -32,3 +55,58 @@ type Provisioner interface {
 	Provision(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error
 	Decommission(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error
 }
+
+// EtcdBackupProvisioner is implemented by provisioners which can verify and
+// restore the etcd backups of the clusters they provision.
+type EtcdBackupProvisioner interface {
+	VerifyEtcdBackup(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error
+	RestoreEtcd(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, snapshot string) (string, error)
+}
+
+// Planner is implemented by provisioners which can plan the changes
+// provisioning a cluster would make without changing anything.
+type Planner interface {
+	Plan(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*Plan, error)
+}
+
+// DecommissionPlanner is implemented by provisioners which can list the
+// resources decommissioning a cluster would touch without deleting anything.
+type DecommissionPlanner interface {
+	PlanDecommission(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*DecommissionPlan, error)
+}
+
+// InventoryExporter is implemented by provisioners which can list all the
+// resources they manage for a cluster, e.g. for audits and migrations.
+type InventoryExporter interface {
+	ExportInventory(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*Inventory, error)
+}
+
+// NodePoolInspector is implemented by provisioners which can show the live
+// state of the node pools of a cluster, e.g. the instances pending
+// replacement by a rolling update.
+type NodePoolInspector interface {
+	NodePoolInsights(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) ([]*NodePoolInsight, error)
+}
+
+// StepProvisioner is implemented by provisioners which can run single steps
+// of provisioning a cluster on their own, e.g. for one-off operations from
+// the command line.
+type StepProvisioner interface {
+	ApplyManifests(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error
+	UpdateNodePool(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, nodePool string) error
+	Render(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, options *RenderOptions) error
+	Values(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, offline bool) (*ClusterValues, error)
+}
+
+// RenderOptions configures how the templates of a cluster are rendered.
+type RenderOptions struct {
+	// Output receives the rendered manifests if Dir is not set.
+	Output io.Writer
+	// Dir is the directory all the rendered templates of the channel are
+	// written to: the manifests, the stacks and the node pools.
+	Dir string
+	// Offline renders without access to AWS and the cluster. Subnets and
+	// secrets are mocked, stacks rendered by senza are skipped and the
+	// cluster is assumed to serve no APIs.
+	Offline bool
+}
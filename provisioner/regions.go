@@ -0,0 +1,212 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	configKeySecondaryRegions = "secondary_regions"
+	regionalStackFile         = "cluster/regional-stack.yaml"
+	regionalStackNamePrefix   = "cluster-regional-"
+	regionTagKey              = "kubernetes.io/cluster-region"
+)
+
+// regionalStackParams is the data passed to the regional stack template.
+type regionalStackParams struct {
+	Cluster *api.Cluster
+	// Region is the secondary region the stack is created in.
+	Region string
+	// PrimaryRegion is the region of the cluster.
+	PrimaryRegion string
+}
+
+// secondaryRegions returns the secondary regions of the cluster configured by
+// the secondary_regions config item as a comma separated list. The cluster's
+// own region is never returned as a secondary region.
+func secondaryRegions(cluster *api.Cluster) []string {
+	var regions []string
+	seen := map[string]bool{cluster.Region: true}
+	for _, region := range strings.Split(cluster.ConfigItems[configKeySecondaryRegions], ",") {
+		region = strings.TrimSpace(region)
+		if region == "" || seen[region] {
+			continue
+		}
+		seen[region] = true
+		regions = append(regions, region)
+	}
+	return regions
+}
+
+// regionalStackName returns the name of the stack of the cluster in a
+// secondary region.
+func regionalStackName(cluster *api.Cluster) string {
+	return regionalStackNamePrefix + cluster.LocalID
+}
+
+// forRegion returns an awsAdapter operating on the region. The session is
+// derived from the adapter's session, so the same assumed role is used in
+// all regions. Adapters are cached for the lifetime of the adapter, which is
+// a single provisioning run.
+func (a *awsAdapter) forRegion(region string) (*awsAdapter, error) {
+	if region == a.region {
+		return a, nil
+	}
+
+	if adapter, ok := a.regionalAdapters[region]; ok {
+		return adapter, nil
+	}
+
+	sess := a.session.Copy(aws.NewConfig().WithRegion(region))
+	adapter, err := newAWSAdapter(a.logger.WithField("region", region), a.apiServer, region, sess, a.tokenSrc, a.dryRun)
+	if err != nil {
+		return nil, err
+	}
+	adapter.audit = a.audit
+	adapter.stackOptions = a.stackOptions
+	adapter.plan = a.plan
+
+	if a.regionalAdapters == nil {
+		a.regionalAdapters = make(map[string]*awsAdapter)
+	}
+	a.regionalAdapters[region] = adapter
+	return adapter, nil
+}
+
+// applyRegionalStacks creates or updates the regional stack in every
+// secondary region of the cluster. Channels without a regional stack template
+// are skipped.
+func (p *clusterpyProvisioner) applyRegionalStacks(ctx context.Context, adapter *awsAdapter, cluster *api.Cluster, channelPath string) error {
+	regions := secondaryRegions(cluster)
+	if len(regions) == 0 {
+		return nil
+	}
+
+	stackFile := path.Join(channelPath, regionalStackFile)
+	if _, err := os.Stat(stackFile); os.IsNotExist(err) {
+		adapter.logger.Warnf("Secondary regions configured but %s doesn't exist, skipping", regionalStackFile)
+		return nil
+	}
+
+	for _, region := range regions {
+		regionalAdapter, err := adapter.forRegion(region)
+		if err != nil {
+			return err
+		}
+
+		params := &regionalStackParams{
+			Cluster:       cluster,
+			Region:        region,
+			PrimaryRegion: cluster.Region,
+		}
+
+		template, err := renderTemplate(newTemplateContext(channelPath), stackFile, params)
+		if err != nil {
+			return fmt.Errorf("failed to render the regional stack for %s: %v", region, err)
+		}
+
+		tags := []*cloudformation.Tag{
+			{
+				Key:   aws.String(tagNameKubernetesClusterPrefix + cluster.ID),
+				Value: aws.String(resourceLifecycleOwned),
+			},
+			{
+				Key:   aws.String(regionTagKey),
+				Value: aws.String(cluster.Region),
+			},
+		}
+
+		stackName := regionalStackName(cluster)
+		err = regionalAdapter.applyStack(stackName, template, "", tags, true)
+		if err != nil {
+			return fmt.Errorf("failed to apply the regional stack in %s: %v", region, err)
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, regionalAdapter.stackApplyTimeout())
+		err = regionalAdapter.waitForStack(waitCtx, waitTime, stackName)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to apply the regional stack in %s: %v", region, err)
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// regionalStackRegions returns the regions other than the cluster's own in
+// which the regional stack of the cluster exists. The regions are discovered
+// from the stacks tagged with the cluster instead of secondary_regions, so
+// the stacks of regions removed from the config item are found as well.
+func (a *awsAdapter) regionalStackRegions(cluster *api.Cluster) ([]string, error) {
+	resp, err := a.ec2Client.DescribeRegions(&ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the regions: %v", err)
+	}
+
+	tags := map[string]string{
+		tagNameKubernetesClusterPrefix + cluster.ID: resourceLifecycleOwned,
+		regionTagKey: cluster.Region,
+	}
+
+	var regions []string
+	for _, r := range resp.Regions {
+		region := aws.StringValue(r.RegionName)
+		if region == cluster.Region {
+			continue
+		}
+
+		regionalAdapter, err := a.forRegion(region)
+		if err != nil {
+			return nil, err
+		}
+
+		stack, err := regionalAdapter.getStackByName(regionalStackName(cluster))
+		if err != nil {
+			if isDoesNotExistsErr(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get the regional stack in %s: %v", region, err)
+		}
+
+		if cloudformationHasTags(tags, stack.Tags) {
+			regions = append(regions, region)
+		}
+	}
+	sort.Strings(regions)
+	return regions, nil
+}
+
+// deleteRegionalStacks deletes the regional stack of the cluster in every
+// region it exists in.
+func (p *clusterpyProvisioner) deleteRegionalStacks(ctx context.Context, adapter *awsAdapter, cluster *api.Cluster) error {
+	regions, err := adapter.regionalStackRegions(cluster)
+	if err != nil {
+		return err
+	}
+
+	for _, region := range regions {
+		regionalAdapter, err := adapter.forRegion(region)
+		if err != nil {
+			return err
+		}
+
+		err = regionalAdapter.DeleteStack(ctx, regionalStackName(cluster))
+		if err != nil {
+			return fmt.Errorf("failed to delete the regional stack in %s: %v", region, err)
+		}
+	}
+	return nil
+}
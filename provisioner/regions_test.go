@@ -0,0 +1,73 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type ec2RegionsAPIStub struct {
+	ec2API
+	regions []string
+}
+
+func (e *ec2RegionsAPIStub) DescribeRegions(input *ec2.DescribeRegionsInput) (*ec2.DescribeRegionsOutput, error) {
+	output := &ec2.DescribeRegionsOutput{}
+	for _, region := range e.regions {
+		output.Regions = append(output.Regions, &ec2.Region{RegionName: aws.String(region)})
+	}
+	return output, nil
+}
+
+func TestSecondaryRegions(t *testing.T) {
+	cluster := &api.Cluster{
+		Region:      "eu-central-1",
+		ConfigItems: map[string]string{},
+	}
+	require.Empty(t, secondaryRegions(cluster))
+
+	cluster.ConfigItems[configKeySecondaryRegions] = "eu-west-1, eu-central-1,,us-east-1,eu-west-1"
+	require.Equal(t, []string{"eu-west-1", "us-east-1"}, secondaryRegions(cluster))
+}
+
+func TestRegionalStackRegions(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:      "aws:123456789012:eu-central-1:kube-1",
+		LocalID: "kube-1",
+		Region:  "eu-central-1",
+		// us-east-1 was removed after its regional stack was created
+		ConfigItems: map[string]string{configKeySecondaryRegions: "eu-west-1"},
+	}
+
+	regionalStack := func(clusterID string) *cloudFormationInventoryAPIStub {
+		return &cloudFormationInventoryAPIStub{stacks: []*cloudformation.Stack{
+			{
+				StackName: aws.String(regionalStackName(cluster)),
+				Tags: []*cloudformation.Tag{
+					{Key: aws.String(tagNameKubernetesClusterPrefix + clusterID), Value: aws.String(resourceLifecycleOwned)},
+					{Key: aws.String(regionTagKey), Value: aws.String(cluster.Region)},
+				},
+			},
+		}}
+	}
+
+	adapter := &awsAdapter{
+		region:    cluster.Region,
+		ec2Client: &ec2RegionsAPIStub{regions: []string{"us-east-1", "eu-central-1", "eu-west-1", "eu-north-1", "ap-south-1"}},
+		regionalAdapters: map[string]*awsAdapter{
+			"eu-west-1":  {cloudformationClient: regionalStack(cluster.ID)},
+			"us-east-1":  {cloudformationClient: regionalStack(cluster.ID)},
+			"eu-north-1": {cloudformationClient: &cloudFormationInventoryAPIStub{}},
+			// a stack with the same name belonging to another cluster
+			"ap-south-1": {cloudformationClient: regionalStack("aws:210987654321:eu-central-1:kube-1")},
+		},
+	}
+
+	regions, err := adapter.regionalStackRegions(cluster)
+	require.NoError(t, err)
+	require.Equal(t, []string{"eu-west-1", "us-east-1"}, regions)
+}
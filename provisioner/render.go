@@ -0,0 +1,316 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/mitchellh/copystructure"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	renderManifestsDir = "manifests"
+	renderStacksDir    = "stacks"
+	renderNodePoolsDir = "node-pools"
+	// offlineZones are the availability zones of the mocked subnets.
+	offlineZones = "abc"
+)
+
+// Render renders the templates of the cluster without changing anything. The
+// configuration defaults of the channel are merged into the config items
+// before rendering. Without a directory in the options only the manifests
+// are written to the output, each preceded by a comment naming its source
+// file.
+func (p *clusterpyProvisioner) Render(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, options *RenderOptions) error {
+	logger = logging.WithModule(logger, "provisioner")
+
+	adapter, _, _, err := p.prepareProvision(logger, cluster, channelConfig, nil)
+	if err != nil {
+		return err
+	}
+
+	// in plan mode the user data of the node pools isn't uploaded.
+	adapter.plan = &Plan{Cluster: cluster.ID}
+
+	manifestsDir := path.Join(channelConfig.Path, manifestsPath)
+	var manifests []*renderedManifest
+	if options.Offline {
+		var values *ClusterValues
+		values, err = p.offlineClusterValues(cluster, channelConfig.Path)
+		if err != nil {
+			return err
+		}
+		manifests, err = p.renderManifests(logger, cluster, manifestsDir, offlineSecretsSource(cluster), offlineCapabilities(cluster), values)
+	} else {
+		_, manifests, err = p.prepareManifests(logger, adapter, cluster, manifestsDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	if options.Dir == "" {
+		for _, manifest := range manifests {
+			_, err = fmt.Fprintf(options.Output, "---\n# Source: %s\n%s\n", strings.TrimPrefix(manifest.File, manifestsDir+"/"), strings.TrimSpace(manifest.Content))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	write := func(file string, content string) error {
+		file = filepath.Join(options.Dir, file)
+		err := os.MkdirAll(filepath.Dir(file), 0700)
+		if err != nil {
+			return err
+		}
+		// rendered templates may contain secrets.
+		return ioutil.WriteFile(file, []byte(content), 0600)
+	}
+
+	for _, manifest := range manifests {
+		err = write(path.Join(renderManifestsDir, strings.TrimPrefix(manifest.File, manifestsDir+"/")), manifest.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.renderStacks(logger, adapter, cluster, channelConfig, options.Offline, write)
+	if err != nil {
+		return err
+	}
+
+	var values *ClusterValues
+	if options.Offline {
+		values, err = p.offlineClusterValues(cluster, channelConfig.Path)
+	} else {
+		values, err = p.clusterValues(adapter, cluster, channelConfig.Path)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the hibernation schedule depends on the workloads of the cluster,
+	// only the hibernate config item is reflected in the rendered
+	// templates.
+	nodePoolProvisioner := newNodePoolProvisioner(logger, adapter, nil, nodePoolCluster(cluster, hibernated(cluster)), channelConfig, p.httpConfig)
+	err = nodePoolProvisioner.render(values.Values, options.Offline, func(file, content string) error {
+		return write(path.Join(renderNodePoolsDir, file), content)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Rendered the templates of cluster %s to %s", cluster.ID, options.Dir)
+	return nil
+}
+
+// renderStacks renders the cluster, etcd and regional stacks. The cluster and
+// etcd stacks are rendered by senza which needs access to AWS, so they're
+// skipped when rendering offline.
+func (p *clusterpyProvisioner) renderStacks(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, channelConfig *channel.Config, offline bool, write func(file, content string) error) error {
+	if offline {
+		logger.Infof("Rendering offline, skipping the stacks rendered by senza")
+	} else {
+		template, err := adapter.clusterStackTemplate(cluster.LocalID, path.Join(channelConfig.Path, "cluster", "senza-definition.yaml"), cluster)
+		if err != nil {
+			return err
+		}
+
+		err = write(path.Join(renderStacksDir, cluster.LocalID+".yaml"), string(template))
+		if err != nil {
+			return err
+		}
+
+		if !isMinimalProfile(cluster) {
+			template, err = adapter.etcdStackTemplate(etcdStackVersion(cluster), path.Join(channelConfig.Path, etcdStackDefinitionFile), cluster)
+			if err != nil {
+				return err
+			}
+
+			err = write(path.Join(renderStacksDir, etcdStackNamePrefix+etcdStackVersion(cluster)+".yaml"), string(template))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	stackFile := path.Join(channelConfig.Path, regionalStackFile)
+	if _, err := os.Stat(stackFile); os.IsNotExist(err) {
+		return nil
+	}
+
+	for _, region := range secondaryRegions(cluster) {
+		params := &regionalStackParams{
+			Cluster:       cluster,
+			Region:        region,
+			PrimaryRegion: cluster.Region,
+		}
+
+		template, err := renderTemplate(newTemplateContext(channelConfig.Path), stackFile, params)
+		if err != nil {
+			return fmt.Errorf("failed to render the regional stack for %s: %v", region, err)
+		}
+
+		err = write(path.Join(renderStacksDir, regionalStackName(cluster)+"-"+region+".yaml"), template)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// render renders the stack templates and the user data of all node pools,
+// one directory per stack. The images of the node pools are only resolved
+// when rendering online.
+func (p *AWSNodePoolProvisioner) render(values map[string]interface{}, offline bool, write func(file, content string) error) error {
+	for _, nodePool := range getNonLegacyNodePools(p.Cluster) {
+		poolValuesCopy, err := copystructure.Copy(values)
+		if err != nil {
+			return err
+		}
+
+		poolValues, ok := poolValuesCopy.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("unable to copy values for node pool %s", nodePool.Name)
+		}
+
+		stacks, err := p.nodePoolStacks(nodePool, poolValues)
+		if err != nil {
+			return fmt.Errorf("failed to render node pool %s: %v", nodePool.Name, err)
+		}
+
+		for _, stack := range stacks {
+			if offline {
+				if image, ok := nodePool.ConfigItems[nodePoolConfigKeyImage]; ok {
+					stack.values[imageValueKey] = image
+				}
+			} else {
+				_, err = p.resolveNodePoolImage(stack.nodePool, stack.name, stack.values)
+				if err != nil {
+					return err
+				}
+			}
+
+			template, _, err := p.generateNodePoolStackTemplate(stack.nodePool, stack.values)
+			if err != nil {
+				return fmt.Errorf("failed to render node pool %s: %v", nodePool.Name, err)
+			}
+
+			profilePath := path.Join(p.cfgBaseDir, nodePool.Profile)
+			userData, err := renderUserData(profilePath, &userDataParams{
+				Cluster:  p.Cluster,
+				NodePool: stack.nodePool,
+				Values:   stack.values,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to render node pool %s: %v", nodePool.Name, err)
+			}
+
+			dir := nodePool.Name
+			if stack.zone != "" {
+				dir = nodePool.Name + "-" + stack.zone
+			}
+
+			err = write(path.Join(dir, stackFileName), template)
+			if err != nil {
+				return err
+			}
+
+			err = write(path.Join(dir, userData.fileName()), userData.source)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// offlineSubnets returns mocked subnets of the cluster, the subnets
+// configured with the subnets config item or one subnet per availability
+// zone otherwise.
+func offlineSubnets(cluster *api.Cluster) []*ec2.Subnet {
+	var ids []string
+	if value, ok := cluster.ConfigItems[subnetsConfigItemKey]; ok {
+		ids = strings.Split(value, ",")
+	} else {
+		for _, zone := range offlineZones {
+			ids = append(ids, fmt.Sprintf("subnet-%s%c", cluster.Region, zone))
+		}
+	}
+
+	subnets := make([]*ec2.Subnet, 0, len(ids))
+	for i, id := range ids {
+		subnets = append(subnets, &ec2.Subnet{
+			SubnetId:         aws.String(id),
+			AvailabilityZone: aws.String(fmt.Sprintf("%s%c", cluster.Region, offlineZones[i%len(offlineZones)])),
+		})
+	}
+	return subnets
+}
+
+// offlineSecrets mocks the SSM and Secrets Manager APIs. Secrets are
+// rendered as a placeholder naming the secret.
+type offlineSecrets struct{}
+
+func (offlineSecrets) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	return &ssm.GetParameterOutput{
+		Parameter: &ssm.Parameter{
+			Name:  input.Name,
+			Value: aws.String("<ssm:" + aws.StringValue(input.Name) + ">"),
+		},
+	}, nil
+}
+
+func (offlineSecrets) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	return &secretsmanager.GetSecretValueOutput{
+		Name:         input.SecretId,
+		SecretString: aws.String("<secretsmanager:" + aws.StringValue(input.SecretId) + ">"),
+	}, nil
+}
+
+// offlineSecretsSource returns a secretsSource returning placeholders for all
+// secrets, including the ones of the secondary regions.
+func offlineSecretsSource(cluster *api.Cluster) *secretsSource {
+	newSource := func() *secretsSource {
+		return &secretsSource{
+			ssmClient:            offlineSecrets{},
+			secretsManagerClient: offlineSecrets{},
+			cache:                make(map[string]string),
+		}
+	}
+
+	secrets := newSource()
+	for _, region := range secondaryRegions(cluster) {
+		secrets.addRegion(region, newSource())
+	}
+	return secrets
+}
+
+// offlineCapabilities returns clusterCapabilities of a cluster serving no
+// APIs. The server version is taken from the kubernetes_version config item.
+func offlineCapabilities(cluster *api.Cluster) *clusterCapabilities {
+	version := cluster.ConfigItems[configKeyKubernetesVersion]
+	if version != "" && !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+
+	return &clusterCapabilities{
+		discovered: true,
+		version:    version,
+		resources:  make(map[string][]metav1.APIResource),
+	}
+}
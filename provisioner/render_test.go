@@ -0,0 +1,78 @@
+package provisioner
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestOfflineSubnets(t *testing.T) {
+	cluster := &api.Cluster{
+		Region:      "eu-central-1",
+		ConfigItems: map[string]string{},
+	}
+
+	subnets := offlineSubnets(cluster)
+	require.Len(t, subnets, 3)
+	require.Equal(t, "subnet-eu-central-1a", aws.StringValue(subnets[0].SubnetId))
+	require.Equal(t, "eu-central-1c", aws.StringValue(subnets[2].AvailabilityZone))
+
+	values, err := nodePoolValuesForSubnets(cluster, subnets)
+	require.NoError(t, err)
+	allSubnets := strings.Split(values["subnets"].(map[string]string)[subnetAllAZName], ",")
+	sort.Strings(allSubnets)
+	require.Equal(t, []string{"subnet-eu-central-1a", "subnet-eu-central-1b", "subnet-eu-central-1c"}, allSubnets)
+
+	cluster.ConfigItems[subnetsConfigItemKey] = "subnet-1,subnet-2"
+	subnets = offlineSubnets(cluster)
+	require.Len(t, subnets, 2)
+	require.Equal(t, "subnet-2", aws.StringValue(subnets[1].SubnetId))
+	require.Equal(t, "eu-central-1b", aws.StringValue(subnets[1].AvailabilityZone))
+
+	_, err = nodePoolValuesForSubnets(cluster, subnets)
+	require.NoError(t, err)
+}
+
+func TestOfflineSecretsSource(t *testing.T) {
+	cluster := &api.Cluster{
+		Region: "eu-central-1",
+		ConfigItems: map[string]string{
+			configKeySecondaryRegions: "eu-west-1",
+		},
+	}
+
+	secrets := offlineSecretsSource(cluster)
+
+	value, err := secrets.ssmParameter("/kube-1/token")
+	require.NoError(t, err)
+	require.Equal(t, "<ssm:/kube-1/token>", value)
+
+	value, err = secrets.secretsManagerSecret("kube-1/token")
+	require.NoError(t, err)
+	require.Equal(t, "<secretsmanager:kube-1/token>", value)
+
+	value, err = secrets.ssmParameterInRegion("eu-west-1", "/kube-1/token")
+	require.NoError(t, err)
+	require.Equal(t, "<ssm:/kube-1/token>", value)
+
+	_, err = secrets.ssmParameterInRegion("us-east-1", "/kube-1/token")
+	require.Error(t, err)
+}
+
+func TestOfflineCapabilities(t *testing.T) {
+	capabilities := offlineCapabilities(&api.Cluster{
+		ConfigItems: map[string]string{configKeyKubernetesVersion: "1.14.8"},
+	})
+
+	version, err := capabilities.serverVersion()
+	require.NoError(t, err)
+	require.Equal(t, "v1.14.8", version)
+
+	ok, err := capabilities.hasAPIVersion("autoscaling.k8s.io/v1beta2")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,248 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// configKeyWaitForRolloutPrefix is the prefix of the config items
+	// enabling to wait for the rollout of the workloads of a component,
+	// e.g. wait_for_rollout_external_dns.
+	configKeyWaitForRolloutPrefix = "wait_for_rollout_"
+	configKeyRolloutTimeout       = "rollout_timeout"
+	defaultRolloutTimeout         = 10 * time.Minute
+
+	kindDeployment  = "Deployment"
+	kindDaemonSet   = "DaemonSet"
+	kindStatefulSet = "StatefulSet"
+)
+
+// rolloutPollInterval is the interval between checks of the rollout status
+// of workloads. It's defined as a variable so it can be changed in tests.
+var rolloutPollInterval = 5 * time.Second
+
+// workload is a Deployment, DaemonSet or StatefulSet applied by a manifest.
+type workload struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+}
+
+func (w *workload) String() string {
+	return fmt.Sprintf("%s %s/%s", strings.ToLower(w.Kind), w.Namespace, w.Name)
+}
+
+// waitForRollout returns true if the CLM waits for the rollout of the
+// workloads of the component after applying it, enabled with the
+// wait_for_rollout_<name> config item like disabling components.
+func waitForRollout(cluster *api.Cluster, component string) bool {
+	key := configKeyWaitForRolloutPrefix + strings.Replace(component, "-", "_", -1)
+	return cluster.ConfigItems[key] == "true"
+}
+
+// rolloutTimeout returns how long to wait for the rollout of the workloads of
+// a component.
+func rolloutTimeout(cluster *api.Cluster) (time.Duration, error) {
+	value, ok := cluster.ConfigItems[configKeyRolloutTimeout]
+	if !ok {
+		return defaultRolloutTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid value for %s: %s", configKeyRolloutTimeout, value)
+	}
+	return timeout, nil
+}
+
+// manifestWorkloads returns the workloads defined by the manifests. Workloads
+// without a namespace are in the default namespace.
+func manifestWorkloads(manifests []*renderedManifest) []*workload {
+	var workloads []*workload
+	for _, manifest := range manifests {
+		for _, document := range yamlDocumentSeparator.Split(manifest.Content, -1) {
+			var object manifestObject
+			err := yaml.Unmarshal([]byte(document), &object)
+			if err != nil {
+				continue
+			}
+
+			switch object.Kind {
+			case kindDeployment, kindDaemonSet, kindStatefulSet:
+			default:
+				continue
+			}
+
+			namespace := object.Metadata.Namespace
+			if namespace == "" {
+				namespace = defaultNamespace
+			}
+			workloads = append(workloads, &workload{
+				APIVersion: object.APIVersion,
+				Kind:       object.Kind,
+				Namespace:  namespace,
+				Name:       object.Metadata.Name,
+			})
+		}
+	}
+	return workloads
+}
+
+// nestedInt returns the integer at the path of fields in the object and
+// false if there's none.
+func nestedInt(object map[string]interface{}, fields ...string) (int64, bool) {
+	var value interface{} = object
+	for _, field := range fields {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		value, ok = m[field]
+		if !ok {
+			return 0, false
+		}
+	}
+
+	switch value := value.(type) {
+	case int64:
+		return value, true
+	case int:
+		return int64(value), true
+	case float64:
+		return int64(value), true
+	default:
+		return 0, false
+	}
+}
+
+// rolledOut returns true if the current generation of the workload has been
+// rolled out to all its replicas, like kubectl rollout status.
+func rolledOut(object *unstructured.Unstructured) bool {
+	generation, _ := nestedInt(object.Object, "metadata", "generation")
+	observedGeneration, _ := nestedInt(object.Object, "status", "observedGeneration")
+	if observedGeneration < generation {
+		return false
+	}
+
+	switch object.GetKind() {
+	case kindDaemonSet:
+		desired, _ := nestedInt(object.Object, "status", "desiredNumberScheduled")
+		updated, _ := nestedInt(object.Object, "status", "updatedNumberScheduled")
+		available, _ := nestedInt(object.Object, "status", "numberAvailable")
+		return updated == desired && available == desired
+	case kindStatefulSet:
+		replicas, ok := nestedInt(object.Object, "spec", "replicas")
+		if !ok {
+			replicas = 1
+		}
+		updated, _ := nestedInt(object.Object, "status", "updatedReplicas")
+		ready, _ := nestedInt(object.Object, "status", "readyReplicas")
+		return updated == replicas && ready == replicas
+	default:
+		replicas, ok := nestedInt(object.Object, "spec", "replicas")
+		if !ok {
+			replicas = 1
+		}
+		updated, _ := nestedInt(object.Object, "status", "updatedReplicas")
+		available, _ := nestedInt(object.Object, "status", "availableReplicas")
+		return updated == replicas && available == replicas
+	}
+}
+
+// waitForWorkloads waits until all the workloads are rolled out, the timeout
+// expires or the context is cancelled.
+func waitForWorkloads(ctx context.Context, deleter *resourceDeleter, workloads []*workload, timeout, pollInterval time.Duration) error {
+	deadline := time.After(timeout)
+	for _, workload := range workloads {
+		for {
+			ready, err := workloadRolledOut(deleter, workload)
+			if err == nil && ready {
+				break
+			}
+
+			select {
+			case <-time.After(pollInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-deadline:
+				if err != nil {
+					return fmt.Errorf("timed out after %s waiting for the rollout of %s: %v", timeout, workload, err)
+				}
+				return fmt.Errorf("timed out after %s waiting for the rollout of %s", timeout, workload)
+			}
+		}
+	}
+	return nil
+}
+
+func workloadRolledOut(deleter *resourceDeleter, workload *workload) (bool, error) {
+	resource, err := deleter.findResource(workload.Kind, workload.APIVersion)
+	if err != nil {
+		return false, err
+	}
+	if resource == nil {
+		return false, fmt.Errorf("the server doesn't serve %s", workload.APIVersion)
+	}
+
+	client, err := deleter.client(resource, workload.Namespace)
+	if err != nil {
+		return false, err
+	}
+
+	object, err := client.Get(workload.Name)
+	if err != nil {
+		return false, err
+	}
+	return rolledOut(object), nil
+}
+
+// waitForRollouts waits for the rollout of the workloads of the component if
+// it's enabled for the cluster. Nothing is waited for in dry-run mode.
+func (p *clusterpyProvisioner) waitForRollouts(ctx context.Context, logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, tokenSource oauth2.TokenSource, component string, manifests []*renderedManifest) error {
+	if !waitForRollout(cluster, component) {
+		return nil
+	}
+
+	workloads := manifestWorkloads(manifests)
+	if len(workloads) == 0 {
+		return nil
+	}
+
+	if adapter.dryRun {
+		logger.Infof("Dry-run: would wait for the rollout of the workloads of component %s (%d)", component, len(workloads))
+		return nil
+	}
+
+	timeout, err := rolloutTimeout(cluster)
+	if err != nil {
+		return err
+	}
+
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return err
+	}
+
+	deleter, err := newResourceDeleter(kubernetes.NewConfigWithTokenSource(cluster.APIServerURL, tokenSource, transport))
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Waiting for the rollout of the workloads of component %s (%d)", component, len(workloads))
+	err = waitForWorkloads(ctx, deleter, workloads, timeout, rolloutPollInterval)
+	if err != nil {
+		return fmt.Errorf("component %s didn't roll out: %v", component, err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestWaitForRollout(t *testing.T) {
+	cluster := &api.Cluster{ConfigItems: map[string]string{
+		"wait_for_rollout_external_dns": "true",
+		"wait_for_rollout_ingress":      "false",
+	}}
+	require.True(t, waitForRollout(cluster, "external-dns"))
+	require.False(t, waitForRollout(cluster, "ingress"))
+	require.False(t, waitForRollout(cluster, "kube2iam"))
+
+	timeout, err := rolloutTimeout(cluster)
+	require.NoError(t, err)
+	require.Equal(t, defaultRolloutTimeout, timeout)
+
+	cluster.ConfigItems[configKeyRolloutTimeout] = "5m"
+	timeout, err = rolloutTimeout(cluster)
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Minute, timeout)
+
+	cluster.ConfigItems[configKeyRolloutTimeout] = "0s"
+	_, err = rolloutTimeout(cluster)
+	require.Error(t, err)
+}
+
+func TestManifestWorkloads(t *testing.T) {
+	workloads := manifestWorkloads([]*renderedManifest{
+		{
+			File:      "external-dns/deployment.yaml",
+			Component: "external-dns",
+			Content: `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: external-dns
+  namespace: kube-system
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: external-dns
+  namespace: kube-system
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: node-agent
+`,
+		},
+	})
+	require.Equal(t, []*workload{
+		{APIVersion: "apps/v1", Kind: kindDeployment, Namespace: "kube-system", Name: "external-dns"},
+		{APIVersion: "apps/v1", Kind: kindDaemonSet, Namespace: defaultNamespace, Name: "node-agent"},
+	}, workloads)
+	require.Equal(t, "deployment kube-system/external-dns", workloads[0].String())
+}
+
+func TestRolledOut(t *testing.T) {
+	for _, tc := range []struct {
+		msg    string
+		object map[string]interface{}
+		ready  bool
+	}{
+		{
+			msg: "deployment rolled out",
+			object: map[string]interface{}{
+				"kind":     kindDeployment,
+				"metadata": map[string]interface{}{"generation": int64(3)},
+				"spec":     map[string]interface{}{"replicas": int64(2)},
+				"status": map[string]interface{}{
+					"observedGeneration": int64(3),
+					"updatedReplicas":    int64(2),
+					"availableReplicas":  int64(2),
+				},
+			},
+			ready: true,
+		},
+		{
+			msg: "deployment generation not observed",
+			object: map[string]interface{}{
+				"kind":     kindDeployment,
+				"metadata": map[string]interface{}{"generation": int64(4)},
+				"status": map[string]interface{}{
+					"observedGeneration": int64(3),
+					"updatedReplicas":    int64(1),
+					"availableReplicas":  int64(1),
+				},
+			},
+		},
+		{
+			msg: "daemon set rolling",
+			object: map[string]interface{}{
+				"kind": kindDaemonSet,
+				"status": map[string]interface{}{
+					"desiredNumberScheduled": int64(5),
+					"updatedNumberScheduled": int64(3),
+					"numberAvailable":        int64(5),
+				},
+			},
+		},
+		{
+			msg: "stateful set rolled out",
+			object: map[string]interface{}{
+				"kind": kindStatefulSet,
+				"spec": map[string]interface{}{"replicas": float64(3)},
+				"status": map[string]interface{}{
+					"updatedReplicas": float64(3),
+					"readyReplicas":   float64(3),
+				},
+			},
+			ready: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			require.Equal(t, tc.ready, rolledOut(&unstructured.Unstructured{Object: tc.object}))
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+var errSecretsNotAvailable = errors.New("secret lookups are not available in this context")
+
+// ssmAPI is a minimal interface containing only the methods we use from the
+// SSM API.
+type ssmAPI interface {
+	GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error)
+}
+
+// secretsManagerAPI is a minimal interface containing only the methods we use
+// from the Secrets Manager API.
+type secretsManagerAPI interface {
+	GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// secretsSource looks up secrets from SSM Parameter Store and Secrets Manager
+// in the cluster's AWS account. Secrets are cached for the lifetime of the
+// secretsSource, which is a single provisioning run.
+type secretsSource struct {
+	ssmClient            ssmAPI
+	secretsManagerClient secretsManagerAPI
+	cache                map[string]string
+	mutex                sync.Mutex
+	// regions contains the sources of the cluster's secondary regions.
+	regions map[string]*secretsSource
+}
+
+// newSecretsSource initializes a new secretsSource. The session should be
+// scoped to the cluster's account via the assumed role such that only the
+// secrets of that account are accessible.
+func newSecretsSource(sess *session.Session) *secretsSource {
+	return &secretsSource{
+		ssmClient:            ssm.New(sess),
+		secretsManagerClient: secretsmanager.New(sess),
+		cache:                make(map[string]string),
+	}
+}
+
+// addRegion makes the secrets of a secondary region available via the
+// regional lookup functions.
+func (s *secretsSource) addRegion(region string, source *secretsSource) {
+	if s.regions == nil {
+		s.regions = make(map[string]*secretsSource)
+	}
+	s.regions[region] = source
+}
+
+// inRegion returns the source of the secondary region. Only the regions
+// configured for the cluster can be used.
+func (s *secretsSource) inRegion(region string) (*secretsSource, error) {
+	if s == nil {
+		return nil, errSecretsNotAvailable
+	}
+
+	source, ok := s.regions[region]
+	if !ok {
+		return nil, fmt.Errorf("region %s is not a secondary region of the cluster", region)
+	}
+	return source, nil
+}
+
+// cached returns the cached value for key or calls lookup to get it.
+func (s *secretsSource) cached(key string, lookup func() (string, error)) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if value, ok := s.cache[key]; ok {
+		return value, nil
+	}
+
+	value, err := lookup()
+	if err != nil {
+		return "", err
+	}
+
+	s.cache[key] = value
+	return value, nil
+}
+
+// ssmParameter is a template function which returns the decrypted value of
+// the SSM parameter.
+func (s *secretsSource) ssmParameter(name string) (string, error) {
+	if s == nil {
+		return "", errSecretsNotAvailable
+	}
+
+	return s.cached("ssm:"+name, func() (string, error) {
+		resp, err := s.ssmClient.GetParameter(&ssm.GetParameterInput{
+			Name:           aws.String(name),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to get SSM parameter %s: %v", name, err)
+		}
+
+		return aws.StringValue(resp.Parameter.Value), nil
+	})
+}
+
+// secretsManagerSecret is a template function which returns the current
+// value of the Secrets Manager secret.
+func (s *secretsSource) secretsManagerSecret(id string) (string, error) {
+	if s == nil {
+		return "", errSecretsNotAvailable
+	}
+
+	return s.cached("secretsmanager:"+id, func() (string, error) {
+		resp, err := s.secretsManagerClient.GetSecretValue(&secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(id),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to get secret %s: %v", id, err)
+		}
+
+		if resp.SecretString == nil {
+			return "", fmt.Errorf("secret %s has no string value", id)
+		}
+
+		return aws.StringValue(resp.SecretString), nil
+	})
+}
+
+// ssmParameterInRegion is a template function which returns the decrypted
+// value of the SSM parameter in a secondary region.
+func (s *secretsSource) ssmParameterInRegion(region, name string) (string, error) {
+	source, err := s.inRegion(region)
+	if err != nil {
+		return "", err
+	}
+	return source.ssmParameter(name)
+}
+
+// secretsManagerSecretInRegion is a template function which returns the
+// current value of the Secrets Manager secret in a secondary region.
+func (s *secretsSource) secretsManagerSecretInRegion(region, id string) (string, error) {
+	source, err := s.inRegion(region)
+	if err != nil {
+		return "", err
+	}
+	return source.secretsManagerSecret(id)
+}
@@ -0,0 +1,95 @@
+package provisioner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/stretchr/testify/require"
+)
+
+type ssmAPIStub struct {
+	calls int
+}
+
+func (s *ssmAPIStub) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	s.calls++
+	if aws.StringValue(input.Name) == "missing" {
+		return nil, errors.New("parameter not found")
+	}
+	return &ssm.GetParameterOutput{
+		Parameter: &ssm.Parameter{Value: aws.String("ssm-" + aws.StringValue(input.Name))},
+	}, nil
+}
+
+type secretsManagerAPIStub struct{}
+
+func (s *secretsManagerAPIStub) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	return &secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String("secret-" + aws.StringValue(input.SecretId)),
+	}, nil
+}
+
+func TestSecretsSource(t *testing.T) {
+	ssmStub := &ssmAPIStub{}
+	secrets := &secretsSource{
+		ssmClient:            ssmStub,
+		secretsManagerClient: &secretsManagerAPIStub{},
+		cache:                make(map[string]string),
+	}
+
+	value, err := secrets.ssmParameter("foo")
+	require.NoError(t, err)
+	require.Equal(t, "ssm-foo", value)
+
+	// second lookup is served from the cache
+	value, err = secrets.ssmParameter("foo")
+	require.NoError(t, err)
+	require.Equal(t, "ssm-foo", value)
+	require.Equal(t, 1, ssmStub.calls)
+
+	_, err = secrets.ssmParameter("missing")
+	require.Error(t, err)
+
+	value, err = secrets.secretsManagerSecret("foo")
+	require.NoError(t, err)
+	require.Equal(t, "secret-foo", value)
+}
+
+func TestSecretsNotAvailable(t *testing.T) {
+	_, err := renderSingle(t, `{{ ssmParameter "foo" }}`, nil)
+	require.Error(t, err)
+
+	_, err = renderSingle(t, `{{ secretsManagerSecret "foo" }}`, nil)
+	require.Error(t, err)
+}
+
+func TestSecretsSourceInRegion(t *testing.T) {
+	newSource := func() *secretsSource {
+		return &secretsSource{
+			ssmClient:            &ssmAPIStub{},
+			secretsManagerClient: &secretsManagerAPIStub{},
+			cache:                make(map[string]string),
+		}
+	}
+
+	secrets := newSource()
+	secrets.addRegion("eu-west-1", newSource())
+
+	value, err := secrets.ssmParameterInRegion("eu-west-1", "foo")
+	require.NoError(t, err)
+	require.Equal(t, "ssm-foo", value)
+
+	value, err = secrets.secretsManagerSecretInRegion("eu-west-1", "foo")
+	require.NoError(t, err)
+	require.Equal(t, "secret-foo", value)
+
+	_, err = secrets.ssmParameterInRegion("us-east-1", "foo")
+	require.Error(t, err)
+
+	var unavailable *secretsSource
+	_, err = unavailable.ssmParameterInRegion("eu-west-1", "foo")
+	require.Error(t, err)
+}
@@ -0,0 +1,313 @@
+package provisioner
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	securityGroupRulesFile = "cluster/security-group-rules.yaml"
+	securityGroupProtoAll  = "-1"
+)
+
+// securityGroupRules are the ingress rules the CLM reconciles for a security
+// group created by the cluster stack or the stacks of a node pool.
+type securityGroupRules struct {
+	// ControlPlane selects the security group of the cluster stack,
+	// NodePool the ones of the stacks of the node pool.
+	ControlPlane bool   `yaml:"control_plane"`
+	NodePool     string `yaml:"node_pool"`
+	// LogicalID is the logical ID of the security group in the stacks.
+	LogicalID string `yaml:"logical_id"`
+	// Prune removes the ingress rules of the security group which aren't
+	// declared.
+	Prune   bool                 `yaml:"prune"`
+	Ingress []*securityGroupRule `yaml:"ingress"`
+}
+
+func (r *securityGroupRules) String() string {
+	if r.ControlPlane {
+		return fmt.Sprintf("security group %s of the control plane", r.LogicalID)
+	}
+	return fmt.Sprintf("security group %s of node pool %s", r.LogicalID, r.NodePool)
+}
+
+// securityGroupRule allows the traffic of a protocol and port range from a
+// CIDR block or a security group.
+type securityGroupRule struct {
+	// Protocol is tcp, udp, icmp or all.
+	Protocol    string `yaml:"protocol"`
+	FromPort    int64  `yaml:"from_port"`
+	ToPort      int64  `yaml:"to_port"`
+	CIDR        string `yaml:"cidr"`
+	SourceGroup string `yaml:"source_group"`
+	Description string `yaml:"description"`
+}
+
+// key identifies the rule, ignoring its description.
+func (r *securityGroupRule) key() string {
+	source := r.CIDR
+	if r.SourceGroup != "" {
+		source = r.SourceGroup
+	}
+
+	if r.Protocol == securityGroupProtoAll {
+		return fmt.Sprintf("all from %s", source)
+	}
+	return fmt.Sprintf("%s %d-%d from %s", r.Protocol, r.FromPort, r.ToPort, source)
+}
+
+func (r *securityGroupRule) validate() error {
+	switch r.Protocol {
+	case "tcp", "udp", "icmp", securityGroupProtoAll:
+	default:
+		return fmt.Errorf("unknown protocol: %s", r.Protocol)
+	}
+
+	if (r.CIDR == "") == (r.SourceGroup == "") {
+		return fmt.Errorf("rules require either a cidr or a source_group")
+	}
+	if r.Protocol != securityGroupProtoAll && r.FromPort > r.ToPort {
+		return fmt.Errorf("invalid port range: %d-%d", r.FromPort, r.ToPort)
+	}
+	return nil
+}
+
+// ipPermission returns the rule as the ingress permission of the EC2 API.
+func (r *securityGroupRule) ipPermission() *ec2.IpPermission {
+	permission := &ec2.IpPermission{IpProtocol: aws.String(r.Protocol)}
+	if r.Protocol != securityGroupProtoAll {
+		permission.FromPort = aws.Int64(r.FromPort)
+		permission.ToPort = aws.Int64(r.ToPort)
+	}
+
+	if r.SourceGroup != "" {
+		permission.UserIdGroupPairs = []*ec2.UserIdGroupPair{{GroupId: aws.String(r.SourceGroup), Description: descriptionValue(r.Description)}}
+	} else {
+		permission.IpRanges = []*ec2.IpRange{{CidrIp: aws.String(r.CIDR), Description: descriptionValue(r.Description)}}
+	}
+	return permission
+}
+
+func descriptionValue(description string) *string {
+	if description == "" {
+		return nil
+	}
+	return aws.String(description)
+}
+
+// permissionRules splits the ingress permissions of a security group into
+// one rule per source. IPv6 ranges and prefix lists aren't managed.
+func permissionRules(permissions []*ec2.IpPermission) []*securityGroupRule {
+	var rules []*securityGroupRule
+	for _, permission := range permissions {
+		rule := securityGroupRule{
+			Protocol: aws.StringValue(permission.IpProtocol),
+			FromPort: aws.Int64Value(permission.FromPort),
+			ToPort:   aws.Int64Value(permission.ToPort),
+		}
+
+		for _, ipRange := range permission.IpRanges {
+			cidrRule := rule
+			cidrRule.CIDR = aws.StringValue(ipRange.CidrIp)
+			cidrRule.Description = aws.StringValue(ipRange.Description)
+			rules = append(rules, &cidrRule)
+		}
+		for _, pair := range permission.UserIdGroupPairs {
+			groupRule := rule
+			groupRule.SourceGroup = aws.StringValue(pair.GroupId)
+			groupRule.Description = aws.StringValue(pair.Description)
+			rules = append(rules, &groupRule)
+		}
+	}
+	return rules
+}
+
+// validate validates that the rules select a security group and that all
+// the rules are valid.
+func (r *securityGroupRules) validate() error {
+	if r.ControlPlane == (r.NodePool != "") {
+		return fmt.Errorf("either control_plane or node_pool is required")
+	}
+	if r.LogicalID == "" {
+		return fmt.Errorf("logical_id is required")
+	}
+
+	for i, rule := range r.Ingress {
+		if rule.Protocol == "all" {
+			rule.Protocol = securityGroupProtoAll
+		}
+		err := rule.validate()
+		if err != nil {
+			return fmt.Errorf("invalid ingress rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// loadSecurityGroupRules renders the security group rules of the channel for
+// the cluster. Channels without the file manage no rules.
+func loadSecurityGroupRules(cluster *api.Cluster, channelPath string) ([]*securityGroupRules, error) {
+	result, err := renderTemplate(newTemplateContext(channelPath), path.Join(channelPath, securityGroupRulesFile), cluster)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var groups []*securityGroupRules
+	err = yaml.UnmarshalStrict([]byte(result), &groups)
+	if err != nil {
+		return nil, fmt.Errorf("invalid security group rules %s: %v", securityGroupRulesFile, err)
+	}
+
+	for i, group := range groups {
+		err := group.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid security group %d in %s: %v", i, securityGroupRulesFile, err)
+		}
+	}
+	return groups, nil
+}
+
+// securityGroupIDs returns the IDs of the security groups selected by the
+// rules. Node pools without stacks have none.
+func (a *awsAdapter) securityGroupIDs(cluster *api.Cluster, rules *securityGroupRules) ([]string, error) {
+	var stackNames []string
+	if rules.ControlPlane {
+		stackNames = append(stackNames, cluster.LocalID)
+	} else {
+		stacks, err := a.listNodePoolStacks(cluster, &api.NodePool{Name: rules.NodePool})
+		if err != nil {
+			return nil, err
+		}
+		for _, stack := range stacks {
+			stackNames = append(stackNames, aws.StringValue(stack.StackName))
+		}
+	}
+
+	var groupIDs []string
+	for _, stackName := range stackNames {
+		resp, err := a.cloudformationClient.DescribeStackResources(&cloudformation.DescribeStackResourcesInput{
+			StackName:         aws.String(stackName),
+			LogicalResourceId: aws.String(rules.LogicalID),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find %s in stack %s: %v", rules, stackName, err)
+		}
+
+		for _, resource := range resp.StackResources {
+			groupIDs = append(groupIDs, aws.StringValue(resource.PhysicalResourceId))
+		}
+	}
+	return groupIDs, nil
+}
+
+// reconcileSecurityGroups authorizes the ingress rules missing from the
+// security groups and, for the groups with prune set, revokes the rules
+// which aren't declared.
+func (a *awsAdapter) reconcileSecurityGroups(logger *log.Entry, cluster *api.Cluster, groups []*securityGroupRules) error {
+	for _, rules := range groups {
+		groupIDs, err := a.securityGroupIDs(cluster, rules)
+		if err != nil {
+			return err
+		}
+
+		for _, groupID := range groupIDs {
+			err := a.reconcileSecurityGroup(logger, groupID, rules)
+			if err != nil {
+				return fmt.Errorf("failed to reconcile %s (%s): %v", rules, groupID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *awsAdapter) reconcileSecurityGroup(logger *log.Entry, groupID string, rules *securityGroupRules) error {
+	resp, err := a.ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		GroupIds: aws.StringSlice([]string{groupID}),
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.SecurityGroups) != 1 {
+		return fmt.Errorf("security group not found")
+	}
+
+	existing := make(map[string]*securityGroupRule)
+	for _, rule := range permissionRules(resp.SecurityGroups[0].IpPermissions) {
+		existing[rule.key()] = rule
+	}
+
+	declared := make(map[string]*securityGroupRule, len(rules.Ingress))
+	for _, rule := range rules.Ingress {
+		declared[rule.key()] = rule
+	}
+
+	for _, key := range sortedRuleKeys(declared) {
+		if _, ok := existing[key]; ok {
+			continue
+		}
+
+		if a.dryRun {
+			logger.Infof("Dry-run: would allow %s in security group %s", key, groupID)
+			continue
+		}
+
+		logger.Infof("Allowing %s in security group %s", key, groupID)
+		_, err = a.ec2Client.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       aws.String(groupID),
+			IpPermissions: []*ec2.IpPermission{declared[key].ipPermission()},
+		})
+		a.audit.Record(audit.KindAWS, "authorize-security-group-ingress", groupID, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !rules.Prune {
+		return nil
+	}
+
+	for _, key := range sortedRuleKeys(existing) {
+		if _, ok := declared[key]; ok {
+			continue
+		}
+
+		if a.dryRun {
+			logger.Infof("Dry-run: would revoke %s in security group %s", key, groupID)
+			continue
+		}
+
+		logger.Infof("Revoking %s in security group %s", key, groupID)
+		_, err = a.ec2Client.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+			GroupId:       aws.String(groupID),
+			IpPermissions: []*ec2.IpPermission{existing[key].ipPermission()},
+		})
+		a.audit.Record(audit.KindAWS, "revoke-security-group-ingress", groupID, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedRuleKeys(rules map[string]*securityGroupRule) []string {
+	keys := make([]string, 0, len(rules))
+	for key := range rules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,159 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type ec2SecurityGroupsAPIStub struct {
+	ec2API
+	permissions []*ec2.IpPermission
+	authorized  []string
+	revoked     []string
+}
+
+func (e *ec2SecurityGroupsAPIStub) DescribeSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error) {
+	return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: []*ec2.SecurityGroup{
+		{GroupId: input.GroupIds[0], IpPermissions: e.permissions},
+	}}, nil
+}
+
+func (e *ec2SecurityGroupsAPIStub) AuthorizeSecurityGroupIngress(input *ec2.AuthorizeSecurityGroupIngressInput) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	for _, rule := range permissionRules(input.IpPermissions) {
+		e.authorized = append(e.authorized, aws.StringValue(input.GroupId)+": "+rule.key())
+	}
+	return &ec2.AuthorizeSecurityGroupIngressOutput{}, nil
+}
+
+func (e *ec2SecurityGroupsAPIStub) RevokeSecurityGroupIngress(input *ec2.RevokeSecurityGroupIngressInput) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	for _, rule := range permissionRules(input.IpPermissions) {
+		e.revoked = append(e.revoked, aws.StringValue(input.GroupId)+": "+rule.key())
+	}
+	return &ec2.RevokeSecurityGroupIngressOutput{}, nil
+}
+
+type cloudFormationSecurityGroupsAPIStub struct {
+	cloudFormationAPI
+}
+
+func (c *cloudFormationSecurityGroupsAPIStub) DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (*cloudformation.DescribeStackResourcesOutput, error) {
+	return &cloudformation.DescribeStackResourcesOutput{StackResources: []*cloudformation.StackResource{
+		{LogicalResourceId: input.LogicalResourceId, PhysicalResourceId: aws.String("sg-" + aws.StringValue(input.StackName))},
+	}}, nil
+}
+
+func TestLoadSecurityGroupRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "security-groups")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cluster := &api.Cluster{LocalID: "kube-1"}
+
+	groups, err := loadSecurityGroupRules(cluster, dir)
+	require.NoError(t, err)
+	require.Empty(t, groups)
+
+	writeTemplateTestFile(t, path.Join(dir, securityGroupRulesFile), `
+- control_plane: true
+  logical_id: MasterSecurityGroup
+  prune: true
+  ingress:
+  - protocol: tcp
+    from_port: 443
+    to_port: 443
+    cidr: 10.0.0.0/8
+    description: "API server of {{ .LocalID }}"
+  - protocol: all
+    source_group: sg-123
+`)
+	groups, err = loadSecurityGroupRules(cluster, dir)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	require.Equal(t, "API server of kube-1", groups[0].Ingress[0].Description)
+	require.Equal(t, securityGroupProtoAll, groups[0].Ingress[1].Protocol)
+
+	for _, invalid := range []string{
+		"- logical_id: WorkerSecurityGroup",
+		"- control_plane: true\n  node_pool: worker\n  logical_id: WorkerSecurityGroup",
+		"- node_pool: worker",
+		"- node_pool: worker\n  logical_id: WorkerSecurityGroup\n  ingress:\n  - protocol: sctp\n    cidr: 10.0.0.0/8",
+		"- node_pool: worker\n  logical_id: WorkerSecurityGroup\n  ingress:\n  - protocol: tcp\n    from_port: 80\n    to_port: 80",
+		"- node_pool: worker\n  logical_id: WorkerSecurityGroup\n  ingress:\n  - protocol: tcp\n    from_port: 443\n    to_port: 80\n    cidr: 10.0.0.0/8",
+		"- node_pool: worker\n  logical_id: WorkerSecurityGroup\n  egress: []",
+	} {
+		writeTemplateTestFile(t, path.Join(dir, securityGroupRulesFile), invalid)
+		_, err = loadSecurityGroupRules(cluster, dir)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestReconcileSecurityGroups(t *testing.T) {
+	logger := log.WithField("cluster", "kube-1")
+	cluster := &api.Cluster{ID: "kube-1", LocalID: "kube-1"}
+
+	for _, tc := range []struct {
+		msg        string
+		prune      bool
+		authorized []string
+		revoked    []string
+	}{
+		{
+			msg:        "missing rules are authorized",
+			authorized: []string{"sg-kube-1: tcp 443-443 from 10.0.0.0/8"},
+		},
+		{
+			msg:        "unmanaged rules are revoked with prune",
+			prune:      true,
+			authorized: []string{"sg-kube-1: tcp 443-443 from 10.0.0.0/8"},
+			revoked:    []string{"sg-kube-1: all from sg-old", "sg-kube-1: tcp 22-22 from 0.0.0.0/0"},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			ec2Stub := &ec2SecurityGroupsAPIStub{
+				permissions: []*ec2.IpPermission{
+					{
+						IpProtocol: aws.String("tcp"),
+						FromPort:   aws.Int64(22),
+						ToPort:     aws.Int64(22),
+						IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+					},
+					{
+						IpProtocol: aws.String("udp"),
+						FromPort:   aws.Int64(8472),
+						ToPort:     aws.Int64(8472),
+						IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("172.31.0.0/16"), Description: aws.String("flannel")}},
+					},
+					{
+						IpProtocol:       aws.String(securityGroupProtoAll),
+						UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-old")}},
+					},
+				},
+			}
+			adapter := &awsAdapter{ec2Client: ec2Stub, cloudformationClient: &cloudFormationSecurityGroupsAPIStub{}}
+
+			err := adapter.reconcileSecurityGroups(logger, cluster, []*securityGroupRules{
+				{
+					ControlPlane: true,
+					LogicalID:    "MasterSecurityGroup",
+					Prune:        tc.prune,
+					Ingress: []*securityGroupRule{
+						{Protocol: "tcp", FromPort: 443, ToPort: 443, CIDR: "10.0.0.0/8"},
+						{Protocol: "udp", FromPort: 8472, ToPort: 8472, CIDR: "172.31.0.0/16"},
+					},
+				},
+			})
+			require.NoError(t, err)
+			require.Equal(t, tc.authorized, ec2Stub.authorized)
+			require.Equal(t, tc.revoked, ec2Stub.revoked)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package provisioner
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// senzaDefinition is the part of a senza definition declaring the parameters
+// of the stack.
+type senzaDefinition struct {
+	SenzaInfo struct {
+		// Parameters are a list of single key maps from the name of the
+		// parameter to its description.
+		Parameters []map[string]interface{} `yaml:"Parameters"`
+	} `yaml:"SenzaInfo"`
+}
+
+// senzaParameters returns the names of the parameters declared by the senza
+// definition.
+func senzaParameters(stackDefinitionPath string) (map[string]bool, error) {
+	content, err := ioutil.ReadFile(stackDefinitionPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var definition senzaDefinition
+	err = yaml.Unmarshal(content, &definition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse senza definition %s: %v", stackDefinitionPath, err)
+	}
+
+	parameters := make(map[string]bool)
+	for _, parameter := range definition.SenzaInfo.Parameters {
+		for name := range parameter {
+			parameters[name] = true
+		}
+	}
+	return parameters, nil
+}
+
+// requireSenzaParameter returns an error if the senza definition doesn't
+// declare the parameter, so that channels which don't support it yet fail
+// with a clear message. purpose describes what the parameter is needed for.
+func requireSenzaParameter(stackDefinitionPath, parameter, purpose string) error {
+	parameters, err := senzaParameters(stackDefinitionPath)
+	if err != nil {
+		return err
+	}
+
+	if !parameters[parameter] {
+		return fmt.Errorf("senza definition %s must declare the parameter %s %s", stackDefinitionPath, parameter, purpose)
+	}
+	return nil
+}
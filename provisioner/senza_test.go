@@ -0,0 +1,42 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireSenzaParameter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "senza")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	definition := path.Join(dir, etcdStackDefinitionFile)
+	writeTemplateTestFile(t, definition, `SenzaInfo:
+  StackName: etcd-cluster
+  Parameters:
+    - HostedZone:
+        Description: "Hosted Zone"
+    - InstanceCount:
+        Description: "Number of etcd instances"
+        Default: "5"
+Resources:
+  EtcdCluster:
+    Type: "AWS::AutoScaling::AutoScalingGroup"
+`)
+
+	require.NoError(t, requireSenzaParameter(definition, etcdInstanceCountParameter, "to keep the number of etcd members"))
+
+	err = requireSenzaParameter(definition, "EtcdS3Backup", "to back up etcd")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must declare the parameter EtcdS3Backup to back up etcd")
+
+	// definitions without parameters
+	writeTemplateTestFile(t, definition, "SenzaInfo:\n  StackName: etcd-cluster\n")
+	require.Error(t, requireSenzaParameter(definition, etcdInstanceCountParameter, "to keep the number of etcd members"))
+
+	require.Error(t, requireSenzaParameter(path.Join(dir, "missing.yaml"), etcdInstanceCountParameter, "to keep the number of etcd members"))
+}
@@ -0,0 +1,135 @@
+package provisioner
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	configKeyServerSideApply = "server_side_apply"
+	configKeyFieldManager    = "apply_field_manager"
+	// configKeyForceConflicts is the config item listing the resources, as
+	// comma separated patterns of <namespace>/<kind>/<name> or <kind>/<name>
+	// for cluster scoped resources, whose conflicting fields are taken over
+	// from other field managers.
+	configKeyForceConflicts = "apply_force_conflicts"
+	defaultFieldManager     = "cluster-lifecycle-manager"
+)
+
+var fieldManagerPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._:-]{0,127}$`)
+
+// serverSideApply is the server-side apply configuration of a cluster. The
+// apply of a resource fails if it changes fields owned by another field
+// manager, e.g. an operator running in the cluster, unless conflicts are
+// forced for the resource.
+type serverSideApply struct {
+	fieldManager   string
+	forceConflicts []string
+}
+
+// newServerSideApply returns the server-side apply configuration of the
+// cluster or nil if manifests are applied client-side.
+func newServerSideApply(cluster *api.Cluster) (*serverSideApply, error) {
+	enabled := cluster.ConfigItems[configKeyServerSideApply]
+	switch enabled {
+	case "", "false":
+		if value, ok := cluster.ConfigItems[configKeyForceConflicts]; ok {
+			return nil, fmt.Errorf("invalid value for %s: %s, requires %s", configKeyForceConflicts, value, configKeyServerSideApply)
+		}
+		return nil, nil
+	case "true":
+	default:
+		return nil, fmt.Errorf("invalid value for %s: %s", configKeyServerSideApply, enabled)
+	}
+
+	result := &serverSideApply{fieldManager: defaultFieldManager}
+	if value, ok := cluster.ConfigItems[configKeyFieldManager]; ok {
+		if !fieldManagerPattern.MatchString(value) {
+			return nil, fmt.Errorf("invalid value for %s: %s", configKeyFieldManager, value)
+		}
+		result.fieldManager = value
+	}
+
+	for _, pattern := range strings.Split(cluster.ConfigItems[configKeyForceConflicts], ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %s", configKeyForceConflicts, pattern)
+		}
+		result.forceConflicts = append(result.forceConflicts, pattern)
+	}
+	return result, nil
+}
+
+// args returns the kubectl apply arguments for applying a manifest.
+func (s *serverSideApply) args(forceConflicts bool) []string {
+	args := []string{"--server-side", "--field-manager=" + s.fieldManager}
+	if forceConflicts {
+		args = append(args, "--force-conflicts")
+	}
+	return args
+}
+
+// forced returns true if conflicts are forced for the resource.
+func (s *serverSideApply) forced(resource string) bool {
+	for _, pattern := range s.forceConflicts {
+		if matched, _ := path.Match(pattern, resource); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// splitManifests moves the documents of the resources whose conflicts are
+// forced out of the manifests into manifests of their own, which come after
+// the remaining manifests.
+func (s *serverSideApply) splitManifests(manifests []*renderedManifest) []*renderedManifest {
+	if len(s.forceConflicts) == 0 {
+		return manifests
+	}
+
+	var result, forced []*renderedManifest
+	for _, manifest := range manifests {
+		var forcedDocuments, otherDocuments []string
+		for _, document := range yamlDocumentSeparator.Split(manifest.Content, -1) {
+			if stripWhitespace(document) == "" {
+				continue
+			}
+
+			var object manifestObject
+			err := yaml.Unmarshal([]byte(document), &object)
+			if err == nil && s.forced(kubernetesResourceName(object.Kind, object.Metadata.Namespace, object.Metadata.Name)) {
+				forcedDocuments = append(forcedDocuments, document)
+				continue
+			}
+			otherDocuments = append(otherDocuments, document)
+		}
+
+		if len(forcedDocuments) == 0 {
+			result = append(result, manifest)
+			continue
+		}
+
+		if len(otherDocuments) > 0 {
+			result = append(result, &renderedManifest{
+				File:      manifest.File,
+				Component: manifest.Component,
+				Content:   strings.Join(otherDocuments, "---\n"),
+			})
+		}
+		forced = append(forced, &renderedManifest{
+			File:           manifest.File,
+			Component:      manifest.Component,
+			Content:        strings.Join(forcedDocuments, "---\n"),
+			ForceConflicts: true,
+		})
+	}
+	return append(result, forced...)
+}
@@ -0,0 +1,85 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestNewServerSideApply(t *testing.T) {
+	serverSide, err := newServerSideApply(&api.Cluster{})
+	require.NoError(t, err)
+	require.Nil(t, serverSide)
+
+	serverSide, err = newServerSideApply(&api.Cluster{ConfigItems: map[string]string{configKeyServerSideApply: "true"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"--server-side", "--field-manager=cluster-lifecycle-manager"}, serverSide.args(false))
+
+	serverSide, err = newServerSideApply(&api.Cluster{ConfigItems: map[string]string{
+		configKeyServerSideApply: "true",
+		configKeyFieldManager:    "clm",
+		configKeyForceConflicts:  "kube-system/Deployment/*, ClusterRole/ingress",
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"--server-side", "--field-manager=clm", "--force-conflicts"}, serverSide.args(true))
+	require.True(t, serverSide.forced("kube-system/Deployment/external-dns"))
+	require.True(t, serverSide.forced("ClusterRole/ingress"))
+	require.False(t, serverSide.forced("visibility/Deployment/logging-agent"))
+
+	for _, invalid := range []map[string]string{
+		{configKeyServerSideApply: "yes"},
+		{configKeyForceConflicts: "ClusterRole/ingress"},
+		{configKeyServerSideApply: "true", configKeyFieldManager: "cluster lifecycle manager"},
+		{configKeyServerSideApply: "true", configKeyForceConflicts: "kube-system/[Deployment"},
+	} {
+		_, err := newServerSideApply(&api.Cluster{ConfigItems: invalid})
+		require.Error(t, err, "%v", invalid)
+	}
+}
+
+func TestServerSideApplySplitManifests(t *testing.T) {
+	serverSide := &serverSideApply{
+		fieldManager:   defaultFieldManager,
+		forceConflicts: []string{"kube-system/Deployment/*"},
+	}
+
+	manifests := []*renderedManifest{
+		{
+			File:      "external-dns/deployment.yaml",
+			Component: "external-dns",
+			Content: `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: external-dns
+  namespace: kube-system
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: external-dns
+  namespace: kube-system
+`,
+		},
+		{
+			File:      "external-dns/rbac.yaml",
+			Component: "external-dns",
+			Content: `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: external-dns
+`,
+		},
+	}
+
+	split := serverSide.splitManifests(manifests)
+	require.Len(t, split, 3)
+	require.Equal(t, []string{"kube-system/ServiceAccount/external-dns"}, manifestResources(split[0].Content))
+	require.False(t, split[0].ForceConflicts)
+	require.Equal(t, manifests[1], split[1])
+	require.Equal(t, "external-dns/deployment.yaml", split[2].File)
+	require.Equal(t, []string{"kube-system/Deployment/external-dns"}, manifestResources(split[2].Content))
+	require.True(t, split[2].ForceConflicts)
+
+	require.Equal(t, manifests, (&serverSideApply{fieldManager: defaultFieldManager}).splitManifests(manifests))
+}
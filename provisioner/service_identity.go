@@ -0,0 +1,115 @@
+package provisioner
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"golang.org/x/oauth2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	rbac "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+)
+
+const (
+	configKeyServiceIdentity    = "service_identity"
+	serviceIdentityNamespace    = "kube-system"
+	serviceIdentityName         = "cluster-lifecycle-manager"
+	serviceIdentityTokenTimeout = 2 * time.Minute
+)
+
+// serviceIdentityEnabled returns true if the manifests of the cluster are
+// applied with the CLM's own service account, enabled with the
+// service_identity config item.
+func serviceIdentityEnabled(cluster *api.Cluster) (bool, error) {
+	value, ok := cluster.ConfigItems[configKeyServiceIdentity]
+	if !ok {
+		return false, nil
+	}
+
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid value for %s: %s", configKeyServiceIdentity, value)
+	}
+}
+
+// serviceIdentityClusterRole is the cluster role of the CLM's service
+// account. Applying the manifests includes creating arbitrary RBAC roles, so
+// it can't be narrower than the permissions granted by the manifests.
+func serviceIdentityClusterRole() *rbac.ClusterRole {
+	return &rbac.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: serviceIdentityName,
+		},
+		Rules: []rbac.PolicyRule{
+			{
+				APIGroups: []string{"*"},
+				Resources: []string{"*"},
+				Verbs:     []string{"*"},
+			},
+			{
+				NonResourceURLs: []string{"*"},
+				Verbs:           []string{"*"},
+			},
+		},
+	}
+}
+
+// ensureServiceIdentity ensures the CLM's service account and its cluster
+// role exist and returns the token of the service account.
+func ensureServiceIdentity(client clientset.Interface, auditLog *audit.Log, timeout time.Duration) (string, error) {
+	clusterRoles := client.RbacV1beta1().ClusterRoles()
+	_, err := clusterRoles.Get(serviceIdentityName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = clusterRoles.Create(serviceIdentityClusterRole())
+		auditLog.Record(audit.KindKubernetes, "create", kubernetesResourceName("ClusterRole", "", serviceIdentityName), err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return ensureServiceAccountToken(client, auditLog, serviceIdentityNamespace, serviceIdentityName, serviceIdentityName, timeout)
+}
+
+// serviceIdentityTokenSource returns the token source the manifests of the
+// cluster are applied with. If the service_identity config item is set the
+// CLM's service account is bootstrapped with the provisioner token, which
+// is then only used for the bootstrap, and its token is returned. Otherwise
+// it's the provisioner token.
+func (p *clusterpyProvisioner) serviceIdentityTokenSource(logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster) (oauth2.TokenSource, error) {
+	enabled, err := serviceIdentityEnabled(cluster)
+	if err != nil || !enabled {
+		return adapter.tokenSrc, err
+	}
+
+	if adapter.dryRun {
+		logger.Infof("Dry-run: would bootstrap service account %s/%s", serviceIdentityNamespace, serviceIdentityName)
+		return adapter.tokenSrc, nil
+	}
+
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, adapter.tokenSrc, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := ensureServiceIdentity(client, adapter.audit, serviceIdentityTokenTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bootstrap service account %s/%s: %v", serviceIdentityNamespace, serviceIdentityName, err)
+	}
+
+	logger.Debugf("Applying manifests as service account %s/%s", serviceIdentityNamespace, serviceIdentityName)
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), nil
+}
@@ -0,0 +1,67 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"golang.org/x/oauth2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func TestEnsureServiceIdentity(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Namespace: serviceIdentityNamespace, Name: serviceIdentityName},
+			Secrets:    []v1.ObjectReference{{Name: "clm-token"}},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: serviceIdentityNamespace, Name: "clm-token"},
+			Type:       v1.SecretTypeServiceAccountToken,
+			Data:       map[string][]byte{adminTokenKey: []byte("clm-token")},
+		},
+	)
+
+	token, err := ensureServiceIdentity(client, nil, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "clm-token", token)
+
+	role, err := client.RbacV1beta1().ClusterRoles().Get(serviceIdentityName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, role.Rules, 2)
+
+	binding, err := client.RbacV1beta1().ClusterRoleBindings().Get(serviceIdentityName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, serviceIdentityName, binding.RoleRef.Name)
+	require.Equal(t, serviceIdentityNamespace, binding.Subjects[0].Namespace)
+
+	// the existing role is kept
+	token, err = ensureServiceIdentity(client, nil, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "clm-token", token)
+}
+
+func TestServiceIdentityTokenSource(t *testing.T) {
+	p := &clusterpyProvisioner{}
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "provisioner"})
+	adapter := &awsAdapter{tokenSrc: tokenSource}
+	logger := log.WithField("test", true)
+
+	// the provisioner token is used by default
+	result, err := p.serviceIdentityTokenSource(logger, adapter, &api.Cluster{ConfigItems: map[string]string{}})
+	require.NoError(t, err)
+	require.Equal(t, tokenSource, result)
+
+	// nothing is bootstrapped in dry-run mode
+	adapter.dryRun = true
+	result, err = p.serviceIdentityTokenSource(logger, adapter, &api.Cluster{ConfigItems: map[string]string{configKeyServiceIdentity: "true"}})
+	require.NoError(t, err)
+	require.Equal(t, tokenSource, result)
+
+	_, err = p.serviceIdentityTokenSource(logger, adapter, &api.Cluster{ConfigItems: map[string]string{configKeyServiceIdentity: "yes"}})
+	require.Error(t, err)
+}
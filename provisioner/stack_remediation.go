@@ -0,0 +1,157 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+)
+
+const (
+	configKeyStackApplyTimeout           = "stack_apply_timeout"
+	configKeyStackDeleteTimeout          = "stack_delete_timeout"
+	configKeyStackContinueUpdateRollback = "stack_continue_update_rollback"
+	configKeyStackRetainFailedResources  = "stack_retain_failed_resources"
+)
+
+// stackOptions configures how long to wait for stack operations and how to
+// remediate stacks which got stuck in a failed state.
+type stackOptions struct {
+	// applyTimeout is the maximum time to wait for a stack to be created
+	// or updated.
+	applyTimeout time.Duration
+	// deleteTimeout is the maximum time to wait for a stack to be
+	// deleted.
+	deleteTimeout time.Duration
+	// continueUpdateRollback enables continuing the rollback of stacks in
+	// UPDATE_ROLLBACK_FAILED before updating them.
+	continueUpdateRollback bool
+	// retainFailedResources enables deleting stacks in DELETE_FAILED by
+	// retaining the resources which failed to be deleted.
+	retainFailedResources bool
+}
+
+// newStackOptions returns the stack options configured by the config items of
+// the cluster.
+func newStackOptions(cluster *api.Cluster) (stackOptions, error) {
+	options := stackOptions{
+		applyTimeout:           maxWaitTimeout,
+		deleteTimeout:          maxWaitTimeout,
+		continueUpdateRollback: cluster.ConfigItems[configKeyStackContinueUpdateRollback] == "true",
+		retainFailedResources:  cluster.ConfigItems[configKeyStackRetainFailedResources] == "true",
+	}
+
+	for key, timeout := range map[string]*time.Duration{
+		configKeyStackApplyTimeout:  &options.applyTimeout,
+		configKeyStackDeleteTimeout: &options.deleteTimeout,
+	} {
+		value, ok := cluster.ConfigItems[key]
+		if !ok {
+			continue
+		}
+
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return stackOptions{}, fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		*timeout = duration
+	}
+
+	return options, nil
+}
+
+// stackApplyTimeout returns the maximum time to wait for a stack to be
+// created or updated.
+func (a *awsAdapter) stackApplyTimeout() time.Duration {
+	if a.stackOptions.applyTimeout == 0 {
+		return maxWaitTimeout
+	}
+	return a.stackOptions.applyTimeout
+}
+
+// stackDeleteTimeout returns the maximum time to wait for a stack to be
+// deleted.
+func (a *awsAdapter) stackDeleteTimeout() time.Duration {
+	if a.stackOptions.deleteTimeout == 0 {
+		return maxWaitTimeout
+	}
+	return a.stackOptions.deleteTimeout
+}
+
+// remediateUpdateRollbackFailed continues the rollback of the stack if it's
+// in UPDATE_ROLLBACK_FAILED, which otherwise can't be updated anymore. It's a
+// noop if the remediation is disabled or the stack is in any other state.
+func (a *awsAdapter) remediateUpdateRollbackFailed(stackName string) error {
+	if !a.stackOptions.continueUpdateRollback {
+		return nil
+	}
+
+	stack, err := a.getStackByName(stackName)
+	if err != nil {
+		return err
+	}
+
+	if aws.StringValue(stack.StackStatus) != cloudformation.StackStatusUpdateRollbackFailed {
+		return nil
+	}
+
+	a.logger.Warnf("Stack '%s' is in %s, continuing the rollback", stackName, cloudformation.StackStatusUpdateRollbackFailed)
+
+	_, err = a.cloudformationClient.ContinueUpdateRollback(&cloudformation.ContinueUpdateRollbackInput{
+		StackName: aws.String(stackName),
+	})
+	a.audit.Record(audit.KindAWS, "continue-update-rollback", stackName, err)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.stackApplyTimeout())
+	defer cancel()
+	err = a.waitForStack(ctx, waitTime, stackName)
+	if err != nil && err != errUpdateRollbackComplete {
+		return fmt.Errorf("failed to continue the rollback of stack %s: %v", stackName, err)
+	}
+
+	return nil
+}
+
+// remediateDeleteFailed deletes a stack in DELETE_FAILED by retaining all the
+// resources which failed to be deleted. The retained resources are logged
+// and must be cleaned up manually.
+func (a *awsAdapter) remediateDeleteFailed(parentCtx context.Context, stackName string) error {
+	resources, err := a.cloudformationClient.DescribeStackResources(&cloudformation.DescribeStackResourcesInput{
+		StackName: aws.String(stackName),
+	})
+	if err != nil {
+		return err
+	}
+
+	var retain []*string
+	for _, resource := range resources.StackResources {
+		if aws.StringValue(resource.ResourceStatus) == cloudformation.ResourceStatusDeleteFailed {
+			a.logger.Warnf("Retaining resource %s (%s) of stack '%s': %s",
+				aws.StringValue(resource.LogicalResourceId),
+				aws.StringValue(resource.PhysicalResourceId),
+				stackName,
+				aws.StringValue(resource.ResourceStatusReason))
+			retain = append(retain, resource.LogicalResourceId)
+		}
+	}
+
+	_, err = a.cloudformationClient.DeleteStack(&cloudformation.DeleteStackInput{
+		StackName:       aws.String(stackName),
+		RetainResources: retain,
+	})
+	a.audit.Record(audit.KindAWS, "delete-stack-retain-resources", stackName, err)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, a.stackDeleteTimeout())
+	defer cancel()
+	return a.waitForStack(ctx, waitTime, stackName)
+}
@@ -0,0 +1,52 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestNewStackOptions(t *testing.T) {
+	options, err := newStackOptions(&api.Cluster{ConfigItems: map[string]string{}})
+	require.NoError(t, err)
+	require.Equal(t, stackOptions{applyTimeout: maxWaitTimeout, deleteTimeout: maxWaitTimeout}, options)
+
+	options, err = newStackOptions(&api.Cluster{ConfigItems: map[string]string{
+		configKeyStackApplyTimeout:           "45m",
+		configKeyStackDeleteTimeout:          "1h",
+		configKeyStackContinueUpdateRollback: "true",
+		configKeyStackRetainFailedResources:  "true",
+	}})
+	require.NoError(t, err)
+	require.Equal(t, stackOptions{
+		applyTimeout:           45 * time.Minute,
+		deleteTimeout:          time.Hour,
+		continueUpdateRollback: true,
+		retainFailedResources:  true,
+	}, options)
+
+	for _, value := range []string{"foo", "0s", "-1m"} {
+		_, err = newStackOptions(&api.Cluster{ConfigItems: map[string]string{configKeyStackApplyTimeout: value}})
+		require.Error(t, err)
+	}
+}
+
+func TestRemediateUpdateRollbackFailed(t *testing.T) {
+	// remediation disabled
+	adapter := newAWSAdapterWithStubs(cloudformation.StackStatusUpdateRollbackFailed, "123")
+	require.NoError(t, adapter.remediateUpdateRollbackFailed("foobar"))
+	stack, err := adapter.getStackByName("foobar")
+	require.NoError(t, err)
+	require.Equal(t, cloudformation.StackStatusUpdateRollbackFailed, aws.StringValue(stack.StackStatus))
+
+	// remediation enabled
+	adapter.stackOptions.continueUpdateRollback = true
+	require.NoError(t, adapter.remediateUpdateRollbackFailed("foobar"))
+	stack, err = adapter.getStackByName("foobar")
+	require.NoError(t, err)
+	require.Equal(t, cloudformation.StackStatusUpdateRollbackComplete, aws.StringValue(stack.StackStatus))
+}
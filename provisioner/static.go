@@ -0,0 +1,296 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+	"golang.org/x/oauth2"
+)
+
+const (
+	staticProviderID              = "zalando-static"
+	configKeyNodePoolBackend      = "node_pool_backend"
+	configKeyStaticReprovisionURL = "static_reprovision_url"
+	configKeyCAPIAPIServer        = "capi_api_server"
+	configKeyCAPINamespace        = "capi_namespace"
+	configKeyCAPIClusterName      = "capi_cluster_name"
+	nodePoolBackendStatic         = "static"
+	nodePoolBackendCAPI           = "capi"
+	defaultCAPINamespace          = "default"
+)
+
+// staticProvisioner manages pre-existing clusters, e.g. on bare-metal or at
+// the edge, without touching any infrastructure. It only updates the nodes
+// of the node pools in place and applies the manifests of the channel.
+type staticProvisioner struct {
+	*clusterpyProvisioner
+}
+
+// NewStaticProvisioner returns a new provisioner for pre-existing clusters
+// authenticating against their API servers with the token source.
+func NewStaticProvisioner(tokenSource oauth2.TokenSource, options *Options) Provisioner {
+	return &staticProvisioner{
+		clusterpyProvisioner: NewClusterpyProvisioner(tokenSource, "", nil, options).(*clusterpyProvisioner),
+	}
+}
+
+func (p *staticProvisioner) Supports(cluster *api.Cluster) bool {
+	return cluster.Provider == staticProviderID
+}
+
+// prepareStatic checks that the cluster can be handled by the provisioner
+// and initializes an adapter for applying the manifests.
+func (p *staticProvisioner) prepareStatic(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, auditLog *audit.Log) (*awsAdapter, error) {
+	if cluster.Provider != staticProviderID {
+		return nil, ErrProviderNotSupported
+	}
+
+	logger.Infof("static: Prepare for provisioning cluster %s (%s)..", cluster.ID, cluster.LifecycleStatus)
+
+	err := p.updateDefaults(cluster, channelConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration defaults: %v", err)
+	}
+
+	err = validateConfigSchema(logger, cluster, channelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSource, err := p.clusterTokenSource(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return &awsAdapter{
+		apiServer: cluster.APIServerURL,
+		region:    cluster.Region,
+		tokenSrc:  tokenSource,
+		dryRun:    options.dryRun,
+		logger:    logger,
+		audit:     auditLog,
+	}, nil
+}
+
+// Provision updates the nodes of the node pools in place and applies the
+// manifests of the channel to the cluster.
+func (p *staticProvisioner) Provision(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (err error) {
+	ctx, span := p.tracer.Start(ctx, "provision", traceAttributes(cluster, auditOperationProvision))
+	defer func() { span.End(err) }()
+
+	auditLog := p.newAuditLog(cluster, auditOperationProvision)
+	adapter, err := p.prepareStatic(logger, cluster, channelConfig, auditLog)
+	if err != nil {
+		return err
+	}
+	defer p.storeAuditLog(logger, cluster, auditLog)
+
+	client, err := p.apiServerClient(cluster)
+	if err != nil {
+		return err
+	}
+
+	apiServerVersion, err := waitForAPIServer(logger, client, cluster.APIServerURL, defaultAPIServerWaitTimeout, nil)
+	if err != nil {
+		return err
+	}
+	logger = logger.WithField("apiserver_version", apiServerVersion.GitVersion)
+
+	adapter.kubectl, err = p.kubectlBinary(logger, channelConfig, apiServerVersion.GitVersion)
+	if err != nil {
+		return err
+	}
+
+	values, err := p.genericClusterValues(cluster, channelConfig.Path)
+	if err != nil {
+		return err
+	}
+
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case options.applyOnly:
+	case adapter.dryRun:
+		logger.Infof("Dry-run: skipping the update of the node pools")
+	default:
+		updater, err := p.staticUpdateStrategy(logger, cluster, channelConfig.Path, values.Values, auditLog)
+		if err != nil {
+			return err
+		}
+
+		for _, nodePool := range cluster.NodePools {
+			err = updater.Update(ctx, nodePool)
+			if err != nil {
+				return err
+			}
+
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return p.applyGeneric(ctx, logger, adapter, cluster, path.Join(channelConfig.Path, manifestsPath), values)
+}
+
+// staticUpdateStrategy returns the update strategy for the node pools of
+// the cluster, backed by the node pool backend selected by the
+// node_pool_backend config item. Nodes of a static inventory are updated in
+// place and only reprovisioned if the static_reprovision_url config item is
+// set. Node pools managed by Cluster API MachineDeployments can be scaled
+// and are updated with the rolling update strategy.
+func (p *staticProvisioner) staticUpdateStrategy(logger *log.Entry, cluster *api.Cluster, channelPath string, values map[string]interface{}, auditLog *audit.Log) (updatestrategy.UpdateStrategy, error) {
+	backendName := nodePoolBackendStatic
+	if value, ok := cluster.ConfigItems[configKeyNodePoolBackend]; ok {
+		backendName = value
+	}
+	if backendName != nodePoolBackendStatic && backendName != nodePoolBackendCAPI {
+		return nil, fmt.Errorf("invalid value for %s: %s", configKeyNodePoolBackend, backendName)
+	}
+
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSource, err := p.clusterTokenSource(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, tokenSource, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	var backend updatestrategy.ProviderNodePoolsBackend
+	switch backendName {
+	case nodePoolBackendStatic:
+		var reprovisioner updatestrategy.Reprovisioner
+		if url, ok := cluster.ConfigItems[configKeyStaticReprovisionURL]; ok {
+			httpClient, err := p.httpConfig.Client(nil)
+			if err != nil {
+				return nil, err
+			}
+			reprovisioner = updatestrategy.NewWebhookReprovisioner(cluster.ID, url, httpClient)
+		}
+
+		backend = updatestrategy.NewStaticInventoryBackend(client, updateProgressNamespace, reprovisioner, func(nodePool *api.NodePool) (string, error) {
+			return staticUserData(cluster, nodePool, channelPath, values)
+		})
+	case nodePoolBackendCAPI:
+		backend, err = p.capiNodePoolsBackend(cluster, tokenSource, transport)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	maxEvictTimeout, err := p.maxEvictTimeout(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := drainPolicy(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	updateLogger := logging.WithModule(logger, "updatestrategy")
+	var poolManager updatestrategy.NodePoolManager = updatestrategy.NewKubernetesNodePoolManager(updateLogger, cluster.ID, client, backend, maxEvictTimeout, policy)
+	if auditLog != nil {
+		poolManager = &auditingNodePoolManager{
+			NodePoolManager: poolManager,
+			auditLog:        auditLog,
+		}
+	}
+
+	if backendName == nodePoolBackendCAPI {
+		return updatestrategy.NewRollingUpdateStrategy(updateLogger, poolManager, defaultRollingUpdateSurge, 0), nil
+	}
+	return updatestrategy.NewInPlaceUpdateStrategy(updateLogger, poolManager), nil
+}
+
+// capiNodePoolsBackend returns the backend managing the MachineDeployments
+// of the cluster. They're looked up in the management cluster given by the
+// capi_api_server config item, authenticating with the provisioner token, or
+// the cluster itself with the token source of the cluster by default.
+func (p *staticProvisioner) capiNodePoolsBackend(cluster *api.Cluster, tokenSource oauth2.TokenSource, transport http.RoundTripper) (*updatestrategy.CAPINodePoolsBackend, error) {
+	apiServer := cluster.APIServerURL
+	if value, ok := cluster.ConfigItems[configKeyCAPIAPIServer]; ok {
+		apiServer = value
+		tokenSource = p.tokenSource
+	}
+
+	namespace := defaultCAPINamespace
+	if value, ok := cluster.ConfigItems[configKeyCAPINamespace]; ok {
+		namespace = value
+	}
+
+	clusterName := cluster.LocalID
+	if value, ok := cluster.ConfigItems[configKeyCAPIClusterName]; ok {
+		clusterName = value
+	}
+
+	return updatestrategy.NewCAPINodePoolsBackend(kubernetes.NewConfigWithTokenSource(apiServer, tokenSource, transport), namespace, clusterName)
+}
+
+// staticUserData returns the Ignition config rendered from the user data of
+// the profile of the node pool, which the nodes are reprovisioned with. It's
+// empty if the profile has no user data.
+func staticUserData(cluster *api.Cluster, nodePool *api.NodePool, channelPath string, values map[string]interface{}) (string, error) {
+	nodePoolProfilesPath := path.Join(channelPath, "cluster", "node-pools", nodePool.Profile)
+	userDataPath := path.Join(nodePoolProfilesPath, userDataFileName)
+
+	rendered, err := renderTemplate(newTemplateContext(nodePoolProfilesPath), userDataPath, &userDataParams{
+		Cluster:  cluster,
+		NodePool: nodePool,
+		Values:   values,
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	userData, err := clcToIgnition([]byte(rendered))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse config %s: %v", userDataPath, err)
+	}
+	return string(userData), nil
+}
+
+// Decommission doesn't delete anything, the infrastructure of static
+// clusters isn't managed by the CLM.
+func (p *staticProvisioner) Decommission(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error {
+	_, err := p.prepareStatic(logger, cluster, channelConfig, nil)
+	if err != nil {
+		return err
+	}
+
+	err = checkDecommission(cluster)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Cluster %s is static, leaving its infrastructure in place", cluster.ID)
+	return nil
+}
@@ -0,0 +1,328 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	configKeyStaticEgress = "static_egress"
+	// staticEgressZoneTagKey tags the elastic IPs and NAT gateways of the
+	// static egress of a cluster with the availability zone they serve.
+	staticEgressZoneTagKey = "cluster-lifecycle-manager.zalando.org/static-egress-zone"
+)
+
+// natGatewayPollInterval is the interval between checks of the state of NAT
+// gateways being created or deleted. It's defined as a variable so it can be
+// changed in tests.
+var natGatewayPollInterval = 10 * time.Second
+
+// staticEgressEnabled returns true if the cluster gets a NAT gateway with an
+// elastic IP in every availability zone, so its egress traffic uses static
+// IPs.
+func staticEgressEnabled(cluster *api.Cluster) bool {
+	return cluster.ConfigItems[configKeyStaticEgress] == "true"
+}
+
+// staticEgressFilters return the filters matching the elastic IPs and NAT
+// gateways of the static egress of the cluster.
+func staticEgressFilters(cluster *api.Cluster) []*ec2.Filter {
+	return []*ec2.Filter{
+		{
+			Name:   aws.String("tag:" + tagNameKubernetesClusterPrefix + cluster.ID),
+			Values: aws.StringSlice([]string{resourceLifecycleOwned}),
+		},
+		{
+			Name:   aws.String("tag-key"),
+			Values: aws.StringSlice([]string{staticEgressZoneTagKey}),
+		},
+	}
+}
+
+func staticEgressTags(cluster *api.Cluster, zone string) []*ec2.Tag {
+	return []*ec2.Tag{
+		{
+			Key:   aws.String(tagNameKubernetesClusterPrefix + cluster.ID),
+			Value: aws.String(resourceLifecycleOwned),
+		},
+		{
+			Key:   aws.String(staticEgressZoneTagKey),
+			Value: aws.String(zone),
+		},
+	}
+}
+
+// staticEgressAddresses returns the elastic IPs of the static egress of the
+// cluster, keyed by availability zone.
+func (a *awsAdapter) staticEgressAddresses(cluster *api.Cluster) (map[string]*ec2.Address, error) {
+	resp, err := a.ec2Client.DescribeAddresses(&ec2.DescribeAddressesInput{
+		Filters: staticEgressFilters(cluster),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make(map[string]*ec2.Address, len(resp.Addresses))
+	for _, address := range resp.Addresses {
+		addresses[tagsToMap(address.Tags)[staticEgressZoneTagKey]] = address
+	}
+	return addresses, nil
+}
+
+// staticEgressIPs returns the sorted public IPs of the static egress of the
+// cluster.
+func (a *awsAdapter) staticEgressIPs(cluster *api.Cluster) ([]string, error) {
+	addresses, err := a.staticEgressAddresses(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		ips = append(ips, aws.StringValue(address.PublicIp))
+	}
+	sort.Strings(ips)
+	return ips, nil
+}
+
+// staticEgressNatGateways returns the NAT gateways of the static egress of
+// the cluster which aren't deleted, keyed by availability zone.
+func (a *awsAdapter) staticEgressNatGateways(cluster *api.Cluster) (map[string]*ec2.NatGateway, error) {
+	filters := append(staticEgressFilters(cluster), &ec2.Filter{
+		Name:   aws.String("state"),
+		Values: aws.StringSlice([]string{ec2.NatGatewayStatePending, ec2.NatGatewayStateAvailable, ec2.NatGatewayStateDeleting, ec2.NatGatewayStateFailed}),
+	})
+
+	natGateways := make(map[string]*ec2.NatGateway)
+	err := a.ec2Client.DescribeNatGatewaysPages(&ec2.DescribeNatGatewaysInput{Filter: filters}, func(resp *ec2.DescribeNatGatewaysOutput, lastPage bool) bool {
+		for _, natGateway := range resp.NatGateways {
+			natGateways[tagsToMap(natGateway.Tags)[staticEgressZoneTagKey]] = natGateway
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return natGateways, nil
+}
+
+// ensureStaticEgress allocates an elastic IP and creates a NAT gateway using
+// it in the subnet selected for every availability zone of the cluster, if
+// static egress is enabled for it, and waits until the NAT gateways are
+// available.
+func (a *awsAdapter) ensureStaticEgress(ctx context.Context, logger *log.Entry, cluster *api.Cluster) error {
+	if !staticEgressEnabled(cluster) {
+		return nil
+	}
+
+	subnets, err := a.GetSubnets()
+	if err != nil {
+		return err
+	}
+
+	addresses, err := a.staticEgressAddresses(cluster)
+	if err != nil {
+		return err
+	}
+
+	natGateways, err := a.staticEgressNatGateways(cluster)
+	if err != nil {
+		return err
+	}
+
+	subnetsPerZone := selectSubnetIDs(subnets)
+	zones := make([]string, 0, len(subnetsPerZone))
+	for zone := range subnetsPerZone {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	for _, zone := range zones {
+		if natGateway, ok := natGateways[zone]; ok && aws.StringValue(natGateway.State) != ec2.NatGatewayStateDeleting {
+			continue
+		}
+
+		if a.dryRun {
+			logger.Infof("Dry-run: would create the static egress NAT gateway of zone %s", zone)
+			continue
+		}
+
+		address, ok := addresses[zone]
+		if !ok {
+			address, err = a.allocateStaticEgressAddress(logger, cluster, zone)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = a.createStaticEgressNatGateway(logger, cluster, zone, subnetsPerZone[zone], address)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.dryRun {
+		return nil
+	}
+	return a.waitForStaticEgressNatGateways(ctx, cluster, ec2.NatGatewayStateAvailable)
+}
+
+// allocateStaticEgressAddress allocates and tags the elastic IP of the
+// static egress of the availability zone.
+func (a *awsAdapter) allocateStaticEgressAddress(logger *log.Entry, cluster *api.Cluster, zone string) (*ec2.Address, error) {
+	resp, err := a.ec2Client.AllocateAddress(&ec2.AllocateAddressInput{
+		Domain: aws.String(ec2.DomainTypeVpc),
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Allocated elastic IP %s for the static egress of zone %s", aws.StringValue(resp.PublicIp), zone)
+
+	err = a.CreateTags(aws.StringValue(resp.AllocationId), staticEgressTags(cluster, zone))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ec2.Address{AllocationId: resp.AllocationId, PublicIp: resp.PublicIp}, nil
+}
+
+// createStaticEgressNatGateway creates and tags the NAT gateway of the static
+// egress of the availability zone. A NAT gateway already using the elastic
+// IP, e.g. because tagging it failed, is adopted instead.
+func (a *awsAdapter) createStaticEgressNatGateway(logger *log.Entry, cluster *api.Cluster, zone, subnetID string, address *ec2.Address) error {
+	resp, err := a.ec2Client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{
+		Filter: []*ec2.Filter{
+			{
+				Name:   aws.String("subnet-id"),
+				Values: aws.StringSlice([]string{subnetID}),
+			},
+			{
+				Name:   aws.String("state"),
+				Values: aws.StringSlice([]string{ec2.NatGatewayStatePending, ec2.NatGatewayStateAvailable}),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var natGatewayID string
+	for _, natGateway := range resp.NatGateways {
+		for _, natGatewayAddress := range natGateway.NatGatewayAddresses {
+			if aws.StringValue(natGatewayAddress.AllocationId) == aws.StringValue(address.AllocationId) {
+				natGatewayID = aws.StringValue(natGateway.NatGatewayId)
+			}
+		}
+	}
+
+	if natGatewayID == "" {
+		created, err := a.ec2Client.CreateNatGateway(&ec2.CreateNatGatewayInput{
+			AllocationId: address.AllocationId,
+			SubnetId:     aws.String(subnetID),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create the static egress NAT gateway of zone %s: %v", zone, err)
+		}
+		natGatewayID = aws.StringValue(created.NatGateway.NatGatewayId)
+		logger.Infof("Created NAT gateway %s with elastic IP %s in subnet %s", natGatewayID, aws.StringValue(address.PublicIp), subnetID)
+	}
+
+	return a.CreateTags(natGatewayID, staticEgressTags(cluster, zone))
+}
+
+// waitForStaticEgressNatGateways waits until all NAT gateways of the static
+// egress of the cluster are in the state, or until they're deleted if state
+// is empty. A failed NAT gateway is an error.
+func (a *awsAdapter) waitForStaticEgressNatGateways(ctx context.Context, cluster *api.Cluster, state string) error {
+	for {
+		natGateways, err := a.staticEgressNatGateways(cluster)
+		if err != nil {
+			return err
+		}
+
+		done := true
+		for zone, natGateway := range natGateways {
+			switch aws.StringValue(natGateway.State) {
+			case state:
+			case ec2.NatGatewayStateFailed:
+				// failed NAT gateways are removed by AWS
+				if state == "" {
+					continue
+				}
+				return fmt.Errorf("static egress NAT gateway %s of zone %s failed: %s", aws.StringValue(natGateway.NatGatewayId), zone, aws.StringValue(natGateway.FailureMessage))
+			default:
+				done = false
+			}
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(natGatewayPollInterval):
+		}
+	}
+}
+
+// deleteStaticEgress deletes the NAT gateways of the static egress of the
+// cluster and releases their elastic IPs once they're deleted. The resources
+// are deleted even if static egress isn't enabled for the cluster anymore.
+func (a *awsAdapter) deleteStaticEgress(ctx context.Context, logger *log.Entry, cluster *api.Cluster) error {
+	natGateways, err := a.staticEgressNatGateways(cluster)
+	if err != nil {
+		return err
+	}
+
+	addresses, err := a.staticEgressAddresses(cluster)
+	if err != nil {
+		return err
+	}
+
+	if a.dryRun {
+		for zone := range natGateways {
+			logger.Infof("Dry-run: would delete the static egress NAT gateway of zone %s", zone)
+		}
+		for zone, address := range addresses {
+			logger.Infof("Dry-run: would release elastic IP %s of zone %s", aws.StringValue(address.PublicIp), zone)
+		}
+		return nil
+	}
+
+	for _, natGateway := range natGateways {
+		switch aws.StringValue(natGateway.State) {
+		case ec2.NatGatewayStateDeleting, ec2.NatGatewayStateFailed:
+			continue
+		}
+
+		logger.Infof("Deleting NAT gateway %s", aws.StringValue(natGateway.NatGatewayId))
+		_, err = a.ec2Client.DeleteNatGateway(&ec2.DeleteNatGatewayInput{NatGatewayId: natGateway.NatGatewayId})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the elastic IPs can only be released once they're not associated
+	// anymore
+	err = a.waitForStaticEgressNatGateways(ctx, cluster, "")
+	if err != nil {
+		return err
+	}
+
+	for _, address := range addresses {
+		logger.Infof("Releasing elastic IP %s", aws.StringValue(address.PublicIp))
+		_, err = a.ec2Client.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: address.AllocationId})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// ec2StaticEgressAPIStub keeps the elastic IPs and NAT gateways in memory.
+// NAT gateways become available or deleted as soon as they're described.
+type ec2StaticEgressAPIStub struct {
+	ec2API
+	addresses   map[string]*ec2.Address
+	natGateways map[string]*ec2.NatGateway
+	released    []string
+}
+
+func newEC2StaticEgressAPIStub() *ec2StaticEgressAPIStub {
+	return &ec2StaticEgressAPIStub{
+		addresses:   make(map[string]*ec2.Address),
+		natGateways: make(map[string]*ec2.NatGateway),
+	}
+}
+
+func (e *ec2StaticEgressAPIStub) DescribeVpcs(input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	return &ec2.DescribeVpcsOutput{Vpcs: []*ec2.Vpc{{VpcId: aws.String("vpc-1"), IsDefault: aws.Bool(true)}}}, nil
+}
+
+func (e *ec2StaticEgressAPIStub) DescribeSubnets(input *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	return &ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+		{SubnetId: aws.String("subnet-a"), AvailabilityZone: aws.String("eu-central-1a")},
+		{SubnetId: aws.String("subnet-b"), AvailabilityZone: aws.String("eu-central-1b")},
+	}}, nil
+}
+
+func (e *ec2StaticEgressAPIStub) AllocateAddress(input *ec2.AllocateAddressInput) (*ec2.AllocateAddressOutput, error) {
+	id := fmt.Sprintf("eipalloc-%d", len(e.addresses)+1)
+	ip := fmt.Sprintf("52.0.0.%d", len(e.addresses)+1)
+	e.addresses[id] = &ec2.Address{AllocationId: aws.String(id), PublicIp: aws.String(ip)}
+	return &ec2.AllocateAddressOutput{AllocationId: aws.String(id), PublicIp: aws.String(ip)}, nil
+}
+
+func (e *ec2StaticEgressAPIStub) ReleaseAddress(input *ec2.ReleaseAddressInput) (*ec2.ReleaseAddressOutput, error) {
+	id := aws.StringValue(input.AllocationId)
+	for _, natGateway := range e.natGateways {
+		if aws.StringValue(natGateway.NatGatewayAddresses[0].AllocationId) == id && aws.StringValue(natGateway.State) != ec2.NatGatewayStateDeleted {
+			return nil, fmt.Errorf("address %s is in use", id)
+		}
+	}
+	delete(e.addresses, id)
+	e.released = append(e.released, id)
+	return &ec2.ReleaseAddressOutput{}, nil
+}
+
+func (e *ec2StaticEgressAPIStub) CreateTags(input *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	id := aws.StringValue(input.Resources[0])
+	if address, ok := e.addresses[id]; ok {
+		address.Tags = append(address.Tags, input.Tags...)
+	}
+	if natGateway, ok := e.natGateways[id]; ok {
+		natGateway.Tags = append(natGateway.Tags, input.Tags...)
+	}
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func (e *ec2StaticEgressAPIStub) CreateNatGateway(input *ec2.CreateNatGatewayInput) (*ec2.CreateNatGatewayOutput, error) {
+	id := fmt.Sprintf("nat-%d", len(e.natGateways)+1)
+	natGateway := &ec2.NatGateway{
+		NatGatewayId:        aws.String(id),
+		SubnetId:            input.SubnetId,
+		State:               aws.String(ec2.NatGatewayStatePending),
+		NatGatewayAddresses: []*ec2.NatGatewayAddress{{AllocationId: input.AllocationId}},
+	}
+	e.natGateways[id] = natGateway
+	return &ec2.CreateNatGatewayOutput{NatGateway: natGateway}, nil
+}
+
+func (e *ec2StaticEgressAPIStub) DeleteNatGateway(input *ec2.DeleteNatGatewayInput) (*ec2.DeleteNatGatewayOutput, error) {
+	e.natGateways[aws.StringValue(input.NatGatewayId)].State = aws.String(ec2.NatGatewayStateDeleting)
+	return &ec2.DeleteNatGatewayOutput{}, nil
+}
+
+// matches returns true if the tags and state match the filters.
+func (e *ec2StaticEgressAPIStub) matches(filters []*ec2.Filter, tags []*ec2.Tag, attributes map[string]string) bool {
+	tagMap := tagsToMap(tags)
+	for _, filter := range filters {
+		name := aws.StringValue(filter.Name)
+		var value string
+		var ok bool
+		switch {
+		case name == "tag-key":
+			_, ok = tagMap[aws.StringValue(filter.Values[0])]
+			if !ok {
+				return false
+			}
+			continue
+		case len(name) > 4 && name[:4] == "tag:":
+			value, ok = tagMap[name[4:]]
+		default:
+			value, ok = attributes[name]
+		}
+		if !ok {
+			return false
+		}
+
+		found := false
+		for _, v := range aws.StringValueSlice(filter.Values) {
+			found = found || v == value
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *ec2StaticEgressAPIStub) DescribeAddresses(input *ec2.DescribeAddressesInput) (*ec2.DescribeAddressesOutput, error) {
+	var addresses []*ec2.Address
+	for _, address := range e.addresses {
+		if e.matches(input.Filters, address.Tags, nil) {
+			addresses = append(addresses, address)
+		}
+	}
+	return &ec2.DescribeAddressesOutput{Addresses: addresses}, nil
+}
+
+func (e *ec2StaticEgressAPIStub) DescribeNatGateways(input *ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error) {
+	var natGateways []*ec2.NatGateway
+	for _, natGateway := range e.natGateways {
+		if e.matches(input.Filter, natGateway.Tags, map[string]string{"state": aws.StringValue(natGateway.State), "subnet-id": aws.StringValue(natGateway.SubnetId)}) {
+			natGateways = append(natGateways, natGateway)
+		}
+	}
+
+	// the state changes are completed once observed
+	for _, natGateway := range e.natGateways {
+		switch aws.StringValue(natGateway.State) {
+		case ec2.NatGatewayStatePending:
+			natGateway.State = aws.String(ec2.NatGatewayStateAvailable)
+		case ec2.NatGatewayStateDeleting:
+			natGateway.State = aws.String(ec2.NatGatewayStateDeleted)
+		}
+	}
+	return &ec2.DescribeNatGatewaysOutput{NatGateways: natGateways}, nil
+}
+
+func (e *ec2StaticEgressAPIStub) DescribeNatGatewaysPages(input *ec2.DescribeNatGatewaysInput, fn func(*ec2.DescribeNatGatewaysOutput, bool) bool) error {
+	resp, err := e.DescribeNatGateways(input)
+	if err != nil {
+		return err
+	}
+	fn(resp, true)
+	return nil
+}
+
+func TestStaticEgress(t *testing.T) {
+	natGatewayPollInterval = 0
+
+	logger := log.WithField("cluster", "kube-1")
+	cluster := &api.Cluster{ID: "kube-1", ConfigItems: map[string]string{configKeyStaticEgress: "true"}}
+	stub := newEC2StaticEgressAPIStub()
+	adapter := &awsAdapter{ec2Client: stub}
+
+	err := adapter.ensureStaticEgress(context.Background(), logger, cluster)
+	require.NoError(t, err)
+	require.Len(t, stub.addresses, 2)
+	require.Len(t, stub.natGateways, 2)
+
+	ips, err := adapter.staticEgressIPs(cluster)
+	require.NoError(t, err)
+	require.Equal(t, []string{"52.0.0.1", "52.0.0.2"}, ips)
+
+	facts, err := adapter.vpcInfrastructureFacts(cluster, &ec2.Vpc{VpcId: aws.String("vpc-1")}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"52.0.0.1", "52.0.0.2"}, facts.EgressIPs)
+
+	// the existing elastic IPs and NAT gateways are reused
+	err = adapter.ensureStaticEgress(context.Background(), logger, cluster)
+	require.NoError(t, err)
+	require.Len(t, stub.addresses, 2)
+	require.Len(t, stub.natGateways, 2)
+
+	// NAT gateways which failed to be tagged are adopted
+	delete(stub.addresses, "eipalloc-2")
+	stub.natGateways["nat-2"].Tags = nil
+	stub.natGateways["nat-2"].State = aws.String(ec2.NatGatewayStateDeleted)
+	stub.addresses["eipalloc-3"] = &ec2.Address{AllocationId: aws.String("eipalloc-3"), PublicIp: aws.String("52.0.0.3"), Tags: staticEgressTags(cluster, "eu-central-1b")}
+	stub.natGateways["nat-3"] = &ec2.NatGateway{
+		NatGatewayId:        aws.String("nat-3"),
+		SubnetId:            aws.String("subnet-b"),
+		State:               aws.String(ec2.NatGatewayStateAvailable),
+		NatGatewayAddresses: []*ec2.NatGatewayAddress{{AllocationId: aws.String("eipalloc-3")}},
+	}
+	err = adapter.ensureStaticEgress(context.Background(), logger, cluster)
+	require.NoError(t, err)
+	require.Len(t, stub.natGateways, 3)
+	require.Equal(t, "eu-central-1b", tagsToMap(stub.natGateways["nat-3"].Tags)[staticEgressZoneTagKey])
+
+	// the static egress is deleted even if it was disabled
+	cluster.ConfigItems = map[string]string{}
+	err = adapter.deleteStaticEgress(context.Background(), logger, cluster)
+	require.NoError(t, err)
+	require.Empty(t, stub.addresses)
+	require.Len(t, stub.released, 2)
+	for _, natGateway := range stub.natGateways {
+		require.Equal(t, ec2.NatGatewayStateDeleted, aws.StringValue(natGateway.State))
+	}
+}
+
+func TestStaticEgressDisabled(t *testing.T) {
+	stub := newEC2StaticEgressAPIStub()
+	adapter := &awsAdapter{ec2Client: stub}
+
+	err := adapter.ensureStaticEgress(context.Background(), log.WithField("cluster", "kube-1"), &api.Cluster{ID: "kube-1"})
+	require.NoError(t, err)
+	require.Empty(t, stub.addresses)
+	require.Empty(t, stub.natGateways)
+}
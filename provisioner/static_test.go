@@ -0,0 +1,47 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestStaticUserData(t *testing.T) {
+	channelPath, err := ioutil.TempDir("", "static-user-data")
+	require.NoError(t, err)
+	defer os.RemoveAll(channelPath)
+
+	profilePath := path.Join(channelPath, "cluster", "node-pools", "worker-default")
+	require.NoError(t, os.MkdirAll(profilePath, 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(profilePath, userDataFileName), []byte(`passwd:
+  users:
+    - name: {{ .NodePool.Name }}
+`), 0644))
+
+	cluster := &api.Cluster{ID: "cluster-1"}
+	userData, err := staticUserData(cluster, &api.NodePool{Name: "default-worker", Profile: "worker-default"}, channelPath, nil)
+	require.NoError(t, err)
+	require.Contains(t, userData, `"name":"default-worker"`)
+
+	// profiles without user data have an empty configuration
+	userData, err = staticUserData(cluster, &api.NodePool{Name: "gpu", Profile: "worker-gpu"}, channelPath, nil)
+	require.NoError(t, err)
+	require.Empty(t, userData)
+}
+
+func TestStaticProvisioner(t *testing.T) {
+	p := &staticProvisioner{clusterpyProvisioner: &clusterpyProvisioner{}}
+	require.True(t, p.Supports(&api.Cluster{Provider: staticProviderID}))
+	require.False(t, p.Supports(&api.Cluster{Provider: openstackProviderID}))
+
+	_, err := p.prepareStatic(log.WithField("test", true), &api.Cluster{Provider: providerID}, nil, nil)
+	require.Equal(t, ErrProviderNotSupported, err)
+
+	_, err = p.staticUpdateStrategy(log.WithField("test", true), &api.Cluster{ConfigItems: map[string]string{configKeyNodePoolBackend: "asg"}}, "", nil, nil)
+	require.Error(t, err)
+}
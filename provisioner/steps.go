@@ -0,0 +1,111 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+)
+
+// ApplyManifests renders and applies the manifests of the cluster without
+// touching its stacks and node pools.
+func (p *clusterpyProvisioner) ApplyManifests(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (err error) {
+	logger = logging.WithModule(logger, "provisioner")
+	ctx, span := p.tracer.Start(ctx, auditOperationApplyManifests, traceAttributes(cluster, auditOperationApplyManifests))
+	defer func() { span.End(err) }()
+
+	auditLog := p.newAuditLog(cluster, auditOperationApplyManifests)
+	adapter, _, _, err := p.prepareProvision(logger, cluster, channelConfig, auditLog)
+	if err != nil {
+		return err
+	}
+	defer p.storeAuditLog(logger, cluster, auditLog)
+
+	adapter.kubectl, err = p.clusterKubectl(logger, cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	return p.apply(ctx, logger.WithField(logging.FieldStep, "manifests"), adapter, cluster, path.Join(channelConfig.Path, manifestsPath))
+}
+
+// UpdateNodePool provisions the stack of a single node pool of the cluster
+// and rolls its nodes, unless the cluster is in apply only mode.
+func (p *clusterpyProvisioner) UpdateNodePool(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, name string) (err error) {
+	logger = logging.WithModule(logger, "provisioner")
+	attributes := traceAttributes(cluster, auditOperationUpdateNodePool)
+	attributes["node_pool"] = name
+	ctx, span := p.tracer.Start(ctx, auditOperationUpdateNodePool, attributes)
+	defer func() { span.End(err) }()
+
+	// the node pools of hibernated clusters stay hibernated.
+	hibernate, err := p.hibernate(logger, cluster)
+	if err != nil {
+		return err
+	}
+	poolCluster := nodePoolCluster(cluster, hibernate)
+
+	var nodePool *api.NodePool
+	for _, pool := range getNonLegacyNodePools(poolCluster) {
+		if pool.Name == name {
+			nodePool = pool
+		}
+	}
+	if nodePool == nil {
+		if hibernate {
+			return fmt.Errorf("node pool %s not found in hibernated cluster %s", name, cluster.ID)
+		}
+		return fmt.Errorf("node pool %s not found in cluster %s", name, cluster.ID)
+	}
+
+	auditLog := p.newAuditLog(cluster, auditOperationUpdateNodePool)
+	adapter, updater, nodePoolManager, err := p.prepareProvision(logger, cluster, channelConfig, auditLog)
+	if err != nil {
+		return err
+	}
+	defer p.storeAuditLog(logger, cluster, auditLog)
+
+	nodePoolProvisioner := newNodePoolProvisioner(logger.WithField(logging.FieldStep, "node-pools"), adapter, nodePoolManager, poolCluster, channelConfig, p.httpConfig)
+
+	values, err := p.clusterValues(adapter, cluster, channelConfig.Path)
+	if err != nil {
+		return err
+	}
+
+	err = nodePoolProvisioner.ProvisionNodePool(ctx, values.Values, nodePool)
+	if err != nil {
+		return err
+	}
+
+	options, err := p.clusterOptions(cluster)
+	if err != nil {
+		return err
+	}
+
+	if options.applyOnly {
+		logger.Infof("Apply only mode, skipping the update of the nodes")
+		return nil
+	}
+
+	return p.updateNodePools(ctx, logger.WithField(logging.FieldStep, "node-pool-update"), adapter, updater, nodePoolProvisioner, values.Values, cluster, []*api.NodePool{nodePool})
+}
+
+// clusterKubectl returns the kubectl binary matching the version of the
+// cluster's API server.
+func (p *clusterpyProvisioner) clusterKubectl(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (string, error) {
+	client, err := p.apiServerClient(cluster)
+	if err != nil {
+		return "", err
+	}
+
+	apiServerVersion, err := probeAPIServer(client, cluster.APIServerURL)
+	if err != nil {
+		return "", err
+	}
+
+	return p.kubectlBinary(logger, channelConfig, apiServerVersion.GitVersion)
+}
@@ -0,0 +1,25 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+func TestUpdateNodePoolNotFound(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:       "aws:123456789012:eu-central-1:kube-1",
+		Provider: providerID,
+		NodePools: []*api.NodePool{
+			{Name: "default-worker"},
+		},
+	}
+
+	err := (&clusterpyProvisioner{}).UpdateNodePool(context.Background(), log.WithField("test", true), cluster, &channel.Config{}, "unknown")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "node pool unknown not found")
+}
@@ -0,0 +1,98 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// maxResourceTags is the number of tags AWS allows on an EC2 resource.
+	maxResourceTags = 50
+	// resourceTagsHeadroom is the number of free tags below which a
+	// warning is logged for a subnet, as every cluster sharing it needs
+	// one.
+	resourceTagsHeadroom = 5
+)
+
+// subnetClusters returns the lifecycle of every cluster sharing or owning
+// the subnet, keyed by cluster ID, from its kubernetes.io/cluster/<id> tags.
+func subnetClusters(subnet *ec2.Subnet) map[string]string {
+	clusters := make(map[string]string)
+	for _, tag := range subnet.Tags {
+		key := aws.StringValue(tag.Key)
+		if strings.HasPrefix(key, tagNameKubernetesClusterPrefix) {
+			clusters[strings.TrimPrefix(key, tagNameKubernetesClusterPrefix)] = aws.StringValue(tag.Value)
+		}
+	}
+	return clusters
+}
+
+// otherSubnetClusters returns the sorted IDs of the clusters other than the
+// cluster tagged on the subnet.
+func otherSubnetClusters(subnet *ec2.Subnet, cluster *api.Cluster) []string {
+	var others []string
+	for id := range subnetClusters(subnet) {
+		if id != cluster.ID {
+			others = append(others, id)
+		}
+	}
+	sort.Strings(others)
+	return others
+}
+
+// reconcileSubnetTag tags the subnet as shared by the cluster unless it's
+// already tagged for it, including subnets owned by the cluster whose tag
+// must not be downgraded. It fails if the subnet can't take another tag and
+// warns if it runs out of tags.
+func reconcileSubnetTag(logger *log.Entry, adapter *awsAdapter, subnet *ec2.Subnet, cluster *api.Cluster) error {
+	subnetID := aws.StringValue(subnet.SubnetId)
+	if _, ok := subnetClusters(subnet)[cluster.ID]; ok {
+		return nil
+	}
+
+	tags := len(subnet.Tags) + 1
+	if tags > maxResourceTags {
+		return fmt.Errorf("unable to tag subnet %s for cluster %s: it already has %d tags, shared by clusters: %s", subnetID, cluster.ID, len(subnet.Tags), strings.Join(otherSubnetClusters(subnet, cluster), ", "))
+	}
+	if tags > maxResourceTags-resourceTagsHeadroom {
+		logger.Warnf("Subnet %s has %d of %d tags, shared by %d other clusters", subnetID, tags, maxResourceTags, len(otherSubnetClusters(subnet, cluster)))
+	}
+
+	return adapter.CreateTags(subnetID, []*ec2.Tag{
+		{
+			Key:   aws.String(tagNameKubernetesClusterPrefix + cluster.ID),
+			Value: aws.String(resourceLifecycleShared),
+		},
+	})
+}
+
+// releaseSubnetTag removes the tag sharing the subnet with the cluster. The
+// tags of other clusters and the tag of a subnet owned by the cluster, which
+// is removed with the stack creating it, are kept.
+func releaseSubnetTag(logger *log.Entry, adapter *awsAdapter, subnet *ec2.Subnet, cluster *api.Cluster) error {
+	if subnetClusters(subnet)[cluster.ID] != resourceLifecycleShared {
+		return nil
+	}
+
+	subnetID := aws.StringValue(subnet.SubnetId)
+	err := adapter.DeleteTags(subnetID, []*ec2.Tag{
+		{
+			Key:   aws.String(tagNameKubernetesClusterPrefix + cluster.ID),
+			Value: aws.String(resourceLifecycleShared),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if others := otherSubnetClusters(subnet, cluster); len(others) > 0 {
+		logger.Infof("Subnet %s is still shared by clusters: %s", subnetID, strings.Join(others, ", "))
+	}
+	return nil
+}
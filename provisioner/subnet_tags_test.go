@@ -0,0 +1,89 @@
+package provisioner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type ec2SubnetTagsAPIStub struct {
+	ec2API
+	created []string
+	deleted []string
+}
+
+func (e *ec2SubnetTagsAPIStub) CreateTags(input *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	for _, tag := range input.Tags {
+		e.created = append(e.created, aws.StringValue(input.Resources[0])+" "+aws.StringValue(tag.Key)+"="+aws.StringValue(tag.Value))
+	}
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func (e *ec2SubnetTagsAPIStub) DeleteTags(input *ec2.DeleteTagsInput) (*ec2.DeleteTagsOutput, error) {
+	for _, tag := range input.Tags {
+		e.deleted = append(e.deleted, aws.StringValue(input.Resources[0])+" "+aws.StringValue(tag.Key))
+	}
+	return &ec2.DeleteTagsOutput{}, nil
+}
+
+func clusterTaggedSubnet(id string, clusters map[string]string) *ec2.Subnet {
+	subnet := &ec2.Subnet{SubnetId: aws.String(id)}
+	for cluster, lifecycle := range clusters {
+		subnet.Tags = append(subnet.Tags, &ec2.Tag{Key: aws.String(tagNameKubernetesClusterPrefix + cluster), Value: aws.String(lifecycle)})
+	}
+	return subnet
+}
+
+func TestSubnetClusters(t *testing.T) {
+	subnet := clusterTaggedSubnet("subnet-a", map[string]string{"kube-1": resourceLifecycleShared, "kube-2": resourceLifecycleOwned})
+	subnet.Tags = append(subnet.Tags, &ec2.Tag{Key: aws.String(subnetELBRoleTagName), Value: aws.String("1")})
+
+	require.Equal(t, map[string]string{"kube-1": resourceLifecycleShared, "kube-2": resourceLifecycleOwned}, subnetClusters(subnet))
+	require.Equal(t, []string{"kube-2"}, otherSubnetClusters(subnet, &api.Cluster{ID: "kube-1"}))
+}
+
+func TestReconcileSubnetTag(t *testing.T) {
+	logger := log.WithField("cluster", "kube-1")
+	cluster := &api.Cluster{ID: "kube-1"}
+	stub := &ec2SubnetTagsAPIStub{}
+	adapter := &awsAdapter{ec2Client: stub}
+
+	// subnets shared with other clusters are tagged
+	err := reconcileSubnetTag(logger, adapter, clusterTaggedSubnet("subnet-a", map[string]string{"kube-2": resourceLifecycleShared}), cluster)
+	require.NoError(t, err)
+
+	// the tag of owned subnets isn't changed
+	err = reconcileSubnetTag(logger, adapter, clusterTaggedSubnet("subnet-b", map[string]string{"kube-1": resourceLifecycleOwned}), cluster)
+	require.NoError(t, err)
+	require.Equal(t, []string{"subnet-a kubernetes.io/cluster/kube-1=shared"}, stub.created)
+
+	full := make(map[string]string)
+	for i := 0; i < maxResourceTags; i++ {
+		full[fmt.Sprintf("kube-%d", i+2)] = resourceLifecycleShared
+	}
+	err = reconcileSubnetTag(logger, adapter, clusterTaggedSubnet("subnet-c", full), cluster)
+	require.Error(t, err)
+	require.Len(t, stub.created, 1)
+}
+
+func TestReleaseSubnetTag(t *testing.T) {
+	logger := log.WithField("cluster", "kube-1")
+	cluster := &api.Cluster{ID: "kube-1"}
+	stub := &ec2SubnetTagsAPIStub{}
+	adapter := &awsAdapter{ec2Client: stub}
+
+	for _, subnet := range []*ec2.Subnet{
+		clusterTaggedSubnet("subnet-a", map[string]string{"kube-1": resourceLifecycleShared, "kube-2": resourceLifecycleShared}),
+		clusterTaggedSubnet("subnet-b", map[string]string{"kube-1": resourceLifecycleOwned}),
+		clusterTaggedSubnet("subnet-c", map[string]string{"kube-2": resourceLifecycleShared}),
+	} {
+		err := releaseSubnetTag(logger, adapter, subnet, cluster)
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{"subnet-a kubernetes.io/cluster/kube-1"}, stub.deleted)
+}
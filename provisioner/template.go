@@ -34,6 +34,10 @@ type templateContext struct {
 	baseDir               string
 	computingManifestHash bool
 	readTemplate          func(string) ([]byte, error)
+	secrets               *secretsSource
+	capabilities          *clusterCapabilities
+	infrastructure        *infrastructureFacts
+	values                *ClusterValues
 }
 
 type podResources struct {
@@ -177,25 +181,43 @@ func effectiveQuantity(instanceResource int64, scale float64, reservedResource i
 	}
 }
 
+// templateFuncs returns the functions available in the template filePath
+// rendered with data.
+func templateFuncs(context *templateContext, filePath string, data interface{}) template.FuncMap {
+	return template.FuncMap{
+		"getAWSAccountID":              getAWSAccountID,
+		"base64":                       base64Encode,
+		"manifestHash":                 func(template string) (string, error) { return manifestHash(context, filePath, template, data) },
+		"autoscalingBufferSettings":    autoscalingBufferSettings,
+		"asgSize":                      asgSize,
+		"azID":                         azID,
+		"azCount":                      azCount,
+		"split":                        split,
+		"ssmParameter":                 context.secrets.ssmParameter,
+		"secretsManagerSecret":         context.secrets.secretsManagerSecret,
+		"ssmParameterInRegion":         context.secrets.ssmParameterInRegion,
+		"secretsManagerSecretInRegion": context.secrets.secretsManagerSecretInRegion,
+		"secondaryRegions":             secondaryRegions,
+		"gpuNodePools":                 gpuNodePools,
+		"apiServerNames":               apiServerNames,
+		"hasAPIVersion":                context.capabilities.hasAPIVersion,
+		"hasKind":                      context.capabilities.hasKind,
+		"hasCRD":                       context.capabilities.hasCRD,
+		"serverVersion":                context.capabilities.serverVersion,
+		"serverVersionAtLeast":         context.capabilities.serverVersionAtLeast,
+		"infrastructure":               context.infrastructure.facts,
+		"values":                       context.values.values,
+	}
+}
+
 // renderTemplate takes a fileName of a template and the model to apply to it.
 // returns the transformed template or an error if not successful
 func renderTemplate(context *templateContext, filePath string, data interface{}) (string, error) {
-	funcMap := template.FuncMap{
-		"getAWSAccountID":           getAWSAccountID,
-		"base64":                    base64Encode,
-		"manifestHash":              func(template string) (string, error) { return manifestHash(context, filePath, template, data) },
-		"autoscalingBufferSettings": autoscalingBufferSettings,
-		"asgSize":                   asgSize,
-		"azID":                      azID,
-		"azCount":                   azCount,
-		"split":                     split,
-	}
-
 	content, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return "", err
 	}
-	t, err := template.New(filePath).Option("missingkey=error").Funcs(funcMap).Parse(string(content))
+	t, err := template.New(filePath).Option("missingkey=error").Funcs(templateFuncs(context, filePath, data)).Parse(string(content))
 	if err != nil {
 		return "", err
 	}
@@ -245,11 +267,16 @@ func manifestHash(context *templateContext, file string, template string, data i
 }
 
 // getAWSAccountID is an utility function for the gotemplate that will remove
-// the prefix "aws" from the infrastructure ID.
+// the prefix "aws" from the infrastructure ID. Infrastructure IDs without an
+// account ID are an error.
 // TODO: get the real AWS account ID from the `external_id` field of the
 // infrastructure account in the cluster registry.
-func getAWSAccountID(ia string) string {
-	return strings.Split(ia, ":")[1]
+func getAWSAccountID(ia string) (string, error) {
+	parts := strings.Split(ia, ":")
+	if len(parts) < 2 || parts[1] == "" {
+		return "", fmt.Errorf("invalid infrastructure account: %s", ia)
+	}
+	return parts[1], nil
 }
 
 // base64Encode base64 encodes a string.
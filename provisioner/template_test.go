@@ -313,3 +313,22 @@ func TestAZCountNoSubnets(t *testing.T) {
 	require.NoError(t, err)
 	require.EqualValues(t, "0", result)
 }
+
+func TestGPUNodePools(t *testing.T) {
+	result, err := renderSingle(
+		t,
+		`{{ range gpuNodePools .NodePools }}{{ .Name }} {{ .GPU }} {{ .Accelerator }} {{ .TaintKey }}={{ .TaintValue }}:{{ .TaintEffect }}{{ end }}`,
+		exampleCluster([]*api.NodePool{
+			{
+				InstanceType: "m4.large",
+				Name:         "worker-default",
+			},
+			{
+				InstanceType: "p2.xlarge",
+				Name:         "worker-gpu",
+			},
+		}))
+
+	require.NoError(t, err)
+	require.EqualValues(t, "worker-gpu 1 gpu nvidia.com/gpu=present:NoSchedule", result)
+}
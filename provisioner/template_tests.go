@@ -0,0 +1,320 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// templateTestsDir is the directory of the channel containing one
+	// directory per template test.
+	templateTestsDir        = "tests"
+	templateTestClusterFile = "cluster.yaml"
+	templateTestAssertFile  = "assertions.yaml"
+	templateTestExpectedDir = "expected"
+	templateTestAccount     = "123456789012"
+	templateTestRegion      = "eu-central-1"
+)
+
+// TemplateTestReport is the result of running the template tests of a
+// channel.
+type TemplateTestReport struct {
+	Passed int                   `json:"passed"`
+	Failed int                   `json:"failed"`
+	Tests  []*TemplateTestResult `json:"tests"`
+}
+
+// TemplateTestResult is the result of a single template test.
+type TemplateTestResult struct {
+	Name     string   `json:"name"`
+	Passed   bool     `json:"passed"`
+	Duration string   `json:"duration"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// templateAssertion checks a single file rendered by a template test. The
+// file is relative to the render directory, e.g.
+// manifests/<component>/<file>.
+type templateAssertion struct {
+	File        string `yaml:"file"`
+	Contains    string `yaml:"contains"`
+	NotContains string `yaml:"not_contains"`
+	Matches     string `yaml:"matches"`
+	// Absent asserts that the file isn't rendered, e.g. for disabled
+	// components.
+	Absent bool `yaml:"absent"`
+}
+
+// RunTemplateTests runs the template tests of the channel. Every test is a
+// directory below tests/ containing a cluster.yaml with the cluster to render
+// the templates for and the expected output: an expected/ directory with
+// files which must match the rendered ones and an assertions.yaml with
+// assertions about the rendered files. The templates are rendered offline so
+// neither AWS nor a cluster is needed. An error is only returned if the
+// tests can't be run, failing tests are reported in the TemplateTestReport.
+func RunTemplateTests(ctx context.Context, logger *log.Entry, renderer StepProvisioner, channelConfig *channel.Config) (*TemplateTestReport, error) {
+	testsDir := path.Join(channelConfig.Path, templateTestsDir)
+	files, err := ioutil.ReadDir(testsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the template tests: %v", err)
+	}
+
+	report := &TemplateTestReport{}
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+
+		testLogger := logger.WithField("test", file.Name())
+		start := time.Now()
+		failures := runTemplateTest(ctx, testLogger, renderer, channelConfig, file.Name(), path.Join(testsDir, file.Name()))
+
+		result := &TemplateTestResult{
+			Name:     file.Name(),
+			Passed:   len(failures) == 0,
+			Duration: time.Since(start).String(),
+			Failures: failures,
+		}
+		if result.Passed {
+			report.Passed++
+			testLogger.Infof("Template test %s passed", file.Name())
+		} else {
+			report.Failed++
+			testLogger.Errorf("Template test %s failed: %s", file.Name(), strings.Join(failures, "; "))
+		}
+		report.Tests = append(report.Tests, result)
+	}
+
+	if len(report.Tests) == 0 {
+		return nil, fmt.Errorf("no template tests found in %s", testsDir)
+	}
+	return report, nil
+}
+
+// runTemplateTest renders the templates for the cluster of the test and
+// returns the failed checks.
+func runTemplateTest(ctx context.Context, logger *log.Entry, renderer StepProvisioner, channelConfig *channel.Config, name, dir string) []string {
+	cluster, err := templateTestCluster(name, path.Join(dir, templateTestClusterFile))
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	renderDir, err := ioutil.TempDir("", "template-test-"+name)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	defer os.RemoveAll(renderDir)
+
+	err = renderer.Render(ctx, logger, cluster, channelConfig, &RenderOptions{Dir: renderDir, Offline: true})
+	if err != nil {
+		return []string{fmt.Sprintf("failed to render templates: %v", err)}
+	}
+
+	failures, err := compareExpected(path.Join(dir, templateTestExpectedDir), renderDir)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	assertions, err := templateTestAssertions(path.Join(dir, templateTestAssertFile))
+	if err != nil {
+		return append(failures, err.Error())
+	}
+
+	for _, assertion := range assertions {
+		failure := assertion.check(renderDir)
+		if failure != "" {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+// templateTestCluster reads the cluster of a template test. The identifiers
+// of the cluster are derived from the name of the test unless specified.
+func templateTestCluster(name, file string) (*api.Cluster, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cluster: %v", err)
+	}
+
+	var cluster api.Cluster
+	err = yaml.Unmarshal(data, &cluster)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the cluster: %v", err)
+	}
+
+	if cluster.Region == "" {
+		cluster.Region = templateTestRegion
+	}
+	if cluster.InfrastructureAccount == "" {
+		cluster.InfrastructureAccount = "aws:" + templateTestAccount
+	}
+	if cluster.LocalID == "" {
+		cluster.LocalID = name
+	}
+	if cluster.ID == "" {
+		cluster.ID = fmt.Sprintf("%s:%s:%s", cluster.InfrastructureAccount, cluster.Region, cluster.LocalID)
+	}
+	if cluster.APIServerURL == "" {
+		cluster.APIServerURL = fmt.Sprintf("https://%s.example.org", cluster.LocalID)
+	}
+	if cluster.Provider == "" {
+		cluster.Provider = providerID
+	}
+	if cluster.ConfigItems == nil {
+		cluster.ConfigItems = make(map[string]string)
+	}
+	for _, nodePool := range cluster.NodePools {
+		if nodePool.ConfigItems == nil {
+			nodePool.ConfigItems = make(map[string]string)
+		}
+	}
+	return &cluster, nil
+}
+
+// templateTestAssertions reads the assertions of a template test if there
+// are any.
+func templateTestAssertions(file string) ([]*templateAssertion, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read the assertions: %v", err)
+	}
+
+	var assertions []*templateAssertion
+	err = yaml.Unmarshal(data, &assertions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the assertions: %v", err)
+	}
+	return assertions, nil
+}
+
+// compareExpected compares the files of the expected directory with the
+// rendered ones. Leading and trailing whitespace is ignored.
+func compareExpected(expectedDir, renderDir string) ([]string, error) {
+	if _, err := os.Stat(expectedDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var files []string
+	err := filepath.Walk(expectedDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the expected files: %v", err)
+	}
+	sort.Strings(files)
+
+	var failures []string
+	for _, file := range files {
+		rel, err := filepath.Rel(expectedDir, file)
+		if err != nil {
+			return nil, err
+		}
+
+		expected, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the expected file %s: %v", rel, err)
+		}
+
+		rendered, err := ioutil.ReadFile(filepath.Join(renderDir, rel))
+		if err != nil {
+			if os.IsNotExist(err) {
+				failures = append(failures, fmt.Sprintf("%s: not rendered", rel))
+				continue
+			}
+			return nil, err
+		}
+
+		diff := firstDifference(strings.TrimSpace(string(expected)), strings.TrimSpace(string(rendered)))
+		if diff != "" {
+			failures = append(failures, fmt.Sprintf("%s: %s", rel, diff))
+		}
+	}
+	return failures, nil
+}
+
+// firstDifference describes the first line differing between the expected
+// and the rendered content or returns an empty string if they're equal.
+func firstDifference(expected, rendered string) string {
+	if expected == rendered {
+		return ""
+	}
+
+	expectedLines := strings.Split(expected, "\n")
+	renderedLines := strings.Split(rendered, "\n")
+	for i := 0; i < len(expectedLines) || i < len(renderedLines); i++ {
+		var expectedLine, renderedLine string
+		if i < len(expectedLines) {
+			expectedLine = expectedLines[i]
+		}
+		if i < len(renderedLines) {
+			renderedLine = renderedLines[i]
+		}
+		if expectedLine != renderedLine {
+			return fmt.Sprintf("line %d: expected %q, got %q", i+1, expectedLine, renderedLine)
+		}
+	}
+	return ""
+}
+
+// check returns a description of the failure if the rendered file doesn't
+// satisfy the assertion.
+func (a *templateAssertion) check(renderDir string) string {
+	if a.File == "" {
+		return "assertion without file"
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(renderDir, a.File))
+	if err != nil {
+		if os.IsNotExist(err) {
+			if a.Absent {
+				return ""
+			}
+			return fmt.Sprintf("%s: not rendered", a.File)
+		}
+		return fmt.Sprintf("%s: %v", a.File, err)
+	}
+	content := string(data)
+
+	if a.Absent {
+		return fmt.Sprintf("%s: rendered, expected it to be absent", a.File)
+	}
+	if a.Contains != "" && !strings.Contains(content, a.Contains) {
+		return fmt.Sprintf("%s: doesn't contain %q", a.File, a.Contains)
+	}
+	if a.NotContains != "" && strings.Contains(content, a.NotContains) {
+		return fmt.Sprintf("%s: contains %q", a.File, a.NotContains)
+	}
+	if a.Matches != "" {
+		re, err := regexp.Compile(a.Matches)
+		if err != nil {
+			return fmt.Sprintf("%s: invalid expression %q: %v", a.File, a.Matches, err)
+		}
+		if !re.MatchString(content) {
+			return fmt.Sprintf("%s: doesn't match %q", a.File, a.Matches)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package provisioner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+// templateRendererStub renders the content config item of the cluster as
+// manifests/component/manifest.yaml.
+type templateRendererStub struct{}
+
+func (r *templateRendererStub) ApplyManifests(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) error {
+	return nil
+}
+
+func (r *templateRendererStub) UpdateNodePool(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, nodePool string) error {
+	return nil
+}
+
+func (r *templateRendererStub) Values(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, offline bool) (*ClusterValues, error) {
+	return nil, nil
+}
+
+func (r *templateRendererStub) Render(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, options *RenderOptions) error {
+	file := filepath.Join(options.Dir, "manifests", "component", "manifest.yaml")
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, []byte(cluster.ConfigItems["content"]+"\n"), 0600)
+}
+
+func writeTemplateTestFile(t *testing.T, file, content string) {
+	require.NoError(t, os.MkdirAll(path.Dir(file), 0755))
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+}
+
+func TestRunTemplateTests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "template-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testsDir := path.Join(dir, templateTestsDir)
+	writeTemplateTestFile(t, path.Join(testsDir, "expected", templateTestClusterFile), "config_items:\n  content: foo\n")
+	writeTemplateTestFile(t, path.Join(testsDir, "expected", templateTestExpectedDir, "manifests/component/manifest.yaml"), "foo")
+	writeTemplateTestFile(t, path.Join(testsDir, "assertions", templateTestClusterFile), "config_items:\n  content: bar\n")
+	writeTemplateTestFile(t, path.Join(testsDir, "assertions", templateTestAssertFile), `
+- file: manifests/component/manifest.yaml
+  contains: bar
+- file: manifests/component/manifest.yaml
+  matches: "^b.r"
+- file: manifests/disabled/manifest.yaml
+  absent: true
+`)
+	writeTemplateTestFile(t, path.Join(testsDir, "failing", templateTestClusterFile), "config_items:\n  content: bar\n")
+	writeTemplateTestFile(t, path.Join(testsDir, "failing", templateTestExpectedDir, "manifests/component/manifest.yaml"), "foo")
+	writeTemplateTestFile(t, path.Join(testsDir, "failing", templateTestExpectedDir, "manifests/component/missing.yaml"), "foo")
+	writeTemplateTestFile(t, path.Join(testsDir, "failing", templateTestAssertFile), `
+- file: manifests/component/manifest.yaml
+  not_contains: bar
+`)
+
+	report, err := RunTemplateTests(context.Background(), log.WithFields(log.Fields{}), &templateRendererStub{}, &channel.Config{Path: dir})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Passed)
+	require.Equal(t, 1, report.Failed)
+
+	require.Equal(t, "assertions", report.Tests[0].Name)
+	require.True(t, report.Tests[0].Passed)
+	require.Equal(t, "expected", report.Tests[1].Name)
+	require.True(t, report.Tests[1].Passed)
+	require.Equal(t, "failing", report.Tests[2].Name)
+	require.Equal(t, []string{
+		`manifests/component/manifest.yaml: line 1: expected "foo", got "bar"`,
+		"manifests/component/missing.yaml: not rendered",
+		`manifests/component/manifest.yaml: contains "bar"`,
+	}, report.Tests[2].Failures)
+
+	_, err = RunTemplateTests(context.Background(), log.WithFields(log.Fields{}), &templateRendererStub{}, &channel.Config{Path: path.Join(dir, "missing")})
+	require.Error(t, err)
+}
+
+func TestTemplateTestCluster(t *testing.T) {
+	dir, err := ioutil.TempDir("", "template-test-cluster")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, templateTestClusterFile)
+	writeTemplateTestFile(t, file, "node_pools:\n- name: default-worker\n  profile: worker-default\n")
+
+	cluster, err := templateTestCluster("kube-1", file)
+	require.NoError(t, err)
+	require.Equal(t, "aws:123456789012:eu-central-1:kube-1", cluster.ID)
+	require.Equal(t, "kube-1", cluster.LocalID)
+	require.Equal(t, "https://kube-1.example.org", cluster.APIServerURL)
+	require.Equal(t, providerID, cluster.Provider)
+	require.NotNil(t, cluster.ConfigItems)
+	require.NotNil(t, cluster.NodePools[0].ConfigItems)
+
+	writeTemplateTestFile(t, file, "node_pools: {")
+	_, err = templateTestCluster("kube-1", file)
+	require.Error(t, err)
+}
@@ -0,0 +1,23 @@
+package provisioner
+
+import "github.com/zalando-incubator/cluster-lifecycle-manager/api"
+
+const (
+	// ConfigKeyUrgentUpdate is the config item marking the update of a
+	// cluster to a channel version as urgent, e.g. for security patches.
+	// The controller only passes it on to the provisioner while the cluster
+	// is updated to that version.
+	ConfigKeyUrgentUpdate = "urgent_update"
+	// ConfigKeyUrgentUpdateReason is the config item explaining why an
+	// update is urgent.
+	ConfigKeyUrgentUpdateReason = "urgent_update_reason"
+	// ConfigKeyUrgentUpdateBy is the config item naming who triggered an
+	// urgent update.
+	ConfigKeyUrgentUpdateBy = "urgent_update_by"
+)
+
+// urgentUpdate returns true if the cluster is provisioned as part of an
+// urgent update.
+func urgentUpdate(cluster *api.Cluster) bool {
+	return cluster.ConfigItems[ConfigKeyUrgentUpdate] != ""
+}
@@ -0,0 +1,437 @@
+package provisioner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	ignitionUserDataFileName = "userdata.ign.json"
+	cloudInitUserDataDir     = "userdata.d"
+	// cloudInitUserDataFileName is the name of the composed cloud-init
+	// user data written when rendering node pools.
+	cloudInitUserDataFileName = "userdata.mime"
+
+	userDataFormatCLC       = "clc"
+	userDataFormatIgnition  = "ignition"
+	userDataFormatCloudInit = "cloud-init"
+
+	// maxEC2UserDataSize is the maximum size of the user data of EC2
+	// instances before base64 encoding.
+	maxEC2UserDataSize = 16 * 1024
+
+	nodePoolConfigKeyIgnitionConfigURL      = "ignition_config_url"
+	nodePoolConfigKeyIgnitionCompression    = "ignition_compression"
+	nodePoolConfigKeyIgnitionPresignedValid = "ignition_presigned_url_validity"
+
+	ignitionConfigURLS3        = "s3"
+	ignitionConfigURLPresigned = "presigned"
+	ignitionCompressionGzip    = "gzip"
+	// maxPresignedURLValidity is the maximum validity of presigned URLs
+	// supported by S3.
+	maxPresignedURLValidity = 7 * 24 * time.Hour
+)
+
+// cloudInitContentTypes are the content types of the cloud-init parts by
+// file extension.
+var cloudInitContentTypes = map[string]string{
+	".sh":       "text/x-shellscript",
+	".yaml":     "text/cloud-config",
+	".yml":      "text/cloud-config",
+	".boothook": "text/cloud-boothook",
+}
+
+// nodePoolUserData is the user data of a node pool rendered from its
+// profile.
+type nodePoolUserData struct {
+	format string
+	// source is the rendered user data file of the profile, or the
+	// composed multipart message for cloud-init.
+	source string
+}
+
+// fileName returns the name of the file the user data is written to when
+// rendering node pools.
+func (u *nodePoolUserData) fileName() string {
+	switch u.format {
+	case userDataFormatIgnition:
+		return ignitionUserDataFileName
+	case userDataFormatCloudInit:
+		return cloudInitUserDataFileName
+	default:
+		return userDataFileName
+	}
+}
+
+// ignition returns the Ignition config of the user data and its spec
+// version. Container Linux Configs are converted to Ignition.
+func (u *nodePoolUserData) ignition() ([]byte, string, error) {
+	data := []byte(u.source)
+	if u.format == userDataFormatCLC {
+		converted, err := clcToIgnition(data)
+		if err != nil {
+			return nil, "", err
+		}
+		data = converted
+	}
+
+	var config struct {
+		Ignition struct {
+			Version string `json:"version"`
+		} `json:"ignition"`
+	}
+	err := json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid Ignition config: %v", err)
+	}
+	if config.Ignition.Version == "" {
+		return nil, "", fmt.Errorf("invalid Ignition config: ignition.version is not set")
+	}
+	return data, config.Ignition.Version, nil
+}
+
+// ignitionPointer is an Ignition config replacing itself with a remote
+// config.
+type ignitionPointer struct {
+	Ignition struct {
+		Version string `json:"version"`
+		Config  struct {
+			Replace struct {
+				Source      string `json:"source"`
+				Compression string `json:"compression,omitempty"`
+			} `json:"replace"`
+		} `json:"config"`
+	} `json:"ignition"`
+}
+
+// ignitionPointerConfig returns the Ignition config replacing itself with the
+// config stored at source. Ignition only accepts configs of its own major
+// spec version, so the pointer uses the version of the stored config if it's
+// spec 3. Compressed configs require spec 3.1 or later.
+func ignitionPointerConfig(version, source, compression string) (string, error) {
+	major, minor := ignitionSpecVersion(version)
+	if compression != "" && (major < 3 || (major == 3 && minor < 1)) {
+		return "", fmt.Errorf("compressed Ignition configs require spec version 3.1 or later, got %s", version)
+	}
+
+	if major < 3 {
+		return fmt.Sprintf(ignitionBaseTemplate, source), nil
+	}
+
+	var pointer ignitionPointer
+	pointer.Ignition.Version = version
+	pointer.Ignition.Config.Replace.Source = source
+	pointer.Ignition.Config.Replace.Compression = compression
+
+	result, err := json.MarshalIndent(&pointer, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// ignitionSpecVersion returns the major and minor part of an Ignition spec
+// version like 3.1.0. Invalid parts are 0.
+func ignitionSpecVersion(version string) (int, int) {
+	parts := strings.SplitN(version, ".", 3)
+	major, _ := strconv.Atoi(parts[0])
+	var minor int
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(parts[1])
+	}
+	return major, minor
+}
+
+// ignitionHosting is how the Ignition config of a node pool is stored in S3
+// and referenced by its instances.
+type ignitionHosting struct {
+	// presigned references the config by a presigned HTTPS URL instead
+	// of its S3 URI, so the instances don't need access to the bucket.
+	presigned bool
+	validity  time.Duration
+	// compression is the compression of the stored config, if any.
+	compression string
+}
+
+// nodePoolIgnitionHosting returns the Ignition hosting of the node pool,
+// configured with the ignition_config_url, ignition_presigned_url_validity
+// and ignition_compression config items of the node pool.
+func nodePoolIgnitionHosting(nodePool *api.NodePool) (*ignitionHosting, error) {
+	hosting := &ignitionHosting{validity: maxPresignedURLValidity}
+
+	switch value := nodePool.ConfigItems[nodePoolConfigKeyIgnitionConfigURL]; value {
+	case "", ignitionConfigURLS3:
+	case ignitionConfigURLPresigned:
+		hosting.presigned = true
+	default:
+		return nil, fmt.Errorf("invalid value for %s: %s", nodePoolConfigKeyIgnitionConfigURL, value)
+	}
+
+	if value, ok := nodePool.ConfigItems[nodePoolConfigKeyIgnitionPresignedValid]; ok {
+		validity, err := time.ParseDuration(value)
+		if err != nil || validity <= 0 || validity > maxPresignedURLValidity {
+			return nil, fmt.Errorf("invalid value for %s: %s", nodePoolConfigKeyIgnitionPresignedValid, value)
+		}
+		hosting.validity = validity
+	}
+
+	switch value := nodePool.ConfigItems[nodePoolConfigKeyIgnitionCompression]; value {
+	case "":
+	case ignitionCompressionGzip:
+		hosting.compression = value
+	default:
+		return nil, fmt.Errorf("invalid value for %s: %s", nodePoolConfigKeyIgnitionCompression, value)
+	}
+
+	return hosting, nil
+}
+
+// presignUserData stores the user data in the bucket and returns its S3 URI
+// and a presigned URL valid for validity. The URL is signed at the time the
+// object was uploaded, so it stays the same on every run until the object is
+// uploaded again once half of the validity has passed.
+func (p *AWSNodePoolProvisioner) presignUserData(userData []byte, bucketName string, validity time.Duration) (string, string, error) {
+	objectName := userDataObjectName(userData)
+
+	uploaded, err := p.userDataUploadTime(bucketName, objectName)
+	if err != nil || time.Since(uploaded) >= validity/2 {
+		_, err = p.uploadUserDataToS3(userData, bucketName)
+		if err != nil {
+			return "", "", err
+		}
+
+		// planned user data isn't uploaded
+		uploaded = time.Now()
+		if p.awsAdapter.plan == nil {
+			uploaded, err = p.userDataUploadTime(bucketName, objectName)
+			if err != nil {
+				return "", "", err
+			}
+		}
+	}
+
+	req, _ := p.awsAdapter.s3Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+	})
+	// the signer uses the current time, sign with the upload time instead
+	req.Handlers.Sign.Swap(v4.SignRequestHandler.Name, request.NamedHandler{
+		Name: v4.SignRequestHandler.Name,
+		Fn: func(r *request.Request) {
+			v4.SignSDKRequestWithCurrentTime(r, func() time.Time { return uploaded })
+		},
+	})
+
+	url, err := req.Presign(validity)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to presign the user data URL: %v", err)
+	}
+	return fmt.Sprintf("s3://%s/%s", bucketName, objectName), url, nil
+}
+
+// userDataUploadTime returns the time the user data object was last uploaded.
+func (p *AWSNodePoolProvisioner) userDataUploadTime(bucketName, objectName string) (time.Time, error) {
+	head, err := p.awsAdapter.s3Client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return aws.TimeValue(head.LastModified), nil
+}
+
+// userDataFormat returns the format of the user data of the node pool
+// profile, selected by the file defining it: userdata.clc.yaml for a
+// Container Linux Config, userdata.ign.json for an Ignition config and a
+// userdata.d directory for the parts of a cloud-init multipart message.
+func userDataFormat(profilePath string) (string, error) {
+	var formats []string
+	for format, file := range map[string]string{
+		userDataFormatCLC:       userDataFileName,
+		userDataFormatIgnition:  ignitionUserDataFileName,
+		userDataFormatCloudInit: cloudInitUserDataDir,
+	} {
+		_, err := os.Stat(path.Join(profilePath, file))
+		if err == nil {
+			formats = append(formats, format)
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	switch len(formats) {
+	case 0:
+		return "", fmt.Errorf("node pool profile %s doesn't define user data", path.Base(profilePath))
+	case 1:
+		return formats[0], nil
+	default:
+		sort.Strings(formats)
+		return "", fmt.Errorf("node pool profile %s defines user data in several formats: %s", path.Base(profilePath), strings.Join(formats, ", "))
+	}
+}
+
+// renderUserData renders the user data of the node pool profile.
+func renderUserData(profilePath string, params *userDataParams) (*nodePoolUserData, error) {
+	format, err := userDataFormat(profilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	userData := &nodePoolUserData{format: format}
+	switch format {
+	case userDataFormatCloudInit:
+		userData.source, err = renderCloudInit(profilePath, params)
+	default:
+		userData.source, err = renderTemplate(newTemplateContext(profilePath), path.Join(profilePath, userData.fileName()), params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return userData, nil
+}
+
+// renderCloudInit renders the parts in the userdata.d directory of the
+// profile, in the order of their names, and composes them into a cloud-init
+// multipart message.
+func renderCloudInit(profilePath string, params *userDataParams) (string, error) {
+	partsPath := path.Join(profilePath, cloudInitUserDataDir)
+	files, err := ioutil.ReadDir(partsPath)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []*cloudInitPart
+	if part := instanceStoragePart(params.Values); part != nil {
+		parts = append(parts, part)
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		contentType, ok := cloudInitContentTypes[path.Ext(file.Name())]
+		if !ok {
+			return "", fmt.Errorf("unknown type of cloud-init part %s", file.Name())
+		}
+
+		content, err := renderTemplate(newTemplateContext(profilePath), path.Join(partsPath, file.Name()), params)
+		if err != nil {
+			return "", err
+		}
+
+		parts = append(parts, &cloudInitPart{fileName: file.Name(), contentType: contentType, content: content})
+	}
+
+	if len(parts) == 0 {
+		return "", fmt.Errorf("no cloud-init parts in %s", cloudInitUserDataDir)
+	}
+	return composeCloudInit(parts)
+}
+
+// cloudInitPart is a part of a cloud-init multipart message.
+type cloudInitPart struct {
+	fileName    string
+	contentType string
+	content     string
+}
+
+// composeCloudInit composes the parts into a MIME multipart message. The
+// boundary is derived from the parts so the same parts always result in the
+// same user data and don't roll the nodes.
+func composeCloudInit(parts []*cloudInitPart) (string, error) {
+	hasher := sha256.New()
+	for _, part := range parts {
+		hasher.Write([]byte(part.fileName))
+		hasher.Write([]byte(part.content))
+	}
+	boundary := "clm-" + hex.EncodeToString(hasher.Sum(nil))[:32]
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=\"%s\"\r\nMIME-Version: 1.0\r\n\r\n", boundary)
+
+	writer := multipart.NewWriter(&message)
+	err := writer.SetBoundary(boundary)
+	if err != nil {
+		return "", err
+	}
+
+	for _, part := range parts {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Type", part.contentType+"; charset=\"utf-8\"")
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", part.fileName))
+		header.Set("MIME-Version", "1.0")
+
+		partWriter, err := writer.CreatePart(header)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = partWriter.Write([]byte(part.content))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+	return message.String(), nil
+}
+
+// cloudInitUserData returns the cloud-init user data passed to the instances
+// as is. Messages exceeding the EC2 limit are gzip compressed, which
+// cloud-init detects.
+func cloudInitUserData(message string) ([]byte, error) {
+	if len(message) <= maxEC2UserDataSize {
+		return []byte(message), nil
+	}
+
+	compressed, err := gzipCompress([]byte(message))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(compressed) > maxEC2UserDataSize {
+		return nil, fmt.Errorf("cloud-init user data exceeds %d bytes after compression: %d", maxEC2UserDataSize, len(compressed))
+	}
+	return compressed, nil
+}
+
+// gzipCompress compresses the data with gzip. The header carries no
+// modification time, so the same data always results in the same output.
+func gzipCompress(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
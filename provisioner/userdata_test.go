@@ -0,0 +1,225 @@
+package provisioner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func newUserDataProfile(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "userdata")
+	require.NoError(t, err)
+
+	for file, content := range files {
+		err := os.MkdirAll(path.Dir(path.Join(dir, file)), 0755)
+		require.NoError(t, err)
+
+		err = ioutil.WriteFile(path.Join(dir, file), []byte(content), 0644)
+		require.NoError(t, err)
+	}
+	return dir
+}
+
+func TestUserDataFormat(t *testing.T) {
+	for _, tc := range []struct {
+		files  map[string]string
+		format string
+	}{
+		{files: map[string]string{userDataFileName: ""}, format: userDataFormatCLC},
+		{files: map[string]string{ignitionUserDataFileName: ""}, format: userDataFormatIgnition},
+		{files: map[string]string{"userdata.d/10-kubelet.sh": ""}, format: userDataFormatCloudInit},
+		{files: map[string]string{stackFileName: ""}},
+		{files: map[string]string{userDataFileName: "", ignitionUserDataFileName: ""}},
+	} {
+		profilePath := newUserDataProfile(t, tc.files)
+		format, err := userDataFormat(profilePath)
+		if tc.format == "" {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, tc.format, format)
+		}
+		os.RemoveAll(profilePath)
+	}
+}
+
+func TestRenderIgnitionUserData(t *testing.T) {
+	profilePath := newUserDataProfile(t, map[string]string{
+		ignitionUserDataFileName: `{"ignition": {"version": "3.0.0"}, "storage": {"files": [{"path": "/etc/hostname", "contents": {"source": "data:,{{.NodePool.Name}}"}}]}}`,
+	})
+	defer os.RemoveAll(profilePath)
+
+	userData, err := renderUserData(profilePath, &userDataParams{Cluster: &api.Cluster{}, NodePool: &api.NodePool{Name: "default-worker"}})
+	require.NoError(t, err)
+	require.Equal(t, ignitionUserDataFileName, userData.fileName())
+	require.Contains(t, userData.source, "data:,default-worker")
+
+	config, version, err := userData.ignition()
+	require.NoError(t, err)
+	require.Equal(t, "3.0.0", version)
+	require.Equal(t, userData.source, string(config))
+
+	for _, invalid := range []string{`{"ignition": {}}`, `ignition: {version: 3.0.0}`} {
+		_, _, err := (&nodePoolUserData{format: userDataFormatIgnition, source: invalid}).ignition()
+		require.Error(t, err, "%v", invalid)
+	}
+}
+
+func TestRenderCloudInitUserData(t *testing.T) {
+	profilePath := newUserDataProfile(t, map[string]string{
+		"userdata.d/20-kubelet.sh":    "#!/bin/sh\necho {{.NodePool.Name}}\n",
+		"userdata.d/10-config.yaml":   "#cloud-config\nhostname: node\n",
+		"userdata.d/files/ignored.sh": "",
+	})
+	defer os.RemoveAll(profilePath)
+
+	params := &userDataParams{Cluster: &api.Cluster{}, NodePool: &api.NodePool{Name: "default-worker"}}
+	userData, err := renderUserData(profilePath, params)
+	require.NoError(t, err)
+	require.Equal(t, cloudInitUserDataFileName, userData.fileName())
+
+	// the message only depends on the parts
+	again, err := renderUserData(profilePath, params)
+	require.NoError(t, err)
+	require.Equal(t, userData.source, again.source)
+
+	header := userData.source[:strings.Index(userData.source, "\r\n")]
+	_, mediaParams, err := mime.ParseMediaType(strings.TrimPrefix(header, "Content-Type: "))
+	require.NoError(t, err)
+
+	reader := multipart.NewReader(strings.NewReader(userData.source), mediaParams["boundary"])
+	for _, expected := range []struct {
+		fileName    string
+		contentType string
+		content     string
+	}{
+		{fileName: "10-config.yaml", contentType: "text/cloud-config", content: "#cloud-config\nhostname: node\n"},
+		{fileName: "20-kubelet.sh", contentType: "text/x-shellscript", content: "#!/bin/sh\necho default-worker\n"},
+	} {
+		part, err := reader.NextPart()
+		require.NoError(t, err)
+		require.Equal(t, expected.fileName, part.FileName())
+		require.True(t, strings.HasPrefix(part.Header.Get("Content-Type"), expected.contentType))
+
+		content, err := ioutil.ReadAll(part)
+		require.NoError(t, err)
+		require.Equal(t, expected.content, string(content))
+	}
+
+	_, err = reader.NextPart()
+	require.Error(t, err)
+}
+
+func TestRenderCloudInitUserDataInvalidPart(t *testing.T) {
+	profilePath := newUserDataProfile(t, map[string]string{
+		"userdata.d/10-kubelet.txt": "",
+	})
+	defer os.RemoveAll(profilePath)
+
+	_, err := renderUserData(profilePath, &userDataParams{})
+	require.Error(t, err)
+}
+
+func TestCloudInitUserData(t *testing.T) {
+	data, err := cloudInitUserData("#cloud-config\n")
+	require.NoError(t, err)
+	require.Equal(t, "#cloud-config\n", string(data))
+
+	// large messages are compressed
+	message := "#cloud-config\n" + strings.Repeat("# comment\n", maxEC2UserDataSize/10)
+	data, err = cloudInitUserData(message)
+	require.NoError(t, err)
+	require.True(t, len(data) <= maxEC2UserDataSize)
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	decompressed, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, message, string(decompressed))
+}
+
+func TestIgnitionPointerConfig(t *testing.T) {
+	// spec 2 configs keep the original pointer
+	pointer, err := ignitionPointerConfig("2.2.0", "s3://bucket/object", "")
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf(ignitionBaseTemplate, "s3://bucket/object"), pointer)
+
+	pointer, err = ignitionPointerConfig("3.1.0", "https://bucket.s3.amazonaws.com/object", ignitionCompressionGzip)
+	require.NoError(t, err)
+	require.Contains(t, pointer, `"version": "3.1.0"`)
+	require.Contains(t, pointer, `"source": "https://bucket.s3.amazonaws.com/object"`)
+	require.Contains(t, pointer, `"compression": "gzip"`)
+
+	pointer, err = ignitionPointerConfig("3.0.0", "s3://bucket/object", "")
+	require.NoError(t, err)
+	require.NotContains(t, pointer, "compression")
+
+	for _, version := range []string{"2.2.0", "3.0.0"} {
+		_, err := ignitionPointerConfig(version, "s3://bucket/object", ignitionCompressionGzip)
+		require.Error(t, err, version)
+	}
+}
+
+func TestNodePoolIgnitionHosting(t *testing.T) {
+	hosting, err := nodePoolIgnitionHosting(&api.NodePool{})
+	require.NoError(t, err)
+	require.Equal(t, &ignitionHosting{validity: maxPresignedURLValidity}, hosting)
+
+	hosting, err = nodePoolIgnitionHosting(&api.NodePool{ConfigItems: map[string]string{
+		nodePoolConfigKeyIgnitionConfigURL:      ignitionConfigURLPresigned,
+		nodePoolConfigKeyIgnitionPresignedValid: "24h",
+		nodePoolConfigKeyIgnitionCompression:    ignitionCompressionGzip,
+	}})
+	require.NoError(t, err)
+	require.Equal(t, &ignitionHosting{presigned: true, validity: 24 * time.Hour, compression: ignitionCompressionGzip}, hosting)
+
+	for _, invalid := range []map[string]string{
+		{nodePoolConfigKeyIgnitionConfigURL: "https"},
+		{nodePoolConfigKeyIgnitionPresignedValid: "8d"},
+		{nodePoolConfigKeyIgnitionPresignedValid: "200h"},
+		{nodePoolConfigKeyIgnitionCompression: "zstd"},
+	} {
+		_, err := nodePoolIgnitionHosting(&api.NodePool{ConfigItems: invalid})
+		require.Error(t, err, "%v", invalid)
+	}
+}
+
+func TestPresignUserData(t *testing.T) {
+	userData := []byte(`{"ignition": {"version": "3.1.0"}}`)
+	uploaded := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	s3Client := &s3APIStub{objects: []*s3.Object{{Key: aws.String(userDataObjectName(userData)), LastModified: aws.Time(uploaded)}}}
+	p := &AWSNodePoolProvisioner{awsAdapter: &awsAdapter{s3Client: s3Client, s3Uploader: &s3UploaderAPIStub{}}}
+
+	uri, presigned, err := p.presignUserData(userData, "bucket", 24*time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, "s3://bucket/"+userDataObjectName(userData), uri)
+
+	parsed, err := url.Parse(presigned)
+	require.NoError(t, err)
+	require.Equal(t, "https", parsed.Scheme)
+	require.Equal(t, uploaded.Format("20060102T150405Z"), parsed.Query().Get("X-Amz-Date"))
+	require.Equal(t, "86400", parsed.Query().Get("X-Amz-Expires"))
+
+	// the URL only changes when the object is uploaded again
+	_, again, err := p.presignUserData(userData, "bucket", 24*time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, presigned, again)
+
+	// missing objects are uploaded, which can't be looked up in the stub
+	_, _, err = p.presignUserData([]byte(`{"ignition": {"version": "3.0.0"}}`), "bucket", 24*time.Hour)
+	require.Error(t, err)
+}
@@ -0,0 +1,202 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/logging"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// channelValuesFile is the template of the values defined by the
+	// channel, rendered for the cluster.
+	channelValuesFile = "cluster/values.yaml"
+	// configKeyValuePrefix is the prefix of the config items overriding a
+	// value, e.g. value_apiserver_count overrides apiserver_count.
+	configKeyValuePrefix = "value_"
+
+	valueSourceDefault    = "default"
+	valueSourceChannel    = "channel"
+	valueSourceConfigItem = "config-item"
+	valueSourceOverride   = "override"
+)
+
+var errValuesNotAvailable = errors.New("values are not available in this context")
+
+// ClusterValues are the effective values passed to the templates of a
+// cluster. The values are layered, each layer overriding the values of the
+// same name of the previous ones: the defaults computed by the CLM, the
+// values of the channel, the value_ config items of the cluster and the
+// overrides passed on the command line.
+type ClusterValues struct {
+	Values map[string]interface{} `json:"values"`
+	// Sources are the layers the values were taken from by name.
+	Sources map[string]string `json:"sources"`
+}
+
+// newClusterValues initializes the values with the defaults.
+func newClusterValues(defaults map[string]interface{}) *ClusterValues {
+	values := &ClusterValues{
+		Values:  make(map[string]interface{}, len(defaults)),
+		Sources: make(map[string]string, len(defaults)),
+	}
+	values.overlay(valueSourceDefault, defaults)
+	return values
+}
+
+// overlay overrides the values with the ones of the layer.
+func (v *ClusterValues) overlay(source string, values map[string]interface{}) {
+	for key, value := range values {
+		v.Values[key] = value
+		v.Sources[key] = source
+	}
+}
+
+// infrastructure returns the infrastructure facts of the default values or
+// nil if they're not available.
+func (v *ClusterValues) infrastructure() *infrastructureFacts {
+	if v == nil {
+		return nil
+	}
+	facts, _ := v.Values[infrastructureValueKey].(*infrastructureFacts)
+	return facts
+}
+
+// values is the values template function. It fails if the values aren't
+// available, e.g. when rendering templates which aren't rendered for a
+// specific cluster.
+func (v *ClusterValues) values() (map[string]interface{}, error) {
+	if v == nil {
+		return nil, errValuesNotAvailable
+	}
+	return v.Values, nil
+}
+
+// layerValues layers the values of the channel, the config items of the
+// cluster and the overrides on top of the defaults.
+func (p *clusterpyProvisioner) layerValues(cluster *api.Cluster, channelPath string, defaults map[string]interface{}) (*ClusterValues, error) {
+	values := newClusterValues(defaults)
+
+	channelValues, err := renderChannelValues(cluster, channelPath)
+	if err != nil {
+		return nil, err
+	}
+	values.overlay(valueSourceChannel, channelValues)
+
+	configItemValues := make(map[string]interface{})
+	for key, value := range cluster.ConfigItems {
+		if strings.HasPrefix(key, configKeyValuePrefix) {
+			configItemValues[strings.TrimPrefix(key, configKeyValuePrefix)] = value
+		}
+	}
+	values.overlay(valueSourceConfigItem, configItemValues)
+
+	overrides := make(map[string]interface{}, len(p.valueOverrides))
+	for key, value := range p.valueOverrides {
+		overrides[key] = value
+	}
+	values.overlay(valueSourceOverride, overrides)
+
+	return values, nil
+}
+
+// clusterValues returns the effective values of the cluster.
+func (p *clusterpyProvisioner) clusterValues(adapter *awsAdapter, cluster *api.Cluster, channelPath string) (*ClusterValues, error) {
+	defaults, err := nodePoolValues(adapter, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.layerValues(cluster, channelPath, defaults)
+}
+
+// offlineClusterValues returns the effective values of the cluster without
+// access to AWS, using the offline subnets and infrastructure facts.
+func (p *clusterpyProvisioner) offlineClusterValues(cluster *api.Cluster, channelPath string) (*ClusterValues, error) {
+	defaults, err := nodePoolValuesForSubnets(cluster, offlineSubnets(cluster))
+	if err != nil {
+		return nil, err
+	}
+	defaults[infrastructureValueKey] = offlineInfrastructureFacts(cluster)
+
+	return p.layerValues(cluster, channelPath, defaults)
+}
+
+// genericClusterValues returns the effective values of a cluster not running
+// on AWS. The defaults computed from the subnets of AWS clusters aren't
+// available.
+func (p *clusterpyProvisioner) genericClusterValues(cluster *api.Cluster, channelPath string) (*ClusterValues, error) {
+	defaults := map[string]interface{}{
+		"apiserver_count": strconv.Itoa(apiServerCount(cluster)),
+	}
+	return p.layerValues(cluster, channelPath, defaults)
+}
+
+// renderChannelValues renders the values of the channel for the cluster.
+// Channels without values define none.
+func renderChannelValues(cluster *api.Cluster, channelPath string) (map[string]interface{}, error) {
+	result, err := renderTemplate(newTemplateContext(channelPath), path.Join(channelPath, channelValuesFile), cluster)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	err = yaml.Unmarshal([]byte(result), &values)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range values {
+		values[key] = stringKeys(value)
+	}
+	return values, nil
+}
+
+// stringKeys converts the nested maps of a YAML value to maps with string
+// keys, so the values can be encoded as JSON.
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprintf("%v", key)] = stringKeys(item)
+		}
+		return result
+	case []interface{}:
+		for i, item := range v {
+			v[i] = stringKeys(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// Values returns the effective values of the cluster and the layer every
+// value was taken from. Offline the values are computed without access to
+// AWS like when rendering offline.
+func (p *clusterpyProvisioner) Values(ctx context.Context, logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config, offline bool) (*ClusterValues, error) {
+	logger = logging.WithModule(logger, "provisioner")
+
+	adapter, _, _, err := p.prepareProvision(logger, cluster, channelConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if offline {
+		return p.offlineClusterValues(cluster, channelConfig.Path)
+	}
+	return p.clusterValues(adapter, cluster, channelConfig.Path)
+}
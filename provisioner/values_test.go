@@ -0,0 +1,93 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestLayerValues(t *testing.T) {
+	channelPath, err := ioutil.TempDir("", "values")
+	require.NoError(t, err)
+	defer os.RemoveAll(channelPath)
+
+	require.NoError(t, os.MkdirAll(path.Join(channelPath, "cluster"), 0755))
+	err = ioutil.WriteFile(path.Join(channelPath, channelValuesFile), []byte(`apiserver_count: "2"
+node_labels: "team={{ .Alias }}"
+logging:
+  level: info
+`), 0644)
+	require.NoError(t, err)
+
+	cluster := &api.Cluster{
+		Alias: "foo",
+		ConfigItems: map[string]string{
+			"value_node_labels": "team=bar",
+			"value_log_format":  "json",
+			"apiserver_count":   "5",
+		},
+	}
+	defaults := map[string]interface{}{
+		"apiserver_count": "1",
+		"node_labels":     "lifecycle-status=ready",
+		"minimal_profile": false,
+		"log_format":      "text",
+	}
+
+	p := &clusterpyProvisioner{valueOverrides: map[string]string{"log_format": "logfmt"}}
+	values, err := p.layerValues(cluster, channelPath, defaults)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]interface{}{
+		"apiserver_count": "2",
+		"node_labels":     "team=bar",
+		"minimal_profile": false,
+		"log_format":      "logfmt",
+		"logging":         map[string]interface{}{"level": "info"},
+	}, values.Values)
+	require.Equal(t, map[string]string{
+		"apiserver_count": valueSourceChannel,
+		"node_labels":     valueSourceConfigItem,
+		"minimal_profile": valueSourceDefault,
+		"log_format":      valueSourceOverride,
+		"logging":         valueSourceChannel,
+	}, values.Sources)
+
+	_, err = json.Marshal(values)
+	require.NoError(t, err)
+}
+
+func TestLayerValuesWithoutChannelValues(t *testing.T) {
+	channelPath, err := ioutil.TempDir("", "values")
+	require.NoError(t, err)
+	defer os.RemoveAll(channelPath)
+
+	p := &clusterpyProvisioner{}
+	values, err := p.layerValues(&api.Cluster{ConfigItems: map[string]string{}}, channelPath, map[string]interface{}{"apiserver_count": "1"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"apiserver_count": "1"}, values.Values)
+}
+
+func TestValuesTemplateFunction(t *testing.T) {
+	basedir, err := ioutil.TempDir("", "values")
+	require.NoError(t, err)
+	defer os.RemoveAll(basedir)
+
+	file := path.Join(basedir, "foo.yaml")
+	err = ioutil.WriteFile(file, []byte(`{{ index values "apiserver_count" }}`), 0644)
+	require.NoError(t, err)
+
+	_, err = renderTemplate(newTemplateContext(basedir), file, nil)
+	require.Error(t, err)
+
+	context := newTemplateContext(basedir)
+	context.values = newClusterValues(map[string]interface{}{"apiserver_count": "3"})
+	result, err := renderTemplate(context, file, nil)
+	require.NoError(t, err)
+	require.Equal(t, "3", result)
+}
@@ -0,0 +1,172 @@
+package provisioner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	configKeyKubernetesVersion = "kubernetes_version"
+	configKeyForceVersionSkew  = "force_kubernetes_version_skew"
+
+	// maxKubeletSkew is the maximum number of minor versions kubelets
+	// are allowed to be behind the API server.
+	maxKubeletSkew = 2
+)
+
+var kubeVersionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// kubeVersion is the major and minor part of a Kubernetes version.
+type kubeVersion struct {
+	major int
+	minor int
+}
+
+func (v kubeVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// parseKubeVersion parses the major and minor part of a Kubernetes version
+// string like 'v1.9.6' or '1.10'.
+func parseKubeVersion(version string) (kubeVersion, error) {
+	match := kubeVersionRegexp.FindStringSubmatch(version)
+	if match == nil {
+		return kubeVersion{}, fmt.Errorf("invalid Kubernetes version: %s", version)
+	}
+
+	// the regexp guarantees that the parts are numbers.
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return kubeVersion{major: major, minor: minor}, nil
+}
+
+// validateVersionSkew validates that upgrading a cluster running the API
+// server and kubelet versions to the target version results in a supported
+// version skew. Downgrades, upgrades skipping a minor version and upgrades
+// leaving kubelets more than maxKubeletSkew minor versions behind are
+// refused.
+func validateVersionSkew(target, apiServer string, kubelets []string) error {
+	targetVersion, err := parseKubeVersion(target)
+	if err != nil {
+		return err
+	}
+
+	apiServerVersion, err := parseKubeVersion(apiServer)
+	if err != nil {
+		return err
+	}
+
+	if targetVersion.major != apiServerVersion.major {
+		return fmt.Errorf("changing the major version from %s to %s is not supported", apiServerVersion, targetVersion)
+	}
+
+	if targetVersion.minor < apiServerVersion.minor {
+		return fmt.Errorf("downgrading from %s to %s is not supported", apiServerVersion, targetVersion)
+	}
+
+	if targetVersion.minor > apiServerVersion.minor+1 {
+		return fmt.Errorf("upgrading from %s to %s skips minor versions", apiServerVersion, targetVersion)
+	}
+
+	for _, kubelet := range kubelets {
+		kubeletVersion, err := parseKubeVersion(kubelet)
+		if err != nil {
+			return err
+		}
+
+		if kubeletVersion.major != targetVersion.major || kubeletVersion.minor > targetVersion.minor {
+			return fmt.Errorf("kubelets running %s are newer than %s", kubeletVersion, targetVersion)
+		}
+
+		if targetVersion.minor-kubeletVersion.minor > maxKubeletSkew {
+			return fmt.Errorf("upgrading to %s leaves kubelets running %s more than %d minor versions behind", targetVersion, kubeletVersion, maxKubeletSkew)
+		}
+	}
+
+	return nil
+}
+
+// checkVersionSkew validates that the Kubernetes version intended by the
+// channel, configured by the kubernetes_version config item, can be applied to
+// the running cluster without causing an unsupported version skew. The check
+// can be overridden by setting the force_kubernetes_version_skew config item
+// to 'true'. It's skipped for clusters being created, since there's no
+// running version to compare with. Failing to get the version of the API
+// server fails the check for ready clusters and if the API server rejects the
+// credentials, otherwise the check is skipped with a warning.
+func (p *clusterpyProvisioner) checkVersionSkew(logger *log.Entry, cluster *api.Cluster) error {
+	target, ok := cluster.ConfigItems[configKeyKubernetesVersion]
+	if !ok || target == "" {
+		return nil
+	}
+
+	switch cluster.LifecycleStatus {
+	case models.ClusterLifecycleStatusRequested, models.ClusterUpdateLifecycleStatusCreating:
+		return nil
+	}
+
+	client, err := p.apiServerClient(cluster)
+	if err != nil {
+		return err
+	}
+
+	serverVersion, err := probeAPIServer(client, cluster.APIServerURL)
+	if err != nil {
+		if _, ok := err.(*apiServerAuthError); ok || cluster.LifecycleStatus == models.ClusterLifecycleStatusReady {
+			return fmt.Errorf("unable to get the API server version to check the Kubernetes version skew: %v", err)
+		}
+		logger.Warnf("Skipping the Kubernetes version skew check, unable to get the API server version: %v", err)
+		return nil
+	}
+
+	err = p.versionSkewError(cluster, target, serverVersion.GitVersion)
+	if err == nil {
+		return nil
+	}
+
+	if cluster.ConfigItems[configKeyForceVersionSkew] == "true" {
+		logger.Warnf("Ignoring Kubernetes version skew: %v", err)
+		return nil
+	}
+
+	return fmt.Errorf("refusing to apply Kubernetes version %s (set %s to override): %v", target, configKeyForceVersionSkew, err)
+}
+
+// versionSkewError returns an error if applying the target version to the
+// cluster running the API server version would result in an unsupported
+// version skew.
+func (p *clusterpyProvisioner) versionSkewError(cluster *api.Cluster, target, apiServer string) error {
+	transport, err := p.clusterTransport(cluster)
+	if err != nil {
+		return err
+	}
+
+	tokenSource, err := p.clusterTokenSource(cluster)
+	if err != nil {
+		return err
+	}
+
+	kubeClient, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, tokenSource, transport)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get the kubelet versions: %v", err)
+	}
+
+	kubelets := make([]string, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		kubelets = append(kubelets, node.Status.NodeInfo.KubeletVersion)
+	}
+
+	return validateVersionSkew(target, apiServer, kubelets)
+}
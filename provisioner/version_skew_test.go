@@ -0,0 +1,130 @@
+package provisioner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+)
+
+func TestValidateVersionSkew(t *testing.T) {
+	for _, tc := range []struct {
+		msg       string
+		target    string
+		apiServer string
+		kubelets  []string
+		valid     bool
+	}{
+		{
+			msg:       "same version",
+			target:    "1.9",
+			apiServer: "v1.9.6",
+			kubelets:  []string{"v1.9.6", "v1.9.3"},
+			valid:     true,
+		},
+		{
+			msg:       "minor upgrade",
+			target:    "v1.10.1",
+			apiServer: "v1.9.6",
+			kubelets:  []string{"v1.9.6", "v1.8.4"},
+			valid:     true,
+		},
+		{
+			msg:       "skipping a minor version",
+			target:    "1.11",
+			apiServer: "v1.9.6",
+			kubelets:  []string{"v1.9.6"},
+			valid:     false,
+		},
+		{
+			msg:       "downgrade",
+			target:    "1.8",
+			apiServer: "v1.9.6",
+			kubelets:  []string{"v1.8.4"},
+			valid:     false,
+		},
+		{
+			msg:       "kubelets too old",
+			target:    "1.10",
+			apiServer: "v1.9.6",
+			kubelets:  []string{"v1.9.6", "v1.7.2"},
+			valid:     false,
+		},
+		{
+			msg:       "invalid version",
+			target:    "latest",
+			apiServer: "v1.9.6",
+			valid:     false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateVersionSkew(tc.target, tc.apiServer, tc.kubelets)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckVersionSkewSkipped(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	p := &clusterpyProvisioner{}
+	for _, status := range []string{models.ClusterLifecycleStatusRequested, models.ClusterUpdateLifecycleStatusCreating} {
+		cluster := &api.Cluster{
+			APIServerURL:    server.URL,
+			LifecycleStatus: status,
+			ConfigItems: map[string]string{
+				configKeyKubernetesVersion: "v1.11.1",
+				configKeyAPIServerAuth:     apiServerAuthStaticToken,
+				configKeyAPIServerToken:    "token",
+			},
+		}
+		assert.NoError(t, p.checkVersionSkew(log.WithField("test", "skew"), cluster), status)
+	}
+}
+
+func TestCheckVersionSkewUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	p := &clusterpyProvisioner{}
+	cluster := &api.Cluster{
+		APIServerURL:    server.URL,
+		LifecycleStatus: models.ClusterLifecycleStatusReady,
+		ConfigItems: map[string]string{
+			configKeyKubernetesVersion: "v1.11.1",
+			configKeyAPIServerAuth:     apiServerAuthStaticToken,
+			configKeyAPIServerToken:    "token",
+		},
+	}
+	assert.Error(t, p.checkVersionSkew(log.WithField("test", "skew"), cluster))
+}
+
+func TestCheckVersionSkewUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	p := &clusterpyProvisioner{}
+	for _, status := range []string{models.ClusterLifecycleStatusReady, models.ClusterLifecycleStatusDecommissionRequested} {
+		cluster := &api.Cluster{
+			APIServerURL:    server.URL,
+			LifecycleStatus: status,
+			ConfigItems: map[string]string{
+				configKeyKubernetesVersion: "v1.11.1",
+				configKeyAPIServerAuth:     apiServerAuthStaticToken,
+				configKeyAPIServerToken:    "token",
+			},
+		}
+		assert.Error(t, p.checkVersionSkew(log.WithField("test", "skew"), cluster), status)
+	}
+}
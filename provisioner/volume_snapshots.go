@@ -0,0 +1,137 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+)
+
+const (
+	// snapshotClusterTagKey tags the snapshots of the volumes of a
+	// decommissioned cluster with the ID of the cluster.
+	snapshotClusterTagKey = "cluster-lifecycle-manager.zalando.org/decommissioned-cluster"
+	// snapshotRetainUntilTagKey tags the snapshots with the time until
+	// which they must be retained.
+	snapshotRetainUntilTagKey = "cluster-lifecycle-manager.zalando.org/retain-until"
+)
+
+// snapshotPollInterval is the interval between checks of the state of
+// snapshots being created. It's defined as a variable so it can be changed
+// in tests.
+var snapshotPollInterval = 15 * time.Second
+
+// volumeSnapshot returns the snapshot created by the CLM for the volume
+// before deleting it or nil if there's none which didn't fail.
+func (a *awsAdapter) volumeSnapshot(volumeID string) (*ec2.Snapshot, error) {
+	resp, err := a.ec2Client.DescribeSnapshots(&ec2.DescribeSnapshotsInput{
+		OwnerIds: aws.StringSlice([]string{"self"}),
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("volume-id"),
+				Values: aws.StringSlice([]string{volumeID}),
+			},
+			{
+				Name:   aws.String("tag-key"),
+				Values: aws.StringSlice([]string{snapshotClusterTagKey}),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snapshot := range resp.Snapshots {
+		if aws.StringValue(snapshot.State) != ec2.SnapshotStateError {
+			return snapshot, nil
+		}
+	}
+	return nil, nil
+}
+
+// snapshotTags returns the tags of the snapshot of a volume of the cluster:
+// the tags of the volume except for the cluster tag, so the snapshot isn't
+// considered a resource of the cluster anymore, and the retention tags.
+func snapshotTags(cluster *api.Cluster, volume *ec2.Volume, retainUntil time.Time) []*ec2.Tag {
+	var tags []*ec2.Tag
+	for _, tag := range volume.Tags {
+		key := aws.StringValue(tag.Key)
+		if key == tagNameKubernetesClusterPrefix+cluster.ID || strings.HasPrefix(key, "aws:") {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	return append(tags,
+		&ec2.Tag{
+			Key:   aws.String(snapshotClusterTagKey),
+			Value: aws.String(cluster.ID),
+		},
+		&ec2.Tag{
+			Key:   aws.String(snapshotRetainUntilTagKey),
+			Value: aws.String(retainUntil.UTC().Format(time.RFC3339)),
+		},
+	)
+}
+
+// snapshotVolume snapshots the volume of the cluster and waits until the
+// snapshot is completed, so the volume can be deleted. A snapshot created
+// by a previous attempt is reused.
+func (a *awsAdapter) snapshotVolume(ctx context.Context, logger *log.Entry, cluster *api.Cluster, volume *ec2.Volume, retention time.Duration) error {
+	volumeID := aws.StringValue(volume.VolumeId)
+
+	snapshot, err := a.volumeSnapshot(volumeID)
+	if err != nil {
+		return err
+	}
+
+	if snapshot == nil {
+		snapshot, err = a.ec2Client.CreateSnapshot(&ec2.CreateSnapshotInput{
+			VolumeId:    volume.VolumeId,
+			Description: aws.String(fmt.Sprintf("Volume %s of decommissioned cluster %s", volumeID, cluster.ID)),
+			TagSpecifications: []*ec2.TagSpecification{
+				{
+					ResourceType: aws.String(ec2.ResourceTypeSnapshot),
+					Tags:         snapshotTags(cluster, volume, time.Now().Add(retention)),
+				},
+			},
+		})
+		a.audit.Record(audit.KindAWS, "create-snapshot", volumeID, err)
+		if err != nil {
+			return fmt.Errorf("failed to snapshot EBS volume %s: %v", volumeID, err)
+		}
+		logger.Infof("Created snapshot %s of EBS volume %s", aws.StringValue(snapshot.SnapshotId), volumeID)
+	}
+
+	for {
+		switch aws.StringValue(snapshot.State) {
+		case ec2.SnapshotStateCompleted:
+			return nil
+		case ec2.SnapshotStateError:
+			return fmt.Errorf("snapshot %s of EBS volume %s failed: %s", aws.StringValue(snapshot.SnapshotId), volumeID, aws.StringValue(snapshot.StateMessage))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(snapshotPollInterval):
+		}
+
+		resp, err := a.ec2Client.DescribeSnapshots(&ec2.DescribeSnapshotsInput{
+			SnapshotIds: []*string{snapshot.SnapshotId},
+		})
+		if err != nil {
+			return err
+		}
+		if len(resp.Snapshots) != 1 {
+			return fmt.Errorf("snapshot %s of EBS volume %s not found", aws.StringValue(snapshot.SnapshotId), volumeID)
+		}
+		snapshot = resp.Snapshots[0]
+	}
+}
@@ -0,0 +1,88 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// ec2SnapshotsAPIStub completes snapshots once they're described by ID.
+type ec2SnapshotsAPIStub struct {
+	ec2API
+	snapshots []*ec2.Snapshot
+	created   []*ec2.CreateSnapshotInput
+}
+
+func (e *ec2SnapshotsAPIStub) DescribeSnapshots(input *ec2.DescribeSnapshotsInput) (*ec2.DescribeSnapshotsOutput, error) {
+	if len(input.SnapshotIds) > 0 {
+		for _, snapshot := range e.snapshots {
+			if aws.StringValue(snapshot.SnapshotId) == aws.StringValue(input.SnapshotIds[0]) {
+				snapshot.State = aws.String(ec2.SnapshotStateCompleted)
+				return &ec2.DescribeSnapshotsOutput{Snapshots: []*ec2.Snapshot{snapshot}}, nil
+			}
+		}
+		return &ec2.DescribeSnapshotsOutput{}, nil
+	}
+
+	var snapshots []*ec2.Snapshot
+	for _, snapshot := range e.snapshots {
+		if aws.StringValue(snapshot.VolumeId) == aws.StringValue(input.Filters[0].Values[0]) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return &ec2.DescribeSnapshotsOutput{Snapshots: snapshots}, nil
+}
+
+func (e *ec2SnapshotsAPIStub) CreateSnapshot(input *ec2.CreateSnapshotInput) (*ec2.Snapshot, error) {
+	e.created = append(e.created, input)
+	snapshot := &ec2.Snapshot{
+		SnapshotId: aws.String("snap-new"),
+		VolumeId:   input.VolumeId,
+		State:      aws.String(ec2.SnapshotStatePending),
+	}
+	e.snapshots = append(e.snapshots, snapshot)
+	return snapshot, nil
+}
+
+func TestSnapshotVolume(t *testing.T) {
+	snapshotPollInterval = 0
+
+	logger := log.WithField("cluster", "kube-1")
+	cluster := &api.Cluster{ID: "kube-1"}
+	volume := &ec2.Volume{
+		VolumeId: aws.String("vol-1"),
+		Tags: []*ec2.Tag{
+			{Key: aws.String("kubernetes.io/cluster/kube-1"), Value: aws.String("owned")},
+			{Key: aws.String("kubernetes.io/created-for/pvc/name"), Value: aws.String("data-postgres-0")},
+		},
+	}
+
+	stub := &ec2SnapshotsAPIStub{snapshots: []*ec2.Snapshot{
+		{SnapshotId: aws.String("snap-failed"), VolumeId: aws.String("vol-1"), State: aws.String(ec2.SnapshotStateError)},
+	}}
+	adapter := &awsAdapter{ec2Client: stub}
+
+	err := adapter.snapshotVolume(context.Background(), logger, cluster, volume, 24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, stub.created, 1)
+	require.Equal(t, ec2.SnapshotStateCompleted, aws.StringValue(stub.snapshots[1].State))
+
+	tags := tagsToMap(stub.created[0].TagSpecifications[0].Tags)
+	require.Len(t, tags, 3)
+	require.Equal(t, "data-postgres-0", tags["kubernetes.io/created-for/pvc/name"])
+	require.Equal(t, "kube-1", tags[snapshotClusterTagKey])
+	retainUntil, err := time.Parse(time.RFC3339, tags[snapshotRetainUntilTagKey])
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(24*time.Hour), retainUntil, time.Minute)
+
+	// the snapshot of a previous attempt is reused
+	err = adapter.snapshotVolume(context.Background(), logger, cluster, volume, 24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, stub.created, 1)
+}
@@ -0,0 +1,291 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+const (
+	waitConditionsFile          = "cluster/wait-conditions.yaml"
+	waitConditionDefaultTimeout = 10 * time.Minute
+	waitConditionPollInterval   = 10 * time.Second
+
+	waitConditionDeployment           = "deployment"
+	waitConditionCRD                  = "crd"
+	waitConditionHTTP                 = "http"
+	waitConditionCloudFormationExport = "cloudformation-export"
+
+	stepEtcd         = "etcd"
+	stepClusterStack = "cluster-stack"
+	stepNodePools    = "node-pools"
+	stepAPIServer    = "api-server"
+	stepManifests    = "manifests"
+)
+
+// waitConditionSteps are the provisioning steps wait conditions can follow,
+// in the order they are run.
+var waitConditionSteps = []string{stepEtcd, stepClusterStack, stepNodePools, stepAPIServer, stepManifests}
+
+// waitCondition is a condition the CLM waits for after a provisioning step
+// before continuing with the next one.
+type waitCondition struct {
+	After     string        `yaml:"after"`
+	Type      string        `yaml:"type"`
+	Namespace string        `yaml:"namespace"`
+	Name      string        `yaml:"name"`
+	URL       string        `yaml:"url"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+func (c *waitCondition) String() string {
+	switch c.Type {
+	case waitConditionDeployment:
+		return fmt.Sprintf("deployment %s/%s", c.Namespace, c.Name)
+	case waitConditionCRD:
+		return fmt.Sprintf("custom resource definition %s", c.Name)
+	case waitConditionHTTP:
+		return fmt.Sprintf("HTTP endpoint %s", c.URL)
+	default:
+		return fmt.Sprintf("CloudFormation export %s", c.Name)
+	}
+}
+
+// validate validates that the condition follows a known step and defines
+// what its type needs. Conditions checked with the API server can't follow
+// steps run before the node pools exist.
+func (c *waitCondition) validate() error {
+	var known bool
+	for _, step := range waitConditionSteps {
+		known = known || c.After == step
+	}
+	if !known {
+		return fmt.Errorf("unknown step: %s", c.After)
+	}
+
+	switch c.Type {
+	case waitConditionDeployment, waitConditionCRD:
+		if c.After == stepEtcd || c.After == stepClusterStack {
+			return fmt.Errorf("%s conditions can't follow step %s", c.Type, c.After)
+		}
+		if c.Name == "" || (c.Type == waitConditionDeployment && c.Namespace == "") {
+			return fmt.Errorf("%s conditions require a name", c.Type)
+		}
+	case waitConditionHTTP:
+		if c.URL == "" {
+			return fmt.Errorf("%s conditions require a URL", c.Type)
+		}
+	case waitConditionCloudFormationExport:
+		if c.Name == "" {
+			return fmt.Errorf("%s conditions require a name", c.Type)
+		}
+	default:
+		return fmt.Errorf("unknown type: %s", c.Type)
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("invalid timeout: %s", c.Timeout)
+	}
+	return nil
+}
+
+// loadWaitConditions renders the wait conditions of the channel for the
+// cluster. Channels without wait conditions define none.
+func loadWaitConditions(cluster *api.Cluster, channelPath string) ([]*waitCondition, error) {
+	result, err := renderTemplate(newTemplateContext(channelPath), path.Join(channelPath, waitConditionsFile), cluster)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var conditions []*waitCondition
+	err = yaml.UnmarshalStrict([]byte(result), &conditions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wait conditions %s: %v", waitConditionsFile, err)
+	}
+
+	for i, condition := range conditions {
+		err := condition.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid wait condition %d in %s: %v", i, waitConditionsFile, err)
+		}
+	}
+	return conditions, nil
+}
+
+// waitForConditions waits for the conditions following the step, one after
+// the other. Nothing is waited for in dry-run mode.
+func (p *clusterpyProvisioner) waitForConditions(ctx context.Context, logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, conditions []*waitCondition, step string) error {
+	for _, condition := range conditions {
+		if condition.After != step {
+			continue
+		}
+
+		if adapter.dryRun {
+			logger.Infof("Dry-run: would wait for %s", condition)
+			continue
+		}
+
+		check, err := p.waitConditionCheck(adapter, cluster, condition)
+		if err != nil {
+			return err
+		}
+
+		logger.Infof("Waiting for %s", condition)
+		err = waitFor(ctx, condition, check, waitConditionPollInterval)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitConditionCheck returns the function checking if the condition is met.
+func (p *clusterpyProvisioner) waitConditionCheck(adapter *awsAdapter, cluster *api.Cluster, condition *waitCondition) (func() (bool, error), error) {
+	switch condition.Type {
+	case waitConditionDeployment:
+		tokenSource, err := p.clusterTokenSource(cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		transport, err := p.clusterTransport(cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, tokenSource, transport)
+		if err != nil {
+			return nil, err
+		}
+
+		return func() (bool, error) { return deploymentReady(client, condition.Namespace, condition.Name) }, nil
+	case waitConditionCRD:
+		tokenSource, err := p.clusterTokenSource(cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		transport, err := p.clusterTransport(cluster)
+		if err != nil {
+			return nil, err
+		}
+
+		deleter, err := newResourceDeleter(kubernetes.NewConfigWithTokenSource(cluster.APIServerURL, tokenSource, transport))
+		if err != nil {
+			return nil, err
+		}
+
+		return func() (bool, error) {
+			resource, err := deleter.findResource(crdResource, "")
+			if err != nil || resource == nil {
+				return false, err
+			}
+
+			client, err := deleter.client(resource, "")
+			if err != nil {
+				return false, err
+			}
+
+			crd, err := client.Get(condition.Name)
+			if err != nil {
+				return false, err
+			}
+			return crdEstablished(crd), nil
+		}, nil
+	case waitConditionHTTP:
+		client, err := p.httpConfig.Client(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return func() (bool, error) { return httpEndpointReady(client, condition.URL) }, nil
+	default:
+		return func() (bool, error) { return cloudFormationExportExists(adapter.cloudformationClient, condition.Name) }, nil
+	}
+}
+
+// waitFor calls check until it reports the condition as met, the timeout of
+// the condition expires or the context is cancelled.
+func waitFor(ctx context.Context, condition *waitCondition, check func() (bool, error), pollInterval time.Duration) error {
+	timeout := condition.Timeout
+	if timeout == 0 {
+		timeout = waitConditionDefaultTimeout
+	}
+	deadline := time.After(timeout)
+
+	for {
+		ready, err := check()
+		if err == nil && ready {
+			return nil
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			if err != nil {
+				return fmt.Errorf("timed out after %s waiting for %s: %v", timeout, condition, err)
+			}
+			return fmt.Errorf("timed out after %s waiting for %s", timeout, condition)
+		}
+	}
+}
+
+// deploymentReady returns true if all the replicas of the current generation
+// of the deployment are available.
+func deploymentReady(client clientset.Interface, namespace, name string) (bool, error) {
+	deployment, err := client.AppsV1beta1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	status := deployment.Status
+	return status.ObservedGeneration >= deployment.Generation && status.UpdatedReplicas == replicas && status.AvailableReplicas == replicas, nil
+}
+
+// httpEndpointReady returns true if the endpoint responds with a 2xx status.
+func httpEndpointReady(client *http.Client, url string) (bool, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return true, nil
+}
+
+// cloudFormationExportExists returns true if a stack exports the name.
+func cloudFormationExportExists(client cloudFormationAPI, name string) (bool, error) {
+	var found bool
+	err := client.ListExportsPages(&cloudformation.ListExportsInput{}, func(resp *cloudformation.ListExportsOutput, lastPage bool) bool {
+		for _, export := range resp.Exports {
+			found = found || aws.StringValue(export.Name) == name
+		}
+		return !found
+	})
+	return found, err
+}
@@ -0,0 +1,150 @@
+package provisioner
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+)
+
+func newWaitConditionsChannel(t *testing.T, conditions string) string {
+	dir, err := ioutil.TempDir("", "wait-conditions")
+	require.NoError(t, err)
+
+	err = os.MkdirAll(path.Join(dir, "cluster"), 0755)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(path.Join(dir, waitConditionsFile), []byte(conditions), 0644)
+	require.NoError(t, err)
+
+	return dir
+}
+
+func TestLoadWaitConditions(t *testing.T) {
+	channelPath := newWaitConditionsChannel(t, `
+- after: manifests
+  type: deployment
+  namespace: kube-system
+  name: external-dns
+  timeout: 5m
+- after: cluster-stack
+  type: http
+  url: https://{{.Alias}}.example.org/healthz
+`)
+	defer os.RemoveAll(channelPath)
+
+	conditions, err := loadWaitConditions(&api.Cluster{Alias: "kube-1"}, channelPath)
+	require.NoError(t, err)
+	require.Len(t, conditions, 2)
+	require.Equal(t, 5*time.Minute, conditions[0].Timeout)
+	require.Equal(t, "https://kube-1.example.org/healthz", conditions[1].URL)
+
+	// channels without wait conditions don't wait
+	conditions, err = loadWaitConditions(&api.Cluster{}, "invalid_folder")
+	require.NoError(t, err)
+	require.Nil(t, conditions)
+
+	for _, invalid := range []string{
+		"- after: unknown\n  type: http\n  url: https://example.org\n",
+		"- after: etcd\n  type: unknown\n",
+		"- after: etcd\n  type: crd\n  name: foos.example.org\n",
+		"- after: manifests\n  type: deployment\n  name: external-dns\n",
+		"- after: manifests\n  type: http\n",
+		"- after: manifests\n  type: cloudformation-export\n",
+		"- after: manifests\n  type: http\n  url: https://example.org\n  retries: 3\n",
+	} {
+		channelPath := newWaitConditionsChannel(t, invalid)
+		_, err := loadWaitConditions(&api.Cluster{}, channelPath)
+		require.Error(t, err, invalid)
+		os.RemoveAll(channelPath)
+	}
+}
+
+func TestDeploymentReady(t *testing.T) {
+	replicas := int32(2)
+	deployment := &v1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "external-dns", Generation: 2},
+		Spec:       v1beta1.DeploymentSpec{Replicas: &replicas},
+		Status:     v1beta1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 2, AvailableReplicas: 1},
+	}
+	client := fake.NewSimpleClientset(deployment)
+
+	ready, err := deploymentReady(client, "kube-system", "external-dns")
+	require.NoError(t, err)
+	require.False(t, ready)
+
+	deployment.Status.AvailableReplicas = 2
+	_, err = client.AppsV1beta1().Deployments("kube-system").Update(deployment)
+	require.NoError(t, err)
+
+	ready, err = deploymentReady(client, "kube-system", "external-dns")
+	require.NoError(t, err)
+	require.True(t, ready)
+
+	_, err = deploymentReady(client, "kube-system", "unknown")
+	require.Error(t, err)
+}
+
+func TestHTTPEndpointReady(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	ready, err := httpEndpointReady(server.Client(), server.URL)
+	require.Error(t, err)
+	require.False(t, ready)
+
+	status = http.StatusOK
+	ready, err = httpEndpointReady(server.Client(), server.URL)
+	require.NoError(t, err)
+	require.True(t, ready)
+}
+
+func TestCloudFormationExportExists(t *testing.T) {
+	client := &cloudFormationAPIStub{
+		exports: []*cloudformation.Export{{Name: aws.String("kube-1-vpc-id"), Value: aws.String("vpc-123")}},
+	}
+
+	exists, err := cloudFormationExportExists(client, "kube-1-vpc-id")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = cloudFormationExportExists(client, "kube-1-subnet-ids")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestWaitFor(t *testing.T) {
+	condition := &waitCondition{Type: waitConditionHTTP, URL: "https://example.org", Timeout: 50 * time.Millisecond}
+
+	var checks int
+	err := waitFor(context.Background(), condition, func() (bool, error) {
+		checks++
+		return checks == 3, nil
+	}, time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, 3, checks)
+
+	err = waitFor(context.Background(), condition, func() (bool, error) { return false, nil }, time.Millisecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timed out after 50ms waiting for HTTP endpoint https://example.org")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = waitFor(ctx, condition, func() (bool, error) { return false, nil }, time.Second)
+	require.Equal(t, context.Canceled, err)
+}
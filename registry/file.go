@@ -55,3 +55,43 @@ func (r *fileRegistry) UpdateCluster(cluster *api.Cluster) error {
 	}
 	return fmt.Errorf("failed to update the cluster: cluster %s not found", cluster.ID)
 }
+
+// UpdateNodePoolStatus logs the observed status of the node pool, like the
+// cluster updates it isn't written back to the file.
+func (r *fileRegistry) UpdateNodePoolStatus(cluster *api.Cluster, nodePool *api.NodePool) error {
+	if cluster == nil || nodePool == nil {
+		return fmt.Errorf("failed to update the node pool status. Empty cluster or node pool is passed")
+	}
+	for _, c := range fileClusters.Clusters {
+		if c.ID == cluster.ID {
+			log.Debugf("[Cluster %s updated] Node pool %s status: %#v", cluster.ID, nodePool.Name, nodePool.Status)
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to update the node pool status: cluster %s not found", cluster.ID)
+}
+
+// CreateCluster adds the cluster to the registry file.
+func (r *fileRegistry) CreateCluster(cluster *api.Cluster) error {
+	if cluster == nil {
+		return fmt.Errorf("failed to create the cluster. Empty cluster is passed")
+	}
+
+	_, err := r.ListClusters(Filter{})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range fileClusters.Clusters {
+		if c.ID == cluster.ID {
+			return fmt.Errorf("failed to create the cluster: cluster %s already exists", cluster.ID)
+		}
+	}
+	fileClusters.Clusters = append(fileClusters.Clusters, cluster)
+
+	fileContent, err := yaml.Marshal(fileClusters)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.filePath, fileContent, 0644)
+}
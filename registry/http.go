@@ -1,7 +1,9 @@
 package registry
 
 import (
+	"fmt"
 	"net/url"
+	"time"
 
 	"golang.org/x/oauth2"
 
@@ -14,7 +16,9 @@ import (
 	apiclient "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/client"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/client/clusters"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/client/infrastructure_accounts"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/client/node_pools"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/httpclient"
 )
 
 type httpRegistry struct {
@@ -25,17 +29,23 @@ type httpRegistry struct {
 // Options are options which can be used to configure the httpRegistry when it
 // is initialized.
 type Options struct {
-	Debug bool
+	Debug      bool
+	HTTPConfig *httpclient.Config
 }
 
 // NewHTTPRegistry initializes a new http based registry source.
-func NewHTTPRegistry(server *url.URL, tokenSource oauth2.TokenSource, options *Options) Registry {
+func NewHTTPRegistry(server *url.URL, tokenSource oauth2.TokenSource, options *Options) (Registry, error) {
+	client, err := newClient(server, options)
+	if err != nil {
+		return nil, err
+	}
+
 	registry := &httpRegistry{
-		apiClient:   newClient(server, options),
+		apiClient:   client,
 		tokenSource: tokenSource,
 	}
 
-	return registry
+	return registry, nil
 }
 
 // ListClusters lists filtered clusters from the registry.
@@ -95,6 +105,44 @@ func (r *httpRegistry) UpdateCluster(cluster *api.Cluster) error {
 	return err
 }
 
+// CreateCluster creates a cluster including its node pools in the registry.
+func (r *httpRegistry) CreateCluster(cluster *api.Cluster) error {
+	authInfo, err := newAuthInfo(r.tokenSource)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.apiClient.Clusters.CreateCluster(
+		clusters.NewCreateClusterParams().WithCluster(convertToClusterModel(cluster)),
+		authInfo,
+	)
+
+	return err
+}
+
+// UpdateNodePoolStatus updates the observed status of a node pool of the
+// cluster in the registry.
+func (r *httpRegistry) UpdateNodePoolStatus(cluster *api.Cluster, nodePool *api.NodePool) error {
+	if nodePool.Status == nil {
+		return fmt.Errorf("node pool %s of cluster %s has no status", nodePool.Name, cluster.ID)
+	}
+
+	authInfo, err := newAuthInfo(r.tokenSource)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.apiClient.NodePools.UpdateNodePoolStatus(
+		node_pools.NewUpdateNodePoolStatusParams().
+			WithClusterID(cluster.ID).
+			WithNodePoolName(nodePool.Name).
+			WithStatus(convertToNodePoolStatusModel(nodePool.Status)),
+		authInfo,
+	)
+
+	return err
+}
+
 // getReadyInfrastructureAccounts gets all ready infrastructure accounts from
 // the registry and converts the list to a map.
 func (r *httpRegistry) getReadyInfrastructureAccounts() (map[string]*models.InfrastructureAccount, error) {
@@ -120,21 +168,27 @@ func (r *httpRegistry) getReadyInfrastructureAccounts() (map[string]*models.Infr
 	return accounts, nil
 }
 
-func newClient(server *url.URL, options *Options) *apiclient.ClusterRegistry {
+func newClient(server *url.URL, options *Options) (*apiclient.ClusterRegistry, error) {
 	// initialize options if not provided
 	if options == nil {
 		options = &Options{}
 	}
 
+	httpTransport, err := options.HTTPConfig.Transport(nil)
+	if err != nil {
+		return nil, err
+	}
+
 	// create the transport
 	transport := httptransport.New(server.Host, server.Path, []string{server.Scheme})
+	transport.Transport = httpTransport
 	transport.Debug = options.Debug
 
 	// create the API client, with the transport
 	client := apiclient.New(transport, strfmt.Default)
 
 	// return the client
-	return client
+	return client, nil
 }
 
 func newAuthInfo(tokenSource oauth2.TokenSource) (runtime.ClientAuthInfoWriter, error) {
@@ -184,7 +238,32 @@ func convertFromNodePoolModel(nodePool *models.NodePool) *api.NodePool {
 		MinSize:          *nodePool.MinSize,
 		MaxSize:          *nodePool.MaxSize,
 		ConfigItems:      nodePool.ConfigItems,
+		Status:           convertFromNodePoolStatusModel(nodePool.Status),
+	}
+}
+
+// converts a NodePoolStatus model generated from the cluster-registry swagger
+// spec into an *api.NodePoolStatus struct.
+func convertFromNodePoolStatusModel(status *models.NodePoolStatus) *api.NodePoolStatus {
+	if status == nil {
+		return nil
+	}
+
+	result := &api.NodePoolStatus{
+		CurrentSize:   status.CurrentSize,
+		InstanceTypes: status.InstanceTypes,
+		Images:        status.Images,
+		LastUpdated:   time.Time(status.LastUpdated),
 	}
+
+	if substitution := status.InstanceTypeSubstitution; substitution != nil {
+		result.InstanceTypeSubstitution = &api.InstanceTypeSubstitution{
+			InstanceType: substitution.InstanceType,
+			Substitute:   substitution.Substitute,
+			Reason:       substitution.Reason,
+		}
+	}
+	return result
 }
 
 // converts a ClusterStatus model generated from the cluster-registry swagger
@@ -197,10 +276,29 @@ func convertFromClusterStatusModel(status *models.ClusterStatus) *api.ClusterSta
 	}
 
 	return &api.ClusterStatus{
-		CurrentVersion: status.CurrentVersion,
-		LastVersion:    status.LastVersion,
-		NextVersion:    status.NextVersion,
-		Problems:       problems,
+		CurrentVersion:   status.CurrentVersion,
+		LastVersion:      status.LastVersion,
+		NextVersion:      status.NextVersion,
+		Problems:         problems,
+		AuditLog:         status.AuditLog,
+		CostEstimate:     convertFromCostEstimateModel(status.CostEstimate),
+		ForceDeletedPods: status.ForceDeletedPods,
+		Degraded:         status.Degraded,
+		QuarantinedUntil: status.QuarantinedUntil,
+	}
+}
+
+// converts a ClusterStatusCostEstimate model generated from the
+// cluster-registry swagger spec into an *api.CostEstimate struct.
+func convertFromCostEstimateModel(estimate *models.ClusterStatusCostEstimate) *api.CostEstimate {
+	if estimate == nil {
+		return nil
+	}
+
+	return &api.CostEstimate{
+		MinMonthly: estimate.MinMonthly,
+		MaxMonthly: estimate.MaxMonthly,
+		Currency:   estimate.Currency,
 	}
 }
 
@@ -216,6 +314,76 @@ func convertFromProblemModel(problem *models.ClusterStatusProblemsItems) *api.Pr
 	}
 }
 
+// converts a *api.Cluster struct to the corresponding model generated from the
+// cluster-registry swagger spec.
+func convertToClusterModel(cluster *api.Cluster) *models.Cluster {
+	nodePools := make([]*models.NodePool, 0, len(cluster.NodePools))
+	for _, pool := range cluster.NodePools {
+		nodePools = append(nodePools, convertToNodePoolModel(pool))
+	}
+
+	status := cluster.Status
+	if status == nil {
+		status = &api.ClusterStatus{}
+	}
+
+	return &models.Cluster{
+		Alias:                 &cluster.Alias,
+		APIServerURL:          &cluster.APIServerURL,
+		Channel:               &cluster.Channel,
+		ConfigItems:           cluster.ConfigItems,
+		CriticalityLevel:      &cluster.CriticalityLevel,
+		Environment:           &cluster.Environment,
+		ID:                    &cluster.ID,
+		InfrastructureAccount: &cluster.InfrastructureAccount,
+		LifecycleStatus:       &cluster.LifecycleStatus,
+		LocalID:               &cluster.LocalID,
+		NodePools:             nodePools,
+		Provider:              &cluster.Provider,
+		Region:                &cluster.Region,
+		Status:                convertToClusterStatusModel(status),
+	}
+}
+
+// converts a *api.NodePool struct to the corresponding model generated from
+// the cluster-registry swagger spec.
+func convertToNodePoolModel(nodePool *api.NodePool) *models.NodePool {
+	return &models.NodePool{
+		DiscountStrategy: &nodePool.DiscountStrategy,
+		InstanceType:     &nodePool.InstanceType,
+		Name:             &nodePool.Name,
+		Profile:          &nodePool.Profile,
+		MinSize:          &nodePool.MinSize,
+		MaxSize:          &nodePool.MaxSize,
+		ConfigItems:      nodePool.ConfigItems,
+		Status:           convertToNodePoolStatusModel(nodePool.Status),
+	}
+}
+
+// converts a *api.NodePoolStatus struct to the corresponding model generated
+// from the cluster-registry swagger spec.
+func convertToNodePoolStatusModel(status *api.NodePoolStatus) *models.NodePoolStatus {
+	if status == nil {
+		return nil
+	}
+
+	result := &models.NodePoolStatus{
+		CurrentSize:   status.CurrentSize,
+		InstanceTypes: status.InstanceTypes,
+		Images:        status.Images,
+		LastUpdated:   strfmt.DateTime(status.LastUpdated),
+	}
+
+	if substitution := status.InstanceTypeSubstitution; substitution != nil {
+		result.InstanceTypeSubstitution = &models.InstanceTypeSubstitution{
+			InstanceType: substitution.InstanceType,
+			Substitute:   substitution.Substitute,
+			Reason:       substitution.Reason,
+		}
+	}
+	return result
+}
+
 // converts a *api.ClusterStatus struct to the corresponding model generated
 // from the cluster-registry swagger spec.
 func convertToClusterStatusModel(status *api.ClusterStatus) *models.ClusterStatus {
@@ -226,10 +394,29 @@ func convertToClusterStatusModel(status *api.ClusterStatus) *models.ClusterStatu
 	}
 
 	return &models.ClusterStatus{
-		CurrentVersion: status.CurrentVersion,
-		LastVersion:    status.LastVersion,
-		NextVersion:    status.NextVersion,
-		Problems:       problems,
+		CurrentVersion:   status.CurrentVersion,
+		LastVersion:      status.LastVersion,
+		NextVersion:      status.NextVersion,
+		Problems:         problems,
+		AuditLog:         status.AuditLog,
+		CostEstimate:     convertToCostEstimateModel(status.CostEstimate),
+		ForceDeletedPods: status.ForceDeletedPods,
+		Degraded:         status.Degraded,
+		QuarantinedUntil: status.QuarantinedUntil,
+	}
+}
+
+// converts a *api.CostEstimate struct to the corresponding model generated
+// from the cluster-registry swagger spec.
+func convertToCostEstimateModel(estimate *api.CostEstimate) *models.ClusterStatusCostEstimate {
+	if estimate == nil {
+		return nil
+	}
+
+	return &models.ClusterStatusCostEstimate{
+		MinMonthly: estimate.MinMonthly,
+		MaxMonthly: estimate.MaxMonthly,
+		Currency:   estimate.Currency,
 	}
 }
 
@@ -18,6 +18,8 @@ type Filter struct {
 type Registry interface {
 	ListClusters(filter Filter) ([]*api.Cluster, error)
 	UpdateCluster(cluster *api.Cluster) error
+	CreateCluster(cluster *api.Cluster) error
+	UpdateNodePoolStatus(cluster *api.Cluster, nodePool *api.NodePool) error
 }
 
 // NewRegistry initializes a new registry source based on the uri.
@@ -29,7 +31,11 @@ func NewRegistry(uri string, tokenSource oauth2.TokenSource, options *Options) R
 
 	switch url.Scheme {
 	case "http", "https":
-		return NewHTTPRegistry(url, tokenSource, options)
+		registry, err := NewHTTPRegistry(url, tokenSource, options)
+		if err != nil {
+			log.Fatalf("failed to setup registry: %v", err)
+		}
+		return registry
 	case "file", "":
 		return NewFileRegistry(url.Host + url.Path)
 	default:
@@ -29,3 +29,11 @@ func (r *staticRegistry) ListClusters(filter Filter) ([]*api.Cluster, error) {
 func (r *staticRegistry) UpdateCluster(cluster *api.Cluster) error {
 	return nil
 }
+
+func (r *staticRegistry) CreateCluster(cluster *api.Cluster) error {
+	return nil
+}
+
+func (r *staticRegistry) UpdateNodePoolStatus(cluster *api.Cluster, nodePool *api.NodePool) error {
+	return nil
+}